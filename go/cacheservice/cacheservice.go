@@ -108,3 +108,11 @@ func Connect(config Config) (CacheService, error) {
 	}
 	return fn(config)
 }
+
+// IsRegistered returns true if a cache service is registered as name.
+func IsRegistered(name string) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := services[name]
+	return ok
+}
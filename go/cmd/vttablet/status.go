@@ -161,6 +161,34 @@ Binlog player state: {{.State}}</br>
 {{else}}
 No binlog player is running.
 {{end}}
+`
+
+	// backupSchedulerTemplate is about the scheduled backups
+	backupSchedulerTemplate = `
+Backups are taken on schedule <b>{{.Schedule}}</b> (UTC), while the tablet type is {{.TabletType}}.<br>
+{{if .Running}}
+A backup is running since {{.Running.Start}}.<br>
+{{else if not .Next.IsZero}}
+Next backup: {{.Next}}<br>
+{{end}}
+{{if .Runs}}
+<table>
+  <tr>
+    <th>Start</th>
+    <th>Duration</th>
+    <th>Result</th>
+  </tr>
+  {{range .Runs}}
+    <tr>
+      <td>{{.Start}}</td>
+      <td>{{.Duration}}</td>
+      <td>{{.Result}}</td>
+    </tr>
+  {{end}}
+</table>
+{{else}}
+No backup was scheduled yet.
+{{end}}
 `
 )
 
@@ -215,6 +243,11 @@ func addStatusParts(qsc tabletserver.Controller) {
 	servenv.AddStatusPart("Binlog Player", binlogTemplate, func() interface{} {
 		return agent.BinlogPlayerMap.Status()
 	})
+	if agent.BackupScheduler != nil {
+		servenv.AddStatusPart("Backup Scheduler", backupSchedulerTemplate, func() interface{} {
+			return agent.BackupScheduler.Status()
+		})
+	}
 	if onStatusRegistered != nil {
 		onStatusRegistered()
 	}
@@ -0,0 +1,188 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron parses cron schedules, and computes when they fire.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// descriptors are the shorthands for common schedules.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// field describes one of the five fields of a schedule.
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 0 and 7 are both Sunday.
+	{"day of week", 0, 7},
+}
+
+// Schedule is a parsed cron schedule. It fires at the minutes that
+// match all its fields. As with the cron daemon, if both the day of
+// month and the day of week are restricted, a day matches if either
+// of them does.
+type Schedule struct {
+	spec string
+
+	// The bit i of each set is 1 if the value i matches.
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar are true if the day fields are '*'.
+	domStar, dowStar bool
+}
+
+// Parse parses a schedule in the standard cron format: five
+// fields separated by spaces, for the minute, hour, day of month,
+// month and day of week. Each field is '*', or a comma separated
+// list of values and ranges like '1-5', that can have a step like
+// '*/15' or '0-30/10'. Names of months and days are not supported.
+// The descriptors @yearly, @monthly, @weekly, @daily and @hourly
+// are supported too.
+func Parse(spec string) (*Schedule, error) {
+	s := &Schedule{spec: spec}
+	expanded := strings.TrimSpace(spec)
+	if d, ok := descriptors[expanded]; ok {
+		expanded = d
+	}
+	parts := strings.Fields(expanded)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("invalid cron schedule %q: it has %v fields, want %v", spec, len(parts), len(fields))
+	}
+	sets := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, f := range fields {
+		set, err := parseField(parts[i], f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron schedule %q: %v", spec, err)
+		}
+		*sets[i] = set
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar = parts[2] == "*"
+	s.dowStar = parts[4] == "*"
+	return s, nil
+}
+
+// parseField returns the set of values that match a field.
+func parseField(value string, f field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(value, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %v field %q", f.name, item)
+			}
+			item = item[:i]
+		}
+
+		var low, high int
+		switch {
+		case item == "*":
+			low, high = f.min, f.max
+		case strings.Contains(item, "-"):
+			bounds := strings.SplitN(item, "-", 2)
+			var err1, err2 error
+			low, err1 = strconv.Atoi(bounds[0])
+			high, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range in %v field %q", f.name, item)
+			}
+		default:
+			var err error
+			low, err = strconv.Atoi(item)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %v field %q", f.name, item)
+			}
+			high = low
+			// A step on a value goes until the maximum.
+			if step > 1 {
+				high = f.max
+			}
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("%v field %q is out of the range %v-%v", f.name, item, f.min, f.max)
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// String returns the schedule as it was parsed.
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Next returns the first time strictly after t at which the schedule
+// fires, in the location of t. It returns the zero time if the
+// schedule never fires, like on February 30th.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+
+	// A schedule that can fire fires at least once every 8 years,
+	// for February 29th.
+	end := t.AddDate(9, 0, 0)
+	for t.Before(end) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !s.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, loc)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchDay returns true if the day of t matches the schedule.
+func (s *Schedule) matchDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// 2018-06-01 is a Friday.
+	from := time.Date(2018, 6, 1, 12, 34, 56, 0, time.UTC)
+	testcases := []struct {
+		spec string
+		want string
+	}{{
+		spec: "* * * * *",
+		want: "2018-06-01 12:35",
+	}, {
+		spec: "0 3 * * *",
+		want: "2018-06-02 03:00",
+	}, {
+		spec: "@daily",
+		want: "2018-06-02 00:00",
+	}, {
+		spec: "@hourly",
+		want: "2018-06-01 13:00",
+	}, {
+		spec: "*/15 * * * *",
+		want: "2018-06-01 12:45",
+	}, {
+		spec: "10-50/20 12 * * *",
+		want: "2018-06-01 12:50",
+	}, {
+		spec: "0 0 * * 0",
+		want: "2018-06-03 00:00",
+	}, {
+		// 7 is Sunday too.
+		spec: "0 0 * * 7",
+		want: "2018-06-03 00:00",
+	}, {
+		spec: "30 2 1,15 * *",
+		want: "2018-06-15 02:30",
+	}, {
+		// Either the day of month or the day of week matches.
+		spec: "0 0 15 * 6",
+		want: "2018-06-02 00:00",
+	}, {
+		spec: "0 0 1 1 *",
+		want: "2019-01-01 00:00",
+	}, {
+		spec: "0 0 29 2 *",
+		want: "2020-02-29 00:00",
+	}}
+	for _, tcase := range testcases {
+		s, err := Parse(tcase.spec)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tcase.spec, err)
+			continue
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != tcase.want {
+			t.Errorf("Parse(%q).Next(%v): %v, want %v", tcase.spec, from, got, tcase.want)
+		}
+	}
+
+	// A schedule that matches t fires at the next match.
+	s, err := Parse("34 12 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Next(from), time.Date(2018, 6, 2, 12, 34, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Next(%v): %v, want %v", from, got, want)
+	}
+
+	// A schedule that never fires.
+	s, err = Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(from); !got.IsZero() {
+		t.Errorf("Next(%v): %v, want the zero time", from, got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		spec string
+		err  string
+	}{{
+		spec: "* * * *",
+		err:  "it has 4 fields, want 5",
+	}, {
+		spec: "60 * * * *",
+		err:  "minute field \"60\" is out of the range 0-59",
+	}, {
+		spec: "* * 0 * *",
+		err:  "day of month field \"0\" is out of the range 1-31",
+	}, {
+		spec: "* 5-2 * * *",
+		err:  "hour field \"5-2\" is out of the range 0-23",
+	}, {
+		spec: "*/0 * * * *",
+		err:  "invalid step in minute field",
+	}, {
+		spec: "* * * jan *",
+		err:  "invalid value in month field \"jan\"",
+	}, {
+		spec: "@often",
+		err:  "it has 1 fields, want 5",
+	}}
+	for _, tcase := range testcases {
+		_, err := Parse(tcase.spec)
+		if err == nil || !strings.Contains(err.Error(), tcase.err) {
+			t.Errorf("Parse(%q): %v, want %v", tcase.spec, err, tcase.err)
+		}
+	}
+}
@@ -18,9 +18,17 @@ package mysql
 
 import (
 	"crypto/rand"
+	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"sync"
+	"time"
 
 	log "github.com/golang/glog"
 )
@@ -38,6 +46,13 @@ import (
 // can authenticate using any method. If SSL is not used, it means the
 // password is sent in the clear. That may not be suitable for some
 // use cases.
+//
+// The caching_sha2_password method uses both: the client first sends
+// a SHA256 hash of the password, checked by ValidateHash. If that
+// fails, the server asks for the password, that is then read by
+// Negotiate. The sha256_password method only uses Negotiate. With
+// both methods, the password is sent over TLS, or encrypted with the
+// RSA key of the Listener.
 type AuthServer interface {
 	// AuthMethod returns the authentication method to use for the
 	// given user. If this returns MysqlNativePassword
@@ -60,11 +75,16 @@ type AuthServer interface {
 
 	// ValidateHash validates the data sent by the client matches
 	// what the server computes.  It also returns the user data.
+	// It is called if AuthMethod returns MysqlNativePassword or
+	// MysqlCachingSha2Password, and the hash is computed with
+	// scramblePassword or scrambleCachingSha2Password respectively.
 	ValidateHash(salt []byte, user string, authResponse []byte, remoteAddr net.Addr) (Getter, error)
 
 	// Negotiate is called if AuthMethod returns anything else
 	// than MysqlNativePassword. It is handed the connection after the
-	// AuthSwitchRequest packet is sent.
+	// AuthSwitchRequest packet is sent (or, for
+	// MysqlCachingSha2Password, after ValidateHash failed and the
+	// client was asked for the password).
 	// - If the negotiation fails, it should just return an error
 	// (should be a SQLError if possible).
 	// The framework is responsible for writing the Error packet
@@ -198,3 +218,249 @@ func AuthServerNegotiateClearOrDialog(c *Conn, method string) (string, error) {
 		return "", fmt.Errorf("unrecognized method: %v", method)
 	}
 }
+
+// Constants for the caching_sha2_password and sha256_password plugins.
+const (
+	// cachingSha2FastAuth is sent in an AuthMoreData packet when
+	// the hash sent by the client was validated.
+	cachingSha2FastAuth = 0x03
+
+	// cachingSha2FullAuth is sent in an AuthMoreData packet when
+	// the hash could not be validated: the client must then send
+	// its password.
+	cachingSha2FullAuth = 0x04
+
+	// cachingSha2RequestPublicKey and sha256RequestPublicKey are
+	// sent by the client to get the RSA public key of the server.
+	cachingSha2RequestPublicKey = 0x02
+	sha256RequestPublicKey      = 0x01
+)
+
+// scrambleCachingSha2Password computes the hash of the password using
+// the caching_sha2_password method:
+// XOR(SHA256(password), SHA256(SHA256(SHA256(password)), salt)).
+func scrambleCachingSha2Password(salt, password []byte) []byte {
+	if len(password) == 0 {
+		return nil
+	}
+
+	// stage1 = SHA256(password)
+	crypt := sha256.New()
+	crypt.Write(password)
+	stage1 := crypt.Sum(nil)
+
+	// stage2 = SHA256(stage1)
+	crypt.Reset()
+	crypt.Write(stage1)
+	stage2 := crypt.Sum(nil)
+
+	return xorCachingSha2Scramble(salt, stage1, stage2)
+}
+
+// xorCachingSha2Scramble returns XOR(stage1, SHA256(stage2, salt)).
+// It is its own inverse: applied to a scramble instead of stage1, it
+// returns stage1.
+func xorCachingSha2Scramble(salt, stage1, stage2 []byte) []byte {
+	crypt := sha256.New()
+	crypt.Write(stage2)
+	crypt.Write(salt)
+	scramble := crypt.Sum(nil)
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
+
+// CachingSha2Cache is the scramble cache of the caching_sha2_password
+// method. It remembers a hash of the password of the users that
+// completed a full authentication, so their next connections can be
+// authenticated from the hash sent by the client, without the
+// password. It is meant for AuthServer implementations that cannot
+// validate the hash themselves. A nil CachingSha2Cache caches nothing.
+type CachingSha2Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachingSha2Entry
+}
+
+type cachingSha2Entry struct {
+	// stage2 is SHA256(SHA256(password)).
+	stage2 []byte
+	added  time.Time
+}
+
+// NewCachingSha2Cache returns a CachingSha2Cache. Its entries are
+// valid for ttl, or forever if ttl is 0.
+func NewCachingSha2Cache(ttl time.Duration) *CachingSha2Cache {
+	return &CachingSha2Cache{
+		ttl:     ttl,
+		entries: make(map[string]cachingSha2Entry),
+	}
+}
+
+// Add remembers the password of user. It must only be called once the
+// password was validated.
+func (csc *CachingSha2Cache) Add(user, password string) {
+	if csc == nil {
+		return
+	}
+	stage1 := sha256.Sum256([]byte(password))
+	stage2 := sha256.Sum256(stage1[:])
+	csc.mu.Lock()
+	defer csc.mu.Unlock()
+	csc.entries[user] = cachingSha2Entry{
+		stage2: stage2[:],
+		added:  time.Now(),
+	}
+}
+
+// Remove forgets the password of user.
+func (csc *CachingSha2Cache) Remove(user string) {
+	if csc == nil {
+		return
+	}
+	csc.mu.Lock()
+	defer csc.mu.Unlock()
+	delete(csc.entries, user)
+}
+
+// Validate returns true if authResponse is the caching_sha2_password
+// hash of the cached password of user, computed with salt.
+func (csc *CachingSha2Cache) Validate(salt []byte, user string, authResponse []byte) bool {
+	if csc == nil || len(authResponse) != sha256.Size {
+		return false
+	}
+	csc.mu.Lock()
+	entry, ok := csc.entries[user]
+	if ok && csc.ttl != 0 && time.Since(entry.added) > csc.ttl {
+		delete(csc.entries, user)
+		ok = false
+	}
+	csc.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	// The client sent XOR(stage1, SHA256(stage2, salt)): recover
+	// stage1 and check that it hashes to stage2.
+	stage1 := xorCachingSha2Scramble(salt, authResponse, entry.stage2)
+	stage2 := sha256.Sum256(stage1)
+	return subtle.ConstantTimeCompare(stage2[:], entry.stage2) == 1
+}
+
+// AuthServerNegotiatePassword will finish a negotiation based on the
+// method type for the connection, and return the password sent by
+// the client. It supports MysqlClearPassword, MysqlDialog,
+// MysqlCachingSha2Password and MysqlSha256Password.
+func AuthServerNegotiatePassword(c *Conn, method string) (string, error) {
+	switch method {
+	case MysqlCachingSha2Password, MysqlSha256Password:
+		return c.readSha2Password(method)
+	default:
+		return AuthServerNegotiateClearOrDialog(c, method)
+	}
+}
+
+// isSecure returns true if the password can be sent in the clear
+// on the connection: it is using TLS, or a unix socket.
+func (c *Conn) isSecure() bool {
+	if c.Capabilities&CapabilityClientSSL != 0 {
+		return true
+	}
+	_, ok := c.conn.RemoteAddr().(*net.UnixAddr)
+	return ok
+}
+
+// readSha2Password reads the password sent by the client for the
+// caching_sha2_password full authentication, or for sha256_password.
+// Over a secure connection, the client sends it in the clear.
+// Otherwise, it encrypts it with the RSA public key of the server,
+// which it may request first.
+func (c *Conn) readSha2Password(method string) (string, error) {
+	data, err := c.ReadPacket()
+	if err != nil {
+		return "", err
+	}
+	if c.isSecure() {
+		if len(data) == 0 || data[len(data)-1] != 0 {
+			return "", fmt.Errorf("received invalid response packet, datalen=%v", len(data))
+		}
+		return string(data[:len(data)-1]), nil
+	}
+
+	if c.rsaKey == nil {
+		return "", NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "Cannot use %v authentication over non-SSL connections without a server RSA key.", method)
+	}
+	requestPublicKey := byte(cachingSha2RequestPublicKey)
+	if method == MysqlSha256Password {
+		requestPublicKey = sha256RequestPublicKey
+	}
+	if len(data) == 1 && data[0] == requestPublicKey {
+		publicKey, err := x509.MarshalPKIXPublicKey(&c.rsaKey.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		if err := c.writeAuthMoreData(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})); err != nil {
+			return "", err
+		}
+		data, err = c.ReadPacket()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, c.rsaKey, data, nil)
+	if err != nil {
+		return "", NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "cannot decrypt password: %v", err)
+	}
+	xorSalt(plain, c.salt)
+	if len(plain) == 0 || plain[len(plain)-1] != 0 {
+		return "", fmt.Errorf("received invalid encrypted password, datalen=%v", len(plain))
+	}
+	return string(plain[:len(plain)-1]), nil
+}
+
+// encryptPassword encrypts a password for caching_sha2_password or
+// sha256_password, with the RSA public key of the server.
+func encryptPassword(password string, salt []byte, publicKey *rsa.PublicKey) ([]byte, error) {
+	plain := make([]byte, len(password)+1)
+	copy(plain, password)
+	xorSalt(plain, salt)
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, plain, nil)
+}
+
+// xorSalt XORs data with salt, repeated as many times as needed.
+func xorSalt(data, salt []byte) {
+	if len(salt) == 0 {
+		return
+	}
+	for i := range data {
+		data[i] ^= salt[i%len(salt)]
+	}
+}
+
+// ReadRSAPrivateKey reads a PEM encoded RSA private key from a file,
+// for use as the Listener RSAKey.
+func ReadRSAPrivateKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %v", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse private key in %v: %v", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %v is not a RSA key", file)
+	}
+	return rsaKey, nil
+}
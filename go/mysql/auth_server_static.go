@@ -32,6 +32,7 @@ import (
 var (
 	mysqlAuthServerStaticFile   = flag.String("mysql_auth_server_static_file", "", "JSON File to read the users/passwords from.")
 	mysqlAuthServerStaticString = flag.String("mysql_auth_server_static_string", "", "JSON representation of the users/passwords config.")
+	mysqlAuthServerStaticMethod = flag.String("mysql_auth_server_static_method", MysqlNativePassword, "client-side authentication method to use. Supported values: mysql_native_password, mysql_clear_password, dialog, caching_sha2_password, sha256_password.")
 )
 
 const (
@@ -44,6 +45,8 @@ type AuthServerStatic struct {
 	// - MysqlNativePassword
 	// - MysqlClearPassword
 	// - MysqlDialog
+	// - MysqlCachingSha2Password
+	// - MysqlSha256Password
 	// It defaults to MysqlNativePassword.
 	Method string
 
@@ -71,6 +74,12 @@ func InitAuthServerStatic() {
 		log.Exitf("Both mysql_auth_server_static_file and mysql_auth_server_static_string specified, can only use one.")
 	}
 
+	switch *mysqlAuthServerStaticMethod {
+	case MysqlNativePassword, MysqlClearPassword, MysqlDialog, MysqlCachingSha2Password, MysqlSha256Password:
+	default:
+		log.Exitf("Invalid mysql_auth_server_static_method value: %v", *mysqlAuthServerStaticMethod)
+	}
+
 	// Create and register auth server.
 	RegisterAuthServerStaticFromParams(*mysqlAuthServerStaticFile, *mysqlAuthServerStaticString)
 }
@@ -89,6 +98,7 @@ func NewAuthServerStatic() *AuthServerStatic {
 // of error.
 func RegisterAuthServerStaticFromParams(file, str string) {
 	authServerStatic := NewAuthServerStatic()
+	authServerStatic.Method = *mysqlAuthServerStaticMethod
 	jsonConfig := []byte(str)
 	if file != "" {
 		data, err := ioutil.ReadFile(file)
@@ -159,7 +169,12 @@ func (a *AuthServerStatic) ValidateHash(salt []byte, user string, authResponse [
 	}
 
 	for _, entry := range entries {
-		computedAuthResponse := scramblePassword(salt, []byte(entry.Password))
+		var computedAuthResponse []byte
+		if a.Method == MysqlCachingSha2Password {
+			computedAuthResponse = scrambleCachingSha2Password(salt, []byte(entry.Password))
+		} else {
+			computedAuthResponse = scramblePassword(salt, []byte(entry.Password))
+		}
 		// Validate the password.
 		if matchSourceHost(remoteAddr, entry.SourceHost) && bytes.Compare(authResponse, computedAuthResponse) == 0 {
 			return &StaticUserData{entry.UserData}, nil
@@ -170,10 +185,11 @@ func (a *AuthServerStatic) ValidateHash(salt []byte, user string, authResponse [
 
 // Negotiate is part of the AuthServer interface.
 // It will be called if Method is anything else than MysqlNativePassword.
-// We only recognize MysqlClearPassword and MysqlDialog here.
+// We recognize MysqlClearPassword, MysqlDialog, MysqlCachingSha2Password
+// and MysqlSha256Password here.
 func (a *AuthServerStatic) Negotiate(c *Conn, user string, remoteAddr net.Addr) (Getter, error) {
 	// Finish the negotiation.
-	password, err := AuthServerNegotiateClearOrDialog(c, a.Method)
+	password, err := AuthServerNegotiatePassword(c, a.Method)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCachingSha2Cache(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatalf("NewSalt failed: %v", err)
+	}
+	scramble := scrambleCachingSha2Password(salt, []byte("password1"))
+
+	csc := NewCachingSha2Cache(0)
+	if csc.Validate(salt, "user1", scramble) {
+		t.Errorf("Validate succeeded before Add")
+	}
+	csc.Add("user1", "password1")
+	if !csc.Validate(salt, "user1", scramble) {
+		t.Errorf("Validate failed after Add")
+	}
+	if csc.Validate(salt, "user2", scramble) {
+		t.Errorf("Validate succeeded for another user")
+	}
+	if csc.Validate(salt, "user1", scrambleCachingSha2Password(salt, []byte("bad"))) {
+		t.Errorf("Validate succeeded for a bad password")
+	}
+	otherSalt, err := NewSalt()
+	if err != nil {
+		t.Fatalf("NewSalt failed: %v", err)
+	}
+	if csc.Validate(otherSalt, "user1", scramble) {
+		t.Errorf("Validate succeeded with another salt")
+	}
+	csc.Remove("user1")
+	if csc.Validate(salt, "user1", scramble) {
+		t.Errorf("Validate succeeded after Remove")
+	}
+
+	// Entries expire.
+	csc = NewCachingSha2Cache(time.Nanosecond)
+	csc.Add("user1", "password1")
+	time.Sleep(time.Millisecond)
+	if csc.Validate(salt, "user1", scramble) {
+		t.Errorf("Validate succeeded after the ttl")
+	}
+
+	// A nil cache caches nothing.
+	csc = nil
+	csc.Add("user1", "password1")
+	if csc.Validate(salt, "user1", scramble) {
+		t.Errorf("Validate succeeded with a nil cache")
+	}
+}
@@ -17,7 +17,10 @@ limitations under the License.
 package mysql
 
 import (
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"net"
 	"strconv"
@@ -274,20 +277,30 @@ func (c *Conn) clientHandshake(characterSet uint8, params *ConnParams) error {
 		c.User = params.Uname
 	case AuthSwitchRequestPacket:
 		// Server is asking to use a different auth method. We
-		// only support cleartext plugin.
-		pluginName, _, err := parseAuthSwitchRequest(response)
+		// support the cleartext, caching_sha2_password and
+		// sha256_password plugins.
+		pluginName, pluginData, err := parseAuthSwitchRequest(response)
 		if err != nil {
 			return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "cannot parse auth switch request: %v", err)
 		}
-		if pluginName != MysqlClearPassword {
+		switch pluginName {
+		case MysqlClearPassword:
+			// Write the password packet.
+			if err := c.writeClearTextPassword(params); err != nil {
+				return err
+			}
+		case MysqlCachingSha2Password, MysqlSha256Password:
+			// The plugin data is the salt, 0 terminated.
+			if len(pluginData) > 0 && pluginData[len(pluginData)-1] == 0 {
+				pluginData = pluginData[:len(pluginData)-1]
+			}
+			if err := c.clientSha2Auth(pluginName, pluginData, params); err != nil {
+				return err
+			}
+		default:
 			return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "server asked for unsupported auth method: %v", pluginName)
 		}
 
-		// Write the password packet.
-		if err := c.writeClearTextPassword(params); err != nil {
-			return err
-		}
-
 		// Wait for OK packet.
 		response, err = c.readPacket()
 		if err != nil {
@@ -611,6 +624,84 @@ func parseAuthSwitchRequest(data []byte) (string, []byte, error) {
 	return pluginName, data[pos:], nil
 }
 
+// clientSha2Auth handles the client side of the caching_sha2_password
+// and sha256_password methods, after the server switched to them.
+// On success, the next packet sent by the server is the OK packet.
+// Returns a SQLError.
+func (c *Conn) clientSha2Auth(method string, salt []byte, params *ConnParams) error {
+	requestPublicKey := byte(sha256RequestPublicKey)
+	if method == MysqlCachingSha2Password {
+		requestPublicKey = cachingSha2RequestPublicKey
+
+		// Start with the fast authentication.
+		if err := c.writeAuthResponse(scrambleCachingSha2Password(salt, []byte(params.Pass))); err != nil {
+			return err
+		}
+		response, err := c.readPacket()
+		if err != nil {
+			return NewSQLError(CRServerLost, SSUnknownSQLState, "%v", err)
+		}
+		switch {
+		case response[0] == ErrPacket:
+			return ParseErrorPacket(response)
+		case len(response) != 2 || response[0] != AuthMoreDataPacket:
+			return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "caching_sha2_password response cannot be parsed: %v", response)
+		case response[1] == cachingSha2FastAuth:
+			return nil
+		case response[1] != cachingSha2FullAuth:
+			return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "caching_sha2_password response cannot be parsed: %v", response)
+		}
+	}
+
+	// Full authentication: send the password, in the clear if the
+	// connection is secure, or encrypted with the server public key.
+	if c.isSecure() {
+		return c.writeClearTextPassword(params)
+	}
+	if err := c.writeAuthResponse([]byte{requestPublicKey}); err != nil {
+		return err
+	}
+	response, err := c.readPacket()
+	if err != nil {
+		return NewSQLError(CRServerLost, SSUnknownSQLState, "%v", err)
+	}
+	switch response[0] {
+	case AuthMoreDataPacket:
+	case ErrPacket:
+		return ParseErrorPacket(response)
+	default:
+		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "public key response cannot be parsed: %v", response)
+	}
+	block, _ := pem.Decode(response[1:])
+	if block == nil {
+		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "server sent an invalid public key: %v", response)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "server sent an invalid public key: %v", err)
+	}
+	rsaPublicKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "server sent a public key that is not a RSA key")
+	}
+	encrypted, err := encryptPassword(params.Pass, salt, rsaPublicKey)
+	if err != nil {
+		return NewSQLError(CRServerHandshakeErr, SSUnknownSQLState, "cannot encrypt password: %v", err)
+	}
+	return c.writeAuthResponse(encrypted)
+}
+
+// writeAuthResponse writes a packet of auth data, during a negotiation.
+// Returns a SQLError.
+func (c *Conn) writeAuthResponse(authData []byte) error {
+	data := c.startEphemeralPacket(len(authData))
+	copy(data, authData)
+	if err := c.writeEphemeralPacket(true); err != nil {
+		return NewSQLError(CRServerLost, SSUnknownSQLState, "cannot send auth response: %v", err)
+	}
+	return nil
+}
+
 // writeClearTextPassword writes the clear text password.
 // Returns a SQLError.
 func (c *Conn) writeClearTextPassword(params *ConnParams) error {
@@ -18,6 +18,7 @@ package mysql
 
 import (
 	"bufio"
+	"crypto/rsa"
 	"fmt"
 	"io"
 	"net"
@@ -143,6 +144,22 @@ type Conn struct {
 	// avoid maps indexed by ConnectionID for instance.
 	ClientData interface{}
 
+	// PrepareData is the map of prepared statements, indexed by
+	// statement ID. It is only used by the server, and maintained
+	// by the COM_STMT_* commands.
+	PrepareData map[uint32]*PrepareData
+
+	// StatementID is the ID of the last statement prepared on this
+	// connection. It is only used by the server.
+	StatementID uint32
+
+	// salt is the data the server sent in its handshake, and rsaKey
+	// is the RSA key of the server. They are only used by the server,
+	// to decrypt the password sent by caching_sha2_password and
+	// sha256_password clients.
+	salt   []byte
+	rsaKey *rsa.PrivateKey
+
 	// Packet encoding variables.
 	reader   *bufio.Reader
 	writer   *bufio.Writer
@@ -186,6 +203,48 @@ type Conn struct {
 	currentEphemeralBuffer *[]byte
 }
 
+// PrepareData holds the state of a server-side prepared statement,
+// between the COM_STMT_PREPARE that created it and the COM_STMT_CLOSE
+// that releases it.
+type PrepareData struct {
+	// StatementID is the ID sent back to the client.
+	StatementID uint32
+
+	// PrepareStmt is the query, as sent by the client. Each '?'
+	// placeholder is parsed by sqlparser as a ':v<N>' bind variable,
+	// starting at ':v1'.
+	PrepareStmt string
+
+	// ParamsCount is the number of '?' placeholders in PrepareStmt.
+	ParamsCount uint16
+
+	// ParamsType contains the MySQL type of each parameter, as
+	// sent by the client in the last COM_STMT_EXECUTE that bound
+	// new types. The unsigned flag is stored in the upper byte.
+	ParamsType []int32
+
+	// ColumnNames are the names of the columns returned by the
+	// statement, if any.
+	ColumnNames []string
+
+	// BindVars contains the parameter values for the next
+	// execution, as 'v1', 'v2', ... bind variables.
+	BindVars map[string]*querypb.BindVariable
+
+	// longData records which parameters received their value
+	// through COM_STMT_SEND_LONG_DATA since the last execution.
+	longData map[uint16]bool
+}
+
+// clearLongData discards the values received through
+// COM_STMT_SEND_LONG_DATA.
+func (prepare *PrepareData) clearLongData() {
+	for paramID := range prepare.longData {
+		delete(prepare.BindVars, fmt.Sprintf("v%d", paramID+1))
+		delete(prepare.longData, paramID)
+	}
+}
+
 // bufPool is used to allocate and free buffers in an efficient way.
 var bufPool = sync.Pool{}
 
@@ -199,6 +258,8 @@ func newConn(conn net.Conn) *Conn {
 		writer:   bufio.NewWriterSize(conn, connBufferSize),
 		sequence: 0,
 		buffer:   make([]byte, connBufferSize),
+
+		PrepareData: make(map[uint32]*PrepareData),
 	}
 }
 
@@ -37,6 +37,16 @@ const (
 	// MysqlDialog uses the dialog plugin on the client side.
 	// It transmits data in the clear.
 	MysqlDialog = "dialog"
+
+	// MysqlCachingSha2Password uses a salt and transmits a SHA256
+	// hash on the wire. If the server cannot check the hash, the
+	// password is sent over TLS, or encrypted with the RSA key of
+	// the server.
+	MysqlCachingSha2Password = "caching_sha2_password"
+
+	// MysqlSha256Password transmits the password over TLS, or
+	// encrypted with the RSA key of the server.
+	MysqlSha256Password = "sha256_password"
 )
 
 // Capability flags.
@@ -157,6 +167,21 @@ const (
 	// ComBinlogDump is COM_BINLOG_DUMP.
 	ComBinlogDump = 0x12
 
+	// ComPrepare is COM_STMT_PREPARE.
+	ComPrepare = 0x16
+
+	// ComStmtExecute is COM_STMT_EXECUTE.
+	ComStmtExecute = 0x17
+
+	// ComStmtSendLongData is COM_STMT_SEND_LONG_DATA.
+	ComStmtSendLongData = 0x18
+
+	// ComStmtClose is COM_STMT_CLOSE.
+	ComStmtClose = 0x19
+
+	// ComStmtReset is COM_STMT_RESET.
+	ComStmtReset = 0x1a
+
 	// ComBinlogDumpGTID is COM_BINLOG_DUMP_GTID.
 	ComBinlogDumpGTID = 0x1e
 
@@ -169,6 +194,10 @@ const (
 	// AuthSwitchRequestPacket is used to switch auth method.
 	AuthSwitchRequestPacket = 0xfe
 
+	// AuthMoreDataPacket is used to send extra data during the
+	// negotiation of an auth method.
+	AuthMoreDataPacket = 0x01
+
 	// ErrPacket is the header of the error packet.
 	ErrPacket = 0xff
 
@@ -307,6 +336,7 @@ const (
 	ERNoDefault                     = 1230
 	EROperandColumns                = 1241
 	ERSubqueryNo1Row                = 1242
+	ERUnknownStmtHandler            = 1243
 	ERNonUpdateableTable            = 1288
 	ERFeatureDisabled               = 1289
 	EROptionPreventsStatement       = 1290
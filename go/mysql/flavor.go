@@ -211,9 +211,10 @@ func resultToMap(qr *sqltypes.Result) (map[string]string, error) {
 // parseSlaveStatus parses the common fields of SHOW SLAVE STATUS.
 func parseSlaveStatus(fields map[string]string) SlaveStatus {
 	status := SlaveStatus{
-		MasterHost:      fields["Master_Host"],
-		SlaveIORunning:  fields["Slave_IO_Running"] == "Yes",
-		SlaveSQLRunning: fields["Slave_SQL_Running"] == "Yes",
+		MasterHost:        fields["Master_Host"],
+		SlaveIORunning:    fields["Slave_IO_Running"] == "Yes",
+		SlaveIOConnecting: fields["Slave_IO_Running"] == "Connecting",
+		SlaveSQLRunning:   fields["Slave_SQL_Running"] == "Yes",
 	}
 	parseInt, _ := strconv.ParseInt(fields["Master_Port"], 10, 0)
 	status.MasterPort = int(parseInt)
@@ -127,6 +127,12 @@ func (mariadbFlavor) status(c *Conn) (SlaveStatus, error) {
 	if err != nil {
 		return SlaveStatus{}, fmt.Errorf("SlaveStatus can't parse MariaDB GTID (Gtid_Slave_Pos: %#v): %v", resultMap["Gtid_Slave_Pos"], err)
 	}
+	if resultMap["Gtid_IO_Pos"] != "" {
+		status.RelayLogPosition.GTIDSet, err = parseMariadbGTIDSet(resultMap["Gtid_IO_Pos"])
+		if err != nil {
+			return SlaveStatus{}, fmt.Errorf("SlaveStatus can't parse MariaDB GTID (Gtid_IO_Pos: %#v): %v", resultMap["Gtid_IO_Pos"], err)
+		}
+	}
 	return status, nil
 }
 
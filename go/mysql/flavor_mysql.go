@@ -94,6 +94,13 @@ func (mysqlFlavor) status(c *Conn) (SlaveStatus, error) {
 	if err != nil {
 		return SlaveStatus{}, fmt.Errorf("SlaveStatus can't parse MySQL 5.6 GTID (Executed_Gtid_Set: %#v): %v", resultMap["Executed_Gtid_Set"], err)
 	}
+	// The relay logs can be purged once applied, so
+	// Retrieved_Gtid_Set may not contain the executed GTIDs.
+	retrieved, err := parseMysql56GTIDSet(resultMap["Retrieved_Gtid_Set"])
+	if err != nil {
+		return SlaveStatus{}, fmt.Errorf("SlaveStatus can't parse MySQL 5.6 GTID (Retrieved_Gtid_Set: %#v): %v", resultMap["Retrieved_Gtid_Set"], err)
+	}
+	status.RelayLogPosition.GTIDSet = status.Position.GTIDSet.(Mysql56GTIDSet).Union(retrieved)
 	return status, nil
 }
 
@@ -17,12 +17,15 @@ limitations under the License.
 package mysql
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
 	"io/ioutil"
 	"net"
 	"os"
 	"path"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -154,6 +157,12 @@ func TestSSLConnection(t *testing.T) {
 		authServer.Method = MysqlClearPassword
 		testSSLConnectionClearText(t, params)
 	})
+
+	// Over SSL, sha256_password sends the password in the clear.
+	t.Run("Sha256", func(t *testing.T) {
+		authServer.Method = MysqlSha256Password
+		testSSLConnectionBasics(t, params)
+	})
 }
 
 func testSSLConnectionClearText(t *testing.T, params *ConnParams) {
@@ -214,3 +223,252 @@ func testSSLConnectionBasics(t *testing.T, params *ConnParams) {
 	// Send a ComQuit to avoid the error message on the server side.
 	conn.writeComQuit()
 }
+
+// TestCachingSha2ClientAuth tests the fast and full authentication
+// paths of caching_sha2_password, without TLS.
+func TestCachingSha2ClientAuth(t *testing.T) {
+	th := &multiConnHandler{}
+
+	authServer := NewAuthServerStatic()
+	authServer.Method = MysqlCachingSha2Password
+	authServer.Entries["user1"] = []*AuthServerStaticEntry{
+		{Password: "password1"},
+	}
+
+	// Create the listener.
+	l, err := NewListener("tcp", ":0", authServer, th)
+	if err != nil {
+		t.Fatalf("NewListener failed: %v", err)
+	}
+	defer l.Close()
+	host := l.Addr().(*net.TCPAddr).IP.String()
+	port := l.Addr().(*net.TCPAddr).Port
+	go func() {
+		l.Accept()
+	}()
+
+	// Setup the right parameters.
+	params := &ConnParams{
+		Host:  host,
+		Port:  port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+
+	// The static auth server validates the hash: fast authentication.
+	ctx := context.Background()
+	conn, err := Connect(ctx, params)
+	if err != nil {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+	result, err := conn.ExecuteFetch("select rows", 10000, true)
+	if err != nil {
+		t.Fatalf("ExecuteFetch failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, selectRowsResult) {
+		t.Errorf("Got wrong result from ExecuteFetch(select rows): %v", result)
+	}
+	conn.writeComQuit()
+	conn.Close()
+
+	// With a bad password, the server asks for a full
+	// authentication, that needs an RSA key without TLS.
+	params.Pass = "bad"
+	_, err = Connect(ctx, params)
+	if err == nil || !strings.Contains(err.Error(), "Cannot use caching_sha2_password authentication over non-SSL connections without a server RSA key") {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+
+	// With an RSA key, the password is sent encrypted, and rejected.
+	l.RSAKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	_, err = Connect(ctx, params)
+	if err == nil || !strings.Contains(err.Error(), "Access denied for user 'user1'") {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+}
+
+// TestSha256ClientAuth tests sha256_password, with the password
+// encrypted with the RSA key of the server.
+func TestSha256ClientAuth(t *testing.T) {
+	th := &multiConnHandler{}
+
+	authServer := NewAuthServerStatic()
+	authServer.Method = MysqlSha256Password
+	authServer.Entries["user1"] = []*AuthServerStaticEntry{
+		{Password: "password1"},
+	}
+
+	// Create the listener.
+	l, err := NewListener("tcp", ":0", authServer, th)
+	if err != nil {
+		t.Fatalf("NewListener failed: %v", err)
+	}
+	defer l.Close()
+	host := l.Addr().(*net.TCPAddr).IP.String()
+	port := l.Addr().(*net.TCPAddr).Port
+	go func() {
+		l.Accept()
+	}()
+
+	// Setup the right parameters.
+	params := &ConnParams{
+		Host:  host,
+		Port:  port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+
+	// Connection should fail, as the server has no RSA key.
+	ctx := context.Background()
+	_, err = Connect(ctx, params)
+	if err == nil || !strings.Contains(err.Error(), "Cannot use sha256_password authentication over non-SSL connections without a server RSA key") {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+
+	l.RSAKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	conn, err := Connect(ctx, params)
+	if err != nil {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+	defer conn.Close()
+
+	// Run a 'select rows' command with results.
+	result, err := conn.ExecuteFetch("select rows", 10000, true)
+	if err != nil {
+		t.Fatalf("ExecuteFetch failed: %v", err)
+	}
+	if !reflect.DeepEqual(result, selectRowsResult) {
+		t.Errorf("Got wrong result from ExecuteFetch(select rows): %v", result)
+	}
+
+	// Send a ComQuit to avoid the error message on the server side.
+	conn.writeComQuit()
+
+	// Bad passwords are rejected.
+	params.Pass = "bad"
+	_, err = Connect(ctx, params)
+	if err == nil || !strings.Contains(err.Error(), "Access denied for user 'user1'") {
+		t.Fatalf("unexpected connection error: %v", err)
+	}
+}
+
+// multiConnHandler is a testHandler for the tests which open several
+// connections to the same listener. It doesn't record the last
+// connection, which the goroutines of the connections would race on.
+type multiConnHandler struct {
+	testHandler
+}
+
+func (th *multiConnHandler) NewConnection(c *Conn) {
+}
+
+// cachingAuthServer is an AuthServerStatic that can only validate
+// caching_sha2_password hashes from its scramble cache, like an
+// AuthServer that doesn't know the passwords.
+type cachingAuthServer struct {
+	*AuthServerStatic
+	cache *CachingSha2Cache
+
+	// mu protects the counters, which the connections update.
+	mu          sync.Mutex
+	negotiated  int
+	cacheHits   int
+	cacheMisses int
+}
+
+func (a *cachingAuthServer) ValidateHash(salt []byte, user string, authResponse []byte, remoteAddr net.Addr) (Getter, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.cache.Validate(salt, user, authResponse) {
+		a.cacheMisses++
+		return nil, NewSQLError(ERAccessDeniedError, SSAccessDeniedError, "Access denied for user '%v'", user)
+	}
+	a.cacheHits++
+	return &StaticUserData{user}, nil
+}
+
+func (a *cachingAuthServer) Negotiate(c *Conn, user string, remoteAddr net.Addr) (Getter, error) {
+	a.mu.Lock()
+	a.negotiated++
+	a.mu.Unlock()
+	password, err := AuthServerNegotiatePassword(c, a.Method)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range a.Entries[user] {
+		if entry.Password == password {
+			a.cache.Add(user, password)
+			return &StaticUserData{user}, nil
+		}
+	}
+	return nil, NewSQLError(ERAccessDeniedError, SSAccessDeniedError, "Access denied for user '%v'", user)
+}
+
+// TestCachingSha2FullAuth tests that a full caching_sha2_password
+// authentication fills the cache used by the fast authentication.
+func TestCachingSha2FullAuth(t *testing.T) {
+	th := &multiConnHandler{}
+
+	authServer := &cachingAuthServer{
+		AuthServerStatic: NewAuthServerStatic(),
+		cache:            NewCachingSha2Cache(0),
+	}
+	authServer.Method = MysqlCachingSha2Password
+	authServer.Entries["user1"] = []*AuthServerStaticEntry{
+		{Password: "password1"},
+	}
+
+	// Create the listener.
+	l, err := NewListener("tcp", ":0", authServer, th)
+	if err != nil {
+		t.Fatalf("NewListener failed: %v", err)
+	}
+	defer l.Close()
+	l.RSAKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	host := l.Addr().(*net.TCPAddr).IP.String()
+	port := l.Addr().(*net.TCPAddr).Port
+	go func() {
+		l.Accept()
+	}()
+
+	// Setup the right parameters.
+	params := &ConnParams{
+		Host:  host,
+		Port:  port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+
+	// The first connection needs the full authentication, the
+	// second one uses the cache.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := Connect(ctx, params)
+		if err != nil {
+			t.Fatalf("unexpected connection error: %v", err)
+		}
+		result, err := conn.ExecuteFetch("select rows", 10000, true)
+		if err != nil {
+			t.Fatalf("ExecuteFetch failed: %v", err)
+		}
+		if !reflect.DeepEqual(result, selectRowsResult) {
+			t.Errorf("Got wrong result from ExecuteFetch(select rows): %v", result)
+		}
+		conn.writeComQuit()
+		conn.Close()
+	}
+	authServer.mu.Lock()
+	defer authServer.mu.Unlock()
+	if authServer.negotiated != 1 || authServer.cacheMisses != 1 || authServer.cacheHits != 1 {
+		t.Errorf("negotiated: %v, cacheMisses: %v, cacheHits: %v, want 1, 1, 1", authServer.negotiated, authServer.cacheMisses, authServer.cacheHits)
+	}
+}
@@ -36,7 +36,7 @@ import (
 var (
 	ldapAuthConfigFile   = flag.String("mysql_ldap_auth_config_file", "", "JSON File from which to read LDAP server config.")
 	ldapAuthConfigString = flag.String("mysql_ldap_auth_config_string", "", "JSON representation of LDAP server config.")
-	ldapAuthMethod       = flag.String("mysql_ldap_auth_method", mysql.MysqlClearPassword, "client-side authentication method to use. Supported values: mysql_clear_password, dialog.")
+	ldapAuthMethod       = flag.String("mysql_ldap_auth_method", mysql.MysqlClearPassword, "client-side authentication method to use. Supported values: mysql_clear_password, dialog, caching_sha2_password, sha256_password.")
 )
 
 // AuthServerLdap implements AuthServer with an LDAP backend
@@ -49,6 +49,11 @@ type AuthServerLdap struct {
 	GroupQuery     string
 	UserDnPattern  string
 	RefreshSeconds time.Duration
+
+	// sha2Cache lets caching_sha2_password clients skip the LDAP
+	// bind for RefreshSeconds after a successful one. It is nil if
+	// RefreshSeconds is 0.
+	sha2Cache *mysql.CachingSha2Cache
 }
 
 // Init is public so it can be called from plugin_auth_ldap.go (go/cmd/vtgate)
@@ -61,8 +66,10 @@ func Init() {
 		log.Infof("Both mysql_ldap_auth_config_file and mysql_ldap_auth_config_string are non-empty, can only use one.")
 		return
 	}
-	if *ldapAuthMethod != mysql.MysqlClearPassword && *ldapAuthMethod != mysql.MysqlDialog {
-		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password or dialog")
+	switch *ldapAuthMethod {
+	case mysql.MysqlClearPassword, mysql.MysqlDialog, mysql.MysqlCachingSha2Password, mysql.MysqlSha256Password:
+	default:
+		log.Exitf("Invalid mysql_ldap_auth_method value: only support mysql_clear_password, dialog, caching_sha2_password or sha256_password")
 	}
 	ldapAuthServer := &AuthServerLdap{
 		Client:       &ClientImpl{},
@@ -81,6 +88,9 @@ func Init() {
 	if err := json.Unmarshal(data, ldapAuthServer); err != nil {
 		log.Exitf("Error parsing AuthServerLdap config: %v", err)
 	}
+	if ldapAuthServer.Method == mysql.MysqlCachingSha2Password && ldapAuthServer.RefreshSeconds > 0 {
+		ldapAuthServer.sha2Cache = mysql.NewCachingSha2Cache(ldapAuthServer.RefreshSeconds * time.Second)
+	}
 	mysql.RegisterAuthServerImpl("ldap", ldapAuthServer)
 }
 
@@ -94,19 +104,39 @@ func (asl *AuthServerLdap) Salt() ([]byte, error) {
 	return mysql.NewSalt()
 }
 
-// ValidateHash is unimplemented for AuthServerLdap.
+// ValidateHash is part of the AuthServer interface. It is only
+// called for MysqlCachingSha2Password, and only succeeds if the user
+// was recently authenticated with the same password: the groups of
+// the user are then fetched without binding as the user.
 func (asl *AuthServerLdap) ValidateHash(salt []byte, user string, authResponse []byte, remoteAddr net.Addr) (mysql.Getter, error) {
-	panic("unimplemented")
+	if !asl.sha2Cache.Validate(salt, user, authResponse) {
+		return nil, mysql.NewSQLError(mysql.ERAccessDeniedError, mysql.SSAccessDeniedError, "Access denied for user '%v'", user)
+	}
+	if err := asl.Client.Connect("tcp", &asl.ServerConfig); err != nil {
+		return nil, err
+	}
+	defer asl.Client.Close()
+	groups, err := asl.getGroups(user)
+	if err != nil {
+		return nil, err
+	}
+	return &LdapUserData{asl: asl, groups: groups, username: user, lastUpdated: time.Now(), updating: false}, nil
 }
 
 // Negotiate is part of the AuthServer interface.
 func (asl *AuthServerLdap) Negotiate(c *mysql.Conn, user string, remoteAddr net.Addr) (mysql.Getter, error) {
 	// Finish the negotiation.
-	password, err := mysql.AuthServerNegotiateClearOrDialog(c, asl.Method)
+	password, err := mysql.AuthServerNegotiatePassword(c, asl.Method)
+	if err != nil {
+		return nil, err
+	}
+	userData, err := asl.validate(user, password)
 	if err != nil {
+		asl.sha2Cache.Remove(user)
 		return nil, err
 	}
-	return asl.validate(user, password)
+	asl.sha2Cache.Add(user, password)
+	return userData, nil
 }
 
 func (asl *AuthServerLdap) validate(username, password string) (mysql.Getter, error) {
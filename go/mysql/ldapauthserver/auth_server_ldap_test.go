@@ -17,10 +17,12 @@ limitations under the License.
 package ldapauthserver
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"testing"
 
 	"gopkg.in/ldap.v2"
+	"vitess.io/vitess/go/mysql"
 )
 
 type MockLdapClient struct{}
@@ -54,3 +56,70 @@ func TestValidateClearText(t *testing.T) {
 		t.Fatalf("AuthServerLdap validated invalid credentials.")
 	}
 }
+
+func TestValidateHash(t *testing.T) {
+	asl := &AuthServerLdap{
+		Client:        &MockLdapClient{},
+		User:          "testuser",
+		Password:      "testpass",
+		UserDnPattern: "%s",
+		Method:        mysql.MysqlCachingSha2Password,
+	}
+	salt, err := mysql.NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a cache, the hash is never validated, and the client
+	// is asked for its password.
+	_, err = asl.ValidateHash(salt, "testuser", make([]byte, 32), nil)
+	if err == nil {
+		t.Fatalf("AuthServerLdap validated a hash without a cache.")
+	}
+
+	// With a cache, only the hash of a cached password is validated.
+	asl.sha2Cache = mysql.NewCachingSha2Cache(0)
+	asl.sha2Cache.Add("testuser", "testpass")
+	_, err = asl.ValidateHash(salt, "testuser", make([]byte, 32), nil)
+	if err == nil {
+		t.Fatalf("AuthServerLdap validated an invalid hash.")
+	}
+
+	// The hash of the cached password is validated.
+	userData, err := asl.ValidateHash(salt, "testuser", scrambleCachingSha2("testpass", salt), nil)
+	if err != nil {
+		t.Fatalf("AuthServerLdap failed to validate the hash of a cached password. Got: %v", err)
+	}
+	if got := userData.Get().Username; got != "testuser" {
+		t.Errorf("ValidateHash returned user %v, want testuser", got)
+	}
+
+	// The hash of another password is not.
+	_, err = asl.ValidateHash(salt, "testuser", scrambleCachingSha2("otherpass", salt), nil)
+	if err == nil {
+		t.Fatalf("AuthServerLdap validated the hash of a wrong password.")
+	}
+
+	// Once the user is removed from the cache, its hash is not
+	// validated anymore.
+	asl.sha2Cache.Remove("testuser")
+	_, err = asl.ValidateHash(salt, "testuser", scrambleCachingSha2("testpass", salt), nil)
+	if err == nil {
+		t.Fatalf("AuthServerLdap validated the hash of a removed user.")
+	}
+}
+
+// scrambleCachingSha2 computes the caching_sha2_password hash a
+// client sends: XOR(SHA256(password), SHA256(SHA256(SHA256(password)), salt)).
+func scrambleCachingSha2(password string, salt []byte) []byte {
+	stage1 := sha256.Sum256([]byte(password))
+	stage2 := sha256.Sum256(stage1[:])
+	crypt := sha256.New()
+	crypt.Write(stage2[:])
+	crypt.Write(salt)
+	scramble := crypt.Sum(nil)
+	for i := range scramble {
+		scramble[i] ^= stage1[i]
+	}
+	return scramble
+}
@@ -332,6 +332,42 @@ func (set Mysql56GTIDSet) AddGTID(gtid GTID) GTIDSet {
 	return newSet
 }
 
+// Union returns the set of the GTIDs in set or in other. A GTIDSet
+// of another flavor is ignored.
+func (set Mysql56GTIDSet) Union(other GTIDSet) Mysql56GTIDSet {
+	other56, ok := other.(Mysql56GTIDSet)
+	if !ok {
+		return set
+	}
+
+	newSet := make(Mysql56GTIDSet)
+	for sid, intervals := range set {
+		newSet[sid] = append([]interval(nil), intervals...)
+	}
+	for sid, intervals := range other56 {
+		newSet[sid] = append(newSet[sid], intervals...)
+	}
+
+	// Sort the intervals of each SID, and merge the ones
+	// that overlap or are contiguous.
+	for sid, intervals := range newSet {
+		sort.Sort(intervalList(intervals))
+		merged := intervals[:1]
+		for _, iv := range intervals[1:] {
+			last := &merged[len(merged)-1]
+			if iv.start <= last.end+1 {
+				if iv.end > last.end {
+					last.end = iv.end
+				}
+				continue
+			}
+			merged = append(merged, iv)
+		}
+		newSet[sid] = merged
+	}
+	return newSet
+}
+
 // SIDBlock returns the binary encoding of a MySQL 5.6 GTID set as expected
 // by internal commands that refer to an "SID block".
 //
@@ -417,6 +417,43 @@ func TestMysql56GTIDSetAddGTID(t *testing.T) {
 	}
 }
 
+func TestMysql56GTIDSetUnion(t *testing.T) {
+	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	sid2 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 16}
+	sid3 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 17}
+
+	set := Mysql56GTIDSet{
+		sid1: []interval{{20, 30}, {35, 40}, {42, 45}},
+		sid2: []interval{{1, 5}, {50, 50}, {60, 70}},
+	}
+	other := Mysql56GTIDSet{
+		sid1: []interval{{1, 10}, {25, 36}, {41, 41}},
+		sid2: []interval{{51, 55}},
+		sid3: []interval{{1, 3}},
+	}
+	// Overlapping and contiguous intervals are merged.
+	want := Mysql56GTIDSet{
+		sid1: []interval{{1, 10}, {20, 45}},
+		sid2: []interval{{1, 5}, {50, 55}, {60, 70}},
+		sid3: []interval{{1, 3}},
+	}
+
+	if got := set.Union(other); !got.Equal(want) {
+		t.Errorf("Union(%v, %v) = %v, want %v", set, other, got, want)
+	}
+	if got := other.Union(set); !got.Equal(want) {
+		t.Errorf("Union(%v, %v) = %v, want %v", other, set, got, want)
+	}
+	// The original sets are not modified.
+	if set.String() != "00010203-0405-0607-0809-0a0b0c0d0e0f:20-30:35-40:42-45,00010203-0405-0607-0809-0a0b0c0d0e10:1-5:50:60-70" {
+		t.Errorf("Union modified its receiver: %v", set)
+	}
+	// A set of another flavor is ignored.
+	if got := set.Union(fakeGTID{}); !got.Equal(set) {
+		t.Errorf("Union(%v, fakeGTID) = %v, want %v", set, got, set)
+	}
+}
+
 func TestMysql56GTIDSetSIDBlock(t *testing.T) {
 	sid1 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
 	sid2 := SID{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 16}
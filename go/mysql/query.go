@@ -18,6 +18,9 @@ package mysql
 
 import (
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 
 	"vitess.io/vitess/go/sqltypes"
 
@@ -467,6 +470,273 @@ func (c *Conn) parseComInitDB(data []byte) string {
 	return string(data[1:])
 }
 
+func (c *Conn) parseComPrepare(data []byte) string {
+	return string(data[1:])
+}
+
+// parseComStmtExecute parses a COM_STMT_EXECUTE packet, and stores
+// the parameter values in the BindVars of the matching PrepareData.
+// It returns the statement ID and the cursor type flags.
+// Returns a SQLError.
+func (c *Conn) parseComStmtExecute(data []byte) (uint32, byte, error) {
+	// We already read the type.
+	pos := 1
+
+	stmtID, pos, ok := readUint32(data, pos)
+	if !ok {
+		return 0, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading statement ID failed")
+	}
+	prepare, ok := c.PrepareData[stmtID]
+	if !ok {
+		return stmtID, 0, NewSQLError(ERUnknownStmtHandler, SSUnknownSQLState, "unknown prepared statement handler (%v) given to mysqld_stmt_execute", stmtID)
+	}
+
+	// Cursor type flags. We do not support cursors, the result
+	// set is always sent back in full.
+	cursorType, pos, ok := readByte(data, pos)
+	if !ok {
+		return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading cursor type flags failed")
+	}
+
+	// Iteration count, always 1.
+	_, pos, ok = readUint32(data, pos)
+	if !ok {
+		return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading iteration count failed")
+	}
+
+	if prepare.ParamsCount == 0 {
+		return stmtID, cursorType, nil
+	}
+
+	nullBitMap, pos, ok := readBytes(data, pos, int((prepare.ParamsCount+7)/8))
+	if !ok {
+		return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading NULL-bitmap failed")
+	}
+
+	// If the client binds new types, read them. Otherwise, the
+	// types of the previous execution are used.
+	newParamsBound, pos, ok := readByte(data, pos)
+	if !ok {
+		return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading new-params-bound flag failed")
+	}
+	if newParamsBound == 1 {
+		for i := uint16(0); i < prepare.ParamsCount; i++ {
+			var typ uint16
+			typ, pos, ok = readUint16(data, pos)
+			if !ok {
+				return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "reading parameter %v type failed", i)
+			}
+			prepare.ParamsType[i] = int32(typ)
+		}
+	}
+
+	for i := uint16(0); i < prepare.ParamsCount; i++ {
+		name := fmt.Sprintf("v%d", i+1)
+
+		// Values sent with COM_STMT_SEND_LONG_DATA are not
+		// repeated in the execute packet.
+		if prepare.longData[i] {
+			continue
+		}
+
+		if nullBitMap[i/8]&(1<<(i%8)) != 0 {
+			prepare.BindVars[name] = sqltypes.NullBindVariable
+			continue
+		}
+
+		var val sqltypes.Value
+		val, pos, ok = parseStmtArg(data, prepare.ParamsType[i], pos)
+		if !ok {
+			return stmtID, 0, NewSQLError(CRMalformedPacket, SSUnknownSQLState, "decoding parameter %v value failed", i)
+		}
+		prepare.BindVars[name] = sqltypes.ValueBindVariable(val)
+	}
+
+	return stmtID, cursorType, nil
+}
+
+// parseStmtArg decodes a single parameter value of a
+// COM_STMT_EXECUTE packet. paramType contains the MySQL type in
+// its lower byte, and the parameter flags in its upper byte.
+func parseStmtArg(data []byte, paramType int32, pos int) (sqltypes.Value, int, bool) {
+	unsigned := paramType&(0x80<<8) != 0
+	switch paramType & 0xff {
+	case TypeTiny:
+		val, pos, ok := readByte(data, pos)
+		if unsigned {
+			return sqltypes.NewUint64(uint64(val)), pos, ok
+		}
+		return sqltypes.NewInt64(int64(int8(val))), pos, ok
+	case TypeShort, TypeYear:
+		val, pos, ok := readUint16(data, pos)
+		if unsigned {
+			return sqltypes.NewUint64(uint64(val)), pos, ok
+		}
+		return sqltypes.NewInt64(int64(int16(val))), pos, ok
+	case TypeLong, TypeInt24:
+		val, pos, ok := readUint32(data, pos)
+		if unsigned {
+			return sqltypes.NewUint64(uint64(val)), pos, ok
+		}
+		return sqltypes.NewInt64(int64(int32(val))), pos, ok
+	case TypeLongLong:
+		val, pos, ok := readUint64(data, pos)
+		if unsigned {
+			return sqltypes.NewUint64(val), pos, ok
+		}
+		return sqltypes.NewInt64(int64(val)), pos, ok
+	case TypeFloat:
+		val, pos, ok := readUint32(data, pos)
+		return sqltypes.NewFloat64(float64(math.Float32frombits(val))), pos, ok
+	case TypeDouble:
+		val, pos, ok := readUint64(data, pos)
+		return sqltypes.NewFloat64(math.Float64frombits(val)), pos, ok
+	case TypeNull:
+		return sqltypes.NULL, pos, true
+	case TypeTimestamp, TypeDate, TypeDateTime:
+		return parseBinaryDateTime(data, paramType&0xff, pos)
+	case TypeTime:
+		return parseBinaryTime(data, pos)
+	case TypeDecimal, TypeNewDecimal:
+		val, pos, ok := readLenEncStringAsBytes(data, pos)
+		return sqltypes.MakeTrusted(sqltypes.Decimal, append([]byte(nil), val...)), pos, ok
+	case TypeVarchar, TypeVarString, TypeString, TypeEnum, TypeSet, TypeTinyBlob,
+		TypeMediumBlob, TypeLongBlob, TypeBlob, TypeBit, TypeJSON, TypeGeometry:
+		val, pos, ok := readLenEncStringAsBytes(data, pos)
+		return sqltypes.MakeTrusted(sqltypes.VarBinary, append([]byte(nil), val...)), pos, ok
+	}
+	return sqltypes.NULL, 0, false
+}
+
+// parseBinaryDateTime decodes a MYSQL_TYPE_DATE, MYSQL_TYPE_DATETIME
+// or MYSQL_TYPE_TIMESTAMP value from the binary protocol.
+func parseBinaryDateTime(data []byte, mysqlType int32, pos int) (sqltypes.Value, int, bool) {
+	length, pos, ok := readByte(data, pos)
+	if !ok {
+		return sqltypes.NULL, 0, false
+	}
+	var year uint16
+	var month, day, hour, minute, second byte
+	var microSecond uint32
+	switch length {
+	case 0:
+	case 4, 7, 11:
+		if year, pos, ok = readUint16(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if month, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if day, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if length >= 7 {
+			if hour, pos, ok = readByte(data, pos); !ok {
+				return sqltypes.NULL, 0, false
+			}
+			if minute, pos, ok = readByte(data, pos); !ok {
+				return sqltypes.NULL, 0, false
+			}
+			if second, pos, ok = readByte(data, pos); !ok {
+				return sqltypes.NULL, 0, false
+			}
+		}
+		if length == 11 {
+			if microSecond, pos, ok = readUint32(data, pos); !ok {
+				return sqltypes.NULL, 0, false
+			}
+		}
+	default:
+		return sqltypes.NULL, 0, false
+	}
+
+	if mysqlType == TypeDate {
+		return sqltypes.MakeTrusted(sqltypes.Date, []byte(fmt.Sprintf("%04d-%02d-%02d", year, month, day))), pos, true
+	}
+	val := fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, minute, second)
+	if microSecond != 0 {
+		val += fmt.Sprintf(".%06d", microSecond)
+	}
+	typ := sqltypes.Datetime
+	if mysqlType == TypeTimestamp {
+		typ = sqltypes.Timestamp
+	}
+	return sqltypes.MakeTrusted(typ, []byte(val)), pos, true
+}
+
+// parseBinaryTime decodes a MYSQL_TYPE_TIME value from the binary protocol.
+func parseBinaryTime(data []byte, pos int) (sqltypes.Value, int, bool) {
+	length, pos, ok := readByte(data, pos)
+	if !ok {
+		return sqltypes.NULL, 0, false
+	}
+	var isNegative, hour, minute, second byte
+	var days, microSecond uint32
+	switch length {
+	case 0:
+	case 8, 12:
+		if isNegative, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if days, pos, ok = readUint32(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if hour, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if minute, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if second, pos, ok = readByte(data, pos); !ok {
+			return sqltypes.NULL, 0, false
+		}
+		if length == 12 {
+			if microSecond, pos, ok = readUint32(data, pos); !ok {
+				return sqltypes.NULL, 0, false
+			}
+		}
+	default:
+		return sqltypes.NULL, 0, false
+	}
+
+	val := fmt.Sprintf("%02d:%02d:%02d", days*24+uint32(hour), minute, second)
+	if microSecond != 0 {
+		val += fmt.Sprintf(".%06d", microSecond)
+	}
+	if isNegative == 1 {
+		val = "-" + val
+	}
+	return sqltypes.MakeTrusted(sqltypes.Time, []byte(val)), pos, true
+}
+
+// parseComStmtSendLongData parses a COM_STMT_SEND_LONG_DATA packet.
+// It returns the statement ID, the parameter ID and a copy of the data.
+func (c *Conn) parseComStmtSendLongData(data []byte) (uint32, uint16, []byte, bool) {
+	// We already read the type.
+	pos := 1
+	stmtID, pos, ok := readUint32(data, pos)
+	if !ok {
+		return 0, 0, nil, false
+	}
+	paramID, pos, ok := readUint16(data, pos)
+	if !ok {
+		return 0, 0, nil, false
+	}
+	chunk, _, ok := readBytesCopy(data, pos, len(data)-pos)
+	if !ok {
+		return 0, 0, nil, false
+	}
+	return stmtID, paramID, chunk, true
+}
+
+// parseComStmtClose parses a COM_STMT_CLOSE or a COM_STMT_RESET
+// packet, and returns the statement ID.
+func (c *Conn) parseComStmtClose(data []byte) (uint32, bool) {
+	// We already read the type.
+	stmtID, _, ok := readUint32(data, 1)
+	return stmtID, ok
+}
+
 func (c *Conn) sendColumnCount(count uint64) error {
 	length := lenEncIntSize(count)
 	data := c.startEphemeralPacket(length)
@@ -586,6 +856,313 @@ func (c *Conn) writeRows(result *sqltypes.Result) error {
 	return nil
 }
 
+// writePrepare writes the COM_STMT_PREPARE_OK response, followed by
+// the parameter and column definitions.
+func (c *Conn) writePrepare(fields []*querypb.Field, prepare *PrepareData) error {
+	paramsCount := prepare.ParamsCount
+	columnCount := uint16(len(fields))
+
+	data := c.startEphemeralPacket(12)
+	pos := 0
+	pos = writeByte(data, pos, OKPacket)
+	pos = writeUint32(data, pos, prepare.StatementID)
+	pos = writeUint16(data, pos, columnCount)
+	pos = writeUint16(data, pos, paramsCount)
+	pos = writeByte(data, pos, 0x00) // reserved filler
+	pos = writeUint16(data, pos, 0)  // warning count
+	if err := c.writeEphemeralPacket(false); err != nil {
+		return err
+	}
+
+	if paramsCount > 0 {
+		// The parameter types are only known at execution
+		// time, so we describe them as binary strings.
+		for i := uint16(0); i < paramsCount; i++ {
+			if err := c.writeColumnDefinition(&querypb.Field{
+				Name:    "?",
+				Type:    sqltypes.VarBinary,
+				Charset: 63,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if c.Capabilities&CapabilityClientDeprecateEOF == 0 {
+			if err := c.writeEOFPacket(c.StatusFlags, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, field := range fields {
+		if err := c.writeColumnDefinition(field); err != nil {
+			return err
+		}
+	}
+
+	if columnCount > 0 && c.Capabilities&CapabilityClientDeprecateEOF == 0 {
+		if err := c.writeEOFPacket(c.StatusFlags, 0); err != nil {
+			return err
+		}
+	}
+
+	return c.flush()
+}
+
+// writeBinaryRow writes a row of a binary protocol result set, as
+// returned by COM_STMT_EXECUTE.
+func (c *Conn) writeBinaryRow(fields []*querypb.Field, row []sqltypes.Value) error {
+	// The NULL-bitmap has an offset of 2 bits for result set rows.
+	bitMapLen := (len(fields) + 7 + 2) / 8
+
+	length := 1 + bitMapLen
+	for _, val := range row {
+		if !val.IsNull() {
+			l, err := binaryValueLength(val)
+			if err != nil {
+				return err
+			}
+			length += l
+		}
+	}
+
+	data := c.startEphemeralPacket(length)
+	pos := 0
+	pos = writeByte(data, pos, 0x00)
+	for i := 0; i < bitMapLen; i++ {
+		pos = writeByte(data, pos, 0x00)
+	}
+
+	for i, val := range row {
+		if val.IsNull() {
+			bytePos := (i+2)/8 + 1
+			bitPos := (i + 2) % 8
+			data[bytePos] |= 1 << uint(bitPos)
+			continue
+		}
+		var err error
+		pos, err = writeBinaryValue(data, pos, val)
+		if err != nil {
+			return err
+		}
+	}
+
+	if pos != length {
+		return fmt.Errorf("internal error packet row: got %v bytes but expected %v", pos, length)
+	}
+
+	return c.writeEphemeralPacket(false)
+}
+
+// writeBinaryRows sends the rows of a Result, using the binary protocol.
+func (c *Conn) writeBinaryRows(result *sqltypes.Result) error {
+	for _, row := range result.Rows {
+		if err := c.writeBinaryRow(result.Fields, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// binaryValueLength returns the number of bytes writeBinaryValue
+// will use to encode the value.
+func binaryValueLength(val sqltypes.Value) (int, error) {
+	switch val.Type() {
+	case sqltypes.Int8, sqltypes.Uint8:
+		return 1, nil
+	case sqltypes.Int16, sqltypes.Uint16, sqltypes.Year:
+		return 2, nil
+	case sqltypes.Int24, sqltypes.Uint24, sqltypes.Int32, sqltypes.Uint32, sqltypes.Float32:
+		return 4, nil
+	case sqltypes.Int64, sqltypes.Uint64, sqltypes.Float64:
+		return 8, nil
+	case sqltypes.Date, sqltypes.Datetime, sqltypes.Timestamp:
+		year, month, day, hour, minute, second, microSecond, err := splitDateTime(val.ToString())
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case microSecond != 0:
+			return 12, nil
+		case hour != 0 || minute != 0 || second != 0:
+			return 8, nil
+		case year != 0 || month != 0 || day != 0:
+			return 5, nil
+		}
+		return 1, nil
+	case sqltypes.Time:
+		_, _, _, _, _, microSecond, err := splitTime(val.ToString())
+		if err != nil {
+			return 0, err
+		}
+		if microSecond != 0 {
+			return 13, nil
+		}
+		return 9, nil
+	}
+	l := len(val.Raw())
+	return lenEncIntSize(uint64(l)) + l, nil
+}
+
+// writeBinaryValue encodes a value of a binary protocol result set row.
+func writeBinaryValue(data []byte, pos int, val sqltypes.Value) (int, error) {
+	switch typ := val.Type(); typ {
+	case sqltypes.Int8, sqltypes.Int16, sqltypes.Int24, sqltypes.Int32, sqltypes.Int64, sqltypes.Year:
+		v, err := strconv.ParseInt(val.ToString(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return writeBinaryInt(data, pos, typ, uint64(v)), nil
+	case sqltypes.Uint8, sqltypes.Uint16, sqltypes.Uint24, sqltypes.Uint32, sqltypes.Uint64:
+		v, err := strconv.ParseUint(val.ToString(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return writeBinaryInt(data, pos, typ, v), nil
+	case sqltypes.Float32:
+		v, err := strconv.ParseFloat(val.ToString(), 32)
+		if err != nil {
+			return 0, err
+		}
+		return writeUint32(data, pos, math.Float32bits(float32(v))), nil
+	case sqltypes.Float64:
+		v, err := strconv.ParseFloat(val.ToString(), 64)
+		if err != nil {
+			return 0, err
+		}
+		return writeUint64(data, pos, math.Float64bits(v)), nil
+	case sqltypes.Date, sqltypes.Datetime, sqltypes.Timestamp:
+		year, month, day, hour, minute, second, microSecond, err := splitDateTime(val.ToString())
+		if err != nil {
+			return 0, err
+		}
+		length := byte(0)
+		switch {
+		case microSecond != 0:
+			length = 11
+		case hour != 0 || minute != 0 || second != 0:
+			length = 7
+		case year != 0 || month != 0 || day != 0:
+			length = 4
+		}
+		pos = writeByte(data, pos, length)
+		if length >= 4 {
+			pos = writeUint16(data, pos, uint16(year))
+			pos = writeByte(data, pos, byte(month))
+			pos = writeByte(data, pos, byte(day))
+		}
+		if length >= 7 {
+			pos = writeByte(data, pos, byte(hour))
+			pos = writeByte(data, pos, byte(minute))
+			pos = writeByte(data, pos, byte(second))
+		}
+		if length == 11 {
+			pos = writeUint32(data, pos, uint32(microSecond))
+		}
+		return pos, nil
+	case sqltypes.Time:
+		isNegative, days, hour, minute, second, microSecond, err := splitTime(val.ToString())
+		if err != nil {
+			return 0, err
+		}
+		length := byte(8)
+		if microSecond != 0 {
+			length = 12
+		}
+		pos = writeByte(data, pos, length)
+		if isNegative {
+			pos = writeByte(data, pos, 1)
+		} else {
+			pos = writeByte(data, pos, 0)
+		}
+		pos = writeUint32(data, pos, uint32(days))
+		pos = writeByte(data, pos, byte(hour))
+		pos = writeByte(data, pos, byte(minute))
+		pos = writeByte(data, pos, byte(second))
+		if length == 12 {
+			pos = writeUint32(data, pos, uint32(microSecond))
+		}
+		return pos, nil
+	}
+
+	// Everything else is sent as a length-encoded string.
+	raw := val.Raw()
+	pos = writeLenEncInt(data, pos, uint64(len(raw)))
+	pos += copy(data[pos:], raw)
+	return pos, nil
+}
+
+// writeBinaryInt writes an integer using the width of its type.
+func writeBinaryInt(data []byte, pos int, typ querypb.Type, v uint64) int {
+	switch typ {
+	case sqltypes.Int8, sqltypes.Uint8:
+		return writeByte(data, pos, byte(v))
+	case sqltypes.Int16, sqltypes.Uint16, sqltypes.Year:
+		return writeUint16(data, pos, uint16(v))
+	case sqltypes.Int24, sqltypes.Uint24, sqltypes.Int32, sqltypes.Uint32:
+		return writeUint32(data, pos, uint32(v))
+	}
+	return writeUint64(data, pos, v)
+}
+
+// splitDateTime splits a 'YYYY-MM-DD[ HH:MM:SS[.ffffff]]' value
+// into its components.
+func splitDateTime(val string) (year, month, day, hour, minute, second, microSecond int, err error) {
+	datePart, timePart := val, ""
+	if i := strings.IndexByte(val, ' '); i != -1 {
+		datePart, timePart = val[:i], val[i+1:]
+	}
+	if _, err = fmt.Sscanf(datePart, "%d-%d-%d", &year, &month, &day); err != nil {
+		return 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid date value %q: %v", val, err)
+	}
+	if timePart == "" {
+		return year, month, day, 0, 0, 0, 0, nil
+	}
+	var isNegative bool
+	var hours int
+	isNegative, hours, minute, second, microSecond, err = splitTimeOfDay(timePart)
+	if err != nil || isNegative || hours > 23 {
+		return 0, 0, 0, 0, 0, 0, 0, fmt.Errorf("invalid datetime value %q", val)
+	}
+	return year, month, day, hours, minute, second, microSecond, nil
+}
+
+// splitTime splits a '[-]HHH:MM:SS[.ffffff]' value into its
+// components, as used by the binary protocol.
+func splitTime(val string) (isNegative bool, days, hour, minute, second, microSecond int, err error) {
+	var hours int
+	isNegative, hours, minute, second, microSecond, err = splitTimeOfDay(val)
+	if err != nil {
+		return false, 0, 0, 0, 0, 0, err
+	}
+	return isNegative, hours / 24, hours % 24, minute, second, microSecond, nil
+}
+
+func splitTimeOfDay(val string) (isNegative bool, hours, minute, second, microSecond int, err error) {
+	if strings.HasPrefix(val, "-") {
+		isNegative = true
+		val = val[1:]
+	}
+	fraction := ""
+	if i := strings.IndexByte(val, '.'); i != -1 {
+		val, fraction = val[:i], val[i+1:]
+	}
+	if _, err = fmt.Sscanf(val, "%d:%d:%d", &hours, &minute, &second); err != nil {
+		return false, 0, 0, 0, 0, fmt.Errorf("invalid time value %q: %v", val, err)
+	}
+	if fraction != "" {
+		// Right-pad to microseconds: '.5' is 500000us.
+		if len(fraction) > 6 {
+			fraction = fraction[:6]
+		}
+		fraction += strings.Repeat("0", 6-len(fraction))
+		if microSecond, err = strconv.Atoi(fraction); err != nil {
+			return false, 0, 0, 0, 0, fmt.Errorf("invalid time fraction %q: %v", fraction, err)
+		}
+	}
+	return isNegative, hours, minute, second, microSecond, nil
+}
+
 // writeEndResult concludes the sending of a Result.
 func (c *Conn) writeEndResult() error {
 	// Send either an EOF, or an OK packet.
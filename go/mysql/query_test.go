@@ -438,3 +438,116 @@ func RowString(row []sqltypes.Value) string {
 	}
 	return result
 }
+
+func TestBinaryValues(t *testing.T) {
+	testcases := []struct {
+		in        sqltypes.Value
+		paramType int32
+		out       string
+	}{{
+		in:        sqltypes.MakeTrusted(querypb.Type_INT8, []byte("-12")),
+		paramType: TypeTiny,
+		out:       "-12",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_UINT8, []byte("250")),
+		paramType: TypeTiny | 0x80<<8,
+		out:       "250",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_INT16, []byte("-1234")),
+		paramType: TypeShort,
+		out:       "-1234",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_YEAR, []byte("2018")),
+		paramType: TypeYear,
+		out:       "2018",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_INT24, []byte("-123456")),
+		paramType: TypeInt24,
+		out:       "-123456",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_UINT32, []byte("4000000000")),
+		paramType: TypeLong | 0x80<<8,
+		out:       "4000000000",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_INT64, []byte("-9000000000")),
+		paramType: TypeLongLong,
+		out:       "-9000000000",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_UINT64, []byte("18446744073709551615")),
+		paramType: TypeLongLong | 0x80<<8,
+		out:       "18446744073709551615",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_FLOAT32, []byte("1.5")),
+		paramType: TypeFloat,
+		out:       "1.5",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_FLOAT64, []byte("-3.25")),
+		paramType: TypeDouble,
+		out:       "-3.25",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_DATE, []byte("2018-05-17")),
+		paramType: TypeDate,
+		out:       "2018-05-17",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_DATE, []byte("0000-00-00")),
+		paramType: TypeDate,
+		out:       "0000-00-00",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2018-05-17 00:00:00")),
+		paramType: TypeDateTime,
+		out:       "2018-05-17 00:00:00",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_DATETIME, []byte("2018-05-17 13:14:15")),
+		paramType: TypeDateTime,
+		out:       "2018-05-17 13:14:15",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_TIMESTAMP, []byte("2018-05-17 13:14:15.5")),
+		paramType: TypeTimestamp,
+		out:       "2018-05-17 13:14:15.500000",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_TIME, []byte("-838:59:59")),
+		paramType: TypeTime,
+		out:       "-838:59:59",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_TIME, []byte("01:02:03.000004")),
+		paramType: TypeTime,
+		out:       "01:02:03.000004",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("1234.5678")),
+		paramType: TypeNewDecimal,
+		out:       "1234.5678",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("nice name")),
+		paramType: TypeVarString,
+		out:       "nice name",
+	}, {
+		in:        sqltypes.MakeTrusted(querypb.Type_BLOB, []byte("")),
+		paramType: TypeBlob,
+		out:       "",
+	}}
+	for _, tcase := range testcases {
+		length, err := binaryValueLength(tcase.in)
+		if err != nil {
+			t.Errorf("binaryValueLength(%v) failed: %v", tcase.in, err)
+			continue
+		}
+		data := make([]byte, length)
+		pos, err := writeBinaryValue(data, 0, tcase.in)
+		if err != nil {
+			t.Errorf("writeBinaryValue(%v) failed: %v", tcase.in, err)
+			continue
+		}
+		if pos != length {
+			t.Errorf("writeBinaryValue(%v) wrote %v bytes, expected %v", tcase.in, pos, length)
+			continue
+		}
+		got, pos, ok := parseStmtArg(data, tcase.paramType, 0)
+		if !ok || pos != length {
+			t.Errorf("parseStmtArg(%v) failed: %v %v", data, pos, ok)
+			continue
+		}
+		if got.ToString() != tcase.out {
+			t.Errorf("binary round trip of %v returned %v, expected %v", tcase.in, got.ToString(), tcase.out)
+		}
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package mysql
 
 import (
+	"crypto/rsa"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -28,6 +29,9 @@ import (
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/stats"
 	"vitess.io/vitess/go/tb"
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
 )
 
 const (
@@ -38,6 +42,8 @@ const (
 	// timing metric keys
 	connectTimingKey = "Connect"
 	queryTimingKey   = "Query"
+	prepareTimingKey = "Prepare"
+	executeTimingKey = "StmtExecute"
 )
 
 var (
@@ -74,6 +80,19 @@ type Handler interface {
 	// the first call to callback. So the Handler should not
 	// hang on to the byte slice.
 	ComQuery(c *Conn, query string, callback func(*sqltypes.Result) error) error
+
+	// ComPrepare is called when a connection receives a
+	// COM_STMT_PREPARE. bindVars contains a NULL value for each
+	// '?' placeholder of the query, named 'v1', 'v2', ...
+	// It returns the fields of the result set the statement
+	// will return, or nil if it doesn't return rows.
+	ComPrepare(c *Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error)
+
+	// ComStmtExecute is called when a connection receives a
+	// COM_STMT_EXECUTE. The parameters of the execution are in
+	// prepare.BindVars. The same rules as ComQuery apply to the
+	// callback.
+	ComStmtExecute(c *Conn, prepare *PrepareData, callback func(*sqltypes.Result) error) error
 }
 
 // Listener is the MySQL server protocol listener.
@@ -106,6 +125,12 @@ type Listener struct {
 	// by the server when TLS is not in use.
 	AllowClearTextWithoutTLS bool
 
+	// RSAKey is the RSA key used by the caching_sha2_password and
+	// sha256_password authentication methods when TLS is not in use:
+	// clients encrypt their password with its public key. If it is
+	// not set, these methods require TLS or a unix socket.
+	RSAKey *rsa.PrivateKey
+
 	// SlowConnectWarnThreshold if non-zero specifies an amount of time
 	// beyond which a warning is logged to identify the slow connection
 	SlowConnectWarnThreshold time.Duration
@@ -255,6 +280,19 @@ func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Ti
 		c.writeErrorPacket(CRServerHandshakeErr, SSUnknownSQLState, "Client asked for auth %v, but server wants auth mysql_native_password", authMethod)
 		return
 
+	case authServerMethod == MysqlCachingSha2Password || authServerMethod == MysqlSha256Password:
+		// The password is either validated from its hash, or sent
+		// over TLS, or encrypted with our RSA key: it is never in
+		// the clear on the wire.
+		userData, err := l.negotiateSha2(c, salt, user, authServerMethod, authMethod, authResponse)
+		if err != nil {
+			log.Warningf("Error authenticating user using %v: %v", authServerMethod, err)
+			c.writeErrorPacketFromError(err)
+			return
+		}
+		c.User = user
+		c.UserData = userData
+
 	default:
 		// The server wants to use something else, re-negotiate.
 
@@ -391,6 +429,179 @@ func (l *Listener) handle(conn net.Conn, connectionID uint32, acceptTime time.Ti
 
 			timings.Record(queryTimingKey, queryStart)
 
+		case ComPrepare:
+			queryStart := time.Now()
+			query := c.parseComPrepare(data)
+			c.recycleReadPacket()
+
+			c.StatementID++
+			prepare := &PrepareData{
+				StatementID: c.StatementID,
+				PrepareStmt: query,
+				ParamsCount: countPrepareParams(query),
+				BindVars:    make(map[string]*querypb.BindVariable),
+				longData:    make(map[uint16]bool),
+			}
+			prepare.ParamsType = make([]int32, prepare.ParamsCount)
+
+			// Let the handler see a value for every parameter.
+			bindVars := make(map[string]*querypb.BindVariable, prepare.ParamsCount)
+			for i := uint16(0); i < prepare.ParamsCount; i++ {
+				bindVars[fmt.Sprintf("v%d", i+1)] = sqltypes.NullBindVariable
+			}
+
+			fields, err := l.handler.ComPrepare(c, query, bindVars)
+			if err != nil {
+				if werr := c.writeErrorPacketFromError(err); werr != nil {
+					// If we can't even write the error, we're done.
+					log.Errorf("Error writing query error to client %v: %v", c.ConnectionID, werr)
+					return
+				}
+				continue
+			}
+			for _, field := range fields {
+				prepare.ColumnNames = append(prepare.ColumnNames, field.Name)
+			}
+			c.PrepareData[prepare.StatementID] = prepare
+
+			if err := c.writePrepare(fields, prepare); err != nil {
+				log.Errorf("Error writing prepare data to client %v: %v", c.ConnectionID, err)
+				return
+			}
+
+			timings.Record(prepareTimingKey, queryStart)
+
+		case ComStmtExecute:
+			queryStart := time.Now()
+			stmtID, _, err := c.parseComStmtExecute(data)
+			c.recycleReadPacket()
+			if err != nil {
+				// The values sent with COM_STMT_SEND_LONG_DATA
+				// were for this execution.
+				if prepare, ok := c.PrepareData[stmtID]; ok {
+					prepare.clearLongData()
+				}
+				if werr := c.writeErrorPacketFromError(err); werr != nil {
+					// If we can't even write the error, we're done.
+					log.Errorf("Error writing query error to client %v: %v", c.ConnectionID, werr)
+					return
+				}
+				continue
+			}
+			prepare := c.PrepareData[stmtID]
+
+			fieldSent := false
+			// sendFinished is set if the response should just be an OK packet.
+			sendFinished := false
+			var fields []*querypb.Field
+			err = l.handler.ComStmtExecute(c, prepare, func(qr *sqltypes.Result) error {
+				if sendFinished {
+					// Failsafe: Unreachable if server is well-behaved.
+					return io.EOF
+				}
+
+				if !fieldSent {
+					fieldSent = true
+
+					if len(qr.Fields) == 0 {
+						sendFinished = true
+						// We should not send any more packets after this.
+						return c.writeOKPacket(qr.RowsAffected, qr.InsertID, c.StatusFlags, 0)
+					}
+					fields = qr.Fields
+					if err := c.writeFields(qr); err != nil {
+						return err
+					}
+				}
+
+				// Streaming results only carry the fields in
+				// their first packet.
+				return c.writeBinaryRows(&sqltypes.Result{Fields: fields, Rows: qr.Rows})
+			})
+
+			// Values sent with COM_STMT_SEND_LONG_DATA are only
+			// used for one execution.
+			prepare.clearLongData()
+
+			// If no field was sent, we expect an error.
+			if !fieldSent {
+				// This is just a failsafe. Should never happen.
+				if err == nil || err == io.EOF {
+					err = NewSQLErrorFromError(errors.New("unexpected: query ended without no results and no error"))
+				}
+				if werr := c.writeErrorPacketFromError(err); werr != nil {
+					// If we can't even write the error, we're done.
+					log.Errorf("Error writing query error to %s: %v", c, werr)
+					return
+				}
+				continue
+			}
+
+			if err != nil {
+				// We can't send an error in the middle of a stream.
+				// All we can do is abort the send, which will cause a 2013.
+				log.Errorf("Error in the middle of a stream to %s: %v", c, err)
+				return
+			}
+
+			// Send the end packet only sendFinished is false (results were streamed).
+			if !sendFinished {
+				if err := c.writeEndResult(); err != nil {
+					log.Errorf("Error writing result to %s: %v", c, err)
+					return
+				}
+			}
+
+			timings.Record(executeTimingKey, queryStart)
+
+		case ComStmtSendLongData:
+			// There is no response to that one, even on errors.
+			// They are reported by the next COM_STMT_EXECUTE.
+			stmtID, paramID, chunk, ok := c.parseComStmtSendLongData(data)
+			c.recycleReadPacket()
+			if !ok {
+				log.Errorf("Got malformed COM_STMT_SEND_LONG_DATA packet from %s", c)
+				continue
+			}
+			prepare, ok := c.PrepareData[stmtID]
+			if !ok || paramID >= prepare.ParamsCount {
+				log.Warningf("Got COM_STMT_SEND_LONG_DATA for unknown statement %v parameter %v from %s", stmtID, paramID, c)
+				continue
+			}
+			name := fmt.Sprintf("v%d", paramID+1)
+			if prepare.longData[paramID] {
+				bv := prepare.BindVars[name]
+				bv.Value = append(bv.Value, chunk...)
+			} else {
+				prepare.longData[paramID] = true
+				prepare.BindVars[name] = sqltypes.BytesBindVariable(chunk)
+			}
+
+		case ComStmtReset:
+			stmtID, ok := c.parseComStmtClose(data)
+			c.recycleReadPacket()
+			prepare, found := c.PrepareData[stmtID]
+			if !ok || !found {
+				if err := c.writeErrorPacket(ERUnknownStmtHandler, SSUnknownSQLState, "unknown prepared statement handler (%v) given to mysqld_stmt_reset", stmtID); err != nil {
+					log.Errorf("Error writing error packet to %s: %s", c, err)
+					return
+				}
+				continue
+			}
+			prepare.clearLongData()
+			if err := c.writeOKPacket(0, 0, c.StatusFlags, 0); err != nil {
+				log.Errorf("Error writing ComStmtReset OK packet to %s: %v", c, err)
+				return
+			}
+
+		case ComStmtClose:
+			// No response to that one.
+			stmtID, ok := c.parseComStmtClose(data)
+			c.recycleReadPacket()
+			if ok {
+				delete(c.PrepareData, stmtID)
+			}
+
 		case ComPing:
 			// No payload to that one, just return OKPacket.
 			c.recycleReadPacket()
@@ -415,6 +626,70 @@ func (l *Listener) Close() {
 	l.listener.Close()
 }
 
+// countPrepareParams returns the number of '?' placeholders in a
+// prepared statement. The tokenizer turns each of them into a
+// ':v<N>' bind variable, numbered from 1.
+func countPrepareParams(query string) uint16 {
+	count := uint16(0)
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			return count
+		}
+		if typ == sqlparser.VALUE_ARG && string(val) == fmt.Sprintf(":v%d", count+1) {
+			count++
+		}
+	}
+}
+
+// negotiateSha2 authenticates a client with the caching_sha2_password
+// or the sha256_password method. authMethod and authResponse are what
+// the client sent in its handshake response.
+func (l *Listener) negotiateSha2(c *Conn, salt []byte, user, authServerMethod, authMethod string, authResponse []byte) (Getter, error) {
+	c.salt = salt
+	c.rsaKey = l.RSAKey
+
+	// Both methods use the salt, so we send it again.
+	switchData := make([]byte, len(salt)+1)
+	copy(switchData, salt)
+
+	if authServerMethod == MysqlCachingSha2Password {
+		// Fast authentication: the client sends a hash of the
+		// password, which the AuthServer may be able to check.
+		if authMethod != MysqlCachingSha2Password {
+			if err := c.writeAuthSwitchRequest(MysqlCachingSha2Password, switchData); err != nil {
+				return nil, err
+			}
+			response, err := c.ReadPacket()
+			if err != nil {
+				return nil, err
+			}
+			authResponse = response
+		}
+		userData, err := l.authServer.ValidateHash(salt, user, authResponse, c.RemoteAddr())
+		if err == nil {
+			if err := c.writeAuthMoreData([]byte{cachingSha2FastAuth}); err != nil {
+				return nil, err
+			}
+			return userData, nil
+		}
+
+		// Full authentication: the client sends its password.
+		if err := c.writeAuthMoreData([]byte{cachingSha2FullAuth}); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := c.writeAuthSwitchRequest(MysqlSha256Password, switchData); err != nil {
+			return nil, err
+		}
+	}
+
+	// Then hand over the rest of the negotiation to the
+	// auth server.
+	return l.authServer.Negotiate(c, user, c.RemoteAddr())
+}
+
 // writeHandshakeV10 writes the Initial Handshake Packet, server side.
 // It returns the salt data.
 func (c *Conn) writeHandshakeV10(serverVersion string, authServer AuthServer, enableTLS bool) ([]byte, error) {
@@ -650,3 +925,18 @@ func (c *Conn) writeAuthSwitchRequest(pluginName string, pluginData []byte) erro
 	}
 	return c.writeEphemeralPacket(true)
 }
+
+// writeAuthMoreData writes an AuthMoreData packet.
+func (c *Conn) writeAuthMoreData(data []byte) error {
+	length := 1 + len(data)
+	buf := c.startEphemeralPacket(length)
+	pos := 0
+	pos = writeByte(buf, pos, AuthMoreDataPacket)
+	pos += copy(buf[pos:], data)
+
+	// Sanity check.
+	if pos != len(buf) {
+		return fmt.Errorf("error building AuthMoreData packet: got %v bytes expected %v", pos, len(buf))
+	}
+	return c.writeEphemeralPacket(true)
+}
@@ -23,6 +23,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -148,6 +149,60 @@ func (th *testHandler) ComQuery(c *Conn, query string, callback func(*sqltypes.R
 	return nil
 }
 
+func (th *testHandler) ComPrepare(c *Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	switch query {
+	case "error":
+		return nil, th.err
+	case "select rows":
+		return selectRowsResult.Fields, nil
+	case "select ?, ?":
+		return []*querypb.Field{
+			{
+				Name: "v1",
+				Type: querypb.Type_INT64,
+			},
+			{
+				Name: "v2",
+				Type: querypb.Type_VARBINARY,
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+func (th *testHandler) ComStmtExecute(c *Conn, prepare *PrepareData, callback func(*sqltypes.Result) error) error {
+	switch prepare.PrepareStmt {
+	case "error":
+		return th.err
+	case "select rows":
+		return callback(selectRowsResult)
+	case "select ?, ?":
+		// Echo the parameters back.
+		row := make([]sqltypes.Value, 2)
+		for i, name := range []string{"v1", "v2"} {
+			val, err := sqltypes.BindVariableToValue(prepare.BindVars[name])
+			if err != nil {
+				return err
+			}
+			row[i] = val
+		}
+		return callback(&sqltypes.Result{
+			Fields: []*querypb.Field{
+				{
+					Name: "v1",
+					Type: querypb.Type_INT64,
+				},
+				{
+					Name: "v2",
+					Type: querypb.Type_VARBINARY,
+				},
+			},
+			Rows: [][]sqltypes.Value{row},
+		})
+	}
+	return callback(&sqltypes.Result{})
+}
+
 func getHostPort(t *testing.T, a net.Addr) (string, int) {
 	// For the host name, we resolve 'localhost' into an address.
 	// This works around a few travis issues where IPv6 is not 100% enabled.
@@ -361,6 +416,204 @@ func TestClientFoundRows(t *testing.T) {
 	c.Close()
 }
 
+// writeRawCommand sends a command packet as a client would.
+func writeRawCommand(t *testing.T, c *Conn, data []byte) {
+	c.sequence = 0
+	if err := c.writePacket(data); err != nil {
+		t.Fatalf("writePacket failed: %v", err)
+	}
+	if err := c.flush(); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+}
+
+// readRawFields reads count column definitions, and the EOF packet
+// that follows them if needed.
+func readRawFields(t *testing.T, c *Conn, count int) []*querypb.Field {
+	fields := make([]*querypb.Field, count)
+	for i := range fields {
+		fields[i] = &querypb.Field{}
+		if err := c.readColumnDefinition(fields[i], i); err != nil {
+			t.Fatalf("readColumnDefinition(%v) failed: %v", i, err)
+		}
+	}
+	if count > 0 && c.Capabilities&CapabilityClientDeprecateEOF == 0 {
+		data, err := c.ReadPacket()
+		if err != nil || data[0] != EOFPacket {
+			t.Fatalf("expected EOF packet after fields, got %v %v", data, err)
+		}
+	}
+	return fields
+}
+
+func TestPreparedStatements(t *testing.T) {
+	th := &testHandler{}
+
+	authServer := NewAuthServerStatic()
+	authServer.Entries["user1"] = []*AuthServerStaticEntry{{
+		Password: "password1",
+		UserData: "userData1",
+	}}
+	l, err := NewListener("tcp", ":0", authServer, th)
+	if err != nil {
+		t.Fatalf("NewListener failed: %v", err)
+	}
+	defer l.Close()
+	go l.Accept()
+
+	host, port := getHostPort(t, l.Addr())
+
+	// Setup the right parameters.
+	params := &ConnParams{
+		Host:  host,
+		Port:  port,
+		Uname: "user1",
+		Pass:  "password1",
+	}
+
+	c, err := Connect(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Prepare a statement with two parameters.
+	writeRawCommand(t, c, append([]byte{ComPrepare}, "select ?, ?"...))
+	data, err := c.ReadPacket()
+	if err != nil || data[0] != OKPacket {
+		t.Fatalf("COM_STMT_PREPARE failed: %v %v", data, err)
+	}
+	stmtID, pos, _ := readUint32(data, 1)
+	columnCount, pos, _ := readUint16(data, pos)
+	paramsCount, _, _ := readUint16(data, pos)
+	if columnCount != 2 || paramsCount != 2 {
+		t.Fatalf("COM_STMT_PREPARE returned %v columns and %v params, expected 2 and 2", columnCount, paramsCount)
+	}
+	readRawFields(t, c, int(paramsCount))
+	fields := readRawFields(t, c, int(columnCount))
+	if fields[0].Name != "v1" || fields[1].Name != "v2" {
+		t.Errorf("COM_STMT_PREPARE returned unexpected fields: %v", fields)
+	}
+	prepare := th.lastConn.PrepareData[stmtID]
+	if prepare == nil || prepare.ParamsCount != 2 || !reflect.DeepEqual(prepare.ColumnNames, []string{"v1", "v2"}) {
+		t.Fatalf("unexpected PrepareData: %+v", prepare)
+	}
+
+	// Execute it, with a BIGINT and a string parameter.
+	execute := []byte{ComStmtExecute, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	writeUint32(execute, 1, stmtID)
+	execute = append(execute,
+		0x00,               // NULL-bitmap
+		0x01,               // new-params-bound flag
+		TypeLongLong, 0x00, // v1 type
+		TypeVarString, 0x00, // v2 type
+		42, 0, 0, 0, 0, 0, 0, 0, // v1 value
+		3, 'f', 'o', 'o', // v2 value
+	)
+	writeRawCommand(t, c, execute)
+	_, _, colNumber, err := c.readComQueryResponse()
+	if err != nil || colNumber != 2 {
+		t.Fatalf("COM_STMT_EXECUTE failed: %v %v", colNumber, err)
+	}
+	readRawFields(t, c, 2)
+	row, err := c.ReadPacket()
+	if err != nil {
+		t.Fatalf("reading binary row failed: %v", err)
+	}
+	want := []byte{
+		0x00,                    // header
+		0x00,                    // NULL-bitmap
+		42, 0, 0, 0, 0, 0, 0, 0, // v1
+		3, 'f', 'o', 'o', // v2
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("got binary row %v, want %v", row, want)
+	}
+	if data, err := c.ReadPacket(); err != nil || data[0] != EOFPacket {
+		t.Fatalf("expected end of result set, got %v %v", data, err)
+	}
+
+	// Execute it again with a NULL v1, and the v2 value sent
+	// as long data. The types of the first execution are reused.
+	longData := []byte{ComStmtSendLongData, 0, 0, 0, 0, 1, 0}
+	writeUint32(longData, 1, stmtID)
+	writeRawCommand(t, c, append(longData, "long"...))
+	writeRawCommand(t, c, append(longData, " data"...))
+	execute = []byte{ComStmtExecute, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	writeUint32(execute, 1, stmtID)
+	execute = append(execute,
+		0x01, // NULL-bitmap: v1 is NULL
+		0x00, // new-params-bound flag
+	)
+	writeRawCommand(t, c, execute)
+	if _, _, _, err := c.readComQueryResponse(); err != nil {
+		t.Fatalf("COM_STMT_EXECUTE failed: %v", err)
+	}
+	readRawFields(t, c, 2)
+	row, err = c.ReadPacket()
+	if err != nil {
+		t.Fatalf("reading binary row failed: %v", err)
+	}
+	want = []byte{
+		0x00,                                           // header
+		0x01 << 2,                                      // NULL-bitmap, with an offset of 2 bits
+		9, 'l', 'o', 'n', 'g', ' ', 'd', 'a', 't', 'a', // v2
+	}
+	if !reflect.DeepEqual(row, want) {
+		t.Errorf("got binary row %v, want %v", row, want)
+	}
+	if data, err := c.ReadPacket(); err != nil || data[0] != EOFPacket {
+		t.Fatalf("expected end of result set, got %v %v", data, err)
+	}
+	if len(prepare.longData) != 0 {
+		t.Errorf("long data was not cleared after execution: %v", prepare.longData)
+	}
+
+	// Long data is also cleared if the execute packet is malformed.
+	writeRawCommand(t, c, append(longData, "lost"...))
+	execute = []byte{ComStmtExecute, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	writeUint32(execute, 1, stmtID)
+	writeRawCommand(t, c, execute)
+	_, _, _, err = c.readComQueryResponse()
+	if sqlErr, ok := err.(*SQLError); !ok || sqlErr.Number() != CRMalformedPacket {
+		t.Errorf("COM_STMT_EXECUTE without parameters returned %v, expected CRMalformedPacket", err)
+	}
+	if len(prepare.longData) != 0 {
+		t.Errorf("long data was not cleared after a failed execution: %v", prepare.longData)
+	}
+
+	// Reset it.
+	reset := []byte{ComStmtReset, 0, 0, 0, 0}
+	writeUint32(reset, 1, stmtID)
+	writeRawCommand(t, c, reset)
+	if data, err := c.ReadPacket(); err != nil || data[0] != OKPacket {
+		t.Fatalf("COM_STMT_RESET failed: %v %v", data, err)
+	}
+
+	// Close it, executing it again fails.
+	closeStmt := []byte{ComStmtClose, 0, 0, 0, 0}
+	writeUint32(closeStmt, 1, stmtID)
+	writeRawCommand(t, c, closeStmt)
+	execute = []byte{ComStmtExecute, 0, 0, 0, 0, 0, 1, 0, 0, 0}
+	writeUint32(execute, 1, stmtID)
+	writeRawCommand(t, c, execute)
+	_, _, _, err = c.readComQueryResponse()
+	if sqlErr, ok := err.(*SQLError); !ok || sqlErr.Number() != ERUnknownStmtHandler {
+		t.Errorf("COM_STMT_EXECUTE on closed statement returned %v, expected ERUnknownStmtHandler", err)
+	}
+
+	// Errors from the handler are returned.
+	th.err = NewSQLError(ERUnknownComError, SSUnknownComError, "forced prepare error")
+	writeRawCommand(t, c, append([]byte{ComPrepare}, "error"...))
+	data, err = c.ReadPacket()
+	if err != nil || data[0] != ErrPacket {
+		t.Fatalf("expected error packet, got %v %v", data, err)
+	}
+	if err := ParseErrorPacket(data); !strings.Contains(err.Error(), "forced prepare error") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestServer(t *testing.T) {
 	th := &testHandler{}
 
@@ -31,6 +31,16 @@ type SlaveStatus struct {
 	MasterHost          string
 	MasterPort          int
 	MasterConnectRetry  int
+
+	// RelayLogPosition is the position of the transactions
+	// received from the master, applied or not. It is ahead of
+	// Position while the SQL thread catches up. It is only set
+	// by the flavors that report it.
+	RelayLogPosition Position
+
+	// SlaveIOConnecting is true if the IO thread is running, but
+	// not connected to the master. SlaveIORunning is then false.
+	SlaveIOConnecting bool
 }
 
 // SlaveRunning returns true iff both the Slave IO and Slave SQL threads are
@@ -43,12 +53,14 @@ func (s *SlaveStatus) SlaveRunning() bool {
 func SlaveStatusToProto(s SlaveStatus) *replicationdatapb.Status {
 	return &replicationdatapb.Status{
 		Position:            EncodePosition(s.Position),
+		RelayLogPosition:    EncodePosition(s.RelayLogPosition),
 		SlaveIoRunning:      s.SlaveIORunning,
 		SlaveSqlRunning:     s.SlaveSQLRunning,
 		SecondsBehindMaster: uint32(s.SecondsBehindMaster),
 		MasterHost:          s.MasterHost,
 		MasterPort:          int32(s.MasterPort),
 		MasterConnectRetry:  int32(s.MasterConnectRetry),
+		SlaveIoConnecting:   s.SlaveIOConnecting,
 	}
 }
 
@@ -58,13 +70,19 @@ func ProtoToSlaveStatus(s *replicationdatapb.Status) SlaveStatus {
 	if err != nil {
 		panic(fmt.Errorf("cannot decode Position: %v", err))
 	}
+	relayLogPos, err := DecodePosition(s.RelayLogPosition)
+	if err != nil {
+		panic(fmt.Errorf("cannot decode RelayLogPosition: %v", err))
+	}
 	return SlaveStatus{
 		Position:            pos,
+		RelayLogPosition:    relayLogPos,
 		SlaveIORunning:      s.SlaveIoRunning,
 		SlaveSQLRunning:     s.SlaveSqlRunning,
 		SecondsBehindMaster: uint(s.SecondsBehindMaster),
 		MasterHost:          s.MasterHost,
 		MasterPort:          int(s.MasterPort),
 		MasterConnectRetry:  int(s.MasterConnectRetry),
+		SlaveIOConnecting:   s.SlaveIoConnecting,
 	}
 }
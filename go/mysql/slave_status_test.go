@@ -50,3 +50,32 @@ func TestStatusSlaveSQLNotRunning(t *testing.T) {
 		t.Errorf("%#v.SlaveRunning() = %v, want %v", input, got, want)
 	}
 }
+
+func TestSlaveStatusProto(t *testing.T) {
+	pos, err := DecodePosition("MySQL56/00010203-0405-0607-0809-0a0b0c0d0e0f:1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayLogPos, err := DecodePosition("MySQL56/00010203-0405-0607-0809-0a0b0c0d0e0f:1-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := SlaveStatus{
+		Position:         pos,
+		RelayLogPosition:  relayLogPos,
+		SlaveSQLRunning:   true,
+		SlaveIOConnecting: true,
+		MasterHost:        "master",
+		MasterPort:        3306,
+	}
+	got := ProtoToSlaveStatus(SlaveStatusToProto(input))
+	if !got.Position.Equal(pos) || !got.RelayLogPosition.Equal(relayLogPos) || got.SlaveIORunning || !got.SlaveIOConnecting || !got.SlaveSQLRunning || got.MasterHost != "master" || got.MasterPort != 3306 {
+		t.Errorf("ProtoToSlaveStatus(SlaveStatusToProto(%#v)) = %#v", input, got)
+	}
+
+	// The relay log position is not reported by all flavors.
+	got = ProtoToSlaveStatus(SlaveStatusToProto(SlaveStatus{Position: pos}))
+	if !got.RelayLogPosition.IsZero() {
+		t.Errorf("RelayLogPosition: %v, want zero", got.RelayLogPosition)
+	}
+}
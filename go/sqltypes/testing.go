@@ -56,7 +56,7 @@ func MakeTestFields(names, types string) []*querypb.Field {
 //     "10|abcd",
 //   )
 // The field type values are set as the types for the rows built.
-// Spaces are trimmed from row values.
+// Spaces are trimmed from row values. "null" is treated as NULL.
 func MakeTestResult(fields []*querypb.Field, rows ...string) *Result {
 	result := &Result{
 		Fields: fields,
@@ -65,6 +65,10 @@ func MakeTestResult(fields []*querypb.Field, rows ...string) *Result {
 	for i, row := range rows {
 		result.Rows[i] = make([]Value, len(fields))
 		for j, col := range split(row) {
+			if col == "null" {
+				result.Rows[i][j] = NULL
+				continue
+			}
 			result.Rows[i][j] = MakeTrusted(fields[j].Type, []byte(col))
 		}
 	}
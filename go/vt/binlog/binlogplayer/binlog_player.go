@@ -20,8 +20,10 @@ limitations under the License.
 package binlogplayer
 
 import (
+	"bytes"
 	"encoding/hex"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -104,6 +106,9 @@ type BinlogPlayer struct {
 	// for table base requests
 	tables []string
 
+	// for streams stored in _vt.vreplication, see NewBinlogPlayerStream
+	plan *StreamPlan
+
 	// common to all
 	uid            uint32
 	position       mysql.Position
@@ -166,6 +171,20 @@ func NewBinlogPlayerTables(dbClient VtClient, tablet *topodatapb.Tablet, tables
 	return result, nil
 }
 
+// NewBinlogPlayerStream returns a new BinlogPlayer pointing at the server
+// replicating the source tables of plan, starting at the startPosition.
+// The statements are transformed by plan before they're applied, and the
+// position is saved in _vt.vreplication with id=uid.
+// If !stopPosition.IsZero(), it will stop when reaching that position.
+func NewBinlogPlayerStream(dbClient VtClient, tablet *topodatapb.Tablet, plan *StreamPlan, uid uint32, startPosition string, stopPosition string, blplStats *Stats) (*BinlogPlayer, error) {
+	result, err := NewBinlogPlayerTables(dbClient, tablet, plan.Tables(), uid, startPosition, stopPosition, blplStats)
+	if err != nil {
+		return nil, err
+	}
+	result.plan = plan
+	return result, nil
+}
+
 // writeRecoveryPosition will write the current GTID as the recovery position
 // for the next transaction.
 // We will also try to get the timestamp for the transaction. Two cases:
@@ -185,6 +204,9 @@ func (blp *BinlogPlayer) writeRecoveryPosition(tx *binlogdatapb.BinlogTransactio
 
 	blp.position = position
 	updateRecovery := updateBlpCheckpoint(blp.uid, blp.position, now, tx.EventToken.Timestamp)
+	if blp.plan != nil {
+		updateRecovery = updateVReplicationPos(blp.uid, blp.position, now, tx.EventToken.Timestamp)
+	}
 
 	qr, err := blp.exec(updateRecovery)
 	if err != nil {
@@ -218,13 +240,20 @@ func ReadStartPosition(dbClient VtClient, uid uint32) (string, string, error) {
 // replication from the checkpoint table.
 func (blp *BinlogPlayer) readThrottlerSettings() (int64, int64, error) {
 	selectThrottlerSettings := QueryBlpThrottlerSettings(blp.uid)
-	qr, err := blp.dbClient.ExecuteFetch(selectThrottlerSettings, 1)
+	if blp.plan != nil {
+		selectThrottlerSettings = QueryVReplicationThrottlerSettings(blp.uid)
+	}
+	return readThrottlerSettings(blp.dbClient, selectThrottlerSettings, blp.uid)
+}
+
+func readThrottlerSettings(dbClient VtClient, selectThrottlerSettings string, uid uint32) (int64, int64, error) {
+	qr, err := dbClient.ExecuteFetch(selectThrottlerSettings, 1)
 	if err != nil {
 		return throttler.InvalidMaxRate, throttler.InvalidMaxReplicationLag, fmt.Errorf("error %v in selecting the throttler settings %v", err, selectThrottlerSettings)
 	}
 
 	if qr.RowsAffected != 1 {
-		return throttler.InvalidMaxRate, throttler.InvalidMaxReplicationLag, fmt.Errorf("checkpoint information not available in db for %v", blp.uid)
+		return throttler.InvalidMaxRate, throttler.InvalidMaxReplicationLag, fmt.Errorf("checkpoint information not available in db for %v", uid)
 	}
 
 	maxTPS, err := sqltypes.ToInt64(qr.Rows[0][0])
@@ -271,7 +300,7 @@ func (blp *BinlogPlayer) processTransaction(tx *binlogdatapb.BinlogTransaction)
 				blp.currentCharset = stmtCharset
 			}
 		}
-		if _, err = blp.exec(string(stmt.Sql)); err == nil {
+		if err = blp.execStatement(string(stmt.Sql)); err == nil {
 			continue
 		}
 		if sqlErr, ok := err.(*mysql.SQLError); ok && sqlErr.Number() == 1213 {
@@ -291,6 +320,25 @@ func (blp *BinlogPlayer) processTransaction(tx *binlogdatapb.BinlogTransaction)
 	return true, nil
 }
 
+// execStatement executes a statement of the stream, after transforming
+// it if the player has a plan.
+func (blp *BinlogPlayer) execStatement(sql string) error {
+	if blp.plan == nil {
+		_, err := blp.exec(sql)
+		return err
+	}
+	queries, err := blp.plan.Transform(sql)
+	if err != nil {
+		return err
+	}
+	for _, query := range queries {
+		if _, err := blp.exec(query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (blp *BinlogPlayer) exec(sql string) (*sqltypes.Result, error) {
 	queryStartTime := time.Now()
 	qr, err := blp.dbClient.ExecuteFetch(sql, 0)
@@ -513,3 +561,251 @@ func QueryBlpCheckpoint(index uint32) string {
 func QueryBlpThrottlerSettings(index uint32) string {
 	return fmt.Sprintf("SELECT max_tps, max_replication_lag FROM _vt.blp_checkpoint WHERE source_shard_uid=%v", index)
 }
+
+// States of a stream in _vt.vreplication.
+const (
+	// BlpRunning means the stream should run.
+	BlpRunning = "Running"
+	// BlpStopped means the stream was stopped, by an operator
+	// or because it reached its stop position.
+	BlpStopped = "Stopped"
+)
+
+// CreateVReplicationTable returns the statements required to create
+// the _vt.vreplication table, which stores the filtered replication
+// streams of a tablet. A stream runs on the master tablet as long as
+// its state is BlpRunning. The source column is the JSON of a
+// BinlogSource. It also creates the _vt.copy_state table, which stores
+// the progress of the streams that copy their tables before streaming,
+// see CreateVReplicationCopy.
+func CreateVReplicationTable() []string {
+	return []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS _vt.vreplication (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  workflow VARBINARY(1000) DEFAULT NULL,
+  source VARBINARY(10000) NOT NULL,
+  pos VARBINARY(%v) NOT NULL,
+  stop_pos VARBINARY(%v) DEFAULT NULL,
+  max_tps BIGINT(20) NOT NULL,
+  max_replication_lag BIGINT(20) NOT NULL,
+  time_updated BIGINT(20) UNSIGNED NOT NULL,
+  transaction_timestamp BIGINT(20) UNSIGNED NOT NULL,
+  state VARBINARY(100) NOT NULL,
+  message VARBINARY(1000) DEFAULT NULL,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB`, mysql.MaximumPositionSize, mysql.MaximumPositionSize),
+		`CREATE TABLE IF NOT EXISTS _vt.copy_state (
+  vrepl_id INT UNSIGNED NOT NULL,
+  table_name VARBINARY(128) NOT NULL,
+  lastpk VARBINARY(2000) DEFAULT NULL,
+  PRIMARY KEY (vrepl_id, table_name)
+) ENGINE=InnoDB`}
+}
+
+// CreateVReplication returns a statement to insert a new stream in
+// the _vt.vreplication table. It starts running as soon as it's
+// inserted. If stopPosition is not empty, the stream stops when it
+// reaches it.
+func CreateVReplication(workflow string, source *BinlogSource, position, stopPosition string, maxTPS, maxReplicationLag, timeUpdated int64) string {
+	return CreateVReplicationState(workflow, source, position, stopPosition, maxTPS, maxReplicationLag, timeUpdated, BlpRunning)
+}
+
+// CreateVReplicationState is like CreateVReplication, but inserts the
+// stream in the given state. A stream inserted as BlpStopped can be
+// completed, with InsertCopyState for instance, before it's started
+// with SetVReplicationState.
+func CreateVReplicationState(workflow string, source *BinlogSource, position, stopPosition string, maxTPS, maxReplicationLag, timeUpdated int64, state string) string {
+	return fmt.Sprintf("INSERT INTO _vt.vreplication "+
+		"(workflow, source, pos, stop_pos, max_tps, max_replication_lag, time_updated, transaction_timestamp, state) "+
+		"VALUES (%v, %v, %v, %v, %v, %v, %v, 0, %v)",
+		encodeString(workflow), encodeString(source.String()), encodeString(position), encodeString(stopPosition),
+		maxTPS, maxReplicationLag, timeUpdated, encodeString(state))
+}
+
+// CreateVReplicationCopy returns the statements to insert a new stream
+// in the _vt.vreplication table, which copies the tables of its rules
+// before streaming. They must be executed in a single transaction.
+// The stream starts from the current position of its source, and
+// catches up with the changes made to the rows it copied between its
+// chunks, so the source keeps serving during the copy. The progress of
+// the copy is in the _vt.copy_state table: a table is copied as long
+// as it has a row there, and lastpk is the primary key of the last row
+// copied, NULL if none was. The primary keys of the tables can't have
+// text columns, which MySQL sorts by their collation, see EncodeLastPK.
+func CreateVReplicationCopy(workflow string, source *BinlogSource, stopPosition string, maxTPS, maxReplicationLag, timeUpdated int64) ([]string, error) {
+	insertCopyState, err := insertCopyState("LAST_INSERT_ID()", source)
+	if err != nil {
+		return nil, err
+	}
+	return []string{
+		CreateVReplication(workflow, source, "", stopPosition, maxTPS, maxReplicationLag, timeUpdated),
+		insertCopyState,
+	}, nil
+}
+
+// InsertCopyState returns a statement to insert the copy state of the
+// tables of source, for the stream uid which must have an empty
+// position: the stream copies them when it starts, like a stream
+// created by CreateVReplicationCopy.
+func InsertCopyState(uid uint32, source *BinlogSource) (string, error) {
+	return insertCopyState(fmt.Sprintf("%v", uid), source)
+}
+
+func insertCopyState(uidExpr string, source *BinlogSource) (string, error) {
+	plan, err := BuildStreamPlan(source)
+	if err != nil {
+		return "", err
+	}
+	values := make([]string, 0, len(plan.Tables()))
+	for _, table := range plan.Tables() {
+		values = append(values, fmt.Sprintf("(%v, %v)", uidExpr, encodeString(table)))
+	}
+	return "INSERT INTO _vt.copy_state (vrepl_id, table_name) VALUES " + strings.Join(values, ", "), nil
+}
+
+// SetVReplicationPos returns a statement to set the position of a
+// stream in the _vt.vreplication table, like the position its copy
+// starts from.
+func SetVReplicationPos(uid uint32, pos string, timeUpdated int64) string {
+	return fmt.Sprintf("UPDATE _vt.vreplication SET pos=%v, time_updated=%v WHERE id=%v",
+		encodeString(pos), timeUpdated, uid)
+}
+
+// updateVReplicationPos returns a statement to update the position
+// of a stream in the _vt.vreplication table.
+func updateVReplicationPos(uid uint32, pos mysql.Position, timeUpdated int64, txTimestamp int64) string {
+	if txTimestamp != 0 {
+		return fmt.Sprintf(
+			"UPDATE _vt.vreplication "+
+				"SET pos=%v, time_updated=%v, transaction_timestamp=%v "+
+				"WHERE id=%v",
+			encodeString(mysql.EncodePosition(pos)), timeUpdated, txTimestamp, uid)
+	}
+
+	return fmt.Sprintf(
+		"UPDATE _vt.vreplication "+
+			"SET pos=%v, time_updated=%v "+
+			"WHERE id=%v",
+		encodeString(mysql.EncodePosition(pos)), timeUpdated, uid)
+}
+
+// SetVReplicationState returns a statement to set the state and the
+// message of a stream in the _vt.vreplication table.
+func SetVReplicationState(uid uint32, state, message string) string {
+	return fmt.Sprintf("UPDATE _vt.vreplication SET state=%v, message=%v WHERE id=%v",
+		encodeString(state), encodeString(message), uid)
+}
+
+// SetVReplicationMessage returns a statement to set the message of a
+// stream in the _vt.vreplication table, like the last error it got.
+func SetVReplicationMessage(uid uint32, message string) string {
+	if len(message) > 1000 {
+		message = message[:1000]
+	}
+	return fmt.Sprintf("UPDATE _vt.vreplication SET message=%v WHERE id=%v",
+		encodeString(message), uid)
+}
+
+// DeleteVReplication returns a statement to delete a stream from the
+// _vt.vreplication table. Its copy state must be deleted with
+// DeleteCopyState too.
+func DeleteVReplication(uid uint32) string {
+	return fmt.Sprintf("DELETE FROM _vt.vreplication WHERE id=%v", uid)
+}
+
+// QueryCopyState returns a statement to query the tables a stream is
+// still copying, with their last copied primary key.
+func QueryCopyState(uid uint32) string {
+	return fmt.Sprintf("SELECT table_name, lastpk FROM _vt.copy_state WHERE vrepl_id=%v", uid)
+}
+
+// ReadCopyState returns the last copied primary key of the tables a
+// stream is still copying, as set by UpdateCopyState. It's empty for
+// the tables whose copy didn't start.
+func ReadCopyState(dbClient VtClient, uid uint32) (map[string]string, error) {
+	query := QueryCopyState(uid)
+	qr, err := dbClient.ExecuteFetch(query, 10000)
+	if err != nil {
+		return nil, fmt.Errorf("error %v in selecting copy state %v", err, query)
+	}
+	copyState := make(map[string]string, len(qr.Rows))
+	for _, row := range qr.Rows {
+		copyState[row[0].ToString()] = row[1].ToString()
+	}
+	return copyState, nil
+}
+
+// UpdateCopyState returns a statement to set the last copied primary
+// key of a table, as returned by EncodeLastPK.
+func UpdateCopyState(uid uint32, table, lastPK string) string {
+	return fmt.Sprintf("UPDATE _vt.copy_state SET lastpk=%v WHERE vrepl_id=%v AND table_name=%v",
+		encodeString(lastPK), uid, encodeString(table))
+}
+
+// DeleteCopyState returns a statement to delete the copy state of a
+// table once it's copied, or of all the tables of the stream if table
+// is empty.
+func DeleteCopyState(uid uint32, table string) string {
+	if table == "" {
+		return fmt.Sprintf("DELETE FROM _vt.copy_state WHERE vrepl_id=%v", uid)
+	}
+	return fmt.Sprintf("DELETE FROM _vt.copy_state WHERE vrepl_id=%v AND table_name=%v",
+		uid, encodeString(table))
+}
+
+// QueryVReplicationStreams returns a statement to list the streams of
+// the _vt.vreplication table.
+func QueryVReplicationStreams() string {
+	return "SELECT id, source, state FROM _vt.vreplication"
+}
+
+// QueryVReplicationWorkflow returns a statement to list the streams
+// of a workflow in the _vt.vreplication table, with their position.
+func QueryVReplicationWorkflow(workflow string) string {
+	return fmt.Sprintf("SELECT id, source, pos FROM _vt.vreplication WHERE workflow=%v", encodeString(workflow))
+}
+
+// QueryVReplication returns a statement to query the position and the
+// stop position of a stream from the _vt.vreplication table.
+func QueryVReplication(uid uint32) string {
+	return fmt.Sprintf("SELECT pos, stop_pos FROM _vt.vreplication WHERE id=%v", uid)
+}
+
+// QueryVReplicationStatus returns a statement to query the state and
+// the message of a stream from the _vt.vreplication table.
+func QueryVReplicationStatus(uid uint32) string {
+	return fmt.Sprintf("SELECT state, message FROM _vt.vreplication WHERE id=%v", uid)
+}
+
+// ReadVReplicationPos returns the current position and the stop
+// position of a stream.
+func ReadVReplicationPos(dbClient VtClient, uid uint32) (string, string, error) {
+	query := QueryVReplication(uid)
+	qr, err := dbClient.ExecuteFetch(query, 1)
+	if err != nil {
+		return "", "", fmt.Errorf("error %v in selecting vreplication settings %v", err, query)
+	}
+	if len(qr.Rows) != 1 {
+		return "", "", fmt.Errorf("stream %v not found in _vt.vreplication", uid)
+	}
+	return qr.Rows[0][0].ToString(), qr.Rows[0][1].ToString(), nil
+}
+
+// QueryVReplicationThrottlerSettings returns a statement to query the
+// throttler settings of a stream from the _vt.vreplication table.
+func QueryVReplicationThrottlerSettings(uid uint32) string {
+	return fmt.Sprintf("SELECT max_tps, max_replication_lag FROM _vt.vreplication WHERE id=%v", uid)
+}
+
+// ReadVReplicationThrottlerSettings returns the max_tps and
+// max_replication_lag settings of a stream.
+func ReadVReplicationThrottlerSettings(dbClient VtClient, uid uint32) (int64, int64, error) {
+	return readThrottlerSettings(dbClient, QueryVReplicationThrottlerSettings(uid), uid)
+}
+
+func encodeString(in string) string {
+	buf := bytes.NewBuffer(nil)
+	sqltypes.NewVarChar(in).EncodeSQL(buf)
+	return buf.String()
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package binlogplayer
 
 import (
+	"reflect"
 	"testing"
 
 	"vitess.io/vitess/go/mysql"
@@ -72,3 +73,111 @@ func TestQueryBlpThrottlerSettings(t *testing.T) {
 		t.Errorf("QueryBlpCheckpoint(482821) = %#v, want %#v", got, want)
 	}
 }
+
+func TestCreateVReplication(t *testing.T) {
+	want := "INSERT INTO _vt.vreplication " +
+		"(workflow, source, pos, stop_pos, max_tps, max_replication_lag, time_updated, transaction_timestamp, state) " +
+		`VALUES ('wf', '{\"keyspace\":\"ks\",\"shard\":\"0\",\"rules\":[{\"match\":\"t\",\"filter\":\"select * from t\"}]}', 'MariaDB/0-1-1083', '', 9223372036854775807, 9223372036854775807, 481823, 0, 'Running')`
+
+	source := &BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules:    []*Rule{{Match: "t", Filter: "select * from t"}},
+	}
+	got := CreateVReplication("wf", source, "MariaDB/0-1-1083", "", throttler.MaxRateModuleDisabled, throttler.ReplicationLagModuleDisabled, 481823)
+	if got != want {
+		t.Errorf("CreateVReplication() = %#v, want %#v", got, want)
+	}
+}
+
+func TestUpdateVReplicationPos(t *testing.T) {
+	gtid := mysql.MustParseGTID("MariaDB", "0-2-582")
+	want := "UPDATE _vt.vreplication " +
+		"SET pos='MariaDB/0-2-582', time_updated=88822, transaction_timestamp=481828 " +
+		"WHERE id=78522"
+
+	got := updateVReplicationPos(78522, mysql.Position{GTIDSet: gtid.GTIDSet()}, 88822, 481828)
+	if got != want {
+		t.Errorf("updateVReplicationPos() = %#v, want %#v", got, want)
+	}
+}
+
+func TestSetVReplicationState(t *testing.T) {
+	want := "UPDATE _vt.vreplication SET state='Stopped', message='it\\'s done' WHERE id=5"
+	if got := SetVReplicationState(5, BlpStopped, "it's done"); got != want {
+		t.Errorf("SetVReplicationState() = %#v, want %#v", got, want)
+	}
+}
+
+func TestCreateVReplicationCopy(t *testing.T) {
+	source := &BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{
+			{Match: "t2", Filter: "select * from t2"},
+			{Match: "t", Filter: "select * from t1"},
+		},
+	}
+	got, err := CreateVReplicationCopy("wf", source, "", throttler.MaxRateModuleDisabled, throttler.ReplicationLagModuleDisabled, 481823)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		CreateVReplication("wf", source, "", "", throttler.MaxRateModuleDisabled, throttler.ReplicationLagModuleDisabled, 481823),
+		"INSERT INTO _vt.copy_state (vrepl_id, table_name) VALUES (LAST_INSERT_ID(), 't1'), (LAST_INSERT_ID(), 't2')",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CreateVReplicationCopy() = %#v, want %#v", got, want)
+	}
+
+	source.Rules = nil
+	if _, err := CreateVReplicationCopy("wf", source, "", 0, 0, 0); err == nil {
+		t.Errorf("CreateVReplicationCopy(no rules) succeeded, want error")
+	}
+}
+
+func TestInsertCopyState(t *testing.T) {
+	source := &BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{
+			{Match: "t2", Filter: "select * from t2"},
+			{Match: "t", Filter: "select * from t1"},
+		},
+	}
+	want := "INSERT INTO _vt.vreplication " +
+		"(workflow, source, pos, stop_pos, max_tps, max_replication_lag, time_updated, transaction_timestamp, state) " +
+		`VALUES ('wf', '{\"keyspace\":\"ks\",\"shard\":\"0\",\"rules\":[{\"match\":\"t2\",\"filter\":\"select * from t2\"},{\"match\":\"t\",\"filter\":\"select * from t1\"}]}', '', '', 9223372036854775807, 9223372036854775807, 481823, 0, 'Stopped')`
+	if got := CreateVReplicationState("wf", source, "", "", throttler.MaxRateModuleDisabled, throttler.ReplicationLagModuleDisabled, 481823, BlpStopped); got != want {
+		t.Errorf("CreateVReplicationState() = %#v, want %#v", got, want)
+	}
+
+	got, err := InsertCopyState(12, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "INSERT INTO _vt.copy_state (vrepl_id, table_name) VALUES (12, 't1'), (12, 't2')"
+	if got != want {
+		t.Errorf("InsertCopyState() = %#v, want %#v", got, want)
+	}
+
+	want = "SELECT id, source, pos FROM _vt.vreplication WHERE workflow='wf'"
+	if got := QueryVReplicationWorkflow("wf"); got != want {
+		t.Errorf("QueryVReplicationWorkflow() = %#v, want %#v", got, want)
+	}
+}
+
+func TestCopyState(t *testing.T) {
+	want := "UPDATE _vt.copy_state SET lastpk='(1, \\'a\\')' WHERE vrepl_id=5 AND table_name='t'"
+	if got := UpdateCopyState(5, "t", "(1, 'a')"); got != want {
+		t.Errorf("UpdateCopyState() = %#v, want %#v", got, want)
+	}
+	want = "DELETE FROM _vt.copy_state WHERE vrepl_id=5 AND table_name='t'"
+	if got := DeleteCopyState(5, "t"); got != want {
+		t.Errorf("DeleteCopyState() = %#v, want %#v", got, want)
+	}
+	want = "DELETE FROM _vt.copy_state WHERE vrepl_id=5"
+	if got := DeleteCopyState(5, ""); got != want {
+		t.Errorf("DeleteCopyState() = %#v, want %#v", got, want)
+	}
+}
@@ -0,0 +1,811 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlogplayer
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/key"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// BinlogSource describes the source of a stream stored in
+// _vt.vreplication: the keyspace and shard to replicate from, and
+// the rules that select and transform the rows.
+type BinlogSource struct {
+	Keyspace string  `json:"keyspace"`
+	Shard    string  `json:"shard"`
+	Rules    []*Rule `json:"rules"`
+
+	// Upsert makes the inserts of the stream update the target rows
+	// that already exist. It's for targets that other writers may
+	// change too, like a lookup vindex table that is being
+	// backfilled.
+	Upsert bool `json:"upsert,omitempty"`
+}
+
+// Rule replicates the rows of a source table into a target table.
+// Match is the name of the target table. Filter is a select statement
+// on the source table, like:
+//   select id, name as user_name from user where in_keyrange(id, 'hash', '-80')
+// The select expressions can only be columns, optionally renamed,
+// or a single '*' to copy all of them. A column can also be replaced
+// by its keyspace id, with keyspace_id(column, vindex_type). The where
+// clause is optional, and can only be an in_keyrange(column,
+// vindex_type, range). In both functions, vindex_type is a functional
+// vindex.
+type Rule struct {
+	Match  string `json:"match"`
+	Filter string `json:"filter"`
+}
+
+// ParseBinlogSource parses the JSON representation of a BinlogSource,
+// as stored in the source column of _vt.vreplication.
+func ParseBinlogSource(data string) (*BinlogSource, error) {
+	bs := &BinlogSource{}
+	if err := json.Unmarshal([]byte(data), bs); err != nil {
+		return nil, fmt.Errorf("cannot parse binlog source %v: %v", data, err)
+	}
+	return bs, nil
+}
+
+// String returns the JSON representation of the BinlogSource.
+func (bs *BinlogSource) String() string {
+	data, err := json.Marshal(bs)
+	if err != nil {
+		// Only basic types, this cannot happen.
+		panic(err)
+	}
+	return string(data)
+}
+
+// StreamPlan is the plan to apply the statements of a stream, built
+// from the rules of its BinlogSource. The source statements must come
+// from row based replication, so they contain the full row images.
+type StreamPlan struct {
+	// tables is keyed by source table name.
+	tables map[string]*tablePlan
+
+	// upsert makes the inserts update the existing rows, see
+	// BinlogSource.Upsert.
+	upsert bool
+}
+
+// tablePlan is the plan for the rows of one source table.
+type tablePlan struct {
+	target sqlparser.TableIdent
+
+	// columns are the columns to copy. If nil, all the
+	// columns are copied under their own name.
+	columns []columnPlan
+
+	// The following fields are set if the rows are filtered
+	// by in_keyrange.
+	keyRange *topodatapb.KeyRange
+	krColumn sqlparser.ColIdent
+	vindex   vindexes.Unique
+
+	// copy is set while the table is being copied, see SetCopyState.
+	copy *copyState
+}
+
+// copyState restricts the rows of a table to the ones that were
+// already copied.
+type copyState struct {
+	pkColumns []sqlparser.ColIdent
+	// lastPK is the primary key of the last copied row. It is nil
+	// if no row was copied yet.
+	lastPK []sqltypes.Value
+}
+
+// columnPlan copies a source column into a target column. If vindex
+// is set, the target column receives the keyspace id of the source
+// column instead.
+type columnPlan struct {
+	source sqlparser.ColIdent
+	target sqlparser.ColIdent
+	vindex vindexes.Unique
+}
+
+// BuildStreamPlan builds the StreamPlan for the rules of source.
+func BuildStreamPlan(source *BinlogSource) (*StreamPlan, error) {
+	if len(source.Rules) == 0 {
+		return nil, fmt.Errorf("no rules in binlog source %v", source)
+	}
+	sp := &StreamPlan{
+		tables: make(map[string]*tablePlan),
+		upsert: source.Upsert,
+	}
+	for _, rule := range source.Rules {
+		table, tp, err := buildTablePlan(rule)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sp.tables[table]; ok {
+			return nil, fmt.Errorf("more than one rule for table %v", table)
+		}
+		sp.tables[table] = tp
+	}
+	return sp, nil
+}
+
+func buildTablePlan(rule *Rule) (string, *tablePlan, error) {
+	stmt, err := sqlparser.Parse(rule.Filter)
+	if err != nil {
+		return "", nil, err
+	}
+	sel, ok := stmt.(*sqlparser.Select)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected: %v not a select statement", rule.Filter)
+	}
+	if sel.Distinct != "" || sel.GroupBy != nil || sel.Having != nil || sel.OrderBy != nil || sel.Limit != nil {
+		return "", nil, fmt.Errorf("unsupported: %v", rule.Filter)
+	}
+	if len(sel.From) != 1 {
+		return "", nil, fmt.Errorf("unsupported: multiple tables in %v", rule.Filter)
+	}
+	ate, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported: %v", sqlparser.String(sel.From[0]))
+	}
+	source, ok := ate.Expr.(sqlparser.TableName)
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported: %v", sqlparser.String(ate.Expr))
+	}
+
+	tp := &tablePlan{
+		target: sqlparser.NewTableIdent(rule.Match),
+	}
+	if rule.Match == "" {
+		tp.target = source.Name
+	}
+	for _, expr := range sel.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+			if len(sel.SelectExprs) != 1 {
+				return "", nil, fmt.Errorf("unsupported: '*' with other expressions in %v", rule.Filter)
+			}
+		case *sqlparser.AliasedExpr:
+			var cp columnPlan
+			switch colExpr := expr.Expr.(type) {
+			case *sqlparser.ColName:
+				cp.source = colExpr.Name
+				cp.target = colExpr.Name
+			case *sqlparser.FuncExpr:
+				if !colExpr.Name.EqualString("keyspace_id") {
+					return "", nil, fmt.Errorf("unsupported: %v, only columns and keyspace_id can be selected", sqlparser.String(expr))
+				}
+				if expr.As.IsEmpty() {
+					return "", nil, fmt.Errorf("keyspace_id must be aliased: %v", sqlparser.String(expr))
+				}
+				args, err := funcArgs(colExpr, 2)
+				if err != nil {
+					return "", nil, err
+				}
+				col, ok := args[0].(*sqlparser.ColName)
+				if !ok {
+					return "", nil, fmt.Errorf("first argument of keyspace_id must be a column: %v", sqlparser.String(args[0]))
+				}
+				if cp.vindex, err = functionalVindex(colExpr.Name.String(), args[1]); err != nil {
+					return "", nil, err
+				}
+				cp.source = col.Name
+			default:
+				return "", nil, fmt.Errorf("unsupported: %v, only columns and keyspace_id can be selected", sqlparser.String(expr))
+			}
+			if !expr.As.IsEmpty() {
+				cp.target = expr.As
+			}
+			tp.columns = append(tp.columns, cp)
+		default:
+			return "", nil, fmt.Errorf("unsupported: %v", sqlparser.String(expr))
+		}
+	}
+	if sel.Where != nil {
+		if err := tp.analyzeWhere(sel.Where.Expr); err != nil {
+			return "", nil, err
+		}
+	}
+	return source.Name.String(), tp, nil
+}
+
+// analyzeWhere sets the keyrange filter of the plan from an
+// in_keyrange(column, vindex_type, range) expression.
+func (tp *tablePlan) analyzeWhere(expr sqlparser.Expr) error {
+	fn, ok := expr.(*sqlparser.FuncExpr)
+	if !ok || !fn.Name.EqualString("in_keyrange") || len(fn.Exprs) != 3 {
+		return fmt.Errorf("unsupported where clause: %v, only in_keyrange(column, vindex_type, range) is supported", sqlparser.String(expr))
+	}
+	args, err := funcArgs(fn, 3)
+	if err != nil {
+		return err
+	}
+	col, ok := args[0].(*sqlparser.ColName)
+	if !ok {
+		return fmt.Errorf("first argument of in_keyrange must be a column: %v", sqlparser.String(args[0]))
+	}
+	unique, err := functionalVindex(fn.Name.String(), args[1])
+	if err != nil {
+		return err
+	}
+	shard, err := stringArg(fn.Name.String(), args[2])
+	if err != nil {
+		return err
+	}
+	keyRanges, err := key.ParseShardingSpec(shard)
+	if err != nil {
+		return err
+	}
+	if len(keyRanges) != 1 {
+		return fmt.Errorf("unexpected range in in_keyrange: %v", shard)
+	}
+
+	tp.keyRange = keyRanges[0]
+	tp.krColumn = col.Name
+	tp.vindex = unique
+	return nil
+}
+
+// funcArgs returns the count arguments of fn.
+func funcArgs(fn *sqlparser.FuncExpr, count int) ([]sqlparser.Expr, error) {
+	if len(fn.Exprs) != count {
+		return nil, fmt.Errorf("%v takes %v arguments: %v", fn.Name.String(), count, sqlparser.String(fn))
+	}
+	args := make([]sqlparser.Expr, count)
+	for i, selExpr := range fn.Exprs {
+		aliased, ok := selExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, fmt.Errorf("unexpected argument to %v: %v", fn.Name.String(), sqlparser.String(selExpr))
+		}
+		args[i] = aliased.Expr
+	}
+	return args, nil
+}
+
+// functionalVindex returns the functional vindex whose type is the
+// string expr, an argument of the fnName function.
+func functionalVindex(fnName string, expr sqlparser.Expr) (vindexes.Unique, error) {
+	vindexType, err := stringArg(fnName, expr)
+	if err != nil {
+		return nil, err
+	}
+	vindex, err := vindexes.CreateVindex(vindexType, vindexType, nil)
+	if err != nil {
+		return nil, err
+	}
+	unique, ok := vindex.(vindexes.Unique)
+	if !ok || vindex.Cost() > 1 {
+		return nil, fmt.Errorf("vindex %v is not functional", vindexType)
+	}
+	return unique, nil
+}
+
+func stringArg(name string, expr sqlparser.Expr) (string, error) {
+	val, ok := expr.(*sqlparser.SQLVal)
+	if !ok || val.Type != sqlparser.StrVal {
+		return "", fmt.Errorf("unexpected argument to %v: %v, want a string", name, sqlparser.String(expr))
+	}
+	return string(val.Val), nil
+}
+
+// SetCopyState restricts the statements of table to the rows whose
+// primary key is at most lastPK, while the table is being copied:
+// the other rows are copied later, with their latest values. lastPK
+// is a tuple as returned by EncodeLastPK. If it's empty, no row was
+// copied yet, and all the statements of table are skipped.
+func (sp *StreamPlan) SetCopyState(table string, pkColumns []string, lastPK string) error {
+	tp, ok := sp.tables[table]
+	if !ok {
+		return fmt.Errorf("no rule for table %v", table)
+	}
+	cs := &copyState{}
+	for _, col := range pkColumns {
+		cs.pkColumns = append(cs.pkColumns, sqlparser.NewColIdent(col))
+	}
+	if lastPK != "" {
+		tuple, err := parseTuple(lastPK)
+		if err != nil {
+			return err
+		}
+		if len(tuple) != len(pkColumns) {
+			return fmt.Errorf("last primary key %v doesn't match columns %v", lastPK, pkColumns)
+		}
+		for _, expr := range tuple {
+			value, err := exprValue(expr)
+			if err != nil {
+				return err
+			}
+			cs.lastPK = append(cs.lastPK, value)
+		}
+	}
+	tp.copy = cs
+	return nil
+}
+
+// Tables returns the sorted names of the source tables of the plan.
+func (sp *StreamPlan) Tables() []string {
+	tables := make([]string, 0, len(sp.tables))
+	for table := range sp.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Transform returns the statements to apply on the target for a
+// statement of the stream. The SET statements are passed through.
+// The DMLs must be the ones generated from row based replication
+// events, where each statement changes one row, and the where clause
+// lists the values of the row: the row is filtered and projected as
+// per the plan of its table. An update can become an insert or a
+// delete if the row enters or leaves the keyrange of the plan.
+func (sp *StreamPlan) Transform(sql string) ([]string, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	switch stmt := stmt.(type) {
+	case *sqlparser.Set:
+		return []string{sql}, nil
+	case *sqlparser.Insert:
+		tp, ok := sp.tables[stmt.Table.Name.String()]
+		if !ok {
+			return nil, nil
+		}
+		rows, ok := stmt.Rows.(sqlparser.Values)
+		if !ok || len(rows) != 1 || len(rows[0]) != len(stmt.Columns) {
+			return nil, fmt.Errorf("unexpected insert in stream: %v", sql)
+		}
+		after := &rowImage{
+			columns: stmt.Columns,
+			values:  rows[0],
+		}
+		return tp.generate(nil, after, sp.upsert)
+	case *sqlparser.Update:
+		tp, ok := sp.tables[dmlTableName(stmt.TableExprs)]
+		if !ok {
+			return nil, nil
+		}
+		before, err := whereImage(stmt.Where)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected update in stream: %v: %v", sql, err)
+		}
+		after := &rowImage{}
+		for _, expr := range stmt.Exprs {
+			after.columns = append(after.columns, expr.Name.Name)
+			after.values = append(after.values, expr.Expr)
+		}
+		return tp.generate(before, after, sp.upsert)
+	case *sqlparser.Delete:
+		tp, ok := sp.tables[dmlTableName(stmt.TableExprs)]
+		if !ok {
+			return nil, nil
+		}
+		before, err := whereImage(stmt.Where)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected delete in stream: %v: %v", sql, err)
+		}
+		return tp.generate(before, nil, sp.upsert)
+	}
+	return nil, fmt.Errorf("unsupported statement in stream, binlog_format must be ROW: %v", sql)
+}
+
+func dmlTableName(tableExprs sqlparser.TableExprs) string {
+	if len(tableExprs) != 1 {
+		return ""
+	}
+	ate, ok := tableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return ""
+	}
+	tableName, ok := ate.Expr.(sqlparser.TableName)
+	if !ok {
+		return ""
+	}
+	return tableName.Name.String()
+}
+
+// rowImage is the image of a row in a statement. The values are
+// the expressions of the statement, so they're generated back as is.
+// A NULL value is a *sqlparser.NullVal.
+type rowImage struct {
+	columns []sqlparser.ColIdent
+	values  []sqlparser.Expr
+}
+
+// whereImage returns the row image of a where clause made of
+// 'column = value' and 'column is null' expressions.
+func whereImage(where *sqlparser.Where) (*rowImage, error) {
+	if where == nil {
+		return nil, fmt.Errorf("no where clause")
+	}
+	ri := &rowImage{}
+	var walk func(expr sqlparser.Expr) error
+	walk = func(expr sqlparser.Expr) error {
+		switch expr := expr.(type) {
+		case *sqlparser.AndExpr:
+			if err := walk(expr.Left); err != nil {
+				return err
+			}
+			return walk(expr.Right)
+		case *sqlparser.ComparisonExpr:
+			col, ok := expr.Left.(*sqlparser.ColName)
+			if ok && expr.Operator == sqlparser.EqualStr {
+				ri.columns = append(ri.columns, col.Name)
+				ri.values = append(ri.values, expr.Right)
+				return nil
+			}
+		case *sqlparser.IsExpr:
+			col, ok := expr.Expr.(*sqlparser.ColName)
+			if ok && expr.Operator == sqlparser.IsNullStr {
+				ri.columns = append(ri.columns, col.Name)
+				ri.values = append(ri.values, &sqlparser.NullVal{})
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected expression %v", sqlparser.String(expr))
+	}
+	if err := walk(where.Expr); err != nil {
+		return nil, err
+	}
+	return ri, nil
+}
+
+func (ri *rowImage) find(col sqlparser.ColIdent) (sqlparser.Expr, bool) {
+	for i, c := range ri.columns {
+		if c.Equal(col) {
+			return ri.values[i], true
+		}
+	}
+	return nil, false
+}
+
+// project returns the target image of a source row image.
+func (tp *tablePlan) project(ri *rowImage) (*rowImage, error) {
+	if tp.columns == nil {
+		return ri, nil
+	}
+	result := &rowImage{
+		columns: make([]sqlparser.ColIdent, len(tp.columns)),
+		values:  make([]sqlparser.Expr, len(tp.columns)),
+	}
+	for i, cp := range tp.columns {
+		val, ok := ri.find(cp.source)
+		if !ok {
+			return nil, fmt.Errorf("column %v is not in the row image, binlog_row_image must be FULL", cp.source.String())
+		}
+		if cp.vindex != nil {
+			var err error
+			if val, err = keyspaceIDExpr(cp.vindex, val); err != nil {
+				return nil, err
+			}
+		}
+		result.columns[i] = cp.target
+		result.values[i] = val
+	}
+	return result, nil
+}
+
+// keyspaceIDExpr returns the literal of the keyspace id that vindex
+// maps the value of expr to. A NULL value maps to NULL.
+func keyspaceIDExpr(vindex vindexes.Unique, expr sqlparser.Expr) (sqlparser.Expr, error) {
+	if _, ok := expr.(*sqlparser.NullVal); ok {
+		return expr, nil
+	}
+	value, err := exprValue(expr)
+	if err != nil {
+		return nil, err
+	}
+	ksids, err := vindex.Map(nil, []sqltypes.Value{value})
+	if err != nil {
+		return nil, err
+	}
+	if err := ksids[0].ValidateUnique(); err != nil {
+		return nil, err
+	}
+	if ksids[0].ID == nil {
+		return nil, fmt.Errorf("could not map %v to a keyspace id", sqlparser.String(expr))
+	}
+	return sqlparser.NewHexVal([]byte(hex.EncodeToString(ksids[0].ID))), nil
+}
+
+// matches returns true if the row image matches the keyrange of the
+// plan, and was already copied if the table is being copied. A nil
+// image never matches.
+func (tp *tablePlan) matches(ri *rowImage) (bool, error) {
+	if ri == nil {
+		return false, nil
+	}
+	if tp.copy != nil {
+		copied, err := tp.copy.copied(ri)
+		if err != nil || !copied {
+			return false, err
+		}
+	}
+	if tp.keyRange == nil {
+		return true, nil
+	}
+	expr, ok := ri.find(tp.krColumn)
+	if !ok {
+		return false, fmt.Errorf("column %v is not in the row image, binlog_row_image must be FULL", tp.krColumn.String())
+	}
+	if _, ok := expr.(*sqlparser.NullVal); ok {
+		return false, nil
+	}
+	value, err := exprValue(expr)
+	if err != nil {
+		return false, err
+	}
+	ksids, err := tp.vindex.Map(nil, []sqltypes.Value{value})
+	if err != nil {
+		return false, err
+	}
+	if err := ksids[0].ValidateUnique(); err != nil {
+		return false, err
+	}
+	return key.KeyRangeContains(tp.keyRange, ksids[0].ID), nil
+}
+
+// copied returns true if the primary key of the row image is at most
+// the last copied primary key.
+func (cs *copyState) copied(ri *rowImage) (bool, error) {
+	if cs.lastPK == nil {
+		return false, nil
+	}
+	for i, col := range cs.pkColumns {
+		expr, ok := ri.find(col)
+		if !ok {
+			return false, fmt.Errorf("column %v is not in the row image, binlog_row_image must be FULL", col.String())
+		}
+		value, err := exprValue(expr)
+		if err != nil {
+			return false, err
+		}
+		cmp, err := sqltypes.NullsafeCompare(value, cs.lastPK[i])
+		if err != nil {
+			return false, err
+		}
+		if cmp != 0 {
+			return cmp < 0, nil
+		}
+	}
+	return true, nil
+}
+
+// exprValue returns the value of a literal expression.
+func exprValue(expr sqlparser.Expr) (sqltypes.Value, error) {
+	pv, err := sqlparser.NewPlanValue(expr)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	return pv.ResolveValue(nil)
+}
+
+// valueExpr returns the literal expression of a value.
+func valueExpr(value sqltypes.Value) sqlparser.Expr {
+	switch {
+	case value.IsNull():
+		return &sqlparser.NullVal{}
+	case value.IsIntegral():
+		return sqlparser.NewIntVal(value.ToBytes())
+	case value.IsFloat() || value.Type() == sqltypes.Decimal:
+		return sqlparser.NewFloatVal(value.ToBytes())
+	}
+	return sqlparser.NewStrVal(value.ToBytes())
+}
+
+// generate returns the statements that change the target row from
+// the before image to the after image. Either of them can be nil.
+// If upsert is set, an insert updates the row if it already exists.
+func (tp *tablePlan) generate(before, after *rowImage, upsert bool) ([]string, error) {
+	beforeIn, err := tp.matches(before)
+	if err != nil {
+		return nil, err
+	}
+	afterIn, err := tp.matches(after)
+	if err != nil {
+		return nil, err
+	}
+	if beforeIn {
+		if before, err = tp.project(before); err != nil {
+			return nil, err
+		}
+	}
+	if afterIn {
+		if after, err = tp.project(after); err != nil {
+			return nil, err
+		}
+	}
+
+	table := sqlparser.TableName{Name: tp.target}
+	var stmt sqlparser.Statement
+	switch {
+	case beforeIn && afterIn:
+		upd := &sqlparser.Update{
+			TableExprs: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: table}},
+			Where:      sqlparser.NewWhere(sqlparser.WhereStr, before.condition()),
+		}
+		for i, col := range after.columns {
+			upd.Exprs = append(upd.Exprs, &sqlparser.UpdateExpr{
+				Name: &sqlparser.ColName{Name: col},
+				Expr: after.values[i],
+			})
+		}
+		stmt = upd
+	case afterIn:
+		ins := &sqlparser.Insert{
+			Action:  sqlparser.InsertStr,
+			Table:   table,
+			Columns: after.columns,
+			Rows:    sqlparser.Values{after.values},
+		}
+		if upsert {
+			for _, col := range after.columns {
+				ins.OnDup = append(ins.OnDup, &sqlparser.UpdateExpr{
+					Name: &sqlparser.ColName{Name: col},
+					Expr: &sqlparser.ValuesFuncExpr{Name: col},
+				})
+			}
+		}
+		stmt = ins
+	case beforeIn:
+		stmt = &sqlparser.Delete{
+			TableExprs: sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: table}},
+			Where:      sqlparser.NewWhere(sqlparser.WhereStr, before.condition()),
+		}
+	default:
+		return nil, nil
+	}
+	return []string{sqlparser.String(stmt)}, nil
+}
+
+// condition returns the where clause that matches the row image.
+func (ri *rowImage) condition() sqlparser.Expr {
+	var cond sqlparser.Expr
+	for i, col := range ri.columns {
+		var expr sqlparser.Expr
+		if _, ok := ri.values[i].(*sqlparser.NullVal); ok {
+			expr = &sqlparser.IsExpr{
+				Operator: sqlparser.IsNullStr,
+				Expr:     &sqlparser.ColName{Name: col},
+			}
+		} else {
+			expr = &sqlparser.ComparisonExpr{
+				Operator: sqlparser.EqualStr,
+				Left:     &sqlparser.ColName{Name: col},
+				Right:    ri.values[i],
+			}
+		}
+		if cond == nil {
+			cond = expr
+			continue
+		}
+		cond = &sqlparser.AndExpr{Left: cond, Right: expr}
+	}
+	return cond
+}
+
+// InsertRows returns the statement that inserts rows of the source
+// table, as copied from the source, in the target table. The rows are
+// filtered and projected like the statements of the stream. It returns
+// no statement if none of the rows match.
+func (sp *StreamPlan) InsertRows(table string, fields []*querypb.Field, rows [][]sqltypes.Value) ([]string, error) {
+	tp, ok := sp.tables[table]
+	if !ok {
+		return nil, fmt.Errorf("no rule for table %v", table)
+	}
+	ins := &sqlparser.Insert{
+		Action: sqlparser.InsertStr,
+		Table:  sqlparser.TableName{Name: tp.target},
+	}
+	var values sqlparser.Values
+	for _, row := range rows {
+		ri := &rowImage{}
+		for i, field := range fields {
+			ri.columns = append(ri.columns, sqlparser.NewColIdent(field.Name))
+			ri.values = append(ri.values, valueExpr(row[i]))
+		}
+		in, err := tp.matches(ri)
+		if err != nil {
+			return nil, err
+		}
+		if !in {
+			continue
+		}
+		projected, err := tp.project(ri)
+		if err != nil {
+			return nil, err
+		}
+		ins.Columns = projected.columns
+		values = append(values, projected.values)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	ins.Rows = values
+	return []string{sqlparser.String(ins)}, nil
+}
+
+// EncodeLastPK returns the tuple of the primary key values of row, as
+// stored in _vt.copy_state. The streams compare the primary keys of
+// their statements to it by their bytes, so the primary key can't
+// have columns that MySQL sorts otherwise, like the strings of a
+// collation.
+func EncodeLastPK(fields []*querypb.Field, row []sqltypes.Value, pkColumns []string) (string, error) {
+	var tuple sqlparser.ValTuple
+	for _, col := range pkColumns {
+		found := false
+		for i, field := range fields {
+			if sqlparser.NewColIdent(field.Name).EqualString(col) {
+				if sqltypes.IsText(field.Type) || field.Type == sqltypes.Enum || field.Type == sqltypes.Set {
+					return "", fmt.Errorf("unsupported: primary key column %v is a %v, which doesn't sort by its bytes, the table cannot be copied", col, strings.ToLower(field.Type.String()))
+				}
+				tuple = append(tuple, valueExpr(row[i]))
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("primary key column %v not found in %v", col, fields)
+		}
+	}
+	return sqlparser.String(tuple), nil
+}
+
+// parseTuple parses a tuple of values, like "(1, 'a')".
+func parseTuple(text string) (sqlparser.ValTuple, error) {
+	stmt, err := sqlparser.Parse("insert into t values " + text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse tuple %v: %v", text, err)
+	}
+	rows, ok := stmt.(*sqlparser.Insert).Rows.(sqlparser.Values)
+	if !ok || len(rows) != 1 {
+		return nil, fmt.Errorf("cannot parse tuple %v", text)
+	}
+	return rows[0], nil
+}
+
+// CopyChunkQuery returns the query that reads the next chunk of rows
+// of a table being copied, after the row of lastPK.
+func CopyChunkQuery(table string, pkColumns []string, lastPK string, chunkSize int) string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	var cols sqlparser.Columns
+	for _, col := range pkColumns {
+		cols = append(cols, sqlparser.NewColIdent(col))
+	}
+	buf.Myprintf("select * from %v", sqlparser.NewTableIdent(table))
+	if lastPK != "" {
+		buf.Myprintf(" where %v > %s", cols, lastPK)
+	}
+	buf.Myprintf(" order by ")
+	for i, col := range cols {
+		if i > 0 {
+			buf.Myprintf(", ")
+		}
+		buf.Myprintf("%v", col)
+	}
+	return fmt.Sprintf("%s limit %d", buf.String(), chunkSize)
+}
@@ -0,0 +1,411 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package binlogplayer
+
+import (
+	"reflect"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestBinlogSourceString(t *testing.T) {
+	bs := &BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{{
+			Match:  "t2",
+			Filter: "select * from t1",
+		}},
+	}
+	want := `{"keyspace":"ks","shard":"0","rules":[{"match":"t2","filter":"select * from t1"}]}`
+	if got := bs.String(); got != want {
+		t.Errorf("String() = %s, want %s", got, want)
+	}
+	got, err := ParseBinlogSource(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, bs) {
+		t.Errorf("ParseBinlogSource() = %v, want %v", got, bs)
+	}
+
+	if _, err := ParseBinlogSource("{"); err == nil {
+		t.Errorf("ParseBinlogSource({) succeeded, want error")
+	}
+}
+
+func TestBuildStreamPlanErrors(t *testing.T) {
+	testcases := []struct {
+		filter string
+		err    string
+	}{{
+		filter: "delete from t",
+		err:    "unexpected: delete from t not a select statement",
+	}, {
+		filter: "select id from t1, t2",
+		err:    "unsupported: multiple tables in select id from t1, t2",
+	}, {
+		filter: "select id from t order by id",
+		err:    "unsupported: select id from t order by id",
+	}, {
+		filter: "select id+1 from t",
+		err:    "unsupported: id + 1, only columns and keyspace_id can be selected",
+	}, {
+		filter: "select now() as t from t",
+		err:    "unsupported: now() as t, only columns and keyspace_id can be selected",
+	}, {
+		filter: "select keyspace_id(id, 'hash') from t",
+		err:    "keyspace_id must be aliased: keyspace_id(id, 'hash')",
+	}, {
+		filter: "select keyspace_id(id) as k from t",
+		err:    "keyspace_id takes 2 arguments: keyspace_id(id)",
+	}, {
+		filter: "select keyspace_id(1, 'hash') as k from t",
+		err:    "first argument of keyspace_id must be a column: 1",
+	}, {
+		filter: "select keyspace_id(id, 'lookup_hash') as k from t",
+		err:    "vindex lookup_hash is not functional",
+	}, {
+		filter: "select *, id from t",
+		err:    "unsupported: '*' with other expressions in select *, id from t",
+	}, {
+		filter: "select id from t where id = 1",
+		err:    "unsupported where clause: id = 1, only in_keyrange(column, vindex_type, range) is supported",
+	}, {
+		filter: "select id from t where in_keyrange(1, 'hash', '-80')",
+		err:    "first argument of in_keyrange must be a column: 1",
+	}, {
+		filter: "select id from t where in_keyrange(id, hash, '-80')",
+		err:    "unexpected argument to in_keyrange: hash, want a string",
+	}, {
+		filter: "select id from t where in_keyrange(id, 'lookup_hash', '-80')",
+		err:    "vindex lookup_hash is not functional",
+	}, {
+		filter: "select id from t where in_keyrange(id, 'hash', '-40-80')",
+		err:    "unexpected range in in_keyrange: -40-80",
+	}}
+	for _, tcase := range testcases {
+		_, err := BuildStreamPlan(&BinlogSource{
+			Rules: []*Rule{{Filter: tcase.filter}},
+		})
+		if err == nil || err.Error() != tcase.err {
+			t.Errorf("BuildStreamPlan(%s): %v, want %s", tcase.filter, err, tcase.err)
+		}
+	}
+
+	_, err := BuildStreamPlan(&BinlogSource{
+		Rules: []*Rule{{Filter: "select * from t"}, {Match: "t2", Filter: "select * from t"}},
+	})
+	want := "more than one rule for table t"
+	if err == nil || err.Error() != want {
+		t.Errorf("BuildStreamPlan(duplicate): %v, want %s", err, want)
+	}
+}
+
+func TestStreamPlanTransform(t *testing.T) {
+	plan, err := BuildStreamPlan(&BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{{
+			Filter: "select * from copied",
+		}, {
+			Match:  "target",
+			Filter: "select id, name as user_name from user where in_keyrange(id, 'hash', '-80')",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := plan.Tables(), []string{"copied", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Tables() = %v, want %v", got, want)
+	}
+
+	// hash(1), hash(2) and hash(3) are in -80, hash(4) is in 80-.
+	testcases := []struct {
+		in   string
+		want []string
+	}{{
+		in:   "SET TIMESTAMP=1",
+		want: []string{"SET TIMESTAMP=1"},
+	}, {
+		in:   "INSERT INTO other SET id=1",
+		want: nil,
+	}, {
+		in:   "INSERT INTO copied SET id=1, ts=convert_tz('2018-01-01 00:00:00', '+00:00', @@session.time_zone), c=NULL",
+		want: []string{"insert into copied(id, ts, c) values (1, convert_tz('2018-01-01 00:00:00', '+00:00', @@session.time_zone), null)"},
+	}, {
+		in:   "INSERT INTO user SET id=1, name='a\\'b', extra=X'0a'",
+		want: []string{"insert into target(id, user_name) values (1, 'a\\'b')"},
+	}, {
+		in:   "INSERT INTO user SET id=4, name='a', extra=1",
+		want: nil,
+	}, {
+		in:   "INSERT INTO user SET id=NULL, name='a', extra=1",
+		want: nil,
+	}, {
+		in:   "UPDATE user SET id=1, name='b', extra=2 WHERE id=1 AND name IS NULL AND extra=1",
+		want: []string{"update target set id = 1, user_name = 'b' where id = 1 and user_name is null"},
+	}, {
+		in:   "UPDATE user SET id=4, name='b', extra=2 WHERE id=1 AND name='a' AND extra=1",
+		want: []string{"delete from target where id = 1 and user_name = 'a'"},
+	}, {
+		in:   "UPDATE user SET id=2, name='b', extra=2 WHERE id=4 AND name='a' AND extra=1",
+		want: []string{"insert into target(id, user_name) values (2, 'b')"},
+	}, {
+		in:   "UPDATE user SET id=4, name='b', extra=2 WHERE id=4 AND name='a' AND extra=1",
+		want: nil,
+	}, {
+		in:   "DELETE FROM user WHERE id=3 AND name='a' AND extra=1",
+		want: []string{"delete from target where id = 3 and user_name = 'a'"},
+	}, {
+		in:   "DELETE FROM copied WHERE id=3 AND c IS NULL",
+		want: []string{"delete from copied where id = 3 and c is null"},
+	}}
+	for _, tcase := range testcases {
+		got, err := plan.Transform(tcase.in)
+		if err != nil {
+			t.Errorf("Transform(%s) failed: %v", tcase.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("Transform(%s):\n%q, want\n%q", tcase.in, got, tcase.want)
+		}
+	}
+
+	errcases := []struct {
+		in  string
+		err string
+	}{{
+		in:  "insert into user(id, name) values (1, 'a'), (2, 'b')",
+		err: "unexpected insert in stream: insert into user(id, name) values (1, 'a'), (2, 'b')",
+	}, {
+		in:  "update user set name='a' where id > 1",
+		err: "unexpected update in stream: update user set name='a' where id > 1: unexpected expression id > 1",
+	}, {
+		in:  "UPDATE user SET id=1 WHERE id=1",
+		err: "column name is not in the row image, binlog_row_image must be FULL",
+	}, {
+		in:  "DELETE FROM user WHERE name='a'",
+		err: "column id is not in the row image, binlog_row_image must be FULL",
+	}, {
+		in:  "create table t(id int)",
+		err: "unsupported statement in stream, binlog_format must be ROW: create table t(id int)",
+	}}
+	for _, tcase := range errcases {
+		_, err := plan.Transform(tcase.in)
+		if err == nil || err.Error() != tcase.err {
+			t.Errorf("Transform(%s): %v, want %s", tcase.in, err, tcase.err)
+		}
+	}
+}
+
+func TestStreamPlanCopy(t *testing.T) {
+	source := &BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{{
+			Filter: "select * from copied",
+		}, {
+			Match:  "target",
+			Filter: "select id, name as user_name from user where in_keyrange(id, 'hash', '-80')",
+		}},
+	}
+	plan, err := BuildStreamPlan(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.SetCopyState("copied", []string{"id", "name"}, "(2, 'b')"); err != nil {
+		t.Fatal(err)
+	}
+	if err := plan.SetCopyState("user", []string{"id"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		in   string
+		want []string
+	}{{
+		in:   "INSERT INTO copied SET id=1, name='z'",
+		want: []string{"insert into copied(id, name) values (1, 'z')"},
+	}, {
+		in:   "INSERT INTO copied SET id=2, name='b'",
+		want: []string{"insert into copied(id, name) values (2, 'b')"},
+	}, {
+		in:   "INSERT INTO copied SET id=2, name='c'",
+		want: nil,
+	}, {
+		in:   "UPDATE copied SET id=3, name='a' WHERE id=1 AND name='a'",
+		want: []string{"delete from copied where id = 1 and name = 'a'"},
+	}, {
+		in:   "DELETE FROM copied WHERE id=NULL AND name='a'",
+		want: []string{"delete from copied where id is null and name = 'a'"},
+	}, {
+		in:   "INSERT INTO user SET id=1, name='a'",
+		want: nil,
+	}}
+	for _, tcase := range testcases {
+		got, err := plan.Transform(tcase.in)
+		if err != nil {
+			t.Errorf("Transform(%s) failed: %v", tcase.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("Transform(%s):\n%q, want\n%q", tcase.in, got, tcase.want)
+		}
+	}
+
+	if err := plan.SetCopyState("other", []string{"id"}, ""); err == nil || err.Error() != "no rule for table other" {
+		t.Errorf("SetCopyState(other): %v, want no rule for table other", err)
+	}
+	if err := plan.SetCopyState("copied", []string{"id"}, "(1, 2)"); err == nil || err.Error() != "last primary key (1, 2) doesn't match columns [id]" {
+		t.Errorf("SetCopyState(mismatch): %v", err)
+	}
+	if _, err := plan.Transform("UPDATE copied SET id=1 WHERE name='a'"); err == nil || err.Error() != "column id is not in the row image, binlog_row_image must be FULL" {
+		t.Errorf("Transform(partial image): %v", err)
+	}
+}
+
+func TestStreamPlanKeyspaceID(t *testing.T) {
+	plan, err := BuildStreamPlan(&BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{{
+			Match:  "name_lookup",
+			Filter: "select name, keyspace_id(id, 'hash') as keyspace_id from user where in_keyrange(name, 'unicode_loose_md5', '80-')",
+		}},
+		Upsert: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hash(1) is 166b40b44aba4bd6, hash(2) is 06e7ea22ce92708f.
+	// unicode_loose_md5('a') is in 80-, unicode_loose_md5('c') is in -80.
+	testcases := []struct {
+		in   string
+		want []string
+	}{{
+		in:   "INSERT INTO user SET id=1, name='a', extra=1",
+		want: []string{"insert into name_lookup(name, keyspace_id) values ('a', X'166b40b44aba4bd6') on duplicate key update name = values(name), keyspace_id = values(keyspace_id)"},
+	}, {
+		in:   "INSERT INTO user SET id=1, name='c', extra=1",
+		want: nil,
+	}, {
+		in:   "UPDATE user SET id=2, name='a', extra=2 WHERE id=1 AND name='a' AND extra=1",
+		want: []string{"update name_lookup set name = 'a', keyspace_id = X'06e7ea22ce92708f' where name = 'a' and keyspace_id = X'166b40b44aba4bd6'"},
+	}, {
+		in:   "DELETE FROM user WHERE id=NULL AND name='a' AND extra=1",
+		want: []string{"delete from name_lookup where name = 'a' and keyspace_id is null"},
+	}}
+	for _, tcase := range testcases {
+		got, err := plan.Transform(tcase.in)
+		if err != nil {
+			t.Errorf("Transform(%s) failed: %v", tcase.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("Transform(%s):\n%q, want\n%q", tcase.in, got, tcase.want)
+		}
+	}
+
+	result := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields("id|name", "int64|varchar"),
+		"1|a",
+		"2|c",
+	)
+	got, err := plan.InsertRows("user", result.Fields, result.Rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"insert into name_lookup(name, keyspace_id) values ('a', X'166b40b44aba4bd6')"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InsertRows():\n%q, want\n%q", got, want)
+	}
+}
+
+func TestStreamPlanInsertRows(t *testing.T) {
+	plan, err := BuildStreamPlan(&BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*Rule{{
+			Match:  "target",
+			Filter: "select id, name as user_name from user where in_keyrange(id, 'hash', '-80')",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields("id|name|price|extra", "int64|varchar|decimal|varbinary"),
+		"1|a'b|1.5|x'y",
+		"4|c|2|y",
+		"2|null|0|z",
+	)
+	got, err := plan.InsertRows("user", result.Fields, result.Rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"insert into target(id, user_name) values (1, 'a\\'b'), (2, null)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InsertRows():\n%q, want\n%q", got, want)
+	}
+
+	got, err = plan.InsertRows("user", result.Fields, result.Rows[1:2])
+	if err != nil || got != nil {
+		t.Errorf("InsertRows(out of range): %q, %v, want nil", got, err)
+	}
+	if _, err := plan.InsertRows("other", result.Fields, result.Rows); err == nil || err.Error() != "no rule for table other" {
+		t.Errorf("InsertRows(other): %v, want no rule for table other", err)
+	}
+
+	lastPK, err := EncodeLastPK(result.Fields, result.Rows[0], []string{"id", "price", "extra"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "(1, 1.5, 'x\\'y')"; lastPK != want {
+		t.Errorf("EncodeLastPK() = %s, want %s", lastPK, want)
+	}
+	if _, err := EncodeLastPK(result.Fields, result.Rows[0], []string{"other"}); err == nil {
+		t.Errorf("EncodeLastPK(other) succeeded, want error")
+	}
+	// MySQL sorts the varchar by its collation, which the stream
+	// can't compare.
+	if _, err := EncodeLastPK(result.Fields, result.Rows[0], []string{"id", "name"}); err == nil || err.Error() != "unsupported: primary key column name is a varchar, which doesn't sort by its bytes, the table cannot be copied" {
+		t.Errorf("EncodeLastPK(name): %v, want a varchar error", err)
+	}
+}
+
+func TestCopyChunkQuery(t *testing.T) {
+	testcases := []struct {
+		pkColumns []string
+		lastPK    string
+		want      string
+	}{{
+		pkColumns: []string{"id"},
+		want:      "select * from user order by id limit 100",
+	}, {
+		pkColumns: []string{"id", "name"},
+		lastPK:    "(1, 'a')",
+		want:      "select * from user where (id, name) > (1, 'a') order by id, name limit 100",
+	}}
+	for _, tcase := range testcases {
+		if got := CopyChunkQuery("user", tcase.pkColumns, tcase.lastPK, 100); got != tcase.want {
+			t.Errorf("CopyChunkQuery(%v, %s) = %s, want %s", tcase.pkColumns, tcase.lastPK, got, tcase.want)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"path"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// CellTabletsPushWatcher keeps a TabletRecorder up to date with all the
+// tablets of a cell, like a TopologyWatcher returned by
+// NewCellTabletsWatcher. But instead of reading all the tablet records
+// every refreshInterval, it uses topo watches: one on the
+// ShardReplication object of each shard in the cell, and one on the
+// record of each tablet these objects list. Tablets are then added,
+// replaced and removed as soon as the topo server notifies a change.
+//
+// The topo server cannot watch directories, so the list of shards in
+// the cell is still read every refreshInterval. This is one directory
+// listing per keyspace, and only matters when a shard gets its first
+// tablet in the cell. Watches that fail are also re-established at
+// that interval.
+type CellTabletsPushWatcher struct {
+	// set at construction time
+	topoServer      *topo.Server
+	tr              TabletRecorder
+	cell            string
+	refreshInterval time.Duration
+	sem             chan int
+	ctx             context.Context
+	cancelFunc      context.CancelFunc
+	// wg keeps track of all launched Go routines.
+	wg sync.WaitGroup
+
+	// mu protects all variables below
+	mu sync.Mutex
+	// shards has the watched shards of the cell.
+	shards map[shardKey]*shardWatch
+	// tablets is indexed by tablet alias.
+	tablets map[string]*tabletWatch
+	// firstLoadDone is true when first load of the topology data is done.
+	firstLoadDone bool
+	// firstLoadChan is closed when the initial loading of topology data is done.
+	firstLoadChan chan struct{}
+}
+
+// shardKey identifies a shard.
+type shardKey struct {
+	keyspace string
+	shard    string
+}
+
+// shardWatch is a watch on the ShardReplication object of a shard.
+type shardWatch struct {
+	cancel context.CancelFunc
+	// aliases has the tablets listed by the last value of the object.
+	aliases map[string]bool
+}
+
+// tabletWatch is a watch on the record of a tablet.
+type tabletWatch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// refs is the number of shards that list the tablet. It is
+	// usually 1, but a tablet can briefly be listed in two shards.
+	refs int
+	// tablet is the value given to the TabletRecorder, if any.
+	tablet *topodatapb.Tablet
+}
+
+// NewCellTabletsPushWatcher returns a CellTabletsPushWatcher that
+// monitors all the tablets in a cell, and starts watching.
+func NewCellTabletsPushWatcher(topoServer *topo.Server, tr TabletRecorder, cell string, refreshInterval time.Duration, topoReadConcurrency int) *CellTabletsPushWatcher {
+	tw := &CellTabletsPushWatcher{
+		topoServer:      topoServer,
+		tr:              tr,
+		cell:            cell,
+		refreshInterval: refreshInterval,
+		sem:             make(chan int, topoReadConcurrency),
+		shards:          make(map[shardKey]*shardWatch),
+		tablets:         make(map[string]*tabletWatch),
+	}
+	tw.firstLoadChan = make(chan struct{})
+	tw.ctx, tw.cancelFunc = context.WithCancel(context.Background())
+	tw.wg.Add(1)
+	go tw.watch()
+	return tw
+}
+
+// watch lists the shards of the cell periodically, and watches them.
+func (tw *CellTabletsPushWatcher) watch() {
+	defer tw.wg.Done()
+	ticker := time.NewTicker(tw.refreshInterval)
+	defer ticker.Stop()
+	for {
+		tw.loadShards()
+		select {
+		case <-tw.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadShards lists the shards that have a ShardReplication object in
+// the cell, starts watching the new ones, and stops watching the ones
+// that went away. The first time, it waits until the tablets of all
+// the shards were given to the TabletRecorder.
+func (tw *CellTabletsPushWatcher) loadShards() {
+	shards, err := tw.listShards()
+	if err != nil {
+		select {
+		case <-tw.ctx.Done():
+			return
+		default:
+		}
+		log.Errorf("cannot list shards for cell: %v: %v", tw.cell, err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	tw.mu.Lock()
+	for key, sw := range tw.shards {
+		if !shards[key] {
+			tw.stopShardLocked(key, sw)
+		}
+	}
+	for key := range shards {
+		if _, ok := tw.shards[key]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(tw.ctx)
+		sw := &shardWatch{
+			cancel:  cancel,
+			aliases: make(map[string]bool),
+		}
+		tw.shards[key] = sw
+		wg.Add(1)
+		go func(key shardKey) {
+			defer wg.Done()
+			filePath := path.Join(topo.KeyspacesPath, key.keyspace, topo.ShardsPath, key.shard, topo.ShardReplicationFile)
+			tw.watchFile(ctx, filePath, func(contents []byte) {
+				tw.updateShard(key, sw, contents)
+			})
+		}(key)
+	}
+	tw.mu.Unlock()
+	wg.Wait()
+
+	tw.mu.Lock()
+	if !tw.firstLoadDone {
+		tw.firstLoadDone = true
+		close(tw.firstLoadChan)
+	}
+	tw.mu.Unlock()
+}
+
+// listShards returns all the shards that have a ShardReplication
+// object in the cell.
+func (tw *CellTabletsPushWatcher) listShards() (map[shardKey]bool, error) {
+	conn, err := tw.topoServer.ConnForCell(tw.ctx, tw.cell)
+	if err != nil {
+		return nil, err
+	}
+	keyspaces, err := conn.ListDir(tw.ctx, topo.KeyspacesPath, false /*full*/)
+	switch err {
+	case nil:
+	case topo.ErrNoNode:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	result := make(map[shardKey]bool)
+	for _, keyspace := range keyspaces {
+		shards, err := conn.ListDir(tw.ctx, path.Join(topo.KeyspacesPath, keyspace.Name, topo.ShardsPath), false /*full*/)
+		switch err {
+		case nil:
+		case topo.ErrNoNode:
+			continue
+		default:
+			return nil, err
+		}
+		for _, shard := range shards {
+			result[shardKey{keyspace: keyspace.Name, shard: shard.Name}] = true
+		}
+	}
+	return result, nil
+}
+
+// updateShard is called with each value of the ShardReplication
+// object of a shard. contents is nil when the object does not exist.
+func (tw *CellTabletsPushWatcher) updateShard(key shardKey, sw *shardWatch, contents []byte) {
+	aliases := make(map[string]*topodatapb.TabletAlias)
+	if contents != nil {
+		sr := &topodatapb.ShardReplication{}
+		if err := proto.Unmarshal(contents, sr); err != nil {
+			log.Errorf("cannot unpack ShardReplication for %v/%v in cell %v: %v", key.keyspace, key.shard, tw.cell, err)
+			return
+		}
+		for _, node := range sr.Nodes {
+			aliases[topoproto.TabletAliasString(node.TabletAlias)] = node.TabletAlias
+		}
+	}
+
+	tw.mu.Lock()
+	if tw.shards[key] != sw {
+		// We stopped watching this shard.
+		tw.mu.Unlock()
+		return
+	}
+	for alias := range sw.aliases {
+		if _, ok := aliases[alias]; !ok {
+			delete(sw.aliases, alias)
+			tw.releaseTabletLocked(alias)
+		}
+	}
+	added := make(map[string]*tabletWatch)
+	for alias := range aliases {
+		if sw.aliases[alias] {
+			continue
+		}
+		sw.aliases[alias] = true
+		if w, ok := tw.tablets[alias]; ok {
+			w.refs++
+			continue
+		}
+		w := &tabletWatch{refs: 1}
+		w.ctx, w.cancel = context.WithCancel(tw.ctx)
+		tw.tablets[alias] = w
+		added[alias] = w
+	}
+	tw.mu.Unlock()
+
+	// Read the new tablets, and start watching them.
+	var wg sync.WaitGroup
+	for alias, w := range added {
+		wg.Add(1)
+		go func(alias string, w *tabletWatch) {
+			defer wg.Done()
+			tw.sem <- 1 // Wait for active queue to drain.
+			defer func() { <-tw.sem }()
+			filePath := path.Join(topo.TabletsPath, alias, topo.TabletFile)
+			tw.watchFile(w.ctx, filePath, func(contents []byte) {
+				tw.updateTablet(alias, w, contents)
+			})
+		}(alias, w)
+	}
+	wg.Wait()
+}
+
+// updateTablet is called with each value of the record of a tablet.
+// contents is nil when the record does not exist.
+func (tw *CellTabletsPushWatcher) updateTablet(alias string, w *tabletWatch, contents []byte) {
+	var tablet *topodatapb.Tablet
+	if contents != nil {
+		tablet = &topodatapb.Tablet{}
+		if err := proto.Unmarshal(contents, tablet); err != nil {
+			log.Errorf("cannot unpack tablet %v: %v", alias, err)
+			return
+		}
+	}
+
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.tablets[alias] != w {
+		// We stopped watching this tablet.
+		return
+	}
+	switch {
+	case w.tablet == nil && tablet != nil:
+		tw.tr.AddTablet(tablet, alias)
+	case w.tablet != nil && tablet == nil:
+		tw.tr.RemoveTablet(w.tablet)
+	case w.tablet != nil && tablet != nil:
+		if TabletToMapKey(w.tablet) != TabletToMapKey(tablet) {
+			tw.tr.ReplaceTablet(w.tablet, tablet, alias)
+		}
+	}
+	w.tablet = tablet
+}
+
+// stopShardLocked stops watching a shard, and releases its tablets.
+// tw.mu must be held.
+func (tw *CellTabletsPushWatcher) stopShardLocked(key shardKey, sw *shardWatch) {
+	sw.cancel()
+	for alias := range sw.aliases {
+		tw.releaseTabletLocked(alias)
+	}
+	delete(tw.shards, key)
+}
+
+// releaseTabletLocked is called when a shard does not list a tablet
+// anymore. When no shard lists it, it stops watching the tablet and
+// removes it from the TabletRecorder. tw.mu must be held.
+func (tw *CellTabletsPushWatcher) releaseTabletLocked(alias string) {
+	w, ok := tw.tablets[alias]
+	if !ok {
+		return
+	}
+	w.refs--
+	if w.refs > 0 {
+		return
+	}
+	w.cancel()
+	if w.tablet != nil {
+		tw.tr.RemoveTablet(w.tablet)
+	}
+	delete(tw.tablets, alias)
+}
+
+// watchFile watches a file in the cell until ctx is done, and calls
+// update with each of its values, or with nil if it does not exist.
+// It returns once the current value was handled. The changes are
+// handled in the background. If the watch fails, it is re-established
+// after refreshInterval.
+func (tw *CellTabletsPushWatcher) watchFile(ctx context.Context, filePath string, update func(contents []byte)) {
+	changes, cancel := tw.startWatch(ctx, filePath, update)
+	tw.wg.Add(1)
+	go func() {
+		defer tw.wg.Done()
+		for {
+			tw.waitForChanges(ctx, filePath, changes, cancel, update)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(tw.refreshInterval):
+			}
+			changes, cancel = tw.startWatch(ctx, filePath, update)
+		}
+	}()
+}
+
+// startWatch starts a watch on a file, and handles its current value.
+// It returns a nil channel if the watch could not be started.
+func (tw *CellTabletsPushWatcher) startWatch(ctx context.Context, filePath string, update func(contents []byte)) (<-chan *topo.WatchData, topo.CancelFunc) {
+	conn, err := tw.topoServer.ConnForCell(ctx, tw.cell)
+	if err != nil {
+		log.Warningf("cannot watch %v in cell %v: %v", filePath, tw.cell, err)
+		return nil, nil
+	}
+	current, changes, cancel := conn.Watch(ctx, filePath)
+	switch current.Err {
+	case nil:
+		update(current.Contents)
+		return changes, cancel
+	case topo.ErrNoNode:
+		update(nil)
+	default:
+		log.Warningf("cannot watch %v in cell %v: %v", filePath, tw.cell, current.Err)
+	}
+	return nil, nil
+}
+
+// waitForChanges handles the changes of a watch, until it fails or ctx
+// is done.
+func (tw *CellTabletsPushWatcher) waitForChanges(ctx context.Context, filePath string, changes <-chan *topo.WatchData, cancel topo.CancelFunc, update func(contents []byte)) {
+	if changes == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			cancel()
+			for range changes {
+			}
+			return
+		case wd, ok := <-changes:
+			if !ok {
+				return
+			}
+			switch wd.Err {
+			case nil:
+				update(wd.Contents)
+			case topo.ErrNoNode:
+				update(nil)
+			case topo.ErrInterrupted:
+			default:
+				log.Warningf("watch on %v in cell %v failed: %v", filePath, tw.cell, wd.Err)
+			}
+		}
+	}
+}
+
+// WaitForInitialTopology waits until the watcher reads all of the topology data
+// for the first time and transfers the information to TabletRecorder via its
+// AddTablet() method.
+func (tw *CellTabletsPushWatcher) WaitForInitialTopology() error {
+	select {
+	case <-tw.ctx.Done():
+		return tw.ctx.Err()
+	case <-tw.firstLoadChan:
+		return nil
+	}
+}
+
+// Stop stops the watcher. It does not clean up the tablets added to TabletRecorder.
+func (tw *CellTabletsPushWatcher) Stop() {
+	tw.cancelFunc()
+	// wait for all watch goroutines to finish.
+	tw.wg.Wait()
+}
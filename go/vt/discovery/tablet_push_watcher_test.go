@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package discovery
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestCellTabletsPushWatcher(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("aa")
+	fhc := NewFakeHealthCheck()
+
+	tablet0 := pushWatcherTablet(0, "ks", "0", 100)
+	if err := ts.CreateTablet(ctx, tablet0); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+
+	// The refresh interval is long enough so all the changes
+	// below have to be pushed by the watches.
+	tw := NewCellTabletsPushWatcher(ts, fhc, "aa", 10*time.Minute, 5)
+	defer tw.Stop()
+	if err := tw.WaitForInitialTopology(); err != nil {
+		t.Fatalf("WaitForInitialTopology failed: %v", err)
+	}
+	if got, want := tabletKeys(fhc), []string{TabletToMapKey(tablet0)}; !equalKeys(got, want) {
+		t.Fatalf("initial tablets = %v, want %v", got, want)
+	}
+
+	// A new tablet in the shard is added.
+	tablet1 := pushWatcherTablet(1, "ks", "0", 200)
+	if err := ts.CreateTablet(ctx, tablet1); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+	waitForTabletKeys(t, fhc, TabletToMapKey(tablet0), TabletToMapKey(tablet1))
+
+	// A new port replaces the tablet.
+	if _, err := ts.UpdateTabletFields(ctx, tablet0.Alias, func(t *topodatapb.Tablet) error {
+		t.PortMap["vt"] = 101
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateTabletFields failed: %v", err)
+	}
+	tablet0.PortMap["vt"] = 101
+	waitForTabletKeys(t, fhc, TabletToMapKey(tablet0), TabletToMapKey(tablet1))
+
+	// A tablet removed from the shard is removed.
+	if err := topo.DeleteTabletReplicationData(ctx, ts, tablet1); err != nil {
+		t.Fatalf("DeleteTabletReplicationData failed: %v", err)
+	}
+	waitForTabletKeys(t, fhc, TabletToMapKey(tablet0))
+
+	// A deleted tablet record is removed too.
+	if err := ts.DeleteTablet(ctx, tablet0.Alias); err != nil {
+		t.Fatalf("DeleteTablet failed: %v", err)
+	}
+	waitForTabletKeys(t, fhc)
+}
+
+func TestCellTabletsPushWatcherNewShard(t *testing.T) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("aa")
+	fhc := NewFakeHealthCheck()
+
+	tw := NewCellTabletsPushWatcher(ts, fhc, "aa", 10*time.Millisecond, 5)
+	defer tw.Stop()
+	if err := tw.WaitForInitialTopology(); err != nil {
+		t.Fatalf("WaitForInitialTopology failed: %v", err)
+	}
+
+	// New shards are found at the next refresh.
+	tablet := pushWatcherTablet(0, "ks", "-80", 100)
+	if err := ts.CreateTablet(ctx, tablet); err != nil {
+		t.Fatalf("CreateTablet failed: %v", err)
+	}
+	waitForTabletKeys(t, fhc, TabletToMapKey(tablet))
+
+	// And shards that went away are not watched anymore.
+	if err := ts.DeleteShardReplication(ctx, "aa", "ks", "-80"); err != nil {
+		t.Fatalf("DeleteShardReplication failed: %v", err)
+	}
+	waitForTabletKeys(t, fhc)
+}
+
+func pushWatcherTablet(uid uint32, keyspace, shard string, port int32) *topodatapb.Tablet {
+	return &topodatapb.Tablet{
+		Alias: &topodatapb.TabletAlias{
+			Cell: "aa",
+			Uid:  uid,
+		},
+		Hostname: "host",
+		PortMap: map[string]int32{
+			"vt": port,
+		},
+		Keyspace: keyspace,
+		Shard:    shard,
+	}
+}
+
+func tabletKeys(fhc *FakeHealthCheck) []string {
+	var keys []string
+	for key := range fhc.GetAllTablets() {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalKeys(got, want []string) bool {
+	sort.Strings(want)
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func waitForTabletKeys(t *testing.T, fhc *FakeHealthCheck, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := tabletKeys(fhc)
+		if equalKeys(got, want) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("tablets = %v, want %v", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,483 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package failover detects the masters that are dead, and replaces
+// them with the most advanced replica, using EmergencyReparentShard.
+package failover
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/event"
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/events"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/wrangler"
+
+	replicationdatapb "vitess.io/vitess/go/vt/proto/replicationdata"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	// failoverCounts counts the failovers by result.
+	failoverCounts = stats.NewCounters("MasterFailovers")
+)
+
+// Config is the configuration of a Detector.
+type Config struct {
+	// CheckInterval is the interval between two checks of
+	// the masters.
+	CheckInterval time.Duration
+
+	// MasterDownTimeout is how long the healthcheck of a master
+	// must fail before its replicas are asked to confirm it is dead.
+	MasterDownTimeout time.Duration
+
+	// MinConfirmingCells is the number of cells where at least
+	// one replica must have lost its connection to the master.
+	// A failover always needs at least one such replica.
+	MinConfirmingCells int
+
+	// PreferredCells, if set, are the cells where the new master
+	// can be, in order of preference. Otherwise, it can be in any
+	// cell, preferably the cell of the old master.
+	PreferredCells []string
+
+	// WaitSlaveTimeout is the timeout of the replication RPCs,
+	// and of the EmergencyReparentShard steps.
+	WaitSlaveTimeout time.Duration
+
+	// Cooldown is the minimum time between two failovers of
+	// a shard, so a failover cannot trigger another one.
+	Cooldown time.Duration
+
+	// DryRun only reports the failovers, without doing them.
+	DryRun bool
+}
+
+// Detector watches the health of the masters, as a listener of a
+// discovery.HealthCheck. When the healthcheck of a master fails for
+// MasterDownTimeout, it locks the shard, checks that the replicas of
+// enough cells lost their connection to the master, and promotes
+// the most advanced replica with EmergencyReparentShard. The shard
+// lock, and the check that the master is still the one of the shard
+// once the lock is taken, make sure that the Detectors of several
+// vtctld instances do not fail over the same master twice.
+type Detector struct {
+	// Immutable, set at construction time.
+	wr     *wrangler.Wrangler
+	config Config
+
+	// mu protects the following fields.
+	mu sync.Mutex
+	// masters are the masters known to the healthcheck,
+	// by tablet alias.
+	masters map[string]*masterHealth
+	// lastFailover is the time of the last failover of each
+	// shard, by keyspace/shard.
+	lastFailover map[string]time.Time
+	// lastStatus is the last status reported for each shard,
+	// by keyspace/shard, so the same decision is only
+	// reported once.
+	lastStatus map[string]string
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+// masterHealth is the health of a master.
+type masterHealth struct {
+	tablet *topodatapb.Tablet
+	// downSince is when the healthcheck of the master started
+	// failing. It is zero while the master is healthy.
+	downSince time.Time
+}
+
+// NewDetector creates a new Detector. It is not open.
+func NewDetector(wr *wrangler.Wrangler, config Config) *Detector {
+	return &Detector{
+		wr:           wr,
+		config:       config,
+		masters:      make(map[string]*masterHealth),
+		lastFailover: make(map[string]time.Time),
+		lastStatus:   make(map[string]string),
+	}
+}
+
+// StatsUpdate is part of the discovery.HealthCheckStatsListener interface.
+func (d *Detector) StatsUpdate(stats *discovery.TabletStats) {
+	alias := topoproto.TabletAliasString(stats.Tablet.Alias)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !stats.Up || stats.Target == nil || stats.Target.TabletType != topodatapb.TabletType_MASTER {
+		delete(d.masters, alias)
+		return
+	}
+	mh, ok := d.masters[alias]
+	if !ok {
+		mh = &masterHealth{}
+		d.masters[alias] = mh
+	}
+	mh.tablet = stats.Tablet
+	switch {
+	case stats.LastError == nil:
+		mh.downSince = time.Time{}
+	case mh.downSince.IsZero():
+		log.Infof("Healthcheck of master %v failed: %v", alias, stats.LastError)
+		mh.downSince = time.Now()
+	}
+}
+
+// Open starts checking the masters. It does nothing if the
+// Detector is already open.
+func (d *Detector) Open(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return
+	}
+	log.Infof("Opening failover Detector, dry run: %v", d.config.DryRun)
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+	go d.run(ctx, d.done)
+}
+
+// Close stops checking the masters, and cancels the failovers
+// in progress. It does nothing if the Detector is not open.
+func (d *Detector) Close() {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel = nil
+	d.done = nil
+	d.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	log.Infof("Closing failover Detector")
+	cancel()
+	<-done
+}
+
+// run checks the masters until ctx is canceled, then closes done.
+func (d *Detector) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.config.CheckInterval):
+		}
+		d.check(ctx)
+	}
+}
+
+// check fails over the masters whose healthcheck failed for
+// MasterDownTimeout, except the ones of the shards in cooldown.
+func (d *Detector) check(ctx context.Context) {
+	now := time.Now()
+	var down []*topodatapb.Tablet
+	d.mu.Lock()
+	for _, mh := range d.masters {
+		if mh.downSince.IsZero() || now.Sub(mh.downSince) < d.config.MasterDownTimeout {
+			continue
+		}
+		if last, ok := d.lastFailover[shardKey(mh.tablet)]; ok && now.Sub(last) < d.config.Cooldown {
+			continue
+		}
+		down = append(down, mh.tablet)
+	}
+	d.mu.Unlock()
+
+	wg := sync.WaitGroup{}
+	for _, master := range down {
+		wg.Add(1)
+		go func(master *topodatapb.Tablet) {
+			defer wg.Done()
+			if err := d.failover(ctx, master); err != nil {
+				log.Warningf("Cannot fail over master %v of %v: %v", topoproto.TabletAliasString(master.Alias), shardKey(master), err)
+			}
+		}(master)
+	}
+	wg.Wait()
+}
+
+// failover replaces a master that looks dead, if its replicas
+// confirm it is.
+func (d *Detector) failover(ctx context.Context, master *topodatapb.Tablet) (err error) {
+	ev := &events.MasterFailover{
+		KeyspaceName: master.Keyspace,
+		ShardName:    master.Shard,
+		OldMaster:    master.Alias,
+		DryRun:       d.config.DryRun,
+	}
+	masterAliasStr := topoproto.TabletAliasString(master.Alias)
+
+	// Only one vtctld makes the decision.
+	ctx, unlock, err := d.wr.TopoServer().LockShard(ctx, master.Keyspace, master.Shard, fmt.Sprintf("automatic failover of %v", masterAliasStr))
+	if err != nil {
+		return err
+	}
+	defer unlock(&err)
+
+	si, err := d.wr.TopoServer().GetShard(ctx, master.Keyspace, master.Shard)
+	if err != nil {
+		return err
+	}
+	if !topoproto.TabletAliasEqual(si.MasterAlias, master.Alias) {
+		log.Infof("Master %v is not the master of %v anymore, not failing over", masterAliasStr, shardKey(master))
+		return nil
+	}
+	tabletMap, err := d.wr.TopoServer().GetTabletMapForShard(ctx, master.Keyspace, master.Shard)
+	if err != nil {
+		return err
+	}
+	statuses := d.replicationStatuses(ctx, tabletMap, master.Alias)
+	if err := d.confirmMasterDead(tabletMap, statuses); err != nil {
+		d.reportOnce(ev, "not failing over: "+err.Error())
+		return nil
+	}
+	newMaster, relayLogPos, err := d.chooseNewMaster(master, tabletMap, statuses)
+	if err != nil {
+		d.reportOnce(ev, "cannot fail over: "+err.Error())
+		failoverCounts.Add("NoCandidate", 1)
+		return nil
+	}
+	ev.NewMaster = newMaster.Alias
+	newMasterAliasStr := topoproto.TabletAliasString(newMaster.Alias)
+
+	d.mu.Lock()
+	d.lastFailover[shardKey(master)] = time.Now()
+	d.mu.Unlock()
+	if d.config.DryRun {
+		d.report(ev, "would promote "+newMasterAliasStr)
+		failoverCounts.Add("DryRun", 1)
+		return nil
+	}
+
+	d.report(ev, "promoting "+newMasterAliasStr)
+	if err := d.waitForRelayLogs(ctx, newMaster, relayLogPos); err != nil {
+		d.report(ev, "failed: "+err.Error())
+		failoverCounts.Add("Failed", 1)
+		return err
+	}
+	if err := d.wr.EmergencyReparentShardLocked(ctx, master.Keyspace, master.Shard, newMaster.Alias, d.config.WaitSlaveTimeout); err != nil {
+		d.report(ev, "failed: "+err.Error())
+		failoverCounts.Add("Failed", 1)
+		return err
+	}
+	d.report(ev, "finished")
+	failoverCounts.Add("Succeeded", 1)
+	return nil
+}
+
+// replicationStatuses returns the replication status of the
+// replicas of the shard that answer, by tablet alias.
+func (d *Detector) replicationStatuses(ctx context.Context, tabletMap map[string]*topo.TabletInfo, masterAlias *topodatapb.TabletAlias) map[string]*replicationdatapb.Status {
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	statuses := make(map[string]*replicationdatapb.Status)
+	for alias, ti := range tabletMap {
+		if topoproto.TabletAliasEqual(ti.Alias, masterAlias) || (ti.Type != topodatapb.TabletType_REPLICA && ti.Type != topodatapb.TabletType_RDONLY) {
+			continue
+		}
+		wg.Add(1)
+		go func(alias string, ti *topo.TabletInfo) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, d.config.WaitSlaveTimeout)
+			defer cancel()
+			status, err := d.wr.TabletManagerClient().SlaveStatus(ctx, ti.Tablet)
+			if err != nil {
+				log.Warningf("Cannot get the replication status of %v, ignoring it: %v", alias, err)
+				return
+			}
+			mu.Lock()
+			statuses[alias] = status
+			mu.Unlock()
+		}(alias, ti)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// confirmMasterDead returns an error unless the replicas of at least
+// MinConfirmingCells cells lost their connection to the master, and
+// no replica is still connected to it. At least one replica must
+// confirm it, even if MinConfirmingCells is 0.
+// A replica only confirms it if it keeps trying to reconnect to the
+// master while applying its relay logs: a replica whose replication
+// was stopped, for instance for a backup, tells nothing about the
+// master.
+func (d *Detector) confirmMasterDead(tabletMap map[string]*topo.TabletInfo, statuses map[string]*replicationdatapb.Status) error {
+	cells := make(map[string]bool)
+	for alias, status := range statuses {
+		if status.SlaveIoRunning {
+			return fmt.Errorf("replica %v is still connected to the master", alias)
+		}
+		if !status.SlaveSqlRunning || !status.SlaveIoConnecting {
+			continue
+		}
+		cells[tabletMap[alias].Alias.Cell] = true
+	}
+	if len(cells) == 0 {
+		return fmt.Errorf("no replica confirmed that it lost its connection to the master")
+	}
+	if len(cells) < d.config.MinConfirmingCells {
+		return fmt.Errorf("the replicas of %v cells lost their connection to the master, want %v", len(cells), d.config.MinConfirmingCells)
+	}
+	return nil
+}
+
+// candidate is a replica that could become the master.
+type candidate struct {
+	tablet *topodatapb.Tablet
+	pos    mysql.Position
+}
+
+// chooseNewMaster returns the replica to promote, and the position
+// of its relay logs. It must have received all the transactions
+// that the other tablets received, so no transaction is lost.
+// Among these replicas, it picks the one in the preferred cell.
+func (d *Detector) chooseNewMaster(master *topodatapb.Tablet, tabletMap map[string]*topo.TabletInfo, statuses map[string]*replicationdatapb.Status) (*topodatapb.Tablet, mysql.Position, error) {
+	var all []candidate
+	for alias, status := range statuses {
+		encoded := status.RelayLogPosition
+		if encoded == "" {
+			encoded = status.Position
+		}
+		pos, err := mysql.DecodePosition(encoded)
+		if err != nil {
+			return nil, mysql.Position{}, fmt.Errorf("cannot decode the position %v of %v: %v", encoded, alias, err)
+		}
+		all = append(all, candidate{tablet: tabletMap[alias].Tablet, pos: pos})
+	}
+
+	var best []candidate
+	for _, c := range all {
+		if c.tablet.Type != topodatapb.TabletType_REPLICA || d.cellRank(c.tablet.Alias.Cell, master.Alias.Cell) < 0 {
+			continue
+		}
+		mostAdvanced := true
+		for _, other := range all {
+			if !c.pos.AtLeast(other.pos) {
+				mostAdvanced = false
+				break
+			}
+		}
+		if mostAdvanced {
+			best = append(best, c)
+		}
+	}
+	if len(best) == 0 {
+		return nil, mysql.Position{}, fmt.Errorf("no eligible replica received all the transactions that the other tablets received")
+	}
+	sort.Slice(best, func(i, j int) bool {
+		ri, rj := d.cellRank(best[i].tablet.Alias.Cell, master.Alias.Cell), d.cellRank(best[j].tablet.Alias.Cell, master.Alias.Cell)
+		if ri != rj {
+			return ri < rj
+		}
+		return topoproto.TabletAliasString(best[i].tablet.Alias) < topoproto.TabletAliasString(best[j].tablet.Alias)
+	})
+	return best[0].tablet, best[0].pos, nil
+}
+
+// cellRank returns the rank of a cell for the new master, the lowest
+// first, or -1 if the new master cannot be in that cell.
+func (d *Detector) cellRank(cell, masterCell string) int {
+	if len(d.config.PreferredCells) == 0 {
+		if cell == masterCell {
+			return 0
+		}
+		return 1
+	}
+	for i, c := range d.config.PreferredCells {
+		if c == cell {
+			return i
+		}
+	}
+	return -1
+}
+
+// waitForRelayLogs waits until the tablet applied its relay logs,
+// up to pos, so it is as advanced as it can be before it is
+// promoted.
+func (d *Detector) waitForRelayLogs(ctx context.Context, tablet *topodatapb.Tablet, pos mysql.Position) error {
+	ctx, cancel := context.WithTimeout(ctx, d.config.WaitSlaveTimeout)
+	defer cancel()
+	alias := topoproto.TabletAliasString(tablet.Alias)
+	for {
+		status, err := d.wr.TabletManagerClient().SlaveStatus(ctx, tablet)
+		if err != nil {
+			return fmt.Errorf("cannot get the replication status of %v: %v", alias, err)
+		}
+		current, err := mysql.DecodePosition(status.Position)
+		if err != nil {
+			return fmt.Errorf("cannot decode the position %v of %v: %v", status.Position, alias, err)
+		}
+		if current.AtLeast(pos) {
+			return nil
+		}
+		if !status.SlaveSqlRunning {
+			return fmt.Errorf("replication is stopped on %v at %v, before the end of its relay logs at %v", alias, status.Position, mysql.EncodePosition(pos))
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %v to apply its relay logs up to %v, it is at %v", alias, mysql.EncodePosition(pos), status.Position)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// report logs the status of a failover, and dispatches it as an
+// audit event.
+func (d *Detector) report(ev *events.MasterFailover, status string) {
+	d.mu.Lock()
+	delete(d.lastStatus, ev.KeyspaceName+"/"+ev.ShardName)
+	d.mu.Unlock()
+	d.dispatch(ev, status)
+}
+
+// reportOnce is report for the decisions not to fail over, that are
+// made again at every check. It only reports a status once in a row.
+func (d *Detector) reportOnce(ev *events.MasterFailover, status string) {
+	key := ev.KeyspaceName + "/" + ev.ShardName
+	d.mu.Lock()
+	same := d.lastStatus[key] == status
+	d.lastStatus[key] = status
+	d.mu.Unlock()
+	if !same {
+		d.dispatch(ev, status)
+	}
+}
+
+// dispatch logs the status, and dispatches the event.
+func (d *Detector) dispatch(ev *events.MasterFailover, status string) {
+	log.Warningf("Failover of master %v of %v/%v (dry run: %v): %v", topoproto.TabletAliasString(ev.OldMaster), ev.KeyspaceName, ev.ShardName, ev.DryRun, status)
+	ev.Status = status
+	event.Dispatch(ev)
+}
+
+// shardKey returns the keyspace/shard of a master.
+func shardKey(tablet *topodatapb.Tablet) string {
+	return tablet.Keyspace + "/" + tablet.Shard
+}
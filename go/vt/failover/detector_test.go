@@ -0,0 +1,382 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package failover
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/event"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/events"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+	"vitess.io/vitess/go/vt/wrangler"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	replicationdatapb "vitess.io/vitess/go/vt/proto/replicationdata"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+const testServerUUID = "00010203-0405-0607-0809-0a0b0c0d0e0f"
+
+// fakeTMC answers the replication RPCs of the tablets in statuses.
+// The others are unreachable.
+type fakeTMC struct {
+	tmclient.TabletManagerClient
+
+	mu       sync.Mutex
+	statuses map[string]*replicationdatapb.Status
+	promoted string
+}
+
+func (f *fakeTMC) SlaveStatus(ctx context.Context, tablet *topodatapb.Tablet) (*replicationdatapb.Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, ok := f.statuses[topoproto.TabletAliasString(tablet.Alias)]
+	if !ok {
+		return nil, fmt.Errorf("tablet %v is unreachable", topoproto.TabletAliasString(tablet.Alias))
+	}
+	result := *status
+	// The SQL thread applies the relay logs.
+	if status.SlaveSqlRunning {
+		status.Position = status.RelayLogPosition
+	}
+	return &result, nil
+}
+
+func (f *fakeTMC) StopReplicationAndGetStatus(ctx context.Context, tablet *topodatapb.Tablet) (*replicationdatapb.Status, error) {
+	status, err := f.SlaveStatus(ctx, tablet)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[topoproto.TabletAliasString(tablet.Alias)].SlaveSqlRunning = false
+	return status, nil
+}
+
+func (f *fakeTMC) PromoteSlave(ctx context.Context, tablet *topodatapb.Tablet) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.promoted = topoproto.TabletAliasString(tablet.Alias)
+	return f.statuses[f.promoted].Position, nil
+}
+
+func (f *fakeTMC) PopulateReparentJournal(ctx context.Context, tablet *topodatapb.Tablet, timeCreatedNS int64, actionName string, masterAlias *topodatapb.TabletAlias, pos string) error {
+	return nil
+}
+
+func (f *fakeTMC) SetMaster(ctx context.Context, tablet *topodatapb.Tablet, parent *topodatapb.TabletAlias, timeCreatedNS int64, forceStartSlave bool) error {
+	return nil
+}
+
+// eventsMu protects failoverEvents.
+var (
+	eventsMu       sync.Mutex
+	failoverEvents []events.MasterFailover
+)
+
+func init() {
+	event.AddListener(func(ev *events.MasterFailover) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		failoverEvents = append(failoverEvents, *ev)
+	})
+}
+
+// lastEvents returns the events since the previous call.
+func lastEvents() []events.MasterFailover {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	result := failoverEvents
+	failoverEvents = nil
+	return result
+}
+
+// replicaStatus returns the status of a replica that lost its
+// connection to the master, with relay logs up to relay.
+func replicaStatus(executed, relay string) *replicationdatapb.Status {
+	return &replicationdatapb.Status{
+		Position:         "MySQL56/" + testServerUUID + ":" + executed,
+		RelayLogPosition:  "MySQL56/" + testServerUUID + ":" + relay,
+		SlaveSqlRunning:   true,
+		SlaveIoConnecting: true,
+	}
+}
+
+// setupShard creates a shard with a master in cell1, a replica in
+// cell1 and cell2, and a rdonly in cell2.
+func setupShard(t *testing.T) (*topo.Server, *fakeTMC, *topodatapb.Tablet) {
+	ctx := context.Background()
+	ts := memorytopo.NewServer("cell1", "cell2")
+	if err := ts.CreateKeyspace(ctx, "ks", &topodatapb.Keyspace{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateShard(ctx, "ks", "0"); err != nil {
+		t.Fatal(err)
+	}
+	var master *topodatapb.Tablet
+	for _, tt := range []struct {
+		cell       string
+		uid        uint32
+		tabletType topodatapb.TabletType
+	}{
+		{"cell1", 1, topodatapb.TabletType_MASTER},
+		{"cell1", 2, topodatapb.TabletType_REPLICA},
+		{"cell2", 3, topodatapb.TabletType_REPLICA},
+		{"cell2", 4, topodatapb.TabletType_RDONLY},
+	} {
+		tablet := &topodatapb.Tablet{
+			Alias:    &topodatapb.TabletAlias{Cell: tt.cell, Uid: tt.uid},
+			Hostname: fmt.Sprintf("host%v", tt.uid),
+			Keyspace: "ks",
+			Shard:    "0",
+			Type:     tt.tabletType,
+		}
+		if err := ts.CreateTablet(ctx, tablet); err != nil {
+			t.Fatal(err)
+		}
+		if tt.tabletType == topodatapb.TabletType_MASTER {
+			master = tablet
+		}
+	}
+	if _, err := ts.UpdateShardFields(ctx, "ks", "0", func(si *topo.ShardInfo) error {
+		si.MasterAlias = master.Alias
+		si.Cells = []string{"cell1", "cell2"}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tmc := &fakeTMC{
+		statuses: map[string]*replicationdatapb.Status{
+			"cell1-0000000002": replicaStatus("1-10", "1-12"),
+			"cell2-0000000003": replicaStatus("1-12", "1-12"),
+			"cell2-0000000004": replicaStatus("1-11", "1-11"),
+		},
+	}
+	return ts, tmc, master
+}
+
+// masterDown reports the master as unreachable to the detector.
+func masterDown(d *Detector, master *topodatapb.Tablet) {
+	d.StatsUpdate(&discovery.TabletStats{
+		Tablet:    master,
+		Target:    &querypb.Target{Keyspace: "ks", Shard: "0", TabletType: topodatapb.TabletType_MASTER},
+		Up:        true,
+		LastError: fmt.Errorf("healthcheck timed out"),
+	})
+}
+
+func TestDetector(t *testing.T) {
+	ctx := context.Background()
+	ts, tmc, master := setupShard(t)
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmc)
+	config := Config{
+		MasterDownTimeout:  time.Hour,
+		MinConfirmingCells: 2,
+		WaitSlaveTimeout:   10 * time.Second,
+		Cooldown:           time.Hour,
+	}
+	d := NewDetector(wr, config)
+
+	// A healthy master is left alone, and so is a master that
+	// was not down for MasterDownTimeout.
+	d.StatsUpdate(&discovery.TabletStats{
+		Tablet: master,
+		Target: &querypb.Target{Keyspace: "ks", Shard: "0", TabletType: topodatapb.TabletType_MASTER},
+		Up:     true,
+	})
+	d.check(ctx)
+	masterDown(d, master)
+	d.check(ctx)
+	if evs := lastEvents(); len(evs) != 0 {
+		t.Fatalf("events: %v, want none", evs)
+	}
+
+	// A replica still connected to the master vetoes the failover,
+	// and the decision is only reported once.
+	d.config.MasterDownTimeout = 0
+	tmc.statuses["cell2-0000000003"].SlaveIoRunning = true
+	d.check(ctx)
+	d.check(ctx)
+	evs := lastEvents()
+	if len(evs) != 1 || evs[0].Status != "not failing over: replica cell2-0000000003 is still connected to the master" {
+		t.Fatalf("events: %v, want one not failing over", evs)
+	}
+	tmc.statuses["cell2-0000000003"].SlaveIoRunning = false
+
+	// Not enough cells confirm the master is dead.
+	d.config.MinConfirmingCells = 3
+	d.check(ctx)
+	evs = lastEvents()
+	if len(evs) != 1 || evs[0].Status != "not failing over: the replicas of 2 cells lost their connection to the master, want 3" {
+		t.Fatalf("events: %v, want one not failing over", evs)
+	}
+	d.config.MinConfirmingCells = 2
+
+	// A dry run picks the most advanced replica. Both replicas
+	// received the same transactions, so the one in the cell of
+	// the master is preferred.
+	d.config.DryRun = true
+	d.check(ctx)
+	evs = lastEvents()
+	if len(evs) != 1 || evs[0].Status != "would promote cell1-0000000002" || !evs[0].DryRun {
+		t.Fatalf("events: %v, want one would promote cell1-0000000002", evs)
+	}
+	// The shard is then in cooldown.
+	d.check(ctx)
+	if evs := lastEvents(); len(evs) != 0 {
+		t.Fatalf("events: %v, want none during the cooldown", evs)
+	}
+	if tmc.promoted != "" {
+		t.Fatalf("a dry run promoted %v", tmc.promoted)
+	}
+
+	// The preferred cells come first.
+	d.config.DryRun = false
+	d.config.PreferredCells = []string{"cell2", "cell1"}
+	d.lastFailover = make(map[string]time.Time)
+	d.check(ctx)
+	evs = lastEvents()
+	if len(evs) != 2 || evs[0].Status != "promoting cell2-0000000003" || evs[1].Status != "finished" || evs[1].DryRun {
+		t.Fatalf("events: %v, want promoting cell2-0000000003 then finished", evs)
+	}
+	if tmc.promoted != "cell2-0000000003" {
+		t.Errorf("promoted tablet: %v, want cell2-0000000003", tmc.promoted)
+	}
+	si, err := ts.GetShard(ctx, "ks", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if topoproto.TabletAliasString(si.MasterAlias) != "cell2-0000000003" {
+		t.Errorf("shard master: %v, want cell2-0000000003", topoproto.TabletAliasString(si.MasterAlias))
+	}
+
+	// Once the master is reparented, the old one is forgotten.
+	d.StatsUpdate(&discovery.TabletStats{
+		Tablet: master,
+		Up:     false,
+	})
+	if len(d.masters) != 0 {
+		t.Errorf("masters: %v, want none", d.masters)
+	}
+}
+
+func TestDetectorNoConfirmation(t *testing.T) {
+	ctx := context.Background()
+	ts, tmc, master := setupShard(t)
+	d := NewDetector(wrangler.New(logutil.NewConsoleLogger(), ts, tmc), Config{
+		MinConfirmingCells: 0,
+		WaitSlaveTimeout:   10 * time.Second,
+		Cooldown:           time.Hour,
+	})
+
+	// Without any replica to confirm it, the master
+	// is not failed over, whatever MinConfirmingCells is.
+	tmc.statuses = map[string]*replicationdatapb.Status{}
+	masterDown(d, master)
+	d.check(ctx)
+	evs := lastEvents()
+	if len(evs) != 1 || evs[0].Status != "not failing over: no replica confirmed that it lost its connection to the master" {
+		t.Fatalf("events: %v, want one not failing over", evs)
+	}
+	if tmc.promoted != "" {
+		t.Errorf("promoted tablet: %v, want none", tmc.promoted)
+	}
+
+	// Nor do replicas whose replication was stopped.
+	tmc.statuses["cell1-0000000002"] = replicaStatus("1-10", "1-12")
+	tmc.statuses["cell1-0000000002"].SlaveSqlRunning = false
+	tmc.statuses["cell2-0000000003"] = replicaStatus("1-10", "1-12")
+	tmc.statuses["cell2-0000000003"].SlaveIoConnecting = false
+	d.lastStatus = make(map[string]string)
+	d.check(ctx)
+	evs = lastEvents()
+	if len(evs) != 1 || evs[0].Status != "not failing over: no replica confirmed that it lost its connection to the master" {
+		t.Fatalf("events: %v, want one not failing over", evs)
+	}
+	if tmc.promoted != "" {
+		t.Errorf("promoted tablet: %v, want none", tmc.promoted)
+	}
+	delete(tmc.statuses, "cell2-0000000003")
+
+	// A single replica is enough.
+	tmc.statuses["cell1-0000000002"] = replicaStatus("1-10", "1-12")
+	d.check(ctx)
+	evs = lastEvents()
+	if len(evs) != 2 || evs[0].Status != "promoting cell1-0000000002" || evs[1].Status != "finished" {
+		t.Fatalf("events: %v, want promoting cell1-0000000002 then finished", evs)
+	}
+}
+
+func TestChooseNewMaster(t *testing.T) {
+	ctx := context.Background()
+	ts, tmc, master := setupShard(t)
+	d := NewDetector(wrangler.New(logutil.NewConsoleLogger(), ts, tmc), Config{
+		WaitSlaveTimeout: 10 * time.Second,
+	})
+	tabletMap, err := ts.GetTabletMapForShard(ctx, "ks", "0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The replica with the most advanced relay logs wins,
+	// even if it applied fewer transactions.
+	tmc.statuses["cell1-0000000002"] = replicaStatus("1-5", "1-13")
+	statuses := d.replicationStatuses(ctx, tabletMap, master.Alias)
+	newMaster, pos, err := d.chooseNewMaster(master, tabletMap, statuses)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := topoproto.TabletAliasString(newMaster.Alias); got != "cell1-0000000002" {
+		t.Errorf("new master: %v, want cell1-0000000002", got)
+	}
+	if err := d.waitForRelayLogs(ctx, newMaster, pos); err != nil {
+		t.Errorf("waitForRelayLogs failed: %v", err)
+	}
+
+	// A replica cannot be promoted in a cell that is not preferred.
+	d.config.PreferredCells = []string{"cell2"}
+	if _, _, err := d.chooseNewMaster(master, tabletMap, statuses); err == nil || !strings.Contains(err.Error(), "no eligible replica received all the transactions") {
+		t.Errorf("chooseNewMaster: %v, want no eligible replica", err)
+	}
+
+	// Nor a rdonly, so it must not be ahead of all the replicas.
+	d.config.PreferredCells = nil
+	tmc.statuses["cell2-0000000004"] = replicaStatus("1-14", "1-14")
+	statuses = d.replicationStatuses(ctx, tabletMap, master.Alias)
+	if _, _, err := d.chooseNewMaster(master, tabletMap, statuses); err == nil || !strings.Contains(err.Error(), "no eligible replica received all the transactions") {
+		t.Errorf("chooseNewMaster: %v, want no eligible replica", err)
+	}
+
+	// A replica whose replication is stopped cannot catch up.
+	tmc.statuses["cell1-0000000002"] = replicaStatus("1-5", "1-13")
+	tmc.statuses["cell1-0000000002"].SlaveSqlRunning = false
+	if err := d.waitForRelayLogs(ctx, newMaster, pos); err == nil || !strings.Contains(err.Error(), "replication is stopped on cell1-0000000002") {
+		t.Errorf("waitForRelayLogs: %v, want replication is stopped", err)
+	}
+}
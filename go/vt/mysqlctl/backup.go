@@ -18,6 +18,8 @@ package mysqlctl
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -51,6 +53,10 @@ const (
 	backupInnodbLogGroupHomeDir = "InnoDBLog"
 	backupData                  = "Data"
 
+	// the bases for archived binlogs, and for binlogs to replay
+	backupBinlogDir = "BinLog"
+	backupTmpDir    = "Tmp"
+
 	// the manifest file name
 	backupManifest = "MANIFEST"
 )
@@ -86,6 +92,8 @@ type FileEntry struct {
 	// - backupInnodbDataHomeDir for files that go into Mycnf.InnodbDataHomeDir
 	// - backupInnodbLogGroupHomeDir for files that go into Mycnf.InnodbLogGroupHomeDir
 	// - backupData for files that go into Mycnf.DataDir
+	// - backupBinlogDir for binlogs read from the Mycnf.BinLogPath directory
+	// - backupTmpDir for binlogs restored into Mycnf.TmpDir
 	Base string
 
 	// Name is the file name, relative to Base
@@ -94,6 +102,10 @@ type FileEntry struct {
 	// Hash is the hash of the final data (transformed and
 	// compressed if specified) stored in the BackupStorage.
 	Hash string
+
+	// Checksum is the hex-encoded SHA-256 of the original data of
+	// the file. Older backups do not have it.
+	Checksum string
 }
 
 func (fe *FileEntry) open(cnf *Mycnf, readOnly bool) (*os.File, error) {
@@ -106,6 +118,10 @@ func (fe *FileEntry) open(cnf *Mycnf, readOnly bool) (*os.File, error) {
 		root = cnf.InnodbLogGroupHomeDir
 	case backupData:
 		root = cnf.DataDir
+	case backupBinlogDir:
+		root = path.Dir(cnf.BinLogPath)
+	case backupTmpDir:
+		root = cnf.TmpDir
 	default:
 		return nil, fmt.Errorf("unknown base: %v", fe.Base)
 	}
@@ -147,6 +163,22 @@ type BackupManifest struct {
 	// backups that don't have this flag are assumed to be
 	// compressed.
 	SkipCompress bool
+
+	// BackupMethod is the name of the BackupEngine that took a
+	// full backup. Backups without it were taken by the builtin
+	// engine.
+	BackupMethod string
+
+	// Incremental is set if the backup only contains the binlogs
+	// since BaseBackup. Its FileEntries are then binlog files.
+	Incremental bool
+
+	// BaseBackup is the name of the backup an incremental backup
+	// is based on. It can be an incremental backup too.
+	BaseBackup string
+
+	// FromPosition is the Position of BaseBackup.
+	FromPosition mysql.Position
 }
 
 // isDbDir returns true if the given directory contains a DB
@@ -220,22 +252,47 @@ func findFilesToBackup(cnf *Mycnf) ([]FileEntry, error) {
 
 // Backup is the main entry point for a backup:
 // - uses the BackupStorage service to store a new backup
-// - shuts down Mysqld during the backup
-// - remember if we were replicating, restore the exact same state
-func Backup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, dir, name string, backupConcurrency int, hookExtraEnv map[string]string) error {
+// - takes the backup with the BackupEngine of the tablet
+// An incremental backup only stores the binlogs since the latest
+// backup in dir, and does not shut down Mysqld.
+func Backup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, dir, name string, backupConcurrency int, hookExtraEnv map[string]string, incremental bool) error {
 	// Start the backup with the BackupStorage.
 	bs, err := backupstorage.GetBackupStorage()
 	if err != nil {
 		return err
 	}
 	defer bs.Close()
+
+	// Find the backup to base an incremental backup on before
+	// starting the new one.
+	var be BackupEngine
+	var baseName string
+	var base *BackupManifest
+	if incremental {
+		baseName, base, err = findLatestBackup(ctx, logger, bs, dir)
+		if err != nil {
+			return err
+		}
+		logger.Infof("taking an incremental backup based on %v", baseName)
+	} else {
+		be, err = GetBackupEngine()
+		if err != nil {
+			return err
+		}
+	}
+
 	bh, err := bs.StartBackup(ctx, dir, name)
 	if err != nil {
 		return fmt.Errorf("StartBackup failed: %v", err)
 	}
 
 	// Take the backup, and either AbortBackup or EndBackup.
-	usable, err := backup(ctx, mysqld, logger, bh, backupConcurrency, hookExtraEnv)
+	var usable bool
+	if incremental {
+		usable, err = backupIncremental(ctx, mysqld, logger, bh, baseName, base, backupConcurrency, hookExtraEnv)
+	} else {
+		usable, err = be.ExecuteBackup(ctx, mysqld, logger, bh, backupConcurrency, hookExtraEnv)
+	}
 	var finishErr error
 	if usable {
 		finishErr = bh.EndBackup(ctx)
@@ -257,7 +314,10 @@ func Backup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, dir,
 	return finishErr
 }
 
-// backup returns a boolean that indicates if the backup is usable,
+// backup takes a builtin backup:
+// - shuts down Mysqld during the backup
+// - remember if we were replicating, restore the exact same state
+// It returns a boolean that indicates if the backup is usable,
 // and an overall error.
 func backup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (bool, error) {
 	// Save initial state so we can restore.
@@ -365,7 +425,7 @@ func backup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh b
 }
 
 // backupFiles finds the list of files to backup, and creates the backup.
-func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, replicationPosition mysql.Position, backupConcurrency int, hookExtraEnv map[string]string) (err error) {
+func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, replicationPosition mysql.Position, backupConcurrency int, hookExtraEnv map[string]string) error {
 	// Get the files to backup.
 	fes, err := findFilesToBackup(mysqld.Cnf())
 	if err != nil {
@@ -373,7 +433,22 @@ func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 	}
 	logger.Infof("found %v files to backup", len(fes))
 
-	// Backup with the provided concurrency.
+	if err := backupFileEntries(ctx, mysqld, logger, bh, fes, backupConcurrency, hookExtraEnv); err != nil {
+		return err
+	}
+
+	return writeBackupManifest(ctx, bh, &BackupManifest{
+		FileEntries:   fes,
+		Position:      replicationPosition,
+		TransformHook: *backupStorageHook,
+		SkipCompress:  !*backupStorageCompress,
+		BackupMethod:  builtinBackupEngineName,
+	})
+}
+
+// backupFileEntries backs up the files with the provided concurrency.
+// The hashes of the files are saved in fes.
+func backupFileEntries(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, fes []FileEntry, backupConcurrency int, hookExtraEnv map[string]string) error {
 	sema := sync2.NewSemaphore(backupConcurrency, 0)
 	rec := concurrency.AllErrorRecorder{}
 	wg := sync.WaitGroup{}
@@ -397,10 +472,11 @@ func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 	}
 
 	wg.Wait()
-	if rec.HasErrors() {
-		return rec.Error()
-	}
+	return rec.Error()
+}
 
+// writeBackupManifest writes the MANIFEST of a backup.
+func writeBackupManifest(ctx context.Context, bh backupstorage.BackupHandle, bm *BackupManifest) (err error) {
 	// open the MANIFEST
 	wc, err := bh.AddFile(ctx, backupManifest)
 	if err != nil {
@@ -413,12 +489,6 @@ func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 	}()
 
 	// JSON-encode and write the MANIFEST
-	bm := &BackupManifest{
-		FileEntries:   fes,
-		Position:      replicationPosition,
-		TransformHook: *backupStorageHook,
-		SkipCompress:  !*backupStorageCompress,
-	}
 	data, err := json.MarshalIndent(bm, "", "  ")
 	if err != nil {
 		return fmt.Errorf("cannot JSON encode %v: %v", backupManifest, err)
@@ -430,16 +500,36 @@ func backupFiles(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 	return nil
 }
 
+// readBackupManifest reads the MANIFEST of a backup.
+func readBackupManifest(ctx context.Context, bh backupstorage.BackupHandle) (*BackupManifest, error) {
+	rc, err := bh.ReadFile(ctx, backupManifest)
+	if err != nil {
+		return nil, fmt.Errorf("can't read MANIFEST: %v", err)
+	}
+	defer rc.Close()
+
+	bm := &BackupManifest{}
+	if err := json.NewDecoder(rc).Decode(bm); err != nil {
+		return nil, fmt.Errorf("cannot JSON decode MANIFEST: %v", err)
+	}
+	return bm, nil
+}
+
 // backupFile backs up an individual file.
-func backupFile(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, fe *FileEntry, name string, hookExtraEnv map[string]string) (err error) {
+func backupFile(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, fe *FileEntry, name string, hookExtraEnv map[string]string) error {
 	// Open the source file for reading.
-	var source *os.File
-	source, err = fe.open(mysqld.Cnf(), true)
+	source, err := fe.open(mysqld.Cnf(), true)
 	if err != nil {
 		return err
 	}
 	defer source.Close()
 
+	return backupStream(ctx, logger, bh, fe, name, source, hookExtraEnv)
+}
+
+// backupStream copies source into the file with the given name in
+// the backup, and saves the hash of the stored data in fe.
+func backupStream(ctx context.Context, logger logutil.Logger, bh backupstorage.BackupHandle, fe *FileEntry, name string, source io.Reader, hookExtraEnv map[string]string) (err error) {
 	// Open the destination file for writing, and a buffer.
 	wc, err := bh.AddFile(ctx, name)
 	if err != nil {
@@ -485,8 +575,10 @@ func backupFile(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 	}
 
 	// Copy from the source file to writer (optional gzip,
-	// optional pipe, tee, output file and hasher).
-	_, err = io.Copy(writer, source)
+	// optional pipe, tee, output file and hasher), and to
+	// the checksum.
+	checksum := sha256.New()
+	_, err = io.Copy(writer, io.TeeReader(source, checksum))
 	if err != nil {
 		return fmt.Errorf("cannot copy data: %v", err)
 	}
@@ -517,8 +609,9 @@ func backupFile(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger,
 		return fmt.Errorf("cannot flush dst: %v", err)
 	}
 
-	// Save the hash.
+	// Save the hash and checksum.
 	fe.Hash = hasher.HashString()
+	fe.Checksum = hex.EncodeToString(checksum.Sum(nil))
 	return nil
 }
 
@@ -585,14 +678,6 @@ func restoreFiles(ctx context.Context, cnf *Mycnf, bh backupstorage.BackupHandle
 
 // restoreFile restores an individual file.
 func restoreFile(ctx context.Context, cnf *Mycnf, bh backupstorage.BackupHandle, fe *FileEntry, transformHook string, compress bool, name string, hookExtraEnv map[string]string) (err error) {
-	// Open the source file for reading.
-	var source io.ReadCloser
-	source, err = bh.ReadFile(ctx, name)
-	if err != nil {
-		return err
-	}
-	defer source.Close()
-
 	// Open the destination file for writing.
 	dstFile, err := fe.open(cnf, false)
 	if err != nil {
@@ -609,6 +694,19 @@ func restoreFile(ctx context.Context, cnf *Mycnf, bh backupstorage.BackupHandle,
 		}
 	}()
 
+	return restoreStream(ctx, bh, fe, name, dstFile, transformHook, compress, hookExtraEnv)
+}
+
+// restoreStream copies the file with the given name in the backup
+// into dstFile, and checks its hash against the one saved in fe.
+func restoreStream(ctx context.Context, bh backupstorage.BackupHandle, fe *FileEntry, name string, dstFile io.Writer, transformHook string, compress bool, hookExtraEnv map[string]string) (err error) {
+	// Open the source file for reading.
+	source, err := bh.ReadFile(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
 	// Create a buffering output.
 	dst := bufio.NewWriterSize(dstFile, 2*1024*1024)
 
@@ -649,8 +747,10 @@ func restoreFile(ctx context.Context, cnf *Mycnf, bh backupstorage.BackupHandle,
 		reader = gz
 	}
 
-	// Copy the data. Will also write to the hasher.
-	if _, err = io.Copy(dst, reader); err != nil {
+	// Copy the data. Will also write to the hasher,
+	// and to the checksum.
+	checksum := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(dst, checksum), reader); err != nil {
 		return err
 	}
 
@@ -671,10 +771,75 @@ func restoreFile(ctx context.Context, cnf *Mycnf, bh backupstorage.BackupHandle,
 		return fmt.Errorf("hash mismatch for %v, got %v expected %v", fe.Name, hash, fe.Hash)
 	}
 
+	// Check the checksum, if the backup has one.
+	if fe.Checksum != "" {
+		if sum := hex.EncodeToString(checksum.Sum(nil)); sum != fe.Checksum {
+			return fmt.Errorf("checksum mismatch for %v, got %v expected %v", fe.Name, sum, fe.Checksum)
+		}
+	}
+
 	// Flush the buffer.
 	return dst.Flush()
 }
 
+// VerifyBackup reads all the files of the backup with the given name
+// in dir, and checks them against the hashes and checksums in its
+// MANIFEST, without restoring them. For an incremental backup, it also
+// checks the backups it is based on can be read.
+func VerifyBackup(ctx context.Context, logger logutil.Logger, bs backupstorage.BackupStorage, dir, name string, verifyConcurrency int) error {
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		return fmt.Errorf("ListBackups failed: %v", err)
+	}
+	index := -1
+	for i, bh := range bhs {
+		if bh.Name() == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("no backup %v in directory %v", name, dir)
+	}
+	bh := bhs[index]
+	bm, err := readBackupManifest(ctx, bh)
+	if err != nil {
+		return fmt.Errorf("backup %v: %v", name, err)
+	}
+
+	if bm.Incremental {
+		manifests := make(map[int]*BackupManifest)
+		chain, err := backupChain(bhs, index, func(i int) *BackupManifest {
+			if i == index {
+				return bm
+			}
+			if manifests[i] == nil {
+				manifests[i], _ = readBackupManifest(ctx, bhs[i])
+			}
+			return manifests[i]
+		})
+		if err != nil {
+			return err
+		}
+		logger.Infof("backup %v is based on full backup %v, with %v incremental backups", name, bhs[chain[0]].Name(), len(chain)-1)
+	}
+
+	logger.Infof("verifying the %v files of backup %v", len(bm.FileEntries), name)
+	sema := sync2.NewSemaphore(verifyConcurrency, 0)
+	rec := concurrency.AllErrorRecorder{}
+	wg := sync.WaitGroup{}
+	for i := range bm.FileEntries {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sema.Acquire()
+			defer sema.Release()
+			rec.RecordError(restoreStream(ctx, bh, &bm.FileEntries[i], fmt.Sprintf("%v", i), ioutil.Discard, bm.TransformHook, !bm.SkipCompress, nil))
+		}(i)
+	}
+	wg.Wait()
+	return rec.Error()
+}
+
 // removeExistingFiles will delete existing files in the data dir to prevent
 // conflicts with the restored archive. In particular, binlogs can be created
 // even during initial bootstrap, and these can interfere with configuring
@@ -727,6 +892,8 @@ func removeExistingFiles(cnf *Mycnf) error {
 // Restore is the main entry point for backup restore.  If there is no
 // appropriate backup on the BackupStorage, Restore logs an error
 // and returns ErrNoBackup. Any other error is returned.
+// If restorePoint is set, Restore uses the most recent backup taken
+// before it, and replays the archived binlogs up to it.
 func Restore(
 	ctx context.Context,
 	mysqld MysqlDaemon,
@@ -736,7 +903,8 @@ func Restore(
 	localMetadata map[string]string,
 	logger logutil.Logger,
 	deleteBeforeRestore bool,
-	dbName string) (mysql.Position, error) {
+	dbName string,
+	restorePoint RestorePoint) (mysql.Position, error) {
 
 	// Wait for mysqld to be ready, in case it was launched in parallel with us.
 	if err := mysqld.Wait(ctx); err != nil {
@@ -756,6 +924,9 @@ func Restore(
 		return mysql.Position{}, fmt.Errorf("ListBackups failed: %v", err)
 	}
 
+	if len(bhs) == 0 && !restorePoint.IsZero() {
+		return mysql.Position{}, fmt.Errorf("no backup to restore to %v on BackupStorage for directory %v", restorePoint, dir)
+	}
 	if len(bhs) == 0 {
 		// There are no backups (not even broken/incomplete ones).
 		logger.Errorf("No backup to restore on BackupStorage for directory %v. Starting up empty.", dir)
@@ -765,27 +936,53 @@ func Restore(
 		return mysql.Position{}, err
 	}
 
-	var bh backupstorage.BackupHandle
-	var bm BackupManifest
+	// The MANIFESTs are read lazily, newest first: an incremental
+	// backup also needs the MANIFESTs of the backups it is based on.
+	manifests := make([]*BackupManifest, len(bhs))
+	manifest := func(i int) *BackupManifest {
+		if manifests[i] == nil {
+			bm, err := readBackupManifest(ctx, bhs[i])
+			if err != nil {
+				log.Warningf("Possibly incomplete backup %v in directory %v on BackupStorage: %v", bhs[i].Name(), dir, err)
+				return nil
+			}
+			manifests[i] = bm
+		}
+		return manifests[i]
+	}
+
+	var chain []int
 	var toRestore int
 	for toRestore = len(bhs) - 1; toRestore >= 0; toRestore-- {
-		bh = bhs[toRestore]
-		rc, err := bh.ReadFile(ctx, backupManifest)
-		if err != nil {
-			log.Warningf("Possibly incomplete backup %v in directory %v on BackupStorage: can't read MANIFEST: %v)", bh.Name(), dir, err)
+		bh := bhs[toRestore]
+		bm := manifest(toRestore)
+		if bm == nil {
 			continue
 		}
 
-		err = json.NewDecoder(rc).Decode(&bm)
-		rc.Close()
+		if !restorePoint.IsZero() {
+			ok, err := isBackupBefore(bh.Name(), bm, restorePoint)
+			if err != nil {
+				log.Warningf("Skipping backup %v in directory %v on BackupStorage: %v", bh.Name(), dir, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		chain, err = backupChain(bhs, toRestore, manifest)
 		if err != nil {
-			log.Warningf("Possibly incomplete backup %v in directory %v on BackupStorage (cannot JSON decode MANIFEST: %v)", bh.Name(), dir, err)
+			log.Warningf("Skipping backup %v in directory %v on BackupStorage: %v", bh.Name(), dir, err)
 			continue
 		}
 
 		logger.Infof("Restore: found backup %v %v to restore with %v files", bh.Directory(), bh.Name(), len(bm.FileEntries))
 		break
 	}
+	if toRestore < 0 && !restorePoint.IsZero() {
+		return mysql.Position{}, fmt.Errorf("no backup before %v on BackupStorage for directory %v", restorePoint, dir)
+	}
 	if toRestore < 0 {
 		// There is at least one attempted backup, but none could be read.
 		// This implies there is data we ought to have, so it's not safe to start
@@ -793,6 +990,13 @@ func Restore(
 		return mysql.Position{}, errors.New("backup(s) found but none could be read, unsafe to start up empty, restart to retry restore")
 	}
 
+	bh := bhs[chain[0]]
+	bm := manifest(chain[0])
+	be, err := getBackupEngine(bm.BackupMethod)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("can't restore backup %v: %v", bh.Name(), err)
+	}
+
 	if !deleteBeforeRestore {
 		logger.Infof("Restore: checking no existing data is present")
 		ok, err := checkNoDB(ctx, mysqld, dbName)
@@ -828,8 +1032,10 @@ func Restore(
 		return mysql.Position{}, err
 	}
 
-	logger.Infof("Restore: copying all files")
-	if err := restoreFiles(context.Background(), mysqld.Cnf(), bh, bm.FileEntries, bm.TransformHook, !bm.SkipCompress, restoreConcurrency, hookExtraEnv); err != nil {
+	if len(chain) > 1 {
+		logger.Infof("Restore: restoring full backup %v, and %v incremental backups on top of it", bh.Name(), len(chain)-1)
+	}
+	if err := be.ExecuteRestore(context.Background(), mysqld, logger, bh, bm, restoreConcurrency, hookExtraEnv); err != nil {
 		return mysql.Position{}, err
 	}
 
@@ -872,5 +1078,28 @@ func Restore(
 		return mysql.Position{}, err
 	}
 
-	return bm.Position, nil
+	pos := bm.Position
+	if len(chain) == 1 && restorePoint.IsZero() {
+		return pos, nil
+	}
+
+	// mysqld skips the transactions it has already executed when
+	// applying binlogs, so it needs to know the backup position.
+	if err := mysqld.SetSlavePosition(context.Background(), pos); err != nil {
+		return mysql.Position{}, fmt.Errorf("failed to set position %v: %v", pos, err)
+	}
+	for _, i := range chain[1:] {
+		logger.Infof("Restore: applying incremental backup %v", bhs[i].Name())
+		if err := applyIncrementalBackup(context.Background(), mysqld, bhs[i], manifest(i), pos, hookExtraEnv); err != nil {
+			return mysql.Position{}, err
+		}
+		pos = manifest(i).Position
+	}
+
+	if !restorePoint.IsZero() {
+		logger.Infof("Restore: replaying archived binlogs from %v to %v", pos, restorePoint)
+		return replayBinlogs(context.Background(), mysqld, logger, bs, dir, pos, restorePoint, hookExtraEnv)
+	}
+
+	return pos, nil
 }
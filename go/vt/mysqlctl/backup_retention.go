@@ -0,0 +1,161 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// This file prunes the old backups of a shard. The incremental
+// backups and the backups they are based on form chains, that are
+// kept or removed as a whole: a chain is kept if any of its backups
+// is kept.
+
+// RetentionPolicy describes the backups of a shard to keep. A backup
+// is kept if any of the rules keeps it. The most recent backup that
+// can be restored is always kept.
+type RetentionPolicy struct {
+	// KeepLast keeps the KeepLast most recent backups.
+	KeepLast int
+
+	// KeepDaily keeps the most recent backup of each of the
+	// KeepDaily most recent days that have a backup, in UTC.
+	KeepDaily int
+
+	// KeepWeekly keeps the most recent backup of each of the
+	// KeepWeekly most recent ISO weeks that have a backup.
+	KeepWeekly int
+
+	// MinAge keeps the backups taken less than MinAge ago.
+	MinAge time.Duration
+}
+
+// BackupsToPrune returns the names of the backups in dir that the
+// policy does not keep, oldest first. Only the backups that can be
+// restored count for KeepLast, KeepDaily and KeepWeekly. The others,
+// incomplete backups or incremental backups whose chain is broken,
+// are only kept by MinAge, or if they are more recent than the last
+// backup that can be restored, as they may be in progress.
+func BackupsToPrune(ctx context.Context, logger logutil.Logger, bs backupstorage.BackupStorage, dir string, policy RetentionPolicy, now time.Time) ([]string, error) {
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+
+	// chain maps each backup to the first backup of its chain,
+	// and restorable lists the chains that can be restored.
+	chain := make(map[string]string)
+	restorable := make(map[string]bool)
+	times := make([]time.Time, len(bhs))
+	keep := make(map[string]bool)
+	for i, bh := range bhs {
+		name := bh.Name()
+		times[i], err = backupTime(name)
+		if err != nil {
+			logger.Warningf("Keeping backup %v, its name does not start with a timestamp: %v", name, err)
+			keep[name] = true
+		}
+		chain[name] = name
+		bm, err := readBackupManifest(ctx, bh)
+		if err != nil {
+			logger.Warningf("Possibly incomplete backup %v in directory %v on BackupStorage: %v", name, dir, err)
+			continue
+		}
+		if !bm.Incremental {
+			restorable[name] = true
+			continue
+		}
+		// A backup is always listed after the backup it is based on.
+		if first, ok := chain[bm.BaseBackup]; ok {
+			chain[name] = first
+			restorable[name] = restorable[bm.BaseBackup]
+		}
+	}
+
+	// Apply the rules to the backups, newest first.
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	restorePoints := 0
+	for i := len(bhs) - 1; i >= 0; i-- {
+		name := bhs[i].Name()
+		if times[i].IsZero() {
+			continue
+		}
+		if now.Sub(times[i]) < policy.MinAge {
+			keep[name] = true
+		}
+		if !restorable[name] {
+			if restorePoints == 0 {
+				keep[name] = true
+			}
+			continue
+		}
+
+		if restorePoints == 0 || restorePoints < policy.KeepLast {
+			keep[name] = true
+		}
+		restorePoints++
+		day := times[i].UTC().Format("2006-01-02")
+		if !days[day] && len(days) < policy.KeepDaily {
+			days[day] = true
+			keep[name] = true
+		}
+		year, week := times[i].UTC().ISOWeek()
+		weekKey := fmt.Sprintf("%v-%v", year, week)
+		if !weeks[weekKey] && len(weeks) < policy.KeepWeekly {
+			weeks[weekKey] = true
+			keep[name] = true
+		}
+	}
+
+	// Keep the whole chain of the backups that are kept.
+	keptChains := make(map[string]bool)
+	for name := range keep {
+		keptChains[chain[name]] = true
+	}
+	var result []string
+	for _, bh := range bhs {
+		if !keptChains[chain[bh.Name()]] {
+			result = append(result, bh.Name())
+		}
+	}
+	return result, nil
+}
+
+// PruneBackups removes the backups in dir that the policy does not
+// keep, and returns their names, oldest first. With dryRun, it only
+// returns them. The newest backups are removed first, so a failure
+// never leaves an incremental backup without its base backup.
+func PruneBackups(ctx context.Context, logger logutil.Logger, bs backupstorage.BackupStorage, dir string, policy RetentionPolicy, dryRun bool) ([]string, error) {
+	names, err := BackupsToPrune(ctx, logger, bs, dir, policy, time.Now())
+	if err != nil || dryRun {
+		return names, err
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		logger.Infof("Removing backup %v", names[i])
+		if err := bs.RemoveBackup(ctx, dir, names[i]); err != nil {
+			return nil, fmt.Errorf("cannot remove backup %v: %v", names[i], err)
+		}
+	}
+	return names, nil
+}
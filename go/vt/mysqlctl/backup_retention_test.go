@@ -0,0 +1,158 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/filebackupstorage"
+)
+
+func TestPruneBackups(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "pruneBackupsTest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	*filebackupstorage.FileBackupStorageRoot = root
+	bs := &filebackupstorage.FileBackupStorage{}
+	dir := "test_keyspace/0"
+
+	// addBackup adds a backup with the given MANIFEST. A nil
+	// MANIFEST leaves the backup incomplete.
+	addBackup := func(timestamp string, bm *BackupManifest) string {
+		name := timestamp + ".cell1-0000000001"
+		bh, err := bs.StartBackup(ctx, dir, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bm != nil {
+			wc, err := bh.AddFile(ctx, backupManifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.NewEncoder(wc).Encode(bm); err != nil {
+				t.Fatal(err)
+			}
+			if err := wc.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := bh.EndBackup(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+	full := func() *BackupManifest {
+		return &BackupManifest{}
+	}
+	incremental := func(base string) *BackupManifest {
+		return &BackupManifest{Incremental: true, BaseBackup: base}
+	}
+
+	// The days are Fridays, except 06-16 (Saturday),
+	// 06-17 (Sunday) and 06-19 (Tuesday).
+	a := addBackup("2018-06-01.030000", full())
+	b := addBackup("2018-06-01.150000", incremental(a))
+	c := addBackup("2018-06-08.030000", full())
+	incomplete := addBackup("2018-06-10.000000", nil)
+	broken := addBackup("2018-06-12.000000", incremental("2018-06-02.000000.cell1-0000000001"))
+	d := addBackup("2018-06-15.030000", full())
+	e := addBackup("2018-06-16.030000", incremental(d))
+	f := addBackup("2018-06-17.030000", incremental(e))
+	g := addBackup("2018-06-19.030000", full())
+	addBackup("2018-06-19.150000", incremental(g))
+	// A backup in progress is never removed.
+	addBackup("2018-06-20.110000", nil)
+	now := time.Date(2018, 6, 20, 12, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{{
+		name:   "keep last",
+		policy: RetentionPolicy{KeepLast: 1},
+		want:   []string{a, b, c, incomplete, broken, d, e, f},
+	}, {
+		name:   "keep last in a chain",
+		policy: RetentionPolicy{KeepLast: 4},
+		want:   []string{a, b, c, incomplete, broken},
+	}, {
+		name:   "keep daily",
+		policy: RetentionPolicy{KeepDaily: 3},
+		want:   []string{a, b, c, incomplete, broken},
+	}, {
+		name:   "keep weekly",
+		policy: RetentionPolicy{KeepWeekly: 3},
+		want:   []string{a, b, incomplete, broken},
+	}, {
+		name:   "min age",
+		policy: RetentionPolicy{MinAge: 10 * 24 * time.Hour},
+		want:   []string{a, b, c, incomplete},
+	}, {
+		name:   "keep last and weekly",
+		policy: RetentionPolicy{KeepLast: 1, KeepWeekly: 4},
+		want:   []string{incomplete, broken},
+	}, {
+		name:   "no rule keeps the last backup",
+		policy: RetentionPolicy{},
+		want:   []string{a, b, c, incomplete, broken, d, e, f},
+	}}
+	for _, tcase := range testcases {
+		got, err := BackupsToPrune(ctx, logutil.NewMemoryLogger(), bs, dir, tcase.policy, now)
+		if err != nil {
+			t.Errorf("%v: BackupsToPrune failed: %v", tcase.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tcase.want) {
+			t.Errorf("%v: BackupsToPrune: %v, want %v", tcase.name, got, tcase.want)
+		}
+	}
+
+	// A dry run does not remove anything.
+	policy := RetentionPolicy{KeepWeekly: 3}
+	want := []string{a, b, incomplete, broken}
+	got, err := PruneBackups(ctx, logutil.NewMemoryLogger(), bs, dir, policy, true /* dryRun */)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PruneBackups(dryRun): %v %v, want %v", got, err, want)
+	}
+	if bhs, err := bs.ListBackups(ctx, dir); err != nil || len(bhs) != 11 {
+		t.Errorf("ListBackups after a dry run: %v backups %v, want 11", len(bhs), err)
+	}
+
+	got, err = PruneBackups(ctx, logutil.NewMemoryLogger(), bs, dir, policy, false /* dryRun */)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("PruneBackups: %v %v, want %v", got, err, want)
+	}
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bhs) != 7 || bhs[0].Name() != c {
+		t.Errorf("ListBackups after PruneBackups: %v backups, the first is %v, want 7 starting with %v", len(bhs), bhs[0].Name(), c)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"flag"
+	"fmt"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// BackupEngine is the interface to take a full backup with a given
+// method, and to restore it.
+type BackupEngine interface {
+	// ExecuteBackup takes a backup into bh, and writes its MANIFEST.
+	// It returns a boolean that indicates if the backup is usable,
+	// and an overall error.
+	ExecuteBackup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (bool, error)
+
+	// ExecuteRestore restores the files of the backup in bh,
+	// described by bm. mysqld is shut down, and its existing
+	// files are removed.
+	ExecuteRestore(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, hookExtraEnv map[string]string) error
+
+	// ShouldDrainForBackup returns true if the tablet has to stop
+	// serving while the engine takes a backup.
+	ShouldDrainForBackup() bool
+}
+
+const builtinBackupEngineName = "builtin"
+
+var (
+	// BackupEngineImplementation is the implementation to use
+	// for taking backups. Exported for test purposes.
+	BackupEngineImplementation = flag.String("backup_engine_implementation", builtinBackupEngineName, "which implementation to use for taking backups: builtin, xtrabackup or mariabackup. Restores use the implementation recorded in the backup.")
+)
+
+// BackupEngineMap contains the registered implementations for BackupEngine
+var BackupEngineMap = make(map[string]BackupEngine)
+
+// GetBackupEngine returns the BackupEngine implementation to use
+// for taking backups. Should be called after flags have been
+// initialized.
+func GetBackupEngine() (BackupEngine, error) {
+	return getBackupEngine(*BackupEngineImplementation)
+}
+
+// getBackupEngine returns the BackupEngine implementation with the
+// given name. Backups taken before there were engines do not record
+// one, they were all taken by the builtin engine.
+func getBackupEngine(name string) (BackupEngine, error) {
+	if name == "" {
+		name = builtinBackupEngineName
+	}
+	be, ok := BackupEngineMap[name]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of BackupEngine named %v", name)
+	}
+	return be, nil
+}
+
+// BuiltinBackupEngine stops replication and shuts down mysqld,
+// then copies all the data files into the backup.
+type BuiltinBackupEngine struct{}
+
+// ExecuteBackup is part of the BackupEngine interface.
+func (be *BuiltinBackupEngine) ExecuteBackup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (bool, error) {
+	return backup(ctx, mysqld, logger, bh, backupConcurrency, hookExtraEnv)
+}
+
+// ExecuteRestore is part of the BackupEngine interface.
+func (be *BuiltinBackupEngine) ExecuteRestore(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, hookExtraEnv map[string]string) error {
+	logger.Infof("Restore: copying all files")
+	return restoreFiles(ctx, mysqld.Cnf(), bh, bm.FileEntries, bm.TransformHook, !bm.SkipCompress, restoreConcurrency, hookExtraEnv)
+}
+
+// ShouldDrainForBackup is part of the BackupEngine interface.
+// mysqld is shut down during the backup.
+func (be *BuiltinBackupEngine) ShouldDrainForBackup() bool {
+	return true
+}
+
+func init() {
+	BackupEngineMap[builtinBackupEngineName] = &BuiltinBackupEngine{}
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/dbconfigs"
+	vtenv "vitess.io/vitess/go/vt/env"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// This file handles archiving the master binlogs into the
+// BackupStorage, and replaying them on top of a restored backup
+// for point-in-time recovery.
+
+const (
+	// binlogArchiveRoot is the top-level directory in the
+	// BackupStorage for archived binlogs.
+	binlogArchiveRoot = "binlogs"
+
+	// binlogArchiveFile is the name of the archived binlog
+	// contents inside its BackupHandle.
+	binlogArchiveFile = "0"
+
+	// BackupTimestampFormat is the format of the timestamp that
+	// prefixes backup names.
+	BackupTimestampFormat = "2006-01-02.150405"
+
+	// binlogArchiveTimestampFormat is the format of the timestamp
+	// that prefixes archived binlog names. Binlog names are reused
+	// after a RESET MASTER, so it is more precise.
+	binlogArchiveTimestampFormat = "2006-01-02.150405.000000000"
+)
+
+// RestorePoint describes how far a point-in-time restore goes.
+// The zero value restores the most recent backup as it was taken.
+type RestorePoint struct {
+	// Position, if set, restores up to and including this position.
+	Position mysql.Position
+
+	// Time, if set, restores all the events that happened
+	// strictly before this time.
+	Time time.Time
+}
+
+// IsZero returns true if no point in time was requested.
+func (rp RestorePoint) IsZero() bool {
+	return rp.Position.IsZero() && rp.Time.IsZero()
+}
+
+// String returns a human readable version of the RestorePoint.
+func (rp RestorePoint) String() string {
+	switch {
+	case !rp.Position.IsZero():
+		return fmt.Sprintf("position %v", rp.Position)
+	case !rp.Time.IsZero():
+		return fmt.Sprintf("time %v", rp.Time.UTC().Format(time.RFC3339))
+	}
+	return "latest backup"
+}
+
+// BinlogManifest describes one archived binlog file.
+type BinlogManifest struct {
+	// FileEntry is the archived binlog file.
+	FileEntry FileEntry
+
+	// PreviousPosition is the position before the first event
+	// of the binlog file.
+	PreviousPosition mysql.Position
+
+	// Position is the position after the last event of the
+	// binlog file.
+	Position mysql.Position
+
+	// TransformHook that was used on the file, if any.
+	TransformHook string
+
+	// SkipCompress is set if the file was not run through gzip.
+	SkipCompress bool
+}
+
+// BinlogArchiveDir returns the directory of the BackupStorage that
+// contains the archived binlogs for the backups in dir. It is kept
+// apart from dir, so listing the backups does not return binlogs.
+func BinlogArchiveDir(dir string) string {
+	return path.Join(binlogArchiveRoot, dir)
+}
+
+// backupTime returns the time a backup was taken at, based on the
+// timestamp that prefixes its name.
+func backupTime(name string) (time.Time, error) {
+	if len(name) < len(BackupTimestampFormat) {
+		return time.Time{}, fmt.Errorf("backup name %v does not start with a timestamp", name)
+	}
+	return time.Parse(BackupTimestampFormat, name[:len(BackupTimestampFormat)])
+}
+
+// previousGTIDs returns the position stored in the Previous_gtids
+// event at the beginning of a binlog file. This event is only
+// written by MySQL 5.6 and later, so other flavors are not supported.
+func previousGTIDs(ctx context.Context, mysqld MysqlDaemon, file string) (mysql.Position, error) {
+	var query bytes.Buffer
+	query.WriteString("SHOW BINLOG EVENTS IN ")
+	sqltypes.NewVarChar(file).EncodeSQL(&query)
+	query.WriteString(" LIMIT 2")
+	qr, err := mysqld.FetchSuperQuery(ctx, query.String())
+	if err != nil {
+		return mysql.Position{}, err
+	}
+	// The columns are Log_name, Pos, Event_type, Server_id,
+	// End_log_pos and Info.
+	for _, row := range qr.Rows {
+		if len(row) < 6 || row[2].ToString() != "Previous_gtids" {
+			continue
+		}
+		return mysql.ParsePosition("MySQL56", row[5].ToString())
+	}
+	return mysql.Position{}, fmt.Errorf("binlog %v has no Previous_gtids event, archiving binlogs requires MySQL 5.6 GTIDs", file)
+}
+
+// readBinlogManifest reads the MANIFEST of an archived binlog.
+func readBinlogManifest(ctx context.Context, bh backupstorage.BackupHandle) (*BinlogManifest, error) {
+	rc, err := bh.ReadFile(ctx, backupManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	bm := &BinlogManifest{}
+	if err := json.NewDecoder(rc).Decode(bm); err != nil {
+		return nil, fmt.Errorf("cannot JSON decode %v: %v", backupManifest, err)
+	}
+	return bm, nil
+}
+
+// ArchiveBinlogs copies the binlog files of a master that are not
+// written to anymore, and that are not archived yet, into the
+// BackupStorage. dir is the directory of the shard backups.
+// It returns the number of archived files.
+func ArchiveBinlogs(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, dir string, hookExtraEnv map[string]string) (int, error) {
+	qr, err := mysqld.FetchSuperQuery(ctx, "SHOW BINARY LOGS")
+	if err != nil {
+		return 0, err
+	}
+	if len(qr.Rows) < 2 {
+		// The last binlog is still being written to.
+		return 0, nil
+	}
+	files := make([]string, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		files = append(files, row[0].ToString())
+	}
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return 0, err
+	}
+	defer bs.Close()
+
+	archiveDir := BinlogArchiveDir(dir)
+	bhs, err := bs.ListBackups(ctx, archiveDir)
+	if err != nil {
+		return 0, fmt.Errorf("ListBackups failed: %v", err)
+	}
+	archived := make(map[string][]backupstorage.BackupHandle)
+	for _, bh := range bhs {
+		file := ArchivedBinlogFile(bh.Name())
+		archived[file] = append(archived[file], bh)
+	}
+
+	count := 0
+	previous, err := previousGTIDs(ctx, mysqld, files[0])
+	if err != nil {
+		return count, err
+	}
+	for i, file := range files[:len(files)-1] {
+		next, err := previousGTIDs(ctx, mysqld, files[i+1])
+		if err != nil {
+			return count, err
+		}
+		bm := &BinlogManifest{
+			FileEntry: FileEntry{
+				Base: backupBinlogDir,
+				Name: file,
+			},
+			PreviousPosition: previous,
+			Position:         next,
+			TransformHook:    *backupStorageHook,
+			SkipCompress:     !*backupStorageCompress,
+		}
+		previous = next
+
+		// Binlog names are reused after a RESET MASTER, so
+		// we also compare the positions to find the file.
+		if isBinlogArchived(ctx, archived[file], bm) {
+			continue
+		}
+		if err := archiveBinlog(ctx, mysqld, logger, bs, archiveDir, bm, hookExtraEnv); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// ArchivedBinlogFile returns the name of the binlog file archived
+// in the BackupHandle with the given name.
+func ArchivedBinlogFile(name string) string {
+	if len(name) <= len(binlogArchiveTimestampFormat) {
+		return ""
+	}
+	return name[len(binlogArchiveTimestampFormat)+1:]
+}
+
+// isBinlogArchived returns true if one of the archived binlogs in bhs
+// has the same positions as bm.
+func isBinlogArchived(ctx context.Context, bhs []backupstorage.BackupHandle, bm *BinlogManifest) bool {
+	for _, bh := range bhs {
+		abm, err := readBinlogManifest(ctx, bh)
+		if err != nil {
+			continue
+		}
+		if abm.PreviousPosition.Equal(bm.PreviousPosition) && abm.Position.Equal(bm.Position) {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveBinlog copies one binlog file and its MANIFEST into
+// a new BackupHandle.
+func archiveBinlog(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bs backupstorage.BackupStorage, archiveDir string, bm *BinlogManifest, hookExtraEnv map[string]string) (err error) {
+	name := fmt.Sprintf("%v.%v", time.Now().UTC().Format(binlogArchiveTimestampFormat), bm.FileEntry.Name)
+	logger.Infof("archiving binlog %v as %v/%v", bm.FileEntry.Name, archiveDir, name)
+	bh, err := bs.StartBackup(ctx, archiveDir, name)
+	if err != nil {
+		return fmt.Errorf("StartBackup failed: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			if abortErr := bh.AbortBackup(ctx); abortErr != nil {
+				logger.Errorf("failed to abort binlog archive %v: %v", name, abortErr)
+			}
+			return
+		}
+		err = bh.EndBackup(ctx)
+	}()
+
+	if err := backupFile(ctx, mysqld, logger, bh, &bm.FileEntry, binlogArchiveFile, hookExtraEnv); err != nil {
+		return err
+	}
+
+	wc, err := bh.AddFile(ctx, backupManifest)
+	if err != nil {
+		return fmt.Errorf("cannot add %v to binlog archive: %v", backupManifest, err)
+	}
+	data, err := json.MarshalIndent(bm, "", "  ")
+	if err != nil {
+		wc.Close()
+		return fmt.Errorf("cannot JSON encode %v: %v", backupManifest, err)
+	}
+	if _, err := wc.Write(data); err != nil {
+		wc.Close()
+		return fmt.Errorf("cannot write %v: %v", backupManifest, err)
+	}
+	return wc.Close()
+}
+
+// isBackupBefore returns true if the backup with the given name
+// and MANIFEST can be used to restore to restorePoint.
+func isBackupBefore(name string, bm *BackupManifest, restorePoint RestorePoint) (bool, error) {
+	if !restorePoint.Position.IsZero() && !restorePoint.Position.AtLeast(bm.Position) {
+		return false, nil
+	}
+	if !restorePoint.Time.IsZero() {
+		t, err := backupTime(name)
+		if err != nil {
+			return false, err
+		}
+		if t.After(restorePoint.Time) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// replayBinlogs applies the archived binlogs on top of a restored
+// backup taken at pos, until restorePoint is reached. mysqld must be
+// running, and already know it is at pos. It returns the position
+// mysqld is at after the replay.
+func replayBinlogs(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bs backupstorage.BackupStorage, dir string, pos mysql.Position, restorePoint RestorePoint, hookExtraEnv map[string]string) (mysql.Position, error) {
+	archiveDir := BinlogArchiveDir(dir)
+	bhs, err := bs.ListBackups(ctx, archiveDir)
+	if err != nil {
+		return mysql.Position{}, fmt.Errorf("ListBackups failed: %v", err)
+	}
+
+	reached := false
+	for _, bh := range bhs {
+		bm, err := readBinlogManifest(ctx, bh)
+		if err != nil {
+			logger.Warningf("Possibly incomplete binlog archive %v in directory %v: %v", bh.Name(), archiveDir, err)
+			continue
+		}
+		if pos.AtLeast(bm.Position) {
+			// Everything in this binlog is already there.
+			continue
+		}
+		if !pos.AtLeast(bm.PreviousPosition) {
+			return mysql.Position{}, fmt.Errorf("archived binlogs are missing transactions between %v and %v, cannot restore to %v", pos, bm.PreviousPosition, restorePoint)
+		}
+
+		logger.Infof("Restore: replaying archived binlog %v", bh.Name())
+		if err := replayBinlog(ctx, mysqld, bh, bm, restorePoint, hookExtraEnv); err != nil {
+			return mysql.Position{}, err
+		}
+		pos = bm.Position
+		if !restorePoint.Position.IsZero() && pos.AtLeast(restorePoint.Position) {
+			reached = true
+			break
+		}
+	}
+	if !restorePoint.Position.IsZero() && !reached {
+		return mysql.Position{}, fmt.Errorf("archived binlogs end at %v, cannot restore to %v", pos, restorePoint)
+	}
+
+	return mysqld.MasterPosition()
+}
+
+// replayBinlog copies one archived binlog in the tmp directory,
+// and applies it.
+func replayBinlog(ctx context.Context, mysqld MysqlDaemon, bh backupstorage.BackupHandle, bm *BinlogManifest, restorePoint RestorePoint, hookExtraEnv map[string]string) error {
+	fe := bm.FileEntry
+	fe.Base = backupTmpDir
+	if err := restoreFile(ctx, mysqld.Cnf(), bh, &fe, bm.TransformHook, !bm.SkipCompress, binlogArchiveFile, hookExtraEnv); err != nil {
+		return err
+	}
+	binlogFile := path.Join(mysqld.Cnf().TmpDir, fe.Name)
+	defer os.Remove(binlogFile)
+
+	return mysqld.ApplyBinlogFile(ctx, binlogFile, restorePoint)
+}
+
+// ApplyBinlogFile runs mysqlbinlog on the given binlog file, and
+// pipes its output into the mysql client, stopping at restorePoint.
+func (mysqld *Mysqld) ApplyBinlogFile(ctx context.Context, binlogFile string, restorePoint RestorePoint) error {
+	dir, err := vtenv.VtMysqlRoot()
+	if err != nil {
+		return err
+	}
+	mysqlbinlogName, err := binaryPath(dir, "mysqlbinlog")
+	if err != nil {
+		return err
+	}
+	mysqlName, err := binaryPath(dir, "mysql")
+	if err != nil {
+		return err
+	}
+	params, err := dbconfigs.WithCredentials(&mysqld.dbcfgs.Dba)
+	if err != nil {
+		return err
+	}
+	cnf, err := mysqld.defaultsExtraFile(&params)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(cnf)
+
+	args := []string{binlogFile}
+	if !restorePoint.Position.IsZero() {
+		args = append(args, "--include-gtids="+restorePoint.Position.String())
+	}
+	if !restorePoint.Time.IsZero() {
+		// mysqlbinlog reads the time in the local time zone.
+		args = append(args, "--stop-datetime="+restorePoint.Time.Local().Format("2006-01-02 15:04:05"))
+	}
+	env := []string{
+		"LD_LIBRARY_PATH=" + path.Join(dir, "lib/mysql"),
+	}
+	readCmd := exec.CommandContext(ctx, mysqlbinlogName, args...)
+	readCmd.Env = env
+	applyCmd := exec.CommandContext(ctx, mysqlName, "--defaults-extra-file="+cnf, "--batch")
+	applyCmd.Env = env
+
+	var readErr, applyOut bytes.Buffer
+	readCmd.Stderr = &readErr
+	applyCmd.Stdout = &applyOut
+	applyCmd.Stderr = &applyOut
+	applyCmd.Stdin, err = readCmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := applyCmd.Start(); err != nil {
+		return fmt.Errorf("cannot start mysql: %v", err)
+	}
+	if err := readCmd.Run(); err != nil {
+		applyCmd.Wait()
+		return fmt.Errorf("mysqlbinlog %v failed: %v, output: %v", binlogFile, err, strings.TrimSpace(readErr.String()))
+	}
+	if err := applyCmd.Wait(); err != nil {
+		return fmt.Errorf("applying binlog %v failed: %v, output: %v", binlogFile, err, strings.TrimSpace(applyOut.String()))
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryptedbackupstorage implements a BackupStorage that
+// encrypts the files of the backups with AES-GCM, and stores them in
+// another BackupStorage implementation.
+package encryptedbackupstorage
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+var (
+	// StorageImplementation is the BackupStorage the encrypted
+	// files are stored in. Exported for test purposes.
+	StorageImplementation = flag.String("encrypted_backup_storage_implementation", "", "which implementation of the backup storage the encrypted backup storage stores the encrypted files in")
+
+	// KMSImplementation is the KMS that encrypts the data keys of
+	// new backups. Exported for test purposes.
+	KMSImplementation = flag.String("encrypted_backup_storage_kms", "keyfile", "which KMS implementation encrypts the data keys of the encrypted backup storage")
+)
+
+// keyFile is the name of the file that contains the encrypted
+// data key in each backup. It is not encrypted.
+const keyFile = "ENCRYPTION-KEY"
+
+// encryptionKey is the content of keyFile.
+type encryptionKey struct {
+	// KMS is the name of the KMS that encrypted the data key.
+	KMS string
+
+	// EncryptedKey is the encrypted data key.
+	EncryptedKey []byte
+}
+
+// EncryptedBackupHandle implements BackupHandle for encrypted backups.
+type EncryptedBackupHandle struct {
+	bh backupstorage.BackupHandle
+
+	// mu protects aead, that is read lazily for read-only backups.
+	mu   sync.Mutex
+	aead cipher.AEAD
+}
+
+// Directory is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) Directory() string {
+	return ebh.bh.Directory()
+}
+
+// Name is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) Name() string {
+	return ebh.bh.Name()
+}
+
+// AddFile is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) AddFile(ctx context.Context, filename string) (io.WriteCloser, error) {
+	if filename == keyFile {
+		return nil, fmt.Errorf("%v is reserved by the encrypted backup storage", keyFile)
+	}
+	wc, err := ebh.bh.AddFile(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	ew, err := newEncryptWriter(wc, ebh.aead, filename)
+	if err != nil {
+		wc.Close()
+		return nil, err
+	}
+	return ew, nil
+}
+
+// EndBackup is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) EndBackup(ctx context.Context) error {
+	return ebh.bh.EndBackup(ctx)
+}
+
+// AbortBackup is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) AbortBackup(ctx context.Context) error {
+	return ebh.bh.AbortBackup(ctx)
+}
+
+// ReadFile is part of the BackupHandle interface
+func (ebh *EncryptedBackupHandle) ReadFile(ctx context.Context, filename string) (io.ReadCloser, error) {
+	aead, err := ebh.readKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := ebh.bh.ReadFile(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := newDecryptReader(rc, aead, filename)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return dr, nil
+}
+
+// readKey reads and decrypts the data key of a read-only backup
+// the first time it is needed.
+func (ebh *EncryptedBackupHandle) readKey(ctx context.Context) (cipher.AEAD, error) {
+	ebh.mu.Lock()
+	defer ebh.mu.Unlock()
+	if ebh.aead != nil {
+		return ebh.aead, nil
+	}
+
+	rc, err := ebh.bh.ReadFile(ctx, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the data key of backup %v, it is not encrypted: %v", ebh.Name(), err)
+	}
+	defer rc.Close()
+	ek := &encryptionKey{}
+	if err := json.NewDecoder(rc).Decode(ek); err != nil {
+		return nil, fmt.Errorf("cannot JSON decode %v: %v", keyFile, err)
+	}
+	kms, ok := KMSMap[ek.KMS]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of KMS named %v", ek.KMS)
+	}
+	key, err := kms.DecryptDataKey(ctx, ek.EncryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	ebh.aead, err = newAEAD(key)
+	return ebh.aead, err
+}
+
+// EncryptedBackupStorage implements BackupStorage on top of
+// another BackupStorage, encrypting the files.
+type EncryptedBackupStorage struct{}
+
+// storage returns the underlying BackupStorage.
+func (ebs *EncryptedBackupStorage) storage() (backupstorage.BackupStorage, error) {
+	if *StorageImplementation == "encrypted" {
+		return nil, fmt.Errorf("the encrypted backup storage cannot store files in itself")
+	}
+	bs, ok := backupstorage.BackupStorageMap[*StorageImplementation]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of BackupStorage named %q for the encrypted backup storage", *StorageImplementation)
+	}
+	return bs, nil
+}
+
+// ListBackups is part of the BackupStorage interface
+func (ebs *EncryptedBackupStorage) ListBackups(ctx context.Context, dir string) ([]backupstorage.BackupHandle, error) {
+	bs, err := ebs.storage()
+	if err != nil {
+		return nil, err
+	}
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]backupstorage.BackupHandle, 0, len(bhs))
+	for _, bh := range bhs {
+		result = append(result, &EncryptedBackupHandle{bh: bh})
+	}
+	return result, nil
+}
+
+// StartBackup is part of the BackupStorage interface. It generates
+// the data key of the backup.
+func (ebs *EncryptedBackupStorage) StartBackup(ctx context.Context, dir, name string) (backupstorage.BackupHandle, error) {
+	bs, err := ebs.storage()
+	if err != nil {
+		return nil, err
+	}
+	kms, ok := KMSMap[*KMSImplementation]
+	if !ok {
+		return nil, fmt.Errorf("no registered implementation of KMS named %v", *KMSImplementation)
+	}
+	key, encryptedKey, err := kms.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate a data key: %v", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	bh, err := bs.StartBackup(ctx, dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeKey(ctx, bh, &encryptionKey{
+		KMS:          *KMSImplementation,
+		EncryptedKey: encryptedKey,
+	}); err != nil {
+		bh.AbortBackup(ctx)
+		return nil, err
+	}
+	return &EncryptedBackupHandle{
+		bh:   bh,
+		aead: aead,
+	}, nil
+}
+
+// writeKey writes the encrypted data key in a new backup.
+func writeKey(ctx context.Context, bh backupstorage.BackupHandle, ek *encryptionKey) error {
+	wc, err := bh.AddFile(ctx, keyFile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(wc).Encode(ek); err != nil {
+		wc.Close()
+		return fmt.Errorf("cannot write %v: %v", keyFile, err)
+	}
+	return wc.Close()
+}
+
+// RemoveBackup is part of the BackupStorage interface
+func (ebs *EncryptedBackupStorage) RemoveBackup(ctx context.Context, dir, name string) error {
+	bs, err := ebs.storage()
+	if err != nil {
+		return err
+	}
+	return bs.RemoveBackup(ctx, dir, name)
+}
+
+// Close implements BackupStorage.
+func (ebs *EncryptedBackupStorage) Close() error {
+	bs, err := ebs.storage()
+	if err != nil {
+		return err
+	}
+	return bs.Close()
+}
+
+func init() {
+	backupstorage.BackupStorageMap["encrypted"] = &EncryptedBackupStorage{}
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryptedbackupstorage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/mysqlctl/filebackupstorage"
+)
+
+// setupEncryptedBackupStorage creates a temporary directory, with a
+// master key and a file backup storage, and returns an
+// EncryptedBackupStorage based on them.
+func setupEncryptedBackupStorage(t *testing.T) *EncryptedBackupStorage {
+	root, err := ioutil.TempDir("", "ebstest")
+	if err != nil {
+		t.Fatalf("os.TempDir failed: %v", err)
+	}
+	*filebackupstorage.FileBackupStorageRoot = path.Join(root, "fbs")
+	*StorageImplementation = "file"
+	*KeyFile = path.Join(root, "keyfile")
+	writeMasterKey(t)
+	return &EncryptedBackupStorage{}
+}
+
+// writeMasterKey writes a new random master key in the keyfile.
+func writeMasterKey(t *testing.T) {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*KeyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cleanupEncryptedBackupStorage() {
+	os.RemoveAll(path.Dir(*KeyFile))
+}
+
+// writeTestBackup creates a backup with the given files.
+func writeTestBackup(t *testing.T, ebs *EncryptedBackupStorage, dir, name string, files map[string][]byte) {
+	t.Helper()
+	ctx := context.Background()
+	bh, err := ebs.StartBackup(ctx, dir, name)
+	if err != nil {
+		t.Fatalf("StartBackup failed: %v", err)
+	}
+	for filename, data := range files {
+		wc, err := bh.AddFile(ctx, filename)
+		if err != nil {
+			t.Fatalf("AddFile(%v) failed: %v", filename, err)
+		}
+		// Write in small pieces, so chunks are assembled.
+		for len(data) > 0 {
+			n := 1000
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := wc.Write(data[:n]); err != nil {
+				t.Fatalf("Write(%v) failed: %v", filename, err)
+			}
+			data = data[n:]
+		}
+		if err := wc.Close(); err != nil {
+			t.Fatalf("Close(%v) failed: %v", filename, err)
+		}
+	}
+	if err := bh.EndBackup(ctx); err != nil {
+		t.Fatalf("EndBackup failed: %v", err)
+	}
+}
+
+// readTestFile reads a file of the only backup in dir.
+func readTestFile(ebs *EncryptedBackupStorage, dir, filename string) ([]byte, error) {
+	ctx := context.Background()
+	bhs, err := ebs.ListBackups(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := bhs[0].ReadFile(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func TestEncryptedBackupStorage(t *testing.T) {
+	ebs := setupEncryptedBackupStorage(t)
+	defer cleanupEncryptedBackupStorage()
+
+	large := make([]byte, 3*chunkSize+100)
+	if _, err := io.ReadFull(rand.Reader, large); err != nil {
+		t.Fatal(err)
+	}
+	exact := bytes.Repeat([]byte("x"), chunkSize)
+	files := map[string][]byte{
+		"0":        large,
+		"1":        exact,
+		"2":        {},
+		"MANIFEST": []byte(`{"Position": "secret"}`),
+	}
+	dir := "keyspace/shard"
+	writeTestBackup(t, ebs, dir, "backup1", files)
+
+	for filename, want := range files {
+		got, err := readTestFile(ebs, dir, filename)
+		if err != nil {
+			t.Fatalf("ReadFile(%v) failed: %v", filename, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%v) returned %v bytes, want %v", filename, len(got), len(want))
+		}
+	}
+
+	// The stored files are encrypted.
+	stored, err := ioutil.ReadFile(path.Join(*filebackupstorage.FileBackupStorageRoot, dir, "backup1", "MANIFEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(stored, []byte("secret")) {
+		t.Errorf("stored MANIFEST is not encrypted: %q", stored)
+	}
+
+	// The key file is reserved.
+	bh, err := ebs.StartBackup(context.Background(), dir, "backup2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bh.AddFile(context.Background(), keyFile); err == nil {
+		t.Errorf("AddFile(%v) worked, want an error", keyFile)
+	}
+	if err := bh.AbortBackup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedBackupStorageCorruption(t *testing.T) {
+	ebs := setupEncryptedBackupStorage(t)
+	defer cleanupEncryptedBackupStorage()
+
+	data := bytes.Repeat([]byte("0123456789"), chunkSize/4)
+	dir := "keyspace/shard"
+	writeTestBackup(t, ebs, dir, "backup1", map[string][]byte{
+		"0": data,
+		"1": data,
+	})
+	storedPath := func(filename string) string {
+		return path.Join(*filebackupstorage.FileBackupStorageRoot, dir, "backup1", filename)
+	}
+	stored, err := ioutil.ReadFile(storedPath("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcases := []struct {
+		desc   string
+		stored []byte
+		err    string
+	}{{
+		desc:   "modified",
+		stored: append(append(append([]byte{}, stored[:100]...), stored[100]^1), stored[101:]...),
+		err:    "it is corrupted",
+	}, {
+		desc:   "truncated",
+		stored: stored[:len(stored)-chunkHeaderSize-16],
+		err:    "truncated",
+	}, {
+		desc:   "extended",
+		stored: append(append([]byte{}, stored...), 'x'),
+		err:    "data after its last chunk",
+	}}
+	for _, tcase := range testcases {
+		if err := ioutil.WriteFile(storedPath("0"), tcase.stored, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readTestFile(ebs, dir, "0"); err == nil || !strings.Contains(err.Error(), tcase.err) {
+			t.Errorf("%v file: ReadFile returned %v, want %v", tcase.desc, err, tcase.err)
+		}
+	}
+
+	// A file cannot be swapped with another file of the backup.
+	if err := ioutil.WriteFile(storedPath("0"), stored, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(storedPath("0"), storedPath("1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTestFile(ebs, dir, "1"); err == nil || !strings.Contains(err.Error(), "it is corrupted") {
+		t.Errorf("swapped file: ReadFile returned %v, want corrupted", err)
+	}
+
+	// Another master key cannot decrypt the backup.
+	writeMasterKey(t)
+	if _, err := readTestFile(ebs, dir, "MANIFEST"); err == nil || !strings.Contains(err.Error(), "another master key") {
+		t.Errorf("ReadFile with another master key returned %v, want another master key", err)
+	}
+}
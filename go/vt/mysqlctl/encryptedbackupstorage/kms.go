@@ -0,0 +1,131 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryptedbackupstorage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// KMS protects the data keys that encrypt the backups. Each backup is
+// encrypted with its own data key, that is stored with the backup,
+// encrypted by the KMS.
+type KMS interface {
+	// GenerateDataKey returns a new random data key for AES-256,
+	// and its encrypted form that is stored with the backup.
+	GenerateDataKey(ctx context.Context) (key, encryptedKey []byte, err error)
+
+	// DecryptDataKey returns the data key from its encrypted form.
+	DecryptDataKey(ctx context.Context, encryptedKey []byte) ([]byte, error)
+}
+
+// KMSMap contains the registered implementations for KMS
+var KMSMap = make(map[string]KMS)
+
+var (
+	// KeyFile is the file that contains the master key of the
+	// keyfile KMS. Exported for test purposes.
+	KeyFile = flag.String("encrypted_backup_storage_keyfile", "", "file that contains the hex-encoded 32 bytes master key of the keyfile KMS")
+)
+
+const (
+	// dataKeySize is the size of the data keys, for AES-256.
+	dataKeySize = 32
+
+	// dataKeyAdditionalData authenticates the encrypted data keys.
+	dataKeyAdditionalData = "vitess backup data key"
+)
+
+// KeyFileKMS encrypts the data keys with AES-GCM, with a master
+// key read from a local file.
+type KeyFileKMS struct{}
+
+// GenerateDataKey is part of the KMS interface.
+func (kms *KeyFileKMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	aead, err := kms.masterKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, nil, err
+	}
+	return key, aead.Seal(nonce, nonce, key, []byte(dataKeyAdditionalData)), nil
+}
+
+// DecryptDataKey is part of the KMS interface.
+func (kms *KeyFileKMS) DecryptDataKey(ctx context.Context, encryptedKey []byte) ([]byte, error) {
+	aead, err := kms.masterKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(encryptedKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data key is too short")
+	}
+	nonce := encryptedKey[:aead.NonceSize()]
+	key, err := aead.Open(nil, nonce, encryptedKey[aead.NonceSize():], []byte(dataKeyAdditionalData))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt the data key, the backup was encrypted with another master key: %v", err)
+	}
+	return key, nil
+}
+
+// masterKey reads the master key from the keyfile. It is read every
+// time, so the file can be replaced without a restart.
+func (kms *KeyFileKMS) masterKey() (cipher.AEAD, error) {
+	if *KeyFile == "" {
+		return nil, fmt.Errorf("encrypted_backup_storage_keyfile must be set to use the keyfile KMS")
+	}
+	data, err := ioutil.ReadFile(*KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode the master key in %v: %v", *KeyFile, err)
+	}
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("the master key in %v has %v bytes, expected %v", *KeyFile, len(key), dataKeySize)
+	}
+	return newAEAD(key)
+}
+
+// newAEAD returns AES-GCM with the given key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func init() {
+	KMSMap["keyfile"] = &KeyFileKMS{}
+}
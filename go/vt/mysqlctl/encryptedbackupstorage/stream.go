@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryptedbackupstorage
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// The files are encrypted with AES-GCM in chunks, so they can be
+// streamed. An encrypted file is:
+// - a random nonce prefix, of nonceSize-4 bytes.
+// - the chunks, each one being a flag byte, the size of the
+//   encrypted data as a big endian uint32, and the encrypted data.
+// The nonce of a chunk is the nonce prefix followed by the index of
+// the chunk as a big endian uint32, so chunks cannot be reordered.
+// The flag is set on the last chunk, which can be empty, so a
+// truncated file is detected. The flag and the file name are the
+// additional data of each chunk, so chunks cannot be moved to
+// another file of the backup.
+
+const (
+	// chunkSize is the maximum size of the data in a chunk.
+	chunkSize = 64 * 1024
+
+	// chunkHeaderSize is the size of the flag and the size of
+	// the encrypted data.
+	chunkHeaderSize = 5
+
+	// lastChunk is the flag of the last chunk.
+	lastChunk = 1
+)
+
+// errTruncated is returned when an encrypted file ends before its
+// last chunk.
+var errTruncated = errors.New("encrypted file is truncated")
+
+// chunkAdditionalData returns the additional data of a chunk.
+func chunkAdditionalData(flag byte, filename string) []byte {
+	return append([]byte{flag}, filename...)
+}
+
+// chunkNonce returns the nonce of the chunk with the given index.
+func chunkNonce(prefix []byte, index uint64) ([]byte, error) {
+	if index > math.MaxUint32 {
+		return nil, fmt.Errorf("encrypted file has too many chunks")
+	}
+	nonce := make([]byte, len(prefix)+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], uint32(index))
+	return nonce, nil
+}
+
+// encryptWriter encrypts what is written to it into wc.
+type encryptWriter struct {
+	wc       io.WriteCloser
+	aead     cipher.AEAD
+	filename string
+	prefix   []byte
+	index    uint64
+	buf      []byte
+}
+
+func newEncryptWriter(wc io.WriteCloser, aead cipher.AEAD, filename string) (*encryptWriter, error) {
+	prefix := make([]byte, aead.NonceSize()-4)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	if _, err := wc.Write(prefix); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{
+		wc:       wc,
+		aead:     aead,
+		filename: filename,
+		prefix:   prefix,
+		buf:      make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// Write is part of the io.Writer interface.
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+n]
+		p = p[n:]
+		written += n
+		if len(ew.buf) == chunkSize {
+			if err := ew.writeChunk(0); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last chunk, and closes the underlying file.
+func (ew *encryptWriter) Close() error {
+	if err := ew.writeChunk(lastChunk); err != nil {
+		ew.wc.Close()
+		return err
+	}
+	return ew.wc.Close()
+}
+
+func (ew *encryptWriter) writeChunk(flag byte) error {
+	nonce, err := chunkNonce(ew.prefix, ew.index)
+	if err != nil {
+		return err
+	}
+	ew.index++
+	sealed := ew.aead.Seal(nil, nonce, ew.buf, chunkAdditionalData(flag, ew.filename))
+	ew.buf = ew.buf[:0]
+
+	var header [chunkHeaderSize]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	if _, err := ew.wc.Write(header[:]); err != nil {
+		return err
+	}
+	_, err = ew.wc.Write(sealed)
+	return err
+}
+
+// decryptReader decrypts what it reads from rc.
+type decryptReader struct {
+	rc       io.ReadCloser
+	aead     cipher.AEAD
+	filename string
+	prefix   []byte
+	index    uint64
+	buf      []byte
+	last     bool
+}
+
+func newDecryptReader(rc io.ReadCloser, aead cipher.AEAD, filename string) (*decryptReader, error) {
+	prefix := make([]byte, aead.NonceSize()-4)
+	if _, err := io.ReadFull(rc, prefix); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	return &decryptReader{
+		rc:       rc,
+		aead:     aead,
+		filename: filename,
+		prefix:   prefix,
+	}, nil
+}
+
+// Read is part of the io.Reader interface.
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.buf) == 0 {
+		if dr.last {
+			// Nothing may follow the last chunk.
+			var extra [1]byte
+			if n, _ := io.ReadFull(dr.rc, extra[:]); n > 0 {
+				return 0, fmt.Errorf("encrypted file %v has data after its last chunk", dr.filename)
+			}
+			return 0, io.EOF
+		}
+		if err := dr.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.buf)
+	dr.buf = dr.buf[n:]
+	return n, nil
+}
+
+// Close is part of the io.Closer interface.
+func (dr *decryptReader) Close() error {
+	return dr.rc.Close()
+}
+
+func (dr *decryptReader) readChunk() error {
+	var header [chunkHeaderSize]byte
+	if _, err := io.ReadFull(dr.rc, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+	flag := header[0]
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > chunkSize+uint32(dr.aead.Overhead()) {
+		return fmt.Errorf("encrypted file %v has a chunk of %v bytes, it is corrupted", dr.filename, size)
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(dr.rc, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errTruncated
+		}
+		return err
+	}
+
+	nonce, err := chunkNonce(dr.prefix, dr.index)
+	if err != nil {
+		return err
+	}
+	dr.index++
+	dr.buf, err = dr.aead.Open(sealed[:0], nonce, sealed, chunkAdditionalData(flag, dr.filename))
+	if err != nil {
+		return fmt.Errorf("cannot decrypt encrypted file %v, it is corrupted: %v", dr.filename, err)
+	}
+	dr.last = flag == lastChunk
+	return nil
+}
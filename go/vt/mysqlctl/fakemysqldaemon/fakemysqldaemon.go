@@ -18,6 +18,8 @@ package fakemysqldaemon
 
 import (
 	"fmt"
+	"os"
+	"path"
 	"reflect"
 	"strings"
 	"time"
@@ -130,6 +132,14 @@ type FakeMysqlDaemon struct {
 	// BinlogPlayerEnabled is used by {Enable,Disable}BinlogPlayer
 	BinlogPlayerEnabled bool
 
+	// AppliedBinlogFiles is appended with the base name of the
+	// files passed to ApplyBinlogFile.
+	AppliedBinlogFiles []string
+
+	// AppliedRestorePoint is the last restore point passed to
+	// ApplyBinlogFile.
+	AppliedRestorePoint mysqlctl.RestorePoint
+
 	// SemiSyncMasterEnabled represents the state of rpl_semi_sync_master_enabled.
 	SemiSyncMasterEnabled bool
 	// SemiSyncSlaveEnabled represents the state of rpl_semi_sync_slave_enabled.
@@ -360,6 +370,16 @@ func (fmd *FakeMysqlDaemon) DisableBinlogPlayback() error {
 	return nil
 }
 
+// ApplyBinlogFile is part of the MysqlDaemon interface
+func (fmd *FakeMysqlDaemon) ApplyBinlogFile(ctx context.Context, binlogFile string, restorePoint mysqlctl.RestorePoint) error {
+	if _, err := os.Stat(binlogFile); err != nil {
+		return err
+	}
+	fmd.AppliedBinlogFiles = append(fmd.AppliedBinlogFiles, path.Base(binlogFile))
+	fmd.AppliedRestorePoint = restorePoint
+	return nil
+}
+
 // Close is part of the MysqlDaemon interface
 func (fmd *FakeMysqlDaemon) Close() {
 	if fmd.appPool != nil {
@@ -0,0 +1,191 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// This file handles incremental backups. An incremental backup
+// stores the binlogs between the backup it is based on and the
+// time it is taken. The backups form chains, that start with a full
+// backup: restoring an incremental backup restores the full backup,
+// then applies the binlogs of each incremental backup in order.
+
+// findLatestBackup returns the name and MANIFEST of the most recent
+// backup in dir that can be read.
+func findLatestBackup(ctx context.Context, logger logutil.Logger, bs backupstorage.BackupStorage, dir string) (string, *BackupManifest, error) {
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		return "", nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+	for i := len(bhs) - 1; i >= 0; i-- {
+		bm, err := readBackupManifest(ctx, bhs[i])
+		if err != nil {
+			logger.Warningf("Possibly incomplete backup %v in directory %v on BackupStorage: %v", bhs[i].Name(), dir, err)
+			continue
+		}
+		return bhs[i].Name(), bm, nil
+	}
+	return "", nil, fmt.Errorf("no backup in directory %v to base an incremental backup on, take a full backup first", dir)
+}
+
+// backupIncremental stores the binlogs that contain the transactions
+// executed since the base backup. mysqld keeps running. It returns a
+// boolean that indicates if the backup is usable, and an overall error.
+func backupIncremental(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, baseName string, base *BackupManifest, backupConcurrency int, hookExtraEnv map[string]string) (bool, error) {
+	// Close the current binlog, so all the transactions executed
+	// until now are in binlogs that are not written to anymore.
+	if err := mysqld.ExecuteSuperQueryList(ctx, []string{"FLUSH BINARY LOGS"}); err != nil {
+		return false, fmt.Errorf("can't flush binlogs: %v", err)
+	}
+	qr, err := mysqld.FetchSuperQuery(ctx, "SHOW BINARY LOGS")
+	if err != nil {
+		return false, err
+	}
+	if len(qr.Rows) == 0 {
+		return false, fmt.Errorf("binary logging is not enabled, can't take an incremental backup")
+	}
+	files := make([]string, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		files = append(files, row[0].ToString())
+	}
+
+	// Find the binlogs after the base backup position. The position
+	// at the end of a binlog is the one at the start of the next one.
+	var fes []FileEntry
+	previous, err := previousGTIDs(ctx, mysqld, files[0])
+	if err != nil {
+		return false, err
+	}
+	for i, file := range files[:len(files)-1] {
+		next, err := previousGTIDs(ctx, mysqld, files[i+1])
+		if err != nil {
+			return false, err
+		}
+		if base.Position.AtLeast(next) {
+			// Everything in this binlog is in the base backup.
+			previous = next
+			continue
+		}
+		if len(fes) == 0 && !base.Position.AtLeast(previous) {
+			return false, fmt.Errorf("the binlogs with the transactions between %v and %v were purged, take a full backup", base.Position, previous)
+		}
+		fes = append(fes, FileEntry{
+			Base: backupBinlogDir,
+			Name: file,
+		})
+		previous = next
+	}
+	if len(fes) == 0 {
+		return false, fmt.Errorf("no new transactions since backup %v at %v", baseName, base.Position)
+	}
+	logger.Infof("backing up %v binlogs from %v to %v", len(fes), base.Position, previous)
+
+	if err := backupFileEntries(ctx, mysqld, logger, bh, fes, backupConcurrency, hookExtraEnv); err != nil {
+		return false, err
+	}
+	if err := writeBackupManifest(ctx, bh, &BackupManifest{
+		FileEntries:   fes,
+		Position:      previous,
+		TransformHook: *backupStorageHook,
+		SkipCompress:  !*backupStorageCompress,
+		Incremental:   true,
+		BaseBackup:    baseName,
+		FromPosition:  base.Position,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// backupChain returns the indexes in bhs of the backups to restore
+// in order to restore the backup at index i: the full backup first,
+// then the incremental backups, up to and including i.
+func backupChain(bhs []backupstorage.BackupHandle, i int, manifest func(int) *BackupManifest) ([]int, error) {
+	chain := []int{i}
+	for bm := manifest(i); bm.Incremental; {
+		j := i - 1
+		for j >= 0 && bhs[j].Name() != bm.BaseBackup {
+			j--
+		}
+		if j < 0 {
+			return nil, fmt.Errorf("backup %v is based on backup %v, which does not exist", bhs[i].Name(), bm.BaseBackup)
+		}
+		base := manifest(j)
+		if base == nil {
+			return nil, fmt.Errorf("backup %v is based on backup %v, which cannot be read", bhs[i].Name(), bm.BaseBackup)
+		}
+		chain = append([]int{j}, chain...)
+		i, bm = j, base
+	}
+	return chain, nil
+}
+
+// applyIncrementalBackup copies the binlogs of an incremental backup
+// in the tmp directory, and applies them one by one. mysqld must be
+// running, at pos.
+func applyIncrementalBackup(ctx context.Context, mysqld MysqlDaemon, bh backupstorage.BackupHandle, bm *BackupManifest, pos mysql.Position, hookExtraEnv map[string]string) error {
+	if !pos.Equal(bm.FromPosition) {
+		return fmt.Errorf("incremental backup %v starts at %v, but the restored data is at %v", bh.Name(), bm.FromPosition, pos)
+	}
+	for i := range bm.FileEntries {
+		fe := bm.FileEntries[i]
+		fe.Base = backupTmpDir
+		if err := restoreFile(ctx, mysqld.Cnf(), bh, &fe, bm.TransformHook, !bm.SkipCompress, fmt.Sprintf("%v", i), hookExtraEnv); err != nil {
+			return err
+		}
+		binlogFile := path.Join(mysqld.Cnf().TmpDir, fe.Name)
+		err := mysqld.ApplyBinlogFile(ctx, binlogFile, RestorePoint{})
+		os.Remove(binlogFile)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackupDependents returns the names of the incremental backups in dir
+// that are based, directly or not, on the backup with the given name,
+// oldest first. Removing that backup makes them impossible to restore.
+func BackupDependents(ctx context.Context, bs backupstorage.BackupStorage, dir, name string) ([]string, error) {
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("ListBackups failed: %v", err)
+	}
+
+	// A backup is always listed after the backup it is based on.
+	chain := map[string]bool{name: true}
+	var dependents []string
+	for _, bh := range bhs {
+		bm, err := readBackupManifest(ctx, bh)
+		if err != nil || !bm.Incremental || !chain[bm.BaseBackup] {
+			continue
+		}
+		chain[bh.Name()] = true
+		dependents = append(dependents, bh.Name())
+	}
+	return dependents, nil
+}
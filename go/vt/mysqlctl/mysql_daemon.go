@@ -95,6 +95,9 @@ type MysqlDaemon interface {
 	// DisableBinlogPlayback disable playback of binlog events
 	DisableBinlogPlayback() error
 
+	// ApplyBinlogFile replays a binlog file, up to restorePoint.
+	ApplyBinlogFile(ctx context.Context, binlogFile string, restorePoint RestorePoint) error
+
 	// Close will close this instance of Mysqld. It will wait for all dba
 	// queries to be finished.
 	Close()
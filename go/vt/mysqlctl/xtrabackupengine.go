@@ -0,0 +1,286 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	vtenv "vitess.io/vitess/go/vt/env"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+)
+
+// XtrabackupEngine takes hot backups with Percona XtraBackup, or with
+// its MariaDB fork mariabackup. mysqld keeps running and replicating
+// during the backup, which is stored as a single xbstream.
+type XtrabackupEngine struct {
+	// name is the name the engine is registered with.
+	name string
+
+	// backupBinary takes and prepares the backups.
+	backupBinary string
+
+	// streamBinary extracts the xbstream.
+	streamBinary string
+
+	// flavor is the flavor of the positions backupBinary reports.
+	flavor string
+}
+
+var (
+	xtrabackupRootPath     = flag.String("xtrabackup_root_path", "", "directory of the xtrabackup and xbstream (or mariabackup and mbstream) binaries, defaults to the MySQL binaries")
+	xtrabackupUser         = flag.String("xtrabackup_user", "", "user that xtrabackup or mariabackup connects to mysqld with, over the socket. It needs the privileges to take a backup.")
+	xtrabackupBackupFlags  = flag.String("xtrabackup_backup_flags", "", "space separated flags added to the xtrabackup or mariabackup command that takes a backup")
+	xtrabackupPrepareFlags = flag.String("xtrabackup_prepare_flags", "", "space separated flags added to the xtrabackup or mariabackup command that prepares a backup before restoring it")
+)
+
+const (
+	// xtrabackupStreamFile is the name of the FileEntry of the
+	// xbstream in the MANIFEST. It is stored as file "0".
+	xtrabackupStreamFile = "backup.xbstream"
+
+	// xtrabackupRestoreDir is the directory in Mycnf.TmpDir that
+	// the xbstream is extracted to and prepared in.
+	xtrabackupRestoreDir = "xtrabackup"
+
+	// xtrabackupPositionPrefix precedes the GTID set of the backup
+	// in the output of xtrabackup and mariabackup:
+	// MySQL binlog position: filename 'vt-bin.000003', position '154', GTID of the last change '<GTID set>'
+	xtrabackupPositionPrefix = "GTID of the last change '"
+)
+
+// ExecuteBackup is part of the BackupEngine interface.
+func (be *XtrabackupEngine) ExecuteBackup(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (bool, error) {
+	if *xtrabackupUser == "" {
+		return false, fmt.Errorf("xtrabackup_user must be set to take a backup with %v", be.backupBinary)
+	}
+	backupProgram, err := be.binaryPath(be.backupBinary)
+	if err != nil {
+		return false, err
+	}
+	cnf := mysqld.Cnf()
+	args := []string{
+		"--defaults-file=" + cnf.path,
+		"--backup",
+		"--stream=xbstream",
+		"--socket=" + cnf.SocketFile,
+		"--user=" + *xtrabackupUser,
+		"--target-dir=" + cnf.TmpDir,
+		fmt.Sprintf("--parallel=%v", backupConcurrency),
+	}
+	args = append(args, strings.Fields(*xtrabackupBackupFlags)...)
+
+	logger.Infof("taking a hot backup with %v", be.backupBinary)
+	cmd := exec.CommandContext(ctx, backupProgram, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return false, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return false, err
+	}
+	if err := cmd.Start(); err != nil {
+		return false, fmt.Errorf("cannot start %v: %v", be.backupBinary, err)
+	}
+
+	// Log the progress reported on stderr, and keep it to find
+	// the position the backup was taken at.
+	var output bytes.Buffer
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			logger.Infof("%v: %v", be.backupBinary, line)
+			output.WriteString(line)
+			output.WriteByte('\n')
+		}
+	}()
+
+	fe := FileEntry{Name: xtrabackupStreamFile}
+	streamErr := backupStream(ctx, logger, bh, &fe, "0", stdout, hookExtraEnv)
+	if streamErr != nil {
+		// Nothing reads the stream anymore.
+		cmd.Process.Kill()
+		io.Copy(ioutil.Discard, stdout)
+	}
+	<-outputDone
+	waitErr := cmd.Wait()
+	if streamErr != nil {
+		return false, streamErr
+	}
+	if waitErr != nil {
+		return false, fmt.Errorf("%v failed: %v", be.backupBinary, waitErr)
+	}
+
+	pos, err := findXtrabackupPosition(output.String(), be.flavor)
+	if err != nil {
+		return false, err
+	}
+	logger.Infof("backup taken at position %v", pos)
+
+	if err := writeBackupManifest(ctx, bh, &BackupManifest{
+		FileEntries:   []FileEntry{fe},
+		Position:      pos,
+		TransformHook: *backupStorageHook,
+		SkipCompress:  !*backupStorageCompress,
+		BackupMethod:  be.name,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ExecuteRestore is part of the BackupEngine interface. It extracts
+// the xbstream in the tmp directory, prepares the backup there, and
+// moves the files into the mysqld directories.
+func (be *XtrabackupEngine) ExecuteRestore(ctx context.Context, mysqld MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, bm *BackupManifest, restoreConcurrency int, hookExtraEnv map[string]string) error {
+	if len(bm.FileEntries) != 1 {
+		return fmt.Errorf("%v backup %v has %v files, expected one xbstream", be.name, bh.Name(), len(bm.FileEntries))
+	}
+	backupProgram, err := be.binaryPath(be.backupBinary)
+	if err != nil {
+		return err
+	}
+	streamProgram, err := be.binaryPath(be.streamBinary)
+	if err != nil {
+		return err
+	}
+	cnf := mysqld.Cnf()
+	restoreDir := path.Join(cnf.TmpDir, xtrabackupRestoreDir)
+	if err := os.RemoveAll(restoreDir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(restoreDir, os.ModePerm); err != nil {
+		return err
+	}
+	defer os.RemoveAll(restoreDir)
+
+	logger.Infof("Restore: extracting the xbstream with %v", be.streamBinary)
+	extractCmd := exec.CommandContext(ctx, streamProgram, "-x", "-C", restoreDir, fmt.Sprintf("--parallel=%v", restoreConcurrency))
+	var extractOutput bytes.Buffer
+	extractCmd.Stdout = &extractOutput
+	extractCmd.Stderr = &extractOutput
+	stdin, err := extractCmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := extractCmd.Start(); err != nil {
+		return fmt.Errorf("cannot start %v: %v", be.streamBinary, err)
+	}
+	streamErr := restoreStream(ctx, bh, &bm.FileEntries[0], "0", stdin, bm.TransformHook, !bm.SkipCompress, hookExtraEnv)
+	stdin.Close()
+	waitErr := extractCmd.Wait()
+	if streamErr != nil {
+		return streamErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("%v failed: %v, output: %v", be.streamBinary, waitErr, strings.TrimSpace(extractOutput.String()))
+	}
+
+	logger.Infof("Restore: preparing the backup with %v", be.backupBinary)
+	args := append([]string{"--prepare", "--target-dir=" + restoreDir}, strings.Fields(*xtrabackupPrepareFlags)...)
+	if err := be.run(ctx, logger, backupProgram, args...); err != nil {
+		return err
+	}
+
+	logger.Infof("Restore: moving the files into place with %v", be.backupBinary)
+	return be.run(ctx, logger, backupProgram,
+		"--defaults-file="+cnf.path,
+		"--move-back",
+		"--target-dir="+restoreDir,
+		fmt.Sprintf("--parallel=%v", restoreConcurrency))
+}
+
+// ShouldDrainForBackup is part of the BackupEngine interface.
+// The backup is taken while mysqld keeps serving.
+func (be *XtrabackupEngine) ShouldDrainForBackup() bool {
+	return false
+}
+
+// binaryPath returns the path of one of the engine binaries.
+func (be *XtrabackupEngine) binaryPath(binary string) (string, error) {
+	if *xtrabackupRootPath != "" {
+		return path.Join(*xtrabackupRootPath, binary), nil
+	}
+	dir, err := vtenv.VtMysqlRoot()
+	if err != nil {
+		return "", err
+	}
+	return binaryPath(dir, binary)
+}
+
+// run runs a command, and logs its output.
+func (be *XtrabackupEngine) run(ctx context.Context, logger logutil.Logger, name string, args ...string) error {
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		logger.Infof("%v: %v", path.Base(name), line)
+	}
+	if err != nil {
+		return fmt.Errorf("%v %v failed: %v", path.Base(name), strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// findXtrabackupPosition returns the position a backup was taken at,
+// as reported in the output of xtrabackup or mariabackup.
+func findXtrabackupPosition(output, flavor string) (mysql.Position, error) {
+	i := strings.LastIndex(output, xtrabackupPositionPrefix)
+	if i < 0 {
+		return mysql.Position{}, fmt.Errorf("cannot find the backup position in the output, GTIDs must be enabled")
+	}
+	gtids := output[i+len(xtrabackupPositionPrefix):]
+	j := strings.IndexByte(gtids, '\'')
+	if j < 0 {
+		return mysql.Position{}, fmt.Errorf("cannot find the end of the backup position in the output")
+	}
+	// A long GTID set is printed over several lines.
+	gtids = strings.Replace(gtids[:j], "\n", "", -1)
+	if gtids == "" {
+		return mysql.Position{}, fmt.Errorf("the backup position is empty, GTIDs must be enabled")
+	}
+	return mysql.ParsePosition(flavor, gtids)
+}
+
+func init() {
+	BackupEngineMap["xtrabackup"] = &XtrabackupEngine{
+		name:         "xtrabackup",
+		backupBinary: "xtrabackup",
+		streamBinary: "xbstream",
+		flavor:       "MySQL56",
+	}
+	BackupEngineMap["mariabackup"] = &XtrabackupEngine{
+		name:         "mariabackup",
+		backupBinary: "mariabackup",
+		streamBinary: "mbstream",
+		flavor:       "MariaDB",
+	}
+}
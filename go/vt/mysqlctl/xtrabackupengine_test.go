@@ -0,0 +1,72 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mysqlctl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindXtrabackupPosition(t *testing.T) {
+	testcases := []struct {
+		output string
+		flavor string
+		want   string
+		err    string
+	}{{
+		output: `xtrabackup: Transaction log of lsn (2543172) to (2543181) was copied.
+MySQL binlog position: filename 'vt-bin.000003', position '154', GTID of the last change '00010203-0405-0607-0809-0a0b0c0d0e0f:1-30'
+completed OK!`,
+		flavor: "MySQL56",
+		want:   "00010203-0405-0607-0809-0a0b0c0d0e0f:1-30",
+	}, {
+		// A long GTID set is printed over several lines.
+		output: `MySQL binlog position: filename 'vt-bin.000003', position '154', GTID of the last change '00010203-0405-0607-0809-0a0b0c0d0e0f:1-30,
+00010203-0405-0607-0809-0a0b0c0d0e10:1-5'
+completed OK!`,
+		flavor: "MySQL56",
+		want:   "00010203-0405-0607-0809-0a0b0c0d0e0f:1-30,00010203-0405-0607-0809-0a0b0c0d0e10:1-5",
+	}, {
+		output: `mariabackup: MySQL binlog position: filename 'vt-bin.000003', position '642', GTID of the last change '0-1-100'`,
+		flavor: "MariaDB",
+		want:   "0-1-100",
+	}, {
+		output: `MySQL binlog position: filename 'vt-bin.000003', position '154'`,
+		flavor: "MySQL56",
+		err:    "cannot find the backup position",
+	}, {
+		output: `MySQL binlog position: filename 'vt-bin.000003', position '154', GTID of the last change ''`,
+		flavor: "MySQL56",
+		err:    "the backup position is empty",
+	}}
+	for _, tcase := range testcases {
+		pos, err := findXtrabackupPosition(tcase.output, tcase.flavor)
+		if tcase.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tcase.err) {
+				t.Errorf("findXtrabackupPosition(%q): %v, want %v", tcase.output, err, tcase.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("findXtrabackupPosition(%q) failed: %v", tcase.output, err)
+			continue
+		}
+		if got := pos.GTIDSet.String(); got != tcase.want {
+			t.Errorf("findXtrabackupPosition(%q): %v, want %v", tcase.output, got, tcase.want)
+		}
+	}
+}
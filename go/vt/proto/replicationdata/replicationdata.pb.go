@@ -37,6 +37,8 @@ type Status struct {
 	MasterHost          string `protobuf:"bytes,5,opt,name=master_host,json=masterHost" json:"master_host,omitempty"`
 	MasterPort          int32  `protobuf:"varint,6,opt,name=master_port,json=masterPort" json:"master_port,omitempty"`
 	MasterConnectRetry  int32  `protobuf:"varint,7,opt,name=master_connect_retry,json=masterConnectRetry" json:"master_connect_retry,omitempty"`
+	RelayLogPosition    string `protobuf:"bytes,8,opt,name=relay_log_position,json=relayLogPosition" json:"relay_log_position,omitempty"`
+	SlaveIoConnecting   bool   `protobuf:"varint,9,opt,name=slave_io_connecting,json=slaveIoConnecting" json:"slave_io_connecting,omitempty"`
 }
 
 func (m *Status) Reset()                    { *m = Status{} }
@@ -93,6 +95,20 @@ func (m *Status) GetMasterConnectRetry() int32 {
 	return 0
 }
 
+func (m *Status) GetRelayLogPosition() string {
+	if m != nil {
+		return m.RelayLogPosition
+	}
+	return ""
+}
+
+func (m *Status) GetSlaveIoConnecting() bool {
+	if m != nil {
+		return m.SlaveIoConnecting
+	}
+	return false
+}
+
 func init() {
 	proto.RegisterType((*Status)(nil), "replicationdata.Status")
 }
@@ -100,21 +116,23 @@ func init() {
 func init() { proto.RegisterFile("replicationdata.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 241 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0xd0, 0xc1, 0x4a, 0x03, 0x31,
-	0x10, 0xc6, 0x71, 0x52, 0xed, 0x5a, 0x47, 0xb4, 0x1a, 0x2d, 0x04, 0x2f, 0x2e, 0x9e, 0x82, 0x07,
-	0x11, 0x7d, 0x03, 0xbd, 0xe8, 0x41, 0x90, 0xf4, 0x01, 0x42, 0xba, 0x1b, 0x6c, 0x60, 0xcd, 0x6c,
-	0x33, 0x53, 0xc1, 0xd7, 0xf1, 0x49, 0xa5, 0x49, 0xbb, 0x48, 0x8f, 0xf9, 0xfe, 0xbf, 0x43, 0x18,
-	0x98, 0x25, 0xdf, 0x77, 0xa1, 0x71, 0x1c, 0x30, 0xb6, 0x8e, 0xdd, 0x7d, 0x9f, 0x90, 0x51, 0x4e,
-	0xf7, 0xe6, 0xdb, 0xdf, 0x11, 0x54, 0x73, 0x76, 0xbc, 0x26, 0x79, 0x0d, 0x93, 0x1e, 0x29, 0x6c,
-	0x92, 0x12, 0xb5, 0xd0, 0xc7, 0x66, 0x78, 0x4b, 0x0d, 0xe7, 0xd4, 0xb9, 0x6f, 0x6f, 0x03, 0xda,
-	0xb4, 0x8e, 0x31, 0xc4, 0x4f, 0x35, 0xaa, 0x85, 0x9e, 0x98, 0xb3, 0xbc, 0xbf, 0xa1, 0x29, 0xab,
-	0xbc, 0x83, 0x8b, 0x22, 0x69, 0xd5, 0x0d, 0xf4, 0x20, 0xd3, 0x69, 0x0e, 0xf3, 0x55, 0xb7, 0xb3,
-	0x8f, 0x30, 0x23, 0xdf, 0x60, 0x6c, 0xc9, 0x2e, 0xfc, 0x32, 0xc4, 0xd6, 0x7e, 0x39, 0x62, 0x9f,
-	0xd4, 0x61, 0x2d, 0xf4, 0xa9, 0xb9, 0xdc, 0xc6, 0xe7, 0xdc, 0xde, 0x73, 0x92, 0x37, 0x70, 0x52,
-	0x90, 0x5d, 0x22, 0xb1, 0x1a, 0xe7, 0x8f, 0x42, 0x99, 0x5e, 0x91, 0xf8, 0x1f, 0xe8, 0x31, 0xb1,
-	0xaa, 0x6a, 0xa1, 0xc7, 0x3b, 0xf0, 0x81, 0x89, 0xe5, 0x03, 0x5c, 0x6d, 0x41, 0x83, 0x31, 0xfa,
-	0x86, 0x6d, 0xf2, 0x9c, 0x7e, 0xd4, 0x51, 0x96, 0xb2, 0xb4, 0x97, 0x92, 0xcc, 0xa6, 0x2c, 0xaa,
-	0x7c, 0xbc, 0xa7, 0xbf, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4f, 0x13, 0x7f, 0xc4, 0x55, 0x01, 0x00,
-	0x00,
+	// 276 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0xd1, 0x4a, 0xc3, 0x30,
+	0x14, 0x86, 0xa9, 0x73, 0x73, 0x8b, 0xe8, 0xb6, 0xcc, 0x41, 0xf0, 0xc6, 0xe2, 0x55, 0x11, 0x19,
+	0xa2, 0x6f, 0xe0, 0x6e, 0x14, 0x14, 0x46, 0xf7, 0x00, 0x21, 0x6b, 0x43, 0x17, 0x88, 0x39, 0x5d,
+	0x72, 0x26, 0xec, 0xce, 0x47, 0x97, 0x9e, 0xb4, 0x45, 0xbc, 0xec, 0xff, 0x7d, 0x70, 0xca, 0x17,
+	0xb6, 0xf4, 0xba, 0xb6, 0xa6, 0x50, 0x68, 0xc0, 0x95, 0x0a, 0xd5, 0xaa, 0xf6, 0x80, 0xc0, 0xa7,
+	0xff, 0xe6, 0xfb, 0x9f, 0x01, 0x1b, 0x6d, 0x51, 0xe1, 0x31, 0xf0, 0x5b, 0x36, 0xae, 0x21, 0x98,
+	0x06, 0x89, 0x24, 0x4d, 0xb2, 0x49, 0xde, 0x7f, 0xf3, 0x8c, 0xcd, 0x82, 0x55, 0xdf, 0x5a, 0x1a,
+	0x90, 0xfe, 0xe8, 0x9c, 0x71, 0x95, 0x38, 0x4b, 0x93, 0x6c, 0x9c, 0x5f, 0xd3, 0xfe, 0x0e, 0x79,
+	0x5c, 0xf9, 0x03, 0x9b, 0x47, 0x33, 0x1c, 0x6c, 0xaf, 0x0e, 0x48, 0x9d, 0x12, 0xd8, 0x1e, 0x6c,
+	0xe7, 0x3e, 0xb3, 0x65, 0xd0, 0x05, 0xb8, 0x32, 0xc8, 0x9d, 0xde, 0x1b, 0x57, 0xca, 0x2f, 0x15,
+	0x50, 0x7b, 0x71, 0x9e, 0x26, 0xd9, 0x55, 0xbe, 0x68, 0xe1, 0x2b, 0xb1, 0x4f, 0x42, 0xfc, 0x8e,
+	0x5d, 0x46, 0x49, 0xee, 0x21, 0xa0, 0x18, 0xd2, 0x8f, 0xb2, 0x38, 0xbd, 0x41, 0xc0, 0x3f, 0x42,
+	0x0d, 0x1e, 0xc5, 0x28, 0x4d, 0xb2, 0x61, 0x27, 0x6c, 0xc0, 0x23, 0x7f, 0x62, 0x37, 0xad, 0x50,
+	0x80, 0x73, 0xba, 0x40, 0xe9, 0x35, 0xfa, 0x93, 0xb8, 0x20, 0x93, 0x47, 0xb6, 0x8e, 0x28, 0x6f,
+	0x08, 0x7f, 0x64, 0xdc, 0x6b, 0xab, 0x4e, 0xd2, 0x42, 0x25, 0xfb, 0x46, 0x63, 0x3a, 0x3d, 0x23,
+	0xf2, 0x01, 0xd5, 0xa6, 0x6b, 0xb5, 0x62, 0x8b, 0xbe, 0x55, 0x7b, 0xa1, 0x69, 0x30, 0xa1, 0x06,
+	0xf3, 0x36, 0xd7, 0xba, 0x07, 0xbb, 0x11, 0x3d, 0xcd, 0xcb, 0xef, 0x00, 0x65, 0xaf, 0x87, 0x4e,
+	0xb3, 0x01, 0x00, 0x00,
 }
@@ -1614,6 +1614,9 @@ func (m *PromoteSlaveResponse) GetPosition() string {
 
 type BackupRequest struct {
 	Concurrency int64 `protobuf:"varint,1,opt,name=concurrency" json:"concurrency,omitempty"`
+	// incremental, if set, only backs up the binlogs since the
+	// previous backup, instead of all the data files.
+	Incremental bool `protobuf:"varint,2,opt,name=incremental" json:"incremental,omitempty"`
 }
 
 func (m *BackupRequest) Reset()                    { *m = BackupRequest{} }
@@ -1628,6 +1631,13 @@ func (m *BackupRequest) GetConcurrency() int64 {
 	return 0
 }
 
+func (m *BackupRequest) GetIncremental() bool {
+	if m != nil {
+		return m.Incremental
+	}
+	return false
+}
+
 type BackupResponse struct {
 	Event *logutil.Event `protobuf:"bytes,1,opt,name=event" json:"event,omitempty"`
 }
@@ -1645,6 +1655,14 @@ func (m *BackupResponse) GetEvent() *logutil.Event {
 }
 
 type RestoreFromBackupRequest struct {
+	// restore_to_pos, if set, is the replication position to restore to.
+	// The closest earlier backup is restored and archived binlogs are
+	// replayed up to and including this position.
+	RestoreToPos string `protobuf:"bytes,1,opt,name=restore_to_pos,json=restoreToPos" json:"restore_to_pos,omitempty"`
+	// restore_to_time_ns, if set, is the time to restore to, in
+	// nanoseconds since the epoch. The closest earlier backup is
+	// restored and archived binlogs are replayed up to this time.
+	RestoreToTimeNs int64 `protobuf:"varint,2,opt,name=restore_to_time_ns,json=restoreToTimeNs" json:"restore_to_time_ns,omitempty"`
 }
 
 func (m *RestoreFromBackupRequest) Reset()                    { *m = RestoreFromBackupRequest{} }
@@ -1652,6 +1670,20 @@ func (m *RestoreFromBackupRequest) String() string            { return proto.Com
 func (*RestoreFromBackupRequest) ProtoMessage()               {}
 func (*RestoreFromBackupRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{89} }
 
+func (m *RestoreFromBackupRequest) GetRestoreToPos() string {
+	if m != nil {
+		return m.RestoreToPos
+	}
+	return ""
+}
+
+func (m *RestoreFromBackupRequest) GetRestoreToTimeNs() int64 {
+	if m != nil {
+		return m.RestoreToTimeNs
+	}
+	return 0
+}
+
 type RestoreFromBackupResponse struct {
 	Event *logutil.Event `protobuf:"bytes,1,opt,name=event" json:"event,omitempty"`
 }
@@ -1765,134 +1797,136 @@ func init() {
 func init() { proto.RegisterFile("tabletmanagerdata.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 2049 bytes of a gzipped FileDescriptorProto
+	// 2090 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xcc, 0x59, 0x5b, 0x6f, 0x1b, 0xc7,
-	0xf5, 0x07, 0x45, 0x49, 0x96, 0x0e, 0x2f, 0x22, 0x97, 0xba, 0x50, 0x0a, 0xfe, 0xba, 0xac, 0x9d,
-	0x7f, 0x54, 0x17, 0x55, 0x6a, 0x25, 0x0d, 0x82, 0x04, 0x29, 0xaa, 0xab, 0xed, 0xc4, 0x89, 0x95,
+	0x15, 0x06, 0x45, 0x49, 0x96, 0x0e, 0x2f, 0x22, 0x97, 0xba, 0x50, 0x0a, 0x6a, 0xc9, 0x6b, 0xa7,
+	0x71, 0x1d, 0x54, 0xa9, 0x95, 0x34, 0x08, 0x12, 0xa4, 0xa8, 0xac, 0x8b, 0xed, 0xc4, 0xb1, 0x99,
 	0x95, 0x2f, 0x45, 0x5f, 0x16, 0x43, 0xee, 0x11, 0xb9, 0xd0, 0x72, 0x77, 0x3d, 0x33, 0x2b, 0x89,
-	0x40, 0xd1, 0x8f, 0xd0, 0xb7, 0xbe, 0xf5, 0xad, 0x40, 0xfb, 0xde, 0x0f, 0x93, 0xa2, 0x9f, 0xa4,
-	0x0f, 0x7d, 0x29, 0xe6, 0x46, 0xce, 0x92, 0x94, 0x4d, 0x19, 0x2e, 0xd0, 0x17, 0x81, 0xe7, 0x37,
-	0xe7, 0x3e, 0x67, 0xce, 0x39, 0x0b, 0xc1, 0x1a, 0x27, 0xad, 0x08, 0x79, 0x8f, 0xc4, 0xa4, 0x83,
-	0x34, 0x20, 0x9c, 0xec, 0xa5, 0x34, 0xe1, 0x89, 0x53, 0x1f, 0x3b, 0xd8, 0x28, 0xbd, 0xc9, 0x90,
-	0xf6, 0xd5, 0xf9, 0x46, 0x95, 0x27, 0x69, 0x32, 0xe4, 0xdf, 0x58, 0xa1, 0x98, 0x46, 0x61, 0x9b,
-	0xf0, 0x30, 0x89, 0x2d, 0xb8, 0x12, 0x25, 0x9d, 0x8c, 0x87, 0x91, 0x22, 0xdd, 0x7f, 0x16, 0x60,
-	0xe9, 0x85, 0x50, 0x7c, 0x8c, 0x17, 0x61, 0x1c, 0x0a, 0x66, 0xc7, 0x81, 0xd9, 0x98, 0xf4, 0xb0,
-	0x59, 0xd8, 0x2e, 0xec, 0x2e, 0x7a, 0xf2, 0xb7, 0xb3, 0x0a, 0xf3, 0xac, 0xdd, 0xc5, 0x1e, 0x69,
-	0xce, 0x48, 0x54, 0x53, 0x4e, 0x13, 0xee, 0xb5, 0x93, 0x28, 0xeb, 0xc5, 0xac, 0x59, 0xdc, 0x2e,
-	0xee, 0x2e, 0x7a, 0x86, 0x74, 0xf6, 0xa0, 0x91, 0xd2, 0xb0, 0x47, 0x68, 0xdf, 0xbf, 0xc4, 0xbe,
-	0x6f, 0xb8, 0x66, 0x25, 0x57, 0x5d, 0x1f, 0x7d, 0x87, 0xfd, 0x23, 0xcd, 0xef, 0xc0, 0x2c, 0xef,
-	0xa7, 0xd8, 0x9c, 0x53, 0x56, 0xc5, 0x6f, 0x67, 0x0b, 0x4a, 0xc2, 0x75, 0x3f, 0xc2, 0xb8, 0xc3,
-	0xbb, 0xcd, 0xf9, 0xed, 0xc2, 0xee, 0xac, 0x07, 0x02, 0x7a, 0x26, 0x11, 0xe7, 0x23, 0x58, 0xa4,
-	0xc9, 0xb5, 0xdf, 0x4e, 0xb2, 0x98, 0x37, 0xef, 0xc9, 0xe3, 0x05, 0x9a, 0x5c, 0x1f, 0x09, 0xda,
-	0xfd, 0x6b, 0x01, 0x6a, 0xe7, 0xd2, 0x4d, 0x2b, 0xb8, 0x4f, 0x60, 0x49, 0xc8, 0xb7, 0x08, 0x43,
-	0x5f, 0x47, 0xa4, 0xe2, 0xac, 0x1a, 0x58, 0x89, 0x38, 0xcf, 0x41, 0x65, 0xdc, 0x0f, 0x06, 0xc2,
-	0xac, 0x39, 0xb3, 0x5d, 0xdc, 0x2d, 0xed, 0xbb, 0x7b, 0xe3, 0x97, 0x34, 0x92, 0x44, 0xaf, 0xc6,
-	0xf3, 0x00, 0x13, 0xa9, 0xba, 0x42, 0xca, 0xc2, 0x24, 0x6e, 0x16, 0xa5, 0x45, 0x43, 0x0a, 0x47,
-	0x1d, 0x65, 0xf5, 0xa8, 0x4b, 0xe2, 0x0e, 0x7a, 0xc8, 0xb2, 0x88, 0x3b, 0x4f, 0xa0, 0xd2, 0xc2,
-	0x8b, 0x84, 0xe6, 0x1c, 0x2d, 0xed, 0xdf, 0x9f, 0x60, 0x7d, 0x34, 0x4c, 0xaf, 0xac, 0x24, 0x75,
-	0x2c, 0xa7, 0x50, 0x26, 0x17, 0x1c, 0xa9, 0x6f, 0xdd, 0xe1, 0x94, 0x8a, 0x4a, 0x52, 0x50, 0xc1,
-	0xee, 0xbf, 0x0a, 0x50, 0x7d, 0xc9, 0x90, 0x9e, 0x21, 0xed, 0x85, 0x8c, 0xe9, 0x62, 0xe9, 0x26,
-	0x8c, 0x9b, 0x62, 0x11, 0xbf, 0x05, 0x96, 0x31, 0xa4, 0xba, 0x54, 0xe4, 0x6f, 0xe7, 0xe7, 0x50,
-	0x4f, 0x09, 0x63, 0xd7, 0x09, 0x0d, 0xfc, 0x76, 0x17, 0xdb, 0x97, 0x2c, 0xeb, 0xc9, 0x3c, 0xcc,
-	0x7a, 0x35, 0x73, 0x70, 0xa4, 0x71, 0xe7, 0x47, 0x80, 0x94, 0x86, 0x57, 0x61, 0x84, 0x1d, 0x54,
-	0x25, 0x53, 0xda, 0x7f, 0x34, 0xc1, 0xdb, 0xbc, 0x2f, 0x7b, 0x67, 0x03, 0x99, 0x93, 0x98, 0xd3,
-	0xbe, 0x67, 0x29, 0xd9, 0xf8, 0x06, 0x96, 0x46, 0x8e, 0x9d, 0x1a, 0x14, 0x2f, 0xb1, 0xaf, 0x3d,
-	0x17, 0x3f, 0x9d, 0x65, 0x98, 0xbb, 0x22, 0x51, 0x86, 0xda, 0x73, 0x45, 0x7c, 0x35, 0xf3, 0x65,
-	0xc1, 0xfd, 0xa9, 0x00, 0xe5, 0xe3, 0xd6, 0x3b, 0xe2, 0xae, 0xc2, 0x4c, 0xd0, 0xd2, 0xb2, 0x33,
-	0x41, 0x6b, 0x90, 0x87, 0xa2, 0x95, 0x87, 0xe7, 0x13, 0x42, 0xfb, 0x74, 0x42, 0x68, 0xb6, 0xb1,
-	0xff, 0x66, 0x60, 0x7f, 0x29, 0x40, 0x69, 0x68, 0x89, 0x39, 0xcf, 0xa0, 0x26, 0xfc, 0xf4, 0xd3,
-	0x21, 0xd6, 0x2c, 0x48, 0x2f, 0x77, 0xde, 0x79, 0x01, 0xde, 0x52, 0x96, 0xa3, 0x99, 0x73, 0x0a,
-	0xd5, 0xa0, 0x95, 0xd3, 0xa5, 0x5e, 0xd0, 0xd6, 0x3b, 0x22, 0xf6, 0x2a, 0x81, 0x45, 0x31, 0xf7,
-	0x6b, 0x28, 0x1d, 0x46, 0xe9, 0x59, 0xc2, 0xd4, 0x23, 0xae, 0x41, 0x31, 0x0b, 0x03, 0x19, 0x60,
-	0xc5, 0x13, 0x3f, 0x9d, 0x0d, 0x58, 0x48, 0xf5, 0xa9, 0x8e, 0x71, 0x40, 0xbb, 0x9f, 0x40, 0xe9,
-	0x2c, 0x8c, 0x3b, 0x1e, 0xbe, 0xc9, 0x90, 0x71, 0xf1, 0x0e, 0x53, 0xd2, 0x8f, 0x12, 0x12, 0xe8,
-	0x0c, 0x19, 0xd2, 0xdd, 0x85, 0xb2, 0x62, 0x64, 0x69, 0x12, 0x33, 0x7c, 0x0b, 0xe7, 0x43, 0x28,
-	0x9f, 0x47, 0x88, 0xa9, 0xd1, 0xb9, 0x01, 0x0b, 0x41, 0x46, 0x65, 0xaf, 0x95, 0xac, 0x45, 0x6f,
-	0x40, 0xbb, 0x4b, 0x50, 0xd1, 0xbc, 0x4a, 0xad, 0xfb, 0x8f, 0x02, 0x38, 0x27, 0x37, 0xd8, 0xce,
-	0x38, 0x3e, 0x49, 0x92, 0x4b, 0xa3, 0x63, 0x52, 0xdb, 0xdd, 0x04, 0x48, 0x09, 0x25, 0x3d, 0xe4,
-	0x48, 0x55, 0xee, 0x16, 0x3d, 0x0b, 0x71, 0xce, 0x60, 0x11, 0x6f, 0x38, 0x25, 0x3e, 0xc6, 0x57,
-	0xb2, 0x01, 0x97, 0xf6, 0x3f, 0x9b, 0x90, 0xda, 0x71, 0x6b, 0x7b, 0x27, 0x42, 0xec, 0x24, 0xbe,
-	0x52, 0x05, 0xb5, 0x80, 0x9a, 0xdc, 0xf8, 0x1a, 0x2a, 0xb9, 0xa3, 0x3b, 0x15, 0xd3, 0x05, 0x34,
-	0x72, 0xa6, 0x74, 0x1e, 0xb7, 0xa0, 0x84, 0x37, 0x21, 0xf7, 0x19, 0x27, 0x3c, 0x63, 0x3a, 0x41,
-	0x20, 0xa0, 0x73, 0x89, 0xc8, 0xe9, 0xc2, 0x83, 0x24, 0xe3, 0x83, 0xe9, 0x22, 0x29, 0x8d, 0x23,
-	0x35, 0x4f, 0x48, 0x53, 0xee, 0x15, 0xd4, 0x1e, 0x23, 0x57, 0x4d, 0xc9, 0xa4, 0x6f, 0x15, 0xe6,
-	0x65, 0xe0, 0xaa, 0x5c, 0x17, 0x3d, 0x4d, 0x39, 0xf7, 0xa1, 0x12, 0xc6, 0xed, 0x28, 0x0b, 0xd0,
-	0xbf, 0x0a, 0xf1, 0x9a, 0x49, 0x13, 0x0b, 0x5e, 0x59, 0x83, 0xaf, 0x04, 0xe6, 0x7c, 0x0c, 0x55,
-	0xbc, 0x51, 0x4c, 0x5a, 0x89, 0x9a, 0x66, 0x15, 0x8d, 0xca, 0xee, 0xce, 0x5c, 0x84, 0xba, 0x65,
-	0x57, 0x47, 0x77, 0x06, 0x75, 0xd5, 0x56, 0xad, 0x49, 0x71, 0x97, 0x56, 0x5d, 0x63, 0x23, 0x88,
-	0xbb, 0x06, 0x2b, 0x8f, 0x91, 0x5b, 0xf5, 0xaf, 0x63, 0x74, 0x7f, 0x07, 0xab, 0xa3, 0x07, 0xda,
-	0x89, 0xdf, 0x40, 0x29, 0xff, 0x62, 0x85, 0xf9, 0xcd, 0x09, 0xe6, 0x6d, 0x61, 0x5b, 0xc4, 0x5d,
-	0x06, 0xe7, 0x1c, 0xb9, 0x87, 0x24, 0x78, 0x1e, 0x47, 0x7d, 0x63, 0x71, 0x05, 0x1a, 0x39, 0x54,
-	0x97, 0xf0, 0x10, 0x7e, 0x4d, 0x43, 0x8e, 0x86, 0x7b, 0x15, 0x96, 0xf3, 0xb0, 0x66, 0xff, 0x16,
-	0xea, 0x6a, 0xb2, 0xbd, 0xe8, 0xa7, 0x86, 0xd9, 0xf9, 0x15, 0x94, 0x94, 0x7b, 0xbe, 0x9c, 0xfb,
-	0xc2, 0xe5, 0xea, 0xfe, 0xf2, 0xde, 0x60, 0x8d, 0x91, 0x39, 0xe7, 0x52, 0x02, 0xf8, 0xe0, 0xb7,
-	0xf0, 0xd3, 0xd6, 0x35, 0x74, 0xc8, 0xc3, 0x0b, 0x8a, 0xac, 0x2b, 0x4a, 0xca, 0x76, 0x28, 0x0f,
-	0x6b, 0xf6, 0x35, 0x58, 0xf1, 0xb2, 0xf8, 0x09, 0x92, 0x88, 0x77, 0xe5, 0xd4, 0x31, 0x02, 0x4d,
-	0x58, 0x1d, 0x3d, 0xd0, 0x22, 0x9f, 0x43, 0xf3, 0x69, 0x27, 0x4e, 0x28, 0xaa, 0xc3, 0x13, 0x4a,
-	0x13, 0x9a, 0x6b, 0x29, 0x9c, 0x23, 0x8d, 0x87, 0x8d, 0x42, 0x92, 0xee, 0x47, 0xb0, 0x3e, 0x41,
-	0x4a, 0xab, 0xfc, 0x4a, 0x38, 0x2d, 0xfa, 0x49, 0xbe, 0x92, 0xef, 0x43, 0xe5, 0x9a, 0x84, 0xdc,
-	0x1f, 0x34, 0x34, 0xa5, 0xb3, 0x2c, 0x40, 0xd3, 0x02, 0x55, 0x64, 0xb6, 0xac, 0xd6, 0xb9, 0x0f,
-	0xab, 0x67, 0x14, 0x2f, 0xa2, 0xb0, 0xd3, 0x1d, 0x79, 0x20, 0x62, 0x55, 0x93, 0x89, 0x33, 0x2f,
-	0xc4, 0x90, 0x6e, 0x07, 0xd6, 0xc6, 0x64, 0x74, 0x5d, 0x3d, 0x83, 0xaa, 0xe2, 0xf2, 0xa9, 0x5c,
-	0x4a, 0xcc, 0x30, 0xf8, 0xf8, 0xd6, 0xca, 0xb6, 0x57, 0x18, 0xaf, 0xd2, 0xb6, 0x28, 0xe6, 0xfe,
-	0xbb, 0x00, 0xce, 0x41, 0x9a, 0x46, 0xfd, 0xbc, 0x67, 0x35, 0x28, 0xb2, 0x37, 0x91, 0x69, 0x31,
-	0xec, 0x4d, 0x24, 0x5a, 0xcc, 0x45, 0x42, 0xdb, 0xa8, 0x1f, 0xab, 0x22, 0xc4, 0x0e, 0x41, 0xa2,
-	0x28, 0xb9, 0xf6, 0xad, 0xd5, 0x56, 0x76, 0x86, 0x05, 0xaf, 0x26, 0x0f, 0xbc, 0x21, 0x3e, 0xbe,
-	0x3d, 0xcd, 0x7e, 0xa8, 0xed, 0x69, 0xee, 0x3d, 0xb7, 0xa7, 0xbf, 0x15, 0xa0, 0x91, 0x8b, 0x5e,
-	0xe7, 0xf8, 0x7f, 0x6f, 0xcf, 0xfb, 0x7b, 0x01, 0x9a, 0xba, 0x91, 0x9f, 0x22, 0x6f, 0x77, 0x0f,
-	0xd8, 0x71, 0x6b, 0x70, 0x5b, 0xcb, 0x30, 0x27, 0xbf, 0x3b, 0xa4, 0x9b, 0x65, 0x4f, 0x11, 0xce,
-	0x1a, 0xdc, 0x0b, 0x5a, 0xbe, 0x1c, 0x60, 0xba, 0x87, 0x07, 0xad, 0x1f, 0xc4, 0x08, 0x5b, 0x87,
-	0x85, 0x1e, 0xb9, 0xf1, 0x69, 0x72, 0xcd, 0xf4, 0xbe, 0x77, 0xaf, 0x47, 0x6e, 0xbc, 0xe4, 0x9a,
-	0xc9, 0x5d, 0x3c, 0x64, 0x72, 0xc9, 0x6e, 0x85, 0x71, 0x94, 0x74, 0x98, 0xbc, 0xa4, 0x05, 0xaf,
-	0xaa, 0xe1, 0x43, 0x85, 0x8a, 0x17, 0x41, 0x65, 0xb1, 0xdb, 0x57, 0xb0, 0xe0, 0x95, 0xa9, 0xf5,
-	0x02, 0xdc, 0xc7, 0xb0, 0x3e, 0xc1, 0x67, 0x9d, 0xe3, 0x87, 0x30, 0xaf, 0x0a, 0x58, 0x27, 0xd7,
-	0xd9, 0x53, 0xdf, 0x4e, 0x3f, 0x8a, 0xbf, 0xba, 0x58, 0x35, 0x87, 0xfb, 0xc7, 0x02, 0xfc, 0x5f,
-	0x5e, 0xd3, 0x41, 0x14, 0x89, 0x1d, 0x8b, 0x7d, 0xf8, 0x14, 0x8c, 0x45, 0x36, 0x3b, 0x21, 0xb2,
-	0x67, 0xb0, 0x79, 0x9b, 0x3f, 0xef, 0x11, 0xde, 0x77, 0xa3, 0x77, 0x7b, 0x90, 0xa6, 0x6f, 0x0f,
-	0xcc, 0xf6, 0x7f, 0x26, 0xe7, 0xff, 0x78, 0xd2, 0xa5, 0xb2, 0xf7, 0xf0, 0x4a, 0x8c, 0x9f, 0x88,
-	0x5c, 0xa1, 0xda, 0x08, 0x4c, 0x3b, 0x3e, 0x85, 0x46, 0x0e, 0xd5, 0x8a, 0x3f, 0x15, 0x7b, 0xc1,
-	0x60, 0x97, 0x28, 0xed, 0xaf, 0xed, 0x8d, 0x7e, 0xec, 0x6a, 0x01, 0xcd, 0x26, 0xfa, 0xfd, 0xf7,
-	0x84, 0x71, 0xa4, 0xa6, 0x7f, 0x1a, 0x03, 0x9f, 0xc3, 0xea, 0xe8, 0x81, 0xb6, 0x61, 0x6f, 0x94,
-	0x85, 0x91, 0x8d, 0xd2, 0x81, 0xda, 0x39, 0x4f, 0x52, 0xe9, 0x9a, 0xd1, 0xd4, 0x80, 0xba, 0x85,
-	0xe9, 0x6e, 0xfc, 0x5b, 0x58, 0x1b, 0x80, 0xdf, 0x87, 0x71, 0xd8, 0xcb, 0x7a, 0xd6, 0xca, 0x78,
-	0x9b, 0x7e, 0x67, 0x07, 0x64, 0xb3, 0xf7, 0x79, 0xd8, 0x43, 0xb3, 0x15, 0x15, 0xbd, 0x92, 0xc0,
-	0x5e, 0x28, 0xc8, 0xfd, 0x02, 0x9a, 0xe3, 0x9a, 0xa7, 0x70, 0x5d, 0xba, 0x49, 0x28, 0xcf, 0xf9,
-	0x2e, 0x92, 0x6f, 0x81, 0xda, 0xf9, 0x63, 0xd8, 0x51, 0x33, 0xf8, 0xe4, 0x46, 0xcc, 0x32, 0x12,
+	0x40, 0xd1, 0x9f, 0xd0, 0xb7, 0xbe, 0xf5, 0xad, 0x40, 0xfb, 0xde, 0x1f, 0x93, 0xa2, 0xbf, 0xa4,
+	0x0f, 0x7d, 0x29, 0xe6, 0x46, 0xce, 0x92, 0x94, 0x4c, 0x0b, 0x46, 0xd1, 0x17, 0x83, 0xe7, 0x9b,
+	0x73, 0x9f, 0x33, 0xe7, 0x9c, 0xb5, 0x60, 0x83, 0x93, 0x76, 0x84, 0xbc, 0x4f, 0x62, 0xd2, 0x45,
+	0x1a, 0x10, 0x4e, 0x76, 0x53, 0x9a, 0xf0, 0xc4, 0xa9, 0x4f, 0x1c, 0x6c, 0x95, 0xde, 0x66, 0x48,
+	0x07, 0xea, 0x7c, 0xab, 0xca, 0x93, 0x34, 0x19, 0xf1, 0x6f, 0xad, 0x51, 0x4c, 0xa3, 0xb0, 0x43,
+	0x78, 0x98, 0xc4, 0x16, 0x5c, 0x89, 0x92, 0x6e, 0xc6, 0xc3, 0x48, 0x91, 0xee, 0xbf, 0x0a, 0xb0,
+	0xf2, 0x52, 0x28, 0x3e, 0xc4, 0xd3, 0x30, 0x0e, 0x05, 0xb3, 0xe3, 0xc0, 0x7c, 0x4c, 0xfa, 0xd8,
+	0x2c, 0xec, 0x14, 0xee, 0x2f, 0x7b, 0xf2, 0xb7, 0xb3, 0x0e, 0x8b, 0xac, 0xd3, 0xc3, 0x3e, 0x69,
+	0xce, 0x49, 0x54, 0x53, 0x4e, 0x13, 0x6e, 0x75, 0x92, 0x28, 0xeb, 0xc7, 0xac, 0x59, 0xdc, 0x29,
+	0xde, 0x5f, 0xf6, 0x0c, 0xe9, 0xec, 0x42, 0x23, 0xa5, 0x61, 0x9f, 0xd0, 0x81, 0x7f, 0x86, 0x03,
+	0xdf, 0x70, 0xcd, 0x4b, 0xae, 0xba, 0x3e, 0xfa, 0x1e, 0x07, 0x07, 0x9a, 0xdf, 0x81, 0x79, 0x3e,
+	0x48, 0xb1, 0xb9, 0xa0, 0xac, 0x8a, 0xdf, 0xce, 0x36, 0x94, 0x84, 0xeb, 0x7e, 0x84, 0x71, 0x97,
+	0xf7, 0x9a, 0x8b, 0x3b, 0x85, 0xfb, 0xf3, 0x1e, 0x08, 0xe8, 0x99, 0x44, 0x9c, 0x8f, 0x60, 0x99,
+	0x26, 0x17, 0x7e, 0x27, 0xc9, 0x62, 0xde, 0xbc, 0x25, 0x8f, 0x97, 0x68, 0x72, 0x71, 0x20, 0x68,
+	0xf7, 0x6f, 0x05, 0xa8, 0x9d, 0x48, 0x37, 0xad, 0xe0, 0x3e, 0x81, 0x15, 0x21, 0xdf, 0x26, 0x0c,
+	0x7d, 0x1d, 0x91, 0x8a, 0xb3, 0x6a, 0x60, 0x25, 0xe2, 0xbc, 0x00, 0x95, 0x71, 0x3f, 0x18, 0x0a,
+	0xb3, 0xe6, 0xdc, 0x4e, 0xf1, 0x7e, 0x69, 0xcf, 0xdd, 0x9d, 0xbc, 0xa4, 0xb1, 0x24, 0x7a, 0x35,
+	0x9e, 0x07, 0x98, 0x48, 0xd5, 0x39, 0x52, 0x16, 0x26, 0x71, 0xb3, 0x28, 0x2d, 0x1a, 0x52, 0x38,
+	0xea, 0x28, 0xab, 0x07, 0x3d, 0x12, 0x77, 0xd1, 0x43, 0x96, 0x45, 0xdc, 0x79, 0x02, 0x95, 0x36,
+	0x9e, 0x26, 0x34, 0xe7, 0x68, 0x69, 0xef, 0xee, 0x14, 0xeb, 0xe3, 0x61, 0x7a, 0x65, 0x25, 0xa9,
+	0x63, 0x39, 0x86, 0x32, 0x39, 0xe5, 0x48, 0x7d, 0xeb, 0x0e, 0x67, 0x54, 0x54, 0x92, 0x82, 0x0a,
+	0x76, 0xff, 0x5d, 0x80, 0xea, 0x2b, 0x86, 0xb4, 0x85, 0xb4, 0x1f, 0x32, 0xa6, 0x8b, 0xa5, 0x97,
+	0x30, 0x6e, 0x8a, 0x45, 0xfc, 0x16, 0x58, 0xc6, 0x90, 0xea, 0x52, 0x91, 0xbf, 0x9d, 0x4f, 0xa1,
+	0x9e, 0x12, 0xc6, 0x2e, 0x12, 0x1a, 0xf8, 0x9d, 0x1e, 0x76, 0xce, 0x58, 0xd6, 0x97, 0x79, 0x98,
+	0xf7, 0x6a, 0xe6, 0xe0, 0x40, 0xe3, 0xce, 0x8f, 0x00, 0x29, 0x0d, 0xcf, 0xc3, 0x08, 0xbb, 0xa8,
+	0x4a, 0xa6, 0xb4, 0xf7, 0x70, 0x8a, 0xb7, 0x79, 0x5f, 0x76, 0x5b, 0x43, 0x99, 0xa3, 0x98, 0xd3,
+	0x81, 0x67, 0x29, 0xd9, 0xfa, 0x16, 0x56, 0xc6, 0x8e, 0x9d, 0x1a, 0x14, 0xcf, 0x70, 0xa0, 0x3d,
+	0x17, 0x3f, 0x9d, 0x55, 0x58, 0x38, 0x27, 0x51, 0x86, 0xda, 0x73, 0x45, 0x7c, 0x3d, 0xf7, 0x55,
+	0xc1, 0xfd, 0xa9, 0x00, 0xe5, 0xc3, 0xf6, 0x3b, 0xe2, 0xae, 0xc2, 0x5c, 0xd0, 0xd6, 0xb2, 0x73,
+	0x41, 0x7b, 0x98, 0x87, 0xa2, 0x95, 0x87, 0x17, 0x53, 0x42, 0xfb, 0x6c, 0x4a, 0x68, 0x87, 0xed,
+	0xff, 0x4d, 0x60, 0x7f, 0x2d, 0x40, 0x69, 0x64, 0x89, 0x39, 0xcf, 0xa0, 0x26, 0xfc, 0xf4, 0xd3,
+	0x11, 0xd6, 0x2c, 0x48, 0x2f, 0xef, 0xbc, 0xf3, 0x02, 0xbc, 0x95, 0x2c, 0x47, 0x33, 0xe7, 0x18,
+	0xaa, 0x41, 0x3b, 0xa7, 0x4b, 0xbd, 0xa0, 0xed, 0x77, 0x44, 0xec, 0x55, 0x02, 0x8b, 0x62, 0xee,
+	0x37, 0x50, 0x7a, 0x14, 0xa5, 0xad, 0x84, 0xa9, 0x47, 0x5c, 0x83, 0x62, 0x16, 0x06, 0x32, 0xc0,
+	0x8a, 0x27, 0x7e, 0x3a, 0x5b, 0xb0, 0x94, 0xea, 0x53, 0x1d, 0xe3, 0x90, 0x76, 0x3f, 0x81, 0x52,
+	0x2b, 0x8c, 0xbb, 0x1e, 0xbe, 0xcd, 0x90, 0x71, 0xf1, 0x0e, 0x53, 0x32, 0x88, 0x12, 0x12, 0xe8,
+	0x0c, 0x19, 0xd2, 0xbd, 0x0f, 0x65, 0xc5, 0xc8, 0xd2, 0x24, 0x66, 0x78, 0x0d, 0xe7, 0x03, 0x28,
+	0x9f, 0x44, 0x88, 0xa9, 0xd1, 0xb9, 0x05, 0x4b, 0x41, 0x46, 0x65, 0xaf, 0x95, 0xac, 0x45, 0x6f,
+	0x48, 0xbb, 0x2b, 0x50, 0xd1, 0xbc, 0x4a, 0xad, 0xfb, 0xcf, 0x02, 0x38, 0x47, 0x97, 0xd8, 0xc9,
+	0x38, 0x3e, 0x49, 0x92, 0x33, 0xa3, 0x63, 0x5a, 0xdb, 0xbd, 0x0d, 0x90, 0x12, 0x4a, 0xfa, 0xc8,
+	0x91, 0xaa, 0xdc, 0x2d, 0x7b, 0x16, 0xe2, 0xb4, 0x60, 0x19, 0x2f, 0x39, 0x25, 0x3e, 0xc6, 0xe7,
+	0xb2, 0x01, 0x97, 0xf6, 0x3e, 0x9f, 0x92, 0xda, 0x49, 0x6b, 0xbb, 0x47, 0x42, 0xec, 0x28, 0x3e,
+	0x57, 0x05, 0xb5, 0x84, 0x9a, 0xdc, 0xfa, 0x06, 0x2a, 0xb9, 0xa3, 0xf7, 0x2a, 0xa6, 0x53, 0x68,
+	0xe4, 0x4c, 0xe9, 0x3c, 0x6e, 0x43, 0x09, 0x2f, 0x43, 0xee, 0x33, 0x4e, 0x78, 0xc6, 0x74, 0x82,
+	0x40, 0x40, 0x27, 0x12, 0x91, 0xd3, 0x85, 0x07, 0x49, 0xc6, 0x87, 0xd3, 0x45, 0x52, 0x1a, 0x47,
+	0x6a, 0x9e, 0x90, 0xa6, 0xdc, 0x73, 0xa8, 0x3d, 0x46, 0xae, 0x9a, 0x92, 0x49, 0xdf, 0x3a, 0x2c,
+	0xca, 0xc0, 0x55, 0xb9, 0x2e, 0x7b, 0x9a, 0x72, 0xee, 0x42, 0x25, 0x8c, 0x3b, 0x51, 0x16, 0xa0,
+	0x7f, 0x1e, 0xe2, 0x05, 0x93, 0x26, 0x96, 0xbc, 0xb2, 0x06, 0x5f, 0x0b, 0xcc, 0xf9, 0x18, 0xaa,
+	0x78, 0xa9, 0x98, 0xb4, 0x12, 0x35, 0xcd, 0x2a, 0x1a, 0x95, 0xdd, 0x9d, 0xb9, 0x08, 0x75, 0xcb,
+	0xae, 0x8e, 0xae, 0x05, 0x75, 0xd5, 0x56, 0xad, 0x49, 0xf1, 0x3e, 0xad, 0xba, 0xc6, 0xc6, 0x10,
+	0x77, 0x03, 0xd6, 0x1e, 0x23, 0xb7, 0xea, 0x5f, 0xc7, 0xe8, 0xfe, 0x1e, 0xd6, 0xc7, 0x0f, 0xb4,
+	0x13, 0xbf, 0x85, 0x52, 0xfe, 0xc5, 0x0a, 0xf3, 0xb7, 0xa7, 0x98, 0xb7, 0x85, 0x6d, 0x11, 0x77,
+	0x15, 0x9c, 0x13, 0xe4, 0x1e, 0x92, 0xe0, 0x45, 0x1c, 0x0d, 0x8c, 0xc5, 0x35, 0x68, 0xe4, 0x50,
+	0x5d, 0xc2, 0x23, 0xf8, 0x0d, 0x0d, 0x39, 0x1a, 0xee, 0x75, 0x58, 0xcd, 0xc3, 0x9a, 0xfd, 0x3b,
+	0xa8, 0xab, 0xc9, 0xf6, 0x72, 0x90, 0x1a, 0x66, 0xe7, 0xd7, 0x50, 0x52, 0xee, 0xf9, 0x72, 0xee,
+	0x0b, 0x97, 0xab, 0x7b, 0xab, 0xbb, 0xc3, 0x35, 0x46, 0xe6, 0x9c, 0x4b, 0x09, 0xe0, 0xc3, 0xdf,
+	0xc2, 0x4f, 0x5b, 0xd7, 0xc8, 0x21, 0x0f, 0x4f, 0x29, 0xb2, 0x9e, 0x28, 0x29, 0xdb, 0xa1, 0x3c,
+	0xac, 0xd9, 0x37, 0x60, 0xcd, 0xcb, 0xe2, 0x27, 0x48, 0x22, 0xde, 0x93, 0x53, 0xc7, 0x08, 0x34,
+	0x61, 0x7d, 0xfc, 0x40, 0x8b, 0x7c, 0x01, 0xcd, 0xa7, 0xdd, 0x38, 0xa1, 0xa8, 0x0e, 0x8f, 0x28,
+	0x4d, 0x68, 0xae, 0xa5, 0x70, 0x8e, 0x34, 0x1e, 0x35, 0x0a, 0x49, 0xba, 0x1f, 0xc1, 0xe6, 0x14,
+	0x29, 0xad, 0xf2, 0x6b, 0xe1, 0xb4, 0xe8, 0x27, 0xf9, 0x4a, 0xbe, 0x0b, 0x95, 0x0b, 0x12, 0x72,
+	0x7f, 0xd8, 0xd0, 0x94, 0xce, 0xb2, 0x00, 0x4d, 0x0b, 0x54, 0x91, 0xd9, 0xb2, 0x5a, 0xe7, 0x1e,
+	0xac, 0xb7, 0x28, 0x9e, 0x46, 0x61, 0xb7, 0x37, 0xf6, 0x40, 0xc4, 0xaa, 0x26, 0x13, 0x67, 0x5e,
+	0x88, 0x21, 0xdd, 0x2e, 0x6c, 0x4c, 0xc8, 0xe8, 0xba, 0x7a, 0x06, 0x55, 0xc5, 0xe5, 0x53, 0xb9,
+	0x94, 0x98, 0x61, 0xf0, 0xf1, 0x95, 0x95, 0x6d, 0xaf, 0x30, 0x5e, 0xa5, 0x63, 0x51, 0xcc, 0xfd,
+	0x4f, 0x01, 0x9c, 0xfd, 0x34, 0x8d, 0x06, 0x79, 0xcf, 0x6a, 0x50, 0x64, 0x6f, 0x23, 0xd3, 0x62,
+	0xd8, 0xdb, 0x48, 0xb4, 0x98, 0xd3, 0x84, 0x76, 0x50, 0x3f, 0x56, 0x45, 0x88, 0x1d, 0x82, 0x44,
+	0x51, 0x72, 0xe1, 0x5b, 0xab, 0xad, 0xec, 0x0c, 0x4b, 0x5e, 0x4d, 0x1e, 0x78, 0x23, 0x7c, 0x72,
+	0x7b, 0x9a, 0xff, 0x50, 0xdb, 0xd3, 0xc2, 0x0d, 0xb7, 0xa7, 0xbf, 0x17, 0xa0, 0x91, 0x8b, 0x5e,
+	0xe7, 0xf8, 0xff, 0x6f, 0xcf, 0xfb, 0x47, 0x01, 0x9a, 0xba, 0x91, 0x1f, 0x23, 0xef, 0xf4, 0xf6,
+	0xd9, 0x61, 0x7b, 0x78, 0x5b, 0xab, 0xb0, 0x20, 0xbf, 0x3b, 0xa4, 0x9b, 0x65, 0x4f, 0x11, 0xce,
+	0x06, 0xdc, 0x0a, 0xda, 0xbe, 0x1c, 0x60, 0xba, 0x87, 0x07, 0xed, 0xe7, 0x62, 0x84, 0x6d, 0xc2,
+	0x52, 0x9f, 0x5c, 0xfa, 0x34, 0xb9, 0x60, 0x7a, 0xdf, 0xbb, 0xd5, 0x27, 0x97, 0x5e, 0x72, 0xc1,
+	0xe4, 0x2e, 0x1e, 0x32, 0xb9, 0x64, 0xb7, 0xc3, 0x38, 0x4a, 0xba, 0x4c, 0x5e, 0xd2, 0x92, 0x57,
+	0xd5, 0xf0, 0x23, 0x85, 0x8a, 0x17, 0x41, 0x65, 0xb1, 0xdb, 0x57, 0xb0, 0xe4, 0x95, 0xa9, 0xf5,
+	0x02, 0xdc, 0xc7, 0xb0, 0x39, 0xc5, 0x67, 0x9d, 0xe3, 0x07, 0xb0, 0xa8, 0x0a, 0x58, 0x27, 0xd7,
+	0xd9, 0x55, 0xdf, 0x4e, 0x3f, 0x8a, 0x7f, 0x75, 0xb1, 0x6a, 0x0e, 0xf7, 0x4f, 0x05, 0xf8, 0x59,
+	0x5e, 0xd3, 0x7e, 0x14, 0x89, 0x1d, 0x8b, 0x7d, 0xf8, 0x14, 0x4c, 0x44, 0x36, 0x3f, 0x25, 0xb2,
+	0x67, 0x70, 0xfb, 0x2a, 0x7f, 0x6e, 0x10, 0xde, 0xf7, 0xe3, 0x77, 0xbb, 0x9f, 0xa6, 0xd7, 0x07,
+	0x66, 0xfb, 0x3f, 0x97, 0xf3, 0x7f, 0x32, 0xe9, 0x52, 0xd9, 0x0d, 0xbc, 0x12, 0xe3, 0x27, 0x22,
+	0xe7, 0xa8, 0x36, 0x02, 0xd3, 0x8e, 0x8f, 0xa1, 0x91, 0x43, 0xb5, 0xe2, 0xcf, 0xc4, 0x5e, 0x30,
+	0xdc, 0x25, 0x4a, 0x7b, 0x1b, 0xbb, 0xe3, 0x1f, 0xbb, 0x5a, 0x40, 0xb3, 0x89, 0x7e, 0xff, 0x03,
+	0x61, 0x1c, 0xa9, 0xe9, 0x9f, 0xc6, 0xc0, 0x17, 0xb0, 0x3e, 0x7e, 0xa0, 0x6d, 0xd8, 0x1b, 0x65,
+	0x61, 0x6c, 0xa3, 0x74, 0xa0, 0x76, 0xc2, 0x93, 0x54, 0xba, 0x66, 0x34, 0x35, 0xa0, 0x6e, 0x61,
+	0xba, 0x1b, 0xff, 0x0e, 0x36, 0x86, 0xe0, 0x0f, 0x61, 0x1c, 0xf6, 0xb3, 0xbe, 0xb5, 0x32, 0x5e,
+	0xa5, 0xdf, 0xb9, 0x03, 0xb2, 0xd9, 0xfb, 0x3c, 0xec, 0xa3, 0xd9, 0x8a, 0x8a, 0x5e, 0x49, 0x60,
+	0x2f, 0x15, 0xe4, 0x7e, 0x09, 0xcd, 0x49, 0xcd, 0x33, 0xb8, 0x2e, 0xdd, 0x24, 0x94, 0xe7, 0x7c,
+	0x17, 0xc9, 0xb7, 0x40, 0xed, 0xfc, 0x21, 0xdc, 0x51, 0x33, 0xf8, 0xe8, 0x52, 0xcc, 0x32, 0x12,
 	0x89, 0x05, 0x20, 0x25, 0x14, 0x63, 0x8e, 0x81, 0x09, 0x43, 0xee, 0x76, 0xea, 0xd8, 0x0f, 0xcd,
-	0x9e, 0x0c, 0x06, 0x7a, 0x1a, 0xb8, 0x0f, 0xc0, 0x7d, 0x9b, 0x16, 0x6d, 0x6b, 0x1b, 0x36, 0x47,
-	0xb9, 0x4e, 0x22, 0x6c, 0x0f, 0x0d, 0xb9, 0x3b, 0xb0, 0x75, 0x2b, 0x87, 0x56, 0xe2, 0xa8, 0xb5,
-	0x50, 0x04, 0x31, 0xa8, 0xa0, 0x9f, 0xa9, 0x95, 0x4d, 0x63, 0x3a, 0x41, 0xcb, 0x30, 0x47, 0x82,
-	0x80, 0x9a, 0x41, 0xa8, 0x08, 0xf7, 0x0f, 0xb0, 0xfa, 0x9a, 0x84, 0xdc, 0xfa, 0xd0, 0x30, 0x41,
-	0x1e, 0x40, 0xb9, 0x15, 0xa5, 0xf9, 0x81, 0x3c, 0x79, 0xbd, 0xb2, 0x85, 0x4b, 0x2d, 0xeb, 0x93,
-	0x65, 0x8a, 0x2b, 0x5d, 0x87, 0xb5, 0x31, 0xfb, 0x3a, 0xb2, 0x1a, 0x54, 0xc5, 0x6d, 0x1f, 0x46,
-	0xe6, 0xa5, 0xba, 0xaf, 0x60, 0x69, 0x80, 0xe8, 0xa8, 0x8e, 0xa0, 0x62, 0x7b, 0x69, 0x46, 0xf5,
-	0xbb, 0xdc, 0x2c, 0x5b, 0x6e, 0x32, 0xb7, 0x2e, 0xf4, 0x12, 0xca, 0x2d, 0x53, 0xb2, 0xda, 0x0d,
-	0xa4, 0x1d, 0xfa, 0x3d, 0x38, 0x5e, 0x16, 0x1f, 0x46, 0xe9, 0xcb, 0x98, 0x87, 0x91, 0xc9, 0xd3,
-	0x87, 0xf0, 0x60, 0x9a, 0x4c, 0x3d, 0x82, 0x46, 0xce, 0xfa, 0x14, 0x75, 0xbf, 0x0e, 0x6b, 0x1e,
-	0x32, 0xb1, 0x9c, 0x0e, 0x1a, 0x85, 0x89, 0x6f, 0x03, 0x9a, 0xe3, 0x47, 0x3a, 0xce, 0x06, 0xd4,
-	0x9f, 0xc6, 0x21, 0x57, 0x3d, 0xc2, 0x08, 0xfc, 0x12, 0x1c, 0x1b, 0x9c, 0xc2, 0xfa, 0x4f, 0x05,
-	0xd8, 0x3c, 0x4b, 0xd2, 0x2c, 0x92, 0x4b, 0xa8, 0xaa, 0xfe, 0x6f, 0x93, 0x4c, 0x94, 0xb1, 0xc9,
-	0xdd, 0xff, 0xc3, 0x92, 0x88, 0xd8, 0x6f, 0x53, 0x24, 0x1c, 0x03, 0x3f, 0x36, 0x1f, 0x4a, 0x15,
-	0x01, 0x1f, 0x29, 0xf4, 0x07, 0x26, 0x1e, 0x1c, 0x69, 0x0b, 0xa5, 0xf6, 0xa4, 0x01, 0x05, 0xc9,
-	0x69, 0xf3, 0x25, 0x94, 0x7b, 0xd2, 0x33, 0x9f, 0x44, 0x21, 0x51, 0x13, 0xa7, 0xb4, 0xbf, 0x32,
-	0xba, 0x58, 0x1f, 0x88, 0x43, 0xaf, 0xa4, 0x58, 0x25, 0xe1, 0x3c, 0x82, 0x65, 0xab, 0x8f, 0x0e,
-	0xcb, 0x7d, 0x56, 0xda, 0x68, 0x58, 0x67, 0x83, 0x35, 0x74, 0x07, 0xb6, 0x6e, 0x8d, 0x4b, 0xa7,
-	0xf0, 0xcf, 0x05, 0xa8, 0x89, 0x74, 0xd9, 0x1d, 0xc7, 0xf9, 0x05, 0xcc, 0x2b, 0x6e, 0xfd, 0x96,
-	0x6e, 0x71, 0x4f, 0x33, 0xdd, 0xea, 0xd9, 0xcc, 0xad, 0x9e, 0x4d, 0xca, 0x67, 0x71, 0x42, 0x3e,
-	0xcd, 0x0d, 0xe7, 0x5b, 0xdf, 0x0a, 0x34, 0x8e, 0xb1, 0x97, 0x70, 0xcc, 0x5f, 0xfc, 0x3e, 0x2c,
-	0xe7, 0xe1, 0x29, 0xae, 0xfe, 0x1b, 0xd8, 0x3a, 0xa3, 0x89, 0x10, 0x92, 0x26, 0x5e, 0x77, 0x31,
-	0x3e, 0x22, 0x59, 0xa7, 0xcb, 0x5f, 0xa6, 0x53, 0x8c, 0x02, 0xf7, 0xd7, 0xb0, 0x7d, 0xbb, 0xf8,
-	0x74, 0x75, 0xaf, 0x04, 0x09, 0xd3, 0x7a, 0x02, 0xab, 0xee, 0xc7, 0x8f, 0x74, 0x02, 0xfe, 0x54,
-	0x80, 0xda, 0x39, 0xe6, 0xeb, 0xfe, 0xae, 0x97, 0x36, 0xe1, 0x06, 0x66, 0x26, 0x55, 0xf4, 0x43,
-	0xa8, 0xcb, 0xfd, 0xde, 0x67, 0xa2, 0xcb, 0xf8, 0x4c, 0xf8, 0xa4, 0xd7, 0xfa, 0x25, 0x79, 0x30,
-	0x9c, 0x4d, 0x72, 0x7c, 0xe1, 0xc8, 0xcb, 0x73, 0x9f, 0x0e, 0x03, 0xf1, 0x50, 0x2a, 0x19, 0xce,
-	0xa7, 0xbb, 0xf9, 0x2c, 0xbe, 0xd7, 0x26, 0xa8, 0xd2, 0x76, 0x1e, 0x80, 0x2b, 0x7a, 0xae, 0xd5,
-	0x27, 0x0e, 0xe2, 0x40, 0x4c, 0x97, 0xdc, 0xce, 0xf2, 0x0a, 0xee, 0xbf, 0x95, 0xeb, 0x7d, 0x77,
-	0x98, 0x15, 0x68, 0xd8, 0x95, 0x60, 0xd5, 0x64, 0x1e, 0x9e, 0xa2, 0x28, 0x1e, 0x41, 0xe5, 0x90,
-	0xb4, 0x2f, 0xb3, 0x41, 0x05, 0x6e, 0x43, 0xa9, 0x9d, 0xc4, 0xed, 0x8c, 0x52, 0x8c, 0xdb, 0x7d,
-	0xdd, 0x78, 0x6c, 0xc8, 0xfd, 0x02, 0xaa, 0x46, 0x44, 0x1b, 0x78, 0x00, 0x73, 0x78, 0x35, 0x4c,
-	0x6c, 0x75, 0xcf, 0xfc, 0x67, 0xe1, 0x44, 0xa0, 0x9e, 0x3a, 0xd4, 0xcd, 0x95, 0x27, 0x14, 0x4f,
-	0x69, 0xd2, 0xcb, 0x59, 0x75, 0x0f, 0x60, 0x7d, 0xc2, 0xd9, 0x5d, 0xd4, 0xb7, 0xe6, 0xe5, 0xbf,
-	0x31, 0x3e, 0xfb, 0x4f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xe5, 0x67, 0xfd, 0x4a, 0x37, 0x19, 0x00,
-	0x00,
+	0x9e, 0x0c, 0x06, 0x7a, 0x1a, 0xb8, 0xf7, 0xc0, 0xbd, 0x4e, 0x8b, 0xb6, 0xb5, 0x03, 0xb7, 0xc7,
+	0xb9, 0x8e, 0x22, 0xec, 0x8c, 0x0c, 0xb9, 0x77, 0x60, 0xfb, 0x4a, 0x0e, 0xad, 0xc4, 0x51, 0x6b,
+	0xa1, 0x08, 0x62, 0x58, 0x41, 0xbf, 0x80, 0xba, 0x85, 0xe9, 0x04, 0xad, 0xc2, 0x02, 0x09, 0x02,
+	0x6a, 0x06, 0xa1, 0x22, 0xdc, 0x3f, 0xc2, 0xfa, 0x1b, 0x12, 0x72, 0xeb, 0x43, 0xc3, 0x04, 0xb9,
+	0x0f, 0xe5, 0x76, 0x94, 0xe6, 0x07, 0xf2, 0xf4, 0xf5, 0xca, 0x16, 0x2e, 0xb5, 0x47, 0xc4, 0x2c,
+	0x57, 0xba, 0x09, 0x1b, 0x13, 0xf6, 0x75, 0x64, 0x35, 0xa8, 0x8a, 0xdb, 0x7e, 0x14, 0x99, 0x97,
+	0xea, 0xbe, 0x86, 0x95, 0x21, 0xa2, 0xa3, 0x3a, 0x80, 0x8a, 0xed, 0xa5, 0x19, 0xd5, 0xef, 0x72,
+	0xb3, 0x6c, 0xb9, 0xc9, 0xdc, 0xba, 0xd0, 0x4b, 0x28, 0xb7, 0x4c, 0xc9, 0x6a, 0x37, 0x90, 0x76,
+	0xe8, 0x0f, 0xe0, 0x78, 0x59, 0xfc, 0x28, 0x4a, 0x5f, 0xc5, 0x3c, 0x8c, 0x4c, 0x9e, 0x3e, 0x84,
+	0x07, 0xb3, 0x64, 0xea, 0x21, 0x34, 0x72, 0xd6, 0x67, 0xa8, 0xfb, 0x4d, 0xd8, 0xf0, 0x90, 0x21,
+	0xb7, 0x56, 0x04, 0x13, 0xdf, 0x16, 0x34, 0x27, 0x8f, 0x74, 0x9c, 0x0d, 0xa8, 0x3f, 0x8d, 0x43,
+	0xae, 0x7a, 0x84, 0x11, 0xf8, 0x15, 0x38, 0x36, 0x38, 0x83, 0xf5, 0x9f, 0x0a, 0x70, 0xbb, 0x95,
+	0xa4, 0x59, 0x24, 0x97, 0x50, 0x55, 0xfd, 0xdf, 0x25, 0x99, 0x28, 0x63, 0x93, 0xbb, 0x9f, 0xc3,
+	0x8a, 0x88, 0xd8, 0xef, 0x50, 0x24, 0x1c, 0x03, 0x3f, 0x36, 0x1f, 0x4a, 0x15, 0x01, 0x1f, 0x28,
+	0xf4, 0x39, 0x13, 0x0f, 0x8e, 0x74, 0x84, 0x52, 0x7b, 0xd2, 0x80, 0x82, 0xe4, 0xb4, 0xf9, 0x0a,
+	0xca, 0x7d, 0xe9, 0x99, 0x4f, 0xa2, 0x90, 0xa8, 0x89, 0x53, 0xda, 0x5b, 0x1b, 0x5f, 0xac, 0xf7,
+	0xc5, 0xa1, 0x57, 0x52, 0xac, 0x92, 0x70, 0x1e, 0xc2, 0xaa, 0xd5, 0x47, 0x47, 0xe5, 0x3e, 0x2f,
+	0x6d, 0x34, 0xac, 0xb3, 0xe1, 0x1a, 0x7a, 0x07, 0xb6, 0xaf, 0x8c, 0x4b, 0xa7, 0xf0, 0x2f, 0x05,
+	0xa8, 0x89, 0x74, 0xd9, 0x1d, 0xc7, 0xf9, 0x25, 0x2c, 0x2a, 0xee, 0x66, 0xe1, 0x3a, 0xf7, 0x34,
+	0xd3, 0x95, 0x9e, 0xcd, 0x5d, 0xe9, 0xd9, 0xb4, 0x7c, 0x16, 0xa7, 0xe4, 0xd3, 0xdc, 0x70, 0xbe,
+	0xf5, 0xad, 0x41, 0xe3, 0x10, 0xfb, 0x09, 0xc7, 0xfc, 0xc5, 0xef, 0xc1, 0x6a, 0x1e, 0x9e, 0xe1,
+	0xea, 0xbf, 0x85, 0xed, 0x16, 0x4d, 0x84, 0x90, 0x34, 0xf1, 0xa6, 0x87, 0xf1, 0x01, 0xc9, 0xba,
+	0x3d, 0xfe, 0x2a, 0x9d, 0x61, 0x14, 0xb8, 0xbf, 0x81, 0x9d, 0xab, 0xc5, 0x67, 0xab, 0x7b, 0x25,
+	0x48, 0x98, 0xd6, 0x13, 0x58, 0x75, 0x3f, 0x79, 0xa4, 0x13, 0xf0, 0x67, 0xf1, 0x7f, 0xa7, 0x98,
+	0xaf, 0xfb, 0xf7, 0xbd, 0xb4, 0x29, 0x37, 0x30, 0x37, 0xad, 0xa2, 0x1f, 0x40, 0x5d, 0xee, 0xf7,
+	0xe2, 0xff, 0x07, 0x28, 0xf7, 0x99, 0xf0, 0x49, 0xaf, 0xf5, 0x2b, 0xf2, 0x60, 0x34, 0x9b, 0xe4,
+	0xf8, 0xc2, 0xb1, 0x97, 0xe7, 0x3e, 0x1d, 0x05, 0xe2, 0xa1, 0x54, 0x82, 0xc1, 0xcd, 0x7c, 0x16,
+	0xdf, 0x6b, 0x53, 0x54, 0x69, 0x3b, 0xf7, 0xc0, 0x15, 0x3d, 0xd7, 0xea, 0x13, 0xfb, 0x71, 0x20,
+	0xa6, 0x4b, 0x6e, 0x67, 0x79, 0x0d, 0x77, 0xaf, 0xe5, 0xba, 0xe9, 0x0e, 0xb3, 0x06, 0x0d, 0xbb,
+	0x12, 0xac, 0x9a, 0xcc, 0xc3, 0x33, 0x14, 0xc5, 0x09, 0x54, 0x1e, 0x91, 0xce, 0x59, 0x36, 0xac,
+	0xc0, 0x1d, 0x28, 0x75, 0x92, 0xb8, 0x93, 0x51, 0x8a, 0x71, 0x67, 0xa0, 0x1b, 0x8f, 0x0d, 0x09,
+	0x8e, 0x30, 0xee, 0x50, 0xec, 0x63, 0xcc, 0x49, 0xa4, 0xbf, 0xcb, 0x6c, 0xc8, 0xfd, 0x12, 0xaa,
+	0x46, 0xa9, 0x76, 0xe1, 0x1e, 0x2c, 0xe0, 0xf9, 0x28, 0xf5, 0xd5, 0x5d, 0xf3, 0xb7, 0x87, 0x23,
+	0x81, 0x7a, 0xea, 0xd0, 0xed, 0xcb, 0xf6, 0xcb, 0x13, 0x8a, 0xc7, 0x34, 0xe9, 0xe7, 0xfd, 0xba,
+	0x07, 0x55, 0xaa, 0xce, 0x7c, 0x9e, 0x88, 0x67, 0x6f, 0xbe, 0x85, 0x35, 0xfa, 0x32, 0x69, 0x25,
+	0xcc, 0xf9, 0x14, 0x1c, 0x8b, 0x4b, 0xd6, 0xdc, 0xb0, 0xd6, 0x56, 0x86, 0x9c, 0x62, 0x78, 0x3c,
+	0x67, 0xee, 0x3e, 0x6c, 0x4e, 0x31, 0xf7, 0x3e, 0x1e, 0xb7, 0x17, 0xe5, 0xdf, 0x4e, 0x3e, 0xff,
+	0xef, 0x00, 0xe9, 0xac, 0x73, 0x90, 0xac, 0x19, 0x00, 0x00,
 }
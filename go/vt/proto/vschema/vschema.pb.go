@@ -123,6 +123,15 @@ type Table struct {
 	AutoIncrement *AutoIncrement `protobuf:"bytes,3,opt,name=auto_increment,json=autoIncrement" json:"auto_increment,omitempty"`
 	// columns lists the columns for the table.
 	Columns []*Column `protobuf:"bytes,4,rep,name=columns" json:"columns,omitempty"`
+	// row_count is an estimate of the number of rows in the table.
+	// It's used to choose how cross-shard joins are executed.
+	// If it's not set, the row count is unknown.
+	RowCount int64 `protobuf:"varint,5,opt,name=row_count,json=rowCount" json:"row_count,omitempty"`
+	// result_cache_ttl_seconds, if set, makes vtgate cache the results
+	// of the SELECTs that read a single row of the table by its primary
+	// vindex, for at most that many seconds. The entries are invalidated
+	// from the update stream before that.
+	ResultCacheTtlSeconds int64 `protobuf:"varint,6,opt,name=result_cache_ttl_seconds,json=resultCacheTtlSeconds" json:"result_cache_ttl_seconds,omitempty"`
 }
 
 func (m *Table) Reset()                    { *m = Table{} }
@@ -158,6 +167,20 @@ func (m *Table) GetColumns() []*Column {
 	return nil
 }
 
+func (m *Table) GetRowCount() int64 {
+	if m != nil {
+		return m.RowCount
+	}
+	return 0
+}
+
+func (m *Table) GetResultCacheTtlSeconds() int64 {
+	if m != nil {
+		return m.ResultCacheTtlSeconds
+	}
+	return 0
+}
+
 // ColumnVindex is used to associate a column to a vindex.
 type ColumnVindex struct {
 	// Legacy implemenation, moving forward all vindexes should define a list of columns.
@@ -276,36 +299,40 @@ func init() {
 func init() { proto.RegisterFile("vschema.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 493 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0xdb, 0x6a, 0xdb, 0x40,
-	0x10, 0x65, 0xed, 0x58, 0xb6, 0x47, 0xb5, 0xdc, 0x2e, 0x69, 0x10, 0x2a, 0x25, 0x46, 0xb4, 0xd4,
-	0x7d, 0xd1, 0x83, 0x43, 0xa1, 0x17, 0x52, 0x5a, 0x4c, 0x1f, 0x42, 0x0b, 0x2d, 0x8a, 0xc9, 0x6b,
-	0xd8, 0xc8, 0x03, 0x09, 0xb1, 0x2e, 0xd1, 0x4a, 0x6e, 0xf5, 0x35, 0x85, 0xfe, 0x41, 0x3f, 0xa2,
-	0xff, 0x55, 0xb4, 0x17, 0x79, 0xe5, 0x28, 0x6f, 0x3b, 0x3e, 0x73, 0xce, 0x9c, 0x19, 0xcd, 0x18,
-	0x26, 0x5b, 0x1e, 0x5d, 0x63, 0xcc, 0x82, 0x2c, 0x4f, 0x8b, 0x94, 0x0e, 0x55, 0xe8, 0xd9, 0x77,
-	0x25, 0xe6, 0x95, 0xfc, 0xd5, 0xff, 0xdb, 0x83, 0xd1, 0x57, 0xac, 0x78, 0xc6, 0x22, 0xa4, 0x2e,
-	0x0c, 0xf9, 0x35, 0xcb, 0xd7, 0xb8, 0x76, 0xc9, 0x8c, 0xcc, 0x47, 0xa1, 0x0e, 0xe9, 0x07, 0x18,
-	0x6d, 0x6f, 0x92, 0x35, 0xfe, 0x42, 0xee, 0xf6, 0x66, 0xfd, 0xb9, 0xbd, 0x38, 0x0e, 0xb4, 0xbc,
-	0xa6, 0x07, 0x17, 0x2a, 0xe3, 0x4b, 0x52, 0xe4, 0x55, 0xd8, 0x10, 0xe8, 0x1b, 0xb0, 0x0a, 0x76,
-	0xb5, 0x41, 0xee, 0xf6, 0x05, 0xf5, 0xf9, 0x7d, 0xea, 0x4a, 0xe0, 0x92, 0xa8, 0x92, 0xbd, 0x6f,
-	0x30, 0x69, 0x29, 0xd2, 0xc7, 0xd0, 0xbf, 0xc5, 0x4a, 0x58, 0x1b, 0x87, 0xf5, 0x93, 0xbe, 0x84,
-	0xc1, 0x96, 0x6d, 0x4a, 0x74, 0x7b, 0x33, 0x32, 0xb7, 0x17, 0xd3, 0x46, 0x58, 0x12, 0x43, 0x89,
-	0xbe, 0xef, 0xbd, 0x25, 0xde, 0x19, 0xd8, 0x46, 0x91, 0x0e, 0xad, 0x17, 0x6d, 0x2d, 0xa7, 0xd1,
-	0x12, 0x34, 0x43, 0xca, 0xff, 0x43, 0xc0, 0x92, 0x05, 0x28, 0x85, 0x83, 0xa2, 0xca, 0x50, 0xe9,
-	0x88, 0x37, 0x3d, 0x01, 0x2b, 0x63, 0x39, 0x8b, 0xf5, 0xa4, 0x9e, 0xed, 0xb9, 0x0a, 0x7e, 0x08,
-	0x54, 0x35, 0x2b, 0x53, 0xe9, 0x21, 0x0c, 0xd2, 0x9f, 0x09, 0xe6, 0x6e, 0x5f, 0x28, 0xc9, 0xc0,
-	0x7b, 0x07, 0xb6, 0x91, 0xdc, 0x61, 0xfa, 0xd0, 0x34, 0x3d, 0x36, 0x4d, 0xfe, 0x23, 0x30, 0x10,
-	0xce, 0x3b, 0x3d, 0x7e, 0x84, 0x69, 0x94, 0x6e, 0xca, 0x38, 0xb9, 0xdc, 0xfb, 0xac, 0x4f, 0x1b,
-	0xb3, 0x4b, 0x81, 0xab, 0x41, 0x3a, 0x91, 0x11, 0x21, 0xa7, 0xa7, 0xe0, 0xb0, 0xb2, 0x48, 0x2f,
-	0x6f, 0x92, 0x28, 0xc7, 0x18, 0x93, 0x42, 0xf8, 0xb6, 0x17, 0x47, 0x0d, 0xfd, 0x73, 0x59, 0xa4,
-	0x67, 0x1a, 0x0d, 0x27, 0xcc, 0x0c, 0xe9, 0x6b, 0x18, 0x4a, 0x41, 0xee, 0x1e, 0x88, 0xb2, 0xd3,
-	0xbd, 0xb2, 0xa1, 0xc6, 0xfd, 0x15, 0x3c, 0x32, 0x9d, 0xd0, 0x23, 0xb0, 0x24, 0xa4, 0xfa, 0x51,
-	0x51, 0xdd, 0x65, 0xc2, 0x62, 0x3d, 0x08, 0xf1, 0xae, 0xf7, 0x59, 0x97, 0xa9, 0x37, 0x6f, 0xbc,
-	0x53, 0x5d, 0xc2, 0xa4, 0x65, 0xf0, 0x41, 0x59, 0x0f, 0x46, 0x1c, 0xef, 0x4a, 0x4c, 0x22, 0x2d,
-	0xdd, 0xc4, 0xfe, 0x29, 0x58, 0xcb, 0x76, 0x71, 0x62, 0x14, 0x3f, 0x56, 0x63, 0xaf, 0x59, 0xce,
-	0xc2, 0x0e, 0xe4, 0xd5, 0xad, 0xaa, 0x0c, 0xe5, 0x37, 0xf0, 0x7f, 0x13, 0x80, 0xf3, 0x7c, 0x7b,
-	0x71, 0x2e, 0x1a, 0xa7, 0x9f, 0x60, 0x7c, 0xab, 0xce, 0x81, 0xbb, 0x44, 0x4c, 0xc5, 0x6f, 0xa6,
-	0xb2, 0xcb, 0x6b, 0x6e, 0x46, 0x2d, 0xd0, 0x8e, 0xe4, 0x7d, 0x07, 0xa7, 0x0d, 0x76, 0x2c, 0xcc,
-	0xab, 0xf6, 0x96, 0x3f, 0xb9, 0x77, 0x8a, 0xc6, 0x0e, 0x5d, 0x59, 0xe2, 0x3f, 0xe2, 0xe4, 0x7f,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x4b, 0xa1, 0xdc, 0xf5, 0x4a, 0x04, 0x00, 0x00,
+	// 547 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x54, 0x4f, 0x6b, 0xdb, 0x4e,
+	0x10, 0x45, 0x56, 0x2c, 0xdb, 0xa3, 0x9f, 0x9d, 0x5f, 0x97, 0x24, 0x2c, 0x0a, 0x25, 0x46, 0xb4,
+	0xd4, 0xbd, 0xf8, 0xe0, 0x50, 0xfa, 0x8f, 0x94, 0x16, 0xd3, 0x43, 0x68, 0xa1, 0x45, 0x36, 0xb9,
+	0x8a, 0x8d, 0x3c, 0xe0, 0x10, 0x59, 0x52, 0x76, 0x57, 0x76, 0xf5, 0x59, 0x7a, 0x28, 0xf4, 0x1b,
+	0xf4, 0x1b, 0x16, 0xed, 0xae, 0x14, 0x29, 0x71, 0x6f, 0x3b, 0x7a, 0xf3, 0xde, 0xbc, 0x9d, 0x9d,
+	0x11, 0x0c, 0xb7, 0x22, 0x5a, 0xe3, 0x86, 0x4d, 0x33, 0x9e, 0xca, 0x94, 0xf4, 0x4c, 0xe8, 0xb9,
+	0x77, 0x39, 0xf2, 0x42, 0x7f, 0xf5, 0xff, 0x74, 0xa0, 0xff, 0x05, 0x0b, 0x91, 0xb1, 0x08, 0x09,
+	0x85, 0x9e, 0x58, 0x33, 0xbe, 0xc2, 0x15, 0xb5, 0xc6, 0xd6, 0xa4, 0x1f, 0x54, 0x21, 0x79, 0x0f,
+	0xfd, 0xed, 0x4d, 0xb2, 0xc2, 0x1f, 0x28, 0x68, 0x67, 0x6c, 0x4f, 0xdc, 0xd9, 0xd9, 0xb4, 0x92,
+	0xaf, 0xe8, 0xd3, 0x2b, 0x93, 0xf1, 0x39, 0x91, 0xbc, 0x08, 0x6a, 0x02, 0x79, 0x05, 0x8e, 0x64,
+	0xd7, 0x31, 0x0a, 0x6a, 0x2b, 0xea, 0xd3, 0xc7, 0xd4, 0xa5, 0xc2, 0x35, 0xd1, 0x24, 0x7b, 0x5f,
+	0x61, 0xd8, 0x52, 0x24, 0xff, 0x83, 0x7d, 0x8b, 0x85, 0xb2, 0x36, 0x08, 0xca, 0x23, 0x79, 0x0e,
+	0xdd, 0x2d, 0x8b, 0x73, 0xa4, 0x9d, 0xb1, 0x35, 0x71, 0x67, 0x87, 0xb5, 0xb0, 0x26, 0x06, 0x1a,
+	0x7d, 0xd7, 0x79, 0x63, 0x79, 0x97, 0xe0, 0x36, 0x8a, 0xec, 0xd1, 0x7a, 0xd6, 0xd6, 0x1a, 0xd5,
+	0x5a, 0x8a, 0xd6, 0x90, 0xf2, 0x7f, 0x5b, 0xe0, 0xe8, 0x02, 0x84, 0xc0, 0x81, 0x2c, 0x32, 0x34,
+	0x3a, 0xea, 0x4c, 0xce, 0xc1, 0xc9, 0x18, 0x67, 0x9b, 0xaa, 0x53, 0xa7, 0x0f, 0x5c, 0x4d, 0xbf,
+	0x2b, 0xd4, 0x5c, 0x56, 0xa7, 0x92, 0x23, 0xe8, 0xa6, 0xbb, 0x04, 0x39, 0xb5, 0x95, 0x92, 0x0e,
+	0xbc, 0xb7, 0xe0, 0x36, 0x92, 0xf7, 0x98, 0x3e, 0x6a, 0x9a, 0x1e, 0x34, 0x4d, 0xfe, 0xec, 0x40,
+	0x57, 0x39, 0xdf, 0xeb, 0xf1, 0x03, 0x1c, 0x46, 0x69, 0x9c, 0x6f, 0x92, 0xf0, 0xc1, 0xb3, 0x1e,
+	0xd7, 0x66, 0xe7, 0x0a, 0x37, 0x8d, 0x1c, 0x45, 0x8d, 0x08, 0x05, 0xb9, 0x80, 0x11, 0xcb, 0x65,
+	0x1a, 0xde, 0x24, 0x11, 0xc7, 0x0d, 0x26, 0x52, 0xf9, 0x76, 0x67, 0x27, 0x35, 0xfd, 0x53, 0x2e,
+	0xd3, 0xcb, 0x0a, 0x0d, 0x86, 0xac, 0x19, 0x92, 0x97, 0xd0, 0xd3, 0x82, 0x82, 0x1e, 0x8c, 0xed,
+	0xd6, 0xcb, 0xe9, 0xb2, 0x41, 0x85, 0x93, 0x53, 0x18, 0xf0, 0x74, 0x17, 0x46, 0x69, 0x9e, 0x48,
+	0xda, 0x1d, 0x5b, 0x13, 0x3b, 0xe8, 0xf3, 0x74, 0x37, 0x2f, 0x63, 0xf2, 0x1a, 0x28, 0x47, 0x91,
+	0xc7, 0x32, 0x8c, 0x58, 0xb4, 0xc6, 0x50, 0xca, 0x38, 0x14, 0x18, 0xa5, 0xc9, 0x4a, 0x50, 0x47,
+	0xe5, 0x1e, 0x6b, 0x7c, 0x5e, 0xc2, 0x4b, 0x19, 0x2f, 0x34, 0xe8, 0x2f, 0xe1, 0xbf, 0xe6, 0xfd,
+	0xc8, 0x09, 0x38, 0xba, 0xa0, 0xe9, 0x92, 0x89, 0xca, 0xde, 0x25, 0x6c, 0x53, 0xb5, 0x57, 0x9d,
+	0xcb, 0x2d, 0xa9, 0xcc, 0x97, 0xf3, 0x3c, 0xa8, 0xbd, 0xfa, 0x73, 0x18, 0xb6, 0xae, 0xfd, 0x4f,
+	0x59, 0x0f, 0xfa, 0x02, 0xef, 0x72, 0x4c, 0xa2, 0x4a, 0xba, 0x8e, 0xfd, 0x0b, 0x70, 0xe6, 0xed,
+	0xe2, 0x56, 0xa3, 0xf8, 0x99, 0x79, 0xcc, 0x92, 0x35, 0x9a, 0xb9, 0x53, 0xbd, 0xcb, 0xcb, 0x22,
+	0x43, 0xfd, 0xb2, 0xfe, 0x2f, 0x0b, 0x60, 0xc1, 0xb7, 0x57, 0x0b, 0xd5, 0x4e, 0xf2, 0x11, 0x06,
+	0xb7, 0x66, 0xc9, 0x04, 0xb5, 0x54, 0xaf, 0xfd, 0xba, 0xd7, 0xf7, 0x79, 0xf5, 0x26, 0x9a, 0xb1,
+	0xbc, 0x27, 0x79, 0xdf, 0x60, 0xd4, 0x06, 0xf7, 0x8c, 0xe1, 0x8b, 0xf6, 0xee, 0x3c, 0x79, 0xb4,
+	0xe0, 0x8d, 0xc9, 0xbc, 0x76, 0xd4, 0x9f, 0xe7, 0xfc, 0xef, 0x00, 0x01, 0xdc, 0x61, 0x56, 0xa0,
+	0x04, 0x00, 0x00,
 }
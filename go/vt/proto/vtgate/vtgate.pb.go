@@ -107,6 +107,35 @@ func (x TransactionMode) String() string {
 }
 func (TransactionMode) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
 
+// CommitOrder is used to designate which of the ShardSessions
+// get used for transactions.
+type CommitOrder int32
+
+const (
+	// NORMAL is the default commit order.
+	CommitOrder_NORMAL CommitOrder = 0
+	// PRE is used to designate pre_sessions.
+	CommitOrder_PRE CommitOrder = 1
+	// POST is used to designate post_sessions.
+	CommitOrder_POST CommitOrder = 2
+)
+
+var CommitOrder_name = map[int32]string{
+	0: "NORMAL",
+	1: "PRE",
+	2: "POST",
+}
+var CommitOrder_value = map[string]int32{
+	"NORMAL": 0,
+	"PRE":    1,
+	"POST":   2,
+}
+
+func (x CommitOrder) String() string {
+	return proto.EnumName(CommitOrder_name, int32(x))
+}
+func (CommitOrder) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
 // Session objects are exchanged like cookies through various
 // calls to VTGate. The behavior differs between V2 & V3 APIs.
 // V3 APIs are Execute, ExecuteBatch and StreamExecute. All
@@ -138,6 +167,10 @@ type Session struct {
 	Options *query.ExecuteOptions `protobuf:"bytes,6,opt,name=options" json:"options,omitempty"`
 	// transaction_mode specifies the current transaction mode.
 	TransactionMode TransactionMode `protobuf:"varint,7,opt,name=transaction_mode,json=transactionMode,enum=vtgate.TransactionMode" json:"transaction_mode,omitempty"`
+	// pre_sessions contains sessions that have to be committed first.
+	PreSessions []*Session_ShardSession `protobuf:"bytes,8,rep,name=pre_sessions,json=preSessions" json:"pre_sessions,omitempty"`
+	// post_sessions contains sessions that have to be committed last.
+	PostSessions []*Session_ShardSession `protobuf:"bytes,9,rep,name=post_sessions,json=postSessions" json:"post_sessions,omitempty"`
 }
 
 func (m *Session) Reset()                    { *m = Session{} }
@@ -194,6 +227,20 @@ func (m *Session) GetTransactionMode() TransactionMode {
 	return TransactionMode_UNSPECIFIED
 }
 
+func (m *Session) GetPreSessions() []*Session_ShardSession {
+	if m != nil {
+		return m.PreSessions
+	}
+	return nil
+}
+
+func (m *Session) GetPostSessions() []*Session_ShardSession {
+	if m != nil {
+		return m.PostSessions
+	}
+	return nil
+}
+
 type Session_ShardSession struct {
 	Target        *query.Target `protobuf:"bytes,1,opt,name=target" json:"target,omitempty"`
 	TransactionId int64         `protobuf:"varint,2,opt,name=transaction_id,json=transactionId" json:"transaction_id,omitempty"`
@@ -2414,125 +2461,130 @@ func init() {
 	proto.RegisterType((*UpdateStreamRequest)(nil), "vtgate.UpdateStreamRequest")
 	proto.RegisterType((*UpdateStreamResponse)(nil), "vtgate.UpdateStreamResponse")
 	proto.RegisterEnum("vtgate.TransactionMode", TransactionMode_name, TransactionMode_value)
+	proto.RegisterEnum("vtgate.CommitOrder", CommitOrder_name, CommitOrder_value)
 }
 
 func init() { proto.RegisterFile("vtgate.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 1838 bytes of a gzipped FileDescriptorProto
+	// 1898 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xd4, 0x5a, 0x5b, 0x8f, 0x23, 0x47,
-	0x15, 0xa6, 0xbb, 0x7d, 0x3d, 0xbe, 0x4e, 0xad, 0x77, 0xd7, 0x71, 0x86, 0x1d, 0xa7, 0x61, 0x14,
-	0x27, 0x59, 0x39, 0xc4, 0xe1, 0x26, 0x84, 0x04, 0x19, 0xef, 0x10, 0x59, 0xd9, 0xd9, 0x0c, 0x65,
-	0x6f, 0x02, 0x12, 0x51, 0xab, 0xc7, 0x2e, 0x79, 0x1a, 0xdb, 0xdd, 0x4e, 0x57, 0xd9, 0x61, 0x78,
-	0x40, 0xf9, 0x07, 0x11, 0x0f, 0x48, 0x68, 0x85, 0x84, 0x90, 0x90, 0x90, 0x90, 0x78, 0x45, 0x02,
-	0x5e, 0x78, 0xe3, 0x11, 0xf1, 0xc4, 0x3b, 0x7f, 0x00, 0x89, 0x5f, 0x80, 0xba, 0xaa, 0xfa, 0xe2,
-	0x9e, 0xb1, 0xc7, 0xe3, 0xb9, 0xc8, 0xfb, 0xe4, 0xae, 0x53, 0xb7, 0xaf, 0xbe, 0xf3, 0xd5, 0xa9,
-	0xd3, 0xd5, 0x86, 0xfc, 0x9c, 0x0d, 0x4d, 0x46, 0x9a, 0x53, 0xd7, 0x61, 0x0e, 0x4a, 0x89, 0x52,
-	0x2d, 0xf7, 0xe9, 0x8c, 0xb8, 0x67, 0xc2, 0x58, 0x2b, 0x32, 0x67, 0xea, 0x0c, 0x4c, 0x66, 0xca,
-	0x72, 0x6e, 0xce, 0xdc, 0x69, 0x5f, 0x14, 0xf4, 0x3f, 0x6a, 0x90, 0xee, 0x12, 0x4a, 0x2d, 0xc7,
-	0x46, 0xfb, 0x50, 0xb4, 0x6c, 0x83, 0xb9, 0xa6, 0x4d, 0xcd, 0x3e, 0xb3, 0x1c, 0xbb, 0xaa, 0xd4,
-	0x95, 0x46, 0x06, 0x17, 0x2c, 0xbb, 0x17, 0x1a, 0x51, 0x1b, 0x8a, 0xf4, 0xd4, 0x74, 0x07, 0x06,
-	0x15, 0xfd, 0x68, 0x55, 0xad, 0x6b, 0x8d, 0x5c, 0x6b, 0xb7, 0x29, 0xb1, 0xc8, 0xf1, 0x9a, 0x5d,
-	0xaf, 0x95, 0x2c, 0xe0, 0x02, 0x8d, 0x94, 0x28, 0x7a, 0x15, 0xb2, 0xd4, 0xb2, 0x87, 0x63, 0x62,
-	0x0c, 0x4e, 0xaa, 0x1a, 0x9f, 0x26, 0x23, 0x0c, 0x4f, 0x4e, 0xd0, 0x23, 0x00, 0x73, 0xc6, 0x9c,
-	0xbe, 0x33, 0x99, 0x58, 0xac, 0x9a, 0xe0, 0xb5, 0x11, 0x0b, 0xfa, 0x0a, 0x14, 0x98, 0xe9, 0x0e,
-	0x09, 0x33, 0x28, 0x73, 0x2d, 0x7b, 0x58, 0x4d, 0xd6, 0x95, 0x46, 0x16, 0xe7, 0x85, 0xb1, 0xcb,
-	0x6d, 0xe8, 0x6d, 0x48, 0x3b, 0x53, 0xc6, 0xf1, 0xa5, 0xea, 0x4a, 0x23, 0xd7, 0xba, 0xdf, 0x14,
-	0xac, 0x1c, 0xfe, 0x8c, 0xf4, 0x67, 0x8c, 0x7c, 0x28, 0x2a, 0xb1, 0xdf, 0x0a, 0x1d, 0x40, 0x39,
-	0xb2, 0x76, 0x63, 0xe2, 0x0c, 0x48, 0x35, 0x5d, 0x57, 0x1a, 0xc5, 0xd6, 0x43, 0x7f, 0x65, 0x11,
-	0x1a, 0x8e, 0x9c, 0x01, 0xc1, 0x25, 0xb6, 0x68, 0xa8, 0xfd, 0x04, 0xf2, 0xd1, 0x55, 0xa3, 0x7d,
-	0x48, 0x09, 0x50, 0x9c, 0xca, 0x5c, 0xab, 0x20, 0x31, 0xf4, 0xb8, 0x11, 0xcb, 0x4a, 0x8f, 0xf9,
-	0xe8, 0xd4, 0xd6, 0xa0, 0xaa, 0xd6, 0x95, 0x86, 0x86, 0x0b, 0x11, 0x6b, 0x67, 0xa0, 0xff, 0x53,
-	0x85, 0xa2, 0x44, 0x8f, 0xc9, 0xa7, 0x33, 0x42, 0x19, 0x7a, 0x0c, 0xd9, 0xbe, 0x39, 0x1e, 0x13,
-	0xd7, 0xeb, 0x24, 0xe6, 0x28, 0x35, 0x85, 0x83, 0xdb, 0xdc, 0xde, 0x79, 0x82, 0x33, 0xa2, 0x45,
-	0x67, 0x80, 0xde, 0x80, 0xb4, 0x74, 0x1a, 0x9f, 0x40, 0xb4, 0x8d, 0xfa, 0x0c, 0xfb, 0xf5, 0xe8,
-	0x75, 0x48, 0x72, 0xa8, 0xdc, 0x39, 0xb9, 0xd6, 0x8e, 0x04, 0x7e, 0xe0, 0xcc, 0xec, 0xc1, 0x0f,
-	0xbd, 0x47, 0x2c, 0xea, 0xd1, 0x37, 0x20, 0xc7, 0xcc, 0x93, 0x31, 0x61, 0x06, 0x3b, 0x9b, 0x12,
-	0xee, 0xad, 0x62, 0xab, 0xd2, 0x0c, 0x44, 0xd7, 0xe3, 0x95, 0xbd, 0xb3, 0x29, 0xc1, 0xc0, 0x82,
-	0x67, 0xf4, 0x18, 0x90, 0xed, 0x30, 0x23, 0x26, 0xb8, 0x24, 0xf7, 0x75, 0xd9, 0x76, 0x58, 0x67,
-	0x41, 0x73, 0xfb, 0x50, 0x1c, 0x91, 0x33, 0x3a, 0x35, 0xfb, 0xc4, 0xe0, 0x42, 0xe2, 0x3e, 0xcd,
-	0xe2, 0x82, 0x6f, 0xe5, 0xac, 0x47, 0x7d, 0x9e, 0x5e, 0xc7, 0xe7, 0xfa, 0x17, 0x0a, 0x94, 0x02,
-	0x46, 0xe9, 0xd4, 0xb1, 0x29, 0x41, 0xfb, 0x90, 0x24, 0xae, 0xeb, 0xb8, 0x31, 0x3a, 0xf1, 0x71,
-	0xfb, 0xd0, 0x33, 0x63, 0x51, 0x7b, 0x15, 0x2e, 0xdf, 0x84, 0x94, 0x4b, 0xe8, 0x6c, 0xcc, 0x24,
-	0x99, 0x48, 0xa2, 0x12, 0x3c, 0xf2, 0x1a, 0x2c, 0x5b, 0xe8, 0xff, 0x51, 0xa1, 0x22, 0x11, 0xf1,
-	0x35, 0xd1, 0xed, 0xf1, 0x74, 0x0d, 0x32, 0x3e, 0xdd, 0xdc, 0xcd, 0x59, 0x1c, 0x94, 0xd1, 0x03,
-	0x48, 0x71, 0xbf, 0xd0, 0x6a, 0xb2, 0xae, 0x35, 0xb2, 0x58, 0x96, 0xe2, 0xea, 0x48, 0x5d, 0x4b,
-	0x1d, 0xe9, 0x25, 0xea, 0x88, 0xb8, 0x3d, 0xb3, 0x96, 0xdb, 0x7f, 0xa5, 0xc0, 0xfd, 0x18, 0xc9,
-	0x5b, 0xe1, 0xfc, 0xff, 0xa9, 0xf0, 0x8a, 0xc4, 0xf5, 0x81, 0x64, 0xb6, 0xf3, 0xb2, 0x28, 0xe0,
-	0x35, 0xc8, 0x07, 0x5b, 0xd4, 0x92, 0x3a, 0xc8, 0xe3, 0xdc, 0x28, 0x5c, 0xc7, 0x96, 0x8a, 0xe1,
-	0x85, 0x02, 0xb5, 0x8b, 0x48, 0xdf, 0x0a, 0x45, 0x7c, 0xae, 0xc1, 0xc3, 0x10, 0x1c, 0x36, 0xed,
-	0x21, 0x79, 0x49, 0xf4, 0xf0, 0x0e, 0xc0, 0x88, 0x9c, 0x19, 0x2e, 0x87, 0xcc, 0xd5, 0xe0, 0xad,
-	0x34, 0xf0, 0xb5, 0xbf, 0x1a, 0x9c, 0x1d, 0xf9, 0xeb, 0xda, 0x52, 0x7d, 0xfc, 0x5a, 0x81, 0xea,
-	0x79, 0x17, 0x6c, 0x85, 0x3a, 0xfe, 0x92, 0x08, 0xd4, 0x71, 0x68, 0x33, 0x8b, 0x9d, 0xbd, 0x34,
-	0xd1, 0xe2, 0x31, 0x20, 0xc2, 0x11, 0x1b, 0x7d, 0x67, 0x3c, 0x9b, 0xd8, 0x86, 0x6d, 0x4e, 0x88,
-	0xcc, 0xe3, 0xca, 0xa2, 0xa6, 0xcd, 0x2b, 0x9e, 0x99, 0x13, 0x82, 0x7e, 0x04, 0xf7, 0x64, 0xeb,
-	0x85, 0x10, 0x93, 0xe2, 0xa2, 0x6a, 0xf8, 0x48, 0x97, 0x30, 0xd1, 0xf4, 0x0d, 0x78, 0x47, 0x0c,
-	0xf2, 0xc1, 0xf2, 0x90, 0x94, 0xbe, 0x96, 0xe4, 0x32, 0x97, 0x4b, 0x2e, 0xbb, 0x8e, 0xe4, 0x6a,
-	0x27, 0x90, 0xf1, 0x41, 0xa3, 0x3d, 0x48, 0x70, 0x68, 0x0a, 0x87, 0x96, 0xf3, 0x13, 0x48, 0x0f,
-	0x11, 0xaf, 0x40, 0x15, 0x48, 0xce, 0xcd, 0xf1, 0x8c, 0x70, 0xc7, 0xe5, 0xb1, 0x28, 0xa0, 0x3d,
-	0xc8, 0x45, 0xb8, 0xe2, 0xbe, 0xca, 0x63, 0x08, 0xa3, 0x71, 0x54, 0xd6, 0x11, 0xc6, 0xb6, 0x42,
-	0xd6, 0xff, 0x52, 0xe1, 0x9e, 0x84, 0x76, 0x60, 0xb2, 0xfe, 0xe9, 0xad, 0x4b, 0xfa, 0x2d, 0x48,
-	0x7b, 0x68, 0x2c, 0x42, 0xab, 0x1a, 0xd7, 0xd4, 0x05, 0xa2, 0xf6, 0x5b, 0x6c, 0x9a, 0xf0, 0xee,
-	0x43, 0xd1, 0xa4, 0x17, 0x24, 0xbb, 0x05, 0x93, 0xde, 0x45, 0xa6, 0xfb, 0x42, 0x09, 0xf2, 0x4a,
-	0xc9, 0xe9, 0xad, 0xb9, 0xfa, 0x6b, 0x90, 0x16, 0x8e, 0xf4, 0xd9, 0x7c, 0x20, 0xb1, 0x09, 0x37,
-	0x7f, 0x6c, 0xb1, 0x53, 0x31, 0xb4, 0xdf, 0x4c, 0xb7, 0xa1, 0xc4, 0x99, 0xe6, 0x6b, 0xe3, 0x74,
-	0x87, 0x51, 0x46, 0xb9, 0x42, 0x94, 0x51, 0x97, 0x66, 0xa5, 0x5a, 0x34, 0x2b, 0xd5, 0xff, 0x1c,
-	0xe6, 0x59, 0x9c, 0x8c, 0x3b, 0xca, 0xb4, 0xdf, 0x89, 0xcb, 0x2c, 0x78, 0xb1, 0x8c, 0xad, 0xfe,
-	0xae, 0xc4, 0x76, 0xd5, 0x77, 0x64, 0xfd, 0x37, 0x61, 0xae, 0xb4, 0x40, 0xdc, 0xad, 0x69, 0xe9,
-	0x71, 0x5c, 0x4b, 0x17, 0xc5, 0x8d, 0x40, 0x47, 0xbf, 0x80, 0x0a, 0x67, 0x32, 0x8c, 0xf0, 0x37,
-	0x28, 0xa6, 0x78, 0x82, 0xab, 0x9d, 0x4b, 0x70, 0xf5, 0xbf, 0xab, 0xf0, 0x28, 0x4a, 0xcf, 0x5d,
-	0x26, 0xf1, 0xdf, 0x8c, 0x8b, 0x6b, 0x77, 0x41, 0x5c, 0x31, 0x4a, 0xb6, 0x56, 0x61, 0xbf, 0x53,
-	0x60, 0x6f, 0x29, 0x85, 0x5b, 0x22, 0xb3, 0x3f, 0xa8, 0x50, 0xe9, 0x32, 0x97, 0x98, 0x93, 0x6b,
-	0xdd, 0xc6, 0x04, 0xaa, 0x54, 0xaf, 0x76, 0xc5, 0xa2, 0xad, 0xef, 0xa2, 0xd8, 0x51, 0x92, 0xb8,
-	0xe4, 0x28, 0x49, 0xae, 0x75, 0x51, 0x16, 0xe1, 0x35, 0xb5, 0x9a, 0x57, 0xbd, 0x0d, 0xf7, 0x63,
-	0x44, 0x49, 0x17, 0x86, 0xe9, 0x80, 0x72, 0x69, 0x3a, 0xf0, 0x85, 0x0a, 0xb5, 0x85, 0x51, 0xae,
-	0x13, 0xae, 0xd7, 0x26, 0x3d, 0x1a, 0x0a, 0xb4, 0xa5, 0xe7, 0x4a, 0x62, 0xd5, 0x6d, 0x47, 0x72,
-	0x4d, 0x47, 0x5d, 0x79, 0x93, 0x74, 0xe0, 0xd5, 0x0b, 0x09, 0xd9, 0x80, 0xdc, 0xdf, 0xaa, 0xb0,
-	0xb7, 0x30, 0xd6, 0xb5, 0x63, 0xd6, 0x8d, 0x30, 0x1c, 0x0f, 0xb6, 0x89, 0x4b, 0x6f, 0x13, 0x6e,
-	0x8d, 0xec, 0x67, 0x50, 0x5f, 0x4e, 0xd0, 0x06, 0x8c, 0xff, 0x49, 0x85, 0x2f, 0xc7, 0x07, 0xbc,
-	0xce, 0x8b, 0xfd, 0x8d, 0xf0, 0xbd, 0xf8, 0xb6, 0x9e, 0xd8, 0xe0, 0x6d, 0xfd, 0xd6, 0xf8, 0x7f,
-	0x0a, 0x8f, 0x96, 0xd1, 0xb5, 0x01, 0xfb, 0x3f, 0x86, 0xfc, 0x01, 0x19, 0x5a, 0xf6, 0x66, 0x5c,
-	0x2f, 0x7c, 0xb6, 0x50, 0x17, 0x3f, 0x5b, 0xe8, 0xdf, 0x81, 0x82, 0x1c, 0x5a, 0xe2, 0x8a, 0x04,
-	0x4a, 0xe5, 0x92, 0x40, 0xf9, 0xb9, 0x02, 0x85, 0x36, 0xff, 0xba, 0x71, 0xeb, 0x89, 0xc2, 0x03,
-	0x48, 0x99, 0xcc, 0x99, 0x58, 0x7d, 0xf9, 0xdd, 0x45, 0x96, 0xf4, 0x32, 0x14, 0x7d, 0x04, 0x02,
-	0xbf, 0xfe, 0x53, 0x28, 0x61, 0x67, 0x3c, 0x3e, 0x31, 0xfb, 0xa3, 0xdb, 0x46, 0xa5, 0x23, 0x28,
-	0x87, 0x73, 0xc9, 0xf9, 0x3f, 0x81, 0x57, 0x30, 0xa1, 0xce, 0x78, 0x4e, 0x22, 0x29, 0xc5, 0x66,
-	0x48, 0x10, 0x24, 0x06, 0x4c, 0x7e, 0x57, 0xc9, 0x62, 0xfe, 0xac, 0xff, 0x4d, 0x81, 0xca, 0x11,
-	0xa1, 0xd4, 0x1c, 0x12, 0x21, 0xb0, 0xcd, 0x86, 0x5e, 0x95, 0x33, 0x56, 0x20, 0x29, 0x4e, 0x5e,
-	0xb1, 0xdf, 0x44, 0x01, 0xbd, 0x0d, 0xd9, 0x60, 0xb3, 0xf1, 0x33, 0xf9, 0xe2, 0xbd, 0x96, 0xf1,
-	0xf7, 0x9a, 0x87, 0x3e, 0x72, 0x3f, 0xc2, 0x9f, 0xf5, 0x5f, 0x2a, 0xb0, 0x23, 0xd1, 0xbf, 0xb7,
-	0xa9, 0x7f, 0x56, 0x41, 0xf7, 0xe7, 0xd4, 0xc2, 0x39, 0xd1, 0x23, 0xd0, 0xfc, 0x60, 0x9c, 0x6b,
-	0xe5, 0xe5, 0x2e, 0xfb, 0xc8, 0x1c, 0xcf, 0x08, 0xf6, 0x2a, 0xf4, 0x23, 0xc8, 0x77, 0x22, 0x99,
-	0x26, 0xda, 0x05, 0x35, 0x80, 0xb1, 0xd8, 0x5c, 0xb5, 0x06, 0xf1, 0x2b, 0x0a, 0xf5, 0xdc, 0x15,
-	0xc5, 0x5f, 0x15, 0xd8, 0x0d, 0x97, 0x78, 0xed, 0x83, 0xe9, 0xaa, 0xab, 0xfd, 0x2e, 0x94, 0xac,
-	0x81, 0x71, 0xee, 0x18, 0xca, 0xb5, 0x2a, 0xbe, 0x8a, 0xa3, 0x8b, 0xc5, 0x05, 0x2b, 0x52, 0xa2,
-	0xfa, 0x2e, 0xd4, 0x2e, 0x12, 0xaf, 0x94, 0xf6, 0x7f, 0x55, 0xd8, 0xe9, 0x4e, 0xc7, 0x16, 0x93,
-	0x31, 0xea, 0xa6, 0xd7, 0xb3, 0xf6, 0x25, 0xdd, 0x6b, 0x90, 0xa7, 0x1e, 0x0e, 0x79, 0x0f, 0x27,
-	0x13, 0x9a, 0x1c, 0xb7, 0x89, 0x1b, 0x38, 0xcf, 0x4f, 0x7e, 0x93, 0x99, 0xcd, 0xb8, 0x08, 0x35,
-	0x0c, 0xb2, 0xc5, 0xcc, 0x66, 0xe8, 0xeb, 0xf0, 0xd0, 0x9e, 0x4d, 0x0c, 0xd7, 0xf9, 0x8c, 0x1a,
-	0x53, 0xe2, 0x1a, 0x7c, 0x64, 0x63, 0x6a, 0xba, 0x8c, 0x87, 0x78, 0x0d, 0xdf, 0xb3, 0x67, 0x13,
-	0xec, 0x7c, 0x46, 0x8f, 0x89, 0xcb, 0x27, 0x3f, 0x36, 0x5d, 0x86, 0xbe, 0x0f, 0x59, 0x73, 0x3c,
-	0x74, 0x5c, 0x8b, 0x9d, 0x4e, 0xe4, 0xc5, 0x9b, 0x2e, 0x61, 0x9e, 0x63, 0xa6, 0xf9, 0x9e, 0xdf,
-	0x12, 0x87, 0x9d, 0xd0, 0x5b, 0x80, 0x66, 0x94, 0x18, 0x02, 0x9c, 0x98, 0x74, 0xde, 0x92, 0xb7,
-	0x70, 0xa5, 0x19, 0x25, 0xe1, 0x30, 0x1f, 0xb5, 0xf4, 0x7f, 0x68, 0x80, 0xa2, 0xe3, 0xca, 0x18,
-	0xfd, 0x2d, 0x48, 0xf1, 0xfe, 0xb4, 0xaa, 0x70, 0xdf, 0xee, 0x05, 0x11, 0xea, 0x5c, 0xdb, 0xa6,
-	0x07, 0x1b, 0xcb, 0xe6, 0xb5, 0x4f, 0x20, 0xef, 0xef, 0x54, 0xbe, 0x9c, 0xa8, 0x37, 0x94, 0x95,
-	0xa7, 0xab, 0xba, 0xc6, 0xe9, 0x5a, 0xfb, 0x1e, 0x64, 0x79, 0x56, 0x77, 0xe9, 0xd8, 0x61, 0x2e,
-	0xaa, 0x46, 0x73, 0xd1, 0xda, 0xbf, 0x15, 0x48, 0xf0, 0xce, 0x6b, 0xbf, 0xfc, 0x1e, 0xf1, 0xf7,
-	0x05, 0x81, 0x52, 0x78, 0x4f, 0x04, 0xed, 0xd7, 0x57, 0x50, 0x12, 0xa5, 0x00, 0xe7, 0x47, 0x51,
-	0x42, 0xda, 0x00, 0xe2, 0x7f, 0x02, 0x7c, 0x28, 0xa1, 0xc3, 0xaf, 0xae, 0x18, 0x2a, 0x58, 0x2e,
-	0xce, 0xd2, 0x60, 0xe5, 0x08, 0x12, 0xd4, 0xfa, 0xb9, 0x88, 0x92, 0x1a, 0xe6, 0xcf, 0xfa, 0xbb,
-	0x70, 0xff, 0x7d, 0xc2, 0xba, 0xee, 0xdc, 0xdf, 0x6e, 0xfe, 0xf6, 0x59, 0x41, 0x93, 0x8e, 0xe1,
-	0x41, 0xbc, 0x93, 0x54, 0xc0, 0xb7, 0x21, 0x4f, 0xdd, 0xb9, 0xb1, 0xd0, 0xd3, 0xcb, 0x4a, 0x02,
-	0xf7, 0x44, 0x3b, 0xe5, 0x68, 0x58, 0xd0, 0x7f, 0xaf, 0xc2, 0xbd, 0xe7, 0xd3, 0x81, 0xc9, 0xb6,
-	0xfd, 0xfc, 0xd8, 0x30, 0x55, 0xdb, 0x85, 0x2c, 0xb3, 0x26, 0x84, 0x32, 0x73, 0x32, 0x95, 0x3b,
-	0x39, 0x34, 0x78, 0xba, 0x22, 0x73, 0x62, 0x33, 0x79, 0x01, 0xe9, 0xeb, 0xea, 0xd0, 0xb3, 0xf5,
-	0x9c, 0x11, 0xb1, 0xb1, 0xa8, 0xd7, 0x47, 0x50, 0x59, 0x64, 0x49, 0x12, 0xdf, 0xf0, 0x07, 0x58,
-	0xcc, 0xda, 0x64, 0xb2, 0xe7, 0xd5, 0xc8, 0x11, 0xd0, 0x1b, 0x50, 0xf6, 0xd2, 0xb7, 0x09, 0x31,
-	0x42, 0x3c, 0xe2, 0x1f, 0x12, 0x25, 0x61, 0xef, 0xf9, 0xe6, 0x37, 0x9f, 0x40, 0x29, 0xf6, 0x2f,
-	0x0d, 0x54, 0x82, 0xdc, 0xf3, 0x67, 0xdd, 0xe3, 0xc3, 0x76, 0xe7, 0x07, 0x9d, 0xc3, 0x27, 0xe5,
-	0x2f, 0x21, 0x80, 0x54, 0xb7, 0xf3, 0xec, 0xfd, 0xa7, 0x87, 0x65, 0x05, 0x65, 0x21, 0x79, 0xf4,
-	0xfc, 0x69, 0xaf, 0x53, 0x56, 0xbd, 0xc7, 0xde, 0xc7, 0x1f, 0x1e, 0xb7, 0xcb, 0xda, 0xc1, 0x0e,
-	0x94, 0x2c, 0xa7, 0x39, 0xb7, 0x18, 0xa1, 0x54, 0xfc, 0x53, 0xe6, 0x24, 0xc5, 0x7f, 0xde, 0xfd,
-	0x7f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xe8, 0x09, 0x06, 0xcb, 0x72, 0x23, 0x00, 0x00,
+	0x15, 0x4e, 0x77, 0xfb, 0x7a, 0xda, 0xb7, 0xa9, 0xf5, 0x6e, 0x1c, 0x67, 0xd8, 0x71, 0x1a, 0x46,
+	0x71, 0x36, 0x23, 0x87, 0x38, 0xdc, 0x84, 0x90, 0xc2, 0x8e, 0x77, 0x88, 0xac, 0xec, 0x5c, 0x28,
+	0x7b, 0x13, 0x90, 0x88, 0x5a, 0x3d, 0x76, 0x69, 0xb6, 0xb1, 0xdd, 0xed, 0x74, 0x95, 0x1d, 0x86,
+	0x07, 0x94, 0x7f, 0x10, 0xf1, 0x80, 0x84, 0x22, 0x24, 0x84, 0x84, 0xc4, 0x13, 0x3c, 0x22, 0x01,
+	0x2f, 0xbc, 0xf1, 0x88, 0x78, 0xe2, 0x9d, 0x3f, 0x80, 0xc4, 0x2f, 0x40, 0x5d, 0x55, 0x7d, 0x71,
+	0xcf, 0xcd, 0xe3, 0x99, 0x59, 0x79, 0x9f, 0xdc, 0x75, 0xaa, 0xea, 0xd4, 0x39, 0xdf, 0xf9, 0xea,
+	0xd4, 0xe9, 0x6a, 0x43, 0x61, 0xce, 0x4e, 0x2c, 0x46, 0x5a, 0x53, 0xcf, 0x65, 0x2e, 0xca, 0x88,
+	0x56, 0x5d, 0xff, 0x74, 0x46, 0xbc, 0x53, 0x21, 0xac, 0x97, 0x98, 0x3b, 0x75, 0x87, 0x16, 0xb3,
+	0x64, 0x5b, 0x9f, 0x33, 0x6f, 0x3a, 0x10, 0x0d, 0xe3, 0x4f, 0x29, 0xc8, 0xf6, 0x08, 0xa5, 0xb6,
+	0xeb, 0xa0, 0x6d, 0x28, 0xd9, 0x8e, 0xc9, 0x3c, 0xcb, 0xa1, 0xd6, 0x80, 0xd9, 0xae, 0x53, 0x53,
+	0x1a, 0x4a, 0x33, 0x87, 0x8b, 0xb6, 0xd3, 0x8f, 0x84, 0xa8, 0x03, 0x25, 0xfa, 0xdc, 0xf2, 0x86,
+	0x26, 0x15, 0xf3, 0x68, 0x4d, 0x6d, 0x68, 0x4d, 0xbd, 0xbd, 0xd9, 0x92, 0xb6, 0x48, 0x7d, 0xad,
+	0x9e, 0x3f, 0x4a, 0x36, 0x70, 0x91, 0xc6, 0x5a, 0x14, 0xbd, 0x0e, 0x79, 0x6a, 0x3b, 0x27, 0x63,
+	0x62, 0x0e, 0x8f, 0x6b, 0x1a, 0x5f, 0x26, 0x27, 0x04, 0x4f, 0x8e, 0xd1, 0x43, 0x00, 0x6b, 0xc6,
+	0xdc, 0x81, 0x3b, 0x99, 0xd8, 0xac, 0x96, 0xe2, 0xbd, 0x31, 0x09, 0xfa, 0x2a, 0x14, 0x99, 0xe5,
+	0x9d, 0x10, 0x66, 0x52, 0xe6, 0xd9, 0xce, 0x49, 0x2d, 0xdd, 0x50, 0x9a, 0x79, 0x5c, 0x10, 0xc2,
+	0x1e, 0x97, 0xa1, 0x77, 0x20, 0xeb, 0x4e, 0x19, 0xb7, 0x2f, 0xd3, 0x50, 0x9a, 0x7a, 0xfb, 0x7e,
+	0x4b, 0xa0, 0xb2, 0xf7, 0x33, 0x32, 0x98, 0x31, 0x72, 0x28, 0x3a, 0x71, 0x30, 0x0a, 0xed, 0x42,
+	0x25, 0xe6, 0xbb, 0x39, 0x71, 0x87, 0xa4, 0x96, 0x6d, 0x28, 0xcd, 0x52, 0xfb, 0xd5, 0xc0, 0xb3,
+	0x18, 0x0c, 0xfb, 0xee, 0x90, 0xe0, 0x32, 0x5b, 0x14, 0xa0, 0xf7, 0xa1, 0x30, 0xf5, 0x48, 0x84,
+	0x4c, 0x6e, 0x09, 0x64, 0xf4, 0xa9, 0x47, 0x42, 0x5c, 0x1e, 0x43, 0x71, 0xea, 0x52, 0x16, 0x69,
+	0xc8, 0x2f, 0xa1, 0xa1, 0xe0, 0x4f, 0x09, 0x54, 0xd4, 0x7f, 0x02, 0x85, 0x78, 0x2f, 0xda, 0x86,
+	0x8c, 0x00, 0x86, 0x87, 0x53, 0x6f, 0x17, 0x25, 0x0e, 0x7d, 0x2e, 0xc4, 0xb2, 0xd3, 0x8f, 0x7e,
+	0xdc, 0x7d, 0x7b, 0x58, 0x53, 0x1b, 0x4a, 0x53, 0xc3, 0xc5, 0x98, 0xb4, 0x3b, 0x34, 0xfe, 0xa9,
+	0x42, 0x49, 0x22, 0x88, 0xc9, 0xa7, 0x33, 0x42, 0x19, 0xda, 0x81, 0xfc, 0xc0, 0x1a, 0x8f, 0x89,
+	0xe7, 0x4f, 0x12, 0x6b, 0x94, 0x5b, 0x82, 0x64, 0x1d, 0x2e, 0xef, 0x3e, 0xc1, 0x39, 0x31, 0xa2,
+	0x3b, 0x44, 0x6f, 0x41, 0x56, 0x3a, 0x57, 0x53, 0xc3, 0xb1, 0x71, 0xdf, 0x70, 0xd0, 0x8f, 0xde,
+	0x84, 0x34, 0x37, 0x95, 0x13, 0x44, 0x6f, 0x6f, 0x48, 0xc3, 0x77, 0xdd, 0x99, 0x33, 0xfc, 0xa1,
+	0xff, 0x88, 0x45, 0x3f, 0xfa, 0x26, 0xe8, 0xcc, 0x3a, 0x1e, 0x13, 0x66, 0xb2, 0xd3, 0x29, 0xe1,
+	0x8c, 0x29, 0xb5, 0xab, 0xad, 0x90, 0xf8, 0x7d, 0xde, 0xd9, 0x3f, 0x9d, 0x12, 0x0c, 0x2c, 0x7c,
+	0x46, 0x3b, 0x80, 0x1c, 0x97, 0x99, 0x09, 0xd2, 0xa7, 0x39, 0xdf, 0x2a, 0x8e, 0xcb, 0xba, 0x0b,
+	0xbc, 0xdf, 0x86, 0xd2, 0x88, 0x9c, 0xd2, 0xa9, 0x35, 0x20, 0x26, 0x27, 0x33, 0xe7, 0x55, 0x1e,
+	0x17, 0x03, 0x29, 0x47, 0x3d, 0xce, 0xbb, 0xec, 0x32, 0xbc, 0x33, 0xbe, 0x50, 0xa0, 0x1c, 0x22,
+	0x4a, 0xa7, 0xae, 0x43, 0x09, 0xda, 0x86, 0x34, 0xf1, 0x3c, 0xd7, 0x4b, 0xc0, 0x89, 0x8f, 0x3a,
+	0x7b, 0xbe, 0x18, 0x8b, 0xde, 0xeb, 0x60, 0xf9, 0x08, 0x32, 0x1e, 0xa1, 0xb3, 0x31, 0x93, 0x60,
+	0x22, 0x69, 0x95, 0xc0, 0x91, 0xf7, 0x60, 0x39, 0xc2, 0xf8, 0x8f, 0x0a, 0x55, 0x69, 0x11, 0xf7,
+	0x89, 0xae, 0x4f, 0xa4, 0xeb, 0x90, 0x0b, 0xe0, 0xe6, 0x61, 0xce, 0xe3, 0xb0, 0x8d, 0x1e, 0x40,
+	0x86, 0xc7, 0x85, 0xd6, 0xd2, 0x0d, 0xad, 0x99, 0xc7, 0xb2, 0x95, 0x64, 0x47, 0xe6, 0x46, 0xec,
+	0xc8, 0x5e, 0xc0, 0x8e, 0x58, 0xd8, 0x73, 0x4b, 0x85, 0xfd, 0x57, 0x0a, 0xdc, 0x4f, 0x80, 0xbc,
+	0x16, 0xc1, 0xff, 0x9f, 0x0a, 0xaf, 0x49, 0xbb, 0x3e, 0x94, 0xc8, 0x76, 0x5f, 0x16, 0x06, 0xbc,
+	0x01, 0x85, 0x70, 0x8b, 0xda, 0x92, 0x07, 0x05, 0xac, 0x8f, 0x22, 0x3f, 0xd6, 0x94, 0x0c, 0x5f,
+	0x2a, 0x50, 0x3f, 0x0f, 0xf4, 0xb5, 0x60, 0xc4, 0xe7, 0x1a, 0xbc, 0x1a, 0x19, 0x87, 0x2d, 0xe7,
+	0x84, 0xbc, 0x24, 0x7c, 0x78, 0x17, 0x60, 0x44, 0x4e, 0x4d, 0x8f, 0x9b, 0xcc, 0xd9, 0xe0, 0x7b,
+	0x1a, 0xc6, 0x3a, 0xf0, 0x06, 0xe7, 0x47, 0xf2, 0x69, 0x5d, 0xf9, 0xf1, 0x6b, 0x05, 0x6a, 0x67,
+	0x43, 0xb0, 0x16, 0xec, 0xf8, 0x4b, 0x2a, 0x64, 0xc7, 0x9e, 0xc3, 0x6c, 0x76, 0xfa, 0xd2, 0x64,
+	0x8b, 0x1d, 0x40, 0x84, 0x5b, 0x6c, 0x0e, 0xdc, 0xf1, 0x6c, 0xe2, 0x98, 0x8e, 0x35, 0x21, 0xb2,
+	0x96, 0xac, 0x88, 0x9e, 0x0e, 0xef, 0x38, 0xb0, 0x26, 0x04, 0xfd, 0x08, 0xee, 0xc9, 0xd1, 0x0b,
+	0x29, 0x26, 0xc3, 0x49, 0xd5, 0x0c, 0x2c, 0xbd, 0x00, 0x89, 0x56, 0x20, 0xc0, 0x1b, 0x42, 0xc9,
+	0x87, 0x17, 0xa7, 0xa4, 0xec, 0x8d, 0x28, 0x97, 0xbb, 0x9a, 0x72, 0xf9, 0x65, 0x28, 0x57, 0x3f,
+	0x86, 0x5c, 0x60, 0x34, 0xda, 0x82, 0x14, 0x37, 0x4d, 0xe1, 0xa6, 0xe9, 0x41, 0x01, 0xe9, 0x5b,
+	0xc4, 0x3b, 0x50, 0x15, 0xd2, 0x73, 0x6b, 0x3c, 0x23, 0x3c, 0x70, 0x05, 0x2c, 0x1a, 0x68, 0x0b,
+	0xf4, 0x18, 0x56, 0x3c, 0x56, 0x05, 0x0c, 0x51, 0x36, 0x8e, 0xd3, 0x3a, 0x86, 0xd8, 0x5a, 0xd0,
+	0xfa, 0x5f, 0x2a, 0xdc, 0x93, 0xa6, 0xed, 0x5a, 0x6c, 0xf0, 0xfc, 0xce, 0x29, 0xfd, 0x36, 0x64,
+	0x7d, 0x6b, 0x6c, 0x42, 0x6b, 0x5a, 0x43, 0x3b, 0x9f, 0xd4, 0xc1, 0x88, 0x55, 0x0b, 0xde, 0x6d,
+	0x28, 0x59, 0xf4, 0x9c, 0x62, 0xb7, 0x68, 0xd1, 0x17, 0x51, 0xe9, 0x7e, 0xa9, 0x40, 0x75, 0x11,
+	0xd3, 0x3b, 0x0b, 0xf5, 0xd7, 0x21, 0x2b, 0x02, 0x19, 0xa0, 0xf9, 0x40, 0xda, 0x26, 0xc2, 0xfc,
+	0xb1, 0xcd, 0x9e, 0x0b, 0xd5, 0xc1, 0x30, 0xc3, 0x81, 0x32, 0x47, 0x9a, 0xfb, 0xc6, 0xe1, 0x8e,
+	0xb2, 0x8c, 0x72, 0x8d, 0x2c, 0xa3, 0x5e, 0x58, 0x95, 0x6a, 0xf1, 0xaa, 0xd4, 0xf8, 0x73, 0x54,
+	0x67, 0x71, 0x30, 0x5e, 0x50, 0xa5, 0xfd, 0x6e, 0x92, 0x66, 0xe1, 0xcb, 0x6d, 0xc2, 0xfb, 0x17,
+	0x45, 0xb6, 0xeb, 0xbe, 0xa7, 0x1b, 0xbf, 0x89, 0x6a, 0xa5, 0x05, 0xe0, 0xee, 0x8c, 0x4b, 0x3b,
+	0x49, 0x2e, 0x9d, 0x97, 0x37, 0x42, 0x1e, 0xfd, 0x02, 0xaa, 0x1c, 0xc9, 0x28, 0xc3, 0xdf, 0x22,
+	0x99, 0x92, 0x05, 0xae, 0x76, 0xa6, 0xc0, 0x35, 0xfe, 0xae, 0xc2, 0xc3, 0x38, 0x3c, 0x2f, 0xb2,
+	0x88, 0xff, 0x56, 0x92, 0x5c, 0x9b, 0x0b, 0xe4, 0x4a, 0x40, 0xb2, 0xb6, 0x0c, 0xfb, 0x9d, 0x02,
+	0x5b, 0x17, 0x42, 0xb8, 0x26, 0x34, 0xfb, 0x83, 0x0a, 0xd5, 0x1e, 0xf3, 0x88, 0x35, 0xb9, 0xd1,
+	0x6d, 0x4c, 0xc8, 0x4a, 0xf5, 0x7a, 0x57, 0x2c, 0xda, 0xf2, 0x21, 0x4a, 0x1c, 0x25, 0xa9, 0x2b,
+	0x8e, 0x92, 0xf4, 0x52, 0x97, 0x75, 0x31, 0x5c, 0x33, 0x97, 0xe3, 0x6a, 0x74, 0xe0, 0x7e, 0x02,
+	0x28, 0x19, 0xc2, 0xa8, 0x1c, 0x50, 0xae, 0x2c, 0x07, 0xbe, 0x50, 0xa1, 0xbe, 0xa0, 0xe5, 0x26,
+	0xe9, 0x7a, 0x69, 0xd0, 0xe3, 0xa9, 0x40, 0xbb, 0xf0, 0x5c, 0x49, 0x5d, 0x76, 0xdb, 0x91, 0x5e,
+	0x32, 0x50, 0xd7, 0xde, 0x24, 0x5d, 0x78, 0xfd, 0x5c, 0x40, 0x56, 0x00, 0xf7, 0xb7, 0x2a, 0x6c,
+	0x2d, 0xe8, 0xba, 0x71, 0xce, 0xba, 0x15, 0x84, 0x93, 0xc9, 0x36, 0x75, 0xe5, 0x6d, 0xc2, 0x9d,
+	0x81, 0x7d, 0x00, 0x8d, 0x8b, 0x01, 0x5a, 0x01, 0xf1, 0x3f, 0xaa, 0xf0, 0x95, 0xa4, 0xc2, 0x9b,
+	0xbc, 0xd8, 0xdf, 0x0a, 0xde, 0x8b, 0x6f, 0xeb, 0xa9, 0x15, 0xde, 0xd6, 0xef, 0x0c, 0xff, 0xa7,
+	0xf0, 0xf0, 0x22, 0xb8, 0x56, 0x40, 0xff, 0xc7, 0x50, 0xd8, 0x25, 0x27, 0xb6, 0xb3, 0x1a, 0xd6,
+	0x0b, 0x9f, 0x4e, 0xd4, 0xc5, 0x4f, 0x27, 0xc6, 0x77, 0xa1, 0x28, 0x55, 0x4b, 0xbb, 0x62, 0x89,
+	0x52, 0xb9, 0x22, 0x51, 0x7e, 0xae, 0x40, 0xb1, 0xc3, 0xbf, 0xb0, 0xdc, 0x79, 0xa1, 0xf0, 0x00,
+	0x32, 0x16, 0x73, 0x27, 0xf6, 0x40, 0x7e, 0xfb, 0x91, 0x2d, 0xa3, 0x02, 0xa5, 0xc0, 0x02, 0x61,
+	0xbf, 0xf1, 0x53, 0x28, 0x63, 0x77, 0x3c, 0x3e, 0xb6, 0x06, 0xa3, 0xbb, 0xb6, 0xca, 0x40, 0x50,
+	0x89, 0xd6, 0x92, 0xeb, 0x7f, 0x02, 0xaf, 0x61, 0x42, 0xdd, 0xf1, 0x9c, 0xc4, 0x4a, 0x8a, 0xd5,
+	0x2c, 0x41, 0x90, 0x1a, 0x32, 0xf9, 0x5d, 0x25, 0x8f, 0xf9, 0xb3, 0xf1, 0x37, 0x05, 0xaa, 0xfb,
+	0x84, 0x52, 0xeb, 0x84, 0x08, 0x82, 0xad, 0xa6, 0xfa, 0xb2, 0x9a, 0xb1, 0x0a, 0x69, 0x71, 0xf2,
+	0x8a, 0xfd, 0x26, 0x1a, 0xe8, 0x1d, 0xc8, 0x87, 0x9b, 0xad, 0x96, 0x92, 0x94, 0x3d, 0xbb, 0xd7,
+	0x72, 0xc1, 0x5e, 0xf3, 0xad, 0x8f, 0xdd, 0x8f, 0xf0, 0x67, 0xe3, 0x97, 0x0a, 0x6c, 0x48, 0xeb,
+	0x1f, 0x0f, 0x46, 0xb7, 0x6f, 0x7a, 0xb0, 0xa6, 0x16, 0xad, 0x89, 0x1e, 0x82, 0x16, 0x24, 0x63,
+	0xbd, 0x5d, 0x90, 0xbb, 0xec, 0x23, 0xff, 0xbe, 0x01, 0xfb, 0x1d, 0xc6, 0x3e, 0x14, 0xba, 0xb1,
+	0x4a, 0x13, 0x6d, 0x82, 0x1a, 0x9a, 0xb1, 0x38, 0x5c, 0xb5, 0x87, 0xc9, 0x2b, 0x0a, 0xf5, 0xcc,
+	0x15, 0xc5, 0x5f, 0x15, 0xd8, 0x8c, 0x5c, 0xbc, 0xf1, 0xc1, 0x74, 0x5d, 0x6f, 0xbf, 0x07, 0x65,
+	0x7b, 0x68, 0x9e, 0x39, 0x86, 0xf4, 0x76, 0x35, 0x60, 0x71, 0xdc, 0x59, 0x5c, 0xb4, 0x63, 0x2d,
+	0x6a, 0x6c, 0x42, 0xfd, 0x3c, 0xf2, 0x4a, 0x6a, 0xff, 0x57, 0x85, 0x8d, 0xde, 0x74, 0x6c, 0x33,
+	0x99, 0xa3, 0x6e, 0xdb, 0x9f, 0xa5, 0x2f, 0xe9, 0xde, 0x80, 0x02, 0xf5, 0xed, 0x90, 0xf7, 0x70,
+	0xb2, 0xa0, 0xd1, 0xb9, 0x4c, 0xdc, 0xc0, 0xf9, 0x71, 0x0a, 0x86, 0xcc, 0x1c, 0xc6, 0x49, 0xa8,
+	0x61, 0x90, 0x23, 0x66, 0x0e, 0x43, 0xdf, 0x80, 0x57, 0x9d, 0xd9, 0xc4, 0xf4, 0xdc, 0xcf, 0xa8,
+	0x39, 0x25, 0x9e, 0xc9, 0x35, 0x9b, 0x53, 0xcb, 0x63, 0x3c, 0xc5, 0x6b, 0xf8, 0x9e, 0x33, 0x9b,
+	0x60, 0xf7, 0x33, 0x7a, 0x44, 0x3c, 0xbe, 0xf8, 0x91, 0xe5, 0x31, 0xf4, 0x7d, 0xc8, 0x5b, 0xe3,
+	0x13, 0xd7, 0xb3, 0xd9, 0xf3, 0x89, 0xbc, 0x78, 0x33, 0xa4, 0x99, 0x67, 0x90, 0x69, 0x3d, 0x0e,
+	0x46, 0xe2, 0x68, 0x12, 0x7a, 0x1b, 0xd0, 0x8c, 0x12, 0x53, 0x18, 0x27, 0x16, 0x9d, 0xb7, 0xe5,
+	0x2d, 0x5c, 0x79, 0x46, 0x49, 0xa4, 0xe6, 0xa3, 0xb6, 0xf1, 0x0f, 0x0d, 0x50, 0x5c, 0xaf, 0xcc,
+	0xd1, 0xdf, 0x86, 0x0c, 0x9f, 0x4f, 0x6b, 0x0a, 0x8f, 0xed, 0x56, 0x98, 0xa1, 0xce, 0x8c, 0x6d,
+	0xf9, 0x66, 0x63, 0x39, 0xbc, 0xfe, 0x09, 0x14, 0x82, 0x9d, 0xca, 0xdd, 0x89, 0x47, 0x43, 0xb9,
+	0xf4, 0x74, 0x55, 0x97, 0x38, 0x5d, 0xeb, 0xef, 0x43, 0x9e, 0x57, 0x75, 0x57, 0xea, 0x8e, 0x6a,
+	0x51, 0x35, 0x5e, 0x8b, 0xd6, 0xff, 0xad, 0x40, 0x8a, 0x4f, 0x5e, 0xfa, 0xe5, 0x77, 0x1f, 0x4a,
+	0xa1, 0x95, 0x22, 0x7a, 0x22, 0x69, 0xbf, 0x79, 0x09, 0x24, 0x71, 0x08, 0x70, 0x61, 0x14, 0x6b,
+	0xa1, 0x0e, 0x80, 0xf8, 0xaf, 0x02, 0x57, 0x25, 0x78, 0xf8, 0xb5, 0x4b, 0x54, 0x85, 0xee, 0xe2,
+	0x3c, 0x0d, 0x3d, 0x47, 0x90, 0xa2, 0xf6, 0xcf, 0x45, 0x96, 0xd4, 0x30, 0x7f, 0x36, 0xde, 0x83,
+	0xfb, 0x1f, 0x10, 0xd6, 0xf3, 0xe6, 0xc1, 0x76, 0x0b, 0xb6, 0xcf, 0x25, 0x30, 0x19, 0x18, 0x1e,
+	0x24, 0x27, 0x49, 0x06, 0x7c, 0x07, 0x0a, 0xd4, 0x9b, 0x9b, 0x0b, 0x33, 0xfd, 0xaa, 0x24, 0x0c,
+	0x4f, 0x7c, 0x92, 0x4e, 0xa3, 0x86, 0xf1, 0x7b, 0x15, 0xee, 0x3d, 0x9b, 0x0e, 0x2d, 0xb6, 0xee,
+	0xe7, 0xc7, 0x8a, 0xa5, 0xda, 0x26, 0xe4, 0x99, 0x3d, 0x21, 0x94, 0x59, 0x93, 0xa9, 0xdc, 0xc9,
+	0x91, 0xc0, 0xe7, 0x15, 0x99, 0x13, 0x87, 0xd5, 0xb2, 0x0b, 0xbc, 0xda, 0xf3, 0x65, 0x7d, 0x77,
+	0x44, 0x1c, 0x2c, 0xfa, 0x8d, 0x11, 0x54, 0x17, 0x51, 0x92, 0xc0, 0x37, 0x03, 0x05, 0x8b, 0x55,
+	0x9b, 0x2c, 0xf6, 0xfc, 0x1e, 0xa9, 0x01, 0xbd, 0x05, 0x15, 0x8f, 0xd0, 0xd9, 0x84, 0x98, 0x91,
+	0x3d, 0xe2, 0x1f, 0x12, 0x65, 0x21, 0xef, 0x07, 0xe2, 0x47, 0x4f, 0xa0, 0x9c, 0xf8, 0xa7, 0x08,
+	0x2a, 0x83, 0xfe, 0xec, 0xa0, 0x77, 0xb4, 0xd7, 0xe9, 0xfe, 0xa0, 0xbb, 0xf7, 0xa4, 0xf2, 0x0a,
+	0x02, 0xc8, 0xf4, 0xba, 0x07, 0x1f, 0x3c, 0xdd, 0xab, 0x28, 0x28, 0x0f, 0xe9, 0xfd, 0x67, 0x4f,
+	0xfb, 0xdd, 0x8a, 0xea, 0x3f, 0xf6, 0x3f, 0x3e, 0x3c, 0xea, 0x54, 0xb4, 0x47, 0x3b, 0xa0, 0x8b,
+	0x5a, 0xe8, 0xd0, 0x1b, 0x12, 0xcf, 0x9f, 0x70, 0x70, 0x88, 0xf7, 0x1f, 0x3f, 0xad, 0xbc, 0x82,
+	0xb2, 0xa0, 0x1d, 0x61, 0x7f, 0x66, 0x0e, 0x52, 0x47, 0x87, 0xbd, 0x7e, 0x45, 0xdd, 0xdd, 0x80,
+	0xb2, 0xed, 0xb6, 0xe6, 0x36, 0x23, 0x94, 0x8a, 0xff, 0xf6, 0x1c, 0x67, 0xf8, 0xcf, 0x7b, 0xff,
+	0x1f, 0x00, 0x6f, 0x52, 0x0a, 0x9a, 0x24, 0x24, 0x00, 0x00,
 }
@@ -74,6 +74,9 @@ type ExecuteResult struct {
 	Sqls           []string
 	ExecutorErr    string
 	TotalTimeSpent time.Duration
+	// MigrationUUIDs are the UUIDs of the online schema changes
+	// that were queued, in the order of Sqls.
+	MigrationUUIDs []string
 }
 
 // ShardWithError contains information why a shard failed to execute given sql
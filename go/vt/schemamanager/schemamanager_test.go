@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"golang.org/x/net/context"
@@ -237,6 +238,7 @@ func newFakeTabletManagerClient() *fakeTabletManagerClient {
 		TabletManagerClient: faketmclient.NewFakeTabletManagerClient(),
 		preflightSchemas:    make(map[string]*tabletmanagerdatapb.SchemaChangeResult),
 		schemaDefinitions:   make(map[string]*tabletmanagerdatapb.SchemaDefinition),
+		dbaQueries:          make(map[string][]string),
 	}
 }
 
@@ -245,6 +247,11 @@ type fakeTabletManagerClient struct {
 	EnableExecuteFetchAsDbaError bool
 	preflightSchemas             map[string]*tabletmanagerdatapb.SchemaChangeResult
 	schemaDefinitions            map[string]*tabletmanagerdatapb.SchemaDefinition
+
+	// mu protects dbaQueries, the queries of ExecuteFetchAsDba
+	// by shard.
+	mu         sync.Mutex
+	dbaQueries map[string][]string
 }
 
 func (client *fakeTabletManagerClient) AddSchemaChange(sql string, schemaResult *tabletmanagerdatapb.SchemaChangeResult) {
@@ -281,6 +288,9 @@ func (client *fakeTabletManagerClient) ExecuteFetchAsDba(ctx context.Context, ta
 	if client.EnableExecuteFetchAsDbaError {
 		return nil, fmt.Errorf("ExecuteFetchAsDba occur an unknown error")
 	}
+	client.mu.Lock()
+	client.dbaQueries[tablet.Shard] = append(client.dbaQueries[tablet.Shard], string(query))
+	client.mu.Unlock()
 	return client.TabletManagerClient.ExecuteFetchAsDba(ctx, tablet, usePool, query, maxRows, disableBinlogs, reloadSchema)
 }
 
@@ -1092,7 +1092,7 @@ func (shardSwap *shardSchemaSwap) takeSeedBackup() (err error) {
 	}
 
 	shardSwap.addShardLog(fmt.Sprintf("Taking backup on the seed tablet %v", seedTablet.Alias))
-	eventStream, err := shardSwap.parent.tabletClient.Backup(shardSwap.parent.ctx, seedTablet, *backupConcurrency)
+	eventStream, err := shardSwap.parent.tabletClient.Backup(shardSwap.parent.ctx, seedTablet, *backupConcurrency, false /* incremental */)
 	if err != nil {
 		return err
 	}
@@ -1117,7 +1117,7 @@ waitForBackup:
 // to become healthy and to catch up with replication.
 func (shardSwap *shardSchemaSwap) swapOnTablet(tablet *topodatapb.Tablet) error {
 	shardSwap.addPropagationLog(fmt.Sprintf("Restoring tablet %v from backup", tablet.Alias))
-	eventStream, err := shardSwap.parent.tabletClient.RestoreFromBackup(shardSwap.parent.ctx, tablet)
+	eventStream, err := shardSwap.parent.tabletClient.RestoreFromBackup(shardSwap.parent.ctx, tablet, "" /* restoreToPos */, 0 /* restoreToTimeNS */)
 	if err != nil {
 		return err
 	}
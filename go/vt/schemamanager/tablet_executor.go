@@ -26,8 +26,10 @@ import (
 	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/vt/mysqlctl/tmutils"
 	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
 	"vitess.io/vitess/go/vt/wrangler"
 
+	querypb "vitess.io/vitess/go/vt/proto/query"
 	tabletmanagerdatapb "vitess.io/vitess/go/vt/proto/tabletmanagerdata"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 )
@@ -41,6 +43,7 @@ type TabletExecutor struct {
 	allowBigSchemaChange bool
 	keyspace             string
 	waitSlaveTimeout     time.Duration
+	ddlStrategy          string
 }
 
 // NewTabletExecutor creates a new TabletExecutor instance
@@ -50,6 +53,7 @@ func NewTabletExecutor(wr *wrangler.Wrangler, waitSlaveTimeout time.Duration) *T
 		isClosed:             true,
 		allowBigSchemaChange: false,
 		waitSlaveTimeout:     waitSlaveTimeout,
+		ddlStrategy:          onlineddl.StrategyDirect,
 	}
 }
 
@@ -65,6 +69,23 @@ func (exec *TabletExecutor) DisallowBigSchemaChange() {
 	exec.allowBigSchemaChange = false
 }
 
+// SetDDLStrategy changes how TabletExecutor applies the ALTER TABLE
+// statements: onlineddl.StrategyDirect runs them on the masters,
+// onlineddl.StrategyOnline queues them as online schema changes.
+func (exec *TabletExecutor) SetDDLStrategy(ddlStrategy string) error {
+	switch ddlStrategy {
+	case onlineddl.StrategyDirect, onlineddl.StrategyOnline:
+		exec.ddlStrategy = ddlStrategy
+		return nil
+	}
+	return fmt.Errorf("unknown ddl_strategy: %v, want %v or %v", ddlStrategy, onlineddl.StrategyDirect, onlineddl.StrategyOnline)
+}
+
+// isOnline returns true if ddl is queued as an online schema change.
+func (exec *TabletExecutor) isOnline(ddl *sqlparser.DDL) bool {
+	return exec.ddlStrategy == onlineddl.StrategyOnline && ddl.Action == sqlparser.AlterStr
+}
+
 // Open opens a connection to the master for every shard.
 func (exec *TabletExecutor) Open(ctx context.Context, keyspace string) error {
 	if !exec.isClosed {
@@ -124,6 +145,14 @@ func (exec *TabletExecutor) Validate(ctx context.Context, sqls []string) error {
 	if err != nil {
 		return err
 	}
+	for i, ddl := range parsedDDLs {
+		if !exec.isOnline(ddl) {
+			continue
+		}
+		if _, err := onlineddl.ParseAlterTable(sqls[i]); err != nil {
+			return err
+		}
+	}
 
 	bigSchemaChange, err := exec.detectBigSchemaChanges(ctx, parsedDDLs)
 	if bigSchemaChange && exec.allowBigSchemaChange {
@@ -156,6 +185,10 @@ func (exec *TabletExecutor) detectBigSchemaChanges(ctx context.Context, parsedDD
 		case sqlparser.DropStr, sqlparser.CreateStr, sqlparser.TruncateStr:
 			continue
 		}
+		if exec.isOnline(ddl) {
+			// The online schema changes don't lock the table.
+			continue
+		}
 		tableName := ddl.Table.Name.String()
 		if rowCount, ok := tableWithCount[tableName]; ok {
 			if rowCount > 100000 && ddl.Action == sqlparser.AlterStr {
@@ -233,10 +266,19 @@ func (exec *TabletExecutor) Execute(ctx context.Context, sqls []string) *Execute
 		execResult.ExecutorErr = err.Error()
 		return &execResult
 	}
+	parsedDDLs, err := parseDDLs(sqls)
+	if err != nil {
+		execResult.ExecutorErr = err.Error()
+		return &execResult
+	}
 
 	for index, sql := range sqls {
 		execResult.CurSQLIndex = index
-		exec.executeOnAllTablets(ctx, &execResult, sql)
+		if exec.isOnline(parsedDDLs[index]) {
+			exec.queueOnAllTablets(ctx, &execResult, sql, parsedDDLs[index].Table.Name.String())
+		} else {
+			exec.executeOnAllTablets(ctx, &execResult, sql)
+		}
 		if len(execResult.FailedShards) > 0 {
 			break
 		}
@@ -244,30 +286,53 @@ func (exec *TabletExecutor) Execute(ctx context.Context, sqls []string) *Execute
 	return &execResult
 }
 
-func (exec *TabletExecutor) executeOnAllTablets(ctx context.Context, execResult *ExecuteResult, sql string) {
-	var wg sync.WaitGroup
-	numOfMasterTablets := len(exec.tablets)
-	wg.Add(numOfMasterTablets)
-	errChan := make(chan ShardWithError, numOfMasterTablets)
-	successChan := make(chan ShardResult, numOfMasterTablets)
-	for _, tablet := range exec.tablets {
-		go func(tablet *topodatapb.Tablet) {
-			defer wg.Done()
-			exec.executeOneTablet(ctx, tablet, sql, errChan, successChan)
-		}(tablet)
+// queueOnAllTablets queues sql as an online schema change on all the
+// masters, with the same UUID. The masters run it on their own, see
+// the onlineddl package.
+func (exec *TabletExecutor) queueOnAllTablets(ctx context.Context, execResult *ExecuteResult, sql, table string) {
+	uuid := onlineddl.CreateUUID()
+	exec.forAllTablets(execResult, func(tablet *topodatapb.Tablet, errChan chan ShardWithError, successChan chan ShardResult) {
+		exec.queueOneTablet(ctx, tablet, &onlineddl.Migration{
+			UUID:     uuid,
+			Keyspace: exec.keyspace,
+			Shard:    tablet.Shard,
+			Table:    table,
+			SQL:      sql,
+			Created:  time.Now().Unix(),
+		}, errChan, successChan)
+	})
+	if len(execResult.FailedShards) > 0 {
+		return
 	}
-	wg.Wait()
-	close(errChan)
-	close(successChan)
-	execResult.FailedShards = make([]ShardWithError, 0, len(errChan))
-	execResult.SuccessShards = make([]ShardResult, 0, len(successChan))
-	for e := range errChan {
-		execResult.FailedShards = append(execResult.FailedShards, e)
+	execResult.MigrationUUIDs = append(execResult.MigrationUUIDs, uuid)
+	exec.wr.Logger().Printf("Online schema migration %v queued on %v shards: %v\n", uuid, len(exec.tablets), sql)
+}
+
+func (exec *TabletExecutor) queueOneTablet(
+	ctx context.Context,
+	tablet *topodatapb.Tablet,
+	m *onlineddl.Migration,
+	errChan chan ShardWithError,
+	successChan chan ShardResult) {
+	var result *querypb.QueryResult
+	for _, query := range append(onlineddl.CreateSchemaMigrationsTable(), onlineddl.InsertMigration(m)) {
+		var err error
+		result, err = exec.wr.TabletManagerClient().ExecuteFetchAsDba(ctx, tablet, false, []byte(query), 0, false, false)
+		if err != nil {
+			errChan <- ShardWithError{Shard: tablet.Shard, Err: err.Error()}
+			return
+		}
 	}
-	for r := range successChan {
-		execResult.SuccessShards = append(execResult.SuccessShards, r)
+	successChan <- ShardResult{
+		Shard:  tablet.Shard,
+		Result: result,
 	}
+}
 
+func (exec *TabletExecutor) executeOnAllTablets(ctx context.Context, execResult *ExecuteResult, sql string) {
+	exec.forAllTablets(execResult, func(tablet *topodatapb.Tablet, errChan chan ShardWithError, successChan chan ShardResult) {
+		exec.executeOneTablet(ctx, tablet, sql, errChan, successChan)
+	})
 	if len(execResult.FailedShards) > 0 {
 		return
 	}
@@ -275,6 +340,7 @@ func (exec *TabletExecutor) executeOnAllTablets(ctx context.Context, execResult
 	// If all shards succeeded, wait (up to waitSlaveTimeout) for slaves to
 	// execute the schema change via replication. This is best-effort, meaning
 	// we still return overall success if the timeout expires.
+	var wg sync.WaitGroup
 	concurrency := sync2.NewSemaphore(10, 0)
 	reloadCtx, cancel := context.WithTimeout(ctx, exec.waitSlaveTimeout)
 	defer cancel()
@@ -288,6 +354,33 @@ func (exec *TabletExecutor) executeOnAllTablets(ctx context.Context, execResult
 	wg.Wait()
 }
 
+// forAllTablets runs f on all the masters in parallel, and saves
+// their results in execResult.
+func (exec *TabletExecutor) forAllTablets(execResult *ExecuteResult, f func(tablet *topodatapb.Tablet, errChan chan ShardWithError, successChan chan ShardResult)) {
+	var wg sync.WaitGroup
+	numOfMasterTablets := len(exec.tablets)
+	wg.Add(numOfMasterTablets)
+	errChan := make(chan ShardWithError, numOfMasterTablets)
+	successChan := make(chan ShardResult, numOfMasterTablets)
+	for _, tablet := range exec.tablets {
+		go func(tablet *topodatapb.Tablet) {
+			defer wg.Done()
+			f(tablet, errChan, successChan)
+		}(tablet)
+	}
+	wg.Wait()
+	close(errChan)
+	close(successChan)
+	execResult.FailedShards = make([]ShardWithError, 0, len(errChan))
+	execResult.SuccessShards = make([]ShardResult, 0, len(successChan))
+	for e := range errChan {
+		execResult.FailedShards = append(execResult.FailedShards, e)
+	}
+	for r := range successChan {
+		execResult.SuccessShards = append(execResult.SuccessShards, r)
+	}
+}
+
 func (exec *TabletExecutor) executeOneTablet(
 	ctx context.Context,
 	tablet *topodatapb.Tablet,
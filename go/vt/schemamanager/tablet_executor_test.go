@@ -17,6 +17,7 @@ limitations under the License.
 package schemamanager
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -28,6 +29,7 @@ import (
 	tabletmanagerdatapb "vitess.io/vitess/go/vt/proto/tabletmanagerdata"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 	"vitess.io/vitess/go/vt/topo/memorytopo"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
 	"vitess.io/vitess/go/vt/wrangler"
 )
 
@@ -194,3 +196,73 @@ func TestTabletExecutorExecute_PreflightWithoutChangesIsAnError(t *testing.T) {
 		t.Fatalf("execute should fail, ddl does not introduce any table schema change")
 	}
 }
+
+func TestTabletExecutorExecuteOnline(t *testing.T) {
+	alter := "ALTER TABLE test_table ADD COLUMN new_id bigint(20)"
+	create := "CREATE TABLE test_table_02 (pk int)"
+	fakeTmc := newFakeTabletManagerClient()
+	for _, sql := range []string{alter, create} {
+		fakeTmc.AddSchemaChange(sql, &tabletmanagerdatapb.SchemaChangeResult{
+			BeforeSchema: &tabletmanagerdatapb.SchemaDefinition{},
+			AfterSchema: &tabletmanagerdatapb.SchemaDefinition{
+				TableDefinitions: []*tabletmanagerdatapb.TableDefinition{{
+					Name:   "test_table",
+					Schema: sql,
+					Type:   tmutils.TableBaseTable,
+				}},
+			},
+		})
+	}
+	fakeTmc.AddSchemaDefinition("vt_test_keyspace", &tabletmanagerdatapb.SchemaDefinition{
+		TableDefinitions: []*tabletmanagerdatapb.TableDefinition{{
+			Name:     "test_table",
+			Schema:   "table schema",
+			Type:     tmutils.TableBaseTable,
+			RowCount: 3000000,
+		}},
+	})
+
+	wr := wrangler.New(logutil.NewConsoleLogger(), newFakeTopo(t), fakeTmc)
+	executor := NewTabletExecutor(wr, testWaitSlaveTimeout)
+	if err := executor.SetDDLStrategy("gh-ost"); err == nil {
+		t.Errorf("SetDDLStrategy(gh-ost) should fail")
+	}
+	if err := executor.SetDDLStrategy(onlineddl.StrategyOnline); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	executor.Open(ctx, "test_keyspace")
+	defer executor.Close()
+
+	// An online ALTER TABLE isn't a big schema change.
+	if err := executor.Validate(ctx, []string{alter, create}); err != nil {
+		t.Fatalf("executor.Validate should succeed, but got error: %v", err)
+	}
+	if err := executor.Validate(ctx, []string{"ALTER TABLE other_db.test_table ADD COLUMN new_id bigint(20)"}); err == nil {
+		t.Errorf("executor.Validate should fail, a qualified table cannot be changed online")
+	}
+
+	result := executor.Execute(ctx, []string{alter, create})
+	if result.ExecutorErr != "" || len(result.FailedShards) != 0 {
+		t.Fatalf("Execute failed: %v %v", result.ExecutorErr, result.FailedShards)
+	}
+	if len(result.MigrationUUIDs) != 1 {
+		t.Fatalf("MigrationUUIDs: %v, want one", result.MigrationUUIDs)
+	}
+
+	// Each master queues the ALTER TABLE with the same UUID, and
+	// runs the CREATE TABLE.
+	for _, shard := range []string{"0", "1", "2"} {
+		queries := fakeTmc.dbaQueries[shard]
+		if len(queries) != 4 {
+			t.Fatalf("queries of shard %v: %v, want 4", shard, queries)
+		}
+		want := fmt.Sprintf("VALUES ('%v', 'test_keyspace', '%v', 'test_table', '%v', 'queued', ", result.MigrationUUIDs[0], shard, alter)
+		if !strings.HasPrefix(queries[2], "INSERT INTO _vt.schema_migrations ") || !strings.Contains(queries[2], want) {
+			t.Errorf("queue query of shard %v: %v, want %v", shard, queries[2], want)
+		}
+		if queries[3] != create {
+			t.Errorf("last query of shard %v: %v, want %v", shard, queries[3], create)
+		}
+	}
+}
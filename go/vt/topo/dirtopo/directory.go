@@ -0,0 +1,73 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// ListDir is part of the topo.Conn interface.
+func (s *Server) ListDir(ctx context.Context, dirPath string, full bool) ([]topo.DirEntry, error) {
+	// ReadDir sorts the entries by name.
+	infos, err := ioutil.ReadDir(s.nodePath(dirPath))
+	if err != nil {
+		if os.IsNotExist(err) || isNotDir(err) {
+			return nil, topo.ErrNoNode
+		}
+		return nil, err
+	}
+
+	var result []topo.DirEntry
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			// Used by the implementation, not topology data.
+			continue
+		}
+		e := topo.DirEntry{
+			Name: info.Name(),
+		}
+		if full {
+			e.Type = topo.TypeFile
+			if info.IsDir() {
+				e.Type = topo.TypeDirectory
+			}
+		}
+		result = append(result, e)
+	}
+	if len(result) == 0 {
+		// Empty directories are removed by Delete, but they
+		// may still be there if a process died in between.
+		return nil, topo.ErrNoNode
+	}
+	return result, nil
+}
+
+// isNotDir returns true if err is caused by a path component
+// that is not a directory.
+func isNotDir(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.ENOTDIR
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// NewMasterParticipation is part of the topo.Server interface
+func (s *Server) NewMasterParticipation(name, id string) (topo.MasterParticipation, error) {
+	return &dirMasterParticipation{
+		electionPath: filepath.Join(s.root, electionsPath, name),
+		name:         name,
+		id:           id,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}, nil
+}
+
+// dirMasterParticipation implements topo.MasterParticipation.
+//
+// The master holds a flock on <root>/.elections/<name>, and writes its
+// id in the file.
+type dirMasterParticipation struct {
+	// electionPath is the path of the election file.
+	electionPath string
+
+	// name is the name of this MasterParticipation
+	name string
+
+	// id is the process's current id.
+	id string
+
+	// stop is a channel closed when Stop is called.
+	stop chan struct{}
+
+	// done is a channel closed when we're done processing the Stop
+	done chan struct{}
+}
+
+// WaitForMastership is part of the topo.MasterParticipation interface.
+func (mp *dirMasterParticipation) WaitForMastership() (context.Context, error) {
+	// If Stop was already called, mp.done is closed, so we are interrupted.
+	select {
+	case <-mp.done:
+		return nil, topo.ErrInterrupted
+	default:
+	}
+
+	// Try to lock until mp.stop is closed.
+	f, err := flock(mp.electionPath, mp.id, mp.stop)
+	if err != nil {
+		// We can't lock. See if it was because we got canceled.
+		select {
+		case <-mp.stop:
+			close(mp.done)
+		default:
+		}
+		return nil, err
+	}
+
+	// We have the lock, keep mastership until Stop is called:
+	// flock(2) locks cannot be lost.
+	lockCtx, lockCancel := context.WithCancel(context.Background())
+	go func() {
+		<-mp.stop
+		// Stop was called. We stop the context first,
+		// so the running process is not thinking it
+		// is the master any more, then we unlock.
+		lockCancel()
+		if err := funlock(f); err != nil {
+			log.Errorf("master election(%v) Unlock failed: %v", mp.name, err)
+		}
+		close(mp.done)
+	}()
+
+	return lockCtx, nil
+}
+
+// Stop is part of the topo.MasterParticipation interface
+func (mp *dirMasterParticipation) Stop() {
+	close(mp.stop)
+	<-mp.done
+}
+
+// GetCurrentMasterID is part of the topo.MasterParticipation interface
+func (mp *dirMasterParticipation) GetCurrentMasterID(ctx context.Context) (string, error) {
+	f, err := os.Open(mp.electionPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+
+	// If we can get a shared lock, there is no master.
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB)
+	switch err {
+	case nil:
+		return "", nil
+	case syscall.EWOULDBLOCK:
+	default:
+		return "", err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// convertError converts a context error into a topo error.
+func convertError(err error) error {
+	switch err {
+	case context.Canceled:
+		return topo.ErrInterrupted
+	case context.DeadlineExceeded:
+		return topo.ErrTimeout
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// generationSize is the size of the generation that starts each file.
+const generationSize = 8
+
+// Create is part of the topo.Conn interface.
+func (s *Server) Create(ctx context.Context, filePath string, contents []byte) (topo.Version, error) {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	nodePath := s.nodePath(filePath)
+	if _, err := os.Lstat(nodePath); err == nil {
+		return nil, topo.ErrNodeExists
+	}
+	if err := s.writeFile(nodePath, contents, 1); err != nil {
+		return nil, err
+	}
+	return DirVersion(1), nil
+}
+
+// Update is part of the topo.Conn interface.
+func (s *Server) Update(ctx context.Context, filePath string, contents []byte, version topo.Version) (topo.Version, error) {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	nodePath := s.nodePath(filePath)
+	_, generation, err := s.readFile(nodePath)
+	switch err {
+	case nil:
+		if version != nil && generation != uint64(version.(DirVersion)) {
+			return nil, topo.ErrBadVersion
+		}
+	case topo.ErrNoNode:
+		// Unconditional updates create the file.
+		if version != nil {
+			return nil, topo.ErrNoNode
+		}
+	default:
+		return nil, err
+	}
+
+	generation++
+	if err := s.writeFile(nodePath, contents, generation); err != nil {
+		return nil, err
+	}
+	return DirVersion(generation), nil
+}
+
+// Get is part of the topo.Conn interface.
+func (s *Server) Get(ctx context.Context, filePath string) ([]byte, topo.Version, error) {
+	contents, generation, err := s.readFile(s.nodePath(filePath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return contents, DirVersion(generation), nil
+}
+
+// Delete is part of the topo.Conn interface.
+func (s *Server) Delete(ctx context.Context, filePath string, version topo.Version) error {
+	unlock, err := s.lockForWrite()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	nodePath := s.nodePath(filePath)
+	_, generation, err := s.readFile(nodePath)
+	if err != nil {
+		return err
+	}
+	if version != nil && generation != uint64(version.(DirVersion)) {
+		return topo.ErrBadVersion
+	}
+	if err := os.Remove(nodePath); err != nil {
+		return err
+	}
+
+	// Remove the directories that are now empty, so they don't
+	// show up in ListDir. os.Remove fails on the first one that
+	// is not empty.
+	for dir := filepath.Dir(nodePath); strings.HasPrefix(dir, s.root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// readFile returns the contents and the generation of a file.
+func (s *Server) readFile(nodePath string) ([]byte, uint64, error) {
+	data, err := ioutil.ReadFile(nodePath)
+	if err != nil {
+		if os.IsNotExist(err) || isNotDir(err) {
+			return nil, 0, topo.ErrNoNode
+		}
+		return nil, 0, err
+	}
+	if len(data) < generationSize {
+		return nil, 0, fmt.Errorf("file %v is too short to be a topo file", nodePath)
+	}
+	return data[generationSize:], binary.BigEndian.Uint64(data), nil
+}
+
+// writeFile writes a file with its generation. The file is written
+// to a temporary file first, and then renamed, so readers never see
+// a partial file. It must be called with the write lock held.
+func (s *Server) writeFile(nodePath string, contents []byte, generation uint64) error {
+	if err := os.MkdirAll(filepath.Dir(nodePath), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Join(s.root, tmpPath), "file")
+	if err != nil {
+		return err
+	}
+	data := make([]byte, generationSize+len(contents))
+	binary.BigEndian.PutUint64(data, generation)
+	copy(data[generationSize:], contents)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), nodePath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
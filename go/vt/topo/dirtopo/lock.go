@@ -0,0 +1,141 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+// lockPollInterval is how often a busy flock is retried.
+// flock(2) cannot be interrupted, so we use non-blocking calls.
+var lockPollInterval = 10 * time.Millisecond
+
+// dirLockDescriptor implements topo.LockDescriptor.
+type dirLockDescriptor struct {
+	lockPath string
+
+	// mu protects f.
+	mu sync.Mutex
+	// f is the flock'ed file. It is nil once unlocked.
+	f *os.File
+}
+
+// Lock is part of the topo.Conn interface.
+func (s *Server) Lock(ctx context.Context, dirPath, contents string) (topo.LockDescriptor, error) {
+	// We list the directory first to make sure it exists.
+	if _, err := s.ListDir(ctx, dirPath, false /*full*/); err != nil {
+		return nil, convertError(err)
+	}
+
+	// The lock files live in their own tree, so they don't keep
+	// directories alive after their last file is deleted.
+	lockPath := filepath.Join(s.root, locksPath, dirPath) + ".lock"
+	f, err := flock(lockPath, contents, ctx.Done())
+	if err == topo.ErrInterrupted {
+		return nil, convertError(ctx.Err())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dirLockDescriptor{
+		lockPath: lockPath,
+		f:        f,
+	}, nil
+}
+
+// Check is part of the topo.LockDescriptor interface.
+// flock(2) locks are only released by their holder, or when it dies.
+func (ld *dirLockDescriptor) Check(ctx context.Context) error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if ld.f == nil {
+		return fmt.Errorf("lock was released")
+	}
+	return nil
+}
+
+// Unlock is part of the topo.LockDescriptor interface.
+func (ld *dirLockDescriptor) Unlock(ctx context.Context) error {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if ld.f == nil {
+		return fmt.Errorf("unlock: lock %v not held", ld.lockPath)
+	}
+	err := funlock(ld.f)
+	ld.f = nil
+	return err
+}
+
+// flock takes an exclusive flock(2) on lockPath. It retries until it
+// gets it, or done is closed, in which case it returns
+// topo.ErrInterrupted. Once locked, contents is written to the file,
+// for information.
+func flock(lockPath, contents string, done <-chan struct{}) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, err
+		}
+		select {
+		case <-done:
+			f.Close()
+			return nil, topo.ErrInterrupted
+		case <-time.After(lockPollInterval):
+		}
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(contents), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// funlock clears and releases a file locked by flock.
+func funlock(f *os.File) error {
+	// Clear the contents first, so readers that see the file
+	// unlocked never see stale contents.
+	truncErr := f.Truncate(0)
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return truncErr
+}
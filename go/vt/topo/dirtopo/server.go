@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package dirtopo implements topo.Server with a local directory as the
+backend. It is meant for single-node deployments, like development
+or test clusters, where running a ZooKeeper, etcd or consul process
+is not worth it. All the processes of the cluster must run on the
+same host, and use the same directory as topo_global_server_address.
+
+Each topo file is stored as a file in the directory of its cell, which
+is the root of the cell inside that directory. The file starts with
+its generation, incremented by each update, followed by its contents.
+Locks and elections use flock(2), and watches poll the files.
+
+The names that start with a '.' in a cell directory are used by the
+implementation, and are not part of the topology data.
+*/
+package dirtopo
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+const (
+	// Path components. They all start with a '.', so they
+	// cannot be mistaken for topology data.
+	locksPath     = ".locks"
+	electionsPath = ".elections"
+	tmpPath       = ".tmp"
+
+	// writeLockFilename is the file that is flock'ed by all the
+	// writes in a cell, so they're serialized across processes.
+	writeLockFilename = ".write_lock"
+)
+
+// Factory is the directory topo.Factory implementation.
+type Factory struct{}
+
+// HasGlobalReadOnlyCell is part of the topo.Factory interface.
+func (f Factory) HasGlobalReadOnlyCell(serverAddr, root string) bool {
+	return false
+}
+
+// Create is part of the topo.Factory interface.
+func (f Factory) Create(cell, serverAddr, root string) (topo.Conn, error) {
+	return NewServer(serverAddr, root)
+}
+
+// Server is the implementation of topo.Server for a local directory.
+type Server struct {
+	// root is the directory of the cell on disk.
+	root string
+}
+
+// NewServer returns a new dirtopo.Server. serverAddr is the directory
+// on disk, and root the path of the cell in that directory.
+func NewServer(serverAddr, root string) (*Server, error) {
+	s := &Server{
+		root: filepath.Join(serverAddr, root),
+	}
+	for _, dir := range []string{s.root, filepath.Join(s.root, tmpPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Close implements topo.Server.Close.
+// There is nothing to close: locks are released by their holders.
+func (s *Server) Close() {
+}
+
+// nodePath returns the path on disk of a topo file or directory.
+func (s *Server) nodePath(p string) string {
+	return filepath.Join(s.root, p)
+}
+
+// lockForWrite takes the write lock of the cell. The returned
+// function releases it.
+func (s *Server) lockForWrite() (func(), error) {
+	f, err := os.OpenFile(filepath.Join(s.root, writeLockFilename), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// Closing the file releases the lock.
+	return func() { f.Close() }, nil
+}
+
+func init() {
+	topo.RegisterFactory("dir", Factory{})
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/test"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestDirTopo(t *testing.T) {
+	// One test is going to wait that full period, so make it shorter.
+	*watchPollInterval = 10 * time.Millisecond
+
+	serverAddr, err := ioutil.TempDir("", "dirtopo")
+	if err != nil {
+		t.Fatalf("cannot create tempdir: %v", err)
+	}
+	defer os.RemoveAll(serverAddr)
+
+	// Run the TopoServerTestSuite tests.
+	testIndex := 0
+	test.TopoServerTestSuite(t, func() *topo.Server {
+		// Each test will use its own sub-directories.
+		testRoot := fmt.Sprintf("test-%v", testIndex)
+		testIndex++
+
+		// Create the server on the new root.
+		ts, err := topo.OpenServer("dir", serverAddr, path.Join(testRoot, topo.GlobalCell))
+		if err != nil {
+			t.Fatalf("OpenServer() failed: %v", err)
+		}
+
+		// Create the CellInfo.
+		if err := ts.CreateCellInfo(context.Background(), test.LocalCellName, &topodatapb.CellInfo{
+			ServerAddress: serverAddr,
+			Root:          path.Join(testRoot, test.LocalCellName),
+		}); err != nil {
+			t.Fatalf("CreateCellInfo() failed: %v", err)
+		}
+
+		return ts
+	})
+}
+
+// TestDirTopoPersistence makes sure the data and its version survive
+// a restart of the server.
+func TestDirTopoPersistence(t *testing.T) {
+	ctx := context.Background()
+	serverAddr, err := ioutil.TempDir("", "dirtopo")
+	if err != nil {
+		t.Fatalf("cannot create tempdir: %v", err)
+	}
+	defer os.RemoveAll(serverAddr)
+
+	s, err := NewServer(serverAddr, topo.GlobalCell)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	if _, err := s.Create(ctx, "keyspaces/ks/Keyspace", []byte("v1")); err != nil {
+		t.Fatalf("Create() failed: %v", err)
+	}
+	version, err := s.Update(ctx, "keyspaces/ks/Keyspace", []byte("v2"), nil)
+	if err != nil {
+		t.Fatalf("Update() failed: %v", err)
+	}
+	s.Close()
+
+	s, err = NewServer(serverAddr, topo.GlobalCell)
+	if err != nil {
+		t.Fatalf("NewServer() failed: %v", err)
+	}
+	defer s.Close()
+	contents, got, err := s.Get(ctx, "keyspaces/ks/Keyspace")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if string(contents) != "v2" || got.String() != version.String() {
+		t.Errorf("Get() = (%q, %v), want (\"v2\", %v)", contents, got, version)
+	}
+
+	// The internal files are not listed.
+	entries, err := s.ListDir(ctx, "/", false /*full*/)
+	if err != nil {
+		t.Fatalf("ListDir() failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "keyspaces" {
+		t.Errorf("ListDir(/) = %v, want only keyspaces", entries)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dirtopo
+
+import (
+	"flag"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+)
+
+var (
+	watchPollInterval = flag.Duration("topo_dir_watch_poll_interval", time.Second, "how often watched files are checked for changes by the directory topo implementation")
+)
+
+// Watch is part of the topo.Conn interface.
+func (s *Server) Watch(ctx context.Context, filePath string) (*topo.WatchData, <-chan *topo.WatchData, topo.CancelFunc) {
+	// Initial get.
+	nodePath := s.nodePath(filePath)
+	contents, generation, err := s.readFile(nodePath)
+	if err != nil {
+		return &topo.WatchData{Err: err}, nil, nil
+	}
+
+	// Initial value to return.
+	wd := &topo.WatchData{
+		Contents: contents,
+		Version:  DirVersion(generation),
+	}
+
+	// Create a context, will be used to cancel the watch.
+	watchCtx, watchCancel := context.WithCancel(context.Background())
+
+	// Create the notifications channel, send updates to it.
+	notifications := make(chan *topo.WatchData, 10)
+	go func() {
+		defer close(notifications)
+
+		ticker := time.NewTicker(*watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watchCtx.Done():
+				notifications <- &topo.WatchData{
+					Err: convertError(watchCtx.Err()),
+				}
+				return
+			case <-ticker.C:
+			}
+
+			// Poll the file. This also returns ErrNoNode if it
+			// was deleted, which ends the watch.
+			contents, newGeneration, err := s.readFile(nodePath)
+			if err != nil {
+				notifications <- &topo.WatchData{
+					Err: err,
+				}
+				return
+			}
+
+			// If we got a new value, send it.
+			if newGeneration != generation {
+				generation = newGeneration
+				notifications <- &topo.WatchData{
+					Contents: contents,
+					Version:  DirVersion(generation),
+				}
+			}
+		}
+	}()
+
+	return wd, notifications, topo.CancelFunc(watchCancel)
+}
@@ -0,0 +1,39 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// MasterFailover is an event that describes a decision of the
+// automatic failover about a shard whose master looks dead.
+type MasterFailover struct {
+	KeyspaceName string
+	ShardName    string
+
+	// OldMaster is the master that looks dead.
+	OldMaster *topodatapb.TabletAlias
+
+	// NewMaster is the master-elect, if one was chosen.
+	NewMaster *topodatapb.TabletAlias
+
+	// DryRun is true if the failover is not done, only reported.
+	DryRun bool
+
+	Status string
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"fmt"
+	"log/syslog"
+
+	"vitess.io/vitess/go/event/syslogger"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+)
+
+// Syslog writes the event to syslog.
+func (mf *MasterFailover) Syslog() (syslog.Priority, string) {
+	dryRun := ""
+	if mf.DryRun {
+		dryRun = " (dry run)"
+	}
+	return syslog.LOG_WARNING, fmt.Sprintf("%s/%s [failover]%s %s old master: %s new master: %s",
+		mf.KeyspaceName, mf.ShardName, dryRun, mf.Status, topoproto.TabletAliasString(mf.OldMaster), topoproto.TabletAliasString(mf.NewMaster))
+}
+
+var _ syslogger.Syslogger = (*MasterFailover)(nil) // compile-time interface check
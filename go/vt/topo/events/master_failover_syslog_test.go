@@ -0,0 +1,50 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package events
+
+import (
+	"log/syslog"
+	"testing"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestMasterFailoverSyslog(t *testing.T) {
+	wantSev, wantMsg := syslog.LOG_WARNING, "keyspace-123/shard-123 [failover] (dry run) status old master: test-0000000123 new master: test-0000000456"
+	mf := &MasterFailover{
+		KeyspaceName: "keyspace-123",
+		ShardName:    "shard-123",
+		OldMaster: &topodatapb.TabletAlias{
+			Cell: "test",
+			Uid:  123,
+		},
+		NewMaster: &topodatapb.TabletAlias{
+			Cell: "test",
+			Uid:  456,
+		},
+		DryRun: true,
+		Status: "status",
+	}
+	gotSev, gotMsg := mf.Syslog()
+
+	if gotSev != wantSev {
+		t.Errorf("wrong severity: got %v, want %v", gotSev, wantSev)
+	}
+	if gotMsg != wantMsg {
+		t.Errorf("wrong message: got %v, want %v", gotMsg, wantMsg)
+	}
+}
@@ -20,9 +20,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"golang.org/x/net/context"
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
 	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/wrangler"
@@ -37,14 +41,24 @@ func init() {
 	addCommand("Shards", command{
 		"RemoveBackup",
 		commandRemoveBackup,
-		"<keyspace/shard> <backup name>",
-		"Removes a backup for the BackupStorage."})
+		"[-with_dependents] <keyspace/shard> <backup name>",
+		"Removes a backup for the BackupStorage. A backup that incremental backups are based on is only removed with -with_dependents, which also removes these incremental backups."})
+	addCommand("Shards", command{
+		"VerifyBackup",
+		commandVerifyBackup,
+		"[-concurrency=4] <keyspace/shard> <backup name>",
+		"Reads all the files of a backup from the BackupStorage, and checks them against the hashes and checksums in its MANIFEST, without restoring it. Encrypted backups are decrypted with the keys available to vtctl."})
+	addCommand("Shards", command{
+		"PruneBackups",
+		commandPruneBackups,
+		"[-keep_last=N] [-keep_daily=N] [-keep_weekly=N] [-min_age=<duration>] [-dry_run] <keyspace/shard>",
+		"Removes the backups of a shard that none of the retention rules keeps. The most recent backup that can be restored is always kept. An incremental backup and the backups it is based on are kept or removed together. With -dry_run, only lists the backups to remove."})
 
 	addCommand("Tablets", command{
 		"RestoreFromBackup",
 		commandRestoreFromBackup,
-		"<tablet alias>",
-		"Stops mysqld and restores the data from the latest backup."})
+		"[-restore_to_pos <position>|-restore_to_time <time>] <tablet alias>",
+		"Stops mysqld and restores the data from the latest backup. With -restore_to_pos or -restore_to_time (RFC3339, e.g. 2018-06-01T15:04:05Z), restores the latest backup taken before that point instead, and replays the archived binlogs up to it. A tablet restored to a point in time does not replicate, and is left DRAINED."})
 }
 
 func commandListBackups(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
@@ -77,6 +91,7 @@ func commandListBackups(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 }
 
 func commandRemoveBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	withDependents := subFlags.Bool("with_dependents", false, "Also removes the incremental backups based on this backup")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -96,16 +111,128 @@ func commandRemoveBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *f
 		return err
 	}
 	defer bs.Close()
+
+	dependents, err := mysqlctl.BackupDependents(ctx, bs, bucket, name)
+	if err != nil {
+		return err
+	}
+	if len(dependents) > 0 && !*withDependents {
+		return fmt.Errorf("incremental backups %v are based on backup %v, use -with_dependents to remove them too", strings.Join(dependents, ", "), name)
+	}
+	// Remove the newest backups first, so a failure
+	// never leaves a broken chain behind.
+	for i := len(dependents) - 1; i >= 0; i-- {
+		wr.Logger().Infof("Removing incremental backup %v", dependents[i])
+		if err := bs.RemoveBackup(ctx, bucket, dependents[i]); err != nil {
+			return err
+		}
+	}
 	return bs.RemoveBackup(ctx, bucket, name)
 }
 
+func commandVerifyBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	concurrency := subFlags.Int("concurrency", 4, "Specifies the number of files to verify simultaneously")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("action VerifyBackup requires <keyspace/shard> <backup name>")
+	}
+
+	keyspace, shard, err := topoproto.ParseKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	bucket := fmt.Sprintf("%v/%v", keyspace, shard)
+	name := subFlags.Arg(1)
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	defer bs.Close()
+	if err := mysqlctl.VerifyBackup(ctx, wr.Logger(), bs, bucket, name, *concurrency); err != nil {
+		return fmt.Errorf("backup %v is not valid: %v", name, err)
+	}
+	wr.Logger().Printf("backup %v is valid\n", name)
+	return nil
+}
+
+func commandPruneBackups(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	keepLast := subFlags.Int("keep_last", 0, "Keeps the N most recent backups")
+	keepDaily := subFlags.Int("keep_daily", 0, "Keeps the most recent backup of each of the N most recent days that have a backup")
+	keepWeekly := subFlags.Int("keep_weekly", 0, "Keeps the most recent backup of each of the N most recent weeks that have a backup")
+	minAge := subFlags.Duration("min_age", 0, "Keeps the backups more recent than this")
+	dryRun := subFlags.Bool("dry_run", false, "Only lists the backups to remove")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 {
+		return fmt.Errorf("action PruneBackups requires <keyspace/shard>")
+	}
+	if *keepLast < 0 || *keepDaily < 0 || *keepWeekly < 0 || *minAge < 0 {
+		return fmt.Errorf("the retention rules of PruneBackups cannot be negative")
+	}
+	if *keepLast == 0 && *keepDaily == 0 && *keepWeekly == 0 && *minAge == 0 {
+		return fmt.Errorf("action PruneBackups requires at least one of -keep_last, -keep_daily, -keep_weekly or -min_age")
+	}
+
+	keyspace, shard, err := topoproto.ParseKeyspaceShard(subFlags.Arg(0))
+	if err != nil {
+		return err
+	}
+	bucket := fmt.Sprintf("%v/%v", keyspace, shard)
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		return err
+	}
+	defer bs.Close()
+	policy := mysqlctl.RetentionPolicy{
+		KeepLast:   *keepLast,
+		KeepDaily:  *keepDaily,
+		KeepWeekly: *keepWeekly,
+		MinAge:     *minAge,
+	}
+	names, err := mysqlctl.PruneBackups(ctx, wr.Logger(), bs, bucket, policy, *dryRun)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if *dryRun {
+			wr.Logger().Printf("would remove %v\n", name)
+		} else {
+			wr.Logger().Printf("removed %v\n", name)
+		}
+	}
+	return nil
+}
+
 func commandRestoreFromBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	restoreToPos := subFlags.String("restore_to_pos", "", "if set, the replication position to restore to, e.g. MySQL56/<server uuid>:1-100")
+	restoreToTime := subFlags.String("restore_to_time", "", "if set, the time to restore to, in RFC3339 format. The transactions committed at or after that time are not restored")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
 	if subFlags.NArg() != 1 {
 		return fmt.Errorf("the RestoreFromBackup command requires the <tablet alias> argument")
 	}
+	if *restoreToPos != "" && *restoreToTime != "" {
+		return fmt.Errorf("-restore_to_pos and -restore_to_time cannot be used together")
+	}
+	if *restoreToPos != "" {
+		if _, err := mysql.DecodePosition(*restoreToPos); err != nil {
+			return fmt.Errorf("invalid -restore_to_pos: %v", err)
+		}
+	}
+	var restoreToTimeNS int64
+	if *restoreToTime != "" {
+		t, err := time.Parse(time.RFC3339, *restoreToTime)
+		if err != nil {
+			return fmt.Errorf("invalid -restore_to_time: %v", err)
+		}
+		restoreToTimeNS = t.UnixNano()
+	}
 
 	tabletAlias, err := topoproto.ParseTabletAlias(subFlags.Arg(0))
 	if err != nil {
@@ -115,7 +242,7 @@ func commandRestoreFromBackup(ctx context.Context, wr *wrangler.Wrangler, subFla
 	if err != nil {
 		return err
 	}
-	stream, err := wr.TabletManagerClient().RestoreFromBackup(ctx, tabletInfo.Tablet)
+	stream, err := wr.TabletManagerClient().RestoreFromBackup(ctx, tabletInfo.Tablet, *restoreToPos, restoreToTimeNS)
 	if err != nil {
 		return err
 	}
@@ -121,6 +121,7 @@ import (
 	"vitess.io/vitess/go/vt/topo"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/topotools"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
 	"vitess.io/vitess/go/vt/wrangler"
 
 	replicationdatapb "vitess.io/vitess/go/vt/proto/replicationdata"
@@ -206,8 +207,8 @@ var commands = []commandGroup{
 				"<tablet alias> <duration>",
 				"Blocks the action queue on the specified tablet for the specified amount of time. This is typically used for testing."},
 			{"Backup", commandBackup,
-				"[-concurrency=4] <tablet alias>",
-				"Stops mysqld and uses the BackupStorage service to store a new backup. This function also remembers if the tablet was replicating so that it can restore the same state after the backup completes."},
+				"[-concurrency=4] [-incremental] <tablet alias>",
+				"Stops mysqld and uses the BackupStorage service to store a new backup. This function also remembers if the tablet was replicating so that it can restore the same state after the backup completes. With -incremental, only stores the binlogs since the latest backup of the shard, without stopping mysqld."},
 			{"ExecuteHook", commandExecuteHook,
 				"<tablet alias> <hook name> [<param1=value1> <param2=value2> ...]",
 				"Runs the specified hook on the given tablet. A hook is a script that resides in the $VTROOT/vthook directory. You can put any script into that directory and use this command to run that script.\n" +
@@ -355,8 +356,17 @@ var commands = []commandGroup{
 				"[-exclude_tables=''] [-include-views] <keyspace name>",
 				"Validates that the master schema from shard 0 matches the schema on all of the other tablets in the keyspace."},
 			{"ApplySchema", commandApplySchema,
-				"[-allow_long_unavailability] [-wait_slave_timeout=10s] {-sql=<sql> || -sql-file=<filename>} <keyspace>",
-				"Applies the schema change to the specified keyspace on every master, running in parallel on all shards. The changes are then propagated to slaves via replication. If -allow_long_unavailability is set, schema changes affecting a large number of rows (and possibly incurring a longer period of unavailability) will not be rejected."},
+				"[-allow_long_unavailability] [-ddl_strategy=direct] [-wait_slave_timeout=10s] {-sql=<sql> || -sql-file=<filename>} <keyspace>",
+				"Applies the schema change to the specified keyspace on every master, running in parallel on all shards. The changes are then propagated to slaves via replication. If -allow_long_unavailability is set, schema changes affecting a large number of rows (and possibly incurring a longer period of unavailability) will not be rejected. With -ddl_strategy=online, the ALTER TABLE statements are queued as online schema changes instead, which each master runs on its own without locking the table: they're followed with ShowSchemaMigrations."},
+			{"ShowSchemaMigrations", commandShowSchemaMigrations,
+				"<keyspace> [<uuid>]",
+				"Displays the online schema changes of every shard of the keyspace, or only the one of <uuid>."},
+			{"CancelSchemaMigration", commandCancelSchemaMigration,
+				"<keyspace> <uuid>",
+				"Cancels an online schema change on the shards where it's queued or running. Its copy of the table is dropped."},
+			{"RetrySchemaMigration", commandRetrySchemaMigration,
+				"<keyspace> <uuid>",
+				"Queues again an online schema change on the shards where it failed or was cancelled. It starts from scratch."},
 			{"CopySchemaShard", commandCopySchemaShard,
 				"[-tables=<table1>,<table2>,...] [-exclude_tables=<table1>,<table2>,...] [-include-views] [-wait_slave_timeout=10s] {<source keyspace/shard> || <source tablet alias>} <destination keyspace/shard>",
 				"Copies the schema from a source shard's master (or a specific tablet) to a destination shard. The schema is applied directly on the master of the destination shard, and it is propagated to the replicas through binlogs."},
@@ -384,6 +394,9 @@ var commands = []commandGroup{
 			{"ApplyVSchema", commandApplyVSchema,
 				"{-vschema=<vschema> || -vschema_file=<vschema file>} [-cells=c1,c2,...] [-skip_rebuild] <keyspace>",
 				"Applies the VTGate routing schema to the provided keyspace. Shows the result after application."},
+			{"VerifyLookupVindex", commandVerifyLookupVindex,
+				"[-fix] [-max_rows=<max rows>] <keyspace> <vindex>",
+				"Scans the owner table and the backing table of a lookup vindex on the masters, and reports the lookup rows whose owner row doesn't exist, and the owner rows that have no lookup row. With -fix, the orphaned lookup rows are deleted and the missing ones are inserted."},
 			{"RebuildVSchemaGraph", commandRebuildVSchemaGraph,
 				"[-cells=c1,c2,...]",
 				"Rebuilds the cell-specific SrvVSchema from the global VSchema objects in the provided cells (or all cells if none provided)."},
@@ -1023,6 +1036,7 @@ func commandSleep(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.Fla
 
 func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	concurrency := subFlags.Int("concurrency", 4, "Specifies the number of compression/checksum jobs to run simultaneously")
+	incremental := subFlags.Bool("incremental", false, "Only backs up the binlogs since the latest backup of the shard")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -1038,7 +1052,7 @@ func commandBackup(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.Fl
 	if err != nil {
 		return err
 	}
-	stream, err := wr.TabletManagerClient().Backup(ctx, tabletInfo.Tablet, *concurrency)
+	stream, err := wr.TabletManagerClient().Backup(ctx, tabletInfo.Tablet, *concurrency, *incremental)
 	if err != nil {
 		return err
 	}
@@ -1891,6 +1905,7 @@ func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	sql := subFlags.String("sql", "", "A list of semicolon-delimited SQL commands")
 	sqlFile := subFlags.String("sql-file", "", "Identifies the file that contains the SQL commands")
 	waitSlaveTimeout := subFlags.Duration("wait_slave_timeout", wrangler.DefaultWaitSlaveTimeout, "The amount of time to wait for slaves to receive the schema change via replication.")
+	ddlStrategy := subFlags.String("ddl_strategy", onlineddl.StrategyDirect, "How the ALTER TABLE statements are applied: direct runs them on the masters, online queues them as online schema changes.")
 	if err := subFlags.Parse(args); err != nil {
 		return err
 	}
@@ -1908,6 +1923,9 @@ func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	if *allowLongUnavailability {
 		executor.AllowBigSchemaChange()
 	}
+	if err := executor.SetDDLStrategy(*ddlStrategy); err != nil {
+		return err
+	}
 	return schemamanager.Run(
 		ctx,
 		schemamanager.NewPlainController(change, keyspace),
@@ -1915,6 +1933,45 @@ func commandApplySchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *fl
 	)
 }
 
+func commandShowSchemaMigrations(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 1 && subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace> argument is required for the ShowSchemaMigrations command")
+	}
+	uuid := ""
+	if subFlags.NArg() == 2 {
+		uuid = subFlags.Arg(1)
+	}
+	qr, err := wr.ShowSchemaMigrations(ctx, subFlags.Arg(0), uuid)
+	if err != nil {
+		return err
+	}
+	printQueryResult(loggerWriter{wr.Logger()}, qr)
+	return nil
+}
+
+func commandCancelSchemaMigration(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace> and <uuid> arguments are required for the CancelSchemaMigration command")
+	}
+	return wr.CancelSchemaMigration(ctx, subFlags.Arg(0), subFlags.Arg(1))
+}
+
+func commandRetrySchemaMigration(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace> and <uuid> arguments are required for the RetrySchemaMigration command")
+	}
+	return wr.RetrySchemaMigration(ctx, subFlags.Arg(0), subFlags.Arg(1))
+}
+
 func commandCopySchemaShard(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	tables := subFlags.String("tables", "", "Specifies a comma-separated list of tables to copy. Each is either an exact match, or a regular expression of the form /regexp/")
 	excludeTables := subFlags.String("exclude_tables", "", "Specifies a comma-separated list of tables to exclude. Each is either an exact match, or a regular expression of the form /regexp/")
@@ -2058,6 +2115,23 @@ func commandRebuildVSchemaGraph(ctx context.Context, wr *wrangler.Wrangler, subF
 	return topotools.RebuildVSchema(ctx, wr.Logger(), wr.TopoServer(), cells)
 }
 
+func commandVerifyLookupVindex(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
+	fix := subFlags.Bool("fix", false, "Deletes the orphaned lookup rows and inserts the missing ones")
+	maxRows := subFlags.Int("max_rows", 1000000, "Specifies the maximum number of rows read from each shard")
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if subFlags.NArg() != 2 {
+		return fmt.Errorf("the <keyspace> and <vindex> arguments are required for the VerifyLookupVindex command")
+	}
+	report, err := wr.VerifyLookupVindex(ctx, subFlags.Arg(0), subFlags.Arg(1), *fix, *maxRows)
+	if err != nil {
+		return err
+	}
+	wr.Logger().Printf("%v orphaned lookup rows, %v missing lookup rows\n", len(report.Orphans), len(report.Missing))
+	return nil
+}
+
 func commandApplyVSchema(ctx context.Context, wr *wrangler.Wrangler, subFlags *flag.FlagSet, args []string) error {
 	vschema := subFlags.String("vschema", "", "Identifies the VTGate routing schema")
 	vschemaFile := subFlags.String("vschema_file", "", "Identifies the VTGate routing schema file")
@@ -0,0 +1,99 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vtctld
+
+import (
+	"flag"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/flagutil"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/failover"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/servenv"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vtctl"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+	"vitess.io/vitess/go/vt/wrangler"
+)
+
+var (
+	enableAutoFailover             = flag.Bool("enable_auto_failover", false, "if set, this vtctld replaces the masters that are dead with the most advanced replica, using EmergencyReparentShard.")
+	autoFailoverDryRun             = flag.Bool("auto_failover_dry_run", false, "if set, the automatic failovers are only reported, not done.")
+	autoFailoverCheckInterval      = flag.Duration("auto_failover_check_interval", 10*time.Second, "the interval between two checks of the health of the masters.")
+	autoFailoverMasterDownTimeout  = flag.Duration("auto_failover_master_down_timeout", 30*time.Second, "how long the healthcheck of a master must fail before its replicas are asked to confirm it is dead.")
+	autoFailoverMinConfirmingCells = flag.Int("auto_failover_min_confirming_cells", 2, "the number of cells where at least one replica must have lost its connection to the master before failing it over. At least one replica must confirm it, even if this is 0.")
+	autoFailoverWaitSlaveTimeout   = flag.Duration("auto_failover_wait_slave_timeout", 30*time.Second, "how long to wait for the replicas during an automatic failover.")
+	autoFailoverCooldown           = flag.Duration("auto_failover_cooldown", time.Hour, "the minimum time between two automatic failovers of a shard.")
+	autoFailoverPreferredCells     flagutil.StringListValue
+)
+
+func init() {
+	flag.Var(&autoFailoverPreferredCells, "auto_failover_preferred_cells", "comma separated list of the cells where a new master can be elected, in order of preference. By default, a new master can be in any cell, preferably the cell of the old master.")
+}
+
+func initAutoFailover(ts *topo.Server) {
+	if !*enableAutoFailover {
+		return
+	}
+	if *mysqlctl.DisableActiveReparents {
+		log.Errorf("-enable_auto_failover cannot be used with -disable_active_reparents, automatic failover is disabled")
+		return
+	}
+
+	wr := wrangler.New(logutil.NewConsoleLogger(), ts, tmclient.NewTabletManagerClient())
+	detector := failover.NewDetector(wr, failover.Config{
+		CheckInterval:      *autoFailoverCheckInterval,
+		MasterDownTimeout:  *autoFailoverMasterDownTimeout,
+		MinConfirmingCells: *autoFailoverMinConfirmingCells,
+		PreferredCells:     autoFailoverPreferredCells,
+		WaitSlaveTimeout:   *autoFailoverWaitSlaveTimeout,
+		Cooldown:           *autoFailoverCooldown,
+		DryRun:             *autoFailoverDryRun,
+	})
+
+	// sendDownEvents is set to true here, so the detector
+	// forgets the masters that are removed.
+	hc := discovery.NewHealthCheck(*vtctl.HealthcheckRetryDelay, *vtctl.HealthCheckTimeout)
+	hc.SetListener(detector, true)
+
+	// Watch the tablets of all the cells, so the replicas
+	// of every cell can confirm a master is dead.
+	cells, err := ts.GetKnownCells(context.Background())
+	if err != nil {
+		log.Errorf("Failed to get the cells, automatic failover is disabled: %v", err)
+		hc.Close()
+		return
+	}
+	var watchers []*discovery.TopologyWatcher
+	for _, cell := range cells {
+		watchers = append(watchers, discovery.NewCellTabletsWatcher(ts, hc, cell, *vtctl.HealthCheckTopologyRefresh, discovery.DefaultTopoReadConcurrency))
+	}
+
+	detector.Open(context.Background())
+	servenv.OnTermSync(func() {
+		detector.Close()
+		for _, w := range watchers {
+			w.Stop()
+		}
+		hc.Close()
+	})
+}
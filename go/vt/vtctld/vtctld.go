@@ -189,4 +189,7 @@ func InitVtctld(ts *topo.Server) {
 
 	// Init workflow manager.
 	initWorkflowManager(ts)
+
+	// Init automatic master failover.
+	initAutoFailover(ts)
 }
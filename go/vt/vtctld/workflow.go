@@ -29,6 +29,7 @@ import (
 	"vitess.io/vitess/go/vt/topo"
 	"vitess.io/vitess/go/vt/vtctl"
 	"vitess.io/vitess/go/vt/workflow"
+	"vitess.io/vitess/go/vt/workflow/lookupvindex"
 	"vitess.io/vitess/go/vt/workflow/resharding"
 	"vitess.io/vitess/go/vt/workflow/topovalidator"
 )
@@ -59,6 +60,9 @@ func initWorkflowManager(ts *topo.Server) {
 		// Register the Horizontal Resharding workflow.
 		resharding.Register()
 
+		// Register the Create Lookup Vindex workflow.
+		lookupvindex.Register()
+
 		// Unregister the blacklisted workflows.
 		for _, name := range workflowManagerDisable {
 			workflow.Unregister(name)
@@ -20,6 +20,11 @@ limitations under the License.
 // becomes unavailable), the buffer will automatically retry buffered requests
 // after the end of the failover was detected.
 //
+// The buffer also covers the cutover of a resharding ("MigrateServedTypes
+// master"), when the masters of the source shards stop serving. After the
+// cutover, the buffered requests fail with an error which tells the caller to
+// re-plan them against the new shards. See RequiresReplanning().
+//
 // Buffering (stalling) requests will increase the number of requests in flight
 // within vtgate and at upstream layers. Therefore, it is important to limit
 // the size of the buffer and the buffering duration (window) per request.
@@ -37,6 +42,7 @@ import (
 
 	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/srvtopo"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vterrors"
 
@@ -48,6 +54,10 @@ var (
 	bufferFullError      = vterrors.New(vtrpcpb.Code_UNAVAILABLE, "master buffer is full")
 	entryEvictedError    = vterrors.New(vtrpcpb.Code_UNAVAILABLE, "buffer full: request evicted for newer request")
 	contextCanceledError = vterrors.New(vtrpcpb.Code_UNAVAILABLE, "context was canceled before failover finished")
+	// shardsChangedError is returned to the requests which were buffered
+	// during a resharding cutover. Its code makes the vtgate resolver
+	// re-resolve the shards and retry.
+	shardsChangedError = vterrors.New(vtrpcpb.Code_FAILED_PRECONDITION, "buffered request must be re-planned because the shard is no longer serving after a resharding")
 )
 
 // bufferMode specifies how the buffer is configured for a given shard.
@@ -79,6 +89,9 @@ type Buffer struct {
 	shards map[string]bool
 	// now returns the current time. Overriden in tests.
 	now func() time.Time
+	// serv and cell are used to detect resharding cutovers. serv may be nil.
+	serv srvtopo.Server
+	cell string
 
 	// bufferSizeSema limits how many requests can be buffered
 	// ("-buffer_size") and is shared by all shardBuffer instances.
@@ -100,11 +113,13 @@ type Buffer struct {
 }
 
 // New creates a new Buffer object.
-func New() *Buffer {
-	return newWithNow(time.Now)
+// "serv" and "cell" are used to read the SrvKeyspace objects, to detect the
+// resharding cutovers. If "serv" is nil, only failovers are buffered.
+func New(serv srvtopo.Server, cell string) *Buffer {
+	return newWithNow(time.Now, serv, cell)
 }
 
-func newWithNow(now func() time.Time) *Buffer {
+func newWithNow(now func() time.Time, serv srvtopo.Server, cell string) *Buffer {
 	if err := verifyFlags(); err != nil {
 		log.Fatalf("Invalid buffer configuration: %v", err)
 	}
@@ -148,6 +163,8 @@ func newWithNow(now func() time.Time) *Buffer {
 		keyspaces:      keyspaces,
 		shards:         shards,
 		now:            now,
+		serv:           serv,
+		cell:           cell,
 		bufferSizeSema: sync2.NewSemaphore(*size, 0),
 		buffers:        make(map[string]*shardBuffer),
 	}
@@ -215,6 +232,7 @@ func (b *Buffer) WaitForFailoverEnd(ctx context.Context, keyspace, shard string,
 
 // StatsUpdate keeps track of the "tablet_externally_reparented_timestamp" of
 // each master. This way we can detect the end of a failover.
+// It also detects the masters which stop serving during a resharding cutover.
 // It is part of the discovery.HealthCheckStatsListener interface.
 func (b *Buffer) StatsUpdate(ts *discovery.TabletStats) {
 	if ts.Target.TabletType != topodatapb.TabletType_MASTER {
@@ -222,7 +240,10 @@ func (b *Buffer) StatsUpdate(ts *discovery.TabletStats) {
 	}
 
 	timestamp := ts.TabletExternallyReparentedTimestamp
-	if timestamp == 0 {
+	// A master which is up and healthy, but not serving, may be the master of
+	// a source shard during a resharding cutover.
+	notServing := ts.Up && !ts.Serving && ts.LastError == nil
+	if timestamp == 0 && !notServing {
 		// Masters where TabletExternallyReparented was never called will return 0.
 		// Ignore them.
 		return
@@ -233,7 +254,19 @@ func (b *Buffer) StatsUpdate(ts *discovery.TabletStats) {
 		// Buffer is shut down. Ignore all calls.
 		return
 	}
-	sb.recordExternallyReparentedTimestamp(timestamp, ts.Tablet.Alias)
+	if notServing {
+		sb.checkReshardingCutover()
+	}
+	if timestamp != 0 {
+		sb.recordExternallyReparentedTimestamp(timestamp, ts.Tablet.Alias)
+	}
+}
+
+// RequiresReplanning returns true if "err" was returned for a request which
+// was buffered during a resharding cutover. Such a request was not executed,
+// and must be planned again, to be sent to the new shards.
+func RequiresReplanning(err error) bool {
+	return err != nil && vterrors.Code(err) == vtrpcpb.Code_FAILED_PRECONDITION && strings.Contains(err.Error(), shardsChangedError.Error())
 }
 
 // causedByFailover returns true if "err" was supposedly caused by a failover.
@@ -288,7 +321,7 @@ func (b *Buffer) getOrCreateBuffer(keyspace, shard string) *shardBuffer {
 	// Look it up again because it could have been created in the meantime.
 	sb, ok = b.buffers[key]
 	if !ok {
-		sb = newShardBuffer(b.mode(keyspace, shard), keyspace, shard, b.now, b.bufferSizeSema)
+		sb = newShardBuffer(b.mode(keyspace, shard), keyspace, shard, b.now, b.bufferSizeSema, b.serv, b.cell)
 		b.buffers[key] = sb
 	}
 	return sb
@@ -86,7 +86,7 @@ func TestBuffer(t *testing.T) {
 
 	// Create the buffer.
 	now := time.Now()
-	b := newWithNow(func() time.Time { return now })
+	b := newWithNow(func() time.Time { return now }, nil, "")
 
 	// Simulate that the current master reports its ExternallyReparentedTimestamp.
 	// vtgate sees this at startup. Additional periodic updates will be sent out
@@ -300,7 +300,7 @@ func TestDryRun(t *testing.T) {
 
 	flag.Set("enable_buffer_dry_run", "true")
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	// Request does not get buffered.
 	if retryDone, err := b.WaitForFailoverEnd(context.Background(), keyspace, shard, failoverErr); err != nil || retryDone != nil {
@@ -343,7 +343,7 @@ func TestPassthrough(t *testing.T) {
 	flag.Set("enable_buffer", "true")
 	flag.Set("buffer_keyspace_shards", topoproto.KeyspaceShardString(keyspace, shard))
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	if retryDone, err := b.WaitForFailoverEnd(context.Background(), keyspace, shard, nil); err != nil || retryDone != nil {
 		t.Fatalf("requests with no error must never be buffered. err: %v retryDone: %v", err, retryDone)
@@ -368,7 +368,7 @@ func TestLastReparentTooRecent_BufferingSkipped(t *testing.T) {
 	// Enable the buffer (no explicit whitelist i.e. it applies to everything).
 	defer resetFlagsForTesting()
 	now := time.Now()
-	b := newWithNow(func() time.Time { return now })
+	b := newWithNow(func() time.Time { return now }, nil, "")
 
 	// Simulate that the old master notified us about its reparented timestamp
 	// very recently (time.Now()).
@@ -412,7 +412,7 @@ func TestLastReparentTooRecent_Buffering(t *testing.T) {
 	// Enable the buffer (no explicit whitelist i.e. it applies to everything).
 	defer resetFlagsForTesting()
 	now := time.Now()
-	b := newWithNow(func() time.Time { return now })
+	b := newWithNow(func() time.Time { return now }, nil, "")
 
 	// Simulate that the old master notified us about its reparented timestamp
 	// very recently (time.Now()).
@@ -470,7 +470,7 @@ func TestPassthroughDuringDrain(t *testing.T) {
 	flag.Set("enable_buffer", "true")
 	flag.Set("buffer_keyspace_shards", topoproto.KeyspaceShardString(keyspace, shard))
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	// Buffer one request.
 	markRetryDone := make(chan struct{})
@@ -516,7 +516,7 @@ func TestPassthroughIgnoredKeyspaceOrShard(t *testing.T) {
 	flag.Set("enable_buffer", "true")
 	flag.Set("buffer_keyspace_shards", topoproto.KeyspaceShardString(keyspace, shard))
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	ignoredKeyspace := "ignored_ks"
 	if retryDone, err := b.WaitForFailoverEnd(context.Background(), ignoredKeyspace, shard, failoverErr); err != nil || retryDone != nil {
@@ -562,7 +562,7 @@ func testRequestCanceled(t *testing.T, explicitEnd bool) {
 	// Enable buffering for the complete keyspace and not just a specific shard.
 	flag.Set("buffer_keyspace_shards", keyspace)
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 	if !explicitEnd {
 		// Set value after constructor to work-around hardcoded minimum values.
 		flag.Set("buffer_window", "100ms")
@@ -636,7 +636,7 @@ func TestEviction(t *testing.T) {
 	flag.Set("buffer_keyspace_shards", topoproto.KeyspaceShardString(keyspace, shard))
 	flag.Set("buffer_size", "2")
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	stopped1 := issueRequest(context.Background(), t, b, failoverErr)
 	// This wait is important because each request gets inserted asynchronously
@@ -720,7 +720,7 @@ func TestEvictionNotPossible(t *testing.T) {
 		topoproto.KeyspaceShardString(keyspace, shard2)))
 	flag.Set("buffer_size", "1")
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	// Make the buffer full (applies to all failovers).
 	// Also triggers buffering for the first shard.
@@ -774,7 +774,7 @@ func TestWindow(t *testing.T) {
 		topoproto.KeyspaceShardString(keyspace, shard2)))
 	flag.Set("buffer_size", "1")
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 	// Set value after constructor to work-around hardcoded minimum values.
 	flag.Set("buffer_window", "1ms")
 
@@ -875,7 +875,7 @@ func TestShutdown(t *testing.T) {
 
 	flag.Set("enable_buffer", "true")
 	defer resetFlagsForTesting()
-	b := New()
+	b := New(nil, "")
 
 	// Buffer one request.
 	stopped1 := issueRequest(context.Background(), t, b, failoverErr)
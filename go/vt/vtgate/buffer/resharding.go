@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buffer
+
+import (
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo/topoproto"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// This file contains the detection of resharding cutovers.
+//
+// During "MigrateServedTypes master", the masters of the source shards stop
+// serving before the SrvKeyspace partitions switch to the destination
+// shards. The replica and rdonly types were migrated before, so at that
+// point a source shard is still listed in the MASTER partition, but not
+// in the REPLICA partition anymore. When vtgate sees a master of such
+// a shard stop serving, it starts buffering. The buffering stops when the
+// MASTER partition no longer lists the shard, and the buffered requests
+// are sent back with shardsChangedError, so they get re-planned against
+// the new shards.
+
+// servedShardsCheckInterval is how often a buffering shardBuffer checks
+// whether its shard is still served by the MASTER partition.
+// The check reads the srvtopo cache. Overriden in tests.
+var servedShardsCheckInterval = 100 * time.Millisecond
+
+// checkReshardingCutover starts buffering if the master of the shard
+// stopped serving because of a resharding cutover.
+// The check runs in the background, so it does not block the healthcheck.
+func (sb *shardBuffer) checkReshardingCutover() {
+	if sb.disabled() || sb.serv == nil {
+		return
+	}
+
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.state != stateIdle || sb.checkingCutover {
+		return
+	}
+	sb.checkingCutover = true
+	sb.wg.Add(1)
+	go func() {
+		defer sb.wg.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), *window)
+		defer cancel()
+		master, replica, err := sb.servedShards(ctx)
+
+		sb.mu.Lock()
+		defer sb.mu.Unlock()
+		sb.checkingCutover = false
+		if err != nil {
+			log.Warningf("Cannot check if shard: %s is in a resharding cutover: %v", topoproto.KeyspaceShardString(sb.keyspace, sb.shard), err)
+			return
+		}
+		if master == nil || replica == nil || !master[sb.shard] || replica[sb.shard] {
+			// Not a resharding cutover.
+			return
+		}
+		if sb.state != stateIdle {
+			return
+		}
+		if lastBufferingStopped := sb.now().Sub(sb.lastEnd); !sb.lastEnd.IsZero() && lastBufferingStopped < *minTimeBetweenFailovers {
+			sb.logTooRecent.Infof("NOT starting buffering for shard: %s because the last failover which triggered buffering is too recent (%v < %v). (A resharding cutover was detected.)",
+				topoproto.KeyspaceShardString(sb.keyspace, sb.shard), lastBufferingStopped, *minTimeBetweenFailovers)
+			return
+		}
+		sb.startBufferingLocked("A resharding cutover was detected: the master stopped serving, and the REPLICA partition no longer has the shard.")
+	}()
+}
+
+// watchServedShards stops the buffering once the shard is no longer in
+// the MASTER partition, i.e. at the end of a resharding cutover.
+// It runs until done is closed, when the buffering stops.
+func (sb *shardBuffer) watchServedShards(done chan struct{}) {
+	defer sb.wg.Done()
+
+	ticker := time.NewTicker(servedShardsCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *window)
+		master, _, err := sb.servedShards(ctx)
+		cancel()
+		if err != nil {
+			log.V(2).Infof("Cannot check if shard: %s is still served: %v", topoproto.KeyspaceShardString(sb.keyspace, sb.shard), err)
+			continue
+		}
+		if master == nil || master[sb.shard] {
+			continue
+		}
+
+		sb.mu.Lock()
+		select {
+		case <-done:
+			// The buffering stopped in the meantime.
+		default:
+			sb.stopBufferingLocked(stopReshardingEndDetected, "resharding end detected: the MASTER partition no longer has the shard")
+		}
+		sb.mu.Unlock()
+		return
+	}
+}
+
+// servedShards returns the shards of the MASTER and REPLICA partitions
+// of the SrvKeyspace of the shard. A partition that does not exist is nil.
+func (sb *shardBuffer) servedShards(ctx context.Context) (master, replica map[string]bool, err error) {
+	srvKeyspace, err := sb.serv.GetSrvKeyspace(ctx, sb.cell, sb.keyspace)
+	if err != nil {
+		return nil, nil, err
+	}
+	return partitionShards(srvKeyspace, topodatapb.TabletType_MASTER), partitionShards(srvKeyspace, topodatapb.TabletType_REPLICA), nil
+}
+
+// partitionShards returns the set of shards of the partition of
+// srvKeyspace for tabletType, or nil if there is no such partition.
+func partitionShards(srvKeyspace *topodatapb.SrvKeyspace, tabletType topodatapb.TabletType) map[string]bool {
+	partition := topoproto.SrvKeyspaceGetPartition(srvKeyspace, tabletType)
+	if partition == nil {
+		return nil
+	}
+	shards := make(map[string]bool)
+	for _, ref := range partition.ShardReferences {
+		shards[ref.Name] = true
+	}
+	return shards
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package buffer
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+// fakeSrvTopo is a srvtopo.Server which serves one SrvKeyspace.
+type fakeSrvTopo struct {
+	mu          sync.Mutex
+	srvKeyspace *topodatapb.SrvKeyspace
+}
+
+// setPartitions sets the shards of the MASTER and REPLICA partitions.
+func (f *fakeSrvTopo) setPartitions(master, replica []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.srvKeyspace = &topodatapb.SrvKeyspace{
+		Partitions: []*topodatapb.SrvKeyspace_KeyspacePartition{
+			partition(topodatapb.TabletType_MASTER, master),
+			partition(topodatapb.TabletType_REPLICA, replica),
+		},
+	}
+}
+
+func partition(tabletType topodatapb.TabletType, shards []string) *topodatapb.SrvKeyspace_KeyspacePartition {
+	p := &topodatapb.SrvKeyspace_KeyspacePartition{ServedType: tabletType}
+	for _, s := range shards {
+		p.ShardReferences = append(p.ShardReferences, &topodatapb.ShardReference{Name: s})
+	}
+	return p
+}
+
+func (f *fakeSrvTopo) GetSrvKeyspaceNames(ctx context.Context, cell string) ([]string, error) {
+	return []string{keyspace}, nil
+}
+
+func (f *fakeSrvTopo) GetSrvKeyspace(ctx context.Context, cell, ks string) (*topodatapb.SrvKeyspace, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ks != keyspace {
+		return nil, fmt.Errorf("unknown keyspace %v", ks)
+	}
+	return f.srvKeyspace, nil
+}
+
+func (f *fakeSrvTopo) WatchSrvVSchema(ctx context.Context, cell string, callback func(*vschemapb.SrvVSchema, error)) {
+}
+
+// masterNotServing simulates the health update of a master which stopped
+// serving, without a failover.
+func masterNotServing(b *Buffer) {
+	b.StatsUpdate(&discovery.TabletStats{
+		Tablet:  oldMaster,
+		Target:  &querypb.Target{Keyspace: keyspace, Shard: shard, TabletType: topodatapb.TabletType_MASTER},
+		Up:      true,
+		Serving: false,
+	})
+}
+
+// waitForCutoverCheck waits up to 10s for checkReshardingCutover() to finish
+// reading the SrvKeyspace.
+func waitForCutoverCheck(b *Buffer) error {
+	sb := b.getOrCreateBuffer(keyspace, shard)
+	start := time.Now()
+	for {
+		sb.mu.RLock()
+		checking := sb.checkingCutover
+		sb.mu.RUnlock()
+		if !checking {
+			return nil
+		}
+
+		if time.Since(start) > 10*time.Second {
+			return fmt.Errorf("the resharding cutover check did not finish")
+		}
+		time.Sleep(1 * time.Millisecond)
+	}
+}
+
+func TestReshardingCutover(t *testing.T) {
+	resetVariables()
+	defer checkVariables(t)
+
+	flag.Set("enable_buffer", "true")
+	defer resetFlagsForTesting()
+	defer func(d time.Duration) { servedShardsCheckInterval = d }(servedShardsCheckInterval)
+	servedShardsCheckInterval = 1 * time.Millisecond
+
+	serv := &fakeSrvTopo{}
+	serv.setPartitions([]string{shard}, []string{shard})
+	b := New(serv, "cell1")
+	defer b.Shutdown()
+
+	// A master which stops serving while the REPLICA partition still has its
+	// shard is not in a resharding cutover.
+	masterNotServing(b)
+	if err := waitForCutoverCheck(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForState(b, stateIdle); err != nil {
+		t.Fatal(err)
+	}
+
+	// The replicas were migrated to the new shards. Now the master stopping
+	// serving is the cutover, and buffering starts.
+	serv.setPartitions([]string{shard}, []string{"-80", "80-"})
+	masterNotServing(b)
+	if err := waitForState(b, stateBuffering); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := starts.Counts()[statsKeyJoined], int64(1); got != want {
+		t.Fatalf("buffering start was not tracked: got = %v, want = %v", got, want)
+	}
+
+	// Requests are buffered, even if they did not see an error yet.
+	if _, err := b.WaitForFailoverEnd(context.Background(), keyspace, "-80", nil); err != nil {
+		t.Fatalf("requests for other shards must not be buffered: %v", err)
+	}
+	stopped := issueRequest(context.Background(), t, b, nil)
+	stopped2 := issueRequest(context.Background(), t, b, failoverErr)
+	if err := waitForRequestsInFlight(b, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// The MASTER partition switches to the new shards. The buffered requests
+	// must be re-planned.
+	serv.setPartitions([]string{"-80", "80-"}, []string{"-80", "80-"})
+	for _, c := range []chan error{stopped, stopped2} {
+		if err := <-c; !RequiresReplanning(err) {
+			t.Fatalf("buffered request must be re-planned, got: %v", err)
+		}
+	}
+	if err := waitForState(b, stateIdle); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForPoolSlots(b, *size); err != nil {
+		t.Fatal(err)
+	}
+	statsKeyJoinedReshardingEndDetected := statsKeyJoined + "." + string(stopReshardingEndDetected)
+	if got, want := stops.Counts()[statsKeyJoinedReshardingEndDetected], int64(1); got != want {
+		t.Fatalf("buffering stop was not tracked: got = %v, want = %v", got, want)
+	}
+
+	// The old master is still not serving, but the last buffering is too recent.
+	masterNotServing(b)
+	if err := waitForCutoverCheck(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForState(b, stateIdle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReshardingCutoverDisabled(t *testing.T) {
+	resetVariables()
+
+	flag.Set("enable_buffer", "true")
+	flag.Set("buffer_keyspace_shards", topoproto.KeyspaceShardString(keyspace, shard2))
+	defer resetFlagsForTesting()
+
+	serv := &fakeSrvTopo{}
+	serv.setPartitions([]string{shard}, []string{"-80", "80-"})
+	b := New(serv, "cell1")
+	defer b.Shutdown()
+
+	// Buffering is not enabled for this shard.
+	masterNotServing(b)
+	if err := waitForCutoverCheck(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitForState(b, stateIdle); err != nil {
+		t.Fatal(err)
+	}
+	if got := starts.Counts()[statsKeyJoined]; got != 0 {
+		t.Fatalf("buffering must not start for a disabled shard: got = %v starts", got)
+	}
+}
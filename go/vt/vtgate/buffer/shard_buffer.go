@@ -27,6 +27,7 @@ import (
 
 	"vitess.io/vitess/go/sync2"
 	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/srvtopo"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vterrors"
 
@@ -67,6 +68,10 @@ type shardBuffer struct {
 	// statsKeyJoined is all elements of "statsKey" in one string, joined by ".".
 	statsKeyJoined string
 	logTooRecent   *logutil.ThrottledLogger
+	// serv and cell are used to read the SrvKeyspace of the shard, to detect
+	// resharding cutovers. serv may be nil. See resharding.go.
+	serv srvtopo.Server
+	cell string
 
 	// mu guards the fields below.
 	mu    sync.RWMutex
@@ -93,6 +98,12 @@ type shardBuffer struct {
 	// timeoutThread will be set while a failover is in progress and the object is
 	// in the BUFFERING state.
 	timeoutThread *timeoutThread
+	// servedShardsDone will be set while the object is in the BUFFERING state
+	// and "serv" is set. It is closed to stop watchServedShards().
+	servedShardsDone chan struct{}
+	// checkingCutover is true while checkReshardingCutover() reads the
+	// SrvKeyspace.
+	checkingCutover bool
 	// wg tracks all pending Go routines. waitForShutdown() will use this field to
 	// block on them.
 	wg sync.WaitGroup
@@ -120,7 +131,7 @@ type entry struct {
 	bufferCancel func()
 }
 
-func newShardBuffer(mode bufferMode, keyspace, shard string, now func() time.Time, bufferSizeSema *sync2.Semaphore) *shardBuffer {
+func newShardBuffer(mode bufferMode, keyspace, shard string, now func() time.Time, bufferSizeSema *sync2.Semaphore, serv srvtopo.Server, cell string) *shardBuffer {
 	statsKey := []string{keyspace, shard}
 	initVariablesForShard(statsKey)
 
@@ -133,6 +144,8 @@ func newShardBuffer(mode bufferMode, keyspace, shard string, now func() time.Tim
 		statsKey:       statsKey,
 		statsKeyJoined: fmt.Sprintf("%s.%s", keyspace, shard),
 		logTooRecent:   logutil.NewThrottledLogger(fmt.Sprintf("FailoverTooRecent-%v", topoproto.KeyspaceShardString(keyspace, shard)), 5*time.Second),
+		serv:           serv,
+		cell:           cell,
 		state:          stateIdle,
 	}
 }
@@ -215,7 +228,7 @@ func (sb *shardBuffer) waitForFailoverEnd(ctx context.Context, keyspace, shard s
 			return nil, nil
 		}
 
-		sb.startBufferingLocked(err)
+		sb.startBufferingLocked(fmt.Sprintf("A failover was detected by this seen error: %v.", err))
 	}
 
 	if sb.mode == bufferDryRun {
@@ -259,7 +272,9 @@ func (sb *shardBuffer) shouldBufferLocked(failoverDetected bool) bool {
 	panic("BUG: All possible states must be covered by the switch expression above.")
 }
 
-func (sb *shardBuffer) startBufferingLocked(err error) {
+// startBufferingLocked starts buffering. "details" describes what triggered
+// the buffering.
+func (sb *shardBuffer) startBufferingLocked(details string) {
 	// Reset monitoring data from previous failover.
 	lastRequestsInFlightMax.Set(sb.statsKey, 0)
 	lastRequestsDryRunMax.Set(sb.statsKey, 0)
@@ -272,13 +287,18 @@ func (sb *shardBuffer) startBufferingLocked(err error) {
 
 	sb.timeoutThread = newTimeoutThread(sb)
 	sb.timeoutThread.start()
+	if sb.serv != nil {
+		sb.servedShardsDone = make(chan struct{})
+		sb.wg.Add(1)
+		go sb.watchServedShards(sb.servedShardsDone)
+	}
 	msg := "Starting buffering"
 	if sb.mode == bufferDryRun {
 		msg = "Dry-run: Would have started buffering"
 	}
 	starts.Add(sb.statsKey, 1)
-	log.Infof("%v for shard: %s (window: %v, size: %v, max failover duration: %v) (A failover was detected by this seen error: %v.)",
-		msg, topoproto.KeyspaceShardString(sb.keyspace, sb.shard), *window, *size, *maxFailoverDuration, err)
+	log.Infof("%v for shard: %s (window: %v, size: %v, max failover duration: %v) (%v)",
+		msg, topoproto.KeyspaceShardString(sb.keyspace, sb.shard), *window, *size, *maxFailoverDuration, details)
 }
 
 // logErrorIfStateNotLocked logs an error if the current state is not "state".
@@ -537,6 +557,16 @@ func (sb *shardBuffer) stopBufferingLocked(reason stopReason, details string) {
 	// Clear the queue such that remove(), oldestEntry() and evictOldestEntry()
 	// will not work on obsolete data.
 	sb.queue = nil
+	if sb.servedShardsDone != nil {
+		close(sb.servedShardsDone)
+		sb.servedShardsDone = nil
+	}
+	// After a resharding, the shard is no longer serving. The buffered
+	// requests must not be retried against it.
+	var drainErr error
+	if reason == stopReshardingEndDetected {
+		drainErr = shardsChangedError
+	}
 
 	msg := "Stopping buffering"
 	if sb.mode == bufferDryRun {
@@ -546,10 +576,13 @@ func (sb *shardBuffer) stopBufferingLocked(reason stopReason, details string) {
 
 	// Start the drain. (Use a new Go routine to release the lock.)
 	sb.wg.Add(1)
-	go sb.drain(q)
+	go sb.drain(q, drainErr)
 }
 
-func (sb *shardBuffer) drain(q []*entry) {
+// drain unblocks the buffered requests. If "err" is set, they fail with it
+// and are not retried against this shard. Therefore, the drain does not wait
+// for them.
+func (sb *shardBuffer) drain(q []*entry, err error) {
 	defer sb.wg.Done()
 
 	// stop must be called outside of the lock because the thread may access
@@ -559,7 +592,7 @@ func (sb *shardBuffer) drain(q []*entry) {
 	start := sb.now()
 	// TODO(mberlin): Parallelize the drain by pumping the data through a channel.
 	for _, e := range q {
-		sb.unblockAndWait(e, nil /* err */, true /* releaseSlot */, true /* blockingWait */)
+		sb.unblockAndWait(e, err, true /* releaseSlot */, err == nil /* blockingWait */)
 	}
 	d := sb.now().Sub(start)
 	log.Infof("Draining finished for shard: %s Took: %v for: %d requests.", topoproto.KeyspaceShardString(sb.keyspace, sb.shard), d, len(q))
@@ -73,10 +73,11 @@ var (
 // stopReason is used in "stopsByReason" as "Reason" label.
 type stopReason string
 
-var stopReasons = []stopReason{stopFailoverEndDetected, stopMaxFailoverDurationExceeded, stopShutdown}
+var stopReasons = []stopReason{stopFailoverEndDetected, stopReshardingEndDetected, stopMaxFailoverDurationExceeded, stopShutdown}
 
 const (
 	stopFailoverEndDetected         stopReason = "NewMasterSeen"
+	stopReshardingEndDetected                  = "ReshardingEndDetected"
 	stopMaxFailoverDurationExceeded            = "MaxDurationExceeded"
 	stopShutdown                               = "Shutdown"
 )
@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vtgate
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var (
+	// consolidationWaits has the time requests waited for an identical
+	// query, by keyspace.
+	consolidationWaits = stats.NewTimings("VtgateQueryConsolidationWaits")
+	// consolidationSkips counts the requests which could have waited
+	// for an identical query, but executed it because of a limit.
+	consolidationSkips = stats.NewCounters("VtgateQueryConsolidationSkips")
+	// consolidationsInFlight is the number of queries that are
+	// currently shared.
+	consolidationsInFlight = stats.NewInt("VtgateQueryConsolidationsInFlight")
+)
+
+// queryConsolidator shares the execution of identical queries between
+// the requests that run them at the same time: the first request
+// executes the query, and the ones that arrive before it is done wait
+// for its result. The Executor only uses it for reads outside of
+// transactions.
+type queryConsolidator struct {
+	// keyspaces has the keyspaces the consolidation is enabled for.
+	// If empty, it is enabled for all of them.
+	keyspaces map[string]bool
+	// maxQueries is the maximum number of queries shared at once.
+	maxQueries int
+	// maxWaiters is the maximum number of requests that wait for
+	// the same query. 0 means no limit.
+	maxWaiters int
+	// maxResultRows is the maximum number of rows of a shared result.
+	// The requests waiting for a query with more rows execute it
+	// themselves. 0 means no limit.
+	maxResultRows int
+
+	mu      sync.Mutex
+	queries map[string]*consolidatedQuery
+}
+
+// consolidatedQuery is a query which is being executed.
+type consolidatedQuery struct {
+	// done is closed when result and err are set.
+	done    chan struct{}
+	waiters int
+	result  *sqltypes.Result
+	err     error
+	// canceled is set if the context of the request which executed
+	// the query was done, or if the query panicked. The waiting
+	// requests then execute it again.
+	canceled bool
+	// tooLarge is set if the result has more than maxResultRows rows.
+	// The waiting requests then execute the query themselves.
+	tooLarge bool
+}
+
+func newQueryConsolidator(keyspaces []string, maxQueries, maxWaiters, maxResultRows int) *queryConsolidator {
+	qc := &queryConsolidator{
+		keyspaces:     make(map[string]bool),
+		maxQueries:    maxQueries,
+		maxWaiters:    maxWaiters,
+		maxResultRows: maxResultRows,
+		queries:       make(map[string]*consolidatedQuery),
+	}
+	for _, keyspace := range keyspaces {
+		qc.keyspaces[keyspace] = true
+	}
+	return qc
+}
+
+// enabled returns true if the queries of keyspace can be consolidated.
+func (qc *queryConsolidator) enabled(keyspace string) bool {
+	return len(qc.keyspaces) == 0 || qc.keyspaces[keyspace]
+}
+
+// execute calls fn, unless an identical query is being executed. It then
+// waits for it, and returns its result. The result is shared, and must
+// not be modified.
+func (qc *queryConsolidator) execute(ctx context.Context, keyspace, key string, fn func() (*sqltypes.Result, error)) (*sqltypes.Result, error) {
+	for {
+		qc.mu.Lock()
+		q, ok := qc.queries[key]
+		switch {
+		case ok && (qc.maxWaiters == 0 || q.waiters < qc.maxWaiters):
+			q.waiters++
+			qc.mu.Unlock()
+			start := time.Now()
+			select {
+			case <-ctx.Done():
+				qc.mu.Lock()
+				q.waiters--
+				qc.mu.Unlock()
+				return nil, vterrors.Errorf(vterrors.Code(ctx.Err()), "context was done while waiting for an identical query: %v", ctx.Err())
+			case <-q.done:
+			}
+			consolidationWaits.Record(keyspace, start)
+			switch {
+			case q.canceled:
+				continue
+			case q.tooLarge:
+				consolidationSkips.Add("MaxResultRows", 1)
+				return fn()
+			}
+			return q.result, q.err
+		case ok:
+			qc.mu.Unlock()
+			consolidationSkips.Add("MaxWaiters", 1)
+			return fn()
+		case len(qc.queries) >= qc.maxQueries:
+			qc.mu.Unlock()
+			consolidationSkips.Add("MaxQueries", 1)
+			return fn()
+		}
+		q = &consolidatedQuery{done: make(chan struct{})}
+		qc.queries[key] = q
+		qc.mu.Unlock()
+		consolidationsInFlight.Add(1)
+		return qc.run(ctx, key, q, fn)
+	}
+}
+
+// run executes the query of q with fn, and releases the requests waiting
+// for it. They are released even if fn panics, and then execute the query
+// themselves.
+func (qc *queryConsolidator) run(ctx context.Context, key string, q *consolidatedQuery, fn func() (*sqltypes.Result, error)) (*sqltypes.Result, error) {
+	q.canceled = true
+	defer func() {
+		qc.mu.Lock()
+		delete(qc.queries, key)
+		qc.mu.Unlock()
+		consolidationsInFlight.Add(-1)
+		close(q.done)
+	}()
+
+	q.result, q.err = fn()
+	q.canceled = ctx.Err() != nil
+	q.tooLarge = q.result != nil && qc.maxResultRows > 0 && len(q.result.Rows) > qc.maxResultRows
+	return q.result, q.err
+}
+
+// consolidationKey returns the key of a query for the queryConsolidator.
+// Queries are identical if they have the same caller, target, options,
+// SQL and bind variables. The caller is part of the key because the
+// tablets may check its permissions, and a request must not get the
+// result of a query it isn't allowed to execute.
+func consolidationKey(ctx context.Context, targetString string, options *querypb.ExecuteOptions, sql string, bindVars map[string]*querypb.BindVariable) string {
+	buf := bytes.NewBufferString(callerid.GetPrincipal(callerid.EffectiveCallerIDFromContext(ctx)))
+	buf.WriteByte(0)
+	buf.WriteString(callerid.GetUsername(callerid.ImmediateCallerIDFromContext(ctx)))
+	buf.WriteByte(0)
+	buf.WriteString(targetString)
+	buf.WriteByte(0)
+	if options != nil {
+		buf.WriteString(proto.CompactTextString(options))
+	}
+	buf.WriteByte(0)
+	buf.WriteString(sql)
+
+	names := make([]string, 0, len(bindVars))
+	for name := range bindVars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteByte(0)
+		buf.WriteString(name)
+		buf.WriteByte('=')
+		buf.WriteString(proto.CompactTextString(bindVars[name]))
+	}
+	return buf.String()
+}
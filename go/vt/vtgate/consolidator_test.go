@@ -0,0 +1,371 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vtgate
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// blockingQuery is a query function which returns when release is closed,
+// and counts how many times it was executed.
+type blockingQuery struct {
+	mu       sync.Mutex
+	count    int
+	started  chan struct{}
+	release  chan struct{}
+	result   *sqltypes.Result
+	startOne sync.Once
+}
+
+func newBlockingQuery() *blockingQuery {
+	return &blockingQuery{
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+		result:  sqltypes.MakeTestResult(sqltypes.MakeTestFields("id", "int64"), "1"),
+	}
+}
+
+func (bq *blockingQuery) execute() (*sqltypes.Result, error) {
+	bq.mu.Lock()
+	bq.count++
+	bq.mu.Unlock()
+	bq.startOne.Do(func() { close(bq.started) })
+	<-bq.release
+	return bq.result, nil
+}
+
+func (bq *blockingQuery) executions() int {
+	bq.mu.Lock()
+	defer bq.mu.Unlock()
+	return bq.count
+}
+
+// waitForWaiters waits until n requests wait for the query of key.
+func waitForWaiters(t *testing.T, qc *queryConsolidator, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		qc.mu.Lock()
+		q, ok := qc.queries[key]
+		done := ok && q.waiters == n
+		qc.mu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v waiters", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQueryConsolidator(t *testing.T) {
+	qc := newQueryConsolidator(nil, 10, 0, 0)
+	bq := newBlockingQuery()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	results := make([]*sqltypes.Result, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			qr, err := qc.execute(ctx, "ks", "select 1", bq.execute)
+			if err != nil {
+				t.Errorf("execute failed: %v", err)
+			}
+			results[i] = qr
+		}(i)
+		if i == 0 {
+			<-bq.started
+		}
+	}
+	waitForWaiters(t, qc, "select 1", 4)
+	close(bq.release)
+	wg.Wait()
+
+	if got := bq.executions(); got != 1 {
+		t.Errorf("executions = %v, want 1", got)
+	}
+	for i, qr := range results {
+		if qr != bq.result {
+			t.Errorf("result %v = %v, want %v", i, qr, bq.result)
+		}
+	}
+	if len(qc.queries) != 0 {
+		t.Errorf("queries = %v, want none", qc.queries)
+	}
+
+	// Once the query is done, it is executed again.
+	if _, err := qc.execute(ctx, "ks", "select 1", bq.execute); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if got := bq.executions(); got != 2 {
+		t.Errorf("executions = %v, want 2", got)
+	}
+}
+
+func TestQueryConsolidatorError(t *testing.T) {
+	qc := newQueryConsolidator(nil, 10, 0, 0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wantErr := errors.New("query failed")
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := qc.execute(context.Background(), "ks", "select 1", func() (*sqltypes.Result, error) {
+			close(started)
+			<-release
+			return nil, wantErr
+		})
+		errs <- err
+	}()
+	<-started
+
+	waiterErr := make(chan error, 1)
+	go func() {
+		_, err := qc.execute(context.Background(), "ks", "select 1", func() (*sqltypes.Result, error) {
+			t.Errorf("the waiting request must not execute the query")
+			return nil, nil
+		})
+		waiterErr <- err
+	}()
+	waitForWaiters(t, qc, "select 1", 1)
+	close(release)
+
+	if err := <-errs; err != wantErr {
+		t.Errorf("execute = %v, want %v", err, wantErr)
+	}
+	if err := <-waiterErr; err != wantErr {
+		t.Errorf("waiting execute = %v, want %v", err, wantErr)
+	}
+}
+
+func TestQueryConsolidatorLimits(t *testing.T) {
+	qc := newQueryConsolidator(nil, 1, 1, 0)
+	bq := newBlockingQuery()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		qc.execute(ctx, "ks", "select 1", bq.execute)
+	}()
+	<-bq.started
+	go func() {
+		defer wg.Done()
+		qc.execute(ctx, "ks", "select 1", bq.execute)
+	}()
+	waitForWaiters(t, qc, "select 1", 1)
+
+	// A second waiter and a second distinct query are over the limits,
+	// and are executed separately.
+	executed := 0
+	execute := func() (*sqltypes.Result, error) {
+		executed++
+		return &sqltypes.Result{}, nil
+	}
+	if _, err := qc.execute(ctx, "ks", "select 1", execute); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if _, err := qc.execute(ctx, "ks", "select 2", execute); err != nil {
+		t.Fatalf("execute failed: %v", err)
+	}
+	if executed != 2 {
+		t.Errorf("executed = %v, want 2", executed)
+	}
+
+	close(bq.release)
+	wg.Wait()
+	if got := bq.executions(); got != 1 {
+		t.Errorf("executions = %v, want 1", got)
+	}
+}
+
+func TestQueryConsolidatorCanceled(t *testing.T) {
+	qc := newQueryConsolidator(nil, 10, 0, 0)
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		qc.execute(ctx, "ks", "select 1", func() (*sqltypes.Result, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+	}()
+	<-started
+
+	// The request which executes the query is canceled: the waiting
+	// request executes it again.
+	want := &sqltypes.Result{RowsAffected: 1}
+	done := make(chan *sqltypes.Result)
+	go func() {
+		qr, err := qc.execute(context.Background(), "ks", "select 1", func() (*sqltypes.Result, error) {
+			return want, nil
+		})
+		if err != nil {
+			t.Errorf("execute failed: %v", err)
+		}
+		done <- qr
+	}()
+	waitForWaiters(t, qc, "select 1", 1)
+	cancel()
+	if got := <-done; got != want {
+		t.Errorf("execute = %v, want %v", got, want)
+	}
+
+	// A waiting request which is canceled returns right away.
+	release := make(chan struct{})
+	defer close(release)
+	started = make(chan struct{})
+	go func() {
+		qc.execute(context.Background(), "ks", "select 2", func() (*sqltypes.Result, error) {
+			close(started)
+			<-release
+			return &sqltypes.Result{}, nil
+		})
+	}()
+	<-started
+	waiterCtx, waiterCancel := context.WithCancel(context.Background())
+	waiterCancel()
+	if _, err := qc.execute(waiterCtx, "ks", "select 2", nil); err == nil {
+		t.Errorf("execute with a canceled context succeeded")
+	}
+	// It doesn't count as a waiter anymore.
+	qc.mu.Lock()
+	waiters := qc.queries["select 2"].waiters
+	qc.mu.Unlock()
+	if waiters != 0 {
+		t.Errorf("waiters = %v, want 0", waiters)
+	}
+}
+
+func TestQueryConsolidatorPanic(t *testing.T) {
+	qc := newQueryConsolidator(nil, 10, 0, 0)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		defer func() {
+			if x := recover(); x == nil {
+				t.Errorf("the query didn't panic")
+			}
+		}()
+		qc.execute(context.Background(), "ks", "select 1", func() (*sqltypes.Result, error) {
+			close(started)
+			<-release
+			panic("query panicked")
+		})
+	}()
+	<-started
+
+	// The waiting request is released, and executes the query itself.
+	want := &sqltypes.Result{RowsAffected: 1}
+	done := make(chan *sqltypes.Result)
+	go func() {
+		qr, err := qc.execute(context.Background(), "ks", "select 1", func() (*sqltypes.Result, error) {
+			return want, nil
+		})
+		if err != nil {
+			t.Errorf("execute failed: %v", err)
+		}
+		done <- qr
+	}()
+	waitForWaiters(t, qc, "select 1", 1)
+	close(release)
+	if got := <-done; got != want {
+		t.Errorf("execute = %v, want %v", got, want)
+	}
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+	if len(qc.queries) != 0 {
+		t.Errorf("queries = %v, want none", qc.queries)
+	}
+}
+
+func TestQueryConsolidatorMaxResultRows(t *testing.T) {
+	qc := newQueryConsolidator(nil, 10, 0, 1)
+	bq := newBlockingQuery()
+	bq.result = sqltypes.MakeTestResult(sqltypes.MakeTestFields("id", "int64"), "1", "2")
+	ctx := context.Background()
+
+	go qc.execute(ctx, "ks", "select 1", bq.execute)
+	<-bq.started
+
+	// The result has too many rows to be shared: the waiting request
+	// executes the query itself.
+	want := &sqltypes.Result{RowsAffected: 1}
+	done := make(chan *sqltypes.Result)
+	go func() {
+		qr, err := qc.execute(ctx, "ks", "select 1", func() (*sqltypes.Result, error) {
+			return want, nil
+		})
+		if err != nil {
+			t.Errorf("execute failed: %v", err)
+		}
+		done <- qr
+	}()
+	waitForWaiters(t, qc, "select 1", 1)
+	close(bq.release)
+	if got := <-done; got != want {
+		t.Errorf("execute = %v, want %v", got, want)
+	}
+}
+
+func TestConsolidationKey(t *testing.T) {
+	bindVars := map[string]*querypb.BindVariable{
+		"a": sqltypes.Int64BindVariable(1),
+		"b": sqltypes.StringBindVariable("x"),
+	}
+	ctx := callerid.NewContext(context.Background(), callerid.NewEffectiveCallerID("user1", "", ""), callerid.NewImmediateCallerID("app1"))
+	key := consolidationKey(ctx, "ks@replica", nil, "select * from t where a = :a and b = :b", bindVars)
+	for i := 0; i < 10; i++ {
+		if got := consolidationKey(ctx, "ks@replica", nil, "select * from t where a = :a and b = :b", bindVars); got != key {
+			t.Fatalf("consolidationKey is not stable: %q != %q", got, key)
+		}
+	}
+
+	different := []string{
+		consolidationKey(context.Background(), "ks@replica", nil, "select * from t where a = :a and b = :b", bindVars),
+		consolidationKey(callerid.NewContext(context.Background(), callerid.NewEffectiveCallerID("user2", "", ""), callerid.NewImmediateCallerID("app1")), "ks@replica", nil, "select * from t where a = :a and b = :b", bindVars),
+		consolidationKey(callerid.NewContext(context.Background(), callerid.NewEffectiveCallerID("user1", "", ""), callerid.NewImmediateCallerID("app2")), "ks@replica", nil, "select * from t where a = :a and b = :b", bindVars),
+		consolidationKey(ctx, "ks@master", nil, "select * from t where a = :a and b = :b", bindVars),
+		consolidationKey(ctx, "ks@replica", &querypb.ExecuteOptions{IncludedFields: querypb.ExecuteOptions_TYPE_ONLY}, "select * from t where a = :a and b = :b", bindVars),
+		consolidationKey(ctx, "ks@replica", nil, "select * from t where a = :b and b = :a", bindVars),
+		consolidationKey(ctx, "ks@replica", nil, "select * from t where a = :a and b = :b", map[string]*querypb.BindVariable{
+			"a": sqltypes.Int64BindVariable(2),
+			"b": sqltypes.StringBindVariable("x"),
+		}),
+	}
+	for _, got := range different {
+		if got == key {
+			t.Errorf("consolidationKey(...) = %q for different queries", got)
+		}
+	}
+}
@@ -53,19 +53,43 @@ type Delete struct {
 	Table *vindexes.Table
 
 	// OwnedVindexQuery is used for deleting lookup vindex entries.
+	// For DeleteSharded, it selects the rows to delete on all the shards,
+	// and its first column is the column of KsidVindex.
 	OwnedVindexQuery string
+
+	// KsidVindex is the primary vindex of Table. For DeleteSharded,
+	// it computes the keyspace ids of the rows to delete.
+	KsidVindex vindexes.Vindex
+
+	// OrderBy, Limit and KeyColumn are set for a DeleteSharded with a
+	// LIMIT clause. The rows of all the shards are sorted according to
+	// OrderBy, which refers to the columns of OwnedVindexQuery, and the
+	// first Limit rows are deleted. OrderBy covers a unique key, whose
+	// column is KeyColumn: each shard receives the keys of its rows in
+	// DMLKeysVarName.
+	OrderBy   []OrderbyParams
+	Limit     *sqltypes.PlanValue
+	KeyColumn int
 }
 
 // MarshalJSON serializes the Delete into a JSON representation.
 // It's used for testing and diagnostics.
 func (del *Delete) MarshalJSON() ([]byte, error) {
-	var tname, vindexName string
+	var tname, vindexName, ksidVindexName string
 	if del.Table != nil {
 		tname = del.Table.Name.String()
 	}
 	if del.Vindex != nil {
 		vindexName = del.Vindex.String()
 	}
+	if del.KsidVindex != nil {
+		ksidVindexName = del.KsidVindex.String()
+	}
+	// The key column is only significant with a limit.
+	var keyColumn *int
+	if del.Limit != nil {
+		keyColumn = &del.KeyColumn
+	}
 	marshalDelete := struct {
 		Opcode           DeleteOpcode
 		Keyspace         *vindexes.Keyspace   `json:",omitempty"`
@@ -74,6 +98,10 @@ func (del *Delete) MarshalJSON() ([]byte, error) {
 		Values           []sqltypes.PlanValue `json:",omitempty"`
 		Table            string               `json:",omitempty"`
 		OwnedVindexQuery string               `json:",omitempty"`
+		KsidVindex       string               `json:",omitempty"`
+		OrderBy          []OrderbyParams      `json:",omitempty"`
+		Limit            *sqltypes.PlanValue  `json:",omitempty"`
+		KeyColumn        *int                 `json:",omitempty"`
 	}{
 		Opcode:           del.Opcode,
 		Keyspace:         del.Keyspace,
@@ -82,6 +110,10 @@ func (del *Delete) MarshalJSON() ([]byte, error) {
 		Values:           del.Values,
 		Table:            tname,
 		OwnedVindexQuery: del.OwnedVindexQuery,
+		KsidVindex:       ksidVindexName,
+		OrderBy:          del.OrderBy,
+		Limit:            del.Limit,
+		KeyColumn:        keyColumn,
 	}
 	return jsonutil.MarshalNoEscape(marshalDelete)
 }
@@ -101,7 +133,11 @@ const (
 	// determine if lookup rows need to be deleted.
 	DeleteEqual
 	// DeleteSharded is for routing a scattered
-	// delete statement.
+	// delete statement. If the table has owned vindexes,
+	// or if the delete has a LIMIT clause, the rows are
+	// first selected with OwnedVindexQuery: their lookup
+	// entries are deleted, and the delete is only sent to
+	// their shards.
 	DeleteSharded
 )
 
@@ -154,11 +190,7 @@ func (del *Delete) execDeleteUnsharded(vcursor VCursor, bindVars map[string]*que
 }
 
 func (del *Delete) execDeleteEqual(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
-	key, err := del.Values[0].ResolveValue(bindVars)
-	if err != nil {
-		return nil, vterrors.Wrap(err, "execDeleteEqual")
-	}
-	ks, shard, ksid, err := resolveSingleShard(vcursor, del.Vindex, del.Keyspace, bindVars, key)
+	ks, shard, ksid, err := resolveSingleShard(vcursor, del.Vindex, del.Keyspace, bindVars, del.Values[0])
 	if err != nil {
 		return nil, vterrors.Wrap(err, "execDeleteEqual")
 	}
@@ -183,23 +215,13 @@ func (del *Delete) deleteVindexEntries(vcursor VCursor, bindVars map[string]*que
 	if len(result.Rows) == 0 {
 		return nil
 	}
-	colnum := 0
-	for _, colVindex := range del.Table.Owned {
-		ids := make([][]sqltypes.Value, len(result.Rows))
-		for range colVindex.Columns {
-			for rowIdx, row := range result.Rows {
-				ids[rowIdx] = append(ids[rowIdx], row[colnum])
-			}
-			colnum++
-		}
-		if err = colVindex.Vindex.(vindexes.Lookup).Delete(vcursor, ids, ksid); err != nil {
-			return err
-		}
-	}
-	return nil
+	return deleteLookupEntries(vcursor, del.Table, result.Rows, 0, ksid)
 }
 
 func (del *Delete) execDeleteSharded(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	if del.OwnedVindexQuery != "" {
+		return del.execDeleteShardedRows(vcursor, bindVars)
+	}
 	ks, allShards, err := vcursor.GetKeyspaceShards(del.Keyspace)
 	if err != nil {
 		return nil, vterrors.Wrap(err, "execDeleteSharded")
@@ -215,3 +237,23 @@ func (del *Delete) execDeleteSharded(vcursor VCursor, bindVars map[string]*query
 	}
 	return vcursor.ExecuteMultiShard(ks, shardQueries, true /* isDML */, true /* canAutocommit */)
 }
+
+// execDeleteShardedRows deletes the rows selected by OwnedVindexQuery,
+// after deleting their lookup entries.
+func (del *Delete) execDeleteShardedRows(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	rows, err := findDMLRows(vcursor, bindVars, del.Keyspace, "", del.OwnedVindexQuery, del.KsidVindex, ksidColumnCount(del.Table), del.OrderBy, del.Limit, del.KeyColumn)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execDeleteSharded")
+	}
+	for i, row := range rows.rows {
+		// The owned vindex columns follow the primary vindex columns.
+		if err := deleteLookupEntries(vcursor, del.Table, [][]sqltypes.Value{row}, ksidColumnCount(del.Table), rows.ksids[i]); err != nil {
+			return nil, vterrors.Wrap(err, "execDeleteSharded")
+		}
+	}
+	result, err := execDMLShards(vcursor, del.Query, bindVars, rows)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execDeleteSharded")
+	}
+	return result, nil
+}
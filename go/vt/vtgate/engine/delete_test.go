@@ -86,6 +86,38 @@ func TestDeleteEqual(t *testing.T) {
 	expectError(t, "Execute", err, "execDeleteEqual: missing bind var aa")
 }
 
+func TestDeleteEqualMultiColumn(t *testing.T) {
+	vindex, _ := vindexes.CreateVindex("region_experimental", "", map[string]string{"region_bytes": "1"})
+	del := &Delete{
+		Opcode: DeleteEqual,
+		Keyspace: &vindexes.Keyspace{
+			Name:    "ks",
+			Sharded: true,
+		},
+		Query:  "dummy_delete",
+		Vindex: vindex,
+		Values: []sqltypes.PlanValue{{
+			Values: []sqltypes.PlanValue{{Value: sqltypes.NewInt64(1)}, {Value: sqltypes.NewInt64(1)}},
+		}},
+	}
+
+	vc := &loggingVCursor{shards: []string{"-20", "20-"}}
+	_, err := del.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{ks true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "01166b40b44aba4bd6"`,
+		`ExecuteMultiShard ks -20: dummy_delete /* vtgate:: keyspace_id:01166b40b44aba4bd6 */  true true`,
+	})
+
+	// Only the region: the delete can't be routed to a single shard.
+	del.Values[0].Values = del.Values[0].Values[:1]
+	_, err = del.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	expectError(t, "Execute", err, "execDeleteEqual: vindex could not map the value to a unique keyspace id")
+}
+
 func TestDeleteEqualNoRoute(t *testing.T) {
 	vindex, _ := vindexes.NewLookupUnique("", map[string]string{
 		"table": "lkp",
@@ -265,3 +297,65 @@ func TestDeleteNoStream(t *testing.T) {
 	err := del.StreamExecute(nil, nil, false, nil)
 	expectError(t, "StreamExecute", err, `query "" cannot be used for streaming`)
 }
+
+func TestDeleteShardedOwnedVindex(t *testing.T) {
+	ks := buildTestVSchema().Keyspaces["sharded"]
+	del := &Delete{
+		Opcode:           DeleteSharded,
+		Keyspace:         ks.Keyspace,
+		Query:            "dummy_delete",
+		Table:            ks.Tables["t1"],
+		OwnedVindexQuery: "dummy_subquery",
+		KsidVindex:       ks.Vindexes["hash"],
+		OrderBy:          []OrderbyParams{{Col: 4, Desc: true}, {Col: 0}},
+		Limit:            &sqltypes.PlanValue{Value: sqltypes.NewInt64(2)},
+		KeyColumn:        0,
+	}
+
+	results := []*sqltypes.Result{sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"id|c1|c2|c3|col",
+			"int64|int64|int64|int64|int64",
+		),
+		"1|4|5|6|10",
+		"3|1|1|1|30",
+		"2|7|8|9|30",
+	)}
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "20-"},
+		results:      results,
+	}
+	_, err := del.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		// The rows are selected on all the shards.
+		`ExecuteMultiShard sharded -20: dummy_subquery 20-: dummy_subquery  false false`,
+		// Only the first two rows in the order of col and id are kept:
+		// 2 and 3, which tie on col.
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "4eb190c9a2fa169c"`,
+		`Execute delete from lkp2 where from1 = :from1 and from2 = :from2 and toc = :toc from1: type:INT64 value:"7" from2: type:INT64 value:"8" toc: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"9" toc: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`Execute delete from lkp2 where from1 = :from1 and from2 = :from2 and toc = :toc from1: type:INT64 value:"1" from2: type:INT64 value:"1" toc: type:VARBINARY value:"N\261\220\311\242\372\026\234"  true`,
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"1" toc: type:VARBINARY value:"N\261\220\311\242\372\026\234"  true`,
+		// Each shard deletes its row by its id.
+		`ExecuteMultiShard sharded -20: dummy_delete __dml_keys: type:TUPLE values:<type:INT64 value:"2" > 20-: dummy_delete __dml_keys: type:TUPLE values:<type:INT64 value:"3" >  true true`,
+	})
+
+	// No rows to delete.
+	vc = &loggingVCursor{
+		shards: []string{"-20", "20-"},
+	}
+	_, err = del.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		`ExecuteMultiShard sharded -20: dummy_subquery 20-: dummy_subquery  false false`,
+	})
+}
@@ -0,0 +1,194 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"fmt"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlannotation"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// DMLKeysVarName is the list bind variable that receives the unique
+// keys of the rows that a DML with a LIMIT clause changes in a shard.
+const DMLKeysVarName = "__dml_keys"
+
+// dmlRows are the rows that a multi-shard DML changes, as returned
+// by its OwnedVindexQuery, along with their keyspace id and shard.
+// If the DML has a LIMIT clause, keys are their unique keys.
+type dmlRows struct {
+	keyspace string
+	fields   []*querypb.Field
+	rows     [][]sqltypes.Value
+	ksids    [][]byte
+	shards   []string
+	keys     []sqltypes.Value
+}
+
+// findDMLRows executes query, which selects the rows of a DML for
+// update, on shard, or on all the shards if shard is empty. The first
+// ksidColumns columns of the query must be the columns of ksidVindex,
+// which give the keyspace ids of the rows. If orderBy is set, the rows
+// of all the shards are sorted, and only the first ones are kept if
+// limit is set. The unique keys of the kept rows are then taken from
+// keyColumn: since orderBy covers it, the rows are in a total order,
+// and the keys are the only way to change the same rows in the shards.
+func findDMLRows(vcursor VCursor, bindVars map[string]*querypb.BindVariable, keyspace *vindexes.Keyspace, shard, query string, ksidVindex vindexes.Vindex, ksidColumns int, orderBy []OrderbyParams, limit *sqltypes.PlanValue, keyColumn int) (*dmlRows, error) {
+	ks, allShards, err := vcursor.GetKeyspaceShards(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	shardQueries := make(map[string]*querypb.BoundQuery, len(allShards))
+	for _, s := range allShards {
+		if shard != "" && s.Name != shard {
+			continue
+		}
+		shardQueries[s.Name] = &querypb.BoundQuery{
+			Sql:           query,
+			BindVariables: bindVars,
+		}
+	}
+	result, err := vcursor.ExecuteMultiShard(ks, shardQueries, false /* isDML */, false /* canAutocommit */)
+	if err != nil {
+		return nil, err
+	}
+	rows := result.Rows
+	if len(orderBy) != 0 {
+		if err := sortRows(rows, orderBy); err != nil {
+			return nil, err
+		}
+	}
+	if limit != nil {
+		count, err := fetchLimit(*limit, bindVars)
+		if err != nil {
+			return nil, err
+		}
+		if count < len(rows) {
+			rows = rows[:count]
+		}
+	}
+
+	dr := &dmlRows{
+		keyspace: ks,
+		fields:   result.Fields,
+		rows:     rows,
+	}
+	if len(rows) == 0 {
+		return dr, nil
+	}
+	if limit != nil {
+		dr.keys = make([]sqltypes.Value, len(rows))
+		for i, row := range rows {
+			dr.keys[i] = row[keyColumn]
+		}
+	}
+	var ksids []vindexes.KsidOrRange
+	switch mapper := ksidVindex.(type) {
+	case vindexes.MultiColumn:
+		rowsColValues := make([][]sqltypes.Value, len(rows))
+		for i, row := range rows {
+			rowsColValues[i] = row[:ksidColumns]
+		}
+		ksids, err = mapper.MapMulti(vcursor, rowsColValues)
+	default:
+		ids := make([]sqltypes.Value, len(rows))
+		for i, row := range rows {
+			ids[i] = row[0]
+		}
+		ksids, err = mapper.(vindexes.Unique).Map(vcursor, ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, ksid := range ksids {
+		if err := ksid.ValidateUnique(); err != nil {
+			return nil, err
+		}
+		if ksid.ID == nil {
+			return nil, fmt.Errorf("could not map %v to a keyspace id", rows[i][:ksidColumns])
+		}
+		shard, err := vcursor.GetShardForKeyspaceID(allShards, ksid.ID)
+		if err != nil {
+			return nil, err
+		}
+		dr.ksids = append(dr.ksids, ksid.ID)
+		dr.shards = append(dr.shards, shard)
+	}
+	return dr, nil
+}
+
+// ksidColumnCount returns the number of columns of the primary vindex
+// of table, which are the first columns of its OwnedVindexQuery.
+func ksidColumnCount(table *vindexes.Table) int {
+	return len(table.ColumnVindexes[0].Columns)
+}
+
+// execDMLShards executes query on the shards of rows. If rows has
+// keys, each shard receives the keys of its rows in DMLKeysVarName.
+func execDMLShards(vcursor VCursor, query string, bindVars map[string]*querypb.BindVariable, rows *dmlRows) (*sqltypes.Result, error) {
+	if len(rows.rows) == 0 {
+		return &sqltypes.Result{}, nil
+	}
+	keys := make(map[string]*querypb.BindVariable)
+	for i, shard := range rows.shards {
+		if _, ok := keys[shard]; !ok {
+			keys[shard] = &querypb.BindVariable{Type: querypb.Type_TUPLE}
+		}
+		if rows.keys != nil {
+			keys[shard].Values = append(keys[shard].Values, sqltypes.ValueToProto(rows.keys[i]))
+		}
+	}
+	sql := sqlannotation.AnnotateIfDML(query, nil)
+	shardQueries := make(map[string]*querypb.BoundQuery, len(keys))
+	for shard, shardKeys := range keys {
+		bv := bindVars
+		if rows.keys != nil {
+			bv = make(map[string]*querypb.BindVariable, len(bindVars)+1)
+			for k, v := range bindVars {
+				bv[k] = v
+			}
+			bv[DMLKeysVarName] = shardKeys
+		}
+		shardQueries[shard] = &querypb.BoundQuery{
+			Sql:           sql,
+			BindVariables: bv,
+		}
+	}
+	return vcursor.ExecuteMultiShard(rows.keyspace, shardQueries, true /* isDML */, true /* canAutocommit */)
+}
+
+// deleteLookupEntries deletes the entries of the owned vindexes of table
+// for rows, which all have the same keyspace id. The owned vindex columns
+// are in the order of table.Owned, starting at colnum.
+func deleteLookupEntries(vcursor VCursor, table *vindexes.Table, rows [][]sqltypes.Value, colnum int, ksid []byte) error {
+	for _, colVindex := range table.Owned {
+		ids := make([][]sqltypes.Value, len(rows))
+		for range colVindex.Columns {
+			for rowIdx, row := range rows {
+				ids[rowIdx] = append(ids[rowIdx], row[colnum])
+			}
+			colnum++
+		}
+		if err := colVindex.Vindex.(vindexes.Lookup).Delete(vcursor, ids, ksid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -30,6 +30,8 @@ type fakePrimitive struct {
 	curResult int
 	// sendErr is sent at the end of the stream if it's set.
 	sendErr error
+	// bindVars records the bind variables of every call.
+	bindVars []map[string]*querypb.BindVariable
 }
 
 func (tp *fakePrimitive) rewind() {
@@ -37,6 +39,7 @@ func (tp *fakePrimitive) rewind() {
 }
 
 func (tp *fakePrimitive) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	tp.bindVars = append(tp.bindVars, bindVars)
 	if tp.results == nil {
 		return nil, tp.sendErr
 	}
@@ -50,6 +53,7 @@ func (tp *fakePrimitive) Execute(vcursor VCursor, bindVars map[string]*querypb.B
 }
 
 func (tp *fakePrimitive) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantields bool, callback func(*sqltypes.Result) error) error {
+	tp.bindVars = append(tp.bindVars, bindVars)
 	if tp.results == nil {
 		return tp.sendErr
 	}
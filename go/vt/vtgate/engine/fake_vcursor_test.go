@@ -31,6 +31,7 @@ import (
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 // noopVCursor is used to build other vcursors.
@@ -41,7 +42,7 @@ func (t noopVCursor) Context() context.Context {
 	return context.Background()
 }
 
-func (t noopVCursor) Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+func (t noopVCursor) Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error) {
 	panic("unimplemented")
 }
 
@@ -49,6 +50,18 @@ func (t noopVCursor) ExecuteAutocommit(method string, query string, bindvars map
 	panic("unimplemented")
 }
 
+func (t noopVCursor) ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	panic("unimplemented")
+}
+
+func (t noopVCursor) CommitBatch() error {
+	panic("unimplemented")
+}
+
+func (t noopVCursor) InTransaction() bool {
+	return false
+}
+
 func (t noopVCursor) ExecuteMultiShard(keyspace string, shardQueries map[string]*querypb.BoundQuery, isDML, canAutocommit bool) (*sqltypes.Result, error) {
 	panic("unimplemented")
 }
@@ -87,6 +100,8 @@ type loggingVCursor struct {
 	curResult int
 	resultErr error
 
+	inTransaction bool
+
 	log []string
 }
 
@@ -94,11 +109,34 @@ func (f *loggingVCursor) Context() context.Context {
 	return context.Background()
 }
 
-func (f *loggingVCursor) Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
-	f.log = append(f.log, fmt.Sprintf("Execute %s %v %v", query, printBindVars(bindvars), isDML))
+func (f *loggingVCursor) Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error) {
+	name := "Unknown"
+	switch co {
+	case vtgatepb.CommitOrder_NORMAL:
+		name = "Execute"
+	case vtgatepb.CommitOrder_PRE:
+		name = "ExecutePre"
+	case vtgatepb.CommitOrder_POST:
+		name = "ExecutePost"
+	}
+	f.log = append(f.log, fmt.Sprintf("%s %s %v %v", name, query, printBindVars(bindvars), isDML))
+	return f.nextResult()
+}
+
+func (f *loggingVCursor) ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	f.log = append(f.log, fmt.Sprintf("ExecuteKeyspaceID %s %q %s %v %v", keyspace, hex.EncodeToString(ksid), query, printBindVars(bindVars), isDML))
 	return f.nextResult()
 }
 
+func (f *loggingVCursor) CommitBatch() error {
+	f.log = append(f.log, "CommitBatch")
+	return nil
+}
+
+func (f *loggingVCursor) InTransaction() bool {
+	return f.inTransaction
+}
+
 func (f *loggingVCursor) ExecuteMultiShard(keyspace string, shardQueries map[string]*querypb.BoundQuery, isDML, canAutocommit bool) (*sqltypes.Result, error) {
 	f.log = append(f.log, fmt.Sprintf("ExecuteMultiShard %s %v %v %v", keyspace, printShardQueries(shardQueries), isDML, canAutocommit))
 	return f.nextResult()
@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/json"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var _ Primitive = (*Filter)(nil)
+
+// Filter is a primitive that returns only the rows of
+// the underlying primitive that satisfy the Predicate.
+// It's used for conditions that cannot be pushed down
+// to the underlying primitive.
+type Filter struct {
+	Predicate evalengine.Expr
+	Input     Primitive
+}
+
+// MarshalJSON serializes the Filter into a JSON representation.
+// It's used for testing and diagnostics.
+func (f *Filter) MarshalJSON() ([]byte, error) {
+	marshalFilter := struct {
+		Opcode    string
+		Predicate string
+		Input     Primitive
+	}{
+		Opcode:    "Filter",
+		Predicate: f.Predicate.String(),
+		Input:     f.Input,
+	}
+	return json.Marshal(marshalFilter)
+}
+
+// Execute satisfies the Primtive interface.
+func (f *Filter) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	result, err := f.Input.Execute(vcursor, bindVars, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := f.filter(bindVars, result.Fields, result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{
+		Fields:       result.Fields,
+		Rows:         rows,
+		RowsAffected: uint64(len(rows)),
+	}, nil
+}
+
+// StreamExecute satisfies the Primtive interface.
+func (f *Filter) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	var fields []*querypb.Field
+	return f.Input.StreamExecute(vcursor, bindVars, wantfields, func(qr *sqltypes.Result) error {
+		if len(qr.Fields) != 0 {
+			fields = qr.Fields
+		}
+		rows, err := f.filter(bindVars, fields, qr.Rows)
+		if err != nil {
+			return err
+		}
+		if len(qr.Fields) == 0 && len(rows) == 0 {
+			return nil
+		}
+		return callback(&sqltypes.Result{Fields: qr.Fields, Rows: rows})
+	})
+}
+
+// GetFields satisfies the Primtive interface.
+func (f *Filter) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	return f.Input.GetFields(vcursor, bindVars)
+}
+
+func (f *Filter) filter(bindVars map[string]*querypb.BindVariable, fields []*querypb.Field, rows [][]sqltypes.Value) ([][]sqltypes.Value, error) {
+	var filtered [][]sqltypes.Value
+	env := evalengine.ExpressionEnv{
+		BindVars: bindVars,
+		Fields:   fields,
+	}
+	for _, row := range rows {
+		env.Row = row
+		ok, err := evalengine.EvaluateBool(f.Predicate, env)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered, nil
+}
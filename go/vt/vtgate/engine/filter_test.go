@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestFilterExecute(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"col1|col2",
+		"int64|varchar",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"1|a",
+			"2|null",
+			"3|c",
+			"4|d",
+			"5|e",
+		)},
+	}
+
+	// col1 > :val and col2 is not null
+	f := &Filter{
+		Predicate: &evalengine.And{
+			Left: &evalengine.Comparison{
+				Op:    ">",
+				Left:  &evalengine.Column{Offset: 0},
+				Right: &evalengine.BindVariable{Key: "val"},
+			},
+			Right: &evalengine.Is{
+				Op:   "is not null",
+				Expr: &evalengine.Column{Offset: 1},
+			},
+		},
+		Input: tp,
+	}
+	bindVars := map[string]*querypb.BindVariable{"val": sqltypes.Int64BindVariable(1)}
+
+	result, err := f.Execute(nil, bindVars, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		fields,
+		"3|c",
+		"4|d",
+		"5|e",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("f.Execute:\n%v, want\n%v", result, wantResult)
+	}
+
+	tp.rewind()
+	var results []*sqltypes.Result
+	err = f.StreamExecute(nil, bindVars, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The input sends two rows at a time. The first
+	// batch is empty after filtering, and is not sent.
+	wantResults := sqltypes.MakeTestStreamingResults(
+		fields,
+		"3|c",
+		"4|d",
+		"---",
+		"5|e",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("f.StreamExecute:\n%s, want\n%s", sqltypes.PrintResults(results), sqltypes.PrintResults(wantResults))
+	}
+}
+
+func TestFilterError(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"col1",
+		"int64",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"1",
+		)},
+	}
+	f := &Filter{
+		Predicate: &evalengine.Comparison{
+			Op:    "=",
+			Left:  &evalengine.Column{Offset: 0},
+			Right: &evalengine.BindVariable{Key: "val"},
+		},
+		Input: tp,
+	}
+
+	want := "missing bind var val"
+	if _, err := f.Execute(nil, nil, false); err == nil || err.Error() != want {
+		t.Errorf("f.Execute(): %v, want %s", err, want)
+	}
+
+	tp.rewind()
+	err := f.StreamExecute(nil, nil, false, func(_ *sqltypes.Result) error { return nil })
+	if err == nil || err.Error() != want {
+		t.Errorf("f.StreamExecute(): %v, want %s", err, want)
+	}
+
+	f.Input = &fakePrimitive{sendErr: errors.New("input fail")}
+	want = "input fail"
+	if _, err := f.Execute(nil, nil, false); err == nil || err.Error() != want {
+		t.Errorf("f.Execute(): %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// HashJoinMemoryLimit is the maximum number of bytes that the rows
+// held in memory by a HashJoin or a SemiJoin can add up to.
+var HashJoinMemoryLimit int64 = 64 * 1024 * 1024
+
+var _ Primitive = (*HashJoin)(nil)
+
+// HashJoin is a join that executes each side only once. The rows
+// of the RHS are loaded in a hash table, which is then probed with
+// the rows of the LHS. Unlike Join, the RHS cannot depend on
+// values from the LHS, and the join condition is limited to
+// equalities between LeftKeys and RightKeys.
+// The rows are returned in the order of the LHS.
+type HashJoin struct {
+	Opcode JoinOpcode
+	// Left and Right are the LHS and RHS primitives
+	// of the HashJoin. They can be any primitive.
+	Left, Right Primitive
+
+	// Cols defines which columns from the left
+	// or right results should be used to build the
+	// return result. It works like Join.Cols.
+	Cols []int
+
+	// LeftKeys and RightKeys are the columns of the LHS and RHS
+	// results that must be equal for two rows to join. They must
+	// be numbers or binary strings, see joinKey.
+	LeftKeys, RightKeys []int
+}
+
+// MarshalJSON serializes the HashJoin into a JSON representation.
+// It's used for testing and diagnostics.
+func (hj *HashJoin) MarshalJSON() ([]byte, error) {
+	marshalHashJoin := struct {
+		Opcode    string
+		Left      Primitive `json:",omitempty"`
+		Right     Primitive `json:",omitempty"`
+		Cols      []int     `json:",omitempty"`
+		LeftKeys  []int
+		RightKeys []int
+	}{
+		Opcode:    "Hash" + hj.Opcode.String(),
+		Left:      hj.Left,
+		Right:     hj.Right,
+		Cols:      hj.Cols,
+		LeftKeys:  hj.LeftKeys,
+		RightKeys: hj.RightKeys,
+	}
+	return json.Marshal(marshalHashJoin)
+}
+
+// Execute performs a non-streaming exec.
+func (hj *HashJoin) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	rresult, err := hj.Right.Execute(vcursor, bindVars, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	ht := newHashTable()
+	if err := ht.add(rresult.Rows, hj.RightKeys); err != nil {
+		return nil, err
+	}
+	lresult, err := hj.Left.Execute(vcursor, bindVars, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	result := &sqltypes.Result{}
+	if wantfields {
+		result.Fields = joinFields(lresult.Fields, rresult.Fields, hj.Cols)
+	}
+	for _, lrow := range lresult.Rows {
+		result.Rows = append(result.Rows, ht.join(hj.Opcode, lrow, hj.LeftKeys, hj.Cols)...)
+	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// StreamExecute performs a streaming exec.
+func (hj *HashJoin) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	var rfields []*querypb.Field
+	ht := newHashTable()
+	err := hj.Right.StreamExecute(vcursor, bindVars, wantfields, func(rresult *sqltypes.Result) error {
+		if len(rresult.Fields) != 0 {
+			rfields = rresult.Fields
+		}
+		return ht.add(rresult.Rows, hj.RightKeys)
+	})
+	if err != nil {
+		return err
+	}
+	return hj.Left.StreamExecute(vcursor, bindVars, wantfields, func(lresult *sqltypes.Result) error {
+		result := &sqltypes.Result{}
+		if wantfields && len(lresult.Fields) != 0 {
+			result.Fields = joinFields(lresult.Fields, rfields, hj.Cols)
+		}
+		for _, lrow := range lresult.Rows {
+			result.Rows = append(result.Rows, ht.join(hj.Opcode, lrow, hj.LeftKeys, hj.Cols)...)
+		}
+		if len(result.Fields) == 0 && len(result.Rows) == 0 {
+			return nil
+		}
+		return callback(result)
+	})
+}
+
+// GetFields fetches the field info.
+func (hj *HashJoin) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	lresult, err := hj.Left.GetFields(vcursor, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	rresult, err := hj.Right.GetFields(vcursor, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{Fields: joinFields(lresult.Fields, rresult.Fields, hj.Cols)}, nil
+}
+
+// hashTable contains the rows of the RHS of a join,
+// indexed by the key returned by joinKey.
+type hashTable struct {
+	rows map[string][][]sqltypes.Value
+	size int64
+}
+
+func newHashTable() *hashTable {
+	return &hashTable{rows: make(map[string][][]sqltypes.Value)}
+}
+
+// add adds the rows to the hash table. Rows that have a NULL key
+// are skipped because they cannot match. It returns an error if the
+// size of the rows exceeds HashJoinMemoryLimit.
+func (ht *hashTable) add(rows [][]sqltypes.Value, keys []int) error {
+	for _, row := range rows {
+		key, ok := joinKey(row, keys)
+		if !ok {
+			continue
+		}
+		for _, v := range row {
+			ht.size += int64(v.Len())
+		}
+		if ht.size > HashJoinMemoryLimit {
+			return vterrors.Errorf(vtrpcpb.Code_RESOURCE_EXHAUSTED, "rows of the right side of the join exceed the memory limit of %d bytes", HashJoinMemoryLimit)
+		}
+		ht.rows[key] = append(ht.rows[key], row)
+	}
+	return nil
+}
+
+// join returns the rows resulting from the join of lrow with the
+// matching rows of the hash table. If it's a left join, and there
+// are no matching rows, lrow is returned with NULLs for the RHS.
+func (ht *hashTable) join(opcode JoinOpcode, lrow []sqltypes.Value, keys []int, cols []int) [][]sqltypes.Value {
+	var matches [][]sqltypes.Value
+	if key, ok := joinKey(lrow, keys); ok {
+		matches = ht.rows[key]
+	}
+	if len(matches) == 0 {
+		if opcode == LeftJoin {
+			return [][]sqltypes.Value{joinRows(lrow, nil, cols)}
+		}
+		return nil
+	}
+	rows := make([][]sqltypes.Value, len(matches))
+	for i, rrow := range matches {
+		rows[i] = joinRows(lrow, rrow, cols)
+	}
+	return rows
+}
+
+// joinKey returns a key that is the same for rows whose values in
+// cols are equal, and false if any of those values is NULL.
+// Numbers are compared by value, which makes 1, 1.0 and 1e0 equal.
+// Other values are compared byte by byte, which is only correct for
+// binary strings: the planner doesn't use a hash join or a semi-join
+// for text keys, whose collation may make different bytes equal.
+func joinKey(row []sqltypes.Value, cols []int) (string, bool) {
+	var key []byte
+	for _, col := range cols {
+		v := row[col]
+		if v.IsNull() {
+			return "", false
+		}
+		raw := v.Raw()
+		switch {
+		case v.Type() == sqltypes.Decimal:
+			raw = normalizeDecimal(raw)
+		case v.IsFloat():
+			if f, err := strconv.ParseFloat(v.ToString(), 64); err == nil {
+				raw = normalizeFloat(f)
+			}
+		}
+		// The length prefix keeps the values apart.
+		key = strconv.AppendInt(key, int64(len(raw)), 10)
+		key = append(key, ':')
+		key = append(key, raw...)
+	}
+	return string(key), true
+}
+
+// normalizeFloat formats f without an exponent, and like an integer
+// if it has no fractional part, so that it can match the canonical
+// form of an integral or decimal value.
+func normalizeFloat(f float64) []byte {
+	if f == 0 {
+		// -0 and 0 are equal.
+		return []byte("0")
+	}
+	return strconv.AppendFloat(nil, f, 'f', -1, 64)
+}
+
+// normalizeDecimal returns the canonical form of a decimal value,
+// without going through a float64 that would make large values
+// collide: leading zeros of the integral part and trailing zeros of
+// the fractional part are removed, and the sign of zero is dropped.
+// 1.50, 01.5 and +1.5 are all 1.5, and 1.00 is 1.
+func normalizeDecimal(raw []byte) []byte {
+	neg := false
+	if len(raw) > 0 && (raw[0] == '-' || raw[0] == '+') {
+		neg = raw[0] == '-'
+		raw = raw[1:]
+	}
+	if dot := bytes.IndexByte(raw, '.'); dot != -1 {
+		raw = bytes.TrimRight(raw, "0")
+		raw = bytes.TrimSuffix(raw, []byte("."))
+	}
+	raw = bytes.TrimLeft(raw, "0")
+	if len(raw) == 0 || raw[0] == '.' {
+		raw = append([]byte("0"), raw...)
+	}
+	if neg && !bytes.Equal(raw, []byte("0")) {
+		raw = append([]byte("-"), raw...)
+	}
+	return raw
+}
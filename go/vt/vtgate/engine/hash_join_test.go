@@ -0,0 +1,321 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestHashJoinExecute(t *testing.T) {
+	leftFields := sqltypes.MakeTestFields(
+		"col1|col2",
+		"int64|varchar",
+	)
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			leftFields,
+			"1|a",
+			"2|b",
+			"3|c",
+			"null|d",
+		)},
+	}
+	rightFields := sqltypes.MakeTestFields(
+		"col3|col4",
+		"decimal|varchar",
+	)
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			rightFields,
+			"1.0|x",
+			"3|y",
+			"1|z",
+			"null|w",
+		)},
+	}
+
+	hj := &HashJoin{
+		Opcode:    NormalJoin,
+		Left:      leftPrim,
+		Right:     rightPrim,
+		Cols:      []int{-1, -2, 2},
+		LeftKeys:  []int{0},
+		RightKeys: []int{0},
+	}
+	result, err := hj.Execute(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|col2|col4",
+			"int64|varchar|varchar",
+		),
+		"1|a|x",
+		"1|a|z",
+		"3|c|y",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("hj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+
+	// Left join.
+	leftPrim.rewind()
+	rightPrim.rewind()
+	hj.Opcode = LeftJoin
+	result, err = hj.Execute(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult = sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|col2|col4",
+			"int64|varchar|varchar",
+		),
+		"1|a|x",
+		"1|a|z",
+		"2|b|null",
+		"3|c|y",
+		"null|d|null",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("hj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+}
+
+func TestHashJoinTextKey(t *testing.T) {
+	// Text keys are compared byte by byte, so 'a' doesn't match 'A'
+	// like it does with a case-insensitive collation in MySQL. This is
+	// why the planner only builds hash joins on numbers and binary
+	// strings.
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col1",
+				"varchar",
+			),
+			"a",
+			"b",
+		)},
+	}
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col2",
+				"varchar",
+			),
+			"A",
+			"b",
+		)},
+	}
+	hj := &HashJoin{
+		Opcode:    NormalJoin,
+		Left:      leftPrim,
+		Right:     rightPrim,
+		Cols:      []int{-1, 1},
+		LeftKeys:  []int{0},
+		RightKeys: []int{0},
+	}
+	result, err := hj.Execute(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|col2",
+			"varchar|varchar",
+		),
+		"b|b",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("hj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+}
+
+func TestHashJoinStreamExecute(t *testing.T) {
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col1|col2",
+				"int64|varchar",
+			),
+			"1|a",
+			"2|b",
+			"3|c",
+		)},
+	}
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col3|col4",
+				"int64|varchar",
+			),
+			"3|y",
+			"1|x",
+		)},
+	}
+
+	hj := &HashJoin{
+		Opcode:    LeftJoin,
+		Left:      leftPrim,
+		Right:     rightPrim,
+		Cols:      []int{-1, 2},
+		LeftKeys:  []int{0},
+		RightKeys: []int{0},
+	}
+	var results []*sqltypes.Result
+	err := hj.StreamExecute(nil, nil, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFields := sqltypes.MakeTestFields(
+		"col1|col4",
+		"int64|varchar",
+	)
+	wantResults := sqltypes.MakeTestStreamingResults(
+		wantFields,
+		"1|x",
+		"2|null",
+		"---",
+		"3|y",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("hj.StreamExecute:\n%v, want\n%v", results, wantResults)
+	}
+}
+
+func TestHashJoinMemoryLimit(t *testing.T) {
+	saved := HashJoinMemoryLimit
+	defer func() { HashJoinMemoryLimit = saved }()
+	HashJoinMemoryLimit = 10
+
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields("col1", "int64"),
+			"1",
+		)},
+	}
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields("col1|col2", "int64|varchar"),
+			"1|aaaa",
+			"2|bbbb",
+			"3|cccc",
+		)},
+	}
+	hj := &HashJoin{
+		Left:      leftPrim,
+		Right:     rightPrim,
+		Cols:      []int{-1, 2},
+		LeftKeys:  []int{0},
+		RightKeys: []int{0},
+	}
+	_, err := hj.Execute(nil, nil, false)
+	want := "exceed the memory limit of 10 bytes"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("hj.Execute: %v, want %s", err, want)
+	}
+}
+
+func TestJoinKey(t *testing.T) {
+	testcases := []struct {
+		v1, v2 sqltypes.Value
+		equal  bool
+	}{{
+		v1:    sqltypes.NewInt64(1),
+		v2:    sqltypes.NewUint64(1),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewInt64(1),
+		v2:    sqltypes.NewFloat64(1),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewInt64(1),
+		v2:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("1.00")),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewFloat64(1.5),
+		v2:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("1.50")),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewInt64(1),
+		v2:    sqltypes.NewInt64(2),
+		equal: false,
+	}, {
+		v1:    sqltypes.NewInt64(-10),
+		v2:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("-010.0")),
+		equal: true,
+	}, {
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("-0.00")),
+		v2:    sqltypes.NewInt64(0),
+		equal: true,
+	}, {
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("0.50")),
+		v2:    sqltypes.NewFloat64(0.5),
+		equal: true,
+	}, {
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("100")),
+		v2:    sqltypes.NewFloat64(1e2),
+		equal: true,
+	}, {
+		// Large decimals that are the same float64 stay apart.
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("12345678901234567890.1")),
+		v2:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("12345678901234567890.2")),
+		equal: false,
+	}, {
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("9007199254740993")),
+		v2:    sqltypes.NewInt64(9007199254740992),
+		equal: false,
+	}, {
+		v1:    sqltypes.MakeTrusted(sqltypes.Decimal, []byte("9007199254740993.000")),
+		v2:    sqltypes.NewInt64(9007199254740993),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewVarChar("a"),
+		v2:    sqltypes.NewVarBinary("a"),
+		equal: true,
+	}, {
+		v1:    sqltypes.NewVarChar("a"),
+		v2:    sqltypes.NewVarChar("A"),
+		equal: false,
+	}}
+	for _, tcase := range testcases {
+		k1, _ := joinKey([]sqltypes.Value{tcase.v1}, []int{0})
+		k2, _ := joinKey([]sqltypes.Value{tcase.v2}, []int{0})
+		if (k1 == k2) != tcase.equal {
+			t.Errorf("joinKey(%v) == joinKey(%v): %v, want %v", tcase.v1, tcase.v2, k1 == k2, tcase.equal)
+		}
+	}
+
+	// The values of multiple columns are kept apart.
+	k1, _ := joinKey([]sqltypes.Value{sqltypes.NewVarChar("ab"), sqltypes.NewVarChar("c")}, []int{0, 1})
+	k2, _ := joinKey([]sqltypes.Value{sqltypes.NewVarChar("a"), sqltypes.NewVarChar("bc")}, []int{0, 1})
+	if k1 == k2 {
+		t.Errorf("joinKey(ab, c) == joinKey(a, bc)")
+	}
+
+	if _, ok := joinKey([]sqltypes.Value{sqltypes.NewInt64(1), sqltypes.NULL}, []int{0, 1}); ok {
+		t.Errorf("joinKey(1, NULL): true, want false")
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package engine
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -33,6 +34,10 @@ import (
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 )
 
+// InsertSelectBatchSize is the maximum number of rows that
+// an INSERT...SELECT inserts with a single set of queries.
+var InsertSelectBatchSize = 500
+
 var _ Primitive = (*Insert)(nil)
 
 // Insert represents the instructions to perform an insert operation.
@@ -62,9 +67,21 @@ type Insert struct {
 	Generate *Generate
 
 	// Prefix, Mid and Suffix are for sharded insert plans.
+	// For InsertSelect plans, Mid is generated for every row.
 	Prefix string
 	Mid    []string
 	Suffix string
+
+	// Input is the primitive that returns the rows of
+	// an InsertSelect plan.
+	Input Primitive
+
+	// VindexValueOffset is used instead of VindexValues for
+	// InsertSelect plans. VindexValueOffset[i][j] is the column
+	// of the rows of Input that contains the value of the j'th
+	// column of the i'th colvindex. If it's beyond the end of
+	// the row, the column was not supplied, and the value is NULL.
+	VindexValueOffset [][]int
 }
 
 // MarshalJSON serializes the Insert into a JSON representation.
@@ -75,25 +92,29 @@ func (ins *Insert) MarshalJSON() ([]byte, error) {
 		tname = ins.Table.Name.String()
 	}
 	marshalInsert := struct {
-		Opcode   InsertOpcode
-		Keyspace *vindexes.Keyspace   `json:",omitempty"`
-		Query    string               `json:",omitempty"`
-		Values   []sqltypes.PlanValue `json:",omitempty"`
-		Table    string               `json:",omitempty"`
-		Generate *Generate            `json:",omitempty"`
-		Prefix   string               `json:",omitempty"`
-		Mid      []string             `json:",omitempty"`
-		Suffix   string               `json:",omitempty"`
+		Opcode            InsertOpcode
+		Keyspace          *vindexes.Keyspace   `json:",omitempty"`
+		Query             string               `json:",omitempty"`
+		Values            []sqltypes.PlanValue `json:",omitempty"`
+		VindexValueOffset [][]int              `json:",omitempty"`
+		Table             string               `json:",omitempty"`
+		Generate          *Generate            `json:",omitempty"`
+		Prefix            string               `json:",omitempty"`
+		Mid               []string             `json:",omitempty"`
+		Suffix            string               `json:",omitempty"`
+		Input             Primitive            `json:",omitempty"`
 	}{
-		Opcode:   ins.Opcode,
-		Keyspace: ins.Keyspace,
-		Query:    ins.Query,
-		Values:   ins.VindexValues,
-		Table:    tname,
-		Generate: ins.Generate,
-		Prefix:   ins.Prefix,
-		Mid:      ins.Mid,
-		Suffix:   ins.Suffix,
+		Opcode:            ins.Opcode,
+		Keyspace:          ins.Keyspace,
+		Query:             ins.Query,
+		Values:            ins.VindexValues,
+		VindexValueOffset: ins.VindexValueOffset,
+		Table:             tname,
+		Generate:          ins.Generate,
+		Prefix:            ins.Prefix,
+		Mid:               ins.Mid,
+		Suffix:            ins.Suffix,
+		Input:             ins.Input,
 	}
 	return jsonutil.MarshalNoEscape(marshalInsert)
 }
@@ -108,6 +129,10 @@ type Generate struct {
 	// values will be generated based on how many were not
 	// supplied (NULL).
 	Values sqltypes.PlanValue
+	// Offset is used instead of Values for InsertSelect plans.
+	// It's the column of the input rows that contains the
+	// supplied values. It works like Insert.VindexValueOffset.
+	Offset int `json:",omitempty"`
 }
 
 // InsertOpcode is a number representing the opcode
@@ -126,12 +151,22 @@ const (
 	// InsertShardedIgnore is for INSERT IGNORE and
 	// INSERT...ON DUPLICATE KEY constructs.
 	InsertShardedIgnore
+	// InsertSelect is for inserting the rows returned by
+	// a SELECT into a sharded table. Requires: Input, and
+	// VindexValueOffset instead of VindexValues.
+	// The rows are inserted in batches of InsertSelectBatchSize.
+	InsertSelect
+	// InsertSelectIgnore is InsertSelect for INSERT IGNORE
+	// and INSERT...ON DUPLICATE KEY constructs.
+	InsertSelectIgnore
 )
 
 var insName = map[InsertOpcode]string{
 	InsertUnsharded:     "InsertUnsharded",
 	InsertSharded:       "InsertSharded",
 	InsertShardedIgnore: "InsertShardedIgnore",
+	InsertSelect:        "InsertSelect",
+	InsertSelectIgnore:  "InsertSelectIgnore",
 }
 
 // MarshalJSON serializes the InsertOpcode as a JSON string.
@@ -147,6 +182,8 @@ func (ins *Insert) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVar
 		return ins.execInsertUnsharded(vcursor, bindVars)
 	case InsertSharded, InsertShardedIgnore:
 		return ins.execInsertSharded(vcursor, bindVars)
+	case InsertSelect, InsertSelectIgnore:
+		return ins.execInsertSelect(vcursor, bindVars)
 	default:
 		// Unreachable.
 		return nil, fmt.Errorf("unsupported query route: %v", ins)
@@ -196,7 +233,7 @@ func (ins *Insert) execInsertSharded(vcursor VCursor, bindVars map[string]*query
 	if err != nil {
 		return nil, vterrors.Wrap(err, "execInsertSharded")
 	}
-	keyspace, shardQueries, err := ins.getInsertShardedRoute(vcursor, bindVars)
+	keyspace, shardQueries, err := ins.getInsertShardedRoute(vcursor, ins.VindexValues, ins.Mid, bindVars)
 	if err != nil {
 		return nil, vterrors.Wrap(err, "execInsertSharded")
 	}
@@ -212,6 +249,178 @@ func (ins *Insert) execInsertSharded(vcursor VCursor, bindVars map[string]*query
 	return result, nil
 }
 
+// execInsertSelect inserts the rows returned by Input in batches.
+// Each batch is routed like the rows of an InsertSharded plan.
+// Within a transaction, the SELECT runs in the transaction, and sees
+// its uncommitted changes. If the transaction was started because of
+// autocommit, each batch is committed separately: a failure can leave
+// the rows of the previous batches inserted.
+// Without a transaction, the rows are streamed and each batch is
+// inserted as soon as it's full, so that they don't all have to fit
+// in memory.
+func (ins *Insert) execInsertSelect(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	if !vcursor.InTransaction() {
+		return ins.streamInsertSelect(vcursor, bindVars)
+	}
+	input, err := ins.Input.Execute(vcursor, bindVars, false)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execInsertSelect")
+	}
+	result := &sqltypes.Result{}
+	rows := input.Rows
+	for len(rows) > 0 {
+		batch := rows
+		if len(batch) > InsertSelectBatchSize {
+			batch = batch[:InsertSelectBatchSize]
+		}
+		rows = rows[len(batch):]
+		qr, err := ins.insertRows(vcursor, bindVars, batch)
+		if err != nil {
+			return nil, vterrors.Wrap(err, "execInsertSelect")
+		}
+		result.RowsAffected += qr.RowsAffected
+		if result.InsertID == 0 {
+			result.InsertID = qr.InsertID
+		}
+		if len(rows) == 0 {
+			break
+		}
+		if err := vcursor.CommitBatch(); err != nil {
+			return nil, vterrors.Wrap(err, "execInsertSelect")
+		}
+	}
+	return result, nil
+}
+
+// streamInsertSelect is execInsertSelect outside of a transaction.
+func (ins *Insert) streamInsertSelect(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	result := &sqltypes.Result{}
+	var batch [][]sqltypes.Value
+	insertBatch := func() error {
+		qr, err := ins.insertRows(vcursor, bindVars, batch)
+		if err != nil {
+			return err
+		}
+		batch = nil
+		result.RowsAffected += qr.RowsAffected
+		if result.InsertID == 0 {
+			result.InsertID = qr.InsertID
+		}
+		return nil
+	}
+	err := ins.Input.StreamExecute(vcursor, bindVars, false, func(qr *sqltypes.Result) error {
+		for _, row := range qr.Rows {
+			batch = append(batch, row)
+			if len(batch) < InsertSelectBatchSize {
+				continue
+			}
+			if err := insertBatch(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execInsertSelect")
+	}
+	if len(batch) > 0 {
+		if err := insertBatch(); err != nil {
+			return nil, vterrors.Wrap(err, "execInsertSelect")
+		}
+	}
+	return result, nil
+}
+
+// insertRows inserts a batch of rows for execInsertSelect.
+// The values of the vindex and sequence columns are passed as
+// bind variables, like for InsertSharded. The other values are
+// encoded in the query.
+func (ins *Insert) insertRows(vcursor VCursor, bindVars map[string]*querypb.BindVariable, rows [][]sqltypes.Value) (*sqltypes.Result, error) {
+	bv := make(map[string]*querypb.BindVariable, len(bindVars))
+	for k, v := range bindVars {
+		bv[k] = v
+	}
+	value := func(row []sqltypes.Value, offset int) sqltypes.Value {
+		if offset < len(row) {
+			return row[offset]
+		}
+		return sqltypes.NULL
+	}
+
+	// The columns that were not supplied are after
+	// the end of the rows.
+	colCount := len(rows[0])
+	placeholders := make(map[int]func(rowNum int) string)
+	var insertID int64
+	if ins.Generate != nil {
+		offset := ins.Generate.Offset
+		values := make([]sqltypes.Value, len(rows))
+		for rowNum, row := range rows {
+			values[rowNum] = value(row, offset)
+		}
+		var err error
+		if insertID, err = ins.generate(vcursor, values, bv); err != nil {
+			return nil, err
+		}
+		placeholders[offset] = func(rowNum int) string { return ":" + SeqVarName + strconv.Itoa(rowNum) }
+		if offset >= colCount {
+			colCount = offset + 1
+		}
+	}
+	vindexValues := make([]sqltypes.PlanValue, len(ins.VindexValueOffset))
+	for vIdx, offsets := range ins.VindexValueOffset {
+		vindexValues[vIdx].Values = make([]sqltypes.PlanValue, len(offsets))
+		for colIdx, offset := range offsets {
+			pvs := make([]sqltypes.PlanValue, len(rows))
+			for rowNum, row := range rows {
+				if ins.Generate != nil && offset == ins.Generate.Offset {
+					pvs[rowNum] = sqltypes.PlanValue{Key: SeqVarName + strconv.Itoa(rowNum)}
+					continue
+				}
+				pvs[rowNum] = sqltypes.PlanValue{Value: value(row, offset)}
+			}
+			vindexValues[vIdx].Values[colIdx].Values = pvs
+			col := ins.Table.ColumnVindexes[vIdx].Columns[colIdx]
+			placeholders[offset] = func(rowNum int) string { return ":" + insertVarName(col, rowNum) }
+			if offset >= colCount {
+				colCount = offset + 1
+			}
+		}
+	}
+
+	mids := make([]string, len(rows))
+	buf := &bytes.Buffer{}
+	for rowNum, row := range rows {
+		buf.Reset()
+		buf.WriteByte('(')
+		for i := 0; i < colCount; i++ {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			if placeholder, ok := placeholders[i]; ok {
+				buf.WriteString(placeholder(rowNum))
+				continue
+			}
+			value(row, i).EncodeSQL(buf)
+		}
+		buf.WriteByte(')')
+		mids[rowNum] = buf.String()
+	}
+
+	keyspace, shardQueries, err := ins.getInsertShardedRoute(vcursor, vindexValues, mids, bv)
+	if err != nil {
+		return nil, err
+	}
+	result, err := vcursor.ExecuteMultiShard(keyspace, shardQueries, true /* isDML */, false /* canAutocommit */)
+	if err != nil {
+		return nil, err
+	}
+	if insertID != 0 {
+		result.InsertID = uint64(insertID)
+	}
+	return result, nil
+}
+
 // processGenerate generates new values using a sequence if necessary.
 // If no value was generated, it returns 0. Values are generated only
 // for cases where none are supplied.
@@ -226,6 +435,12 @@ func (ins *Insert) processGenerate(vcursor VCursor, bindVars map[string]*querypb
 	if err != nil {
 		return 0, vterrors.Wrap(err, "processGenerate")
 	}
+	return ins.generate(vcursor, resolved, bindVars)
+}
+
+// generate generates new values for the NULLs in resolved,
+// and sets the bind variables of the sequence column.
+func (ins *Insert) generate(vcursor VCursor, resolved []sqltypes.Value, bindVars map[string]*querypb.BindVariable) (insertID int64, err error) {
 	count := int64(0)
 	for _, val := range resolved {
 		if val.IsNull() {
@@ -272,7 +487,7 @@ func (ins *Insert) processGenerate(vcursor VCursor, bindVars map[string]*querypb
 // For unowned vindexes with no input values, it reverse maps.
 // For unowned vindexes with values, it validates.
 // If it's an IGNORE or ON DUPLICATE key insert, it drops unroutable rows.
-func (ins *Insert) getInsertShardedRoute(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (keyspace string, shardQueries map[string]*querypb.BoundQuery, err error) {
+func (ins *Insert) getInsertShardedRoute(vcursor VCursor, vindexValues []sqltypes.PlanValue, mids []string, bindVars map[string]*querypb.BindVariable) (keyspace string, shardQueries map[string]*querypb.BoundQuery, err error) {
 	keyspace, allShards, err := vcursor.GetKeyspaceShards(ins.Keyspace)
 	if err != nil {
 		return "", nil, vterrors.Wrap(err, "getInsertShardedRoute")
@@ -280,13 +495,13 @@ func (ins *Insert) getInsertShardedRoute(vcursor VCursor, bindVars map[string]*q
 
 	// vindexRowsValues builds the values of all vindex columns.
 	// the 3-d structure indexes are colVindex, row, col. Note that
-	// ins.Values indexes are colVindex, col, row. So, the conversion
+	// vindexValues indexes are colVindex, col, row. So, the conversion
 	// involves a transpose.
 	// The reason we need to transpose is because all the Vindex APIs
 	// require inputs in that format.
-	vindexRowsValues := make([][][]sqltypes.Value, len(ins.VindexValues))
+	vindexRowsValues := make([][][]sqltypes.Value, len(vindexValues))
 	rowCount := 0
-	for vIdx, vColValues := range ins.VindexValues {
+	for vIdx, vColValues := range vindexValues {
 		if len(vColValues.Values) != len(ins.Table.ColumnVindexes[vIdx].Columns) {
 			return "", nil, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: supplied vindex column values don't match vschema: %v %v", vColValues, ins.Table.ColumnVindexes[vIdx].Columns)
 		}
@@ -329,9 +544,9 @@ func (ins *Insert) getInsertShardedRoute(vcursor VCursor, bindVars map[string]*q
 		var err error
 		if colVindex.Owned {
 			switch ins.Opcode {
-			case InsertSharded:
+			case InsertSharded, InsertSelect:
 				err = ins.processOwned(vcursor, vindexRowsValues[vIdx], colVindex, bindVars, keyspaceIDs)
-			case InsertShardedIgnore:
+			case InsertShardedIgnore, InsertSelectIgnore:
 				// For InsertShardedIgnore, the work is substantially different.
 				// So, we use a separate function.
 				err = ins.processOwnedIgnore(vcursor, vindexRowsValues[vIdx], colVindex, bindVars, keyspaceIDs)
@@ -357,7 +572,7 @@ func (ins *Insert) getInsertShardedRoute(vcursor VCursor, bindVars map[string]*q
 			return "", nil, vterrors.Wrap(err, "getInsertShardedRoute")
 		}
 		shardKeyspaceIDMap[shard] = append(shardKeyspaceIDMap[shard], ksid)
-		routing[shard] = append(routing[shard], ins.Mid[rowNum])
+		routing[shard] = append(routing[shard], mids[rowNum])
 	}
 
 	shardQueries = make(map[string]*querypb.BoundQuery, len(routing))
@@ -374,16 +589,18 @@ func (ins *Insert) getInsertShardedRoute(vcursor VCursor, bindVars map[string]*q
 }
 
 // processPrimary maps the primary vindex values to the kesypace ids.
-func (ins *Insert) processPrimary(vcursor VCursor, vindexKeys [][]sqltypes.Value, colVindex *vindexes.ColumnVindex, bv map[string]*querypb.BindVariable) (keyspaceIDs [][]byte, err error) {
-	mapper := colVindex.Vindex.(vindexes.Unique)
-	var flattenedVidexKeys []sqltypes.Value
-	// TODO: @rafael - this will change once vindex Primary keys also support multicolumns
-	for _, val := range vindexKeys {
-		for _, internalVal := range val {
-			flattenedVidexKeys = append(flattenedVidexKeys, internalVal)
+func (ins *Insert) processPrimary(vcursor VCursor, vindexColumnsKeys [][]sqltypes.Value, colVindex *vindexes.ColumnVindex, bv map[string]*querypb.BindVariable) (keyspaceIDs [][]byte, err error) {
+	var ksids []vindexes.KsidOrRange
+	switch mapper := colVindex.Vindex.(type) {
+	case vindexes.MultiColumn:
+		ksids, err = mapper.MapMulti(vcursor, vindexColumnsKeys)
+	default:
+		vindexKeys := make([]sqltypes.Value, len(vindexColumnsKeys))
+		for rowNum, rowColumnKeys := range vindexColumnsKeys {
+			vindexKeys[rowNum] = rowColumnKeys[0]
 		}
+		ksids, err = mapper.(vindexes.Unique).Map(vcursor, vindexKeys)
 	}
-	ksids, err := mapper.Map(vcursor, flattenedVidexKeys)
 	if err != nil {
 		return nil, err
 	}
@@ -394,16 +611,19 @@ func (ins *Insert) processPrimary(vcursor VCursor, vindexKeys [][]sqltypes.Value
 		keyspaceIDs = append(keyspaceIDs, ksid.ID)
 	}
 
-	for rowNum, vindexKey := range flattenedVidexKeys {
+	for rowNum, rowColumnKeys := range vindexColumnsKeys {
 		if keyspaceIDs[rowNum] == nil {
-			if ins.Opcode != InsertShardedIgnore {
-				return nil, fmt.Errorf("could not map %v to a keyspace id", vindexKey)
+			if !ins.ignore() {
+				if len(rowColumnKeys) == 1 {
+					return nil, fmt.Errorf("could not map %v to a keyspace id", rowColumnKeys[0])
+				}
+				return nil, fmt.Errorf("could not map %v to a keyspace id", rowColumnKeys)
 			}
 			// InsertShardedIgnore: skip the row.
 			continue
 		}
-		for _, col := range colVindex.Columns {
-			bv[insertVarName(col, rowNum)] = sqltypes.ValueBindVariable(vindexKey)
+		for colIdx, vindexKey := range rowColumnKeys {
+			bv[insertVarName(colVindex.Columns[colIdx], rowNum)] = sqltypes.ValueBindVariable(vindexKey)
 		}
 	}
 	return keyspaceIDs, nil
@@ -533,7 +753,7 @@ func (ins *Insert) processUnowned(vcursor VCursor, vindexColumnsKeys [][]sqltype
 		for i, v := range verified {
 			rowNum := verifyIndexes[i]
 			if !v {
-				if ins.Opcode != InsertShardedIgnore {
+				if !ins.ignore() {
 					return fmt.Errorf("values %v for column %v does not map to keyspace ids", vindexColumnsKeys, colVindex.Columns)
 				}
 				// InsertShardedIgnore: skip the row.
@@ -548,6 +768,12 @@ func (ins *Insert) processUnowned(vcursor VCursor, vindexColumnsKeys [][]sqltype
 	return nil
 }
 
+// ignore returns true if rows that cannot be
+// inserted must be skipped instead of failing.
+func (ins *Insert) ignore() bool {
+	return ins.Opcode == InsertShardedIgnore || ins.Opcode == InsertSelectIgnore
+}
+
 func insertVarName(col sqlparser.ColIdent, rowNum int) string {
 	return "_" + col.CompliantName() + strconv.Itoa(rowNum)
 }
@@ -18,6 +18,7 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"vitess.io/vitess/go/sqltypes"
@@ -189,6 +190,87 @@ func TestInsertShardedSimple(t *testing.T) {
 	})
 }
 
+func TestInsertShardedMultiColumn(t *testing.T) {
+	invschema := &vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"region": {
+						Type:   "region_experimental",
+						Params: map[string]string{"region_bytes": "1"},
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{{
+							Name:    "region",
+							Columns: []string{"region", "id"},
+						}},
+					},
+				},
+			},
+		},
+	}
+	vs, err := vindexes.BuildVSchema(invschema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := vs.Keyspaces["sharded"]
+
+	ins := &Insert{
+		Opcode:   InsertSharded,
+		Keyspace: ks.Keyspace,
+		VindexValues: []sqltypes.PlanValue{{
+			// colVindex columns: region, id
+			Values: []sqltypes.PlanValue{{
+				// 2 rows.
+				Values: []sqltypes.PlanValue{{
+					Value: sqltypes.NewInt64(1),
+				}, {
+					Value: sqltypes.NewInt64(2),
+				}},
+			}, {
+				Values: []sqltypes.PlanValue{{
+					Value: sqltypes.NewInt64(1),
+				}, {
+					Value: sqltypes.NewInt64(2),
+				}},
+			}},
+		}},
+		Table:  ks.Tables["t1"],
+		Prefix: "prefix",
+		Mid:    []string{" mid1", " mid2"},
+		Suffix: " suffix",
+	}
+
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "20-"},
+	}
+	_, err = ins.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		// The region is the first byte of the keyspace id.
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "01166b40b44aba4bd6"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "0206e7ea22ce92708f"`,
+		`ExecuteMultiShard sharded ` +
+			`-20: prefix mid1 suffix /* vtgate:: keyspace_id:01166b40b44aba4bd6 */ ` +
+			`_id0: type:INT64 value:"1" _id1: type:INT64 value:"2" _region0: type:INT64 value:"1" _region1: type:INT64 value:"2" ` +
+			`20-: prefix mid2 suffix /* vtgate:: keyspace_id:0206e7ea22ce92708f */ ` +
+			`_id0: type:INT64 value:"1" _id1: type:INT64 value:"2" _region0: type:INT64 value:"1" _region1: type:INT64 value:"2"  true true`,
+	})
+
+	// A region that's out of range can't be mapped.
+	ins.VindexValues[0].Values[0].Values[1].Value = sqltypes.NewInt64(256)
+	vc.Rewind()
+	_, err = ins.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	expectError(t, "Execute", err, "execInsertSharded: getInsertShardedRoute: could not map [INT64(256) INT64(2)] to a keyspace id")
+}
+
 func TestInsertShardedFail(t *testing.T) {
 	invschema := &vschemapb.SrvVSchema{
 		Keyspaces: map[string]*vschemapb.Keyspace{
@@ -1388,3 +1470,214 @@ func TestInsertShardedUnownedReverseMapFail(t *testing.T) {
 	_, err = ins.Execute(vc, map[string]*querypb.BindVariable{}, false)
 	expectError(t, "Execute", err, "execInsertSharded: getInsertShardedRoute: value must be supplied for column [c3]")
 }
+
+func TestInsertSelect(t *testing.T) {
+	saved := InsertSelectBatchSize
+	defer func() { InsertSelectBatchSize = saved }()
+	InsertSelectBatchSize = 2
+
+	invschema := &vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"hash": {
+						Type: "hash",
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{{
+							Name:    "hash",
+							Columns: []string{"id"},
+						}},
+					},
+				},
+			},
+		},
+	}
+	vs, err := vindexes.BuildVSchema(invschema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := vs.Keyspaces["sharded"]
+
+	ins := &Insert{
+		Opcode:   InsertSelect,
+		Keyspace: ks.Keyspace,
+		Input: &fakePrimitive{
+			results: []*sqltypes.Result{sqltypes.MakeTestResult(
+				sqltypes.MakeTestFields(
+					"name|id",
+					"varchar|int64",
+				),
+				"a|1",
+				"b|null",
+				"c|3",
+			)},
+		},
+		VindexValueOffset: [][]int{{1}},
+		Table:             ks.Tables["t1"],
+		Generate: &Generate{
+			Keyspace: &vindexes.Keyspace{
+				Name:    "ks2",
+				Sharded: false,
+			},
+			Query:  "dummy_generate",
+			Offset: 1,
+		},
+		Prefix: "prefix ",
+		Suffix: " suffix",
+	}
+
+	vc := &loggingVCursor{
+		shards:        []string{"-20", "20-"},
+		shardForKsid:  []string{"20-", "-20", "20-"},
+		inTransaction: true,
+		results: []*sqltypes.Result{
+			sqltypes.MakeTestResult(
+				sqltypes.MakeTestFields(
+					"nextval",
+					"int64",
+				),
+				"2",
+			),
+			{RowsAffected: 2},
+			{RowsAffected: 1},
+		},
+	}
+	result, err := ins.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		// The rows are inserted in two batches.
+		`GetKeyspaceShards &{ks2 false}`,
+		`ExecuteStandalone dummy_generate n: type:INT64 value:"1"  ks2 -20`,
+		`GetKeyspaceShards &{sharded true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		`ExecuteMultiShard sharded ` +
+			`-20: prefix ('b', :_id1) suffix /* vtgate:: keyspace_id:06e7ea22ce92708f */ ` +
+			`__seq0: type:INT64 value:"1" __seq1: type:INT64 value:"2" ` +
+			`_id0: type:INT64 value:"1" _id1: type:INT64 value:"2" ` +
+			`20-: prefix ('a', :_id0) suffix /* vtgate:: keyspace_id:166b40b44aba4bd6 */ ` +
+			`__seq0: type:INT64 value:"1" __seq1: type:INT64 value:"2" ` +
+			`_id0: type:INT64 value:"1" _id1: type:INT64 value:"2"  ` +
+			`true false`,
+		`CommitBatch`,
+		`GetKeyspaceShards &{sharded true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "4eb190c9a2fa169c"`,
+		`ExecuteMultiShard sharded ` +
+			`20-: prefix ('c', :_id0) suffix /* vtgate:: keyspace_id:4eb190c9a2fa169c */ ` +
+			`__seq0: type:INT64 value:"3" _id0: type:INT64 value:"3"  ` +
+			`true false`,
+	})
+	expectResult(t, "Execute", result, &sqltypes.Result{RowsAffected: 3, InsertID: 2})
+}
+
+// loggedStream logs the results that its Primitive streams
+// to the loggingVCursor.
+type loggedStream struct {
+	Primitive
+}
+
+func (ls loggedStream) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	return ls.Primitive.StreamExecute(vcursor, bindVars, wantfields, func(qr *sqltypes.Result) error {
+		vc := vcursor.(*loggingVCursor)
+		vc.log = append(vc.log, fmt.Sprintf("StreamExecute %d rows", len(qr.Rows)))
+		return callback(qr)
+	})
+}
+
+func TestInsertSelectStreaming(t *testing.T) {
+	saved := InsertSelectBatchSize
+	defer func() { InsertSelectBatchSize = saved }()
+	InsertSelectBatchSize = 3
+
+	invschema := &vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"hash": {
+						Type: "hash",
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{{
+							Name:    "hash",
+							Columns: []string{"id"},
+						}},
+					},
+				},
+			},
+		},
+	}
+	vs, err := vindexes.BuildVSchema(invschema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := vs.Keyspaces["sharded"]
+
+	// The input streams two rows at a time.
+	ins := &Insert{
+		Opcode:   InsertSelect,
+		Keyspace: ks.Keyspace,
+		Input: loggedStream{&fakePrimitive{
+			results: []*sqltypes.Result{sqltypes.MakeTestResult(
+				sqltypes.MakeTestFields(
+					"id",
+					"int64",
+				),
+				"1",
+				"2",
+				"3",
+				"4",
+				"5",
+			)},
+		}},
+		VindexValueOffset: [][]int{{0}},
+		Table:             ks.Tables["t1"],
+		Prefix:            "prefix ",
+		Suffix:            " suffix",
+	}
+
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "-20", "-20", "-20", "-20"},
+		results: []*sqltypes.Result{
+			{RowsAffected: 3},
+			{RowsAffected: 2},
+		},
+	}
+	result, err := ins.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		// Outside of a transaction, each batch is inserted as
+		// soon as it's full.
+		`StreamExecute 0 rows`,
+		`StreamExecute 2 rows`,
+		`StreamExecute 2 rows`,
+		`GetKeyspaceShards &{sharded true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "4eb190c9a2fa169c"`,
+		`ExecuteMultiShard sharded ` +
+			`-20: prefix (:_id0),(:_id1),(:_id2) suffix /* vtgate:: keyspace_id:166b40b44aba4bd6,06e7ea22ce92708f,4eb190c9a2fa169c */ ` +
+			`_id0: type:INT64 value:"1" _id1: type:INT64 value:"2" _id2: type:INT64 value:"3"  ` +
+			`true false`,
+		`StreamExecute 1 rows`,
+		`GetKeyspaceShards &{sharded true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "d2fd8867d50d2dfe"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "70bb023c810ca87a"`,
+		`ExecuteMultiShard sharded ` +
+			`-20: prefix (:_id0),(:_id1) suffix /* vtgate:: keyspace_id:d2fd8867d50d2dfe,70bb023c810ca87a */ ` +
+			`_id0: type:INT64 value:"4" _id1: type:INT64 value:"5"  ` +
+			`true false`,
+	})
+	expectResult(t, "Execute", result, &sqltypes.Result{RowsAffected: 5})
+}
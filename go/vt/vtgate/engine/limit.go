@@ -122,7 +122,12 @@ func (l *Limit) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVari
 }
 
 func (l *Limit) fetchCount(bindVars map[string]*querypb.BindVariable) (int, error) {
-	resolved, err := l.Count.ResolveValue(bindVars)
+	return fetchLimit(l.Count, bindVars)
+}
+
+// fetchLimit resolves the row count of a LIMIT clause.
+func fetchLimit(count sqltypes.PlanValue, bindVars map[string]*querypb.BindVariable) (int, error) {
+	resolved, err := count.ResolveValue(bindVars)
 	if err != nil {
 		return 0, err
 	}
@@ -130,9 +135,9 @@ func (l *Limit) fetchCount(bindVars map[string]*querypb.BindVariable) (int, erro
 	if err != nil {
 		return 0, err
 	}
-	count := int(num)
-	if count < 0 {
+	n := int(num)
+	if n < 0 {
 		return 0, fmt.Errorf("requested limit is out of range: %v", num)
 	}
-	return count, nil
+	return n, nil
 }
@@ -17,9 +17,12 @@ limitations under the License.
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
+	"math/big"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 )
@@ -40,6 +43,17 @@ type OrderedAggregate struct {
 	// the aggregation key.
 	Keys []int
 
+	// HasDistinct is true if one of the aggregates is distinct.
+	// The underlying primitive is then expected to order the
+	// rows by the distinct column after the keys.
+	HasDistinct bool `json:",omitempty"`
+
+	// Having is the condition that an aggregated row must
+	// satisfy to be returned. It's evaluated before truncation,
+	// which allows it to reference columns that were added only
+	// for this purpose.
+	Having evalengine.Expr
+
 	// TruncateColumnCount specifies the number of columns to return
 	// in the final result. Rest of the columns are truncated
 	// from the result received. If 0, no truncation happens.
@@ -49,11 +63,47 @@ type OrderedAggregate struct {
 	Input Primitive
 }
 
+// MarshalJSON serializes the OrderedAggregate into a JSON representation.
+// It's used for testing and diagnostics.
+func (oa *OrderedAggregate) MarshalJSON() ([]byte, error) {
+	var having string
+	if oa.Having != nil {
+		having = oa.Having.String()
+	}
+	marshalAggregate := struct {
+		Aggregates          []AggregateParams
+		Keys                []int
+		HasDistinct         bool   `json:",omitempty"`
+		Having              string `json:",omitempty"`
+		TruncateColumnCount int    `json:",omitempty"`
+		Input               Primitive
+	}{
+		Aggregates:          oa.Aggregates,
+		Keys:                oa.Keys,
+		HasDistinct:         oa.HasDistinct,
+		Having:              having,
+		TruncateColumnCount: oa.TruncateColumnCount,
+		Input:               oa.Input,
+	}
+	return json.Marshal(marshalAggregate)
+}
+
 // AggregateParams specify the parameters for each aggregation.
 // It contains the opcode and input column number.
 type AggregateParams struct {
 	Opcode AggregateOpcode
 	Col    int
+	// CountCol is the input column that contains the count
+	// of values. It's used only by AggregateAvg, for which
+	// Col contains the sum.
+	CountCol int `json:",omitempty"`
+	// Alias is set only for opcodes that change the type of
+	// the column. It's used as the name of the resulting field.
+	Alias string `json:",omitempty"`
+}
+
+func (ap AggregateParams) isDistinct() bool {
+	return ap.Opcode == AggregateCountDistinct || ap.Opcode == AggregateSumDistinct
 }
 
 // AggregateOpcode is the aggregation Opcode.
@@ -65,8 +115,25 @@ const (
 	AggregateSum
 	AggregateMin
 	AggregateMax
+	AggregateCountDistinct
+	AggregateSumDistinct
+	AggregateAvg
 )
 
+var (
+	opcodeType = map[AggregateOpcode]querypb.Type{
+		AggregateCountDistinct: sqltypes.Int64,
+		AggregateSumDistinct:   sqltypes.Decimal,
+	}
+	countZero = sqltypes.MakeTrusted(sqltypes.Int64, []byte("0"))
+	countOne  = sqltypes.MakeTrusted(sqltypes.Int64, []byte("1"))
+	sumZero   = sqltypes.MakeTrusted(sqltypes.Decimal, []byte("0"))
+)
+
+// avgScaleIncrement is the number of digits that MySQL adds to
+// the scale of the argument to compute the scale of an AVG.
+const avgScaleIncrement = 4
+
 // SupportedAggregates maps the list of supported aggregate
 // functions to their opcodes.
 var SupportedAggregates = map[string]AggregateOpcode{
@@ -74,6 +141,11 @@ var SupportedAggregates = map[string]AggregateOpcode{
 	"sum":   AggregateSum,
 	"min":   AggregateMin,
 	"max":   AggregateMax,
+	"avg":   AggregateAvg,
+	// These functions don't exist in mysql, but are used
+	// to display the plan.
+	"count_distinct": AggregateCountDistinct,
+	"sum_distinct":   AggregateSumDistinct,
 }
 
 func (code AggregateOpcode) String() string {
@@ -106,15 +178,16 @@ func (oa *OrderedAggregate) execute(vcursor VCursor, bindVars map[string]*queryp
 		return nil, err
 	}
 	out := &sqltypes.Result{
-		Fields: result.Fields,
+		Fields: oa.convertFields(result.Fields),
 		Rows:   make([][]sqltypes.Value, 0, len(result.Rows)),
 		Extras: result.Extras,
 	}
 	// This code is similar to the one in StreamExecute.
 	var current []sqltypes.Value
+	var curDistinct sqltypes.Value
 	for _, row := range result.Rows {
 		if current == nil {
-			current = row
+			current, curDistinct = oa.convertRow(row)
 			continue
 		}
 
@@ -124,42 +197,66 @@ func (oa *OrderedAggregate) execute(vcursor VCursor, bindVars map[string]*queryp
 		}
 
 		if equal {
-			current, err = oa.merge(result.Fields, current, row)
+			current, curDistinct, err = oa.merge(result.Fields, current, row, curDistinct)
 			if err != nil {
 				return nil, err
 			}
 			continue
 		}
-		out.Rows = append(out.Rows, current)
-		current = row
+		if err := oa.appendFinal(out, result.Fields, current, bindVars); err != nil {
+			return nil, err
+		}
+		current, curDistinct = oa.convertRow(row)
 	}
 	if current != nil {
-		out.Rows = append(out.Rows, current)
+		if err := oa.appendFinal(out, result.Fields, current, bindVars); err != nil {
+			return nil, err
+		}
 	}
 	out.RowsAffected = uint64(len(out.Rows))
 	return out, nil
 }
 
+// appendFinal finalizes the aggregated row and appends it
+// to the result if it satisfies the Having conditions.
+func (oa *OrderedAggregate) appendFinal(out *sqltypes.Result, fields []*querypb.Field, row []sqltypes.Value, bindVars map[string]*querypb.BindVariable) error {
+	row, ok, err := oa.finalize(fields, row, bindVars)
+	if err != nil || !ok {
+		return err
+	}
+	out.Rows = append(out.Rows, row)
+	return nil
+}
+
 // StreamExecute is a Primitive function.
 func (oa *OrderedAggregate) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
 	var current []sqltypes.Value
+	var curDistinct sqltypes.Value
 	var fields []*querypb.Field
 
 	cb := func(qr *sqltypes.Result) error {
 		return callback(qr.Truncate(oa.TruncateColumnCount))
 	}
+	// sendFinal is the streaming equivalent of appendFinal.
+	sendFinal := func(row []sqltypes.Value) error {
+		row, ok, err := oa.finalize(fields, row, bindVars)
+		if err != nil || !ok {
+			return err
+		}
+		return cb(&sqltypes.Result{Rows: [][]sqltypes.Value{row}})
+	}
 
 	err := oa.Input.StreamExecute(vcursor, bindVars, wantfields, func(qr *sqltypes.Result) error {
 		if len(qr.Fields) != 0 {
 			fields = qr.Fields
-			if err := cb(&sqltypes.Result{Fields: fields}); err != nil {
+			if err := cb(&sqltypes.Result{Fields: oa.convertFields(fields)}); err != nil {
 				return err
 			}
 		}
 		// This code is similar to the one in Execute.
 		for _, row := range qr.Rows {
 			if current == nil {
-				current = row
+				current, curDistinct = oa.convertRow(row)
 				continue
 			}
 
@@ -169,16 +266,16 @@ func (oa *OrderedAggregate) StreamExecute(vcursor VCursor, bindVars map[string]*
 			}
 
 			if equal {
-				current, err = oa.merge(fields, current, row)
+				current, curDistinct, err = oa.merge(fields, current, row, curDistinct)
 				if err != nil {
 					return err
 				}
 				continue
 			}
-			if err := cb(&sqltypes.Result{Rows: [][]sqltypes.Value{current}}); err != nil {
+			if err := sendFinal(current); err != nil {
 				return err
 			}
-			current = row
+			current, curDistinct = oa.convertRow(row)
 		}
 		return nil
 	})
@@ -187,19 +284,91 @@ func (oa *OrderedAggregate) StreamExecute(vcursor VCursor, bindVars map[string]*
 	}
 
 	if current != nil {
-		if err := cb(&sqltypes.Result{Rows: [][]sqltypes.Value{current}}); err != nil {
+		if err := sendFinal(current); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// convertFields changes the fields of the columns whose type
+// is changed by the aggregation.
+func (oa *OrderedAggregate) convertFields(fields []*querypb.Field) []*querypb.Field {
+	if fields == nil || !oa.changesFields() {
+		return fields
+	}
+	newFields := make([]*querypb.Field, len(fields))
+	copy(newFields, fields)
+	for _, aggr := range oa.Aggregates {
+		switch {
+		case aggr.isDistinct():
+			newFields[aggr.Col] = &querypb.Field{
+				Name: aggr.Alias,
+				Type: opcodeType[aggr.Opcode],
+			}
+		case aggr.Opcode == AggregateAvg:
+			field := *fields[aggr.Col]
+			field.Name = aggr.Alias
+			if !sqltypes.IsFloat(field.Type) {
+				field.Type = sqltypes.Decimal
+				field.Decimals += avgScaleIncrement
+			}
+			newFields[aggr.Col] = &field
+		}
+	}
+	return newFields
+}
+
+func (oa *OrderedAggregate) changesFields() bool {
+	for _, aggr := range oa.Aggregates {
+		if aggr.isDistinct() || aggr.Opcode == AggregateAvg {
+			return true
+		}
+	}
+	return false
+}
+
+// convertRow prepares the first row of a group for aggregation.
+// The values of a distinct column are replaced by their initial
+// count or sum, and the original value is returned as curDistinct,
+// which merge uses to detect the next distinct value.
+func (oa *OrderedAggregate) convertRow(row []sqltypes.Value) (newRow []sqltypes.Value, curDistinct sqltypes.Value) {
+	if !oa.HasDistinct {
+		return row, sqltypes.NULL
+	}
+	newRow = sqltypes.CopyRow(row)
+	for _, aggr := range oa.Aggregates {
+		switch aggr.Opcode {
+		case AggregateCountDistinct:
+			curDistinct = row[aggr.Col]
+			if row[aggr.Col].IsNull() {
+				newRow[aggr.Col] = countZero
+			} else {
+				newRow[aggr.Col] = countOne
+			}
+		case AggregateSumDistinct:
+			curDistinct = row[aggr.Col]
+			var err error
+			newRow[aggr.Col], err = sqltypes.Cast(row[aggr.Col], opcodeType[aggr.Opcode])
+			if err != nil {
+				newRow[aggr.Col] = sumZero
+			}
+		}
+	}
+	return newRow, curDistinct
+}
+
 // GetFields is a Primitive function.
 func (oa *OrderedAggregate) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
 	qr, err := oa.Input.GetFields(vcursor, bindVars)
 	if err != nil {
 		return nil, err
 	}
+	if oa.changesFields() {
+		converted := *qr
+		converted.Fields = oa.convertFields(qr.Fields)
+		qr = &converted
+	}
 	return qr.Truncate(oa.TruncateColumnCount), nil
 }
 
@@ -216,9 +385,22 @@ func (oa *OrderedAggregate) keysEqual(row1, row2 []sqltypes.Value) (bool, error)
 	return true, nil
 }
 
-func (oa *OrderedAggregate) merge(fields []*querypb.Field, row1, row2 []sqltypes.Value) ([]sqltypes.Value, error) {
+func (oa *OrderedAggregate) merge(fields []*querypb.Field, row1, row2 []sqltypes.Value, curDistinct sqltypes.Value) ([]sqltypes.Value, sqltypes.Value, error) {
 	result := sqltypes.CopyRow(row1)
 	for _, aggr := range oa.Aggregates {
+		if aggr.isDistinct() {
+			if row2[aggr.Col].IsNull() {
+				continue
+			}
+			cmp, err := sqltypes.NullsafeCompare(curDistinct, row2[aggr.Col])
+			if err != nil {
+				return nil, sqltypes.NULL, err
+			}
+			if cmp == 0 {
+				continue
+			}
+			curDistinct = row2[aggr.Col]
+		}
 		var err error
 		switch aggr.Opcode {
 		case AggregateCount, AggregateSum:
@@ -227,12 +409,89 @@ func (oa *OrderedAggregate) merge(fields []*querypb.Field, row1, row2 []sqltypes
 			result[aggr.Col], err = sqltypes.Min(row1[aggr.Col], row2[aggr.Col])
 		case AggregateMax:
 			result[aggr.Col], err = sqltypes.Max(row1[aggr.Col], row2[aggr.Col])
+		case AggregateCountDistinct:
+			result[aggr.Col], err = sqltypes.NullsafeAdd(row1[aggr.Col], countOne, opcodeType[aggr.Opcode])
+		case AggregateSumDistinct:
+			// NullsafeAdd returns row2 as is if row1 is NULL.
+			// So, it has to be cast to the result type.
+			result[aggr.Col], err = sqltypes.NullsafeAdd(row1[aggr.Col], row2[aggr.Col], opcodeType[aggr.Opcode])
+			if err == nil {
+				result[aggr.Col], err = sqltypes.Cast(result[aggr.Col], opcodeType[aggr.Opcode])
+			}
+		case AggregateAvg:
+			result[aggr.Col], err = sqltypes.NullsafeAdd(row1[aggr.Col], row2[aggr.Col], fields[aggr.Col].Type)
+			if err == nil {
+				result[aggr.CountCol], err = sqltypes.NullsafeAdd(row1[aggr.CountCol], row2[aggr.CountCol], fields[aggr.CountCol].Type)
+			}
 		default:
-			return nil, fmt.Errorf("BUG: Unexpected opcode: %v", aggr.Opcode)
+			return nil, sqltypes.NULL, fmt.Errorf("BUG: Unexpected opcode: %v", aggr.Opcode)
 		}
 		if err != nil {
-			return nil, err
+			return nil, sqltypes.NULL, err
+		}
+	}
+	return result, curDistinct, nil
+}
+
+// finalize computes the values that can only be known once all
+// the rows of a group have been merged, and evaluates the Having
+// conditions. It returns false if the row must be discarded.
+func (oa *OrderedAggregate) finalize(fields []*querypb.Field, row []sqltypes.Value, bindVars map[string]*querypb.BindVariable) ([]sqltypes.Value, bool, error) {
+	copied := false
+	for _, aggr := range oa.Aggregates {
+		if aggr.Opcode != AggregateAvg {
+			continue
+		}
+		avg, err := average(fields[aggr.Col], row[aggr.Col], row[aggr.CountCol])
+		if err != nil {
+			return nil, false, err
+		}
+		// The row may still be owned by the input.
+		if !copied {
+			row = sqltypes.CopyRow(row)
+			copied = true
+		}
+		row[aggr.Col] = avg
+	}
+	if oa.Having != nil {
+		ok, err := evalengine.EvaluateBool(oa.Having, evalengine.ExpressionEnv{
+			BindVars: bindVars,
+			Fields:   fields,
+			Row:      row,
+		})
+		if err != nil || !ok {
+			return nil, false, err
 		}
 	}
-	return result, nil
+	return row, true, nil
+}
+
+// average divides sum by count. Floating point sums produce a
+// Float64. Other sums produce a Decimal whose scale is computed
+// the same way as MySQL does for AVG.
+func average(sumField *querypb.Field, sum, count sqltypes.Value) (sqltypes.Value, error) {
+	if sum.IsNull() {
+		return sqltypes.NULL, nil
+	}
+	n, err := sqltypes.ToInt64(count)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	if n == 0 {
+		return sqltypes.NULL, nil
+	}
+	if sqltypes.IsFloat(sumField.Type) {
+		f, err := sqltypes.ToFloat64(sum)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		return sqltypes.NewFloat64(f / float64(n)), nil
+	}
+	r, ok := new(big.Rat).SetString(sum.ToString())
+	if !ok {
+		return sqltypes.NULL, fmt.Errorf("could not parse value: '%s'", sum.ToString())
+	}
+	r.Quo(r, new(big.Rat).SetInt64(n))
+	scale := int(sumField.Decimals) + avgScaleIncrement
+	return sqltypes.MakeTrusted(sqltypes.Decimal, []byte(r.FloatString(scale))), nil
 }
@@ -22,6 +22,9 @@ import (
 	"testing"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
 )
 
 func TestOrderedAggregateExecute(t *testing.T) {
@@ -255,6 +258,248 @@ func TestOrderedAggregateGetFieldsTruncate(t *testing.T) {
 	}
 }
 
+func TestOrderedAggregateExecuteCountDistinct(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"col1|col2|count(*)",
+		"varbinary|int64|int64",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			// Two identical values
+			"a|1|1",
+			"a|1|2",
+			// Single value
+			"b|1|1",
+			// A null value and a non-null value
+			"c|null|2",
+			"c|1|1",
+			// Two different values
+			"d|1|1",
+			"d|2|1",
+			// Only null values
+			"e|null|1",
+			"e|null|2",
+		)},
+	}
+
+	oa := &OrderedAggregate{
+		HasDistinct: true,
+		Aggregates: []AggregateParams{{
+			Opcode: AggregateCountDistinct,
+			Col:    1,
+			Alias:  "count(distinct col2)",
+		}, {
+			// Also add a count(*)
+			Opcode: AggregateCount,
+			Col:    2,
+		}},
+		Keys:  []int{0},
+		Input: tp,
+	}
+
+	result, err := oa.Execute(nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|count(distinct col2)|count(*)",
+			"varbinary|int64|int64",
+		),
+		"a|1|3",
+		"b|1|1",
+		"c|1|3",
+		"d|2|2",
+		"e|0|3",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("oa.Execute:\n%v, want\n%v", result, wantResult)
+	}
+}
+
+func TestOrderedAggregateStreamSumDistinct(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"col1|col2",
+		"varbinary|int64",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"a|1",
+			"a|1",
+			"b|null",
+			"b|2",
+			"c|1",
+			"c|2",
+			"d|null",
+		)},
+	}
+
+	oa := &OrderedAggregate{
+		HasDistinct: true,
+		Aggregates: []AggregateParams{{
+			Opcode: AggregateSumDistinct,
+			Col:    1,
+			Alias:  "sum(distinct col2)",
+		}},
+		Keys:  []int{0},
+		Input: tp,
+	}
+
+	var results []*sqltypes.Result
+	err := oa.StreamExecute(nil, nil, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantResults := sqltypes.MakeTestStreamingResults(
+		sqltypes.MakeTestFields(
+			"col1|sum(distinct col2)",
+			"varbinary|decimal",
+		),
+		"a|1",
+		"-----",
+		"b|2",
+		"-----",
+		"c|3",
+		"-----",
+		"d|null",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("oa.StreamExecute:\n%s, want\n%s", sqltypes.PrintResults(results), sqltypes.PrintResults(wantResults))
+	}
+}
+
+func TestOrderedAggregateExecuteAvg(t *testing.T) {
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col|avg(val)|count(val)",
+				"varbinary|decimal|int64",
+			),
+			"a|1|1",
+			"a|2|2",
+			"b|null|0",
+			"c|10|3",
+		)},
+	}
+
+	oa := &OrderedAggregate{
+		Aggregates: []AggregateParams{{
+			Opcode:   AggregateAvg,
+			Col:      1,
+			CountCol: 2,
+			Alias:    "avg(val)",
+		}},
+		Keys:                []int{0},
+		TruncateColumnCount: 2,
+		Input:               tp,
+	}
+
+	result, err := oa.Execute(nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col|avg(val)",
+			"varbinary|decimal",
+		),
+		"a|1.0000",
+		"b|null",
+		"c|3.3333",
+	)
+	wantResult.Fields[1].Decimals = 4
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("oa.Execute:\n%v, want\n%v", result, wantResult)
+	}
+}
+
+func TestOrderedAggregateHaving(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"col|count(*)|max(val)",
+		"varbinary|int64|int64",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"a|1|5",
+			"a|1|1",
+			"b|3|2",
+			"c|1|null",
+			"d|4|7",
+		)},
+	}
+
+	oa := &OrderedAggregate{
+		Aggregates: []AggregateParams{{
+			Opcode: AggregateCount,
+			Col:    1,
+		}, {
+			Opcode: AggregateMax,
+			Col:    2,
+		}},
+		Keys: []int{0},
+		// count(*) < 4 and max(val) != :val
+		Having: &evalengine.And{
+			Left: &evalengine.Comparison{
+				Op:    "<",
+				Left:  &evalengine.Column{Offset: 1},
+				Right: &evalengine.Literal{Val: sqltypes.NewInt64(4)},
+			},
+			Right: &evalengine.Comparison{
+				Op:    "!=",
+				Left:  &evalengine.Column{Offset: 2},
+				Right: &evalengine.BindVariable{Key: "val"},
+			},
+		},
+		TruncateColumnCount: 2,
+		Input:               tp,
+	}
+
+	bindVars := map[string]*querypb.BindVariable{"val": sqltypes.Int64BindVariable(2)}
+	result, err := oa.Execute(nil, bindVars, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col|count(*)",
+			"varbinary|int64",
+		),
+		"a|2",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("oa.Execute:\n%v, want\n%v", result, wantResult)
+	}
+
+	tp.rewind()
+	var results []*sqltypes.Result
+	err = oa.StreamExecute(nil, bindVars, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResults := sqltypes.MakeTestStreamingResults(
+		sqltypes.MakeTestFields(
+			"col|count(*)",
+			"varbinary|int64",
+		),
+		"a|2",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("oa.StreamExecute:\n%s, want\n%s", sqltypes.PrintResults(results), sqltypes.PrintResults(wantResults))
+	}
+}
+
 func TestOrderedAggregateInputFail(t *testing.T) {
 	tp := &fakePrimitive{sendErr: errors.New("input fail")}
 
@@ -367,7 +612,7 @@ func TestMerge(t *testing.T) {
 		"1|3|2.8|2|bc",
 	)
 
-	merged, err := oa.merge(fields, r.Rows[0], r.Rows[1])
+	merged, _, err := oa.merge(fields, r.Rows[0], r.Rows[1], sqltypes.NULL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -377,7 +622,7 @@ func TestMerge(t *testing.T) {
 	}
 
 	// swap and retry
-	merged, err = oa.merge(fields, r.Rows[1], r.Rows[0])
+	merged, _, err = oa.merge(fields, r.Rows[1], r.Rows[0], sqltypes.NULL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -27,6 +27,7 @@ import (
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 // SeqVarName is a reserved bind var name for sequence values.
@@ -44,8 +45,19 @@ type VCursor interface {
 	Context() context.Context
 
 	// V3 functions.
-	Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
+	Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error)
 	ExecuteAutocommit(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
+	ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
+
+	// CommitBatch commits the work done so far and begins a new
+	// transaction, if vtgate started the transaction because of
+	// autocommit. Otherwise, it's a no-op. It lets a large DML
+	// commit in batches instead of holding a single transaction.
+	CommitBatch() error
+
+	// InTransaction returns true if the session is in a transaction,
+	// whether the application or autocommit started it.
+	InTransaction() bool
 
 	// Shard-level functions.
 	ExecuteMultiShard(keyspace string, shardQueries map[string]*querypb.BoundQuery, isDML, canAutocommit bool) (*sqltypes.Result, error)
@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/json"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+var _ Primitive = (*Projection)(nil)
+
+// Projection is a primitive that computes each column of its
+// result by evaluating an expression against the rows of the
+// underlying primitive. It's used for expressions that cannot
+// be pushed down to the underlying primitive, and to drop the
+// columns that were added only for that purpose.
+type Projection struct {
+	// Exprs contains the expression of each column.
+	Exprs []evalengine.Expr
+	// Cols contains the name of each column. A column that
+	// only copies an input column keeps the input field instead.
+	Cols  []string
+	Input Primitive
+}
+
+// MarshalJSON serializes the Projection into a JSON representation.
+// It's used for testing and diagnostics.
+func (p *Projection) MarshalJSON() ([]byte, error) {
+	exprs := make([]string, len(p.Exprs))
+	for i, expr := range p.Exprs {
+		exprs[i] = expr.String()
+	}
+	marshalProjection := struct {
+		Opcode string
+		Exprs  []string
+		Cols   []string
+		Input  Primitive
+	}{
+		Opcode: "Projection",
+		Exprs:  exprs,
+		Cols:   p.Cols,
+		Input:  p.Input,
+	}
+	return json.Marshal(marshalProjection)
+}
+
+// Execute satisfies the Primtive interface.
+func (p *Projection) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	result, err := p.Input.Execute(vcursor, bindVars, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.project(bindVars, result.Fields, result.Rows)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{
+		Fields:       p.fields(bindVars, result.Fields),
+		Rows:         rows,
+		RowsAffected: result.RowsAffected,
+	}, nil
+}
+
+// StreamExecute satisfies the Primtive interface.
+func (p *Projection) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	var fields []*querypb.Field
+	return p.Input.StreamExecute(vcursor, bindVars, wantfields, func(qr *sqltypes.Result) error {
+		result := &sqltypes.Result{}
+		if len(qr.Fields) != 0 {
+			fields = qr.Fields
+			result.Fields = p.fields(bindVars, fields)
+		}
+		rows, err := p.project(bindVars, fields, qr.Rows)
+		if err != nil {
+			return err
+		}
+		result.Rows = rows
+		return callback(result)
+	})
+}
+
+// GetFields satisfies the Primtive interface.
+func (p *Projection) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	result, err := p.Input.GetFields(vcursor, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{Fields: p.fields(bindVars, result.Fields)}, nil
+}
+
+// fields returns the fields of the result, or nil
+// if the fields of the input are not known.
+func (p *Projection) fields(bindVars map[string]*querypb.BindVariable, fields []*querypb.Field) []*querypb.Field {
+	if fields == nil {
+		return nil
+	}
+	env := evalengine.ExpressionEnv{
+		BindVars: bindVars,
+		Fields:   fields,
+	}
+	result := make([]*querypb.Field, len(p.Exprs))
+	for i, expr := range p.Exprs {
+		if col, ok := expr.(*evalengine.Column); ok {
+			result[i] = fields[col.Offset]
+			continue
+		}
+		result[i] = &querypb.Field{
+			Name: p.Cols[i],
+			Type: expr.Type(env),
+		}
+	}
+	return result
+}
+
+func (p *Projection) project(bindVars map[string]*querypb.BindVariable, fields []*querypb.Field, rows [][]sqltypes.Value) ([][]sqltypes.Value, error) {
+	if rows == nil {
+		return nil, nil
+	}
+	projected := make([][]sqltypes.Value, len(rows))
+	env := evalengine.ExpressionEnv{
+		BindVars: bindVars,
+		Fields:   fields,
+	}
+	for i, row := range rows {
+		env.Row = row
+		projected[i] = make([]sqltypes.Value, len(p.Exprs))
+		for j, expr := range p.Exprs {
+			v, err := expr.Evaluate(env)
+			if err != nil {
+				return nil, err
+			}
+			projected[i][j] = v
+		}
+	}
+	return projected, nil
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+)
+
+func TestProjectionExecute(t *testing.T) {
+	fields := sqltypes.MakeTestFields(
+		"id|col|hidden",
+		"int64|int64|varchar",
+	)
+	tp := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			fields,
+			"1|10|a",
+			"2|null|b",
+			"3|30|c",
+		)},
+	}
+
+	// id, ifnull(col, 0) + 1 as a
+	p := &Projection{
+		Exprs: []evalengine.Expr{
+			&evalengine.Column{Offset: 0},
+			&evalengine.Arithmetic{
+				Op: "+",
+				Left: &evalengine.Func{
+					Name: "ifnull",
+					Args: []evalengine.Expr{
+						&evalengine.Column{Offset: 1},
+						&evalengine.Literal{Val: sqltypes.NewInt64(0)},
+					},
+				},
+				Right: &evalengine.Literal{Val: sqltypes.NewInt64(1)},
+			},
+		},
+		Cols:  []string{"id", "a"},
+		Input: tp,
+	}
+	wantFields := sqltypes.MakeTestFields(
+		"id|a",
+		"int64|int64",
+	)
+
+	result, err := p.Execute(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		wantFields,
+		"1|11",
+		"2|1",
+		"3|31",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("p.Execute:\n%v, want\n%v", result, wantResult)
+	}
+
+	tp.rewind()
+	var results []*sqltypes.Result
+	err = p.StreamExecute(nil, nil, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResults := sqltypes.MakeTestStreamingResults(
+		wantFields,
+		"1|11",
+		"2|1",
+		"---",
+		"3|31",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("p.StreamExecute:\n%s, want\n%s", sqltypes.PrintResults(results), sqltypes.PrintResults(wantResults))
+	}
+
+	tp.rewind()
+	result, err = p.GetFields(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Fields, wantFields) {
+		t.Errorf("p.GetFields:\n%v, want\n%v", result.Fields, wantFields)
+	}
+}
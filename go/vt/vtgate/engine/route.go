@@ -27,6 +27,7 @@ import (
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 )
 
 var _ Primitive = (*Route)(nil)
@@ -61,6 +62,11 @@ type Route struct {
 	// in the final result. Rest of the columns are truncated
 	// from the result received. If 0, no truncation happens.
 	TruncateColumnCount int
+
+	// ResultCacheTable is set if the result of the query can be
+	// cached. The query then reads this table by its primary vindex,
+	// which has Values[0] as value.
+	ResultCacheTable *vindexes.Table
 }
 
 // OrderbyParams specifies the parameters for ordering.
@@ -77,6 +83,10 @@ func (route *Route) MarshalJSON() ([]byte, error) {
 	if route.Vindex != nil {
 		vindexName = route.Vindex.String()
 	}
+	var resultCacheTable string
+	if route.ResultCacheTable != nil {
+		resultCacheTable = route.ResultCacheTable.Name.String()
+	}
 	marshalRoute := struct {
 		Opcode              RouteOpcode
 		Keyspace            *vindexes.Keyspace   `json:",omitempty"`
@@ -86,6 +96,7 @@ func (route *Route) MarshalJSON() ([]byte, error) {
 		Values              []sqltypes.PlanValue `json:",omitempty"`
 		OrderBy             []OrderbyParams      `json:",omitempty"`
 		TruncateColumnCount int                  `json:",omitempty"`
+		ResultCacheTable    string               `json:",omitempty"`
 	}{
 		Opcode:              route.Opcode,
 		Keyspace:            route.Keyspace,
@@ -95,6 +106,7 @@ func (route *Route) MarshalJSON() ([]byte, error) {
 		Values:              route.Values,
 		OrderBy:             route.OrderBy,
 		TruncateColumnCount: route.TruncateColumnCount,
+		ResultCacheTable:    resultCacheTable,
 	}
 	return jsonutil.MarshalNoEscape(marshalRoute)
 }
@@ -267,6 +279,9 @@ func (route *Route) paramsAllShards(vcursor VCursor, bindVars map[string]*queryp
 }
 
 func (route *Route) paramsSelectEqual(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (ks string, shardVars map[string]map[string]*querypb.BindVariable, err error) {
+	if _, ok := route.Vindex.(vindexes.MultiColumn); ok {
+		return route.paramsSelectMulti(vcursor, bindVars)
+	}
 	key, err := route.Values[0].ResolveValue(bindVars)
 	if err != nil {
 		return "", nil, vterrors.Wrap(err, "paramsSelectEqual")
@@ -282,6 +297,34 @@ func (route *Route) paramsSelectEqual(vcursor VCursor, bindVars map[string]*quer
 	return ks, shardVars, nil
 }
 
+// paramsSelectMulti computes the shards of a route on a multi-column
+// vindex. Values[0] has the values of the leading columns of the vindex.
+// If only some of them are given, the route scatters over the keyrange
+// that they map to.
+func (route *Route) paramsSelectMulti(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (ks string, shardVars map[string]map[string]*querypb.BindVariable, err error) {
+	colValues, err := route.Values[0].ResolveList(bindVars)
+	if err != nil {
+		return "", nil, vterrors.Wrap(err, "paramsSelectMulti")
+	}
+	ks, allShards, err := vcursor.GetKeyspaceShards(route.Keyspace)
+	if err != nil {
+		return "", nil, vterrors.Wrap(err, "paramsSelectMulti")
+	}
+	ksids, err := route.Vindex.(vindexes.MultiColumn).MapMulti(vcursor, [][]sqltypes.Value{colValues})
+	if err != nil {
+		return "", nil, vterrors.Wrap(err, "paramsSelectMulti")
+	}
+	shards, err := shardsForKsid(vcursor, allShards, ksids[0])
+	if err != nil {
+		return "", nil, vterrors.Wrap(err, "paramsSelectMulti")
+	}
+	shardVars = make(map[string]map[string]*querypb.BindVariable)
+	for _, shard := range shards {
+		shardVars[shard] = bindVars
+	}
+	return ks, shardVars, nil
+}
+
 func (route *Route) paramsSelectIN(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (ks string, shardVars map[string]map[string]*querypb.BindVariable, err error) {
 	keys, err := route.Values[0].ResolveList(bindVars)
 	if err != nil {
@@ -306,24 +349,10 @@ func (route *Route) resolveShards(vcursor VCursor, bindVars map[string]*querypb.
 		if err != nil {
 			return "", nil, err
 		}
-		var shards []string
 		for i, ksid := range ksids {
-			switch {
-			case ksid.Range != nil:
-				// Even for a unique vindex, a KeyRange can be returned if a keypace
-				// id cannot be identified. For example, this can happen during backfill.
-				// In such cases, we scatter over the KeyRange.
-				// Use the multi-keyspace id API to convert a keyrange to shards.
-				shards, err = vcursor.GetShardsForKsids(allShards, vindexes.Ksids{Range: ksid.Range})
-				if err != nil {
-					return "", nil, err
-				}
-			case ksid.ID != nil:
-				shard, err := vcursor.GetShardForKeyspaceID(allShards, ksid.ID)
-				if err != nil {
-					return "", nil, err
-				}
-				shards = []string{shard}
+			shards, err := shardsForKsid(vcursor, allShards, ksid)
+			if err != nil {
+				return "", nil, err
 			}
 			for _, shard := range shards {
 				routing.Add(shard, sqltypes.ValueToProto(vindexKeys[i]))
@@ -349,8 +378,26 @@ func (route *Route) resolveShards(vcursor VCursor, bindVars map[string]*querypb.
 	return newKeyspace, routing, nil
 }
 
+// shardsForKsid returns the shards of a keyspace id or keyrange.
+// Even for a unique vindex, a KeyRange can be returned if a keypace
+// id cannot be identified. For example, this can happen during backfill.
+// In such cases, we scatter over the KeyRange.
+func shardsForKsid(vcursor VCursor, allShards []*topodatapb.ShardReference, ksid vindexes.KsidOrRange) ([]string, error) {
+	switch {
+	case ksid.Range != nil:
+		// Use the multi-keyspace id API to convert a keyrange to shards.
+		return vcursor.GetShardsForKsids(allShards, vindexes.Ksids{Range: ksid.Range})
+	case ksid.ID != nil:
+		shard, err := vcursor.GetShardForKeyspaceID(allShards, ksid.ID)
+		if err != nil {
+			return nil, err
+		}
+		return []string{shard}, nil
+	}
+	return nil, nil
+}
+
 func (route *Route) sort(in *sqltypes.Result) (*sqltypes.Result, error) {
-	var err error
 	// Since Result is immutable, we make a copy.
 	// The copy can be shallow because we won't be changing
 	// the contents of any row.
@@ -361,18 +408,25 @@ func (route *Route) sort(in *sqltypes.Result) (*sqltypes.Result, error) {
 		InsertID:     in.InsertID,
 	}
 
-	sort.Slice(out.Rows, func(i, j int) bool {
+	err := sortRows(out.Rows, route.OrderBy)
+	return out, err
+}
+
+// sortRows sorts rows in the specified order.
+func sortRows(rows [][]sqltypes.Value, orderBy []OrderbyParams) error {
+	var err error
+	sort.Slice(rows, func(i, j int) bool {
 		// If there are any errors below, the function sets
 		// the external err and returns true. Once err is set,
 		// all subsequent calls return true. This will make
 		// Slice think that all elements are in the correct
 		// order and return more quickly.
-		for _, order := range route.OrderBy {
+		for _, order := range orderBy {
 			if err != nil {
 				return true
 			}
 			var cmp int
-			cmp, err = sqltypes.NullsafeCompare(out.Rows[i][order.Col], out.Rows[j][order.Col])
+			cmp, err = sqltypes.NullsafeCompare(rows[i][order.Col], rows[j][order.Col])
 			if err != nil {
 				return true
 			}
@@ -386,19 +440,36 @@ func (route *Route) sort(in *sqltypes.Result) (*sqltypes.Result, error) {
 		}
 		return true
 	})
-
-	return out, err
+	return err
 }
 
-func resolveSingleShard(vcursor VCursor, vindex vindexes.Vindex, keyspace *vindexes.Keyspace, bindVars map[string]*querypb.BindVariable, vindexKey sqltypes.Value) (newKeyspace, shard string, ksid []byte, err error) {
+// resolveSingleShard resolves the shard of the row whose vindex value
+// is pv. For a multi-column vindex, pv has the values of all the columns.
+func resolveSingleShard(vcursor VCursor, vindex vindexes.Vindex, keyspace *vindexes.Keyspace, bindVars map[string]*querypb.BindVariable, pv sqltypes.PlanValue) (newKeyspace, shard string, ksid []byte, err error) {
 	newKeyspace, allShards, err := vcursor.GetKeyspaceShards(keyspace)
 	if err != nil {
 		return "", "", nil, err
 	}
-	mapper := vindex.(vindexes.Unique)
-	ksids, err := mapper.Map(vcursor, []sqltypes.Value{vindexKey})
-	if err != nil {
-		return "", "", nil, err
+	var ksids []vindexes.KsidOrRange
+	switch mapper := vindex.(type) {
+	case vindexes.MultiColumn:
+		colValues, err := pv.ResolveList(bindVars)
+		if err != nil {
+			return "", "", nil, err
+		}
+		ksids, err = mapper.MapMulti(vcursor, [][]sqltypes.Value{colValues})
+		if err != nil {
+			return "", "", nil, err
+		}
+	default:
+		vindexKey, err := pv.ResolveValue(bindVars)
+		if err != nil {
+			return "", "", nil, err
+		}
+		ksids, err = mapper.(vindexes.Unique).Map(vcursor, []sqltypes.Value{vindexKey})
+		if err != nil {
+			return "", "", nil, err
+		}
 	}
 	if err := ksids[0].ValidateUnique(); err != nil {
 		return "", "", nil, err
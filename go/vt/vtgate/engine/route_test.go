@@ -296,6 +296,53 @@ func TestSelectEqualNoRoute(t *testing.T) {
 	expectResult(t, "sel.StreamExecute", result, nil)
 }
 
+func TestSelectEqualMultiColumn(t *testing.T) {
+	vindex, _ := vindexes.CreateVindex("region_experimental", "", map[string]string{"region_bytes": "1"})
+	sel := &Route{
+		Opcode: SelectEqualUnique,
+		Keyspace: &vindexes.Keyspace{
+			Name:    "ks",
+			Sharded: true,
+		},
+		Query:      "dummy_select",
+		FieldQuery: "dummy_select_field",
+		Vindex:     vindex,
+		Values: []sqltypes.PlanValue{{
+			Values: []sqltypes.PlanValue{{Value: sqltypes.NewInt64(1)}, {Value: sqltypes.NewInt64(1)}},
+		}},
+	}
+
+	vc := &loggingVCursor{
+		shards:  []string{"-20", "20-"},
+		results: []*sqltypes.Result{defaultSelectResult},
+	}
+	result, err := sel.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{ks true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "01166b40b44aba4bd6"`,
+		`ExecuteMultiShard ks -20: dummy_select  false false`,
+	})
+	expectResult(t, "sel.Execute", result, defaultSelectResult)
+
+	// Only the region: scatter over its keyrange.
+	sel.Opcode = SelectEqual
+	sel.Values[0].Values = sel.Values[0].Values[:1]
+	vc.Rewind()
+	result, err = wrapStreamExecute(sel, vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{ks true}`,
+		`GetShardsForKsids [name:"-20"  name:"20-" ] {"start:\"\\001\" end:\"\\002\" " []}`,
+		`StreamExecuteMulti dummy_select ks -20: 20-: `,
+	})
+	expectResult(t, "sel.StreamExecute", result, defaultSelectResult)
+}
+
 func TestSelectINUnique(t *testing.T) {
 	vindex, _ := vindexes.NewHash("", nil)
 	sel := &Route{
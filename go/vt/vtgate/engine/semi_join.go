@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"encoding/json"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// SemiJoinBatchSize is the maximum number of LHS values
+// that a SemiJoin sends to its RHS in a single query.
+var SemiJoinBatchSize = 1000
+
+var _ Primitive = (*SemiJoin)(nil)
+
+// SemiJoin is a join that reduces the rows of the RHS to those
+// that can match the LHS. It collects the distinct values of
+// the LeftKey column of the LHS, and passes them in batches
+// to the RHS as the ListVar list bind variable. The RHS is
+// expected to filter its rows with a 'col in ::ListVar' clause.
+// The rows returned by the RHS are then joined with the rows
+// of the LHS like in a HashJoin.
+// This requires far fewer RHS queries than a Join, which sends
+// one query for each LHS row.
+type SemiJoin struct {
+	Opcode JoinOpcode
+	// Left and Right are the LHS and RHS primitives
+	// of the SemiJoin. They can be any primitive.
+	Left, Right Primitive
+
+	// Cols defines which columns from the left
+	// or right results should be used to build the
+	// return result. It works like Join.Cols.
+	Cols []int
+
+	// ListVar is the name of the bind variable that
+	// receives the values of LeftKey.
+	ListVar string
+
+	// LeftKey and RightKey are the columns of the LHS and RHS
+	// results that must be equal for two rows to join.
+	LeftKey, RightKey int
+}
+
+// MarshalJSON serializes the SemiJoin into a JSON representation.
+// It's used for testing and diagnostics.
+func (sj *SemiJoin) MarshalJSON() ([]byte, error) {
+	marshalSemiJoin := struct {
+		Opcode   string
+		Left     Primitive `json:",omitempty"`
+		Right    Primitive `json:",omitempty"`
+		Cols     []int     `json:",omitempty"`
+		ListVar  string
+		LeftKey  int
+		RightKey int
+	}{
+		Opcode:   "Semi" + sj.Opcode.String(),
+		Left:     sj.Left,
+		Right:    sj.Right,
+		Cols:     sj.Cols,
+		ListVar:  sj.ListVar,
+		LeftKey:  sj.LeftKey,
+		RightKey: sj.RightKey,
+	}
+	return json.Marshal(marshalSemiJoin)
+}
+
+// Execute performs a non-streaming exec.
+func (sj *SemiJoin) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool) (*sqltypes.Result, error) {
+	lresult, err := sj.Left.Execute(vcursor, bindVars, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	ht, rfields, err := sj.fetchRight(vcursor, bindVars, lresult.Rows, wantfields)
+	if err != nil {
+		return nil, err
+	}
+	result := &sqltypes.Result{}
+	if wantfields {
+		result.Fields = joinFields(lresult.Fields, rfields, sj.Cols)
+	}
+	for _, lrow := range lresult.Rows {
+		result.Rows = append(result.Rows, ht.join(sj.Opcode, lrow, []int{sj.LeftKey}, sj.Cols)...)
+	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// StreamExecute performs a streaming exec.
+// Every result of the LHS stream is joined separately.
+func (sj *SemiJoin) StreamExecute(vcursor VCursor, bindVars map[string]*querypb.BindVariable, wantfields bool, callback func(*sqltypes.Result) error) error {
+	var lfields []*querypb.Field
+	return sj.Left.StreamExecute(vcursor, bindVars, wantfields, func(lresult *sqltypes.Result) error {
+		if len(lresult.Fields) != 0 {
+			lfields = lresult.Fields
+		}
+		if len(lresult.Rows) == 0 && !wantfields {
+			return nil
+		}
+		ht, rfields, err := sj.fetchRight(vcursor, bindVars, lresult.Rows, wantfields)
+		if err != nil {
+			return err
+		}
+		result := &sqltypes.Result{}
+		if wantfields {
+			wantfields = false
+			result.Fields = joinFields(lfields, rfields, sj.Cols)
+		}
+		for _, lrow := range lresult.Rows {
+			result.Rows = append(result.Rows, ht.join(sj.Opcode, lrow, []int{sj.LeftKey}, sj.Cols)...)
+		}
+		return callback(result)
+	})
+}
+
+// GetFields fetches the field info.
+func (sj *SemiJoin) GetFields(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	lresult, err := sj.Left.GetFields(vcursor, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	rresult, err := sj.Right.GetFields(vcursor, combineVars(bindVars, sj.listVars(nil)))
+	if err != nil {
+		return nil, err
+	}
+	return &sqltypes.Result{Fields: joinFields(lresult.Fields, rresult.Fields, sj.Cols)}, nil
+}
+
+// fetchRight executes the RHS for the distinct values of LeftKey in
+// lrows, and returns its rows in a hash table. If wantfields is set,
+// it also returns the fields of the RHS.
+func (sj *SemiJoin) fetchRight(vcursor VCursor, bindVars map[string]*querypb.BindVariable, lrows [][]sqltypes.Value, wantfields bool) (*hashTable, []*querypb.Field, error) {
+	var values []sqltypes.Value
+	seen := make(map[string]bool)
+	for _, lrow := range lrows {
+		key, ok := joinKey(lrow, []int{sj.LeftKey})
+		if !ok || seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, lrow[sj.LeftKey])
+	}
+
+	ht := newHashTable()
+	var rfields []*querypb.Field
+	for len(values) > 0 {
+		batch := values
+		if len(batch) > SemiJoinBatchSize {
+			batch = batch[:SemiJoinBatchSize]
+		}
+		values = values[len(batch):]
+		rresult, err := sj.Right.Execute(vcursor, combineVars(bindVars, sj.listVars(batch)), wantfields)
+		if err != nil {
+			return nil, nil, err
+		}
+		if wantfields {
+			wantfields = false
+			rfields = rresult.Fields
+		}
+		if err := ht.add(rresult.Rows, []int{sj.RightKey}); err != nil {
+			return nil, nil, err
+		}
+	}
+	if wantfields {
+		rresult, err := sj.Right.GetFields(vcursor, combineVars(bindVars, sj.listVars(nil)))
+		if err != nil {
+			return nil, nil, err
+		}
+		rfields = rresult.Fields
+	}
+	return ht, rfields, nil
+}
+
+// listVars returns the bind variables that pass values to the RHS.
+func (sj *SemiJoin) listVars(values []sqltypes.Value) map[string]*querypb.BindVariable {
+	bv := &querypb.BindVariable{
+		Type:   querypb.Type_TUPLE,
+		Values: make([]*querypb.Value, len(values)),
+	}
+	for i, v := range values {
+		bv.Values[i] = sqltypes.ValueToProto(v)
+	}
+	return map[string]*querypb.BindVariable{sj.ListVar: bv}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package engine
+
+import (
+	"reflect"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+func TestSemiJoinExecute(t *testing.T) {
+	saved := SemiJoinBatchSize
+	defer func() { SemiJoinBatchSize = saved }()
+	SemiJoinBatchSize = 2
+
+	leftFields := sqltypes.MakeTestFields(
+		"col1|col2",
+		"int64|varchar",
+	)
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			leftFields,
+			"1|a",
+			"2|b",
+			"1|c",
+			"null|d",
+			"3|e",
+		)},
+	}
+	rightFields := sqltypes.MakeTestFields(
+		"col3|col4",
+		"int64|varchar",
+	)
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{
+			sqltypes.MakeTestResult(
+				rightFields,
+				"1|x",
+				"1|y",
+			),
+			sqltypes.MakeTestResult(
+				rightFields,
+				"3|z",
+			),
+		},
+	}
+
+	sj := &SemiJoin{
+		Opcode:   LeftJoin,
+		Left:     leftPrim,
+		Right:    rightPrim,
+		Cols:     []int{-1, -2, 2},
+		ListVar:  "t_col1",
+		LeftKey:  0,
+		RightKey: 0,
+	}
+	bindVars := map[string]*querypb.BindVariable{"a": sqltypes.Int64BindVariable(10)}
+	result, err := sj.Execute(nil, bindVars, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|col2|col4",
+			"int64|varchar|varchar",
+		),
+		"1|a|x",
+		"1|a|y",
+		"2|b|null",
+		"1|c|x",
+		"1|c|y",
+		"null|d|null",
+		"3|e|z",
+	)
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("sj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+
+	// The distinct values are sent in batches.
+	wantBindVars := []map[string]*querypb.BindVariable{{
+		"a": sqltypes.Int64BindVariable(10),
+		"t_col1": &querypb.BindVariable{
+			Type: querypb.Type_TUPLE,
+			Values: []*querypb.Value{
+				sqltypes.ValueToProto(sqltypes.NewInt64(1)),
+				sqltypes.ValueToProto(sqltypes.NewInt64(2)),
+			},
+		},
+	}, {
+		"a": sqltypes.Int64BindVariable(10),
+		"t_col1": &querypb.BindVariable{
+			Type: querypb.Type_TUPLE,
+			Values: []*querypb.Value{
+				sqltypes.ValueToProto(sqltypes.NewInt64(3)),
+			},
+		},
+	}}
+	if !reflect.DeepEqual(rightPrim.bindVars, wantBindVars) {
+		t.Errorf("sj.Execute: RHS bind vars:\n%v, want\n%v", rightPrim.bindVars, wantBindVars)
+	}
+
+	// Normal join.
+	leftPrim.rewind()
+	rightPrim.rewind()
+	sj.Opcode = NormalJoin
+	result, err = sj.Execute(nil, bindVars, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult = sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"col1|col2|col4",
+			"int64|varchar|varchar",
+		),
+		"1|a|x",
+		"1|a|y",
+		"1|c|x",
+		"1|c|y",
+		"3|e|z",
+	)
+	wantResult.Fields = nil
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("sj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+}
+
+func TestSemiJoinExecuteNoRows(t *testing.T) {
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col1|col2",
+				"int64|varchar",
+			),
+		)},
+	}
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col3|col4",
+				"int64|varchar",
+			),
+		)},
+	}
+
+	sj := &SemiJoin{
+		Left:     leftPrim,
+		Right:    rightPrim,
+		Cols:     []int{-1, 2},
+		ListVar:  "t_col1",
+		LeftKey:  0,
+		RightKey: 0,
+	}
+	result, err := sj.Execute(nil, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantResult := &sqltypes.Result{
+		Fields: sqltypes.MakeTestFields(
+			"col1|col4",
+			"int64|varchar",
+		),
+	}
+	if !reflect.DeepEqual(result, wantResult) {
+		t.Errorf("sj.Execute:\n%v, want\n%v", result, wantResult)
+	}
+	// The RHS is only called for its fields.
+	wantBindVars := []map[string]*querypb.BindVariable{{
+		"t_col1": &querypb.BindVariable{
+			Type:   querypb.Type_TUPLE,
+			Values: []*querypb.Value{},
+		},
+	}}
+	if !reflect.DeepEqual(rightPrim.bindVars, wantBindVars) {
+		t.Errorf("sj.Execute: RHS bind vars:\n%v, want\n%v", rightPrim.bindVars, wantBindVars)
+	}
+}
+
+func TestSemiJoinStreamExecute(t *testing.T) {
+	leftPrim := &fakePrimitive{
+		results: []*sqltypes.Result{sqltypes.MakeTestResult(
+			sqltypes.MakeTestFields(
+				"col1|col2",
+				"int64|varchar",
+			),
+			"1|a",
+			"2|b",
+			"3|c",
+		)},
+	}
+	rightFields := sqltypes.MakeTestFields(
+		"col3|col4",
+		"int64|varchar",
+	)
+	rightPrim := &fakePrimitive{
+		results: []*sqltypes.Result{
+			sqltypes.MakeTestResult(rightFields),
+			sqltypes.MakeTestResult(
+				rightFields,
+				"2|x",
+			),
+			sqltypes.MakeTestResult(
+				rightFields,
+				"3|y",
+			),
+		},
+	}
+
+	sj := &SemiJoin{
+		Left:     leftPrim,
+		Right:    rightPrim,
+		Cols:     []int{-1, 2},
+		ListVar:  "t_col1",
+		LeftKey:  0,
+		RightKey: 0,
+	}
+	var results []*sqltypes.Result
+	err := sj.StreamExecute(nil, nil, true, func(qr *sqltypes.Result) error {
+		results = append(results, qr)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The LHS sends its fields, and then rows in chunks of two.
+	// The RHS is executed once for each chunk.
+	wantResults := sqltypes.MakeTestStreamingResults(
+		sqltypes.MakeTestFields(
+			"col1|col4",
+			"int64|varchar",
+		),
+		"2|x",
+		"---",
+		"3|y",
+	)
+	if !reflect.DeepEqual(results, wantResults) {
+		t.Errorf("sj.StreamExecute:\n%v, want\n%v", results, wantResults)
+	}
+}
@@ -19,11 +19,14 @@ package engine
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"vitess.io/vitess/go/jsonutil"
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/sqlannotation"
+	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
@@ -56,19 +59,64 @@ type Update struct {
 	Table *vindexes.Table
 
 	// OwnedVindexQuery is used for updating changes in lookup vindexes.
+	// For UpdateSharded, and for updates that move rows, it selects the
+	// rows to update on all the shards, and its first column is the
+	// column of KsidVindex. The owned vindex columns follow it.
 	OwnedVindexQuery string
+
+	// KsidVindex is the primary vindex of Table. It computes the
+	// keyspace ids of the rows selected by OwnedVindexQuery.
+	KsidVindex vindexes.Vindex
+
+	// OrderBy, Limit and KeyColumn are set for an UpdateSharded, or an
+	// update that moves rows, with a LIMIT clause. The rows of all the
+	// shards are sorted according to OrderBy, which refers to the columns
+	// of OwnedVindexQuery, and the first Limit rows are updated. OrderBy
+	// covers a unique key, whose column is KeyColumn: each shard receives
+	// the keys of its rows in DMLKeysVarName.
+	OrderBy   []OrderbyParams
+	Limit     *sqltypes.PlanValue
+	KeyColumn int
+
+	// Assignments are set if the update changes the primary vindex
+	// columns. The rows selected by OwnedVindexQuery are then moved:
+	// they're deleted with DeleteQuery, and inserted again with the
+	// values of the assignments, in the shards of their new keyspace ids.
+	// The expressions refer to the columns of OwnedVindexQuery, and the
+	// columns of the table start at RowOffset.
+	Assignments []*UpdateAssignment
+	RowOffset   int
+	DeleteQuery string
+}
+
+// UpdateAssignment is an assignment of the SET clause of an update.
+type UpdateAssignment struct {
+	Column string
+	Expr   evalengine.Expr
 }
 
 // MarshalJSON serializes the Update into a JSON representation.
 // It's used for testing and diagnostics.
 func (upd *Update) MarshalJSON() ([]byte, error) {
-	var tname, vindexName string
+	var tname, vindexName, ksidVindexName string
 	if upd.Table != nil {
 		tname = upd.Table.Name.String()
 	}
 	if upd.Vindex != nil {
 		vindexName = upd.Vindex.String()
 	}
+	if upd.KsidVindex != nil {
+		ksidVindexName = upd.KsidVindex.String()
+	}
+	var assignments []string
+	for _, a := range upd.Assignments {
+		assignments = append(assignments, fmt.Sprintf("%s = %s", a.Column, a.Expr))
+	}
+	// The key column is only significant with a limit.
+	var keyColumn *int
+	if upd.Limit != nil {
+		keyColumn = &upd.KeyColumn
+	}
 	marshalUpdate := struct {
 		Opcode              UpdateOpcode
 		Keyspace            *vindexes.Keyspace              `json:",omitempty"`
@@ -78,6 +126,13 @@ func (upd *Update) MarshalJSON() ([]byte, error) {
 		ChangedVindexValues map[string][]sqltypes.PlanValue `json:",omitempty"`
 		Table               string                          `json:",omitempty"`
 		OwnedVindexQuery    string                          `json:",omitempty"`
+		KsidVindex          string                          `json:",omitempty"`
+		OrderBy             []OrderbyParams                 `json:",omitempty"`
+		Limit               *sqltypes.PlanValue             `json:",omitempty"`
+		KeyColumn           *int                            `json:",omitempty"`
+		Assignments         []string                        `json:",omitempty"`
+		RowOffset           int                             `json:",omitempty"`
+		DeleteQuery         string                          `json:",omitempty"`
 	}{
 		Opcode:              upd.Opcode,
 		Keyspace:            upd.Keyspace,
@@ -87,6 +142,13 @@ func (upd *Update) MarshalJSON() ([]byte, error) {
 		ChangedVindexValues: upd.ChangedVindexValues,
 		Table:               tname,
 		OwnedVindexQuery:    upd.OwnedVindexQuery,
+		KsidVindex:          ksidVindexName,
+		OrderBy:             upd.OrderBy,
+		Limit:               upd.Limit,
+		KeyColumn:           keyColumn,
+		Assignments:         assignments,
+		RowOffset:           upd.RowOffset,
+		DeleteQuery:         upd.DeleteQuery,
 	}
 	return jsonutil.MarshalNoEscape(marshalUpdate)
 }
@@ -104,11 +166,19 @@ const (
 	// to a single shard: Requires: A Vindex, and
 	// a single Value.
 	UpdateEqual
+	// UpdateSharded is for routing a scattered
+	// update statement. If the update changes owned
+	// vindexes, or if it has a LIMIT clause, the rows
+	// are first selected with OwnedVindexQuery: their
+	// lookup entries are updated, and the update is
+	// only sent to their shards.
+	UpdateSharded
 )
 
 var updName = map[UpdateOpcode]string{
 	UpdateUnsharded: "UpdateUnsharded",
 	UpdateEqual:     "UpdateEqual",
+	UpdateSharded:   "UpdateSharded",
 }
 
 // MarshalJSON serializes the UpdateOpcode as a JSON string.
@@ -124,6 +194,8 @@ func (upd *Update) Execute(vcursor VCursor, bindVars map[string]*querypb.BindVar
 		return upd.execUpdateUnsharded(vcursor, bindVars)
 	case UpdateEqual:
 		return upd.execUpdateEqual(vcursor, bindVars)
+	case UpdateSharded:
+		return upd.execUpdateSharded(vcursor, bindVars)
 	default:
 		// Unreachable.
 		return nil, fmt.Errorf("unsupported opcode: %v", upd)
@@ -152,17 +224,16 @@ func (upd *Update) execUpdateUnsharded(vcursor VCursor, bindVars map[string]*que
 }
 
 func (upd *Update) execUpdateEqual(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
-	key, err := upd.Values[0].ResolveValue(bindVars)
-	if err != nil {
-		return nil, vterrors.Wrap(err, "execUpdateEqual")
-	}
-	ks, shard, ksid, err := resolveSingleShard(vcursor, upd.Vindex, upd.Keyspace, bindVars, key)
+	ks, shard, ksid, err := resolveSingleShard(vcursor, upd.Vindex, upd.Keyspace, bindVars, upd.Values[0])
 	if err != nil {
 		return nil, vterrors.Wrap(err, "execUpdateEqual")
 	}
 	if len(ksid) == 0 {
 		return &sqltypes.Result{}, nil
 	}
+	if upd.Assignments != nil {
+		return upd.execMoveRows(vcursor, bindVars, shard, "execUpdateEqual")
+	}
 	if len(upd.ChangedVindexValues) != 0 {
 		if err := upd.updateVindexEntries(vcursor, upd.OwnedVindexQuery, bindVars, ks, shard, ksid); err != nil {
 			return nil, vterrors.Wrap(err, "execUpdateEqual")
@@ -189,12 +260,18 @@ func (upd *Update) updateVindexEntries(vcursor VCursor, query string, bindVars m
 	if len(subQueryResult.Rows) > 1 {
 		return vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "unsupported: update changes multiple rows in the vindex")
 	}
-	colnum := 0
+	return upd.updateLookupEntries(vcursor, bindVars, subQueryResult.Rows[0], 0, ksid)
+}
+
+// updateLookupEntries replaces the entries of the changed vindexes for
+// a row. The owned vindex columns are in the order of Table.Owned,
+// starting at colnum.
+func (upd *Update) updateLookupEntries(vcursor VCursor, bindVars map[string]*querypb.BindVariable, row []sqltypes.Value, colnum int, ksid []byte) error {
 	for _, colVindex := range upd.Table.Owned {
 		// Fetch the column values. colnum must keep incrementing.
 		fromIds := make([]sqltypes.Value, 0, len(colVindex.Columns))
 		for range colVindex.Columns {
-			fromIds = append(fromIds, subQueryResult.Rows[0][colnum])
+			fromIds = append(fromIds, row[colnum])
 			colnum++
 		}
 
@@ -216,3 +293,143 @@ func (upd *Update) updateVindexEntries(vcursor VCursor, query string, bindVars m
 	}
 	return nil
 }
+
+func (upd *Update) execUpdateSharded(vcursor VCursor, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, error) {
+	if upd.Assignments != nil {
+		return upd.execMoveRows(vcursor, bindVars, "", "execUpdateSharded")
+	}
+	if upd.OwnedVindexQuery == "" {
+		ks, allShards, err := vcursor.GetKeyspaceShards(upd.Keyspace)
+		if err != nil {
+			return nil, vterrors.Wrap(err, "execUpdateSharded")
+		}
+		shardQueries := make(map[string]*querypb.BoundQuery, len(allShards))
+		sql := sqlannotation.AnnotateIfDML(upd.Query, nil)
+		for _, shard := range allShards {
+			shardQueries[shard.Name] = &querypb.BoundQuery{
+				Sql:           sql,
+				BindVariables: bindVars,
+			}
+		}
+		return vcursor.ExecuteMultiShard(ks, shardQueries, true /* isDML */, true /* canAutocommit */)
+	}
+
+	rows, err := findDMLRows(vcursor, bindVars, upd.Keyspace, "", upd.OwnedVindexQuery, upd.KsidVindex, ksidColumnCount(upd.Table), upd.OrderBy, upd.Limit, upd.KeyColumn)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execUpdateSharded")
+	}
+	if len(upd.ChangedVindexValues) != 0 {
+		for i, row := range rows.rows {
+			// The owned vindex columns follow the primary vindex columns.
+			if err := upd.updateLookupEntries(vcursor, bindVars, row, ksidColumnCount(upd.Table), rows.ksids[i]); err != nil {
+				return nil, vterrors.Wrap(err, "execUpdateSharded")
+			}
+		}
+	}
+	result, err := execDMLShards(vcursor, upd.Query, bindVars, rows)
+	if err != nil {
+		return nil, vterrors.Wrap(err, "execUpdateSharded")
+	}
+	return result, nil
+}
+
+// execMoveRows executes an update that changes the primary vindex
+// columns. The rows are deleted from their current shard, along with
+// their lookup entries, and inserted again with the new values, which
+// creates the new lookup entries. The rows are only looked for in
+// shard, or in all the shards if it's empty.
+func (upd *Update) execMoveRows(vcursor VCursor, bindVars map[string]*querypb.BindVariable, shard, method string) (*sqltypes.Result, error) {
+	rows, err := findDMLRows(vcursor, bindVars, upd.Keyspace, shard, upd.OwnedVindexQuery, upd.KsidVindex, ksidColumnCount(upd.Table), upd.OrderBy, upd.Limit, upd.KeyColumn)
+	if err != nil {
+		return nil, vterrors.Wrap(err, method)
+	}
+	if len(rows.rows) == 0 {
+		return &sqltypes.Result{}, nil
+	}
+	newRows, err := upd.newRows(bindVars, rows)
+	if err != nil {
+		return nil, vterrors.Wrap(err, method)
+	}
+	ins, err := upd.moveInsert(rows.fields[upd.RowOffset:])
+	if err != nil {
+		return nil, vterrors.Wrap(err, method)
+	}
+
+	for i, row := range rows.rows {
+		if err := deleteLookupEntries(vcursor, upd.Table, [][]sqltypes.Value{row}, ksidColumnCount(upd.Table), rows.ksids[i]); err != nil {
+			return nil, vterrors.Wrap(err, method)
+		}
+	}
+	if _, err := execDMLShards(vcursor, upd.DeleteQuery, bindVars, rows); err != nil {
+		return nil, vterrors.Wrap(err, method)
+	}
+	if _, err := ins.insertRows(vcursor, bindVars, newRows); err != nil {
+		return nil, vterrors.Wrap(err, method)
+	}
+	return &sqltypes.Result{RowsAffected: uint64(len(newRows))}, nil
+}
+
+// newRows returns the table rows of the moved rows, after the assignments.
+// The assignments are applied in order, and each one sees the values of
+// the previous ones, like in MySQL.
+func (upd *Update) newRows(bindVars map[string]*querypb.BindVariable, rows *dmlRows) ([][]sqltypes.Value, error) {
+	newRows := make([][]sqltypes.Value, len(rows.rows))
+	for i, row := range rows.rows {
+		row = append([]sqltypes.Value(nil), row...)
+		env := evalengine.ExpressionEnv{
+			BindVars: bindVars,
+			Fields:   rows.fields,
+			Row:      row,
+		}
+		for _, a := range upd.Assignments {
+			val, err := a.Expr.Evaluate(env)
+			if err != nil {
+				return nil, err
+			}
+			// The column can be both in the table row
+			// and before it, if it's used by an expression.
+			for j, field := range rows.fields {
+				if strings.EqualFold(field.Name, a.Column) {
+					row[j] = val
+				}
+			}
+		}
+		newRows[i] = row[upd.RowOffset:]
+	}
+	return newRows, nil
+}
+
+// moveInsert returns the Insert that inserts the moved rows,
+// whose columns are described by fields.
+func (upd *Update) moveInsert(fields []*querypb.Field) (*Insert, error) {
+	columns := make(sqlparser.Columns, len(fields))
+	for i, field := range fields {
+		columns[i] = sqlparser.NewColIdent(field.Name)
+	}
+	offsets := make([][]int, len(upd.Table.ColumnVindexes))
+	for vIdx, colVindex := range upd.Table.ColumnVindexes {
+		offsets[vIdx] = make([]int, len(colVindex.Columns))
+		for colIdx, col := range colVindex.Columns {
+			offset := -1
+			for i, column := range columns {
+				if col.Equal(column) {
+					offset = i
+					break
+				}
+			}
+			if offset == -1 {
+				return nil, fmt.Errorf("vindex column %v not found in table %v", col, upd.Table.Name)
+			}
+			offsets[vIdx][colIdx] = offset
+		}
+	}
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("insert into %v%v values ", upd.Table.Name, columns)
+	return &Insert{
+		Opcode:            InsertSelect,
+		Keyspace:          upd.Keyspace,
+		Table:             upd.Table,
+		Prefix:            buf.String(),
+		VindexValueOffset: offsets,
+	}, nil
+}
@@ -21,6 +21,8 @@ import (
 	"testing"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
@@ -288,3 +290,199 @@ func buildTestVSchema() *vindexes.VSchema {
 	}
 	return vs
 }
+
+func TestUpdateSharded(t *testing.T) {
+	upd := &Update{
+		Opcode: UpdateSharded,
+		Keyspace: &vindexes.Keyspace{
+			Name:    "ks",
+			Sharded: true,
+		},
+		Query: "dummy_update",
+	}
+
+	vc := &loggingVCursor{shards: []string{"-20", "20-"}}
+	_, err := upd.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{ks true}`,
+		`ExecuteMultiShard ks -20: dummy_update 20-: dummy_update  true true`,
+	})
+
+	// Failure case
+	vc = &loggingVCursor{shardErr: errors.New("shard_error")}
+	_, err = upd.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	expectError(t, "Execute", err, "execUpdateSharded: shard_error")
+}
+
+func TestUpdateShardedChangedVindex(t *testing.T) {
+	ks := buildTestVSchema().Keyspaces["sharded"]
+	upd := &Update{
+		Opcode:   UpdateSharded,
+		Keyspace: ks.Keyspace,
+		Query:    "dummy_update",
+		ChangedVindexValues: map[string][]sqltypes.PlanValue{
+			"onecol": {{
+				Value: sqltypes.NewInt64(3),
+			}},
+		},
+		Table:            ks.Tables["t1"],
+		OwnedVindexQuery: "dummy_subquery",
+		KsidVindex:       ks.Vindexes["hash"],
+	}
+
+	results := []*sqltypes.Result{sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"id|c1|c2|c3",
+			"int64|int64|int64|int64",
+		),
+		"1|4|5|6",
+		"2|7|8|9",
+	)}
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "-20"},
+		results:      results,
+	}
+	_, err := upd.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		`ExecuteMultiShard sharded -20: dummy_subquery 20-: dummy_subquery  false false`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		// The entries of onecol are replaced for each row, with its keyspace id.
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"6" toc: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		`Execute insert into lkp1(from, toc) values(:from0, :toc0) from0: type:INT64 value:"3" toc0: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"9" toc: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`Execute insert into lkp1(from, toc) values(:from0, :toc0) from0: type:INT64 value:"3" toc0: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		// The update is only sent to the shard of the rows.
+		`ExecuteMultiShard sharded -20: dummy_update  true true`,
+	})
+}
+
+func TestUpdateMoveRows(t *testing.T) {
+	ks := buildTestVSchema().Keyspaces["sharded"]
+	upd := &Update{
+		Opcode:   UpdateEqual,
+		Keyspace: ks.Keyspace,
+		Query:    "dummy_update",
+		Vindex:   ks.Vindexes["hash"],
+		Values:   []sqltypes.PlanValue{{Value: sqltypes.NewInt64(1)}},
+		Table:    ks.Tables["t1"],
+		// select id, c1, c2, c3, col, t1.* from t1 where id = 1 for update
+		OwnedVindexQuery: "dummy_subquery",
+		KsidVindex:       ks.Vindexes["hash"],
+		Assignments: []*UpdateAssignment{{
+			Column: "id",
+			Expr:   &evalengine.Literal{Val: sqltypes.NewInt64(2)},
+		}, {
+			Column: "col",
+			Expr: &evalengine.Arithmetic{
+				Op:    sqlparser.PlusStr,
+				Left:  &evalengine.Column{Offset: 4},
+				Right: &evalengine.Literal{Val: sqltypes.NewInt64(1)},
+			},
+		}},
+		RowOffset:   5,
+		DeleteQuery: "dummy_delete",
+	}
+
+	results := []*sqltypes.Result{sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"id|c1|c2|c3|col|id|c1|c2|c3|col",
+			"int64|int64|int64|int64|int64|int64|int64|int64|int64|int64",
+		),
+		"1|4|5|6|10|1|4|5|6|10",
+	)}
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "-20", "20-"},
+		results:      results,
+	}
+	result, err := upd.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		// The rows are only selected in the shard of the routing value.
+		`GetKeyspaceShards &{sharded true}`,
+		`ExecuteMultiShard sharded -20: dummy_subquery  false false`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		// The lookup entries of the old row are deleted, along with the row.
+		`Execute delete from lkp2 where from1 = :from1 and from2 = :from2 and toc = :toc from1: type:INT64 value:"4" from2: type:INT64 value:"5" toc: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"6" toc: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		`ExecuteMultiShard sharded -20: dummy_delete  true true`,
+		// The new row is inserted in the shard of its new keyspace id,
+		// with new lookup entries.
+		`GetKeyspaceShards &{sharded true}`,
+		`Execute insert into lkp2(from1, from2, toc) values(:from10, :from20, :toc0) from10: type:INT64 value:"4" from20: type:INT64 value:"5" toc0: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`Execute insert into lkp1(from, toc) values(:from0, :toc0) from0: type:INT64 value:"6" toc0: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		`ExecuteMultiShard sharded 20-: insert into t1(id, c1, c2, c3, col) values (:_id0, :_c10, :_c20, :_c30, 11) /* vtgate:: keyspace_id:06e7ea22ce92708f */ _c10: type:INT64 value:"4" _c20: type:INT64 value:"5" _c30: type:INT64 value:"6" _id0: type:INT64 value:"2"  true false`,
+	})
+	expectResult(t, "Execute", result, &sqltypes.Result{RowsAffected: 1})
+}
+
+func TestUpdateMoveRowsLimit(t *testing.T) {
+	ks := buildTestVSchema().Keyspaces["sharded"]
+	upd := &Update{
+		Opcode:   UpdateSharded,
+		Keyspace: ks.Keyspace,
+		Query:    "dummy_update",
+		Table:    ks.Tables["t1"],
+		// select id, c1, c2, c3, col, t1.* from t1 order by col, id limit 1 for update
+		OwnedVindexQuery: "dummy_subquery",
+		KsidVindex:       ks.Vindexes["hash"],
+		OrderBy:          []OrderbyParams{{Col: 4}, {Col: 0}},
+		Limit:            &sqltypes.PlanValue{Value: sqltypes.NewInt64(1)},
+		KeyColumn:        0,
+		Assignments: []*UpdateAssignment{{
+			Column: "id",
+			Expr:   &evalengine.Literal{Val: sqltypes.NewInt64(2)},
+		}},
+		RowOffset:   5,
+		DeleteQuery: "dummy_delete",
+	}
+
+	results := []*sqltypes.Result{sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"id|c1|c2|c3|col|id|c1|c2|c3|col",
+			"int64|int64|int64|int64|int64|int64|int64|int64|int64|int64",
+		),
+		"3|7|8|9|10|3|7|8|9|10",
+		"1|4|5|6|10|1|4|5|6|10",
+	)}
+	vc := &loggingVCursor{
+		shards:       []string{"-20", "20-"},
+		shardForKsid: []string{"-20", "20-"},
+		results:      results,
+	}
+	result, err := upd.Execute(vc, map[string]*querypb.BindVariable{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vc.ExpectLog(t, []string{
+		`GetKeyspaceShards &{sharded true}`,
+		`ExecuteMultiShard sharded -20: dummy_subquery 20-: dummy_subquery  false false`,
+		// Only the first row in the order of col and id is kept: 1,
+		// which ties with 3 on col.
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "166b40b44aba4bd6"`,
+		`Execute delete from lkp2 where from1 = :from1 and from2 = :from2 and toc = :toc from1: type:INT64 value:"4" from2: type:INT64 value:"5" toc: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		`Execute delete from lkp1 where from = :from and toc = :toc from: type:INT64 value:"6" toc: type:VARBINARY value:"\026k@\264J\272K\326"  true`,
+		// Its shard deletes it by its id, and only it is inserted again.
+		`ExecuteMultiShard sharded -20: dummy_delete __dml_keys: type:TUPLE values:<type:INT64 value:"1" >  true true`,
+		`GetKeyspaceShards &{sharded true}`,
+		`Execute insert into lkp2(from1, from2, toc) values(:from10, :from20, :toc0) from10: type:INT64 value:"4" from20: type:INT64 value:"5" toc0: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`Execute insert into lkp1(from, toc) values(:from0, :toc0) from0: type:INT64 value:"6" toc0: type:VARBINARY value:"\006\347\352\"\316\222p\217"  true`,
+		`GetShardForKeyspaceID [name:"-20"  name:"20-" ] "06e7ea22ce92708f"`,
+		`ExecuteMultiShard sharded 20-: insert into t1(id, c1, c2, c3, col) values (:_id0, :_c10, :_c20, :_c30, 10) /* vtgate:: keyspace_id:06e7ea22ce92708f */ _c10: type:INT64 value:"4" _c20: type:INT64 value:"5" _c30: type:INT64 value:"6" _id0: type:INT64 value:"2"  true false`,
+	})
+	expectResult(t, "Execute", result, &sqltypes.Result{RowsAffected: 1})
+}
@@ -119,16 +119,15 @@ func (vf *VindexFunc) mapVindex(vcursor VCursor, bindVars map[string]*querypb.Bi
 		if err != nil {
 			return nil, err
 		}
-		switch {
-		case ksids[0].Range != nil:
-			result.Rows = append(result.Rows, vf.buildRow(vkey, nil, ksids[0].Range))
-			result.RowsAffected = 1
-		case ksids[0].ID != nil:
-			result.Rows = [][]sqltypes.Value{
-				vf.buildRow(vkey, ksids[0].ID, nil),
-			}
-			result.RowsAffected = 1
+		vf.addKsidOrRange(result, vkey, ksids[0])
+	case vindexes.MultiColumn:
+		// The value is for the first column of the vindex,
+		// which maps to a keyrange.
+		ksids, err := mapper.MapMulti(vcursor, [][]sqltypes.Value{{key}})
+		if err != nil {
+			return nil, err
 		}
+		vf.addKsidOrRange(result, vkey, ksids[0])
 	case vindexes.NonUnique:
 		ksidss, err := mapper.Map(vcursor, []sqltypes.Value{key})
 		if err != nil {
@@ -149,6 +148,21 @@ func (vf *VindexFunc) mapVindex(vcursor VCursor, bindVars map[string]*querypb.Bi
 	return result, nil
 }
 
+// addKsidOrRange adds the row of a KsidOrRange to result, if the
+// value could be mapped.
+func (vf *VindexFunc) addKsidOrRange(result *sqltypes.Result, vkey sqltypes.Value, ksid vindexes.KsidOrRange) {
+	switch {
+	case ksid.Range != nil:
+		result.Rows = append(result.Rows, vf.buildRow(vkey, nil, ksid.Range))
+		result.RowsAffected = 1
+	case ksid.ID != nil:
+		result.Rows = [][]sqltypes.Value{
+			vf.buildRow(vkey, ksid.ID, nil),
+		}
+		result.RowsAffected = 1
+	}
+}
+
 func (vf *VindexFunc) buildRow(id sqltypes.Value, ksid []byte, kr *topodatapb.KeyRange) []sqltypes.Value {
 	row := make([]sqltypes.Value, 0, len(vf.Fields))
 	for _, col := range vf.Cols {
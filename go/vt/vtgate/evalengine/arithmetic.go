@@ -0,0 +1,429 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evalengine
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// divScaleIncrement is the number of digits that MySQL adds to
+// the scale of the dividend to compute the scale of a division.
+const divScaleIncrement = 4
+
+// maxScale is the maximum scale of a MySQL decimal.
+const maxScale = 30
+
+// numeric represents a numeric value extracted from a Value.
+// typ is one of Int64, Uint64, Float64 or Decimal. The scale
+// is the number of fractional digits of a Decimal.
+type numeric struct {
+	typ   querypb.Type
+	ival  int64
+	uval  uint64
+	fval  float64
+	dval  *big.Rat
+	scale int
+}
+
+// newNumeric parses a non-NULL value. Integral, float and decimal values
+// keep their type. Like in MySQL, all other values are converted to a
+// float using their longest numeric prefix, and produce zero if there
+// is none.
+func newNumeric(v sqltypes.Value) (numeric, error) {
+	str := v.ToString()
+	switch {
+	case v.IsSigned():
+		ival, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return numeric{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err)
+		}
+		return numeric{typ: sqltypes.Int64, ival: ival}, nil
+	case v.IsUnsigned():
+		uval, err := strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			return numeric{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err)
+		}
+		return numeric{typ: sqltypes.Uint64, uval: uval}, nil
+	case v.IsFloat():
+		fval, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return numeric{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", err)
+		}
+		return numeric{typ: sqltypes.Float64, fval: fval}, nil
+	case v.Type() == sqltypes.Decimal:
+		return newDecimal(str)
+	}
+	return numeric{typ: sqltypes.Float64, fval: parseFloatPrefix(str)}, nil
+}
+
+func newDecimal(str string) (numeric, error) {
+	dval, ok := new(big.Rat).SetString(str)
+	if !ok {
+		return numeric{}, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not parse decimal value: '%s'", str)
+	}
+	scale := 0
+	if i := strings.IndexByte(str, '.'); i != -1 {
+		scale = len(str) - i - 1
+	}
+	return numeric{typ: sqltypes.Decimal, dval: dval, scale: scale}, nil
+}
+
+// parseFloatPrefix returns the value of the longest prefix of str
+// that is a valid number, ignoring leading spaces.
+func parseFloatPrefix(str string) float64 {
+	str = strings.TrimLeft(str, " \t\n\r")
+	end := 0
+	digits := func() bool {
+		start := end
+		for end < len(str) && str[end] >= '0' && str[end] <= '9' {
+			end++
+		}
+		return end > start
+	}
+	if end < len(str) && (str[end] == '+' || str[end] == '-') {
+		end++
+	}
+	mantissa := digits()
+	if end < len(str) && str[end] == '.' {
+		end++
+		mantissa = digits() || mantissa
+	}
+	if !mantissa {
+		return 0
+	}
+	if end < len(str) && (str[end] == 'e' || str[end] == 'E') {
+		saved := end
+		end++
+		if end < len(str) && (str[end] == '+' || str[end] == '-') {
+			end++
+		}
+		if !digits() {
+			end = saved
+		}
+	}
+	// The only possible error is a range error,
+	// in which case fval is +/-Inf.
+	fval, _ := strconv.ParseFloat(str[:end], 64)
+	return fval
+}
+
+func (n numeric) toFloat() float64 {
+	switch n.typ {
+	case sqltypes.Int64:
+		return float64(n.ival)
+	case sqltypes.Uint64:
+		return float64(n.uval)
+	case sqltypes.Decimal:
+		f, _ := n.dval.Float64()
+		return f
+	}
+	return n.fval
+}
+
+func (n numeric) toRat() *big.Rat {
+	switch n.typ {
+	case sqltypes.Int64:
+		return new(big.Rat).SetInt64(n.ival)
+	case sqltypes.Uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(n.uval))
+	case sqltypes.Float64:
+		r := new(big.Rat)
+		if r.SetFloat64(n.fval) == nil {
+			// Inf or NaN.
+			return new(big.Rat)
+		}
+		return r
+	}
+	return n.dval
+}
+
+func (n numeric) toInt() *big.Int {
+	if n.typ == sqltypes.Uint64 {
+		return new(big.Int).SetUint64(n.uval)
+	}
+	return big.NewInt(n.ival)
+}
+
+func (n numeric) isZero() bool {
+	switch n.typ {
+	case sqltypes.Int64:
+		return n.ival == 0
+	case sqltypes.Uint64:
+		return n.uval == 0
+	case sqltypes.Decimal:
+		return n.dval.Sign() == 0
+	}
+	return n.fval == 0
+}
+
+// numericClass returns the type that newNumeric produces for
+// values of the specified type. Null is returned as is.
+func numericClass(typ querypb.Type) querypb.Type {
+	switch {
+	case typ == sqltypes.Null:
+		return sqltypes.Null
+	case sqltypes.IsSigned(typ):
+		return sqltypes.Int64
+	case sqltypes.IsUnsigned(typ):
+		return sqltypes.Uint64
+	case typ == sqltypes.Decimal:
+		return sqltypes.Decimal
+	}
+	return sqltypes.Float64
+}
+
+// resultClass returns the type in which an operation between
+// two numerics must be performed.
+func resultClass(t1, t2 querypb.Type) querypb.Type {
+	switch {
+	case t1 == sqltypes.Float64 || t2 == sqltypes.Float64:
+		return sqltypes.Float64
+	case t1 == sqltypes.Decimal || t2 == sqltypes.Decimal:
+		return sqltypes.Decimal
+	case t1 == sqltypes.Uint64 || t2 == sqltypes.Uint64:
+		return sqltypes.Uint64
+	}
+	return sqltypes.Int64
+}
+
+// arithmeticType returns the type of the result of an arithmetic
+// operation on values of the specified types.
+func arithmeticType(op string, t1, t2 querypb.Type) querypb.Type {
+	class := resultClass(numericClass(t1), numericClass(t2))
+	switch op {
+	case sqlparser.DivStr:
+		if class != sqltypes.Float64 {
+			return sqltypes.Decimal
+		}
+	case sqlparser.IntDivStr:
+		if class != sqltypes.Uint64 {
+			return sqltypes.Int64
+		}
+	}
+	return class
+}
+
+// arithmetic performs the operation on two non-NULL values.
+// Integer operations fail on overflow. A division by zero
+// produces NULL.
+func arithmetic(op string, v1, v2 sqltypes.Value) (sqltypes.Value, error) {
+	n1, err := newNumeric(v1)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	n2, err := newNumeric(v2)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	class := resultClass(n1.typ, n2.typ)
+	switch op {
+	case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr:
+		switch class {
+		case sqltypes.Float64:
+			f1, f2 := n1.toFloat(), n2.toFloat()
+			switch op {
+			case sqlparser.PlusStr:
+				return sqltypes.NewFloat64(f1 + f2), nil
+			case sqlparser.MinusStr:
+				return sqltypes.NewFloat64(f1 - f2), nil
+			}
+			return sqltypes.NewFloat64(f1 * f2), nil
+		case sqltypes.Decimal:
+			r1, r2 := n1.toRat(), n2.toRat()
+			switch op {
+			case sqlparser.PlusStr:
+				return decimalValue(new(big.Rat).Add(r1, r2), maxInt(n1.scale, n2.scale)), nil
+			case sqlparser.MinusStr:
+				return decimalValue(new(big.Rat).Sub(r1, r2), maxInt(n1.scale, n2.scale)), nil
+			}
+			return decimalValue(new(big.Rat).Mul(r1, r2), n1.scale+n2.scale), nil
+		}
+		i1, i2 := n1.toInt(), n2.toInt()
+		switch op {
+		case sqlparser.PlusStr:
+			return integralValue(class, new(big.Int).Add(i1, i2), v1, op, v2)
+		case sqlparser.MinusStr:
+			return integralValue(class, new(big.Int).Sub(i1, i2), v1, op, v2)
+		}
+		return integralValue(class, new(big.Int).Mul(i1, i2), v1, op, v2)
+	case sqlparser.DivStr:
+		if n2.isZero() {
+			return sqltypes.NULL, nil
+		}
+		if class == sqltypes.Float64 {
+			return sqltypes.NewFloat64(n1.toFloat() / n2.toFloat()), nil
+		}
+		return decimalValue(new(big.Rat).Quo(n1.toRat(), n2.toRat()), n1.scale+divScaleIncrement), nil
+	case sqlparser.IntDivStr:
+		if n2.isZero() {
+			return sqltypes.NULL, nil
+		}
+		var quotient *big.Int
+		switch class {
+		case sqltypes.Int64, sqltypes.Uint64:
+			quotient = new(big.Int).Quo(n1.toInt(), n2.toInt())
+		default:
+			class = sqltypes.Int64
+			r := new(big.Rat).Quo(n1.toRat(), n2.toRat())
+			quotient = new(big.Int).Quo(r.Num(), r.Denom())
+		}
+		return integralValue(class, quotient, v1, op, v2)
+	case sqlparser.ModStr:
+		if n2.isZero() {
+			return sqltypes.NULL, nil
+		}
+		switch class {
+		case sqltypes.Float64:
+			return sqltypes.NewFloat64(math.Mod(n1.toFloat(), n2.toFloat())), nil
+		case sqltypes.Decimal:
+			r1, r2 := n1.toRat(), n2.toRat()
+			q := new(big.Rat).Quo(r1, r2)
+			truncated := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+			return decimalValue(new(big.Rat).Sub(r1, truncated.Mul(truncated, r2)), maxInt(n1.scale, n2.scale)), nil
+		}
+		return integralValue(class, new(big.Int).Rem(n1.toInt(), n2.toInt()), v1, op, v2)
+	}
+	return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: unexpected arithmetic operator: %s", op)
+}
+
+// negate returns the negation of a non-NULL value.
+func negate(v sqltypes.Value) (sqltypes.Value, error) {
+	n, err := newNumeric(v)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	switch n.typ {
+	case sqltypes.Float64:
+		return sqltypes.NewFloat64(-n.fval), nil
+	case sqltypes.Decimal:
+		return decimalValue(new(big.Rat).Neg(n.dval), n.scale), nil
+	}
+	result := new(big.Int).Neg(n.toInt())
+	if !result.IsInt64() {
+		return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "BIGINT value is out of range in '-%s'", v.ToString())
+	}
+	return sqltypes.NewInt64(result.Int64()), nil
+}
+
+// integralValue converts the result of an integer operation to a
+// value of the specified class, or fails if it's out of range.
+func integralValue(class querypb.Type, result *big.Int, v1 sqltypes.Value, op string, v2 sqltypes.Value) (sqltypes.Value, error) {
+	if class == sqltypes.Uint64 {
+		if result.Sign() < 0 || !result.IsUint64() {
+			return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "BIGINT UNSIGNED value is out of range in '%s %s %s'", v1.ToString(), op, v2.ToString())
+		}
+		return sqltypes.NewUint64(result.Uint64()), nil
+	}
+	if !result.IsInt64() {
+		return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "BIGINT value is out of range in '%s %s %s'", v1.ToString(), op, v2.ToString())
+	}
+	return sqltypes.NewInt64(result.Int64()), nil
+}
+
+// decimalValue formats r as a Decimal with the specified scale.
+// Like in MySQL, the last digit is rounded half away from zero.
+func decimalValue(r *big.Rat, scale int) sqltypes.Value {
+	if scale > maxScale {
+		scale = maxScale
+	}
+	return sqltypes.MakeTrusted(sqltypes.Decimal, []byte(r.FloatString(scale)))
+}
+
+// compareValues compares two non-NULL values and returns 0 if v1==v2,
+// -1 if v1<v2, and 1 if v1>v2. If none of the values is a number, they
+// are compared as binary strings, which is only correct if one of them
+// is binary or a date: two text values fail, because their collation
+// may make different bytes equal. Otherwise, they're compared as numbers:
+// integers and decimals are compared exactly, and all other combinations
+// are compared as floats.
+func compareValues(v1, v2 sqltypes.Value) (int, error) {
+	if !isNumber(v1.Type()) && !isNumber(v2.Type()) {
+		if !isByteComparable(v1) && !isByteComparable(v2) {
+			return 0, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "types are not comparable: %v vs %v", v1.Type(), v2.Type())
+		}
+		return bytes.Compare(v1.ToBytes(), v2.ToBytes()), nil
+	}
+	n1, err := newNumeric(v1)
+	if err != nil {
+		return 0, err
+	}
+	n2, err := newNumeric(v2)
+	if err != nil {
+		return 0, err
+	}
+	switch resultClass(n1.typ, n2.typ) {
+	case sqltypes.Float64:
+		f1, f2 := n1.toFloat(), n2.toFloat()
+		switch {
+		case f1 < f2:
+			return -1, nil
+		case f1 > f2:
+			return 1, nil
+		}
+		return 0, nil
+	case sqltypes.Decimal:
+		return n1.toRat().Cmp(n2.toRat()), nil
+	}
+	return n1.toInt().Cmp(n2.toInt()), nil
+}
+
+func isNumber(typ querypb.Type) bool {
+	return sqltypes.IsIntegral(typ) || sqltypes.IsFloat(typ) || typ == sqltypes.Decimal
+}
+
+// isByteComparable returns true if v is binary or a date/time,
+// like in sqltypes.NullsafeCompare.
+func isByteComparable(v sqltypes.Value) bool {
+	if v.IsBinary() {
+		return true
+	}
+	switch v.Type() {
+	case sqltypes.Timestamp, sqltypes.Date, sqltypes.Time, sqltypes.Datetime:
+		return true
+	}
+	return false
+}
+
+// isTrue returns true if v is a non-NULL value different from zero.
+func isTrue(v sqltypes.Value) (bool, error) {
+	if v.IsNull() {
+		return false, nil
+	}
+	n, err := newNumeric(v)
+	if err != nil {
+		return false, err
+	}
+	return !n.isZero(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
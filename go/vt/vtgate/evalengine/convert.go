@@ -0,0 +1,294 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evalengine
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// ColumnResolver returns the offset of the column of the row that
+// contains the value of expr. It's called for column names and for
+// aggregate functions, which cannot be evaluated by the engine.
+type ColumnResolver func(expr sqlparser.Expr) (int, error)
+
+// Convert converts a sqlparser expression into an Expr. It returns
+// an error if the expression contains constructs that cannot be
+// evaluated, or if resolve fails.
+func Convert(expr sqlparser.Expr, resolve ColumnResolver) (Expr, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.ColName:
+		offset, err := resolve(expr)
+		if err != nil {
+			return nil, err
+		}
+		return &Column{Offset: offset}, nil
+	case *sqlparser.SQLVal:
+		return convertSQLVal(expr)
+	case *sqlparser.NullVal:
+		return &Literal{Val: sqltypes.NULL}, nil
+	case sqlparser.BoolVal:
+		return &Literal{Val: boolValue(bool(expr))}, nil
+	case *sqlparser.ParenExpr:
+		return Convert(expr.Expr, resolve)
+	case *sqlparser.AndExpr:
+		left, right, err := convertOperands(expr.Left, expr.Right, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &And{Left: left, Right: right}, nil
+	case *sqlparser.OrExpr:
+		left, right, err := convertOperands(expr.Left, expr.Right, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Or{Left: left, Right: right}, nil
+	case *sqlparser.NotExpr:
+		inner, err := Convert(expr.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: inner}, nil
+	case *sqlparser.ComparisonExpr:
+		return convertComparison(expr, resolve)
+	case *sqlparser.RangeCond:
+		left, err := Convert(expr.Left, resolve)
+		if err != nil {
+			return nil, err
+		}
+		from, to, err := convertOperands(expr.From, expr.To, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Between{Not: expr.Operator == sqlparser.NotBetweenStr, Left: left, From: from, To: to}, nil
+	case *sqlparser.IsExpr:
+		inner, err := Convert(expr.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Is{Op: expr.Operator, Expr: inner}, nil
+	case *sqlparser.BinaryExpr:
+		switch expr.Operator {
+		case sqlparser.PlusStr, sqlparser.MinusStr, sqlparser.MultStr, sqlparser.DivStr, sqlparser.IntDivStr, sqlparser.ModStr:
+			left, right, err := convertOperands(expr.Left, expr.Right, resolve)
+			if err != nil {
+				return nil, err
+			}
+			return &Arithmetic{Op: expr.Operator, Left: left, Right: right}, nil
+		}
+	case *sqlparser.UnaryExpr:
+		switch expr.Operator {
+		case sqlparser.UPlusStr, sqlparser.UMinusStr, sqlparser.BangStr:
+			inner, err := Convert(expr.Expr, resolve)
+			if err != nil {
+				return nil, err
+			}
+			switch expr.Operator {
+			case sqlparser.UMinusStr:
+				return &Negate{Expr: inner}, nil
+			case sqlparser.BangStr:
+				return &Not{Expr: inner}, nil
+			}
+			return inner, nil
+		}
+	case *sqlparser.CaseExpr:
+		return convertCase(expr, resolve)
+	case *sqlparser.FuncExpr:
+		if expr.IsAggregate() {
+			offset, err := resolve(expr)
+			if err != nil {
+				return nil, err
+			}
+			return &Column{Offset: offset}, nil
+		}
+		return convertFunc(expr, resolve)
+	}
+	return nil, unsupportedError(expr)
+}
+
+func unsupportedError(expr sqlparser.SQLNode) error {
+	return fmt.Errorf("unsupported: expression evaluation in vtgate: %s", sqlparser.String(expr))
+}
+
+func convertOperands(left, right sqlparser.Expr, resolve ColumnResolver) (Expr, Expr, error) {
+	l, err := Convert(left, resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := Convert(right, resolve)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, r, nil
+}
+
+// convertSQLVal converts a literal. Like in MySQL, a number with a
+// decimal point is a Decimal, and it's a Float64 only if it has an
+// exponent.
+func convertSQLVal(val *sqlparser.SQLVal) (Expr, error) {
+	switch val.Type {
+	case sqlparser.StrVal:
+		return &Literal{Val: sqltypes.MakeTrusted(sqltypes.VarChar, val.Val)}, nil
+	case sqlparser.IntVal:
+		if ival, err := strconv.ParseInt(string(val.Val), 10, 64); err == nil {
+			return &Literal{Val: sqltypes.NewInt64(ival)}, nil
+		}
+		if uval, err := strconv.ParseUint(string(val.Val), 10, 64); err == nil {
+			return &Literal{Val: sqltypes.NewUint64(uval)}, nil
+		}
+		// The value overflows 64 bits.
+		return &Literal{Val: sqltypes.MakeTrusted(sqltypes.Decimal, val.Val)}, nil
+	case sqlparser.FloatVal:
+		if bytes.ContainsAny(val.Val, "eE") {
+			fval, err := strconv.ParseFloat(string(val.Val), 64)
+			if err != nil {
+				return nil, err
+			}
+			return &Literal{Val: sqltypes.NewFloat64(fval)}, nil
+		}
+		return &Literal{Val: sqltypes.MakeTrusted(sqltypes.Decimal, val.Val)}, nil
+	case sqlparser.HexVal:
+		v, err := val.HexDecode()
+		if err != nil {
+			return nil, err
+		}
+		return &Literal{Val: sqltypes.MakeTrusted(sqltypes.VarBinary, v)}, nil
+	case sqlparser.HexNum:
+		// Skip the 0x prefix.
+		digits := val.Val[2:]
+		if len(digits)%2 != 0 {
+			digits = append([]byte{'0'}, digits...)
+		}
+		v := make([]byte, hex.DecodedLen(len(digits)))
+		if _, err := hex.Decode(v, digits); err != nil {
+			return nil, err
+		}
+		return &Literal{Val: sqltypes.MakeTrusted(sqltypes.VarBinary, v)}, nil
+	case sqlparser.ValArg:
+		// Skip the ':' prefix.
+		return &BindVariable{Key: string(val.Val[1:])}, nil
+	}
+	return nil, unsupportedError(val)
+}
+
+// comparisonOperators lists the operators
+// that are converted to a Comparison.
+var comparisonOperators = map[string]bool{
+	sqlparser.EqualStr:         true,
+	sqlparser.NotEqualStr:      true,
+	sqlparser.NullSafeEqualStr: true,
+	sqlparser.LessThanStr:      true,
+	sqlparser.LessEqualStr:     true,
+	sqlparser.GreaterThanStr:   true,
+	sqlparser.GreaterEqualStr:  true,
+}
+
+func convertComparison(expr *sqlparser.ComparisonExpr, resolve ColumnResolver) (Expr, error) {
+	switch {
+	case comparisonOperators[expr.Operator]:
+		left, right, err := convertOperands(expr.Left, expr.Right, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Comparison{Op: expr.Operator, Left: left, Right: right}, nil
+	case expr.Operator == sqlparser.InStr || expr.Operator == sqlparser.NotInStr:
+		tuple, ok := expr.Right.(sqlparser.ValTuple)
+		if !ok {
+			break
+		}
+		left, err := Convert(expr.Left, resolve)
+		if err != nil {
+			return nil, err
+		}
+		in := &In{Not: expr.Operator == sqlparser.NotInStr, Left: left}
+		for _, item := range tuple {
+			converted, err := Convert(item, resolve)
+			if err != nil {
+				return nil, err
+			}
+			in.List = append(in.List, converted)
+		}
+		return in, nil
+	case expr.Operator == sqlparser.LikeStr || expr.Operator == sqlparser.NotLikeStr:
+		escape := byte('\\')
+		if expr.Escape != nil {
+			val, ok := expr.Escape.(*sqlparser.SQLVal)
+			if !ok || val.Type != sqlparser.StrVal || len(val.Val) != 1 {
+				break
+			}
+			escape = val.Val[0]
+		}
+		left, pattern, err := convertOperands(expr.Left, expr.Right, resolve)
+		if err != nil {
+			return nil, err
+		}
+		return &Like{Not: expr.Operator == sqlparser.NotLikeStr, Left: left, Pattern: pattern, Escape: escape}, nil
+	}
+	return nil, unsupportedError(expr)
+}
+
+func convertCase(expr *sqlparser.CaseExpr, resolve ColumnResolver) (Expr, error) {
+	result := &Case{}
+	var err error
+	if expr.Expr != nil {
+		if result.Expr, err = Convert(expr.Expr, resolve); err != nil {
+			return nil, err
+		}
+	}
+	for _, when := range expr.Whens {
+		cond, val, err := convertOperands(when.Cond, when.Val, resolve)
+		if err != nil {
+			return nil, err
+		}
+		result.Whens = append(result.Whens, When{Cond: cond, Val: val})
+	}
+	if expr.Else != nil {
+		if result.Else, err = Convert(expr.Else, resolve); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func convertFunc(expr *sqlparser.FuncExpr, resolve ColumnResolver) (Expr, error) {
+	name := expr.Name.Lowered()
+	fn, ok := functions[name]
+	if !ok || !expr.Qualifier.IsEmpty() || expr.Distinct {
+		return nil, unsupportedError(expr)
+	}
+	if len(expr.Exprs) < fn.minArgs || (fn.maxArgs != -1 && len(expr.Exprs) > fn.maxArgs) {
+		return nil, fmt.Errorf("incorrect parameter count in the call to native function '%s'", name)
+	}
+	result := &Func{Name: name}
+	for _, arg := range expr.Exprs {
+		aliased, ok := arg.(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, unsupportedError(expr)
+		}
+		converted, err := Convert(aliased.Expr, resolve)
+		if err != nil {
+			return nil, err
+		}
+		result.Args = append(result.Args, converted)
+	}
+	return result, nil
+}
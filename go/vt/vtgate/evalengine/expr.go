@@ -0,0 +1,771 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package evalengine evaluates SQL expressions against the rows
+// that vtgate receives from the tablets. It's used for the parts of
+// a query that cannot be pushed down to MySQL, like conditions on
+// the results of a cross-shard aggregation or a cross-shard join.
+//
+// The evaluation follows the MySQL type coercion rules: a NULL operand
+// produces NULL, strings are converted to numbers by arithmetic operators,
+// and integer arithmetic fails on overflow. Collations are not supported:
+// strings are compared as binary strings, and comparing two text values
+// fails.
+package evalengine
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// ExpressionEnv is the environment in which an expression is evaluated.
+type ExpressionEnv struct {
+	// BindVars are the bind variables of the query.
+	BindVars map[string]*querypb.BindVariable
+	// Fields describes the columns of Row.
+	Fields []*querypb.Field
+	// Row is the row for which the expression is evaluated.
+	Row []sqltypes.Value
+}
+
+// Expr is an expression that can be evaluated by vtgate.
+type Expr interface {
+	// Evaluate returns the value of the expression for env.Row.
+	Evaluate(env ExpressionEnv) (sqltypes.Value, error)
+	// Type returns the type of the values returned by Evaluate.
+	// Only the bind variables and the fields of env are used.
+	Type(env ExpressionEnv) querypb.Type
+	// String returns the representation of the expression
+	// that is used to display plans.
+	String() string
+}
+
+// EvaluateBool evaluates expr and returns true if the result is
+// neither NULL nor zero, which is how MySQL evaluates a condition.
+func EvaluateBool(expr Expr, env ExpressionEnv) (bool, error) {
+	v, err := expr.Evaluate(env)
+	if err != nil {
+		return false, err
+	}
+	return isTrue(v)
+}
+
+var (
+	_ Expr = (*Literal)(nil)
+	_ Expr = (*BindVariable)(nil)
+	_ Expr = (*Column)(nil)
+	_ Expr = (*Arithmetic)(nil)
+	_ Expr = (*Negate)(nil)
+	_ Expr = (*Comparison)(nil)
+	_ Expr = (*In)(nil)
+	_ Expr = (*Between)(nil)
+	_ Expr = (*Like)(nil)
+	_ Expr = (*And)(nil)
+	_ Expr = (*Or)(nil)
+	_ Expr = (*Not)(nil)
+	_ Expr = (*Is)(nil)
+	_ Expr = (*Case)(nil)
+	_ Expr = (*Func)(nil)
+)
+
+func boolValue(b bool) sqltypes.Value {
+	if b {
+		return sqltypes.NewInt64(1)
+	}
+	return sqltypes.NewInt64(0)
+}
+
+// boolean is the result of a condition, which can be NULL.
+type boolean int
+
+const (
+	boolFalse = boolean(iota)
+	boolTrue
+	boolNull
+)
+
+func toBoolean(b bool) boolean {
+	if b {
+		return boolTrue
+	}
+	return boolFalse
+}
+
+func (b boolean) value() sqltypes.Value {
+	if b == boolNull {
+		return sqltypes.NULL
+	}
+	return boolValue(b == boolTrue)
+}
+
+func and(b1, b2 boolean) boolean {
+	switch {
+	case b1 == boolFalse || b2 == boolFalse:
+		return boolFalse
+	case b1 == boolNull || b2 == boolNull:
+		return boolNull
+	}
+	return boolTrue
+}
+
+func not(b boolean) boolean {
+	switch b {
+	case boolTrue:
+		return boolFalse
+	case boolFalse:
+		return boolTrue
+	}
+	return boolNull
+}
+
+// Literal is a constant value.
+type Literal struct {
+	Val sqltypes.Value
+}
+
+// Evaluate satisfies the Expr interface.
+func (l *Literal) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	return l.Val, nil
+}
+
+// Type satisfies the Expr interface.
+func (l *Literal) Type(env ExpressionEnv) querypb.Type {
+	return l.Val.Type()
+}
+
+func (l *Literal) String() string {
+	buf := &bytes.Buffer{}
+	l.Val.EncodeSQL(buf)
+	return buf.String()
+}
+
+// BindVariable is the value of a bind variable of the query.
+type BindVariable struct {
+	Key string
+}
+
+// Evaluate satisfies the Expr interface.
+func (bv *BindVariable) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	val, ok := env.BindVars[bv.Key]
+	if !ok {
+		return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "missing bind var %s", bv.Key)
+	}
+	return sqltypes.BindVariableToValue(val)
+}
+
+// Type satisfies the Expr interface.
+func (bv *BindVariable) Type(env ExpressionEnv) querypb.Type {
+	if val, ok := env.BindVars[bv.Key]; ok {
+		return val.Type
+	}
+	return sqltypes.Null
+}
+
+func (bv *BindVariable) String() string {
+	return ":" + bv.Key
+}
+
+// Column is the value of a column of the row.
+type Column struct {
+	Offset int
+}
+
+// Evaluate satisfies the Expr interface.
+func (c *Column) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	return env.Row[c.Offset], nil
+}
+
+// Type satisfies the Expr interface.
+func (c *Column) Type(env ExpressionEnv) querypb.Type {
+	if c.Offset < len(env.Fields) {
+		return env.Fields[c.Offset].Type
+	}
+	return sqltypes.Null
+}
+
+func (c *Column) String() string {
+	return fmt.Sprintf("[COLUMN %d]", c.Offset)
+}
+
+// Arithmetic is a binary arithmetic operation. Op is one of
+// the sqlparser operators +, -, *, /, div and %.
+type Arithmetic struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (a *Arithmetic) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v1, v2, err := evaluateOperands(env, a.Left, a.Right)
+	if err != nil || v1.IsNull() || v2.IsNull() {
+		return sqltypes.NULL, err
+	}
+	return arithmetic(a.Op, v1, v2)
+}
+
+// Type satisfies the Expr interface.
+func (a *Arithmetic) Type(env ExpressionEnv) querypb.Type {
+	return arithmeticType(a.Op, a.Left.Type(env), a.Right.Type(env))
+}
+
+func (a *Arithmetic) String() string {
+	return formatBinary(a.Left, a.Op, a.Right)
+}
+
+// Negate is the unary minus.
+type Negate struct {
+	Expr Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (n *Negate) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v, err := n.Expr.Evaluate(env)
+	if err != nil || v.IsNull() {
+		return sqltypes.NULL, err
+	}
+	return negate(v)
+}
+
+// Type satisfies the Expr interface.
+func (n *Negate) Type(env ExpressionEnv) querypb.Type {
+	class := numericClass(n.Expr.Type(env))
+	if class == sqltypes.Uint64 || class == sqltypes.Null {
+		return sqltypes.Int64
+	}
+	return class
+}
+
+func (n *Negate) String() string {
+	return "-" + formatOperand(n.Expr)
+}
+
+// Comparison compares two values. Op is one of the sqlparser
+// operators =, !=, <, <=, >, >= and <=>. The result is NULL if
+// one of the operands is NULL, except for <=>.
+type Comparison struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (c *Comparison) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v1, v2, err := evaluateOperands(env, c.Left, c.Right)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	if v1.IsNull() || v2.IsNull() {
+		if c.Op == sqlparser.NullSafeEqualStr {
+			return boolValue(v1.IsNull() && v2.IsNull()), nil
+		}
+		return sqltypes.NULL, nil
+	}
+	cmp, err := compareValues(v1, v2)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	switch c.Op {
+	case sqlparser.EqualStr, sqlparser.NullSafeEqualStr:
+		return boolValue(cmp == 0), nil
+	case sqlparser.NotEqualStr:
+		return boolValue(cmp != 0), nil
+	case sqlparser.LessThanStr:
+		return boolValue(cmp < 0), nil
+	case sqlparser.LessEqualStr:
+		return boolValue(cmp <= 0), nil
+	case sqlparser.GreaterThanStr:
+		return boolValue(cmp > 0), nil
+	case sqlparser.GreaterEqualStr:
+		return boolValue(cmp >= 0), nil
+	}
+	return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: unexpected comparison operator: %s", c.Op)
+}
+
+// Type satisfies the Expr interface.
+func (c *Comparison) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (c *Comparison) String() string {
+	return formatBinary(c.Left, c.Op, c.Right)
+}
+
+// In checks if a value is equal to one of the values of a list.
+type In struct {
+	Not  bool
+	Left Expr
+	List []Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (in *In) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v, err := in.Left.Evaluate(env)
+	if err != nil || v.IsNull() {
+		return sqltypes.NULL, err
+	}
+	hasNull := false
+	for _, expr := range in.List {
+		item, err := expr.Evaluate(env)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		if item.IsNull() {
+			hasNull = true
+			continue
+		}
+		cmp, err := compareValues(v, item)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		if cmp == 0 {
+			return boolValue(!in.Not), nil
+		}
+	}
+	if hasNull {
+		return sqltypes.NULL, nil
+	}
+	return boolValue(in.Not), nil
+}
+
+// Type satisfies the Expr interface.
+func (in *In) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (in *In) String() string {
+	items := make([]string, len(in.List))
+	for i, expr := range in.List {
+		items[i] = expr.String()
+	}
+	op := sqlparser.InStr
+	if in.Not {
+		op = sqlparser.NotInStr
+	}
+	return fmt.Sprintf("%s %s (%s)", formatOperand(in.Left), op, strings.Join(items, ", "))
+}
+
+// Between checks if a value is within an inclusive range.
+type Between struct {
+	Not      bool
+	Left     Expr
+	From, To Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (b *Between) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v, err := b.Left.Evaluate(env)
+	if err != nil || v.IsNull() {
+		return sqltypes.NULL, err
+	}
+	from, to, err := evaluateOperands(env, b.From, b.To)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	// This is evaluated as (v >= from AND v <= to).
+	lower, err := compareBound(v, from, 1)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	upper, err := compareBound(v, to, -1)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	result := and(lower, upper)
+	if b.Not {
+		result = not(result)
+	}
+	return result.value(), nil
+}
+
+// compareBound returns true if v is on the side of bound specified
+// by direction, or equal to it. It returns NULL if bound is NULL.
+func compareBound(v, bound sqltypes.Value, direction int) (boolean, error) {
+	if bound.IsNull() {
+		return boolNull, nil
+	}
+	cmp, err := compareValues(v, bound)
+	if err != nil {
+		return boolNull, err
+	}
+	return toBoolean(cmp == 0 || cmp == direction), nil
+}
+
+// Type satisfies the Expr interface.
+func (b *Between) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (b *Between) String() string {
+	op := sqlparser.BetweenStr
+	if b.Not {
+		op = sqlparser.NotBetweenStr
+	}
+	return fmt.Sprintf("%s %s %s and %s", formatOperand(b.Left), op, formatOperand(b.From), formatOperand(b.To))
+}
+
+// Like matches a value against a pattern, in which '%' matches any
+// sequence of characters and '_' matches a single character. Escape
+// is the character that makes the next character match literally.
+// The match is case sensitive, so it fails if both operands are text,
+// whose collation may not be.
+type Like struct {
+	Not           bool
+	Left, Pattern Expr
+	Escape        byte
+}
+
+// Evaluate satisfies the Expr interface.
+func (l *Like) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v, pattern, err := evaluateOperands(env, l.Left, l.Pattern)
+	if err != nil || v.IsNull() || pattern.IsNull() {
+		return sqltypes.NULL, err
+	}
+	if v.IsText() && pattern.IsText() {
+		return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "LIKE is not supported on text values: %v like %v", v.Type(), pattern.Type())
+	}
+	return boolValue(matchLike([]rune(v.ToString()), []rune(pattern.ToString()), rune(l.Escape)) != l.Not), nil
+}
+
+// matchLike returns true if str matches pattern.
+func matchLike(str, pattern []rune, escape rune) bool {
+	for len(pattern) > 0 {
+		switch c := pattern[0]; {
+		case c == '%':
+			// Collapse consecutive wildcards, and try every
+			// possible length for the matched sequence.
+			for len(pattern) > 0 && pattern[0] == '%' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if matchLike(str[i:], pattern, escape) {
+					return true
+				}
+			}
+			return false
+		case c == '_':
+			if len(str) == 0 {
+				return false
+			}
+		default:
+			if c == escape && len(pattern) > 1 {
+				pattern = pattern[1:]
+				c = pattern[0]
+			}
+			if len(str) == 0 || str[0] != c {
+				return false
+			}
+		}
+		str, pattern = str[1:], pattern[1:]
+	}
+	return len(str) == 0
+}
+
+// Type satisfies the Expr interface.
+func (l *Like) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (l *Like) String() string {
+	op := sqlparser.LikeStr
+	if l.Not {
+		op = sqlparser.NotLikeStr
+	}
+	return formatBinary(l.Left, op, l.Pattern)
+}
+
+// And is the logical AND. It returns false if one of the
+// operands is false, and NULL if one of them is NULL.
+type And struct {
+	Left, Right Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (a *And) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	b1, b2, err := evaluateLogicalOperands(env, a.Left, a.Right)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	return and(b1, b2).value(), nil
+}
+
+// Type satisfies the Expr interface.
+func (a *And) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (a *And) String() string {
+	return formatBinary(a.Left, "and", a.Right)
+}
+
+// Or is the logical OR. It returns true if one of the
+// operands is true, and NULL if one of them is NULL.
+type Or struct {
+	Left, Right Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (o *Or) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	b1, b2, err := evaluateLogicalOperands(env, o.Left, o.Right)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	return not(and(not(b1), not(b2))).value(), nil
+}
+
+// Type satisfies the Expr interface.
+func (o *Or) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (o *Or) String() string {
+	return formatBinary(o.Left, "or", o.Right)
+}
+
+// Not is the logical NOT.
+type Not struct {
+	Expr Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (n *Not) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	b, err := evaluateLogical(env, n.Expr)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	return not(b).value(), nil
+}
+
+// Type satisfies the Expr interface.
+func (n *Not) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (n *Not) String() string {
+	return "not " + formatOperand(n.Expr)
+}
+
+// evaluateLogical evaluates expr as a condition.
+func evaluateLogical(env ExpressionEnv, expr Expr) (boolean, error) {
+	v, err := expr.Evaluate(env)
+	if err != nil || v.IsNull() {
+		return boolNull, err
+	}
+	b, err := isTrue(v)
+	if err != nil {
+		return boolNull, err
+	}
+	return toBoolean(b), nil
+}
+
+func evaluateLogicalOperands(env ExpressionEnv, left, right Expr) (boolean, boolean, error) {
+	b1, err := evaluateLogical(env, left)
+	if err != nil {
+		return boolNull, boolNull, err
+	}
+	b2, err := evaluateLogical(env, right)
+	if err != nil {
+		return boolNull, boolNull, err
+	}
+	return b1, b2, nil
+}
+
+// Is tests a value against NULL, true or false. Op is one
+// of the sqlparser IS operators. The result is never NULL.
+type Is struct {
+	Op   string
+	Expr Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (is *Is) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	v, err := is.Expr.Evaluate(env)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	b, err := isTrue(v)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	switch is.Op {
+	case sqlparser.IsNullStr:
+		return boolValue(v.IsNull()), nil
+	case sqlparser.IsNotNullStr:
+		return boolValue(!v.IsNull()), nil
+	case sqlparser.IsTrueStr:
+		return boolValue(b), nil
+	case sqlparser.IsNotTrueStr:
+		return boolValue(!b), nil
+	case sqlparser.IsFalseStr:
+		return boolValue(!v.IsNull() && !b), nil
+	case sqlparser.IsNotFalseStr:
+		return boolValue(v.IsNull() || b), nil
+	}
+	return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: unexpected is operator: %s", is.Op)
+}
+
+// Type satisfies the Expr interface.
+func (is *Is) Type(env ExpressionEnv) querypb.Type {
+	return sqltypes.Int64
+}
+
+func (is *Is) String() string {
+	return formatOperand(is.Expr) + " " + is.Op
+}
+
+// Case is the CASE expression. If Expr is set, the value of each
+// When.Cond is compared with it. Otherwise, each When.Cond is
+// evaluated as a condition. The result is the Val of the first
+// matching When, or Else. Else can be nil, which produces NULL.
+type Case struct {
+	Expr  Expr
+	Whens []When
+	Else  Expr
+}
+
+// When is a WHEN clause of a CASE expression.
+type When struct {
+	Cond, Val Expr
+}
+
+// Evaluate satisfies the Expr interface.
+func (c *Case) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	var base sqltypes.Value
+	if c.Expr != nil {
+		var err error
+		if base, err = c.Expr.Evaluate(env); err != nil {
+			return sqltypes.NULL, err
+		}
+	}
+	for _, when := range c.Whens {
+		cond, err := when.Cond.Evaluate(env)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		var match bool
+		switch {
+		case c.Expr == nil:
+			if match, err = isTrue(cond); err != nil {
+				return sqltypes.NULL, err
+			}
+		case !base.IsNull() && !cond.IsNull():
+			cmp, err := compareValues(base, cond)
+			if err != nil {
+				return sqltypes.NULL, err
+			}
+			match = cmp == 0
+		}
+		if match {
+			return when.Val.Evaluate(env)
+		}
+	}
+	if c.Else == nil {
+		return sqltypes.NULL, nil
+	}
+	return c.Else.Evaluate(env)
+}
+
+// Type satisfies the Expr interface.
+func (c *Case) Type(env ExpressionEnv) querypb.Type {
+	types := make([]querypb.Type, 0, len(c.Whens)+1)
+	for _, when := range c.Whens {
+		types = append(types, when.Val.Type(env))
+	}
+	if c.Else != nil {
+		types = append(types, c.Else.Type(env))
+	}
+	return aggregateTypes(types)
+}
+
+func (c *Case) String() string {
+	buf := &bytes.Buffer{}
+	buf.WriteString("case")
+	if c.Expr != nil {
+		fmt.Fprintf(buf, " %s", c.Expr)
+	}
+	for _, when := range c.Whens {
+		fmt.Fprintf(buf, " when %s then %s", when.Cond, when.Val)
+	}
+	if c.Else != nil {
+		fmt.Fprintf(buf, " else %s", c.Else)
+	}
+	buf.WriteString(" end")
+	return buf.String()
+}
+
+// aggregateTypes returns the type that can represent values of all the
+// specified types, which is used for the result of expressions like CASE.
+// NULL is ignored. Different numeric types are widened, and any other
+// mix produces a string.
+func aggregateTypes(types []querypb.Type) querypb.Type {
+	result := sqltypes.Null
+	for _, typ := range types {
+		switch {
+		case typ == sqltypes.Null || typ == result:
+			continue
+		case result == sqltypes.Null:
+			result = typ
+		case isNumber(result) && isNumber(typ):
+			c1, c2 := numericClass(result), numericClass(typ)
+			if c1 == c2 || c1 == sqltypes.Float64 || c2 == sqltypes.Float64 {
+				result = resultClass(c1, c2)
+			} else {
+				// Mixing signed and unsigned integers requires a decimal.
+				result = sqltypes.Decimal
+			}
+		case sqltypes.IsBinary(result) || sqltypes.IsBinary(typ):
+			result = sqltypes.VarBinary
+		default:
+			result = sqltypes.VarChar
+		}
+	}
+	return result
+}
+
+func evaluateOperands(env ExpressionEnv, left, right Expr) (sqltypes.Value, sqltypes.Value, error) {
+	v1, err := left.Evaluate(env)
+	if err != nil {
+		return sqltypes.NULL, sqltypes.NULL, err
+	}
+	v2, err := right.Evaluate(env)
+	if err != nil {
+		return sqltypes.NULL, sqltypes.NULL, err
+	}
+	return v1, v2, nil
+}
+
+func formatBinary(left Expr, op string, right Expr) string {
+	return fmt.Sprintf("%s %s %s", formatOperand(left), op, formatOperand(right))
+}
+
+// formatOperand parenthesizes the expressions that
+// could otherwise be displayed ambiguously.
+func formatOperand(expr Expr) string {
+	switch expr.(type) {
+	case *Literal, *BindVariable, *Column, *Func, *Case:
+		return expr.String()
+	}
+	return "(" + expr.String() + ")"
+}
@@ -0,0 +1,494 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evalengine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// testEnv contains a row with one column for each of the
+// column names i, u, f, d, s, b, n.
+var testEnv = ExpressionEnv{
+	BindVars: map[string]*querypb.BindVariable{
+		"bv": sqltypes.Int64BindVariable(7),
+	},
+	Fields: []*querypb.Field{
+		{Name: "i", Type: sqltypes.Int64},
+		{Name: "u", Type: sqltypes.Uint64},
+		{Name: "f", Type: sqltypes.Float64},
+		{Name: "d", Type: sqltypes.Decimal},
+		{Name: "s", Type: sqltypes.VarChar},
+		{Name: "b", Type: sqltypes.VarBinary},
+		{Name: "n", Type: sqltypes.Int64},
+	},
+	Row: []sqltypes.Value{
+		sqltypes.NewInt64(-3),
+		sqltypes.NewUint64(10),
+		sqltypes.NewFloat64(2.5),
+		sqltypes.MakeTrusted(sqltypes.Decimal, []byte("1.25")),
+		sqltypes.NewVarChar("12abc"),
+		sqltypes.NewVarBinary("Bin"),
+		sqltypes.NULL,
+	},
+}
+
+func resolveTestColumn(expr sqlparser.Expr) (int, error) {
+	name := sqlparser.String(expr)
+	for i, field := range testEnv.Fields {
+		if field.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown column: %s", name)
+}
+
+func convertTestExpr(t *testing.T, in string) Expr {
+	t.Helper()
+	stmt, err := sqlparser.Parse("select " + in + " from t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expr := stmt.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr
+	converted, err := Convert(expr, resolveTestColumn)
+	if err != nil {
+		t.Fatalf("Convert(%s): %v", in, err)
+	}
+	return converted
+}
+
+func TestEvaluate(t *testing.T) {
+	testcases := []struct {
+		in      string
+		out     string
+		outType querypb.Type
+	}{{
+		// Literals and columns.
+		in:      "1.50",
+		out:     "DECIMAL(1.50)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "1.5e1",
+		out:     "FLOAT64(15)",
+		outType: sqltypes.Float64,
+	}, {
+		in:      "18446744073709551615",
+		out:     "UINT64(18446744073709551615)",
+		outType: sqltypes.Uint64,
+	}, {
+		in:      "x'616263'",
+		out:     "VARBINARY(\"abc\")",
+		outType: sqltypes.VarBinary,
+	}, {
+		in:      ":bv",
+		out:     "INT64(7)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "s",
+		out:     "VARCHAR(\"12abc\")",
+		outType: sqltypes.VarChar,
+	}, {
+		// Arithmetic.
+		in:      "i + 1",
+		out:     "INT64(-2)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "u - 4",
+		out:     "UINT64(6)",
+		outType: sqltypes.Uint64,
+	}, {
+		in:      "i * f",
+		out:     "FLOAT64(-7.5)",
+		outType: sqltypes.Float64,
+	}, {
+		in:      "d + 1.5",
+		out:     "DECIMAL(2.75)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "d * d",
+		out:     "DECIMAL(1.5625)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "7 / 2",
+		out:     "DECIMAL(3.5000)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "d / 3",
+		out:     "DECIMAL(0.416667)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "7 div 2",
+		out:     "INT64(3)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "i % 2",
+		out:     "INT64(-1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "1 / 0",
+		out:     "NULL",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "s + 1",
+		out:     "FLOAT64(13)",
+		outType: sqltypes.Float64,
+	}, {
+		in:      "n + 1",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "-i",
+		out:     "INT64(3)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "-d",
+		out:     "DECIMAL(-1.25)",
+		outType: sqltypes.Decimal,
+	}, {
+		// Comparisons.
+		in:      "i < u",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "s = 12",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b = 'Bin'",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b = 'bin'",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "d >= 1.25",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n = 1",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n <=> null",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "i in (1, -3)",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "i not in (1, null)",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "f between 2 and 3",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "f not between 3 and null",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b like 'B%'",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b like '_i_'",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b like 'bin'",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b like 'B\\\\%'",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "i like '-3'",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "b not like '%b'",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		// Logical operators.
+		in:      "n = 1 and i = 0",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n = 1 and i = -3",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n = 1 or i = -3",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "not (n = 1)",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n is null",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "n is not true",
+		out:     "INT64(1)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "i is false",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		// Case.
+		in:      "case when i > 0 then 'pos' when i < 0 then 'neg' end",
+		out:     "VARCHAR(\"neg\")",
+		outType: sqltypes.VarChar,
+	}, {
+		in:      "case i when 1 then 1 else 2.5 end",
+		out:     "DECIMAL(2.5)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "case n when null then 1 end",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		// Functions.
+		in:      "ifnull(n, 0)",
+		out:     "INT64(0)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "coalesce(n, null, s)",
+		out:     "VARCHAR(\"12abc\")",
+		outType: sqltypes.VarChar,
+	}, {
+		in:      "nullif(i, -3)",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "if(n, 1, 2)",
+		out:     "INT64(2)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "greatest(i, u, 5)",
+		out:     "UINT64(10)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "least(i, n)",
+		out:     "NULL",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "abs(i)",
+		out:     "INT64(3)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "ceil(d)",
+		out:     "DECIMAL(2)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "floor(-d)",
+		out:     "DECIMAL(-2)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "round(d, 1)",
+		out:     "DECIMAL(1.3)",
+		outType: sqltypes.Decimal,
+	}, {
+		in:      "round(f)",
+		out:     "FLOAT64(2)",
+		outType: sqltypes.Float64,
+	}, {
+		in:      "round(1234, -2)",
+		out:     "INT64(1200)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "mod(u, 3)",
+		out:     "UINT64(1)",
+		outType: sqltypes.Uint64,
+	}, {
+		in:      "concat(s, '-', i)",
+		out:     "VARCHAR(\"12abc--3\")",
+		outType: sqltypes.VarChar,
+	}, {
+		in:      "concat(s, n)",
+		out:     "NULL",
+		outType: sqltypes.VarChar,
+	}, {
+		in:      "upper(s)",
+		out:     "VARCHAR(\"12ABC\")",
+		outType: sqltypes.VarChar,
+	}, {
+		in:      "lower(b)",
+		out:     "VARBINARY(\"Bin\")",
+		outType: sqltypes.VarBinary,
+	}, {
+		in:      "char_length('añb')",
+		out:     "INT64(3)",
+		outType: sqltypes.Int64,
+	}, {
+		in:      "length('añb')",
+		out:     "INT64(4)",
+		outType: sqltypes.Int64,
+	}}
+	for _, tcase := range testcases {
+		expr := convertTestExpr(t, tcase.in)
+		got, err := expr.Evaluate(testEnv)
+		if err != nil {
+			t.Errorf("Evaluate(%s): %v", tcase.in, err)
+			continue
+		}
+		if got.String() != tcase.out {
+			t.Errorf("Evaluate(%s): %v, want %s", tcase.in, got, tcase.out)
+		}
+		if typ := expr.Type(testEnv); typ != tcase.outType {
+			t.Errorf("Type(%s): %v, want %v", tcase.in, typ, tcase.outType)
+		}
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	testcases := []struct {
+		in  string
+		out string
+	}{{
+		in:  "9223372036854775807 + 1",
+		out: "BIGINT value is out of range in '9223372036854775807 + 1'",
+	}, {
+		in:  "u - 11",
+		out: "BIGINT UNSIGNED value is out of range in '10 - 11'",
+	}, {
+		in:  ":missing",
+		out: "missing bind var missing",
+	}, {
+		// Text values may have a case insensitive collation.
+		in:  "s = '12'",
+		out: "types are not comparable: VARCHAR vs VARCHAR",
+	}, {
+		in:  "s in ('a', 'b')",
+		out: "types are not comparable: VARCHAR vs VARCHAR",
+	}, {
+		in:  "s like '12%'",
+		out: "LIKE is not supported on text values: VARCHAR like VARCHAR",
+	}}
+	for _, tcase := range testcases {
+		_, err := convertTestExpr(t, tcase.in).Evaluate(testEnv)
+		if err == nil || err.Error() != tcase.out {
+			t.Errorf("Evaluate(%s): %v, want %s", tcase.in, err, tcase.out)
+		}
+	}
+}
+
+func TestEvaluateBool(t *testing.T) {
+	testcases := []struct {
+		in  string
+		out bool
+	}{
+		{in: "i", out: true},
+		{in: "n", out: false},
+		{in: "0.0", out: false},
+		{in: "'abc'", out: false},
+		{in: "s", out: true},
+	}
+	for _, tcase := range testcases {
+		got, err := EvaluateBool(convertTestExpr(t, tcase.in), testEnv)
+		if err != nil {
+			t.Errorf("EvaluateBool(%s): %v", tcase.in, err)
+			continue
+		}
+		if got != tcase.out {
+			t.Errorf("EvaluateBool(%s): %v, want %v", tcase.in, got, tcase.out)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	testcases := []struct {
+		in  string
+		out string
+	}{{
+		in:  "(i + 1) * 2 > :bv and s is not null",
+		out: "((([COLUMN 0] + 1) * 2) > :bv) and ([COLUMN 4] is not null)",
+	}, {
+		in:  "case when i in (1, 2) then lower(s) else 'x' end",
+		out: "case when [COLUMN 0] in (1, 2) then lower([COLUMN 4]) else 'x' end",
+	}, {
+		in:  "count(*) >= 1.5",
+		out: "[COLUMN 6] >= 1.5",
+	}}
+	for _, tcase := range testcases {
+		stmt, err := sqlparser.Parse("select " + tcase.in + " from t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := stmt.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr
+		got, err := Convert(expr, func(expr sqlparser.Expr) (int, error) {
+			if _, ok := expr.(*sqlparser.FuncExpr); ok {
+				return 6, nil
+			}
+			return resolveTestColumn(expr)
+		})
+		if err != nil {
+			t.Errorf("Convert(%s): %v", tcase.in, err)
+			continue
+		}
+		if got.String() != tcase.out {
+			t.Errorf("Convert(%s): %s, want %s", tcase.in, got, tcase.out)
+		}
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	testcases := []struct {
+		in  string
+		out string
+	}{{
+		in:  "a",
+		out: "unknown column: a",
+	}, {
+		in:  "i & 1",
+		out: "unsupported: expression evaluation in vtgate: i & 1",
+	}, {
+		in:  "i in (select 1 from dual)",
+		out: "unsupported: expression evaluation in vtgate: i in (select 1 from dual)",
+	}, {
+		in:  "substr(s, 1)",
+		out: "unsupported: expression evaluation in vtgate: substr(s, 1)",
+	}, {
+		in:  "ifnull(s)",
+		out: "incorrect parameter count in the call to native function 'ifnull'",
+	}}
+	for _, tcase := range testcases {
+		stmt, err := sqlparser.Parse("select " + tcase.in + " from t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expr := stmt.(*sqlparser.Select).SelectExprs[0].(*sqlparser.AliasedExpr).Expr
+		_, err = Convert(expr, resolveTestColumn)
+		if err == nil || !strings.Contains(err.Error(), tcase.out) {
+			t.Errorf("Convert(%s): %v, want %s", tcase.in, err, tcase.out)
+		}
+	}
+}
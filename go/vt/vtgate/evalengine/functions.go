@@ -0,0 +1,336 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package evalengine
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+// Func is a call to a builtin function.
+// Name is lower case.
+type Func struct {
+	Name string
+	Args []Expr
+}
+
+// function describes a builtin function. Functions that are marked
+// nullable return NULL if any of their arguments is NULL, and their
+// eval function is only called with non-NULL arguments. Arguments
+// that are missing from the call are also passed as NULL.
+type function struct {
+	minArgs, maxArgs int
+	nullable         bool
+	eval             func(args []sqltypes.Value) (sqltypes.Value, error)
+	typ              func(types []querypb.Type) querypb.Type
+}
+
+// functions lists the builtin functions that can be evaluated.
+var functions = map[string]*function{
+	"ifnull":      {minArgs: 2, maxArgs: 2, eval: evalCoalesce, typ: aggregateTypes},
+	"coalesce":    {minArgs: 1, maxArgs: -1, eval: evalCoalesce, typ: aggregateTypes},
+	"nullif":      {minArgs: 2, maxArgs: 2, eval: evalNullif, typ: firstType},
+	"if":          {minArgs: 3, maxArgs: 3, eval: evalIf, typ: ifType},
+	"greatest":    {minArgs: 2, maxArgs: -1, nullable: true, eval: evalGreatest, typ: aggregateTypes},
+	"least":       {minArgs: 2, maxArgs: -1, nullable: true, eval: evalLeast, typ: aggregateTypes},
+	"abs":         {minArgs: 1, maxArgs: 1, nullable: true, eval: evalAbs, typ: numericType},
+	"ceil":        {minArgs: 1, maxArgs: 1, nullable: true, eval: evalCeil, typ: numericType},
+	"ceiling":     {minArgs: 1, maxArgs: 1, nullable: true, eval: evalCeil, typ: numericType},
+	"floor":       {minArgs: 1, maxArgs: 1, nullable: true, eval: evalFloor, typ: numericType},
+	"round":       {minArgs: 1, maxArgs: 2, nullable: true, eval: evalRound, typ: numericType},
+	"mod":         {minArgs: 2, maxArgs: 2, nullable: true, eval: evalMod, typ: modType},
+	"concat":      {minArgs: 1, maxArgs: -1, nullable: true, eval: evalConcat, typ: stringType},
+	"lower":       {minArgs: 1, maxArgs: 1, nullable: true, eval: evalLower, typ: stringType},
+	"lcase":       {minArgs: 1, maxArgs: 1, nullable: true, eval: evalLower, typ: stringType},
+	"upper":       {minArgs: 1, maxArgs: 1, nullable: true, eval: evalUpper, typ: stringType},
+	"ucase":       {minArgs: 1, maxArgs: 1, nullable: true, eval: evalUpper, typ: stringType},
+	"length":      {minArgs: 1, maxArgs: 1, nullable: true, eval: evalLength, typ: int64Type},
+	"char_length": {minArgs: 1, maxArgs: 1, nullable: true, eval: evalCharLength, typ: int64Type},
+}
+
+// Evaluate satisfies the Expr interface.
+func (f *Func) Evaluate(env ExpressionEnv) (sqltypes.Value, error) {
+	fn, ok := functions[f.Name]
+	if !ok {
+		return sqltypes.NULL, vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: unsupported function: %s", f.Name)
+	}
+	n := fn.maxArgs
+	if n == -1 {
+		n = len(f.Args)
+	}
+	args := make([]sqltypes.Value, n)
+	for i, arg := range f.Args {
+		v, err := arg.Evaluate(env)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		if v.IsNull() && fn.nullable {
+			return sqltypes.NULL, nil
+		}
+		args[i] = v
+	}
+	return fn.eval(args)
+}
+
+// Type satisfies the Expr interface.
+func (f *Func) Type(env ExpressionEnv) querypb.Type {
+	fn, ok := functions[f.Name]
+	if !ok {
+		return sqltypes.Null
+	}
+	types := make([]querypb.Type, len(f.Args))
+	for i, arg := range f.Args {
+		types[i] = arg.Type(env)
+	}
+	return fn.typ(types)
+}
+
+func (f *Func) String() string {
+	args := make([]string, len(f.Args))
+	for i, arg := range f.Args {
+		args[i] = arg.String()
+	}
+	return f.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func evalCoalesce(args []sqltypes.Value) (sqltypes.Value, error) {
+	for _, arg := range args {
+		if !arg.IsNull() {
+			return arg, nil
+		}
+	}
+	return sqltypes.NULL, nil
+}
+
+func evalNullif(args []sqltypes.Value) (sqltypes.Value, error) {
+	if args[0].IsNull() || args[1].IsNull() {
+		return args[0], nil
+	}
+	cmp, err := compareValues(args[0], args[1])
+	if err != nil || cmp == 0 {
+		return sqltypes.NULL, err
+	}
+	return args[0], nil
+}
+
+func evalIf(args []sqltypes.Value) (sqltypes.Value, error) {
+	b, err := isTrue(args[0])
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	if b {
+		return args[1], nil
+	}
+	return args[2], nil
+}
+
+func evalGreatest(args []sqltypes.Value) (sqltypes.Value, error) {
+	return extreme(args, 1)
+}
+
+func evalLeast(args []sqltypes.Value) (sqltypes.Value, error) {
+	return extreme(args, -1)
+}
+
+// extreme returns the argument that compares as direction
+// with all the other ones.
+func extreme(args []sqltypes.Value, direction int) (sqltypes.Value, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		cmp, err := compareValues(arg, result)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		if cmp == direction {
+			result = arg
+		}
+	}
+	return result, nil
+}
+
+func evalAbs(args []sqltypes.Value) (sqltypes.Value, error) {
+	n, err := newNumeric(args[0])
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	switch n.typ {
+	case sqltypes.Int64:
+		if n.ival >= 0 {
+			return sqltypes.NewInt64(n.ival), nil
+		}
+		return negate(args[0])
+	case sqltypes.Uint64:
+		return sqltypes.NewUint64(n.uval), nil
+	case sqltypes.Decimal:
+		return decimalValue(new(big.Rat).Abs(n.dval), n.scale), nil
+	}
+	return sqltypes.NewFloat64(math.Abs(n.fval)), nil
+}
+
+func evalCeil(args []sqltypes.Value) (sqltypes.Value, error) {
+	return roundWith(args[0], math.Ceil, func(num, denom *big.Int) *big.Int {
+		q, m := new(big.Int).DivMod(num, denom, new(big.Int))
+		if m.Sign() != 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		return q
+	})
+}
+
+func evalFloor(args []sqltypes.Value) (sqltypes.Value, error) {
+	return roundWith(args[0], math.Floor, func(num, denom *big.Int) *big.Int {
+		// Div rounds towards negative infinity for positive denominators.
+		return new(big.Int).Div(num, denom)
+	})
+}
+
+// roundWith rounds a value to an integer. Integers are returned
+// unchanged, floats use ffunc and decimals use dfunc, which must
+// round the fraction num/denom.
+func roundWith(v sqltypes.Value, ffunc func(float64) float64, dfunc func(num, denom *big.Int) *big.Int) (sqltypes.Value, error) {
+	n, err := newNumeric(v)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	switch n.typ {
+	case sqltypes.Int64:
+		return sqltypes.NewInt64(n.ival), nil
+	case sqltypes.Uint64:
+		return sqltypes.NewUint64(n.uval), nil
+	case sqltypes.Decimal:
+		return decimalValue(new(big.Rat).SetInt(dfunc(n.dval.Num(), n.dval.Denom())), 0), nil
+	}
+	return sqltypes.NewFloat64(ffunc(n.fval)), nil
+}
+
+// evalRound rounds to the specified number of decimals, which can be
+// negative. Like in MySQL, exact values are rounded half away from zero,
+// and floats are rounded half to even.
+func evalRound(args []sqltypes.Value) (sqltypes.Value, error) {
+	n, err := newNumeric(args[0])
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	decimals := int64(0)
+	if !args[1].IsNull() {
+		if decimals, err = sqltypes.ToInt64(args[1]); err != nil {
+			return sqltypes.NULL, err
+		}
+	}
+	if decimals > maxScale {
+		decimals = maxScale
+	}
+	if decimals < -maxScale {
+		decimals = -maxScale
+	}
+	if n.typ == sqltypes.Float64 {
+		shift := math.Pow10(int(decimals))
+		return sqltypes.NewFloat64(math.RoundToEven(n.fval*shift) / shift), nil
+	}
+	if decimals >= 0 && n.typ != sqltypes.Decimal {
+		return args[0], nil
+	}
+	r := n.toRat()
+	if decimals >= 0 {
+		return decimalValue(r, int(decimals)), nil
+	}
+	shift := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(-decimals), nil))
+	rounded, _ := new(big.Rat).SetString(new(big.Rat).Quo(r, shift).FloatString(0))
+	rounded.Mul(rounded, shift)
+	if n.typ == sqltypes.Decimal {
+		return decimalValue(rounded, 0), nil
+	}
+	return integralValue(n.typ, rounded.Num(), args[0], "round", args[1])
+}
+
+func evalMod(args []sqltypes.Value) (sqltypes.Value, error) {
+	return arithmetic(sqlparser.ModStr, args[0], args[1])
+}
+
+func evalConcat(args []sqltypes.Value) (sqltypes.Value, error) {
+	var buf bytes.Buffer
+	for _, arg := range args {
+		buf.Write(arg.ToBytes())
+	}
+	return sqltypes.MakeTrusted(sqltypes.VarChar, buf.Bytes()), nil
+}
+
+// evalLower and evalUpper leave binary strings unchanged, like MySQL.
+func evalLower(args []sqltypes.Value) (sqltypes.Value, error) {
+	if args[0].IsBinary() {
+		return args[0], nil
+	}
+	return sqltypes.NewVarChar(strings.ToLower(args[0].ToString())), nil
+}
+
+func evalUpper(args []sqltypes.Value) (sqltypes.Value, error) {
+	if args[0].IsBinary() {
+		return args[0], nil
+	}
+	return sqltypes.NewVarChar(strings.ToUpper(args[0].ToString())), nil
+}
+
+func evalLength(args []sqltypes.Value) (sqltypes.Value, error) {
+	return sqltypes.NewInt64(int64(args[0].Len())), nil
+}
+
+func evalCharLength(args []sqltypes.Value) (sqltypes.Value, error) {
+	if args[0].IsBinary() {
+		return sqltypes.NewInt64(int64(args[0].Len())), nil
+	}
+	return sqltypes.NewInt64(int64(utf8.RuneCount(args[0].ToBytes()))), nil
+}
+
+func firstType(types []querypb.Type) querypb.Type {
+	return types[0]
+}
+
+func ifType(types []querypb.Type) querypb.Type {
+	return aggregateTypes(types[1:])
+}
+
+func numericType(types []querypb.Type) querypb.Type {
+	if class := numericClass(types[0]); class != sqltypes.Null {
+		return class
+	}
+	return sqltypes.Int64
+}
+
+func modType(types []querypb.Type) querypb.Type {
+	return arithmeticType(sqlparser.ModStr, types[0], types[1])
+}
+
+func stringType(types []querypb.Type) querypb.Type {
+	if len(types) == 1 && sqltypes.IsBinary(types[0]) {
+		return types[0]
+	}
+	return sqltypes.VarChar
+}
+
+func int64Type(types []querypb.Type) querypb.Type {
+	return sqltypes.Int64
+}
@@ -25,6 +25,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/golang/glog"
@@ -41,6 +42,7 @@ import (
 	"vitess.io/vitess/go/vt/topo"
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/buffer"
 	"vitess.io/vitess/go/vt/vtgate/engine"
 	"vitess.io/vitess/go/vt/vtgate/planbuilder"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
@@ -78,6 +80,11 @@ type Executor struct {
 	legacyAutocommit bool
 	plans            *cache.LRUCache
 	vschemaStats     *VSchemaStats
+
+	// consolidator is only set with -enable_query_consolidation.
+	consolidator *queryConsolidator
+	// resultCache is only set with -result_cache_service.
+	resultCache *resultCache
 }
 
 var executorOnce sync.Once
@@ -162,6 +169,7 @@ func (e *Executor) execute(ctx context.Context, safeSession *SafeSession, sql st
 			if err := e.txConn.Begin(ctx, safeSession); err != nil {
 				return nil, err
 			}
+			safeSession.SetImplicitTransaction()
 			// The defer acts as a failsafe. If commit was successful,
 			// the rollback will be a no-op.
 			defer e.txConn.Rollback(ctx, safeSession)
@@ -276,7 +284,26 @@ func (e *Executor) handleExec(ctx context.Context, safeSession *SafeSession, sql
 		return nil, err
 	}
 
-	qr, err := plan.Instructions.Execute(vcursor, bindVars, true)
+	qr, storeResult := e.getCachedResult(ctx, plan, safeSession, vcursor.target.TabletType, bindVars)
+	firstPlan := plan
+	switch {
+	case qr != nil:
+	case e.canConsolidate(query, plan, safeSession, vcursor):
+		key := consolidationKey(ctx, safeSession.TargetString, safeSession.Options, plan.Original, bindVars)
+		qr, err = e.consolidator.execute(ctx, vcursor.target.Keyspace, key, func() (*sqltypes.Result, error) {
+			var qr *sqltypes.Result
+			var err error
+			qr, plan, vcursor, err = executePlan(query, plan, vcursor, bindVars)
+			return qr, err
+		})
+	default:
+		qr, plan, vcursor, err = executePlan(query, plan, vcursor, bindVars)
+	}
+	// A query that was planned again may have read another keyspace,
+	// whose changes don't invalidate the cached result.
+	if err == nil && storeResult != nil && plan == firstPlan {
+		storeResult(qr)
+	}
 	logStats.ExecuteTime = time.Since(execStart)
 	var errCount uint64
 	if err != nil {
@@ -297,6 +324,87 @@ func (e *Executor) handleExec(ctx context.Context, safeSession *SafeSession, sql
 	return qr, err
 }
 
+// Prepare returns the fields of the result set a query would
+// return, without executing it. It is used to answer COM_STMT_PREPARE
+// requests. Statements that don't return rows have no fields.
+func (e *Executor) Prepare(ctx context.Context, method string, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable) (fields []*querypb.Field, err error) {
+	logStats := NewLogStats(ctx, method, sql, bindVars)
+	fields, err = e.prepare(ctx, safeSession, sql, bindVars, logStats)
+	logStats.Error = err
+
+	// The statement is logged when it's executed. Only log
+	// prepare requests that failed.
+	if err != nil {
+		logStats.Send()
+	}
+	return fields, err
+}
+
+func (e *Executor) prepare(ctx context.Context, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable, logStats *LogStats) ([]*querypb.Field, error) {
+	target := e.ParseTarget(safeSession.TargetString)
+	if bindVars == nil {
+		bindVars = make(map[string]*querypb.BindVariable)
+	}
+
+	stmtType := sqlparser.Preview(sql)
+	logStats.StmtType = sqlparser.StmtType(stmtType)
+
+	switch stmtType {
+	case sqlparser.StmtSelect:
+		return e.handlePrepare(ctx, safeSession, sql, bindVars, target, logStats)
+	case sqlparser.StmtShow:
+		// SHOW is not executed to get its fields: they are
+		// returned when the statement is executed.
+		return nil, nil
+	case sqlparser.StmtInsert, sqlparser.StmtReplace, sqlparser.StmtUpdate, sqlparser.StmtDelete,
+		sqlparser.StmtDDL, sqlparser.StmtBegin, sqlparser.StmtCommit, sqlparser.StmtRollback,
+		sqlparser.StmtSet, sqlparser.StmtUse, sqlparser.StmtOther, sqlparser.StmtComment:
+		return nil, nil
+	}
+	return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "unrecognized statement: %s", sql)
+}
+
+func (e *Executor) handlePrepare(ctx context.Context, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable, target querypb.Target, logStats *LogStats) ([]*querypb.Field, error) {
+	keyRange, err := parseRange(safeSession.TargetString)
+	if err != nil {
+		return nil, vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "could not parse target %s (%s)", safeSession.TargetString, err.Error())
+	}
+	if keyRange != nil || target.Shard != "" {
+		// V1 mode or V3 mode with a forced shard or range
+		// target: there is no plan to get the fields from.
+		// They will be returned when the query is executed.
+		return nil, nil
+	}
+
+	// V3 mode. The plan is cached the same way it is for
+	// Execute, so it will be reused by every execution.
+	query, comments := sqlparser.SplitTrailingComments(sql)
+	vcursor := newVCursorImpl(ctx, safeSession, target, comments, e, logStats)
+	plan, err := e.getPlan(
+		vcursor,
+		query,
+		comments,
+		bindVars,
+		skipQueryPlanCache(safeSession),
+		logStats,
+	)
+	execStart := time.Now()
+	logStats.PlanTime = execStart.Sub(logStats.StartTime)
+
+	if err != nil {
+		logStats.Error = err
+		return nil, err
+	}
+
+	qr, err := plan.Instructions.GetFields(vcursor, bindVars)
+	logStats.ExecuteTime = time.Since(execStart)
+	if err != nil {
+		logStats.Error = err
+		return nil, err
+	}
+	return qr.Fields, nil
+}
+
 func (e *Executor) destinationExec(ctx context.Context, safeSession *SafeSession, sql string, bindVars map[string]*querypb.BindVariable, target querypb.Target, destination key.Destination, logStats *LogStats) (*sqltypes.Result, error) {
 	f := func() ([]*srvtopo.ResolvedShard, error) {
 		rss, err := e.resolver.resolver.ResolveDestination(ctx, target.Keyspace, target.TabletType, destination)
@@ -918,7 +1026,10 @@ func (e *Executor) MessageAck(ctx context.Context, keyspace, name string, ids []
 
 		// We always use the (unique) primary vindex. The ID must be the
 		// primary vindex for message tables.
-		mapper := table.ColumnVindexes[0].Vindex.(vindexes.Unique)
+		mapper, ok := table.ColumnVindexes[0].Vindex.(vindexes.Unique)
+		if !ok {
+			return 0, fmt.Errorf("primary vindex of message table %s is not a single-column unique vindex", name)
+		}
 		// convert []*querypb.Value to []sqltypes.Value for calling Map.
 		values := make([]sqltypes.Value, 0, len(ids))
 		for _, id := range ids {
@@ -1182,6 +1293,58 @@ func (e *Executor) getPlan(vcursor *vcursorImpl, sql string, comments string, bi
 	return plan, nil
 }
 
+// executePlan executes a plan. If the request was buffered during a
+// resharding cutover, it was not executed, and it's planned and executed
+// again: its tables may now be served by other shards, or by another
+// keyspace after a vertical split. It returns the plan and the vcursor
+// that were used last.
+func executePlan(query string, plan *engine.Plan, vcursor *vcursorImpl, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, *engine.Plan, *vcursorImpl, error) {
+	qr, err := plan.Instructions.Execute(vcursor, bindVars, true)
+	if !buffer.RequiresReplanning(err) || !canReplan(query, vcursor) {
+		return qr, plan, vcursor, err
+	}
+
+	// The new vcursor only counts the queries of the new plan.
+	e := vcursor.executor
+	logStats := vcursor.logStats
+	atomic.StoreUint32(&logStats.ShardQueries, 0)
+	vcursor = newVCursorImpl(vcursor.ctx, vcursor.safeSession, vcursor.target, vcursor.trailingComments, e, logStats)
+	newPlan, err := e.getPlan(vcursor, query, vcursor.trailingComments, bindVars, skipQueryPlanCache(vcursor.safeSession), logStats)
+	if err != nil {
+		return nil, plan, vcursor, err
+	}
+	qr, err = newPlan.Instructions.Execute(vcursor, bindVars, true)
+	return qr, newPlan, vcursor, err
+}
+
+// canConsolidate returns true if the result of a query can be shared
+// with the identical queries executed at the same time. Only reads
+// outside of transactions can be. Reads from sequences cannot, since
+// they return different values each time.
+func (e *Executor) canConsolidate(query string, plan *engine.Plan, safeSession *SafeSession, vcursor *vcursorImpl) bool {
+	if e.consolidator == nil || safeSession.InTransaction() || !e.consolidator.enabled(vcursor.target.Keyspace) {
+		return false
+	}
+	if sqlparser.Preview(query) != sqlparser.StmtSelect {
+		return false
+	}
+	if route, ok := plan.Instructions.(*engine.Route); ok && route.Opcode == engine.SelectNext {
+		return false
+	}
+	return true
+}
+
+// canReplan returns true if a query which failed because of a resharding
+// cutover can be executed again. Reads can always be. Other statements only
+// if they were sent to a single shard, and nothing else was executed for
+// them, so they had no effect.
+func canReplan(query string, vcursor *vcursorImpl) bool {
+	if sqlparser.Preview(query) == sqlparser.StmtSelect {
+		return true
+	}
+	return !vcursor.hasPartialDML && atomic.LoadUint32(&vcursor.logStats.ShardQueries) == 1
+}
+
 // skipQueryPlanCache extracts SkipQueryPlanCache from session
 func skipQueryPlanCache(safeSession *SafeSession) bool {
 	if safeSession == nil || safeSession.Options == nil {
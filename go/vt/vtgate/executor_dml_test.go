@@ -24,6 +24,7 @@ import (
 	"golang.org/x/net/context"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vtgate/engine"
 	_ "vitess.io/vitess/go/vt/vtgate/vindexes"
 	"vitess.io/vitess/go/vt/vttablet/sandboxconn"
 
@@ -621,6 +622,81 @@ func TestInsertShardedKeyrange(t *testing.T) {
 	}
 }
 
+func TestInsertSelect(t *testing.T) {
+	saved := engine.InsertSelectBatchSize
+	defer func() { engine.InsertSelectBatchSize = saved }()
+	engine.InsertSelectBatchSize = 1
+
+	executor, sbc1, sbc2, sbclookup := createExecutorEnv()
+	selectResult := sqltypes.MakeTestResult(
+		sqltypes.MakeTestFields(
+			"id|col",
+			"int64|varchar",
+		),
+		"1|a",
+		"3|b",
+	)
+
+	// Within a transaction, the batches are part of the transaction.
+	sbclookup.SetResults([]*sqltypes.Result{selectResult})
+	session := NewSafeSession(&vtgatepb.Session{TargetString: "@master", InTransaction: true})
+	result, err := executor.Execute(context.Background(), "TestExecute", session, "insert into user_extra(user_id, col) select id, col from main1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowsAffected != 2 {
+		t.Errorf("RowsAffected: %d, want 2", result.RowsAffected)
+	}
+	if sbclookup.Queries[0].Sql != "select id, col from main1" {
+		t.Errorf("sbclookup.Queries: %+v, want the select", sbclookup.Queries)
+	}
+	wantQueries := []*querypb.BoundQuery{{
+		Sql: "insert into user_extra(user_id, col) values (:_user_id0, 'a') /* vtgate:: keyspace_id:166b40b44aba4bd6 */",
+		BindVariables: map[string]*querypb.BindVariable{
+			"_user_id0": sqltypes.Int64BindVariable(1),
+		},
+	}}
+	if !reflect.DeepEqual(sbc1.Queries, wantQueries) {
+		t.Errorf("sbc1.Queries:\n%+v, want\n%+v\n", sbc1.Queries, wantQueries)
+	}
+	wantQueries = []*querypb.BoundQuery{{
+		Sql: "insert into user_extra(user_id, col) values (:_user_id0, 'b') /* vtgate:: keyspace_id:4eb190c9a2fa169c */",
+		BindVariables: map[string]*querypb.BindVariable{
+			"_user_id0": sqltypes.Int64BindVariable(3),
+		},
+	}}
+	if !reflect.DeepEqual(sbc2.Queries, wantQueries) {
+		t.Errorf("sbc2.Queries:\n%+v, want\n%+v\n", sbc2.Queries, wantQueries)
+	}
+	if commits := sbc1.CommitCount.Get() + sbc2.CommitCount.Get() + sbclookup.CommitCount.Get(); commits != 0 {
+		t.Errorf("commit count: %d, want 0", commits)
+	}
+	if !session.InTransaction() {
+		t.Errorf("session.InTransaction: false, want true")
+	}
+
+	// With autocommit, each batch is committed separately.
+	sbclookup.SetResults([]*sqltypes.Result{selectResult})
+	session = NewSafeSession(&vtgatepb.Session{TargetString: "@master", Autocommit: true, TransactionMode: vtgatepb.TransactionMode_MULTI})
+	_, err = executor.Execute(context.Background(), "TestExecute", session, "insert into user_extra(user_id, col) select id, col from main1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The first batch is committed with the select.
+	if got := sbclookup.CommitCount.Get(); got != 1 {
+		t.Errorf("sbclookup commit count: %d, want 1", got)
+	}
+	if got := sbc1.CommitCount.Get(); got != 1 {
+		t.Errorf("sbc1 commit count: %d, want 1", got)
+	}
+	if got := sbc2.CommitCount.Get(); got != 1 {
+		t.Errorf("sbc2 commit count: %d, want 1", got)
+	}
+	if session.InTransaction() {
+		t.Errorf("session.InTransaction: true, want false")
+	}
+}
+
 func TestInsertShardedAutocommitLookup(t *testing.T) {
 
 	vschema := `
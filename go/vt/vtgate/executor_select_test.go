@@ -232,6 +232,69 @@ func TestStreamBuffering(t *testing.T) {
 	}
 }
 
+func TestSelectPrepare(t *testing.T) {
+	executor, sbc1, _, sbclookup := createExecutorEnv()
+
+	sql := "select id from user where id = :v1"
+	fields, err := executor.Prepare(context.Background(), "TestPrepare", NewSafeSession(masterSession), sql, map[string]*querypb.BindVariable{
+		"v1": sqltypes.NullBindVariable,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fields, sandboxconn.SingleRowResult.Fields) {
+		t.Errorf("Prepare fields: %+v, want %+v", fields, sandboxconn.SingleRowResult.Fields)
+	}
+	wantQueries := []*querypb.BoundQuery{{
+		Sql:           "select id from user where 1 != 1",
+		BindVariables: map[string]*querypb.BindVariable{"v1": sqltypes.NullBindVariable},
+	}}
+	if !reflect.DeepEqual(sbc1.Queries, wantQueries) {
+		t.Errorf("sbc1.Queries: %+v, want %+v\n", sbc1.Queries, wantQueries)
+	}
+	sbc1.Queries = nil
+
+	// Executing the prepared statement must reuse the cached plan.
+	_, err = executorExec(executor, sql, map[string]*querypb.BindVariable{
+		"v1": sqltypes.Int64BindVariable(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantQueries = []*querypb.BoundQuery{{
+		Sql:           "select id from user where id = :v1",
+		BindVariables: map[string]*querypb.BindVariable{"v1": sqltypes.Int64BindVariable(1)},
+	}}
+	if !reflect.DeepEqual(sbc1.Queries, wantQueries) {
+		t.Errorf("sbc1.Queries: %+v, want %+v\n", sbc1.Queries, wantQueries)
+	}
+	if got := executor.plans.Length(); got != 1 {
+		t.Errorf("plan cache length: %d, want 1", got)
+	}
+
+	// DMLs have no fields to describe.
+	fields, err = executor.Prepare(context.Background(), "TestPrepare", NewSafeSession(masterSession), "update user set a = :v1 where id = :v2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields != nil {
+		t.Errorf("Prepare fields: %+v, want nil", fields)
+	}
+
+	// Nor do SHOW statements, which are not executed.
+	session := NewSafeSession(&vtgatepb.Session{TargetString: KsTestUnsharded})
+	fields, err = executor.Prepare(context.Background(), "TestPrepare", session, "show tables", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields != nil {
+		t.Errorf("Prepare fields: %+v, want nil", fields)
+	}
+	if got := sbclookup.ExecCount.Get(); got != 0 {
+		t.Errorf("sbclookup.ExecCount: %v, want 0", got)
+	}
+}
+
 func TestSelectBindvars(t *testing.T) {
 	executor, sbc1, sbc2, _ := createExecutorEnv()
 	logChan := QueryLogger.Subscribe("Test")
@@ -28,11 +28,15 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
 	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 )
 
 func TestExecutorTransactionsNoAutoCommit(t *testing.T) {
@@ -1437,3 +1441,168 @@ func TestParseEmptyTargetMultiKeyspace(t *testing.T) {
 		t.Errorf("ParseTarget(%s): %v, want %v", "@master", got, want)
 	}
 }
+
+func TestCanReplan(t *testing.T) {
+	testcases := []struct {
+		query         string
+		shardQueries  uint32
+		hasPartialDML bool
+		want          bool
+	}{{
+		query:         "select id from user",
+		shardQueries:  8,
+		hasPartialDML: true,
+		want:          true,
+	}, {
+		query:        "update user set a = a + 1 where id = 1",
+		shardQueries: 1,
+		want:         true,
+	}, {
+		query:        "update user set a = a + 1",
+		shardQueries: 8,
+		want:         false,
+	}, {
+		// The lookup vindex row was already inserted.
+		query:         "insert into user(id, name) values(1, 'a')",
+		shardQueries:  1,
+		hasPartialDML: true,
+		want:          false,
+	}}
+	for _, tc := range testcases {
+		vcursor := &vcursorImpl{
+			logStats:      &LogStats{ShardQueries: tc.shardQueries},
+			hasPartialDML: tc.hasPartialDML,
+		}
+		if got := canReplan(tc.query, vcursor); got != tc.want {
+			t.Errorf("canReplan(%v) with %v shard queries, hasPartialDML: %v = %v, want %v", tc.query, tc.shardQueries, tc.hasPartialDML, got, tc.want)
+		}
+	}
+}
+
+func TestExecutePlanReplan(t *testing.T) {
+	executor, sbc1, _, sbclookup := createExecutorEnv()
+	ctx := context.Background()
+	safeSession := NewSafeSession(&vtgatepb.Session{TargetString: "@master"})
+	logStats := NewLogStats(ctx, "Test", "", nil)
+	vcursor := newVCursorImpl(ctx, safeSession, executor.ParseTarget("@master"), "", executor, logStats)
+	query := "select id from main1"
+	bindVars := map[string]*querypb.BindVariable{}
+	plan, err := executor.getPlan(vcursor, query, "", bindVars, false, logStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While the request is buffered, a vertical split moves main1
+	// from the unsharded keyspace to the sharded one.
+	srvVSchema := proto.Clone(executor.srvVschema).(*vschemapb.SrvVSchema)
+	delete(srvVSchema.Keyspaces[KsTestUnsharded].Tables, "main1")
+	srvVSchema.Keyspaces["TestExecutor"].Tables["main1"] = &vschemapb.Table{
+		ColumnVindexes: []*vschemapb.ColumnVindex{{
+			Name:   "hash_index",
+			Column: "id",
+		}},
+	}
+	vschema, err := vindexes.BuildVSchema(srvVSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	executor.mu.Lock()
+	executor.vschema = vschema
+	executor.mu.Unlock()
+	executor.plans.Clear()
+	sbclookup.MustFailWith = vterrors.New(vtrpcpb.Code_FAILED_PRECONDITION, "buffered request must be re-planned because the shard is no longer serving after a resharding")
+
+	_, newPlan, newVCursor, err := executePlan(query, plan, vcursor, bindVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sbclookup.ExecCount.Get(); got != 1 {
+		t.Errorf("sbclookup.ExecCount: %v, want 1", got)
+	}
+	if got := sbc1.ExecCount.Get(); got != 1 {
+		t.Errorf("sbc1.ExecCount: %v, want 1", got)
+	}
+	if newPlan == plan || newPlan.Instructions.(*engine.Route).Keyspace.Name != "TestExecutor" {
+		t.Errorf("executePlan didn't plan the query again: %v", newPlan.Instructions)
+	}
+	if newVCursor == vcursor {
+		t.Errorf("executePlan didn't use a new vcursor")
+	}
+	// Only the queries of the new plan are counted.
+	if got := logStats.ShardQueries; got != 8 {
+		t.Errorf("logStats.ShardQueries: %v, want 8", got)
+	}
+}
+
+func TestCanConsolidate(t *testing.T) {
+	executor, _, _, _ := createExecutorEnv()
+	executor.consolidator = newQueryConsolidator([]string{KsTestUnsharded}, 10, 0, 0)
+
+	testcases := []struct {
+		query         string
+		target        string
+		inTransaction bool
+		want          bool
+	}{{
+		query:  "select id from main1",
+		target: KsTestUnsharded,
+		want:   true,
+	}, {
+		query:         "select id from main1",
+		target:        KsTestUnsharded,
+		inTransaction: true,
+		want:          false,
+	}, {
+		query:  "select next :n values from user_seq",
+		target: KsTestUnsharded,
+		want:   false,
+	}, {
+		query:  "update main1 set id = 1",
+		target: KsTestUnsharded,
+		want:   false,
+	}, {
+		// The keyspace is not enabled.
+		query:  "select id from user",
+		target: "TestExecutor",
+		want:   false,
+	}}
+	for _, tc := range testcases {
+		safeSession := NewSafeSession(&vtgatepb.Session{
+			TargetString:  tc.target,
+			Autocommit:    true,
+			InTransaction: tc.inTransaction,
+		})
+		vcursor := newVCursorImpl(context.Background(), safeSession, executor.ParseTarget(tc.target), "", executor, nil)
+		plan, err := executor.getPlan(vcursor, tc.query, "", map[string]*querypb.BindVariable{}, false, nil)
+		if err != nil {
+			t.Fatalf("getPlan(%v) failed: %v", tc.query, err)
+		}
+		if got := executor.canConsolidate(tc.query, plan, safeSession, vcursor); got != tc.want {
+			t.Errorf("canConsolidate(%v) in %v, inTransaction: %v = %v, want %v", tc.query, tc.target, tc.inTransaction, got, tc.want)
+		}
+	}
+}
+
+func TestExecutorConsolidation(t *testing.T) {
+	executor, sbc1, _, _ := createExecutorEnv()
+	session := &vtgatepb.Session{TargetString: "@master", Autocommit: true}
+	result, err := executor.Execute(context.Background(), "TestExecute", NewSafeSession(session), "select id from user where id = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor.consolidator = newQueryConsolidator(nil, 10, 0, 0)
+	got, err := executor.Execute(context.Background(), "TestExecute", NewSafeSession(session), "select id from user where id = 1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, result) {
+		t.Errorf("consolidated result: %v, want %v", got, result)
+	}
+	if len(executor.consolidator.queries) != 0 {
+		t.Errorf("queries = %v, want none", executor.consolidator.queries)
+	}
+	if got := sbc1.ExecCount.Get(); got != 2 {
+		t.Errorf("sbc1.ExecCount: %v, want 2", got)
+	}
+}
@@ -48,13 +48,24 @@ var (
 	tabletFilters       flagutil.StringListValue
 	refreshInterval     = flag.Duration("tablet_refresh_interval", 1*time.Minute, "tablet refresh interval")
 	topoReadConcurrency = flag.Int("topo_read_concurrency", 32, "concurrent topo reads")
+	tabletDiscovery     = flag.String("tablet_discovery", tabletDiscoveryPoll, "how to find the tablets of the watched cells: 'poll' reads all the tablets every -tablet_refresh_interval, 'watch' uses topo watches on the ShardReplication objects and the tablet records, and only lists the shards every -tablet_refresh_interval")
 	allowedTabletTypes  []topodatapb.TabletType
 )
 
 const (
 	gatewayImplementationDiscovery = "discoverygateway"
+
+	tabletDiscoveryPoll  = "poll"
+	tabletDiscoveryWatch = "watch"
 )
 
+// tabletsWatcher is implemented by discovery.TopologyWatcher and
+// discovery.CellTabletsPushWatcher.
+type tabletsWatcher interface {
+	WaitForInitialTopology() error
+	Stop()
+}
+
 func init() {
 	flag.Var(&tabletFilters, "tablet_filters", "Specifies a comma-separated list of 'keyspace|shard_name or keyrange' values to filter the tablets to watch")
 	topoproto.TabletTypeListVar(&allowedTabletTypes, "allowed_tablet_types", "Specifies the tablet types this vtgate is allowed to route queries to")
@@ -72,7 +83,7 @@ type discoveryGateway struct {
 
 	// tabletsWatchers contains a list of all the watchers we use.
 	// We create one per cell.
-	tabletsWatchers []*discovery.TopologyWatcher
+	tabletsWatchers []tabletsWatcher
 
 	// mu protects the fields of this group.
 	mu sync.RWMutex
@@ -80,8 +91,13 @@ type discoveryGateway struct {
 	// keyspace/shard/tablet_type.
 	statusAggregators map[string]*TabletStatusAggregator
 
-	// buffer, if enabled, buffers requests during a detected MASTER failover.
+	// buffer, if enabled, buffers requests during a detected MASTER failover
+	// or resharding cutover.
 	buffer *buffer.Buffer
+
+	// loadBalancer is only set with -gateway_tablet_selection=least_loaded.
+	// Otherwise, a random tablet is picked.
+	loadBalancer *loadBalancer
 }
 
 func createDiscoveryGateway(hc discovery.HealthCheck, topoServer *topo.Server, serv srvtopo.Server, cell string, retryCount int) Gateway {
@@ -92,9 +108,17 @@ func createDiscoveryGateway(hc discovery.HealthCheck, topoServer *topo.Server, s
 		srvTopoServer:     serv,
 		localCell:         cell,
 		retryCount:        retryCount,
-		tabletsWatchers:   make([]*discovery.TopologyWatcher, 0, 1),
+		tabletsWatchers:   make([]tabletsWatcher, 0, 1),
 		statusAggregators: make(map[string]*TabletStatusAggregator),
-		buffer:            buffer.New(),
+		buffer:            buffer.New(serv, cell),
+	}
+	lb, err := newLoadBalancer(cell)
+	if err != nil {
+		log.Exitf("Invalid tablet selection configuration: %v", err)
+	}
+	dg.loadBalancer = lb
+	if *tabletDiscovery != tabletDiscoveryPoll && *tabletDiscovery != tabletDiscoveryWatch {
+		log.Exitf("Invalid -tablet_discovery value %q, must be %v or %v", *tabletDiscovery, tabletDiscoveryPoll, tabletDiscoveryWatch)
 	}
 
 	// Set listener which will update TabletStatsCache and MasterBuffer.
@@ -115,7 +139,12 @@ func createDiscoveryGateway(hc discovery.HealthCheck, topoServer *topo.Server, s
 			tr = fbs
 		}
 
-		ctw := discovery.NewCellTabletsWatcher(dg.topoServer, tr, c, *refreshInterval, *topoReadConcurrency)
+		var ctw tabletsWatcher
+		if *tabletDiscovery == tabletDiscoveryWatch {
+			ctw = discovery.NewCellTabletsPushWatcher(dg.topoServer, tr, c, *refreshInterval, *topoReadConcurrency)
+		} else {
+			ctw = discovery.NewCellTabletsWatcher(dg.topoServer, tr, c, *refreshInterval, *topoReadConcurrency)
+		}
 		dg.tabletsWatchers = append(dg.tabletsWatchers, ctw)
 	}
 	dg.QueryService = queryservice.Wrap(nil, dg.withRetry)
@@ -126,6 +155,9 @@ func createDiscoveryGateway(hc discovery.HealthCheck, topoServer *topo.Server, s
 // It is part of the discovery.HealthCheckStatsListener interface.
 func (dg *discoveryGateway) StatsUpdate(ts *discovery.TabletStats) {
 	dg.tsc.StatsUpdate(ts)
+	if !ts.Up && dg.loadBalancer != nil {
+		dg.loadBalancer.remove(ts.Key)
+	}
 
 	if ts.Target.TabletType == topodatapb.TabletType_MASTER {
 		dg.buffer.StatsUpdate(ts)
@@ -223,6 +255,17 @@ func (dg *discoveryGateway) withRetry(ctx context.Context, target *querypb.Targe
 			// The next call blocks if we should buffer during a failover.
 			retryDone, bufferErr := dg.buffer.WaitForFailoverEnd(ctx, target.Keyspace, target.Shard, err)
 			if bufferErr != nil {
+				if retryDone != nil {
+					// We're not going to retry. Give up the buffer slot now.
+					retryDone()
+				}
+				if buffer.RequiresReplanning(bufferErr) {
+					// A resharding cutover ended while the request was buffered.
+					// Do not retry this shard and let the upper layers re-resolve
+					// the shards.
+					err = bufferErr
+					break
+				}
 				// Buffering failed e.g. buffer is already full. Do not retry.
 				err = vterrors.Errorf(
 					vterrors.Code(bufferErr),
@@ -246,7 +289,11 @@ func (dg *discoveryGateway) withRetry(ctx context.Context, target *querypb.Targe
 			err = vterrors.New(vtrpcpb.Code_UNAVAILABLE, "no valid tablet")
 			break
 		}
-		shuffleTablets(dg.localCell, tablets)
+		if dg.loadBalancer != nil {
+			dg.loadBalancer.sortTablets(tablets, target.TabletType)
+		} else {
+			shuffleTablets(dg.localCell, tablets)
+		}
 
 		// skip tablets we tried before
 		var ts *discovery.TabletStats
@@ -280,7 +327,13 @@ func (dg *discoveryGateway) withRetry(ctx context.Context, target *querypb.Targe
 
 		startTime := time.Now()
 		var canRetry bool
-		err, canRetry = inner(ctx, ts.Target, conn)
+		if dg.loadBalancer != nil {
+			done := dg.loadBalancer.begin(ts.Key, !isStreaming(name))
+			err, canRetry = inner(ctx, ts.Target, conn)
+			done(err)
+		} else {
+			err, canRetry = inner(ctx, ts.Target, conn)
+		}
 		dg.updateStats(target, startTime, err)
 		if canRetry {
 			invalidTablets[ts.Key] = true
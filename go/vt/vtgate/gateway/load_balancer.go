@@ -0,0 +1,234 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/flagutil"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+const (
+	tabletSelectionRandom      = "random"
+	tabletSelectionLeastLoaded = "least_loaded"
+
+	// minLatency is the latency used for the tablets which did not answer
+	// any query yet, and the lower bound of the measured latencies.
+	minLatency = 100 * time.Microsecond
+)
+
+var (
+	tabletSelection   = flag.String("gateway_tablet_selection", tabletSelectionRandom, "how to pick a healthy tablet for a query: 'random' picks a random tablet, preferably in the local cell. 'least_loaded' picks the tablet with the lowest latency and fewest requests in flight, weighted by -gateway_cell_weights.")
+	latencyEWMAWeight = flag.Float64("gateway_latency_ewma_weight", 0.1, "with -gateway_tablet_selection=least_loaded, the weight of the latest query in the moving average of the latency of a tablet")
+	cellWeights       flagutil.StringMapValue
+)
+
+func init() {
+	flag.Var(&cellWeights, "gateway_cell_weights", "with -gateway_tablet_selection=least_loaded, comma separated list of cell:weight or cell@tablet_type:weight entries, e.g. 'cell2@replica:0.2'. The tablet with the lowest load divided by its weight is picked. By default, the local cell has a weight of 1 and the other cells of 0. The tablets with a weight of 0 are only used when no other tablet is available.")
+}
+
+// loadBalancer orders the healthy tablets of a target by their load, as
+// seen by this vtgate: the moving average of their query latency, times
+// the number of queries in flight.
+type loadBalancer struct {
+	// Immutable, set at construction time.
+	localCell string
+	// ewmaWeight is the weight of a new latency sample.
+	ewmaWeight float64
+	// weights is indexed by cell or cell@tablet_type.
+	weights map[string]float64
+
+	// mu protects loads.
+	mu sync.Mutex
+	// loads is indexed by discovery.TabletStats.Key.
+	loads map[string]*tabletLoad
+}
+
+// tabletLoad is the load of a tablet. It is protected by loadBalancer.mu.
+type tabletLoad struct {
+	// latency is the moving average of the query latency.
+	// It is zero until the first query finishes.
+	latency  time.Duration
+	inFlight int
+}
+
+// newLoadBalancer creates a loadBalancer from the command line flags.
+// It returns nil if the least_loaded tablet selection is not enabled.
+func newLoadBalancer(localCell string) (*loadBalancer, error) {
+	switch *tabletSelection {
+	case tabletSelectionRandom:
+		return nil, nil
+	case tabletSelectionLeastLoaded:
+	default:
+		return nil, fmt.Errorf("invalid -gateway_tablet_selection %q, must be %v or %v", *tabletSelection, tabletSelectionRandom, tabletSelectionLeastLoaded)
+	}
+	if *latencyEWMAWeight <= 0 || *latencyEWMAWeight > 1 {
+		return nil, fmt.Errorf("-gateway_latency_ewma_weight must be in (0, 1], got %v", *latencyEWMAWeight)
+	}
+	weights, err := parseCellWeights(cellWeights)
+	if err != nil {
+		return nil, err
+	}
+	return &loadBalancer{
+		localCell:  localCell,
+		ewmaWeight: *latencyEWMAWeight,
+		weights:    weights,
+		loads:      make(map[string]*tabletLoad),
+	}, nil
+}
+
+// parseCellWeights validates the entries of -gateway_cell_weights.
+func parseCellWeights(entries map[string]string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for key, value := range entries {
+		cell := key
+		if i := strings.Index(key, "@"); i >= 0 {
+			tabletType, err := topoproto.ParseTabletType(key[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid tablet type in -gateway_cell_weights entry %v: %v", key, err)
+			}
+			cell = key[:i]
+			key = cell + "@" + topoproto.TabletTypeLString(tabletType)
+		}
+		if cell == "" {
+			return nil, fmt.Errorf("missing cell in -gateway_cell_weights entry %v", key)
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight in -gateway_cell_weights entry %v:%v, must be a non-negative number", key, value)
+		}
+		weights[key] = weight
+	}
+	return weights, nil
+}
+
+// weight returns the weight of the tablets of a cell, for a tablet type.
+func (lb *loadBalancer) weight(cell string, tabletType topodatapb.TabletType) float64 {
+	if w, ok := lb.weights[cell+"@"+topoproto.TabletTypeLString(tabletType)]; ok {
+		return w
+	}
+	if w, ok := lb.weights[cell]; ok {
+		return w
+	}
+	if cell == lb.localCell {
+		return 1
+	}
+	return 0
+}
+
+// sortTablets orders the tablets from the least to the most loaded.
+// The tablets with a weight of 0 come last, in random order.
+// Tablets with the same load are in random order too.
+func (lb *loadBalancer) sortTablets(tablets []discovery.TabletStats, tabletType topodatapb.TabletType) {
+	type scored struct {
+		ts    discovery.TabletStats
+		score float64
+	}
+	all := make([]scored, len(tablets))
+	lb.mu.Lock()
+	for i, ts := range tablets {
+		all[i].ts = ts
+		weight := lb.weight(ts.Tablet.Alias.Cell, tabletType)
+		if weight == 0 {
+			all[i].score = -1
+			continue
+		}
+		latency, inFlight := minLatency, 0
+		if load, ok := lb.loads[ts.Key]; ok {
+			if load.latency > latency {
+				latency = load.latency
+			}
+			inFlight = load.inFlight
+		}
+		all[i].score = latency.Seconds() * float64(inFlight+1) / weight
+	}
+	lb.mu.Unlock()
+
+	for i := len(all) - 1; i > 0; i-- {
+		j := rand.Intn(i + 1)
+		all[i], all[j] = all[j], all[i]
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		switch {
+		case all[i].score < 0:
+			return false
+		case all[j].score < 0:
+			return true
+		}
+		return all[i].score < all[j].score
+	})
+	for i := range all {
+		tablets[i] = all[i].ts
+	}
+}
+
+// begin records a query sent to a tablet. The returned function must be
+// called with the error of the query when it finishes. If recordLatency
+// is false, the latency of the query is not recorded, e.g. for streaming
+// queries. The latency of failed queries is never recorded: a tablet
+// which fails fast must not look less loaded.
+func (lb *loadBalancer) begin(key string, recordLatency bool) func(error) {
+	start := time.Now()
+	lb.mu.Lock()
+	load, ok := lb.loads[key]
+	if !ok {
+		load = &tabletLoad{}
+		lb.loads[key] = load
+	}
+	load.inFlight++
+	lb.mu.Unlock()
+
+	return func(err error) {
+		elapsed := time.Since(start)
+		lb.mu.Lock()
+		defer lb.mu.Unlock()
+		load.inFlight--
+		if !recordLatency || err != nil {
+			return
+		}
+		if load.latency == 0 {
+			load.latency = elapsed
+			return
+		}
+		load.latency = time.Duration(lb.ewmaWeight*float64(elapsed) + (1-lb.ewmaWeight)*float64(load.latency))
+	}
+}
+
+// remove forgets the load of a tablet which is gone.
+// A query in flight can still finish.
+func (lb *loadBalancer) remove(key string) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	delete(lb.loads, key)
+}
+
+// isStreaming returns true for the names of the streaming
+// QueryService methods.
+func isStreaming(name string) bool {
+	return strings.HasPrefix(name, "Stream") || strings.HasSuffix(name, "Stream")
+}
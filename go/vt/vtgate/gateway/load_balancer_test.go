@@ -0,0 +1,201 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gateway
+
+import (
+	"errors"
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/topo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestParseCellWeights(t *testing.T) {
+	got, err := parseCellWeights(map[string]string{
+		"cell1":         "1",
+		"cell2@REPLICA": "0.2",
+		"cell2@rdonly":  "0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"cell1":         1,
+		"cell2@replica": 0.2,
+		"cell2@rdonly":  0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCellWeights() = %v, want %v", got, want)
+	}
+
+	for _, entries := range []map[string]string{
+		{"cell1": "-1"},
+		{"cell1": "heavy"},
+		{"cell1@nosuchtype": "1"},
+		{"@replica": "1"},
+	} {
+		if _, err := parseCellWeights(entries); err == nil {
+			t.Errorf("parseCellWeights(%v) must fail", entries)
+		}
+	}
+
+	_, err = parseCellWeights(map[string]string{"cell1": "-1"})
+	wantErr := "invalid weight in -gateway_cell_weights entry cell1:-1, must be a non-negative number"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("parseCellWeights(cell1:-1) = %v, want %v", err, wantErr)
+	}
+}
+
+func TestNewLoadBalancer(t *testing.T) {
+	defer flag.Set("gateway_tablet_selection", tabletSelectionRandom)
+
+	if lb, err := newLoadBalancer("cell1"); lb != nil || err != nil {
+		t.Errorf("newLoadBalancer() with random tablet selection = %v, %v, want nil, nil", lb, err)
+	}
+	flag.Set("gateway_tablet_selection", "fastest")
+	if _, err := newLoadBalancer("cell1"); err == nil {
+		t.Errorf("newLoadBalancer() with an unknown tablet selection must fail")
+	}
+	flag.Set("gateway_tablet_selection", tabletSelectionLeastLoaded)
+	if lb, err := newLoadBalancer("cell1"); lb == nil || err != nil {
+		t.Errorf("newLoadBalancer() with least_loaded tablet selection = %v, %v, want a loadBalancer", lb, err)
+	}
+}
+
+func loadBalancerTablets() []discovery.TabletStats {
+	return []discovery.TabletStats{
+		{Key: "t1", Tablet: topo.NewTablet(1, "cell1", "host1")},
+		{Key: "t2", Tablet: topo.NewTablet(2, "cell1", "host2")},
+		{Key: "t3", Tablet: topo.NewTablet(3, "cell2", "host3")},
+	}
+}
+
+func tabletKeys(tablets []discovery.TabletStats) []string {
+	var keys []string
+	for _, ts := range tablets {
+		keys = append(keys, ts.Key)
+	}
+	return keys
+}
+
+func TestLoadBalancerSortTablets(t *testing.T) {
+	lb := &loadBalancer{
+		localCell:  "cell1",
+		ewmaWeight: 0.5,
+		weights:    map[string]float64{},
+		loads:      make(map[string]*tabletLoad),
+	}
+
+	// By default, the other cells are only a fallback.
+	lb.loads["t1"] = &tabletLoad{latency: 10 * time.Millisecond}
+	lb.loads["t2"] = &tabletLoad{latency: 2 * time.Millisecond}
+	lb.loads["t3"] = &tabletLoad{latency: 1 * time.Millisecond}
+	tablets := loadBalancerTablets()
+	lb.sortTablets(tablets, topodatapb.TabletType_REPLICA)
+	if got, want := tabletKeys(tablets), []string{"t2", "t1", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortTablets() = %v, want %v", got, want)
+	}
+
+	// The requests in flight count as well.
+	lb.loads["t2"].inFlight = 5
+	tablets = loadBalancerTablets()
+	lb.sortTablets(tablets, topodatapb.TabletType_REPLICA)
+	if got, want := tabletKeys(tablets), []string{"t1", "t2", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortTablets() = %v, want %v", got, want)
+	}
+
+	// With a weight, the other cell is used when the local cell is loaded
+	// enough. The weight only applies to its tablet type.
+	lb.weights["cell2@replica"] = 0.2
+	tablets = loadBalancerTablets()
+	lb.sortTablets(tablets, topodatapb.TabletType_REPLICA)
+	if got, want := tabletKeys(tablets), []string{"t3", "t1", "t2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortTablets() = %v, want %v", got, want)
+	}
+	tablets = loadBalancerTablets()
+	lb.sortTablets(tablets, topodatapb.TabletType_RDONLY)
+	if got, want := tabletKeys(tablets), []string{"t1", "t2", "t3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortTablets() = %v, want %v", got, want)
+	}
+}
+
+func TestLoadBalancerBegin(t *testing.T) {
+	lb := &loadBalancer{
+		localCell:  "cell1",
+		ewmaWeight: 0.5,
+		loads:      make(map[string]*tabletLoad),
+	}
+
+	done := lb.begin("t1", true)
+	done2 := lb.begin("t1", false)
+	if got := lb.loads["t1"].inFlight; got != 2 {
+		t.Errorf("inFlight = %v, want 2", got)
+	}
+	time.Sleep(10 * time.Millisecond)
+	done(nil)
+	done2(nil)
+	load := lb.loads["t1"]
+	if load.inFlight != 0 {
+		t.Errorf("inFlight = %v, want 0", load.inFlight)
+	}
+	// The first sample is the latency.
+	first := load.latency
+	if first < 10*time.Millisecond {
+		t.Errorf("latency = %v, want at least 10ms", first)
+	}
+
+	// The next ones are averaged.
+	lb.begin("t1", true)(nil)
+	if load.latency >= first || load.latency < first/2 {
+		t.Errorf("latency = %v, want the average of %v and a faster query", load.latency, first)
+	}
+
+	// Failed queries don't change the latency.
+	second := load.latency
+	lb.begin("t1", true)(errors.New("tablet error"))
+	if load.latency != second {
+		t.Errorf("latency = %v after a failed query, want %v", load.latency, second)
+	}
+	if load.inFlight != 0 {
+		t.Errorf("inFlight = %v, want 0", load.inFlight)
+	}
+
+	lb.remove("t1")
+	if _, ok := lb.loads["t1"]; ok {
+		t.Errorf("the load of a removed tablet must be forgotten")
+	}
+}
+
+func TestIsStreaming(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Execute":       false,
+		"BeginExecute":  false,
+		"MessageAck":    false,
+		"StreamExecute": true,
+		"MessageStream": true,
+		"UpdateStream":  true,
+	} {
+		if got := isStreaming(name); got != want {
+			t.Errorf("isStreaming(%v) = %v, want %v", name, got, want)
+		}
+	}
+}
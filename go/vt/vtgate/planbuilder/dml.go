@@ -18,11 +18,13 @@ package planbuilder
 
 import (
 	"errors"
+	"fmt"
 
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vterrors"
 	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
@@ -80,19 +82,91 @@ func buildUpdatePlan(upd *sqlparser.Update, vschema VSchema) (*engine.Update, er
 	}
 	eupd.Vindex, eupd.Values, err = getDMLRouting(upd.Where, eupd.Table)
 	if err != nil {
-		return nil, err
+		eupd.Opcode = engine.UpdateSharded
+	} else {
+		eupd.Opcode = engine.UpdateEqual
 	}
-	eupd.Opcode = engine.UpdateEqual
 
 	if eupd.ChangedVindexValues, err = buildChangedVindexesValues(eupd, upd, eupd.Table.ColumnVindexes); err != nil {
 		return nil, err
 	}
+	primary := eupd.Table.ColumnVindexes[0]
+	if _, ok := eupd.ChangedVindexValues[primary.Name]; ok {
+		if err := buildUpdateMovePlan(upd, eupd); err != nil {
+			return nil, err
+		}
+		return eupd, nil
+	}
+	if eupd.Opcode == engine.UpdateSharded {
+		if len(eupd.ChangedVindexValues) == 0 && upd.Limit == nil {
+			return eupd, nil
+		}
+		sel, key, err := buildMultiShardDMLSubquery(eupd.Table, upd.Where, upd.OrderBy, upd.Limit, &eupd.OrderBy, &eupd.Limit, &eupd.KeyColumn)
+		if err != nil {
+			return nil, err
+		}
+		eupd.OwnedVindexQuery = sqlparser.String(sel)
+		eupd.KsidVindex = primary.Vindex
+		if upd.Limit != nil {
+			keyed := *upd
+			keyed.Where = dmlKeysWhere(upd.Where, key)
+			keyed.OrderBy = nil
+			keyed.Limit = nil
+			eupd.Query = generateQuery(&keyed)
+		}
+		return eupd, nil
+	}
 	if len(eupd.ChangedVindexValues) != 0 {
 		eupd.OwnedVindexQuery = generateUpdateSubquery(upd, eupd.Table)
 	}
 	return eupd, nil
 }
 
+// buildUpdateMovePlan completes the plan of an update that changes
+// the primary vindex columns. Such an update is executed as a delete
+// of the rows, followed by an insert of the updated rows, and the
+// expressions of the SET clause are evaluated by vtgate.
+func buildUpdateMovePlan(upd *sqlparser.Update, eupd *engine.Update) error {
+	sel, key, err := buildMultiShardDMLSubquery(eupd.Table, upd.Where, upd.OrderBy, upd.Limit, &eupd.OrderBy, &eupd.Limit, &eupd.KeyColumn)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range upd.Exprs {
+		expr, err := evalengine.Convert(assignment.Expr, func(expr sqlparser.Expr) (int, error) {
+			col, ok := expr.(*sqlparser.ColName)
+			if !ok {
+				return 0, fmt.Errorf("unsupported: %s in an update of primary vindex columns", sqlparser.String(expr))
+			}
+			return findOrAddSelectColumn(sel, &sqlparser.ColName{Name: col.Name}), nil
+		})
+		if err != nil {
+			return err
+		}
+		eupd.Assignments = append(eupd.Assignments, &engine.UpdateAssignment{
+			Column: assignment.Name.Name.String(),
+			Expr:   expr,
+		})
+	}
+	eupd.RowOffset = len(sel.SelectExprs)
+	sel.SelectExprs = append(sel.SelectExprs, &sqlparser.StarExpr{TableName: sqlparser.TableName{Name: eupd.Table.Name}})
+	eupd.OwnedVindexQuery = sqlparser.String(sel)
+	eupd.KsidVindex = eupd.Table.ColumnVindexes[0].Vindex
+	// The lookup entries are deleted and created again
+	// when the rows are moved, instead of being updated.
+	eupd.ChangedVindexValues = nil
+
+	del := &sqlparser.Delete{
+		Comments:   upd.Comments,
+		TableExprs: upd.TableExprs,
+		Where:      upd.Where,
+	}
+	if upd.Limit != nil {
+		del.Where = dmlKeysWhere(upd.Where, key)
+	}
+	eupd.DeleteQuery = generateQuery(del)
+	return nil
+}
+
 func generateQuery(statement sqlparser.Statement) string {
 	buf := sqlparser.NewTrackedBuffer(dmlFormatter)
 	statement.Format(buf)
@@ -136,7 +210,9 @@ func buildChangedVindexesValues(eupd *engine.Update, update *sqlparser.Update, c
 			return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "unsupported: Need to provide order by clause when using limit. Invalid update on vindex: %v", vindex.Name)
 		}
 		if i == 0 {
-			return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "unsupported: You can't update primary vindex columns. Invalid update on vindex: %v", vindex.Name)
+			// The rows are moved to the shards of the new values.
+			changedVindexes[vindex.Name] = vindexValues
+			continue
 		}
 		if _, ok := vindex.Vindex.(vindexes.Lookup); !ok {
 			return nil, vterrors.Errorf(vtrpcpb.Code_UNIMPLEMENTED, "unsupported: You can only update lookup vindexes. Invalid update on vindex: %v", vindex.Name)
@@ -196,17 +272,142 @@ func buildDeletePlan(del *sqlparser.Delete, vschema VSchema) (*engine.Delete, er
 	}
 
 	if edel.Opcode == engine.DeleteSharded {
-		if len(edel.Table.Owned) != 0 {
-			return edel, errors.New("unsupported: multi shard delete on a table with owned lookup vindexes")
+		if len(edel.Table.Owned) == 0 && del.Limit == nil {
+			return edel, nil
 		}
+		sel, key, err := buildMultiShardDMLSubquery(edel.Table, del.Where, del.OrderBy, del.Limit, &edel.OrderBy, &edel.Limit, &edel.KeyColumn)
+		if err != nil {
+			return nil, err
+		}
+		edel.OwnedVindexQuery = sqlparser.String(sel)
+		edel.KsidVindex = edel.Table.ColumnVindexes[0].Vindex
 		if del.Limit != nil {
-			return edel, errors.New("unsupported: multi shard delete with limit")
+			keyed := *del
+			keyed.Where = dmlKeysWhere(del.Where, key)
+			keyed.OrderBy = nil
+			keyed.Limit = nil
+			edel.Query = generateQuery(&keyed)
 		}
+		return edel, nil
 	}
 	edel.OwnedVindexQuery = generateDeleteSubquery(del, edel.Table)
 	return edel, nil
 }
 
+// buildMultiShardDMLSubquery builds the query that selects the rows
+// of a multi-shard DML for update. Its first columns are the primary
+// vindex columns, followed by the columns of the owned vindexes, and
+// by the expressions of the ORDER BY clause. It sets orderBy and limit
+// for vtgate to sort the rows of all the shards, and to keep only the
+// first ones.
+// With a limit, the ORDER BY clause must include a unique key, so that
+// the rows are in a total order: the shards then change the rows
+// that vtgate kept by their key, which is returned, and whose column
+// is set in ekeyColumn.
+func buildMultiShardDMLSubquery(table *vindexes.Table, where *sqlparser.Where, orderBy sqlparser.OrderBy, limit *sqlparser.Limit, eorderBy *[]engine.OrderbyParams, elimit **sqltypes.PlanValue, ekeyColumn *int) (*sqlparser.Select, sqlparser.ColIdent, error) {
+	sel := &sqlparser.Select{
+		From:    sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: sqlparser.TableName{Name: table.Name}}},
+		Where:   where,
+		OrderBy: orderBy,
+		Limit:   limit,
+		Lock:    sqlparser.ForUpdateStr,
+	}
+	for _, column := range table.ColumnVindexes[0].Columns {
+		sel.SelectExprs = append(sel.SelectExprs, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{Name: column}})
+	}
+	for _, cv := range table.Owned {
+		for _, column := range cv.Columns {
+			sel.SelectExprs = append(sel.SelectExprs, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{Name: column}})
+		}
+	}
+	for _, order := range orderBy {
+		*eorderBy = append(*eorderBy, engine.OrderbyParams{
+			Col:  findOrAddSelectColumn(sel, order.Expr),
+			Desc: order.Direction == sqlparser.DescScr,
+		})
+	}
+	var key sqlparser.ColIdent
+	if limit != nil {
+		if limit.Offset != nil {
+			return nil, key, errors.New("unsupported: offset in multi shard DML")
+		}
+		var ok bool
+		if key, ok = uniqueKey(table, orderBy); !ok {
+			return nil, key, errors.New("unsupported: limit in a multi shard DML requires an order by on the auto-increment column or on the column of an owned unique vindex")
+		}
+		*ekeyColumn = findOrAddSelectColumn(sel, &sqlparser.ColName{Name: key})
+		pv, err := sqlparser.NewPlanValue(limit.Rowcount)
+		if err != nil {
+			return nil, key, err
+		}
+		*elimit = &pv
+	}
+	return sel, key, nil
+}
+
+// uniqueKey returns the first column of orderBy that vtgate knows to
+// be unique in table: its auto-increment column, whose values come
+// from a sequence, or the column of one of its owned unique vindexes,
+// whose lookup table only accepts a value once.
+func uniqueKey(table *vindexes.Table, orderBy sqlparser.OrderBy) (sqlparser.ColIdent, bool) {
+	for _, order := range orderBy {
+		col, ok := order.Expr.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		if table.AutoIncrement != nil && col.Name.Equal(table.AutoIncrement.Column) {
+			return col.Name, true
+		}
+		for _, cv := range table.Owned {
+			if _, ok := cv.Vindex.(vindexes.Unique); ok && len(cv.Columns) == 1 && col.Name.Equal(cv.Columns[0]) {
+				return col.Name, true
+			}
+		}
+	}
+	return sqlparser.ColIdent{}, false
+}
+
+// findOrAddSelectColumn returns the position of expr in the select
+// list of sel. If it's absent, it's added to the list. Since sel
+// selects from a single table, columns are compared by name.
+func findOrAddSelectColumn(sel *sqlparser.Select, expr sqlparser.Expr) int {
+	for i, selectExpr := range sel.SelectExprs {
+		aliased, ok := selectExpr.(*sqlparser.AliasedExpr)
+		if !ok {
+			continue
+		}
+		if col, ok := expr.(*sqlparser.ColName); ok {
+			if nameMatch(aliased.Expr, col.Name) {
+				return i
+			}
+			continue
+		}
+		if sqlparser.String(aliased.Expr) == sqlparser.String(expr) {
+			return i
+		}
+	}
+	sel.SelectExprs = append(sel.SelectExprs, &sqlparser.AliasedExpr{Expr: expr})
+	return len(sel.SelectExprs) - 1
+}
+
+// dmlKeysWhere returns the WHERE clause of a DML with a limit for
+// a shard, which receives the unique keys of its rows.
+func dmlKeysWhere(where *sqlparser.Where, key sqlparser.ColIdent) *sqlparser.Where {
+	var expr sqlparser.Expr = &sqlparser.ComparisonExpr{
+		Operator: sqlparser.InStr,
+		Left:     &sqlparser.ColName{Name: key},
+		Right:    sqlparser.ListArg("::" + engine.DMLKeysVarName),
+	}
+	if where != nil {
+		left := where.Expr
+		if _, ok := left.(*sqlparser.OrExpr); ok {
+			left = &sqlparser.ParenExpr{Expr: left}
+		}
+		expr = &sqlparser.AndExpr{Left: left, Right: expr}
+	}
+	return &sqlparser.Where{Type: sqlparser.WhereStr, Expr: expr}
+}
+
 // generateDeleteSubquery generates the query to fetch the rows
 // that will be deleted. This allows VTGate to clean up any
 // owned vindexes as needed.
@@ -252,6 +453,13 @@ func getDMLRouting(where *sqlparser.Where, table *vindexes.Table) (vindexes.Vind
 		return nil, nil, errors.New("unsupported: multi-shard where clause in DML")
 	}
 	for _, index := range table.Ordered {
+		if vindexes.IsMultiColumn(index.Vindex) {
+			// A multi-column vindex needs a match on all its columns.
+			if pv, ok := getMultiMatch(where.Expr, index.Columns); ok {
+				return index.Vindex, []sqltypes.PlanValue{pv}, nil
+			}
+			continue
+		}
 		if !vindexes.IsUnique(index.Vindex) {
 			continue
 		}
@@ -273,6 +481,19 @@ func extractValueFromUpdate(upd *sqlparser.UpdateExpr, col sqlparser.ColIdent) (
 	return sqlparser.NewPlanValue(upd.Expr)
 }
 
+// getMultiMatch returns the matched values of cols, if there is
+// an equality constraint on each of them.
+func getMultiMatch(node sqlparser.Expr, cols []sqlparser.ColIdent) (pv sqltypes.PlanValue, ok bool) {
+	for _, col := range cols {
+		colpv, ok := getMatch(node, col)
+		if !ok {
+			return sqltypes.PlanValue{}, false
+		}
+		pv.Values = append(pv.Values, colpv)
+	}
+	return pv, true
+}
+
 // getMatch returns the matched value if there is an equality
 // constraint on the specified column that can be used to
 // decide on a route.
@@ -39,7 +39,7 @@ func buildInsertPlan(ins *sqlparser.Insert, vschema VSchema) (*engine.Insert, er
 	if ins.Action == sqlparser.ReplaceStr {
 		return nil, errors.New("unsupported: REPLACE INTO with sharded schema")
 	}
-	return buildInsertShardedPlan(ins, table)
+	return buildInsertShardedPlan(ins, table, vschema)
 }
 
 func buildInsertUnshardedPlan(ins *sqlparser.Insert, table *vindexes.Table, vschema VSchema) (*engine.Insert, error) {
@@ -85,7 +85,7 @@ func buildInsertUnshardedPlan(ins *sqlparser.Insert, table *vindexes.Table, vsch
 	return eins, nil
 }
 
-func buildInsertShardedPlan(ins *sqlparser.Insert, table *vindexes.Table) (*engine.Insert, error) {
+func buildInsertShardedPlan(ins *sqlparser.Insert, table *vindexes.Table, vschema VSchema) (*engine.Insert, error) {
 	eins := &engine.Insert{
 		Opcode:   engine.InsertSharded,
 		Table:    table,
@@ -106,7 +106,7 @@ func buildInsertShardedPlan(ins *sqlparser.Insert, table *vindexes.Table) (*engi
 	var rows sqlparser.Values
 	switch insertValues := ins.Rows.(type) {
 	case *sqlparser.Select, *sqlparser.Union:
-		return nil, errors.New("unsupported: insert into select")
+		return buildInsertSelectPlan(ins, eins, vschema)
 	case sqlparser.Values:
 		rows = insertValues
 		if hasSubquery(rows) {
@@ -152,6 +152,72 @@ func buildInsertShardedPlan(ins *sqlparser.Insert, table *vindexes.Table) (*engi
 	return eins, nil
 }
 
+// buildInsertSelectPlan builds the plan for an INSERT...SELECT into a
+// sharded table. The rows returned by the SELECT are routed at execution
+// time, like the rows of a VALUES clause. The vindex and auto-inc columns
+// that are not in the column list are added to it, and they're NULL for
+// every row.
+func buildInsertSelectPlan(ins *sqlparser.Insert, eins *engine.Insert, vschema VSchema) (*engine.Insert, error) {
+	eins.Opcode = engine.InsertSelect
+	if ins.Ignore != "" || ins.OnDup != nil {
+		eins.Opcode = engine.InsertSelectIgnore
+	}
+	colCount, err := selectColumnCount(ins.Rows.(sqlparser.SelectStatement))
+	if err != nil {
+		return nil, err
+	}
+	if colCount != len(ins.Columns) {
+		return nil, errors.New("column list doesn't match values")
+	}
+
+	eins.Query = generateQuery(ins)
+	switch sel := ins.Rows.(type) {
+	case *sqlparser.Select:
+		eins.Input, err = buildSelectPlan(sel, vschema)
+	case *sqlparser.Union:
+		eins.Input, err = buildUnionPlan(sel, vschema)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if eins.Table.AutoIncrement != nil {
+		eins.Generate = &engine.Generate{
+			Keyspace: eins.Table.AutoIncrement.Sequence.Keyspace,
+			Query:    fmt.Sprintf("select next :n values from %s", sqlparser.String(eins.Table.AutoIncrement.Sequence.Name)),
+			Offset:   findOrAddColumn(ins, eins.Table.AutoIncrement.Column),
+		}
+	}
+	eins.VindexValueOffset = make([][]int, len(eins.Table.ColumnVindexes))
+	for vIdx, colVindex := range eins.Table.ColumnVindexes {
+		eins.VindexValueOffset[vIdx] = make([]int, len(colVindex.Columns))
+		for colIdx, col := range colVindex.Columns {
+			eins.VindexValueOffset[vIdx][colIdx] = findOrAddColumn(ins, col)
+		}
+	}
+	generateInsertShardedQuery(ins, eins, nil)
+	return eins, nil
+}
+
+// selectColumnCount returns the number of columns returned by sel.
+// It fails if the number cannot be known, because of a '*' expression.
+func selectColumnCount(sel sqlparser.SelectStatement) (int, error) {
+	switch sel := sel.(type) {
+	case *sqlparser.Select:
+		for _, expr := range sel.SelectExprs {
+			if _, ok := expr.(*sqlparser.StarExpr); ok {
+				return 0, errors.New("unsupported: '*' expression in insert into select")
+			}
+		}
+		return len(sel.SelectExprs), nil
+	case *sqlparser.Union:
+		return selectColumnCount(sel.Left)
+	case *sqlparser.ParenSelect:
+		return selectColumnCount(sel.Select)
+	}
+	panic(fmt.Sprintf("BUG: unexpected construct in insert: %T", sel))
+}
+
 func generateInsertShardedQuery(node *sqlparser.Insert, eins *engine.Insert, valueTuples sqlparser.Values) {
 	prefixBuf := sqlparser.NewTrackedBuffer(dmlFormatter)
 	midBuf := sqlparser.NewTrackedBuffer(dmlFormatter)
@@ -205,6 +271,8 @@ func swapBindVariables(rows sqlparser.Values, colNum int, baseName string) (sqlt
 
 // findOrAddColumn finds the position of a column in the insert. If it's
 // absent it appends it to the with NULL values and returns that position.
+// For an INSERT...SELECT, the values are left out: the rows returned by
+// the SELECT are shorter than the column list.
 func findOrAddColumn(ins *sqlparser.Insert, col sqlparser.ColIdent) int {
 	for i, column := range ins.Columns {
 		if col.Equal(column) {
@@ -212,9 +280,10 @@ func findOrAddColumn(ins *sqlparser.Insert, col sqlparser.ColIdent) int {
 		}
 	}
 	ins.Columns = append(ins.Columns, col)
-	rows := ins.Rows.(sqlparser.Values)
-	for i := range rows {
-		rows[i] = append(rows[i], &sqlparser.NullVal{})
+	if rows, ok := ins.Rows.(sqlparser.Values); ok {
+		for i := range rows {
+			rows[i] = append(rows[i], &sqlparser.NullVal{})
+		}
 	}
 	return len(ins.Columns) - 1
 }
@@ -18,9 +18,11 @@ package planbuilder
 
 import (
 	"errors"
+	"fmt"
 
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 )
 
 var _ builder = (*join)(nil)
@@ -72,6 +74,19 @@ type join struct {
 	// Left and Right are the nodes for the join.
 	Left, Right builder
 
+	// filter contains the WHERE clause conditions that reference
+	// the right side of a left join. They cannot be pushed down
+	// to the right side, and are evaluated on the joined rows.
+	filter evalengine.Expr
+
+	// strategy is chosen during Wireup. For a hash join or a semi-join,
+	// leftKeys and rightKeys are the columns of the join keys, and
+	// listVar is the bind variable that passes the LHS keys of a
+	// semi-join to the RHS.
+	strategy            joinStrategy
+	leftKeys, rightKeys []int
+	listVar             string
+
 	ejoin *engine.Join
 }
 
@@ -147,7 +162,39 @@ func (jb *join) SetOrder(order int) {
 
 // Primitive satisfies the builder interface.
 func (jb *join) Primitive() engine.Primitive {
-	return jb.ejoin
+	// The primitives of the inputs may have been wrapped
+	// after the join was created. So, they're refreshed.
+	jb.ejoin.Left = jb.Left.Primitive()
+	jb.ejoin.Right = jb.Right.Primitive()
+	var primitive engine.Primitive = jb.ejoin
+	switch jb.strategy {
+	case hashJoin:
+		primitive = &engine.HashJoin{
+			Opcode:    jb.ejoin.Opcode,
+			Left:      jb.ejoin.Left,
+			Right:     jb.ejoin.Right,
+			Cols:      jb.ejoin.Cols,
+			LeftKeys:  jb.leftKeys,
+			RightKeys: jb.rightKeys,
+		}
+	case semiJoin:
+		primitive = &engine.SemiJoin{
+			Opcode:   jb.ejoin.Opcode,
+			Left:     jb.ejoin.Left,
+			Right:    jb.ejoin.Right,
+			Cols:     jb.ejoin.Cols,
+			ListVar:  jb.listVar,
+			LeftKey:  jb.leftKeys[0],
+			RightKey: jb.rightKeys[0],
+		}
+	}
+	if jb.filter != nil {
+		return &engine.Filter{
+			Predicate: jb.filter,
+			Input:     primitive,
+		}
+	}
+	return primitive
 }
 
 // Leftmost satisfies the builder interface.
@@ -166,11 +213,43 @@ func (jb *join) PushFilter(filter sqlparser.Expr, whereType string, origin colum
 		return jb.Left.PushFilter(filter, whereType, origin)
 	}
 	if jb.ejoin.Opcode == engine.LeftJoin {
-		return errors.New("unsupported: cross-shard left join and where clause")
+		return jb.pushPostFilter(filter, whereType)
 	}
 	return jb.Right.PushFilter(filter, whereType, origin)
 }
 
+// pushPostFilter adds a filter that references the right side of a left
+// join to the conditions that are evaluated on the joined rows. The columns
+// it references are added to the result of the join.
+func (jb *join) pushPostFilter(filter sqlparser.Expr, whereType string) error {
+	if whereType != sqlparser.WhereStr {
+		return fmt.Errorf("unsupported: cross-shard left join and %s clause", whereType)
+	}
+	expr, err := evalengine.Convert(filter, func(expr sqlparser.Expr) (int, error) {
+		col, ok := expr.(*sqlparser.ColName)
+		if !ok {
+			return 0, fmt.Errorf("unsupported: cross-shard left join and where clause: %s", sqlparser.String(expr))
+		}
+		// The column must come from within the join. This may not be
+		// the case for outer references, or for ON clauses of joins
+		// that contain this one.
+		origin, isLocal, _ := jb.Symtab().Find(col)
+		if !isLocal || origin.Order() < jb.Leftmost().Order() || origin.Order() > jb.rightMaxOrder {
+			return 0, fmt.Errorf("unsupported: cross-shard left join and where clause referencing %s", sqlparser.String(col))
+		}
+		_, colnum := jb.SupplyCol(col)
+		return colnum, nil
+	})
+	if err != nil {
+		return err
+	}
+	if jb.filter != nil {
+		expr = &evalengine.And{Left: jb.filter, Right: expr}
+	}
+	jb.filter = expr
+	return nil
+}
+
 // PushSelect satisfies the builder interface.
 func (jb *join) PushSelect(expr *sqlparser.AliasedExpr, origin columnOriginator) (rc *resultColumn, colnum int, err error) {
 	if jb.isOnLeft(origin.Order()) {
@@ -181,6 +260,7 @@ func (jb *join) PushSelect(expr *sqlparser.AliasedExpr, origin columnOriginator)
 		jb.ejoin.Cols = append(jb.ejoin.Cols, -colnum-1)
 	} else {
 		// Pushing of non-trivial expressions not allowed for RHS of left joins.
+		// They're instead evaluated by a projection.
 		if _, ok := expr.Expr.(*sqlparser.ColName); !ok && jb.ejoin.Opcode == engine.LeftJoin {
 			return nil, 0, errors.New("unsupported: cross-shard left join and column expressions")
 		}
@@ -222,6 +302,7 @@ func (jb *join) PushMisc(sel *sqlparser.Select) {
 
 // Wireup satisfies the builder interface.
 func (jb *join) Wireup(bldr builder, jt *jointab) error {
+	jb.chooseStrategy(bldr, jt)
 	err := jb.Right.Wireup(bldr, jt)
 	if err != nil {
 		return err
@@ -284,3 +365,19 @@ func (jb *join) SupplyCol(col *sqlparser.ColName) (rc *resultColumn, colnum int)
 func (jb *join) isOnLeft(nodeNum int) bool {
 	return nodeNum <= jb.leftMaxOrder
 }
+
+// isOnLeftJoinRHS returns true if the specified route number
+// is on the right side of a left join within bldr.
+func isOnLeftJoinRHS(bldr builder, nodeNum int) bool {
+	jb, ok := bldr.(*join)
+	if !ok {
+		return false
+	}
+	if jb.isOnLeft(nodeNum) {
+		return isOnLeftJoinRHS(jb.Left, nodeNum)
+	}
+	if jb.ejoin.Opcode == engine.LeftJoin {
+		return true
+	}
+	return isOnLeftJoinRHS(jb.Right, nodeNum)
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planbuilder
+
+import (
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// joinStrategy is the algorithm used to execute a join.
+type joinStrategy int
+
+const (
+	// nestedLoopJoin executes the RHS once for every LHS row.
+	// It's the default, and it's built as an engine.Join.
+	nestedLoopJoin = joinStrategy(iota)
+	// hashJoin executes the RHS once, and joins its rows
+	// in memory. It's built as an engine.HashJoin.
+	hashJoin
+	// semiJoin executes the RHS once for every batch of
+	// LHS keys. It's built as an engine.SemiJoin.
+	semiJoin
+)
+
+const (
+	// nestedLoopJoinMaxRows is the estimated number of LHS rows
+	// up to which a nested-loop join is preferred.
+	nestedLoopJoinMaxRows = 100
+	// hashJoinMaxRows is the estimated number of RHS rows
+	// up to which a hash join is preferred.
+	hashJoinMaxRows = 10000
+)
+
+// joinKey is an equality between a column of the LHS
+// and a column of the RHS of a join.
+type joinKey struct {
+	cond        *sqlparser.ComparisonExpr
+	left, right *sqlparser.ColName
+}
+
+// chooseStrategy chooses how the join is executed, and rewrites
+// its RHS accordingly. It must be called before the RHS is wired up.
+//
+// A nested-loop join is used unless the LHS is estimated to return
+// more than nestedLoopJoinMaxRows rows, and the RHS is a route whose
+// only references to the LHS are equalities between columns of both
+// sides in its WHERE clause. Those equalities become the join keys.
+// Their columns must both be numbers or both be binary strings, as
+// declared in the vschema: the join keys are compared byte by byte,
+// not by collation like text columns. A hash join is then used if the RHS is estimated to return at most
+// hashJoinMaxRows rows. Otherwise, a semi-join is used if there's a
+// single key. The row estimates come from the row_count of the tables
+// in the vschema.
+func (jb *join) chooseStrategy(bldr builder, jt *jointab) {
+	rb, ok := jb.Right.(*route)
+	if !ok {
+		return
+	}
+	if leftRows := estimateRows(jb.Left); leftRows == 0 || leftRows <= nestedLoopJoinMaxRows {
+		return
+	}
+	keys := jb.joinKeys(rb)
+	if len(keys) == 0 {
+		return
+	}
+	if rightRows := estimateRows(rb); rightRows != 0 && rightRows <= hashJoinMaxRows {
+		jb.useHashJoin(rb, keys)
+		return
+	}
+	if len(keys) == 1 {
+		jb.useSemiJoin(bldr, jt, rb, keys[0])
+	}
+}
+
+// joinKeys returns the join keys of the RHS route. It returns nil if
+// the route references the LHS in any other way.
+func (jb *join) joinKeys(rb *route) []joinKey {
+	sel, ok := rb.Select.(*sqlparser.Select)
+	if !ok || sel.Where == nil {
+		return nil
+	}
+	refs := 0
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && !rb.isLocal(col) {
+			refs++
+		}
+		return true, nil
+	}, sel)
+
+	var keys []joinKey
+	for _, filter := range splitAndExpression(nil, sel.Where.Expr) {
+		cond, ok := filter.(*sqlparser.ComparisonExpr)
+		if !ok || cond.Operator != sqlparser.EqualStr {
+			continue
+		}
+		left, ok := cond.Left.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		right, ok := cond.Right.(*sqlparser.ColName)
+		if !ok {
+			continue
+		}
+		if rb.isLocal(left) {
+			left, right = right, left
+		}
+		if rb.isLocal(left) || !rb.isLocal(right) {
+			continue
+		}
+		// The LHS column must come from within the join,
+		// and not from an outer query.
+		origin, isLocal, _ := jb.Symtab().Find(left)
+		if !isLocal || origin.Order() < jb.Leftmost().Order() || !jb.isOnLeft(origin.Order()) {
+			continue
+		}
+		if !hashableTypes(left.Metadata.(*column).typ, right.Metadata.(*column).typ) {
+			continue
+		}
+		keys = append(keys, joinKey{cond: cond, left: left, right: right})
+	}
+	if len(keys) != refs {
+		return nil
+	}
+	return keys
+}
+
+// hashableTypes returns true if columns of the types left and right
+// can be join keys of a hash join or a semi-join. Numbers are compared
+// by value, and binary strings byte by byte, like in MySQL. Text can't
+// be, because its collation may make different bytes equal, and the
+// type of the columns is unknown unless the vschema declares it.
+func hashableTypes(left, right querypb.Type) bool {
+	isNumber := func(typ querypb.Type) bool {
+		return sqltypes.IsIntegral(typ) || sqltypes.IsFloat(typ) || typ == sqltypes.Decimal
+	}
+	switch {
+	case isNumber(left) && isNumber(right):
+		return true
+	case sqltypes.IsBinary(left) && sqltypes.IsBinary(right):
+		return true
+	}
+	return false
+}
+
+// useHashJoin removes the join keys from the WHERE clause of the RHS,
+// which makes it independent from the LHS, and requests the key columns
+// from both sides.
+func (jb *join) useHashJoin(rb *route, keys []joinKey) {
+	replace := make(map[sqlparser.Expr]sqlparser.Expr)
+	for _, key := range keys {
+		replace[key.cond] = nil
+	}
+	jb.rewriteRHS(rb, keys, replace)
+	for _, key := range keys {
+		_, leftKey := jb.Left.SupplyCol(key.left)
+		_, rightKey := rb.SupplyCol(key.right)
+		jb.leftKeys = append(jb.leftKeys, leftKey)
+		jb.rightKeys = append(jb.rightKeys, rightKey)
+	}
+	jb.strategy = hashJoin
+}
+
+// useSemiJoin replaces the join key in the WHERE clause of the RHS
+// with an IN clause, whose list bind variable receives the LHS keys.
+func (jb *join) useSemiJoin(bldr builder, jt *jointab, rb *route, key joinKey) {
+	// Procure names the bind variable, and makes the LHS
+	// return the key column, like for a nested-loop join.
+	// The semi-join passes it as a list instead.
+	joinVar := jt.Procure(bldr, key.left, rb.Order())
+	jb.listVar = joinVar
+	jb.leftKeys = []int{jb.ejoin.Vars[joinVar]}
+	delete(jb.ejoin.Vars, joinVar)
+
+	jb.rewriteRHS(rb, []joinKey{key}, map[sqlparser.Expr]sqlparser.Expr{
+		key.cond: &sqlparser.ComparisonExpr{
+			Operator: sqlparser.InStr,
+			Left:     key.right,
+			Right:    sqlparser.ListArg("::" + joinVar),
+		},
+	})
+	_, rightKey := rb.SupplyCol(key.right)
+	jb.rightKeys = []int{rightKey}
+	jb.strategy = semiJoin
+}
+
+// rewriteRHS rebuilds the WHERE clause of the RHS route after replacing
+// its conditions as specified by replace. A nil replacement removes the
+// condition. If the route was using one of the keys for routing, its
+// plan is recomputed from the new conditions.
+func (jb *join) rewriteRHS(rb *route, keys []joinKey, replace map[sqlparser.Expr]sqlparser.Expr) {
+	sel := rb.Select.(*sqlparser.Select)
+	filters := splitAndExpression(nil, sel.Where.Expr)
+	sel.Where = nil
+	var newFilters []sqlparser.Expr
+	for _, filter := range filters {
+		if newFilter, ok := replace[filter]; ok {
+			if newFilter == nil {
+				continue
+			}
+			filter = newFilter
+		}
+		sel.AddWhere(filter)
+		newFilters = append(newFilters, filter)
+	}
+
+	for _, key := range keys {
+		if rb.condition != key.left {
+			continue
+		}
+		rb.updateRoute(engine.SelectScatter, nil, nil)
+		for _, filter := range newFilters {
+			rb.UpdatePlan(filter)
+		}
+		return
+	}
+}
+
+// estimateRows returns the estimated number of rows returned by bldr,
+// or 0 if it's unknown. It's only known for routes whose tables all
+// have a row count in the vschema.
+func estimateRows(bldr builder) int64 {
+	rb, ok := bldr.(*route)
+	if !ok {
+		return 0
+	}
+	if rb.ERoute.Opcode == engine.SelectEqualUnique {
+		// A unique vindex returns at most one row per table,
+		// unless the value comes from another route.
+		if _, ok := rb.condition.(*sqlparser.ColName); !ok {
+			return 1
+		}
+	}
+	var rows int64
+	for _, t := range rb.Symtab().tables {
+		if origin, ok := t.origin.(*route); !ok || origin.Resolve() != rb {
+			continue
+		}
+		if t.vindexTable == nil || t.vindexTable.RowCount == 0 {
+			return 0
+		}
+		if t.vindexTable.RowCount > rows {
+			rows = t.vindexTable.RowCount
+		}
+	}
+	return rows
+}
@@ -24,6 +24,7 @@ import (
 	"vitess.io/vitess/go/sqltypes"
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
 	"vitess.io/vitess/go/vt/vtgate/vindexes"
 )
 
@@ -54,12 +55,43 @@ var _ builder = (*orderedAggregate)(nil)
 //      Keys: []int{0, 1},
 //      Input: (Scatter Route with the order by request),
 //    }
+//
+// Some constructs require the route to return columns that are
+// not in the select list: group by expressions that were not selected,
+// the count for an AVG, which is sent as a SUM, and aggregates that
+// are referenced only by the HAVING clause. These columns are added
+// after the select list, and truncated from the final result.
 type orderedAggregate struct {
 	symtab        *symtab
 	resultColumns []*resultColumn
 	order         int
 	input         *route
 	eaggr         *engine.OrderedAggregate
+
+	// aggrColumns maps the text of the aggregate functions of
+	// the select list to their column numbers. It's used to
+	// resolve the aggregates referenced by the HAVING clause.
+	aggrColumns map[string]int
+
+	// avgs contains the AVG aggregates for which the count
+	// column must still be pushed to the route.
+	avgs []*avgAggregate
+
+	// extraDistinct is the argument of the distinct aggregate,
+	// if any. The route has to group and order by this expression
+	// after the group by keys. distinctCol is its column number.
+	extraDistinct sqlparser.Expr
+	distinctCol   int
+
+	// groupBy is the group by clause that will be sent to
+	// the route.
+	groupBy sqlparser.GroupBy
+}
+
+// avgAggregate identifies an AVG aggregate and its arguments.
+type avgAggregate struct {
+	index int
+	exprs sqlparser.SelectExprs
 }
 
 // checkAggregates analyzes the select expression for aggregates. If it determines
@@ -127,10 +159,11 @@ func checkAggregates(sel *sqlparser.Select, bldr builder) (builder, error) {
 
 	// We need an aggregator primitive.
 	return &orderedAggregate{
-		symtab: rb.Symtab(),
-		order:  rb.Order() + 1,
-		input:  rb,
-		eaggr:  &engine.OrderedAggregate{},
+		symtab:      rb.Symtab(),
+		order:       rb.Order() + 1,
+		input:       rb,
+		eaggr:       &engine.OrderedAggregate{},
+		aggrColumns: make(map[string]int),
 	}, nil
 }
 
@@ -267,8 +300,63 @@ func (oa *orderedAggregate) ResultColumns() []*resultColumn {
 }
 
 // PushFilter satisfies the builder interface.
-func (oa *orderedAggregate) PushFilter(_ sqlparser.Expr, whereType string, _ columnOriginator) error {
-	return errors.New("unsupported: filtering on results of aggregates")
+// Only HAVING clauses can be pushed into oa. A condition that does not
+// reference aggregates is the same for all the rows of a group. So, it
+// can be evaluated by the underlying route. Otherwise, oa evaluates
+// the condition after the aggregation.
+func (oa *orderedAggregate) PushFilter(filter sqlparser.Expr, whereType string, origin columnOriginator) error {
+	if whereType != sqlparser.HavingStr {
+		return errors.New("unsupported: filtering on results of aggregates")
+	}
+	if origin != oa && !nodeHasAggregates(filter) {
+		return oa.input.PushFilter(filter, whereType, origin)
+	}
+
+	having, err := evalengine.Convert(filter, oa.havingColumn)
+	if err != nil {
+		return err
+	}
+	if oa.eaggr.Having != nil {
+		having = &evalengine.And{Left: oa.eaggr.Having, Right: having}
+	}
+	oa.eaggr.Having = having
+	return nil
+}
+
+// havingColumn returns the column number of a column or an aggregate
+// referenced by a HAVING condition. Aggregates that are not in the
+// select list are added as extra columns.
+func (oa *orderedAggregate) havingColumn(expr sqlparser.Expr) (int, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.ColName:
+		c := expr.Metadata.(*column)
+		for i, rc := range oa.resultColumns {
+			if rc.column == c {
+				return i, nil
+			}
+		}
+		if c.Origin() == oa.input {
+			_, colnum, _ := oa.input.PushSelect(&sqlparser.AliasedExpr{Expr: expr}, oa.input)
+			return colnum, nil
+		}
+	case *sqlparser.FuncExpr:
+		if _, ok := engine.SupportedAggregates[expr.Name.Lowered()]; !ok {
+			break
+		}
+		if colnum, ok := oa.aggrColumns[sqlparser.String(expr)]; ok {
+			return colnum, nil
+		}
+		if expr.Distinct {
+			return 0, fmt.Errorf("unsupported: in scatter query: distinct aggregate in having must be in the select list: %s", sqlparser.String(expr))
+		}
+		_, colnum, err := oa.pushAggregate(&sqlparser.AliasedExpr{Expr: expr}, oa.input)
+		if err != nil {
+			return 0, err
+		}
+		oa.pushAvgCounts()
+		return colnum, nil
+	}
+	return 0, fmt.Errorf("unsupported: in scatter query: complex having expression: %s", sqlparser.String(expr))
 }
 
 // PushSelect satisfies the builder interface.
@@ -285,20 +373,14 @@ func (oa *orderedAggregate) PushFilter(_ sqlparser.Expr, whereType string, _ col
 // the rows be correctly ordered for a merge sort.
 func (oa *orderedAggregate) PushSelect(expr *sqlparser.AliasedExpr, origin columnOriginator) (rc *resultColumn, colnum int, err error) {
 	if inner, ok := expr.Expr.(*sqlparser.FuncExpr); ok {
-		if opcode, ok := engine.SupportedAggregates[inner.Name.Lowered()]; ok {
-			innerRC, innerCol, _ := oa.input.PushSelect(expr, origin)
-
-			// Add to Aggregates.
-			oa.eaggr.Aggregates = append(oa.eaggr.Aggregates, engine.AggregateParams{
-				Opcode: opcode,
-				Col:    innerCol,
-			})
-
-			// Build a new rc with oa as origin because it's semantically different
-			// from the expression we pushed down.
-			rc := &resultColumn{alias: innerRC.alias, column: &column{origin: oa}}
+		if _, ok := engine.SupportedAggregates[inner.Name.Lowered()]; ok {
+			rc, colnum, err := oa.pushAggregate(expr, origin)
+			if err != nil {
+				return nil, 0, err
+			}
 			oa.resultColumns = append(oa.resultColumns, rc)
-			return rc, len(oa.resultColumns) - 1, nil
+			oa.aggrColumns[sqlparser.String(inner)] = colnum
+			return rc, colnum, nil
 		}
 	}
 
@@ -312,6 +394,97 @@ func (oa *orderedAggregate) PushSelect(expr *sqlparser.AliasedExpr, origin colum
 	return innerRC, len(oa.resultColumns) - 1, nil
 }
 
+// pushAggregate pushes the aggregate function to the route and adds
+// the corresponding entry to the Aggregates. The returned resultColumn
+// is not added to oa.resultColumns.
+// COUNT(DISTINCT expr) and SUM(DISTINCT expr) are sent as 'expr', which the
+// route groups and orders by. AVG(expr) is sent as SUM(expr). The COUNT(expr)
+// it also requires is pushed later by pushAvgCounts.
+func (oa *orderedAggregate) pushAggregate(expr *sqlparser.AliasedExpr, origin columnOriginator) (rc *resultColumn, colnum int, err error) {
+	funcExpr := expr.Expr.(*sqlparser.FuncExpr)
+	opcode := engine.SupportedAggregates[funcExpr.Name.Lowered()]
+	alias := expr.As.String()
+	if alias == "" {
+		alias = sqlparser.String(funcExpr)
+	}
+
+	var innerCol int
+	aggr := engine.AggregateParams{Opcode: opcode}
+	switch {
+	case funcExpr.Distinct && (opcode == engine.AggregateCount || opcode == engine.AggregateSum):
+		innerAliased, ok := funcExpr.Exprs[0].(*sqlparser.AliasedExpr)
+		if len(funcExpr.Exprs) != 1 || !ok {
+			return nil, 0, fmt.Errorf("unsupported: only one expression allowed inside aggregates: %s", sqlparser.String(funcExpr))
+		}
+		if oa.extraDistinct != nil {
+			return nil, 0, fmt.Errorf("unsupported: only one distinct aggregation allowed in a select: %s", sqlparser.String(funcExpr))
+		}
+		_, innerCol, _ = oa.input.PushSelect(&sqlparser.AliasedExpr{Expr: innerAliased.Expr}, origin)
+		oa.extraDistinct = innerAliased.Expr
+		oa.distinctCol = innerCol
+		oa.eaggr.HasDistinct = true
+		if opcode == engine.AggregateCount {
+			aggr.Opcode = engine.AggregateCountDistinct
+		} else {
+			aggr.Opcode = engine.AggregateSumDistinct
+		}
+		aggr.Alias = alias
+	case opcode == engine.AggregateAvg:
+		if funcExpr.Distinct {
+			return nil, 0, fmt.Errorf("unsupported: in scatter query: avg(distinct): %s", sqlparser.String(funcExpr))
+		}
+		sum := &sqlparser.FuncExpr{
+			Name:  sqlparser.NewColIdent("sum"),
+			Exprs: funcExpr.Exprs,
+		}
+		_, innerCol, _ = oa.input.PushSelect(&sqlparser.AliasedExpr{Expr: sum, As: expr.As}, origin)
+		oa.avgs = append(oa.avgs, &avgAggregate{
+			index: len(oa.eaggr.Aggregates),
+			exprs: funcExpr.Exprs,
+		})
+		aggr.Alias = alias
+	default:
+		_, innerCol, _ = oa.input.PushSelect(expr, origin)
+	}
+
+	// Add to Aggregates.
+	aggr.Col = innerCol
+	oa.eaggr.Aggregates = append(oa.eaggr.Aggregates, aggr)
+
+	// Build a new rc with oa as origin because it's semantically different
+	// from the expression we pushed down.
+	return &resultColumn{alias: expr.As, column: &column{origin: oa}}, innerCol, nil
+}
+
+// pushAvgCounts pushes the COUNT that each pending AVG needs. The
+// counts are not part of the select list. So, this must be done after
+// all the select expressions are pushed.
+func (oa *orderedAggregate) pushAvgCounts() {
+	for _, avg := range oa.avgs {
+		count := &sqlparser.FuncExpr{
+			Name:  sqlparser.NewColIdent("count"),
+			Exprs: avg.exprs,
+		}
+		_, countCol, _ := oa.input.PushSelect(&sqlparser.AliasedExpr{Expr: count}, oa.input)
+		oa.eaggr.Aggregates[avg.index].CountCol = countCol
+	}
+	oa.avgs = nil
+}
+
+// CompleteSelect pushes the constructs that depend on the entire select
+// list: the counts for AVG, and the group by clause, which needs the
+// argument of the distinct aggregate, if any.
+func (oa *orderedAggregate) CompleteSelect() {
+	oa.pushAvgCounts()
+	groupBy := oa.groupBy
+	if oa.extraDistinct != nil {
+		groupBy = append(groupBy, oa.extraDistinct)
+	}
+	if len(groupBy) != 0 {
+		_ = oa.input.SetGroupBy(groupBy)
+	}
+}
+
 func (oa *orderedAggregate) MakeDistinct() error {
 	for i, rc := range oa.resultColumns {
 		// If the column origin is oa (and not the underlying route),
@@ -327,9 +500,11 @@ func (oa *orderedAggregate) MakeDistinct() error {
 }
 
 // SetGroupBy satisfies the builder interface.
+// Group by expressions that are not in the select list are added
+// as extra columns.
 func (oa *orderedAggregate) SetGroupBy(groupBy sqlparser.GroupBy) error {
-	colnum := -1
 	for _, expr := range groupBy {
+		colnum := -1
 		switch node := expr.(type) {
 		case *sqlparser.ColName:
 			c := node.Metadata.(*column)
@@ -342,9 +517,6 @@ func (oa *orderedAggregate) SetGroupBy(groupBy sqlparser.GroupBy) error {
 					break
 				}
 			}
-			if colnum == -1 {
-				return errors.New("unsupported: in scatter query: group by column must reference column in SELECT list")
-			}
 		case *sqlparser.SQLVal:
 			num, err := ResultFromNumber(oa.resultColumns, node)
 			if err != nil {
@@ -352,15 +524,41 @@ func (oa *orderedAggregate) SetGroupBy(groupBy sqlparser.GroupBy) error {
 			}
 			colnum = num
 		default:
-			return errors.New("unsupported: in scatter query: only simple references allowed")
+			if err := oa.checkGroupByExpr(node); err != nil {
+				return err
+			}
+			text := sqlparser.String(node)
+			for i, selectExpr := range oa.input.Select.(*sqlparser.Select).SelectExprs[:len(oa.resultColumns)] {
+				if aliased, ok := selectExpr.(*sqlparser.AliasedExpr); ok && sqlparser.String(aliased.Expr) == text {
+					colnum = i
+					break
+				}
+			}
+		}
+		if colnum == -1 {
+			_, colnum, _ = oa.input.PushSelect(&sqlparser.AliasedExpr{Expr: expr}, oa.input)
 		}
 		oa.eaggr.Keys = append(oa.eaggr.Keys, colnum)
 	}
 
-	_ = oa.input.SetGroupBy(groupBy)
+	oa.groupBy = groupBy
 	return nil
 }
 
+// checkGroupByExpr verifies that a complex group by expression
+// does not reference aggregates.
+func (oa *orderedAggregate) checkGroupByExpr(expr sqlparser.Expr) error {
+	if nodeHasAggregates(expr) {
+		return fmt.Errorf("group by expression cannot reference an aggregate function: %v", sqlparser.String(expr))
+	}
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if col, ok := node.(*sqlparser.ColName); ok && col.Metadata.(*column).Origin() == oa {
+			return false, fmt.Errorf("group by expression cannot reference an aggregate function: %v", sqlparser.String(expr))
+		}
+		return true, nil
+	}, expr)
+}
+
 // PushOrderBy pushes the order by expression into the primitive.
 // The requested order must be such that the ordering can be done
 // before the group by, which will allow us to push it down to the
@@ -431,17 +629,30 @@ func (oa *orderedAggregate) PushOrderBy(orderBy sqlparser.OrderBy) error {
 		if referenced[i] {
 			continue
 		}
-		// Build a brand new reference for the key.
-		col, err := oa.input.BuildColName(key)
-		if err != nil {
-			return fmt.Errorf("generating order by clause: %v", err)
-		}
-		order := &sqlparser.Order{Expr: col, Direction: sqlparser.AscScr}
-		oa.input.PushOrderBy(order)
+		oa.pushOrderByColumn(key)
+	}
+	// Rows with the same keys must also be ordered by the distinct value.
+	if oa.extraDistinct != nil {
+		oa.pushOrderByColumn(oa.distinctCol)
 	}
 	return nil
 }
 
+// pushOrderByColumn requests the route to order by the specified
+// column. A brand new reference is built for the column. If the column
+// is a complex expression or its name is ambiguous, the column number
+// is used instead.
+func (oa *orderedAggregate) pushOrderByColumn(colnum int) {
+	var expr sqlparser.Expr
+	col, err := oa.input.BuildColName(colnum)
+	if err == nil {
+		expr = col
+	} else {
+		expr = sqlparser.NewIntVal([]byte(strconv.Itoa(colnum + 1)))
+	}
+	oa.input.PushOrderBy(&sqlparser.Order{Expr: expr, Direction: sqlparser.AscScr})
+}
+
 // PushOrderByNull satisfies the builder interface.
 func (oa *orderedAggregate) PushOrderByNull() {
 	panic("BUG: unreachable")
@@ -453,7 +664,14 @@ func (oa *orderedAggregate) PushOrderByRand() {
 }
 
 // SetUpperLimit satisfies the builder interface.
+// The limit can be pushed down only if every row returned by the
+// route becomes a row of the result. This is not the case if the
+// route also groups by the distinct value, or if some of the groups
+// can be filtered out by the HAVING clause.
 func (oa *orderedAggregate) SetUpperLimit(count *sqlparser.SQLVal) {
+	if oa.extraDistinct != nil || oa.eaggr.Having != nil {
+		return
+	}
 	oa.input.SetUpperLimit(count)
 }
 
@@ -467,14 +685,16 @@ func (oa *orderedAggregate) PushMisc(sel *sqlparser.Select) {
 // the primitive to pull a corresponding weight_string from mysql and
 // compare those instead. This is because we currently don't have the
 // ability to mimic mysql's collation behavior.
+// Any column that was added beyond the select list is truncated.
 func (oa *orderedAggregate) Wireup(bldr builder, jt *jointab) error {
 	for i, colnum := range oa.eaggr.Keys {
-		if sqltypes.IsText(oa.resultColumns[colnum].column.typ) {
-			// len(oa.resultColumns) does not change. No harm using the value multiple times.
-			oa.eaggr.TruncateColumnCount = len(oa.resultColumns)
+		if sqltypes.IsText(oa.input.ResultColumns()[colnum].column.typ) {
 			oa.eaggr.Keys[i] = oa.input.SupplyWeightString(colnum)
 		}
 	}
+	if len(oa.input.ResultColumns()) > len(oa.resultColumns) {
+		oa.eaggr.TruncateColumnCount = len(oa.resultColumns)
+	}
 	return oa.input.Wireup(bldr, jt)
 }
 
@@ -0,0 +1,193 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package planbuilder
+
+import (
+	"fmt"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/evalengine"
+)
+
+var _ builder = (*projection)(nil)
+
+// projection is the builder for engine.Projection.
+// It's built on top of a join, and it computes the select
+// expressions that cannot be pushed down, like expressions
+// that reference the right side of a left join. It also
+// drops the columns that the join returns only to be used
+// by vtgate, like the ones needed by its filter.
+// If the projection turns out to only copy the columns
+// of the join, it's omitted from the plan.
+type projection struct {
+	symtab        *symtab
+	resultColumns []*resultColumn
+	input         builder
+	eprojection   *engine.Projection
+}
+
+// newProjection builds a new projection.
+func newProjection(bldr builder) *projection {
+	return &projection{
+		symtab:      bldr.Symtab(),
+		input:       bldr,
+		eprojection: &engine.Projection{},
+	}
+}
+
+// Symtab satisfies the builder interface.
+func (pb *projection) Symtab() *symtab {
+	return pb.symtab.Resolve()
+}
+
+// MaxOrder satisfies the builder interface.
+func (pb *projection) MaxOrder() int {
+	return pb.input.MaxOrder()
+}
+
+// SetOrder satisfies the builder interface.
+func (pb *projection) SetOrder(order int) {
+	pb.input.SetOrder(order)
+}
+
+// Primitive satisfies the builder interface.
+func (pb *projection) Primitive() engine.Primitive {
+	input := pb.input.Primitive()
+	if pb.isIdentity() {
+		return input
+	}
+	pb.eprojection.Input = input
+	return pb.eprojection
+}
+
+// isIdentity returns true if the projection
+// returns the columns of its input unchanged.
+func (pb *projection) isIdentity() bool {
+	if len(pb.eprojection.Exprs) != len(pb.input.ResultColumns()) {
+		return false
+	}
+	for i, expr := range pb.eprojection.Exprs {
+		if col, ok := expr.(*evalengine.Column); !ok || col.Offset != i {
+			return false
+		}
+	}
+	return true
+}
+
+// Leftmost satisfies the builder interface.
+func (pb *projection) Leftmost() columnOriginator {
+	return pb.input.Leftmost()
+}
+
+// ResultColumns satisfies the builder interface.
+func (pb *projection) ResultColumns() []*resultColumn {
+	return pb.resultColumns
+}
+
+// PushFilter satisfies the builder interface.
+func (pb *projection) PushFilter(filter sqlparser.Expr, whereType string, origin columnOriginator) error {
+	return pb.input.PushFilter(filter, whereType, origin)
+}
+
+// PushSelect satisfies the builder interface.
+// Column names, and expressions that can be computed by
+// a route, are pushed down. The other expressions are
+// evaluated from the columns they reference.
+func (pb *projection) PushSelect(expr *sqlparser.AliasedExpr, origin columnOriginator) (rc *resultColumn, colnum int, err error) {
+	name := expr.As.String()
+	if _, ok := expr.Expr.(*sqlparser.ColName); ok || !isOnLeftJoinRHS(pb.input, origin.Order()) {
+		rc, colnum, err = pb.input.PushSelect(expr, origin)
+		if err != nil {
+			return nil, 0, err
+		}
+		if name == "" {
+			name = rc.alias.String()
+		}
+		return pb.addColumn(rc, &evalengine.Column{Offset: colnum}, name)
+	}
+
+	converted, err := evalengine.Convert(expr.Expr, func(expr sqlparser.Expr) (int, error) {
+		col, ok := expr.(*sqlparser.ColName)
+		if !ok {
+			return 0, fmt.Errorf("unsupported: cross-shard left join and column expressions: %s", sqlparser.String(expr))
+		}
+		if _, isLocal, _ := pb.Symtab().Find(col); !isLocal {
+			return 0, fmt.Errorf("unsupported: cross-shard left join and column expressions referencing %s", sqlparser.String(col))
+		}
+		_, colnum := pb.input.SupplyCol(col)
+		return colnum, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if name == "" {
+		name = sqlparser.String(expr.Expr)
+	}
+	return pb.addColumn(pb.Symtab().NewResultColumn(expr, origin), converted, name)
+}
+
+// addColumn adds a column to the result, and returns its offset.
+func (pb *projection) addColumn(rc *resultColumn, expr evalengine.Expr, name string) (*resultColumn, int, error) {
+	pb.eprojection.Exprs = append(pb.eprojection.Exprs, expr)
+	pb.eprojection.Cols = append(pb.eprojection.Cols, name)
+	pb.resultColumns = append(pb.resultColumns, rc)
+	return rc, len(pb.resultColumns) - 1, nil
+}
+
+// PushOrderByNull satisfies the builder interface.
+func (pb *projection) PushOrderByNull() {
+	pb.input.PushOrderByNull()
+}
+
+// PushOrderByRand satisfies the builder interface.
+func (pb *projection) PushOrderByRand() {
+	pb.input.PushOrderByRand()
+}
+
+// SetUpperLimit satisfies the builder interface.
+func (pb *projection) SetUpperLimit(count *sqlparser.SQLVal) {
+	pb.input.SetUpperLimit(count)
+}
+
+// PushMisc satisfies the builder interface.
+func (pb *projection) PushMisc(sel *sqlparser.Select) {
+	pb.input.PushMisc(sel)
+}
+
+// Wireup satisfies the builder interface.
+func (pb *projection) Wireup(bldr builder, jt *jointab) error {
+	return pb.input.Wireup(bldr, jt)
+}
+
+// SupplyVar satisfies the builder interface.
+func (pb *projection) SupplyVar(from, to int, col *sqlparser.ColName, varname string) {
+	pb.input.SupplyVar(from, to, col, varname)
+}
+
+// SupplyCol satisfies the builder interface.
+func (pb *projection) SupplyCol(col *sqlparser.ColName) (rc *resultColumn, colnum int) {
+	c := col.Metadata.(*column)
+	for i, rc := range pb.resultColumns {
+		if rc.column == c {
+			return rc, i
+		}
+	}
+	rc, colnum = pb.input.SupplyCol(col)
+	rc, colnum, _ = pb.addColumn(rc, &evalengine.Column{Offset: colnum}, rc.alias.String())
+	return rc, colnum
+}
@@ -62,10 +62,33 @@ type route struct {
 	// are added to be used for collation of text columns.
 	weightStrings map[*resultColumn]int
 
+	// hiddenOrderBy contains the ORDER BY expressions of a scatter
+	// route that are not in the select list. They're added as extra
+	// columns during wireup, once the select list is final.
+	hiddenOrderBy []hiddenOrderBy
+
+	// multiColumnValues keeps the values of the equality filters on
+	// the columns of multi-column vindexes, in the order of the columns.
+	// The route is computed on the leading columns that have a value.
+	multiColumnValues map[multiColumnKey][]sqlparser.Expr
+
 	// ERoute is the primitive being built.
 	ERoute *engine.Route
 }
 
+// multiColumnKey identifies a multi-column vindex of a table of the route.
+type multiColumnKey struct {
+	table     *table
+	colVindex *vindexes.ColumnVindex
+}
+
+// hiddenOrderBy is an ORDER BY expression that's not in the select
+// list. order is the index of its entry in ERoute.OrderBy.
+type hiddenOrderBy struct {
+	order int
+	expr  sqlparser.Expr
+}
+
 func newRoute(stmt sqlparser.SelectStatement, eroute *engine.Route, condition sqlparser.Expr, vschema VSchema) *route {
 	rb := &route{
 		Select:        stmt,
@@ -332,7 +355,10 @@ func (rb *route) computeEqualPlan(comparison *sqlparser.ComparisonExpr) (opcode
 		left, right = right, left
 		vindex = rb.Symtab().Vindex(left, rb)
 		if vindex == nil {
-			return engine.SelectScatter, nil, nil
+			if opcode, vindex, condition = rb.computeMultiColumnPlan(comparison.Left, comparison.Right); vindex != nil {
+				return opcode, vindex, condition
+			}
+			return rb.computeMultiColumnPlan(comparison.Right, comparison.Left)
 		}
 	}
 	if !rb.exprIsValue(right) {
@@ -344,6 +370,49 @@ func (rb *route) computeEqualPlan(comparison *sqlparser.ComparisonExpr) (opcode
 	return engine.SelectEqual, vindex, right
 }
 
+// computeMultiColumnPlan computes the plan for an equality constraint
+// between expr, if it's a column of a multi-column vindex, and val.
+// The value is kept, and the plan is computed on the values of the
+// leading columns of the vindex: if only some of them are known,
+// the route scatters over the keyrange they map to.
+func (rb *route) computeMultiColumnPlan(expr, val sqlparser.Expr) (opcode engine.RouteOpcode, vindex vindexes.Vindex, condition sqlparser.Expr) {
+	col, ok := expr.(*sqlparser.ColName)
+	if !ok || col.Metadata == nil {
+		return engine.SelectScatter, nil, nil
+	}
+	c := col.Metadata.(*column)
+	if len(c.multiColumns) == 0 || c.Origin() != rb || !rb.exprIsValue(val) {
+		return engine.SelectScatter, nil, nil
+	}
+	if rb.multiColumnValues == nil {
+		rb.multiColumnValues = make(map[multiColumnKey][]sqlparser.Expr)
+	}
+	opcode = engine.SelectScatter
+	for _, ref := range c.multiColumns {
+		key := multiColumnKey{table: c.table, colVindex: ref.colVindex}
+		values := rb.multiColumnValues[key]
+		if values == nil {
+			values = make([]sqlparser.Expr, len(ref.colVindex.Columns))
+			rb.multiColumnValues[key] = values
+		}
+		values[ref.index] = val
+		var prefix sqlparser.ValTuple
+		for _, v := range values {
+			if v == nil {
+				break
+			}
+			prefix = append(prefix, v)
+		}
+		switch {
+		case len(prefix) == len(values):
+			return engine.SelectEqualUnique, ref.colVindex.Vindex, prefix
+		case len(prefix) != 0 && opcode == engine.SelectScatter:
+			opcode, vindex, condition = engine.SelectEqual, ref.colVindex.Vindex, prefix
+		}
+	}
+	return opcode, vindex, condition
+}
+
 // computeINPlan computes the plan for an IN constraint.
 func (rb *route) computeINPlan(comparison *sqlparser.ComparisonExpr) (opcode engine.RouteOpcode, vindex vindexes.Vindex, condition sqlparser.Expr) {
 	vindex = rb.Symtab().Vindex(comparison.Left, rb)
@@ -434,13 +503,21 @@ func (rb *route) PushOrderBy(order *sqlparser.Order) error {
 				break
 			}
 		}
-	default:
-		return fmt.Errorf("unsupported: in scatter query: complex order by expression: %s", sqlparser.String(expr))
 	}
 	// If column is not found, then the order by is referencing
-	// a column that's not on the select list.
+	// an expression that's not on the select list. It will be
+	// added as an extra column.
 	if colnum == -1 {
-		return fmt.Errorf("unsupported: in scatter query: order by must reference a column in the select list: %s", sqlparser.String(order))
+		if !rb.canAddColumns() {
+			if _, ok := order.Expr.(*sqlparser.ColName); ok {
+				return fmt.Errorf("unsupported: in scatter query: order by must reference a column in the select list: %s", sqlparser.String(order))
+			}
+			return fmt.Errorf("unsupported: in scatter query: complex order by expression: %s", sqlparser.String(order.Expr))
+		}
+		rb.hiddenOrderBy = append(rb.hiddenOrderBy, hiddenOrderBy{
+			order: len(rb.ERoute.OrderBy),
+			expr:  order.Expr,
+		})
 	}
 	rb.ERoute.OrderBy = append(rb.ERoute.OrderBy, engine.OrderbyParams{
 		Col:  colnum,
@@ -451,6 +528,23 @@ func (rb *route) PushOrderBy(order *sqlparser.Order) error {
 	return nil
 }
 
+// canAddColumns returns true if columns that are not part of the
+// result can be added to the select list. This is not possible
+// if the select list has a '*' expression, because the number of
+// columns it expands to is not known.
+func (rb *route) canAddColumns() bool {
+	sel, ok := rb.Select.(*sqlparser.Select)
+	if !ok {
+		return false
+	}
+	for _, expr := range sel.SelectExprs {
+		if _, ok := expr.(*sqlparser.StarExpr); ok {
+			return false
+		}
+	}
+	return true
+}
+
 // PushOrderByNull satisfies the builder interface.
 func (rb *route) PushOrderByNull() {
 	rb.Select.(*sqlparser.Select).OrderBy = sqlparser.OrderBy{&sqlparser.Order{Expr: &sqlparser.NullVal{}}}
@@ -505,11 +599,32 @@ func (rb *route) Wireup(bldr builder, jt *jointab) error {
 		}
 	}
 
+	// Add the ORDER BY expressions that are not in the select list.
+	// Like weight strings, they're not added to resultColumns, and
+	// are truncated from the result.
+	for _, hidden := range rb.hiddenOrderBy {
+		rb.ERoute.TruncateColumnCount = len(rb.resultColumns)
+		expr := hidden.expr
+		if col, ok := expr.(*sqlparser.ColName); ok && sqltypes.IsText(col.Metadata.(*column).typ) {
+			expr = &sqlparser.FuncExpr{
+				Name:  sqlparser.NewColIdent("weight_string"),
+				Exprs: []sqlparser.SelectExpr{&sqlparser.AliasedExpr{Expr: expr}},
+			}
+		}
+		sel := rb.Select.(*sqlparser.Select)
+		sel.SelectExprs = append(sel.SelectExprs, &sqlparser.AliasedExpr{Expr: expr})
+		rb.ERoute.OrderBy[hidden.order].Col = len(sel.SelectExprs) - 1
+	}
+
 	// If rb has to do the ordering, and if any columns are Text,
 	// we have to request the corresponding weight_string from mysql
 	// and use that value instead. This is because we cannot mimic
 	// mysql's collation behavior yet.
 	for i, orderby := range rb.ERoute.OrderBy {
+		if orderby.Col >= len(rb.resultColumns) {
+			// This is a hidden ORDER BY expression.
+			continue
+		}
 		rc := rb.resultColumns[orderby.Col]
 		if sqltypes.IsText(rc.column.typ) {
 			// If a weight string was previously requested (by OrderedAggregator),
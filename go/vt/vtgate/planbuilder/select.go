@@ -22,6 +22,7 @@ import (
 
 	"vitess.io/vitess/go/vt/sqlparser"
 	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
 )
 
 // buildSelectPlan is the new function to build a Select plan.
@@ -36,9 +37,44 @@ func buildSelectPlan(sel *sqlparser.Select, vschema VSchema) (primitive engine.P
 	if err != nil {
 		return nil, err
 	}
+	if rb, ok := builder.(*route); ok {
+		rb.ERoute.ResultCacheTable = resultCacheTable(sel, rb)
+	}
 	return builder.Primitive(), nil
 }
 
+// resultCacheTable returns the table whose result cache a select can use,
+// or nil. The select must read a single table, which has a result cache,
+// by its primary vindex. Selects with subqueries or locks are not cached.
+func resultCacheTable(sel *sqlparser.Select, rb *route) *vindexes.Table {
+	if rb.ERoute.Opcode != engine.SelectEqualUnique || sel.Lock != "" || len(sel.From) != 1 || hasSubquery(sel) {
+		return nil
+	}
+	tables := rb.Symtab().tables
+	if len(tables) != 1 {
+		return nil
+	}
+	var vindexTable *vindexes.Table
+	for _, t := range tables {
+		vindexTable = t.vindexTable
+	}
+	if vindexTable == nil || vindexTable.ResultCacheTTL == 0 || !vindexes.CanCacheResults(vindexTable) {
+		return nil
+	}
+	primary := vindexTable.ColumnVindexes[0].Vindex
+	if rb.ERoute.Vindex != primary {
+		return nil
+	}
+	// If another column uses the same vindex, we don't know
+	// which column the route is for.
+	for _, cv := range vindexTable.ColumnVindexes[1:] {
+		if cv.Vindex == primary {
+			return nil
+		}
+	}
+	return vindexTable
+}
+
 // processSelect builds a primitive tree for the given query or subquery.
 func processSelect(sel *sqlparser.Select, vschema VSchema, outer builder) (builder, error) {
 	bldr, err := processTableExprs(sel.From, vschema)
@@ -121,6 +157,11 @@ func reorderBySubquery(filters []sqlparser.Expr) {
 // pushSelectExprs identifies the target route for the
 // select expressions and pushes them down.
 func pushSelectExprs(sel *sqlparser.Select, bldr builder) (builder, error) {
+	// The select expressions of a join may have to be evaluated
+	// by vtgate. If they don't, the projection is a no-op.
+	if _, ok := bldr.(*join); ok {
+		bldr = newProjection(bldr)
+	}
 	resultColumns, err := pushSelectRoutes(sel.SelectExprs, bldr)
 	if err != nil {
 		return nil, err
@@ -130,6 +171,9 @@ func pushSelectExprs(sel *sqlparser.Select, bldr builder) (builder, error) {
 	if err := pushGroupBy(sel, bldr); err != nil {
 		return nil, err
 	}
+	if oa, ok := bldr.(*orderedAggregate); ok {
+		oa.CompleteSelect()
+	}
 	return bldr, nil
 }
 
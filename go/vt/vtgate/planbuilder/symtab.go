@@ -123,21 +123,25 @@ func (st *symtab) AddVindexTable(alias sqlparser.TableName, vindexTable *vindexe
 
 	for _, cv := range vindexTable.ColumnVindexes {
 		for i, cvcol := range cv.Columns {
-			var vindex vindexes.Vindex
-			if i == 0 {
-				// For now, only the first column is used for vindex Map functions.
-				vindex = cv.Vindex
-			}
 			lowered := cvcol.Lowered()
-			if col, ok := t.columns[lowered]; ok {
-				col.Vindex = vindex
+			col, ok := t.columns[lowered]
+			if !ok {
+				col = &column{
+					origin: rb,
+					name:   cvcol,
+					table:  t,
+				}
+				t.columns[lowered] = col
+			}
+			if vindexes.IsMultiColumn(cv.Vindex) {
+				// A multi-column vindex needs the values of its
+				// leading columns, which the route collects.
+				col.multiColumns = append(col.multiColumns, multiColumnRef{colVindex: cv, index: i})
 				continue
 			}
-			t.columns[lowered] = &column{
-				origin: rb,
-				Vindex: vindex,
-				name:   cvcol,
-				table:  t,
+			if i == 0 {
+				// For now, only the first column is used for vindex Map functions.
+				col.Vindex = cv.Vindex
 			}
 		}
 	}
@@ -204,6 +208,7 @@ func (st *symtab) ClearVindexes() {
 	for _, t := range st.tables {
 		for _, c := range t.columns {
 			c.Vindex = nil
+			c.multiColumns = nil
 		}
 	}
 }
@@ -466,7 +471,8 @@ type table struct {
 // used to construct a select expression if the column is
 // requested during the wire-up phase.
 // If the table column has a vindex, then that information
-// is also stored and used to make routing decisions.
+// is also stored and used to make routing decisions. For the
+// columns of multi-column vindexes, multiColumns is set instead.
 // Two columns are equal only if their pointer values match,
 // and not their content.
 type column struct {
@@ -476,11 +482,22 @@ type column struct {
 	typ    querypb.Type
 	table  *table
 
+	// multiColumns are the multi-column vindexes of the column,
+	// with the index of the column in each of them.
+	multiColumns []multiColumnRef
+
 	// colnum is set only for primitives that can return a
 	// subset of their internal result like subquery or vindexFunc.
 	colnum int
 }
 
+// multiColumnRef is a reference from a column to one of its
+// multi-column vindexes.
+type multiColumnRef struct {
+	colVindex *vindexes.ColumnVindex
+	index     int
+}
+
 // Origin returns the route that originates the column.
 func (c *column) Origin() columnOriginator {
 	// If it's a route, we have to resolve it.
@@ -50,6 +50,8 @@ var (
 	mysqlSslKey  = flag.String("mysql_server_ssl_key", "", "Path to ssl key for mysql server plugin SSL")
 	mysqlSslCa   = flag.String("mysql_server_ssl_ca", "", "Path to ssl CA for mysql server plugin SSL. If specified, server will require and validate client certs.")
 
+	mysqlRSAKey = flag.String("mysql_server_rsa_key", "", "Path to the RSA private key used by the caching_sha2_password and sha256_password auth methods over non-SSL connections")
+
 	mysqlSlowConnectWarnThreshold = flag.Duration("mysql_slow_connect_warn_threshold", 0, "Warn if it takes more than the given threshold for a mysql connection to establish")
 
 	busyConnections int32
@@ -84,6 +86,66 @@ func (vh *vtgateHandler) ConnectionClosed(c *mysql.Conn) {
 }
 
 func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	return vh.execute(c, query, make(map[string]*querypb.BindVariable), callback)
+}
+
+// ComPrepare is part of the mysql.Handler interface.
+func (vh *vtgateHandler) ComPrepare(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	ctx := newCallerContext(c)
+	session := newSession(c)
+	if c.SchemaName != "" {
+		session.TargetString = c.SchemaName
+	}
+	session, fields, err := vh.vtg.Prepare(ctx, session, query, bindVars)
+	c.ClientData = session
+	err = mysql.NewSQLErrorFromError(err)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// ComStmtExecute is part of the mysql.Handler interface. The '?'
+// placeholders of the prepared statement are parsed as ':v<N>' bind
+// variables, so the query text is the same for every execution,
+// and its plan is reused from the executor plan cache.
+func (vh *vtgateHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareData, callback func(*sqltypes.Result) error) error {
+	return vh.execute(c, prepare.PrepareStmt, sqltypes.CopyBindVariables(prepare.BindVars), callback)
+}
+
+// execute runs a query for ComQuery or ComStmtExecute.
+func (vh *vtgateHandler) execute(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable, callback func(*sqltypes.Result) error) error {
+	ctx := newCallerContext(c)
+	session := newSession(c)
+
+	if !session.InTransaction {
+		atomic.AddInt32(&busyConnections, 1)
+	}
+	defer func() {
+		if !session.InTransaction {
+			atomic.AddInt32(&busyConnections, -1)
+		}
+	}()
+
+	if c.SchemaName != "" {
+		session.TargetString = c.SchemaName
+	}
+	if session.Options.Workload == querypb.ExecuteOptions_OLAP {
+		err := vh.vtg.StreamExecute(ctx, session, query, bindVars, callback)
+		return mysql.NewSQLErrorFromError(err)
+	}
+	session, result, err := vh.vtg.Execute(ctx, session, query, bindVars)
+	c.ClientData = session
+	err = mysql.NewSQLErrorFromError(err)
+	if err != nil {
+		return err
+	}
+	return callback(result)
+}
+
+// newCallerContext returns the context to use for a request coming
+// from the connection.
+func newCallerContext(c *mysql.Conn) context.Context {
 	// FIXME(alainjobart): Add some kind of timeout to the context.
 	ctx := context.Background()
 
@@ -97,8 +159,12 @@ func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sq
 		c.User,                  /* principal: who */
 		c.RemoteAddr().String(), /* component: running client process */
 		"VTGate MySQL Connector" /* subcomponent: part of the client */)
-	ctx = callerid.NewContext(ctx, ef, im)
+	return callerid.NewContext(ctx, ef, im)
+}
 
+// newSession returns the Session stored in the connection, or a new
+// one if there is none yet.
+func newSession(c *mysql.Conn) *vtgatepb.Session {
 	session, _ := c.ClientData.(*vtgatepb.Session)
 	if session == nil {
 		session = &vtgatepb.Session{
@@ -111,30 +177,7 @@ func (vh *vtgateHandler) ComQuery(c *mysql.Conn, query string, callback func(*sq
 			session.Options.ClientFoundRows = true
 		}
 	}
-
-	if !session.InTransaction {
-		atomic.AddInt32(&busyConnections, 1)
-	}
-	defer func() {
-		if !session.InTransaction {
-			atomic.AddInt32(&busyConnections, -1)
-		}
-	}()
-
-	if c.SchemaName != "" {
-		session.TargetString = c.SchemaName
-	}
-	if session.Options.Workload == querypb.ExecuteOptions_OLAP {
-		err := vh.vtg.StreamExecute(ctx, session, query, make(map[string]*querypb.BindVariable), callback)
-		return mysql.NewSQLErrorFromError(err)
-	}
-	session, result, err := vh.vtg.Execute(ctx, session, query, make(map[string]*querypb.BindVariable))
-	c.ClientData = session
-	err = mysql.NewSQLErrorFromError(err)
-	if err != nil {
-		return err
-	}
-	return callback(result)
+	return session
 }
 
 var mysqlListener *mysql.Listener
@@ -178,6 +221,12 @@ func initMySQLProtocol() {
 			}
 		}
 		mysqlListener.AllowClearTextWithoutTLS = *mysqlAllowClearTextWithoutTLS
+		if *mysqlRSAKey != "" {
+			mysqlListener.RSAKey, err = mysql.ReadRSAPrivateKey(*mysqlRSAKey)
+			if err != nil {
+				log.Exitf("mysql.ReadRSAPrivateKey failed: %v", err)
+			}
+		}
 
 		// Check for the connection threshold
 		if *mysqlSlowConnectWarnThreshold != 0 {
@@ -0,0 +1,368 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vtgate
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/vterrors"
+	"vitess.io/vitess/go/vt/vtgate/engine"
+	"vitess.io/vitess/go/vt/vtgate/resultcache"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var (
+	// resultCacheHits and resultCacheMisses count the lookups
+	// in the result cache, by keyspace.table.
+	resultCacheHits   = stats.NewCounters("VtgateResultCacheHits")
+	resultCacheMisses = stats.NewCounters("VtgateResultCacheMisses")
+	// resultCacheInvalidations counts the invalidations, by
+	// Keyspace, Table or Row.
+	resultCacheInvalidations = stats.NewCounters("VtgateResultCacheInvalidations")
+	// resultCacheErrors counts the failed operations on the cache
+	// service, by operation.
+	resultCacheErrors = stats.NewCounters("VtgateResultCacheErrors")
+
+	logResultCacheErrors = logutil.NewThrottledLogger("ResultCache", 5*time.Second)
+
+	errUpdateStreamEnded = vterrors.New(vtrpcpb.Code_UNAVAILABLE, "update stream ended")
+)
+
+const (
+	// resultCacheStreamSlack is how long before they start the update
+	// streams begin, so they also see the changes committed while they
+	// connect to the tablets.
+	resultCacheStreamSlack = 5 * time.Second
+	// resultCacheRetryDelay is how long the invalidation of a keyspace
+	// waits before starting again after an error. The shards of the
+	// keyspace are also checked for changes at that interval.
+	resultCacheRetryDelay = 5 * time.Second
+)
+
+// resultCache caches the results of the reads which the planner
+// marked with engine.Route.ResultCacheTable, outside of transactions.
+//
+// The entries of a keyspace are invalidated from the update streams
+// of all its shards. The invalidation of a keyspace starts the first
+// time a query of the keyspace could use the cache, and the cache is
+// only used for the keyspace while all the streams run.
+type resultCache struct {
+	cache      *resultcache.Cache
+	resolver   *Resolver
+	tabletType topodatapb.TabletType
+	// vschema returns the current VSchema.
+	vschema func() *vindexes.VSchema
+	// updateStream streams the changes of a shard from timestamp.
+	// It's a field so tests can replace it.
+	updateStream func(ctx context.Context, keyspace, shard string, timestamp int64, callback func(*querypb.StreamEvent) error) error
+	retryDelay   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// keyspaces has the keyspaces whose invalidation was started.
+	// The value is true while their update streams run.
+	keyspaces map[string]bool
+}
+
+func newResultCache(cache *resultcache.Cache, resolver *Resolver, tabletType topodatapb.TabletType, vschema func() *vindexes.VSchema) *resultCache {
+	ctx, cancel := context.WithCancel(context.Background())
+	rc := &resultCache{
+		cache:      cache,
+		resolver:   resolver,
+		tabletType: tabletType,
+		vschema:    vschema,
+		retryDelay: resultCacheRetryDelay,
+		ctx:        ctx,
+		cancel:     cancel,
+		keyspaces:  make(map[string]bool),
+	}
+	rc.updateStream = func(ctx context.Context, keyspace, shard string, timestamp int64, callback func(*querypb.StreamEvent) error) error {
+		return resolver.UpdateStream(ctx, keyspace, shard, nil, tabletType, timestamp, nil, func(event *querypb.StreamEvent, _ int64) error {
+			return callback(event)
+		})
+	}
+	return rc
+}
+
+// close stops the invalidation, and closes the cache.
+func (rc *resultCache) close() {
+	rc.cancel()
+	rc.wg.Wait()
+	rc.cache.Close()
+}
+
+// active returns true if the cache can be used for keyspace. It starts
+// the invalidation of keyspace if needed.
+func (rc *resultCache) active(keyspace string) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	active, ok := rc.keyspaces[keyspace]
+	if !ok {
+		rc.keyspaces[keyspace] = false
+		rc.wg.Add(1)
+		go func() {
+			defer rc.wg.Done()
+			rc.invalidate(keyspace)
+		}()
+	}
+	return active
+}
+
+func (rc *resultCache) setActive(keyspace string, active bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.keyspaces[keyspace] = active
+}
+
+// invalidate runs the update streams of the shards of keyspace, until
+// rc is closed. If a stream fails, or the shards change, all the
+// streams are restarted.
+func (rc *resultCache) invalidate(keyspace string) {
+	for {
+		if err := rc.runStreams(keyspace); err != nil {
+			logResultCacheErrors.Errorf("invalidation of the result cache for keyspace %v failed, retrying in %v: %v", keyspace, rc.retryDelay, err)
+		}
+		select {
+		case <-rc.ctx.Done():
+			return
+		case <-time.After(rc.retryDelay):
+		}
+	}
+}
+
+// runStreams runs the update streams of the shards of keyspace, and
+// returns when one of them fails, or the shards change.
+func (rc *resultCache) runStreams(keyspace string) error {
+	shards, err := rc.shards(keyspace)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(rc.ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		rc.setActive(keyspace, false)
+		cancel()
+		wg.Wait()
+	}()
+	errs := make(chan error, len(shards))
+	timestamp := time.Now().Add(-resultCacheStreamSlack).Unix()
+	for _, shard := range shards {
+		wg.Add(1)
+		go func(shard string) {
+			defer wg.Done()
+			errs <- rc.updateStream(ctx, keyspace, shard, timestamp, func(event *querypb.StreamEvent) error {
+				return rc.processEvent(ctx, keyspace, event)
+			})
+		}(shard)
+	}
+
+	// The changes committed while the cache wasn't
+	// used for the keyspace were not seen.
+	if err := rc.cache.InvalidateKeyspace(ctx, keyspace); err != nil {
+		resultCacheErrors.Add("Invalidate", 1)
+		return err
+	}
+	resultCacheInvalidations.Add("Keyspace", 1)
+	rc.setActive(keyspace, true)
+	log.Infof("result cache active for keyspace %v, shards %v", keyspace, shards)
+
+	ticker := time.NewTicker(rc.retryDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rc.ctx.Done():
+			return nil
+		case err := <-errs:
+			if err == nil {
+				err = errUpdateStreamEnded
+			}
+			return err
+		case <-ticker.C:
+			current, err := rc.shards(keyspace)
+			if err != nil {
+				return err
+			}
+			if !StrsEquals(current, shards) {
+				log.Infof("shards of keyspace %v changed from %v to %v, restarting the result cache invalidation", keyspace, shards, current)
+				return nil
+			}
+		}
+	}
+}
+
+// shards returns the shards of keyspace for the tablet type
+// of the update streams.
+func (rc *resultCache) shards(keyspace string) ([]string, error) {
+	_, _, allShards, err := rc.resolver.resolver.GetKeyspaceShards(rc.ctx, keyspace, rc.tabletType)
+	if err != nil {
+		return nil, err
+	}
+	shards := make([]string, len(allShards))
+	for i, shard := range allShards {
+		shards[i] = shard.Name
+	}
+	return shards, nil
+}
+
+// processEvent invalidates the entries an event of the update
+// stream changes. Schema changes and errors invalidate the whole
+// keyspace.
+func (rc *resultCache) processEvent(ctx context.Context, keyspace string, event *querypb.StreamEvent) error {
+	for _, statement := range event.Statements {
+		if statement.Category != querypb.StreamEvent_Statement_DML {
+			if err := rc.cache.InvalidateKeyspace(ctx, keyspace); err != nil {
+				resultCacheErrors.Add("Invalidate", 1)
+				return err
+			}
+			resultCacheInvalidations.Add("Keyspace", 1)
+			continue
+		}
+		if err := rc.invalidateRows(ctx, keyspace, statement); err != nil {
+			resultCacheErrors.Add("Invalidate", 1)
+			return err
+		}
+	}
+	return nil
+}
+
+// invalidateRows invalidates the rows a DML changed, by the keyspace
+// id their primary key maps to. If the primary vindex column is not
+// part of the primary key, the whole table is invalidated.
+func (rc *resultCache) invalidateRows(ctx context.Context, keyspace string, statement *querypb.StreamEvent_Statement) error {
+	vschema := rc.vschema()
+	if vschema == nil {
+		return nil
+	}
+	ks, ok := vschema.Keyspaces[keyspace]
+	if !ok {
+		return nil
+	}
+	table, ok := ks.Tables[statement.TableName]
+	// A table without a result cache has no entries, except the
+	// ones stored before the vschema changed, which expire.
+	if !ok || table.ResultCacheTTL == 0 || !vindexes.CanCacheResults(table) {
+		return nil
+	}
+	primary := table.ColumnVindexes[0]
+	col := -1
+	for i, field := range statement.PrimaryKeyFields {
+		if primary.Columns[0].EqualString(field.Name) {
+			col = i
+			break
+		}
+	}
+	if col != -1 {
+		ksids := make([][]byte, 0, len(statement.PrimaryKeyValues))
+		for _, row := range statement.PrimaryKeyValues {
+			values := sqltypes.MakeRowTrusted(statement.PrimaryKeyFields, row)
+			ksid := resultCacheKeyspaceID(primary.Vindex, values[col])
+			if ksid == nil {
+				ksids = nil
+				break
+			}
+			ksids = append(ksids, ksid)
+		}
+		if ksids != nil {
+			for _, ksid := range ksids {
+				if err := rc.cache.InvalidateRow(ctx, keyspace, statement.TableName, ksid); err != nil {
+					return err
+				}
+				resultCacheInvalidations.Add("Row", 1)
+			}
+			return nil
+		}
+	}
+	if err := rc.cache.InvalidateTable(ctx, keyspace, statement.TableName); err != nil {
+		return err
+	}
+	resultCacheInvalidations.Add("Table", 1)
+	return nil
+}
+
+// resultCacheKeyspaceID returns the keyspace id a value of the primary
+// vindex of a table with a result cache maps to, or nil if it doesn't
+// map to one. The vindex doesn't use a lookup, so it needs no VCursor.
+func resultCacheKeyspaceID(vindex vindexes.Vindex, value sqltypes.Value) []byte {
+	ksids, err := vindex.(vindexes.Unique).Map(nil, []sqltypes.Value{value})
+	if err != nil || len(ksids) != 1 || ksids[0].Range != nil {
+		return nil
+	}
+	return ksids[0].ID
+}
+
+// getCachedResult returns the cached result of a plan, if it has one.
+// If it doesn't, but can be cached, it also returns a function to store
+// its result after executing it. Only the reads of the tablet type whose
+// update streams invalidate the cache use it: the results read from other
+// tablet types could be older than the invalidations.
+func (e *Executor) getCachedResult(ctx context.Context, plan *engine.Plan, safeSession *SafeSession, tabletType topodatapb.TabletType, bindVars map[string]*querypb.BindVariable) (*sqltypes.Result, func(*sqltypes.Result)) {
+	if e.resultCache == nil || safeSession.InTransaction() || tabletType != e.resultCache.tabletType {
+		return nil, nil
+	}
+	route, ok := plan.Instructions.(*engine.Route)
+	if !ok || route.ResultCacheTable == nil || !e.resultCache.active(route.Keyspace.Name) {
+		return nil, nil
+	}
+	value, err := route.Values[0].ResolveValue(bindVars)
+	if err != nil {
+		// Executing the plan returns the error.
+		return nil, nil
+	}
+	ksid := resultCacheKeyspaceID(route.Vindex, value)
+	if ksid == nil {
+		return nil, nil
+	}
+
+	keyspace := route.Keyspace.Name
+	table := route.ResultCacheTable
+	name := keyspace + "." + table.Name.String()
+	// The key has the caller, so that a cached result is only
+	// returned to the callers allowed to read it.
+	query := consolidationKey(ctx, safeSession.TargetString, safeSession.Options, plan.Original, bindVars)
+	qr, ticket, err := e.resultCache.cache.Get(ctx, keyspace, table.Name.String(), ksid, query)
+	if err != nil {
+		resultCacheErrors.Add("Get", 1)
+		logResultCacheErrors.Errorf("result cache lookup failed for %v: %v", name, err)
+		return nil, nil
+	}
+	if qr != nil {
+		resultCacheHits.Add(name, 1)
+		return qr, nil
+	}
+	resultCacheMisses.Add(name, 1)
+	return nil, func(qr *sqltypes.Result) {
+		if err := e.resultCache.cache.Set(ctx, ticket, table.ResultCacheTTL, qr); err != nil {
+			resultCacheErrors.Add("Set", 1)
+			logResultCacheErrors.Errorf("result cache store failed for %v: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vtgate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/callerid"
+	"vitess.io/vitess/go/vt/vtgate/resultcache"
+	"vitess.io/vitess/go/vt/vttablet/sandboxconn"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+)
+
+var resultCacheVSchema = `
+{
+	"sharded": true,
+	"vindexes": {
+		"hash_index": {
+			"type": "hash"
+		}
+	},
+	"tables": {
+		"user_profile": {
+			"column_vindexes": [
+				{
+					"column": "user_id",
+					"name": "hash_index"
+				}
+			],
+			"result_cache_ttl_seconds": 60
+		}
+	}
+}
+`
+
+// fakeUpdateStreams replaces the update streams of a resultCache.
+// Each event sent to events is processed by one of the streams,
+// which then sends to processed.
+type fakeUpdateStreams struct {
+	events    chan *querypb.StreamEvent
+	processed chan struct{}
+}
+
+func newFakeUpdateStreams(rc *resultCache) *fakeUpdateStreams {
+	f := &fakeUpdateStreams{
+		events:    make(chan *querypb.StreamEvent),
+		processed: make(chan struct{}),
+	}
+	rc.updateStream = func(ctx context.Context, keyspace, shard string, timestamp int64, callback func(*querypb.StreamEvent) error) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case event := <-f.events:
+				err := callback(event)
+				f.processed <- struct{}{}
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return f
+}
+
+func (f *fakeUpdateStreams) send(event *querypb.StreamEvent) {
+	f.events <- event
+	<-f.processed
+}
+
+func waitForResultCache(t *testing.T, rc *resultCache, keyspace string) {
+	timeout := time.After(5 * time.Second)
+	for {
+		rc.mu.Lock()
+		active := rc.keyspaces[keyspace]
+		rc.mu.Unlock()
+		if active {
+			return
+		}
+		select {
+		case <-timeout:
+			t.Fatalf("the result cache is not active for keyspace %v", keyspace)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func dmlEvent(table string, userIDs ...int64) *querypb.StreamEvent {
+	statement := &querypb.StreamEvent_Statement{
+		Category:         querypb.StreamEvent_Statement_DML,
+		TableName:        table,
+		PrimaryKeyFields: sqltypes.MakeTestFields("user_id", "int64"),
+	}
+	for _, id := range userIDs {
+		statement.PrimaryKeyValues = append(statement.PrimaryKeyValues, sqltypes.RowToProto3([]sqltypes.Value{sqltypes.NewInt64(id)}))
+	}
+	return &querypb.StreamEvent{Statements: []*querypb.StreamEvent_Statement{statement}}
+}
+
+func TestExecutorResultCache(t *testing.T) {
+	executor, sbc1, _, _ := createCustomExecutor(resultCacheVSchema)
+	executor.resultCache = newResultCache(resultcache.NewMemory(1<<20), executor.resolver, topodatapb.TabletType_MASTER, executor.VSchema)
+	defer executor.resultCache.close()
+	streams := newFakeUpdateStreams(executor.resultCache)
+
+	session := &vtgatepb.Session{TargetString: "@master", Autocommit: true}
+	sql := "select name from user_profile where user_id = 1"
+	ctx := context.Background()
+	execCount := int64(0)
+	execute := func(cached bool) {
+		t.Helper()
+		result, err := executor.Execute(ctx, "TestExecute", NewSafeSession(session), sql, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cached {
+			execCount++
+		}
+		if got := sbc1.ExecCount.Get(); got != execCount {
+			t.Errorf("%v: sbc1.ExecCount: %v, want %v", sql, got, execCount)
+		}
+		if !reflect.DeepEqual(result, sandboxconn.SingleRowResult) {
+			t.Errorf("%v: %v, want %v", sql, result, sandboxconn.SingleRowResult)
+		}
+	}
+
+	// The cache is only used once the update streams run.
+	execute(false)
+	waitForResultCache(t, executor.resultCache, "TestExecutor")
+	execute(false)
+	execute(true)
+
+	// The results are only shared by the same caller.
+	ctx = callerid.NewContext(context.Background(), callerid.NewEffectiveCallerID("user1", "", ""), callerid.NewImmediateCallerID("app1"))
+	execute(false)
+	execute(true)
+	ctx = context.Background()
+	execute(true)
+
+	// Another row doesn't invalidate the result.
+	streams.send(dmlEvent("user_profile", 2))
+	execute(true)
+	streams.send(dmlEvent("user_profile", 1, 3))
+	execute(false)
+	execute(true)
+
+	// Schema changes invalidate the keyspace.
+	streams.send(&querypb.StreamEvent{
+		Statements: []*querypb.StreamEvent_Statement{{
+			Category: querypb.StreamEvent_Statement_DDL,
+			Sql:      []byte("alter table user_profile add column c int"),
+		}},
+	})
+	execute(false)
+
+	// Locking reads and transactions don't use the cache.
+	sql = "select name from user_profile where user_id = 1 for update"
+	execute(false)
+	execute(false)
+	sql = "select name from user_profile where user_id = 1"
+	session.InTransaction = true
+	execute(false)
+}
+
+func TestExecutorResultCacheTabletType(t *testing.T) {
+	executor, sbc1, _, _ := createCustomExecutor(resultCacheVSchema)
+	executor.resultCache = newResultCache(resultcache.NewMemory(1<<20), executor.resolver, topodatapb.TabletType_REPLICA, executor.VSchema)
+	defer executor.resultCache.close()
+	// The sandbox has no replicas to stream from: mark the
+	// invalidation as running.
+	executor.resultCache.keyspaces["TestExecutor"] = true
+
+	// The update streams of the replicas don't invalidate the results
+	// read from the master, so they aren't cached.
+	session := &vtgatepb.Session{TargetString: "@master", Autocommit: true}
+	sql := "select name from user_profile where user_id = 1"
+	for i := 1; i <= 2; i++ {
+		if _, err := executor.Execute(context.Background(), "TestExecute", NewSafeSession(session), sql, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := sbc1.ExecCount.Get(); got != int64(i) {
+			t.Errorf("sbc1.ExecCount: %v, want %v", got, i)
+		}
+	}
+}
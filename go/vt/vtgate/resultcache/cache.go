@@ -0,0 +1,265 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resultcache caches the results of the queries which read a row
+// by its keyspace id. The results are stored in a
+// cacheservice.CacheService, either a MemoryCache or a service like
+// memcache which is shared by several vtgates.
+//
+// The entries are invalidated by generation: the keyspace, each table,
+// and each row of a table have a generation key, which holds a random
+// value. The key of an entry is a hash of the query and of the values of
+// the three generation keys when it was stored. Invalidating a row, a
+// table or a keyspace deletes its generation key, so the entries stored
+// before become unreachable, and are eventually evicted or expire.
+package resultcache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/cacheservice"
+	"vitess.io/vitess/go/pools"
+	"vitess.io/vitess/go/sqltypes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+const (
+	genKeyPrefix   = "vtgate:g:"
+	entryKeyPrefix = "vtgate:r:"
+)
+
+// Cache is a cache of query results. It is safe for concurrent use.
+type Cache struct {
+	// memory is set if the results are stored in memory.
+	// Otherwise, pool has the connections to the cache service.
+	memory *MemoryCache
+	pool   *pools.ResourcePool
+}
+
+// Ticket allows storing the result of a query which was not cached.
+// It is returned by Get before the query is executed, so the result
+// isn't reachable if it was invalidated while the query was executed.
+type Ticket struct {
+	key string
+}
+
+// NewMemory creates a Cache which stores up to capacity bytes
+// of results in memory.
+func NewMemory(capacity int64) *Cache {
+	return &Cache{
+		memory: NewMemoryCache(capacity),
+	}
+}
+
+// New creates a Cache which stores the results in the cache service
+// registered as service with cacheservice.Register, at address. It
+// uses up to poolSize connections.
+func New(service, address string, timeout time.Duration, poolSize int) (*Cache, error) {
+	if !cacheservice.IsRegistered(service) {
+		return nil, fmt.Errorf("cache service %v is not registered", service)
+	}
+	cacheservice.DefaultCacheService = service
+	config := cacheservice.Config{
+		Address: address,
+		Timeout: timeout,
+	}
+	factory := func() (pools.Resource, error) {
+		return cacheservice.Connect(config)
+	}
+	return &Cache{
+		pool: pools.NewResourcePool(factory, poolSize, poolSize, time.Minute),
+	}, nil
+}
+
+// Close closes the connections to the cache service.
+func (c *Cache) Close() {
+	if c.pool != nil {
+		c.pool.Close()
+	}
+}
+
+// withConn calls fn with a connection to the cache service.
+func (c *Cache) withConn(ctx context.Context, fn func(conn cacheservice.CacheService) error) error {
+	if c.memory != nil {
+		return fn(c.memory)
+	}
+	r, err := c.pool.Get(ctx)
+	if err != nil {
+		return err
+	}
+	conn := r.(cacheservice.CacheService)
+	if err := fn(conn); err != nil {
+		// The connection may be broken, don't reuse it.
+		conn.Close()
+		c.pool.Put(nil)
+		return err
+	}
+	c.pool.Put(conn)
+	return nil
+}
+
+// Get returns the cached result of a query which reads the row of table
+// with keyspace id ksid, or nil if there is none. query must identify
+// the query, its bind variables, and anything else its result depends
+// on. The returned Ticket allows storing the result of the query with
+// Set after executing it.
+func (c *Cache) Get(ctx context.Context, keyspace, table string, ksid []byte, query string) (*sqltypes.Result, *Ticket, error) {
+	var qr *sqltypes.Result
+	var ticket *Ticket
+	err := c.withConn(ctx, func(conn cacheservice.CacheService) error {
+		gens, err := generations(conn, keyspaceGenKey(keyspace), tableGenKey(keyspace, table), rowGenKey(keyspace, table, ksid))
+		if err != nil {
+			return err
+		}
+		ticket = &Ticket{key: entryKey(gens, query)}
+		results, err := conn.Get(ticket.key)
+		if err != nil || len(results) == 0 {
+			return err
+		}
+		p := &querypb.QueryResult{}
+		if err := proto.Unmarshal(results[0].Value, p); err != nil {
+			return err
+		}
+		qr = sqltypes.Proto3ToResult(p)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return qr, ticket, nil
+}
+
+// Set stores the result of the query that ticket was returned for.
+// The result expires after ttl.
+func (c *Cache) Set(ctx context.Context, ticket *Ticket, ttl time.Duration, qr *sqltypes.Result) error {
+	value, err := proto.Marshal(sqltypes.ResultToProto3(qr))
+	if err != nil {
+		return err
+	}
+	return c.withConn(ctx, func(conn cacheservice.CacheService) error {
+		_, err := conn.Set(ticket.key, 0, uint64(ttl/time.Second), value)
+		return err
+	})
+}
+
+// InvalidateKeyspace invalidates the results of all the tables of a
+// keyspace.
+func (c *Cache) InvalidateKeyspace(ctx context.Context, keyspace string) error {
+	return c.invalidate(ctx, keyspaceGenKey(keyspace))
+}
+
+// InvalidateTable invalidates the results of all the rows of a table.
+func (c *Cache) InvalidateTable(ctx context.Context, keyspace, table string) error {
+	return c.invalidate(ctx, tableGenKey(keyspace, table))
+}
+
+// InvalidateRow invalidates the results of the row of a table with
+// keyspace id ksid.
+func (c *Cache) InvalidateRow(ctx context.Context, keyspace, table string, ksid []byte) error {
+	return c.invalidate(ctx, rowGenKey(keyspace, table, ksid))
+}
+
+func (c *Cache) invalidate(ctx context.Context, genKey string) error {
+	return c.withConn(ctx, func(conn cacheservice.CacheService) error {
+		_, err := conn.Delete(genKey)
+		return err
+	})
+}
+
+// generations returns the values of the generation keys. The missing
+// ones are created with a new random value.
+func generations(conn cacheservice.CacheService, keys ...string) ([][]byte, error) {
+	results, err := conn.Get(keys...)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]byte, len(results))
+	for _, result := range results {
+		values[result.Key] = result.Value
+	}
+	gens := make([][]byte, len(keys))
+	for i, key := range keys {
+		gen, ok := values[key]
+		if !ok {
+			gen, err = newGeneration(conn, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+		gens[i] = gen
+	}
+	return gens, nil
+}
+
+// newGeneration stores a new random value in a generation key, unless
+// another one was stored first. It returns the value of the key.
+// The values must be random across vtgates, which can share the
+// cache service.
+func newGeneration(conn cacheservice.CacheService, key string) ([]byte, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	gen := []byte(hex.EncodeToString(b))
+	stored, err := conn.Add(key, 0, 0, gen)
+	if err != nil || stored {
+		return gen, err
+	}
+	results, err := conn.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	// If the key was invalidated again in the meantime, the
+	// new value is as good as any other: no other result can
+	// have been stored with it.
+	if len(results) == 1 {
+		gen = results[0].Value
+	}
+	return gen, nil
+}
+
+func keyspaceGenKey(keyspace string) string {
+	return hashKey(genKeyPrefix, []byte("k"), []byte(keyspace))
+}
+
+func tableGenKey(keyspace, table string) string {
+	return hashKey(genKeyPrefix, []byte("t"), []byte(keyspace), []byte(table))
+}
+
+func rowGenKey(keyspace, table string, ksid []byte) string {
+	return hashKey(genKeyPrefix, []byte("r"), []byte(keyspace), []byte(table), ksid)
+}
+
+func entryKey(gens [][]byte, query string) string {
+	return hashKey(entryKeyPrefix, append(gens, []byte(query))...)
+}
+
+// hashKey returns prefix followed by a hash of parts. The keys are
+// hashed so they fit the restrictions of memcache on length and
+// characters.
+func hashKey(prefix string, parts ...[]byte) string {
+	hash := sha1.Sum(bytes.Join(parts, []byte{0}))
+	return prefix + hex.EncodeToString(hash[:])
+}
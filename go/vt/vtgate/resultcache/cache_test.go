@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resultcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemory(1 << 20)
+	defer c.Close()
+	qr := sqltypes.MakeTestResult(sqltypes.MakeTestFields("id|name", "int64|varchar"), "1|a")
+
+	get := func(ksid, query string) (*sqltypes.Result, *Ticket) {
+		t.Helper()
+		got, ticket, err := c.Get(ctx, "ks", "t1", []byte(ksid), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got, ticket
+	}
+	set := func(ticket *Ticket) {
+		t.Helper()
+		if err := c.Set(ctx, ticket, time.Minute, qr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectHit := func(ksid, query string, hit bool) {
+		t.Helper()
+		got, _ := get(ksid, query)
+		if hit && !reflect.DeepEqual(got, qr) {
+			t.Errorf("Get(%v, %v): %v, want %v", ksid, query, got, qr)
+		}
+		if !hit && got != nil {
+			t.Errorf("Get(%v, %v): %v, want nil", ksid, query, got)
+		}
+	}
+
+	// Miss, then hit.
+	_, ticket := get("1", "q1")
+	set(ticket)
+	expectHit("1", "q1", true)
+	expectHit("1", "q2", false)
+	expectHit("2", "q1", false)
+
+	// A row is invalidated.
+	_, ticket = get("2", "q1")
+	set(ticket)
+	if err := c.InvalidateRow(ctx, "ks", "t1", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	expectHit("1", "q1", false)
+	expectHit("2", "q1", true)
+
+	// A table, and a keyspace.
+	if err := c.InvalidateTable(ctx, "ks", "t1"); err != nil {
+		t.Fatal(err)
+	}
+	expectHit("2", "q1", false)
+	_, ticket = get("2", "q1")
+	set(ticket)
+	if err := c.InvalidateKeyspace(ctx, "ks"); err != nil {
+		t.Fatal(err)
+	}
+	expectHit("2", "q1", false)
+
+	// A result can't be reached if its row is invalidated
+	// between Get and Set.
+	_, ticket = get("3", "q1")
+	if err := c.InvalidateRow(ctx, "ks", "t1", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	set(ticket)
+	expectHit("3", "q1", false)
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resultcache
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"vitess.io/vitess/go/cache"
+	"vitess.io/vitess/go/cacheservice"
+)
+
+// maxRelativeTimeout is the largest timeout which is a number of
+// seconds from now. Larger ones are a unix time, as in memcache.
+const maxRelativeTimeout = 30 * 24 * 60 * 60
+
+// MemoryCache is a cacheservice.CacheService which keeps the values
+// in memory. The least recently used values are evicted when their
+// total size reaches the capacity. It is safe for concurrent use, so
+// all the connections of a Cache share the same MemoryCache.
+type MemoryCache struct {
+	// mu serializes the operations that read and write a value.
+	mu      sync.Mutex
+	values  *cache.LRUCache
+	lastCas uint64
+}
+
+// memoryValue is a value of the MemoryCache.
+type memoryValue struct {
+	value []byte
+	flags uint16
+	cas   uint64
+	// expires is zero if the value doesn't expire.
+	expires time.Time
+}
+
+// Size is part of the cache.Value interface.
+func (mv *memoryValue) Size() int {
+	return len(mv.value)
+}
+
+// NewMemoryCache creates a MemoryCache which holds up to capacity
+// bytes of values.
+func NewMemoryCache(capacity int64) *MemoryCache {
+	return &MemoryCache{
+		values: cache.NewLRUCache(capacity),
+	}
+}
+
+// get returns the value of key, or nil if it doesn't
+// exist or has expired. mc.mu must be held.
+func (mc *MemoryCache) get(key string) *memoryValue {
+	v, ok := mc.values.Get(key)
+	if !ok {
+		return nil
+	}
+	mv := v.(*memoryValue)
+	if !mv.expires.IsZero() && !time.Now().Before(mv.expires) {
+		mc.values.Delete(key)
+		return nil
+	}
+	return mv
+}
+
+// set stores a value. mc.mu must be held.
+func (mc *MemoryCache) set(key string, flags uint16, timeout uint64, value []byte) {
+	mc.lastCas++
+	mv := &memoryValue{
+		value: value,
+		flags: flags,
+		cas:   mc.lastCas,
+	}
+	switch {
+	case timeout == 0:
+	case timeout <= maxRelativeTimeout:
+		mv.expires = time.Now().Add(time.Duration(timeout) * time.Second)
+	default:
+		mv.expires = time.Unix(int64(timeout), 0)
+	}
+	mc.values.Set(key, mv)
+}
+
+// Get is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Get(keys ...string) ([]cacheservice.Result, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var results []cacheservice.Result
+	for _, key := range keys {
+		if mv := mc.get(key); mv != nil {
+			results = append(results, cacheservice.Result{
+				Key:   key,
+				Value: mv.value,
+				Flags: mv.flags,
+			})
+		}
+	}
+	return results, nil
+}
+
+// Gets is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Gets(keys ...string) ([]cacheservice.Result, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	var results []cacheservice.Result
+	for _, key := range keys {
+		if mv := mc.get(key); mv != nil {
+			results = append(results, cacheservice.Result{
+				Key:   key,
+				Value: mv.value,
+				Flags: mv.flags,
+				Cas:   mv.cas,
+			})
+		}
+	}
+	return results, nil
+}
+
+// Set is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Set(key string, flags uint16, timeout uint64, value []byte) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.set(key, flags, timeout, value)
+	return true, nil
+}
+
+// Add is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Add(key string, flags uint16, timeout uint64, value []byte) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.get(key) != nil {
+		return false, nil
+	}
+	mc.set(key, flags, timeout, value)
+	return true, nil
+}
+
+// Replace is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Replace(key string, flags uint16, timeout uint64, value []byte) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.get(key) == nil {
+		return false, nil
+	}
+	mc.set(key, flags, timeout, value)
+	return true, nil
+}
+
+// Append is part of the cacheservice.CacheService interface.
+// As in memcache, flags and timeout are ignored.
+func (mc *MemoryCache) Append(key string, flags uint16, timeout uint64, value []byte) (bool, error) {
+	return mc.concat(key, func(old []byte) [][]byte { return [][]byte{old, value} })
+}
+
+// Prepend is part of the cacheservice.CacheService interface.
+// As in memcache, flags and timeout are ignored.
+func (mc *MemoryCache) Prepend(key string, flags uint16, timeout uint64, value []byte) (bool, error) {
+	return mc.concat(key, func(old []byte) [][]byte { return [][]byte{value, old} })
+}
+
+// concat replaces an existing value with the concatenation of parts.
+func (mc *MemoryCache) concat(key string, parts func(old []byte) [][]byte) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mv := mc.get(key)
+	if mv == nil {
+		return false, nil
+	}
+	mc.lastCas++
+	mc.values.Set(key, &memoryValue{
+		value:   bytes.Join(parts(mv.value), nil),
+		flags:   mv.flags,
+		cas:     mc.lastCas,
+		expires: mv.expires,
+	})
+	return true, nil
+}
+
+// Cas is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Cas(key string, flags uint16, timeout uint64, value []byte, cas uint64) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mv := mc.get(key)
+	if mv == nil || mv.cas != cas {
+		return false, nil
+	}
+	mc.set(key, flags, timeout, value)
+	return true, nil
+}
+
+// Delete is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) Delete(key string) (bool, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.get(key) == nil {
+		return false, nil
+	}
+	return mc.values.Delete(key), nil
+}
+
+// FlushAll is part of the cacheservice.CacheService interface.
+func (mc *MemoryCache) FlushAll() error {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.values.Clear()
+	return nil
+}
+
+// Stats is part of the cacheservice.CacheService interface.
+// It only supports the general statistics, in the memcache format.
+func (mc *MemoryCache) Stats(argument string) ([]byte, error) {
+	if argument != "" {
+		return nil, fmt.Errorf("unsupported stats argument: %v", argument)
+	}
+	length, size, capacity, evictions, _ := mc.values.Stats()
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "STAT curr_items %d\r\n", length)
+	fmt.Fprintf(buf, "STAT bytes %d\r\n", size)
+	fmt.Fprintf(buf, "STAT limit_maxbytes %d\r\n", capacity)
+	fmt.Fprintf(buf, "STAT evictions %d\r\n", evictions)
+	return buf.Bytes(), nil
+}
+
+// Close is part of the cacheservice.CacheService interface.
+// The values are kept, since the MemoryCache is shared.
+func (mc *MemoryCache) Close() {
+}
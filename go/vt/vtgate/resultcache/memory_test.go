@@ -0,0 +1,105 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resultcache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"vitess.io/vitess/go/cacheservice"
+)
+
+func TestMemoryCache(t *testing.T) {
+	mc := NewMemoryCache(100)
+
+	if stored, _ := mc.Add("a", 1, 0, []byte("1")); !stored {
+		t.Errorf("Add(a): not stored")
+	}
+	if stored, _ := mc.Add("a", 1, 0, []byte("2")); stored {
+		t.Errorf("Add(a) again: stored")
+	}
+	if stored, _ := mc.Replace("b", 1, 0, []byte("1")); stored {
+		t.Errorf("Replace(b): stored")
+	}
+	if stored, _ := mc.Append("a", 0, 0, []byte("2")); !stored {
+		t.Errorf("Append(a): not stored")
+	}
+	if stored, _ := mc.Prepend("a", 0, 0, []byte("0")); !stored {
+		t.Errorf("Prepend(a): not stored")
+	}
+	results, _ := mc.Get("a", "b")
+	want := []cacheservice.Result{{Key: "a", Value: []byte("012"), Flags: 1}}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("Get(a, b): %v, want %v", results, want)
+	}
+
+	results, _ = mc.Gets("a")
+	cas := results[0].Cas
+	if stored, _ := mc.Cas("a", 0, 0, []byte("3"), cas+1); stored {
+		t.Errorf("Cas(a) with a wrong cas: stored")
+	}
+	if stored, _ := mc.Cas("a", 0, 0, []byte("3"), cas); !stored {
+		t.Errorf("Cas(a): not stored")
+	}
+	if deleted, _ := mc.Delete("a"); !deleted {
+		t.Errorf("Delete(a): not deleted")
+	}
+	if deleted, _ := mc.Delete("a"); deleted {
+		t.Errorf("Delete(a) again: deleted")
+	}
+
+	mc.Set("c", 0, 0, []byte("3"))
+	mc.FlushAll()
+	if results, _ := mc.Get("c"); len(results) != 0 {
+		t.Errorf("Get(c) after FlushAll: %v, want none", results)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	mc := NewMemoryCache(100)
+	mc.Set("a", 0, 1, []byte("1"))
+	// A timeout larger than 30 days is a unix time.
+	mc.Set("b", 0, uint64(time.Now().Add(-time.Second).Unix()), []byte("2"))
+	if results, _ := mc.Get("a", "b"); len(results) != 1 || results[0].Key != "a" {
+		t.Errorf("Get(a, b): %v, want a only", results)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if results, _ := mc.Get("a"); len(results) != 0 {
+		t.Errorf("Get(a) after its timeout: %v, want none", results)
+	}
+	// An expired value can be added again.
+	if stored, _ := mc.Add("a", 0, 0, []byte("1")); !stored {
+		t.Errorf("Add(a) after its timeout: not stored")
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	mc := NewMemoryCache(10)
+	mc.Set("a", 0, 0, []byte("12345"))
+	mc.Set("b", 0, 0, []byte("12345"))
+	mc.Get("a")
+	mc.Set("c", 0, 0, []byte("12345"))
+	results, _ := mc.Get("a", "b", "c")
+	var keys []string
+	for _, result := range results {
+		keys = append(keys, result.Key)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys: %v, want %v", keys, want)
+	}
+}
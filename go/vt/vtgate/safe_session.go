@@ -35,6 +35,13 @@ type SafeSession struct {
 	mu              sync.Mutex
 	mustRollback    bool
 	autocommitState autocommitState
+	// implicitTransaction is set if vtgate started the transaction
+	// because of autocommit. Such transactions can be committed in
+	// batches. See CommitBatch in vcursor_impl.go.
+	implicitTransaction bool
+	// commitOrder is the list of shard sessions that Find and
+	// Append work on. See CommitOrder in vtgate.proto.
+	commitOrder vtgatepb.CommitOrder
 	*vtgatepb.Session
 }
 
@@ -73,6 +80,8 @@ func NewAutocommitSession(sessn *vtgatepb.Session) *SafeSession {
 	newSession := proto.Clone(sessn).(*vtgatepb.Session)
 	newSession.InTransaction = false
 	newSession.ShardSessions = nil
+	newSession.PreSessions = nil
+	newSession.PostSessions = nil
 	newSession.Autocommit = true
 	return NewSafeSession(newSession)
 }
@@ -105,13 +114,40 @@ func (session *SafeSession) AutocommitApproval() bool {
 		panic("BUG: AutocommitToken: unexpected autocommit state")
 	}
 
-	if session.autocommitState == autocommittable && len(session.ShardSessions) == 0 {
+	// The pre sessions must be committed before the main transaction,
+	// which can't be autocommitted if there are any.
+	if session.autocommitState == autocommittable && len(session.ShardSessions) == 0 && len(session.PreSessions) == 0 {
 		session.autocommitState = autocommitted
 		return true
 	}
 	return false
 }
 
+// SetImplicitTransaction marks the current transaction as
+// started by vtgate because of autocommit.
+func (session *SafeSession) SetImplicitTransaction() {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.implicitTransaction = true
+}
+
+// IsImplicitTransaction returns true if the current transaction
+// was started by vtgate because of autocommit.
+func (session *SafeSession) IsImplicitTransaction() bool {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.implicitTransaction
+}
+
+// SetCommitOrder sets the list of shard sessions that Find and Append
+// work on. The queries executed with the session after the call are
+// committed in that order, relative to the main transaction.
+func (session *SafeSession) SetCommitOrder(co vtgatepb.CommitOrder) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.commitOrder = co
+}
+
 // InTransaction returns true if we are in a transaction
 func (session *SafeSession) InTransaction() bool {
 	if session == nil || session.Session == nil {
@@ -129,7 +165,16 @@ func (session *SafeSession) Find(keyspace, shard string, tabletType topodatapb.T
 	}
 	session.mu.Lock()
 	defer session.mu.Unlock()
-	for _, shardSession := range session.ShardSessions {
+	var sessions []*vtgatepb.Session_ShardSession
+	switch session.commitOrder {
+	case vtgatepb.CommitOrder_NORMAL:
+		sessions = session.ShardSessions
+	case vtgatepb.CommitOrder_PRE:
+		sessions = session.PreSessions
+	case vtgatepb.CommitOrder_POST:
+		sessions = session.PostSessions
+	}
+	for _, shardSession := range sessions {
 		if keyspace == shardSession.Target.Keyspace && tabletType == shardSession.Target.TabletType && shard == shardSession.Target.Shard {
 			return shardSession.TransactionId
 		}
@@ -147,10 +192,20 @@ func (session *SafeSession) Append(shardSession *vtgatepb.Session_ShardSession,
 	}
 
 	// Always append, in order for rollback to succeed.
-	session.ShardSessions = append(session.ShardSessions, shardSession)
-	if session.isSingleDB(txMode) && len(session.ShardSessions) > 1 {
-		session.mustRollback = true
-		return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "multi-db transaction attempted: %v", session.ShardSessions)
+	switch session.commitOrder {
+	case vtgatepb.CommitOrder_NORMAL:
+		session.ShardSessions = append(session.ShardSessions, shardSession)
+		if session.isSingleDB(txMode) && len(session.ShardSessions) > 1 {
+			session.mustRollback = true
+			return vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "multi-db transaction attempted: %v", session.ShardSessions)
+		}
+	case vtgatepb.CommitOrder_PRE:
+		session.PreSessions = append(session.PreSessions, shardSession)
+	case vtgatepb.CommitOrder_POST:
+		session.PostSessions = append(session.PostSessions, shardSession)
+	default:
+		// Should be unreachable.
+		return vterrors.Errorf(vtrpcpb.Code_INTERNAL, "BUG: SafeSession.Append: unexpected commit order: %v", session.commitOrder)
 	}
 	return nil
 }
@@ -191,7 +246,10 @@ func (session *SafeSession) Reset() {
 	defer session.mu.Unlock()
 	session.mustRollback = false
 	session.autocommitState = notAutocommittable
+	session.implicitTransaction = false
 	session.Session.InTransaction = false
 	session.SingleDb = false
 	session.ShardSessions = nil
+	session.PreSessions = nil
+	session.PostSessions = nil
 }
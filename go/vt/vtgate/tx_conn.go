@@ -89,10 +89,32 @@ func (txc *TxConn) Commit(ctx context.Context, session *SafeSession) error {
 	case vtgatepb.TransactionMode_UNSPECIFIED:
 		twopc = (txc.mode == vtgatepb.TransactionMode_TWOPC)
 	}
+
+	// The pre sessions are committed first, and the post sessions
+	// last. If the pre sessions fail, the main transaction is rolled
+	// back. This way, a committed row always has its consistent lookup
+	// entries: the entries left over by a failure point to missing rows,
+	// and they're reclaimed by the vindex.
+	if err := txc.runSessions(session.PreSessions, func(s *vtgatepb.Session_ShardSession) error {
+		return txc.gateway.Commit(ctx, s.Target, s.TransactionId)
+	}); err != nil {
+		txc.rollbackSessions(ctx, session.ShardSessions)
+		txc.rollbackSessions(ctx, session.PostSessions)
+		return err
+	}
+	var err error
 	if twopc {
-		return txc.commit2PC(ctx, session)
+		err = txc.commit2PC(ctx, session)
+	} else {
+		err = txc.commitNormal(ctx, session)
+	}
+	if err != nil {
+		txc.rollbackSessions(ctx, session.PostSessions)
+		return err
 	}
-	return txc.commitNormal(ctx, session)
+	return txc.runSessions(session.PostSessions, func(s *vtgatepb.Session_ShardSession) error {
+		return txc.gateway.Commit(ctx, s.Target, s.TransactionId)
+	})
 }
 
 func (txc *TxConn) commitNormal(ctx context.Context, session *SafeSession) error {
@@ -110,6 +132,14 @@ func (txc *TxConn) commitNormal(ctx context.Context, session *SafeSession) error
 	return err
 }
 
+// rollbackSessions rolls back shardSessions, ignoring errors. It's
+// used to clean up after a failed commit.
+func (txc *TxConn) rollbackSessions(ctx context.Context, shardSessions []*vtgatepb.Session_ShardSession) {
+	for _, s := range shardSessions {
+		txc.gateway.Rollback(ctx, s.Target, s.TransactionId)
+	}
+}
+
 func (txc *TxConn) commit2PC(ctx context.Context, session *SafeSession) error {
 	// If the number of participants is one or less, then it's a normal commit.
 	if len(session.ShardSessions) <= 1 {
@@ -164,7 +194,11 @@ func (txc *TxConn) Rollback(ctx context.Context, session *SafeSession) error {
 	}
 	defer session.Reset()
 
-	return txc.runSessions(session.ShardSessions, func(s *vtgatepb.Session_ShardSession) error {
+	var allSessions []*vtgatepb.Session_ShardSession
+	allSessions = append(allSessions, session.PreSessions...)
+	allSessions = append(allSessions, session.ShardSessions...)
+	allSessions = append(allSessions, session.PostSessions...)
+	return txc.runSessions(allSessions, func(s *vtgatepb.Session_ShardSession) error {
 		return txc.gateway.Rollback(ctx, s.Target, s.TransactionId)
 	})
 }
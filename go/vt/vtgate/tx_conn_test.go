@@ -160,6 +160,106 @@ func TestTxConnCommitSuccess(t *testing.T) {
 	}
 }
 
+func TestTxConnCommitOrderSuccess(t *testing.T) {
+	sc, sbc0, sbc1 := newTestTxConnEnv("TestTxConn")
+	sc.txConn.mode = vtgatepb.TransactionMode_MULTI
+
+	queries := []*querypb.BoundQuery{{
+		Sql: "query1",
+	}}
+
+	// Sequence the executes to ensure commit order
+	session := NewSafeSession(&vtgatepb.Session{InTransaction: true})
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"0": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_PRE)
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"0": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_POST)
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"1": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_NORMAL)
+	wantSession := vtgatepb.Session{
+		InTransaction: true,
+		ShardSessions: []*vtgatepb.Session_ShardSession{{
+			Target: &querypb.Target{
+				Keyspace:   "TestTxConn",
+				Shard:      "0",
+				TabletType: topodatapb.TabletType_MASTER,
+			},
+			TransactionId: 1,
+		}},
+		PreSessions: []*vtgatepb.Session_ShardSession{{
+			Target: &querypb.Target{
+				Keyspace:   "TestTxConn",
+				Shard:      "0",
+				TabletType: topodatapb.TabletType_MASTER,
+			},
+			TransactionId: 2,
+		}},
+		PostSessions: []*vtgatepb.Session_ShardSession{{
+			Target: &querypb.Target{
+				Keyspace:   "TestTxConn",
+				Shard:      "1",
+				TabletType: topodatapb.TabletType_MASTER,
+			},
+			TransactionId: 1,
+		}},
+	}
+	if !proto.Equal(session.Session, &wantSession) {
+		t.Errorf("Session:\n%+v, want\n%+v", *session.Session, wantSession)
+	}
+
+	if err := sc.txConn.Commit(context.Background(), session); err != nil {
+		t.Fatal(err)
+	}
+	wantSession = vtgatepb.Session{}
+	if !proto.Equal(session.Session, &wantSession) {
+		t.Errorf("Session:\n%+v, want\n%+v", *session.Session, wantSession)
+	}
+	if commitCount := sbc0.CommitCount.Get(); commitCount != 2 {
+		t.Errorf("sbc0.CommitCount: %d, want 2", commitCount)
+	}
+	if commitCount := sbc1.CommitCount.Get(); commitCount != 1 {
+		t.Errorf("sbc1.CommitCount: %d, want 1", commitCount)
+	}
+}
+
+func TestTxConnCommitOrderFailure(t *testing.T) {
+	sc, sbc0, sbc1 := newTestTxConnEnv("TestTxConn")
+	sc.txConn.mode = vtgatepb.TransactionMode_MULTI
+
+	queries := []*querypb.BoundQuery{{
+		Sql: "query1",
+	}}
+
+	session := NewSafeSession(&vtgatepb.Session{InTransaction: true})
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"1": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_PRE)
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"0": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_POST)
+	sc.ExecuteMultiShard(context.Background(), "TestTxConn", map[string]*querypb.BoundQuery{"1": queries[0]}, topodatapb.TabletType_MASTER, session, false, false)
+	session.SetCommitOrder(vtgatepb.CommitOrder_NORMAL)
+
+	// The failed pre session must roll back the main and post sessions.
+	sbc0.MustFailCodes[vtrpcpb.Code_INVALID_ARGUMENT] = 1
+	err := sc.txConn.Commit(context.Background(), session)
+	want := "INVALID_ARGUMENT error"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Commit: %v, want %s", err, want)
+	}
+	wantSession := vtgatepb.Session{}
+	if !proto.Equal(session.Session, &wantSession) {
+		t.Errorf("Session:\n%+v, want\n%+v", *session.Session, wantSession)
+	}
+	if commitCount := sbc0.CommitCount.Get(); commitCount != 1 {
+		t.Errorf("sbc0.CommitCount: %d, want 1", commitCount)
+	}
+	if commitCount := sbc1.CommitCount.Get(); commitCount != 0 {
+		t.Errorf("sbc1.CommitCount: %d, want 0", commitCount)
+	}
+	if rollbackCount := sbc1.RollbackCount.Get(); rollbackCount != 2 {
+		t.Errorf("sbc1.RollbackCount: %d, want 2", rollbackCount)
+	}
+}
+
 func TestTxConnCommit2PC(t *testing.T) {
 	sc, sbc0, sbc1 := newTestTxConnEnv("TestTxConnCommit2PC")
 
@@ -30,6 +30,7 @@ import (
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
 )
 
@@ -101,8 +102,11 @@ func (vc *vcursorImpl) DefaultKeyspace() (*vindexes.Keyspace, error) {
 	return ks.Keyspace, nil
 }
 
-// Execute performs a V3 level execution of the query.
-func (vc *vcursorImpl) Execute(method string, query string, BindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+// Execute performs a V3 level execution of the query. The query
+// runs in the transaction of the session designated by co.
+func (vc *vcursorImpl) Execute(method string, query string, BindVars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error) {
+	vc.safeSession.SetCommitOrder(co)
+	defer vc.safeSession.SetCommitOrder(vtgatepb.CommitOrder_NORMAL)
 	qr, err := vc.executor.Execute(vc.ctx, method, vc.safeSession, query+vc.trailingComments, BindVars)
 	if err == nil {
 		vc.hasPartialDML = true
@@ -119,6 +123,47 @@ func (vc *vcursorImpl) ExecuteAutocommit(method string, query string, BindVars m
 	return qr, err
 }
 
+// ExecuteKeyspaceID executes the query on the shard of ksid in keyspace,
+// in the main transaction of the session.
+func (vc *vcursorImpl) ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	ks, _, allShards, err := srvtopo.GetKeyspaceShards(vc.ctx, vc.executor.serv, vc.executor.cell, keyspace, vc.target.TabletType)
+	if err != nil {
+		return nil, err
+	}
+	shard, err := key.GetShardForKeyspaceID(allShards, ksid)
+	if err != nil {
+		return nil, err
+	}
+	shardQueries := map[string]*querypb.BoundQuery{
+		shard: {
+			Sql:           query,
+			BindVariables: bindVars,
+		},
+	}
+	return vc.ExecuteMultiShard(ks, shardQueries, isDML, false /* canAutocommit */)
+}
+
+// CommitBatch commits the current transaction and begins a new one,
+// if the transaction was started because of autocommit.
+func (vc *vcursorImpl) CommitBatch() error {
+	if !vc.safeSession.IsImplicitTransaction() {
+		return nil
+	}
+	if err := vc.executor.txConn.Commit(vc.ctx, vc.safeSession); err != nil {
+		return err
+	}
+	if err := vc.executor.txConn.Begin(vc.ctx, vc.safeSession); err != nil {
+		return err
+	}
+	vc.safeSession.SetImplicitTransaction()
+	return nil
+}
+
+// InTransaction returns true if the session is in a transaction.
+func (vc *vcursorImpl) InTransaction() bool {
+	return vc.safeSession.InTransaction()
+}
+
 // ExecuteMultiShard executes different queries on different shards and returns the combined result.
 func (vc *vcursorImpl) ExecuteMultiShard(keyspace string, shardQueries map[string]*querypb.BoundQuery, isDML, canAutocommit bool) (*sqltypes.Result, error) {
 	atomic.AddUint32(&vc.logStats.ShardQueries, uint32(len(shardQueries)))
@@ -0,0 +1,373 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vindexes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+var (
+	_ Vindex        = (*ConsistentLookupUnique)(nil)
+	_ Unique        = (*ConsistentLookupUnique)(nil)
+	_ Lookup        = (*ConsistentLookupUnique)(nil)
+	_ WantOwnerInfo = (*ConsistentLookupUnique)(nil)
+	_ Vindex        = (*ConsistentLookup)(nil)
+	_ NonUnique     = (*ConsistentLookup)(nil)
+	_ Lookup        = (*ConsistentLookup)(nil)
+	_ WantOwnerInfo = (*ConsistentLookup)(nil)
+)
+
+func init() {
+	Register("consistent_lookup", NewConsistentLookup)
+	Register("consistent_lookup_unique", NewConsistentLookupUnique)
+}
+
+// ConsistentLookup is a non-unique lookup vindex that can stay
+// consistent with respect to its owner table without 2PC.
+// The lookup rows are created in a pre-commit transaction, which
+// commits before the transaction of the owner rows, and deleted in a
+// post-commit transaction, which commits after it. A failed commit can
+// therefore leave orphaned lookup rows, but never rows without their
+// lookup entry. An orphaned row is reclaimed when an insert conflicts
+// with it and its owner row doesn't exist.
+type ConsistentLookup struct {
+	*clCommon
+}
+
+// NewConsistentLookup creates a ConsistentLookup vindex.
+// The supplied map has the following required fields:
+//   table: name of the backing table. It can be qualified by the keyspace.
+//   from: list of columns in the table that have the 'from' values of the lookup vindex.
+//   to: The 'to' column name of the table.
+func NewConsistentLookup(name string, m map[string]string) (Vindex, error) {
+	clc, err := newCLCommon(name, m)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistentLookup{clCommon: clc}, nil
+}
+
+// Cost returns the cost of this vindex as 20.
+func (lu *ConsistentLookup) Cost() int {
+	return 20
+}
+
+// Map returns the corresponding KeyspaceId values for the given ids.
+func (lu *ConsistentLookup) Map(vcursor VCursor, ids []sqltypes.Value) ([]Ksids, error) {
+	out := make([]Ksids, 0, len(ids))
+	results, err := lu.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_PRE)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if len(result.Rows) == 0 {
+			out = append(out, Ksids{})
+			continue
+		}
+		ksids := make([][]byte, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			ksids = append(ksids, row[0].ToBytes())
+		}
+		out = append(out, Ksids{IDs: ksids})
+	}
+	return out, nil
+}
+
+//====================================================================
+
+// ConsistentLookupUnique defines a vindex that uses a lookup table.
+// The table is expected to define the id column as unique. It's
+// Unique and a Lookup. Its lookup rows are kept consistent like those
+// of ConsistentLookup.
+type ConsistentLookupUnique struct {
+	*clCommon
+}
+
+// NewConsistentLookupUnique creates a ConsistentLookupUnique vindex.
+// The supplied map has the following required fields:
+//   table: name of the backing table. It can be qualified by the keyspace.
+//   from: list of columns in the table that have the 'from' values of the lookup vindex.
+//   to: The 'to' column name of the table.
+func NewConsistentLookupUnique(name string, m map[string]string) (Vindex, error) {
+	clc, err := newCLCommon(name, m)
+	if err != nil {
+		return nil, err
+	}
+	return &ConsistentLookupUnique{clCommon: clc}, nil
+}
+
+// Cost returns the cost of this vindex as 10.
+func (lu *ConsistentLookupUnique) Cost() int {
+	return 10
+}
+
+// Map returns the corresponding KeyspaceId values for the given ids.
+func (lu *ConsistentLookupUnique) Map(vcursor VCursor, ids []sqltypes.Value) ([]KsidOrRange, error) {
+	out := make([]KsidOrRange, 0, len(ids))
+	results, err := lu.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_PRE)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range results {
+		switch len(result.Rows) {
+		case 0:
+			out = append(out, KsidOrRange{})
+		case 1:
+			out = append(out, KsidOrRange{ID: result.Rows[0][0].ToBytes()})
+		default:
+			return nil, fmt.Errorf("Lookup.Map: unexpected multiple results from vindex %s: %v", lu.lkp.Table, ids[i])
+		}
+	}
+	return out, nil
+}
+
+//====================================================================
+
+// clCommon implements the functions shared by the consistent lookup
+// vindexes.
+type clCommon struct {
+	name         string
+	lkp          lookupInternal
+	keyspace     string
+	ownerTable   string
+	ownerColumns []string
+
+	lockLookupQuery   string
+	lockOwnerQuery    string
+	insertLookupQuery string
+	updateLookupQuery string
+}
+
+// newCLCommon is common code for the consistent lookup vindexes.
+func newCLCommon(name string, m map[string]string) (*clCommon, error) {
+	lu := &clCommon{name: name}
+	if _, ok := m["autocommit"]; ok {
+		return nil, fmt.Errorf("autocommit is not allowed for consistent lookup vindex %s", name)
+	}
+	if _, ok := m["write_only"]; ok {
+		return nil, fmt.Errorf("write_only is not allowed for consistent lookup vindex %s", name)
+	}
+	if err := lu.lkp.Init(m, false /* autocommit */, false /* upsert */); err != nil {
+		return nil, err
+	}
+	return lu, nil
+}
+
+// SetOwnerInfo is for WantOwnerInfo. It builds the queries that
+// lock the lookup and owner rows.
+func (lu *clCommon) SetOwnerInfo(keyspace, table string, cols []sqlparser.ColIdent) error {
+	if len(cols) != len(lu.lkp.FromColumns) {
+		return fmt.Errorf("owner table column count does not match vindex %s", lu.name)
+	}
+	lu.keyspace = keyspace
+	lu.ownerTable = sqlparser.String(sqlparser.NewTableIdent(table))
+	lu.ownerColumns = make([]string, len(cols))
+	for i, col := range cols {
+		lu.ownerColumns[i] = sqlparser.String(col)
+	}
+	lu.lockLookupQuery = lu.generateLockLookup()
+	lu.lockOwnerQuery = lu.generateLockOwner()
+	lu.insertLookupQuery = lu.generateInsertLookup()
+	lu.updateLookupQuery = lu.generateUpdateLookup()
+	return nil
+}
+
+// String returns the name of the vindex.
+func (lu *clCommon) String() string {
+	return lu.name
+}
+
+// Verify returns true if ids maps to ksids.
+func (lu *clCommon) Verify(vcursor VCursor, ids []sqltypes.Value, ksids [][]byte) ([]bool, error) {
+	return lu.lkp.Verify(vcursor, ids, ksidsToValues(ksids), vtgatepb.CommitOrder_PRE)
+}
+
+// Create reserves the id by inserting it into the vindex table.
+// If the insert fails because of a duplicate, the rows are inserted
+// one by one, and a conflicting lookup row is reclaimed if its owner
+// row doesn't exist.
+func (lu *clCommon) Create(vcursor VCursor, rowsColValues [][]sqltypes.Value, ksids [][]byte, ignoreMode bool) error {
+	err := lu.lkp.createCustom(vcursor, rowsColValues, ksidsToValues(ksids), ignoreMode, vtgatepb.CommitOrder_PRE)
+	if err == nil {
+		return nil
+	}
+	if vterrors.Code(err) != vtrpcpb.Code_ALREADY_EXISTS {
+		return err
+	}
+	for i, row := range rowsColValues {
+		if err := lu.handleDup(vcursor, row, ksids[i], err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleDup creates the lookup row of values, which may conflict
+// with an existing row. The existing row and its owner row are locked:
+// if the owner exists, the dup error is returned. If not, the lookup
+// row is an orphan, and it's updated to point to ksid.
+func (lu *clCommon) handleDup(vcursor VCursor, values []sqltypes.Value, ksid []byte, dupError error) error {
+	bindVars := make(map[string]*querypb.BindVariable, len(values)+1)
+	for colnum, val := range values {
+		bindVars[lu.lkp.FromColumns[colnum]] = sqltypes.ValueBindVariable(val)
+	}
+	bindVars[lu.lkp.To] = sqltypes.BytesBindVariable(ksid)
+
+	// Lock the lookup row in the pre-commit transaction.
+	qr, err := vcursor.Execute("VindexCreate", lu.lockLookupQuery, bindVars, false /* isDML */, vtgatepb.CommitOrder_PRE)
+	if err != nil {
+		return err
+	}
+	switch len(qr.Rows) {
+	case 0:
+		if _, err := vcursor.Execute("VindexCreate", lu.insertLookupQuery, bindVars, true /* isDML */, vtgatepb.CommitOrder_PRE); err != nil {
+			return err
+		}
+	case 1:
+		if lu.lockOwnerQuery == "" {
+			return dupError
+		}
+		existingksid := qr.Rows[0][0].ToBytes()
+		// Lock the owner row in the main transaction.
+		qr, err = vcursor.ExecuteKeyspaceID(lu.keyspace, existingksid, lu.lockOwnerQuery, bindVars, false /* isDML */)
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) != 0 {
+			return dupError
+		}
+		if bytes.Equal(existingksid, ksid) {
+			return nil
+		}
+		if _, err := vcursor.Execute("VindexCreate", lu.updateLookupQuery, bindVars, true /* isDML */, vtgatepb.CommitOrder_PRE); err != nil {
+			return err
+		}
+	default:
+		return vterrors.Errorf(vtrpcpb.Code_INTERNAL, "unexpected rows: %v from consistent lookup vindex %s", qr.Rows, lu.name)
+	}
+	return nil
+}
+
+// Delete deletes the entry from the vindex table. The rows are
+// deleted in the post-commit transaction.
+func (lu *clCommon) Delete(vcursor VCursor, rowsColValues [][]sqltypes.Value, ksid []byte) error {
+	return lu.lkp.deleteCustom(vcursor, rowsColValues, sqltypes.MakeTrusted(sqltypes.VarBinary, ksid), vtgatepb.CommitOrder_POST)
+}
+
+// Update updates the entry in the vindex table.
+func (lu *clCommon) Update(vcursor VCursor, oldValues []sqltypes.Value, ksid []byte, newValues []sqltypes.Value) error {
+	// The lookup row is left as is if the values don't change:
+	// the insert would otherwise run before the delete, and fail
+	// on the existing row.
+	if valuesEqual(oldValues, newValues) {
+		return nil
+	}
+	if err := lu.Delete(vcursor, [][]sqltypes.Value{oldValues}, ksid); err != nil {
+		return err
+	}
+	return lu.Create(vcursor, [][]sqltypes.Value{newValues}, [][]byte{ksid}, false /* ignoreMode */)
+}
+
+// valuesEqual returns true if the two lists of values are equal.
+// Values that cannot be compared numerically are compared bytewise.
+func valuesEqual(left, right []sqltypes.Value) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i].IsNull() || right[i].IsNull() {
+			if left[i].IsNull() != right[i].IsNull() {
+				return false
+			}
+			continue
+		}
+		cmp, err := sqltypes.NullsafeCompare(left[i], right[i])
+		if err != nil {
+			if !bytes.Equal(left[i].ToBytes(), right[i].ToBytes()) {
+				return false
+			}
+			continue
+		}
+		if cmp != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalJSON returns a JSON representation of the vindex.
+func (lu *clCommon) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lu.lkp)
+}
+
+func (lu *clCommon) generateLockLookup() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "select %s from %s", lu.lkp.To, lu.lkp.Table)
+	lu.addWhere(buf, lu.lkp.FromColumns)
+	buf.WriteString(" for update")
+	return buf.String()
+}
+
+func (lu *clCommon) generateLockOwner() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "select %s from %s", lu.ownerColumns[0], lu.ownerTable)
+	lu.addWhere(buf, lu.ownerColumns)
+	buf.WriteString(" for update")
+	return buf.String()
+}
+
+func (lu *clCommon) generateInsertLookup() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "insert into %s(", lu.lkp.Table)
+	for _, col := range lu.lkp.FromColumns {
+		fmt.Fprintf(buf, "%s, ", col)
+	}
+	fmt.Fprintf(buf, "%s) values(", lu.lkp.To)
+	for _, col := range lu.lkp.FromColumns {
+		fmt.Fprintf(buf, ":%s, ", col)
+	}
+	fmt.Fprintf(buf, ":%s)", lu.lkp.To)
+	return buf.String()
+}
+
+func (lu *clCommon) generateUpdateLookup() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "update %s set %s = :%s", lu.lkp.Table, lu.lkp.To, lu.lkp.To)
+	lu.addWhere(buf, lu.lkp.FromColumns)
+	return buf.String()
+}
+
+// addWhere adds a where clause that matches cols with the bind
+// variables of the from columns.
+func (lu *clCommon) addWhere(buf *bytes.Buffer, cols []string) {
+	buf.WriteString(" where ")
+	for colIdx, column := range cols {
+		if colIdx != 0 {
+			buf.WriteString(" and ")
+		}
+		fmt.Fprintf(buf, "%s = :%s", column, lu.lkp.FromColumns[colIdx])
+	}
+}
@@ -0,0 +1,462 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package vindexes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vterrors"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
+	vtrpcpb "vitess.io/vitess/go/vt/proto/vtrpc"
+)
+
+func TestConsistentLookupInit(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	cols := []sqlparser.ColIdent{
+		sqlparser.NewColIdent("fc"),
+	}
+	err := lookup.(WantOwnerInfo).SetOwnerInfo("ks", "t1", cols)
+	want := "owner table column count does not match vindex consistent_lookup"
+	if err == nil || err.Error() != want {
+		t.Errorf("SetOwnerInfo: %v, want %v", err, want)
+	}
+
+	_, err = CreateVindex("consistent_lookup", "consistent_lookup", map[string]string{
+		"table":      "t",
+		"from":       "fromc1,fromc2",
+		"to":         "toc",
+		"autocommit": "true",
+	})
+	want = "autocommit is not allowed for consistent lookup vindex consistent_lookup"
+	if err == nil || err.Error() != want {
+		t.Errorf("CreateVindex(autocommit): %v, want %v", err, want)
+	}
+}
+
+func TestConsistentLookupInfo(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	if got, want := lookup.Cost(), 20; got != want {
+		t.Errorf("Cost(): %d, want %d", got, want)
+	}
+	if got, want := lookup.String(), "consistent_lookup"; got != want {
+		t.Errorf("String(): %s, want %s", got, want)
+	}
+	if IsUnique(lookup) {
+		t.Errorf("IsUnique(): true, want false")
+	}
+
+	lookup = createConsistentLookup(t, "consistent_lookup_unique")
+	if got, want := lookup.Cost(), 10; got != want {
+		t.Errorf("Cost(): %d, want %d", got, want)
+	}
+	if !IsUnique(lookup) {
+		t.Errorf("IsUnique(): false, want true")
+	}
+}
+
+func TestConsistentLookupMap(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(makeTestResult(2), nil)
+	vc.AddResult(makeTestResult(2), nil)
+
+	got, err := lookup.(NonUnique).Map(vc, []sqltypes.Value{sqltypes.NewInt64(1), sqltypes.NewInt64(2)})
+	if err != nil {
+		t.Error(err)
+	}
+	want := []Ksids{{
+		IDs: [][]byte{
+			[]byte("1"),
+			[]byte("2"),
+		},
+	}, {
+		IDs: [][]byte{
+			[]byte("1"),
+			[]byte("2"),
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Map(): %#v, want %+v", got, want)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre select toc from t where fromc1 = :fromc1 [{fromc1 1}] false",
+		"ExecutePre select toc from t where fromc1 = :fromc1 [{fromc1 2}] false",
+	})
+
+	// Test query fail.
+	vc.AddResult(nil, fmt.Errorf("execute failed"))
+	_, err = lookup.(NonUnique).Map(vc, []sqltypes.Value{sqltypes.NewInt64(1)})
+	wantErr := "lookup.Map: execute failed"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("lookup(query fail) err: %v, want %s", err, wantErr)
+	}
+}
+
+func TestConsistentLookupUniqueMap(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup_unique")
+	vc := &loggingVCursor{}
+	vc.AddResult(makeTestResult(0), nil)
+	vc.AddResult(makeTestResult(1), nil)
+
+	got, err := lookup.(Unique).Map(vc, []sqltypes.Value{sqltypes.NewInt64(1), sqltypes.NewInt64(2)})
+	if err != nil {
+		t.Error(err)
+	}
+	want := []KsidOrRange{{}, {ID: []byte("1")}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Map(): %#v, want %+v", got, want)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre select toc from t where fromc1 = :fromc1 [{fromc1 1}] false",
+		"ExecutePre select toc from t where fromc1 = :fromc1 [{fromc1 2}] false",
+	})
+
+	// More than one result is invalid
+	vc.AddResult(makeTestResult(2), nil)
+	_, err = lookup.(Unique).Map(vc, []sqltypes.Value{sqltypes.NewInt64(1)})
+	wantErr := "Lookup.Map: unexpected multiple results from vindex t: INT64(1)"
+	if err == nil || err.Error() != wantErr {
+		t.Errorf("lookup(query fail) err: %v, want %s", err, wantErr)
+	}
+}
+
+func TestConsistentLookupVerify(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(makeTestResult(1), nil)
+	vc.AddResult(makeTestResult(0), nil)
+
+	got, err := lookup.Verify(vc, []sqltypes.Value{sqltypes.NewInt64(1), sqltypes.NewInt64(2)}, [][]byte{[]byte("test1"), []byte("test2")})
+	if err != nil {
+		t.Error(err)
+	}
+	want := []bool{true, false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify(): %v, want %v", got, want)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre select fromc1 from t where fromc1 = :fromc1 and toc = :toc [{fromc1 1} {toc test1}] true",
+		"ExecutePre select fromc1 from t where fromc1 = :fromc1 and toc = :toc [{fromc1 2} {toc test2}] true",
+	})
+}
+
+func TestConsistentLookupCreateSimple(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}, {
+		sqltypes.NewInt64(3),
+		sqltypes.NewInt64(4),
+	}}, [][]byte{[]byte("test1"), []byte("test2")}, false /* ignoreMode */); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0), (:fromc11, :fromc21, :toc1) [{fromc10 1} {fromc11 3} {fromc20 2} {fromc21 4} {toc0 test1} {toc1 test2}] true",
+	})
+}
+
+func TestConsistentLookupCreateThenRecreate(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry"))
+	vc.AddResult(&sqltypes.Result{}, nil)
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("test1")}, false /* ignoreMode */); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 1} {fromc20 2} {toc0 test1}] true",
+		"ExecutePre select toc from t where fromc1 = :fromc1 and fromc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc test1}] false",
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc1, :fromc2, :toc) [{fromc1 1} {fromc2 2} {toc test1}] true",
+	})
+}
+
+func TestConsistentLookupCreateThenUpdate(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry"))
+	vc.AddResult(makeTestResult(1), nil)
+	vc.AddResult(&sqltypes.Result{}, nil)
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("test1")}, false /* ignoreMode */); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 1} {fromc20 2} {toc0 test1}] true",
+		"ExecutePre select toc from t where fromc1 = :fromc1 and fromc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc test1}] false",
+		"ExecuteKeyspaceID ks 31 select fc1 from t1 where fc1 = :fromc1 and fc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc test1}] false",
+		"ExecutePre update t set toc = :toc where fromc1 = :fromc1 and fromc2 = :fromc2 [{fromc1 1} {fromc2 2} {toc test1}] true",
+	})
+}
+
+func TestConsistentLookupCreateThenSkipUpdate(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry"))
+	vc.AddResult(makeTestResult(1), nil)
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("1")}, false /* ignoreMode */); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 1} {fromc20 2} {toc0 1}] true",
+		"ExecutePre select toc from t where fromc1 = :fromc1 and fromc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc 1}] false",
+		"ExecuteKeyspaceID ks 31 select fc1 from t1 where fc1 = :fromc1 and fc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc 1}] false",
+	})
+}
+
+func TestConsistentLookupCreateThenDupkey(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry"))
+	vc.AddResult(makeTestResult(1), nil)
+	vc.AddResult(makeTestResult(1), nil)
+
+	err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("test1")}, false /* ignoreMode */)
+	want := "lookup.Create: Duplicate entry"
+	if err == nil || err.Error() != want {
+		t.Errorf("lookup(query fail) err: %v, want %s", err, want)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 1} {fromc20 2} {toc0 test1}] true",
+		"ExecutePre select toc from t where fromc1 = :fromc1 and fromc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc test1}] false",
+		"ExecuteKeyspaceID ks 31 select fc1 from t1 where fc1 = :fromc1 and fc2 = :fromc2 for update [{fromc1 1} {fromc2 2} {toc test1}] false",
+	})
+}
+
+func TestConsistentLookupCreateNonDupError(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, errors.New("general error"))
+
+	err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("test1")}, false /* ignoreMode */)
+	want := "lookup.Create: general error"
+	if err == nil || err.Error() != want {
+		t.Errorf("lookup(query fail) err: %v, want %s", err, want)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 1} {fromc20 2} {toc0 test1}] true",
+	})
+}
+
+func TestConsistentLookupCreateThenBadRows(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(nil, vterrors.New(vtrpcpb.Code_ALREADY_EXISTS, "Duplicate entry"))
+	vc.AddResult(makeTestResult(2), nil)
+
+	err := lookup.(Lookup).Create(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, [][]byte{[]byte("test1")}, false /* ignoreMode */)
+	want := "unexpected rows: [[INT64(1)] [INT64(2)]] from consistent lookup vindex consistent_lookup"
+	if err == nil || err.Error() != want {
+		t.Errorf("lookup(query fail) err: %v, want %s", err, want)
+	}
+}
+
+func TestConsistentLookupDelete(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Delete(vc, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}}, []byte("test")); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePost delete from t where fromc1 = :fromc1 and fromc2 = :fromc2 and toc = :toc [{fromc1 1} {fromc2 2} {toc test}] true",
+	})
+}
+
+func TestConsistentLookupUpdate(t *testing.T) {
+	lookup := createConsistentLookup(t, "consistent_lookup")
+	vc := &loggingVCursor{}
+	vc.AddResult(&sqltypes.Result{}, nil)
+	vc.AddResult(&sqltypes.Result{}, nil)
+
+	if err := lookup.(Lookup).Update(vc, []sqltypes.Value{
+		sqltypes.NewInt64(1),
+		sqltypes.NewInt64(2),
+	}, []byte("test"), []sqltypes.Value{
+		sqltypes.NewInt64(3),
+		sqltypes.NewInt64(4),
+	}); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{
+		"ExecutePost delete from t where fromc1 = :fromc1 and fromc2 = :fromc2 and toc = :toc [{fromc1 1} {fromc2 2} {toc test}] true",
+		"ExecutePre insert into t(fromc1, fromc2, toc) values(:fromc10, :fromc20, :toc0) [{fromc10 3} {fromc20 4} {toc0 test}] true",
+	})
+
+	// Same values: the lookup row is left as is.
+	vc = &loggingVCursor{}
+	if err := lookup.(Lookup).Update(vc, []sqltypes.Value{
+		sqltypes.NewInt64(1),
+		sqltypes.NewVarChar("a"),
+	}, []byte("test"), []sqltypes.Value{
+		sqltypes.NewInt32(1),
+		sqltypes.NewVarBinary("a"),
+	}); err != nil {
+		t.Error(err)
+	}
+	vc.verifyLog(t, []string{})
+}
+
+func createConsistentLookup(t *testing.T, name string) Vindex {
+	t.Helper()
+	l, err := CreateVindex(name, name, map[string]string{
+		"table": "t",
+		"from":  "fromc1,fromc2",
+		"to":    "toc",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := []sqlparser.ColIdent{
+		sqlparser.NewColIdent("fc1"),
+		sqlparser.NewColIdent("fc2"),
+	}
+	if err := l.(WantOwnerInfo).SetOwnerInfo("ks", "t1", cols); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// loggingVCursor logs the queries it executes, and returns
+// the results that were added to it in order.
+type loggingVCursor struct {
+	results []*sqltypes.Result
+	errors  []error
+	index   int
+	log     []string
+}
+
+func (vc *loggingVCursor) Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error) {
+	name := "Unknown"
+	switch co {
+	case vtgatepb.CommitOrder_NORMAL:
+		name = "Execute"
+	case vtgatepb.CommitOrder_PRE:
+		name = "ExecutePre"
+	case vtgatepb.CommitOrder_POST:
+		name = "ExecutePost"
+	}
+	return vc.execute(name, query, bindvars, isDML)
+}
+
+func (vc *loggingVCursor) ExecuteAutocommit(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	return vc.execute("ExecuteAutocommit", query, bindvars, isDML)
+}
+
+func (vc *loggingVCursor) ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	return vc.execute(fmt.Sprintf("ExecuteKeyspaceID %s %s", keyspace, hex.EncodeToString(ksid)), query, bindVars, isDML)
+}
+
+func (vc *loggingVCursor) AddResult(qr *sqltypes.Result, err error) {
+	vc.results = append(vc.results, qr)
+	vc.errors = append(vc.errors, err)
+}
+
+func (vc *loggingVCursor) execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error) {
+	if vc.index >= len(vc.results) {
+		return nil, fmt.Errorf("ran out of results to return: %s", query)
+	}
+	var keys []string
+	for k := range bindvars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf := &bytes.Buffer{}
+	for i, k := range keys {
+		if i != 0 {
+			buf.WriteString(" ")
+		}
+		fmt.Fprintf(buf, "{%s %s}", k, bindvars[k].Value)
+	}
+	vc.log = append(vc.log, fmt.Sprintf("%s %s [%s] %v", method, query, buf.String(), isDML))
+	idx := vc.index
+	vc.index++
+	if vc.errors[idx] != nil {
+		return nil, vc.errors[idx]
+	}
+	return vc.results[idx], nil
+}
+
+func (vc *loggingVCursor) verifyLog(t *testing.T, want []string) {
+	t.Helper()
+	for i := 0; i < len(want); i++ {
+		if i >= len(vc.log) {
+			t.Errorf("expecting user: %v, got nothing", want[i])
+			continue
+		}
+		if vc.log[i] != want[i] {
+			t.Errorf("log(%d):\n%q, want\n%q", i, vc.log[i], want[i])
+		}
+	}
+	for i := len(want); i < len(vc.log); i++ {
+		t.Errorf("unexpected log: %v", vc.log[i])
+	}
+	vc.log = nil
+}
+
+// makeTestResult returns a result with rows 1 to n.
+func makeTestResult(numRows int) *sqltypes.Result {
+	result := &sqltypes.Result{
+		Fields:       sqltypes.MakeTestFields("id", "varbinary"),
+		RowsAffected: uint64(numRows),
+	}
+	for i := 0; i < numRows; i++ {
+		result.Rows = append(result.Rows, []sqltypes.Value{
+			sqltypes.NewInt64(int64(i + 1)),
+		})
+	}
+	return result
+}
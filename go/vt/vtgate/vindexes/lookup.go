@@ -22,6 +22,7 @@ import (
 
 	"vitess.io/vitess/go/sqltypes"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 var (
@@ -64,7 +65,7 @@ func (ln *LookupNonUnique) Map(vcursor VCursor, ids []sqltypes.Value) ([]Ksids,
 		return out, nil
 	}
 
-	results, err := ln.lkp.Lookup(vcursor, ids)
+	results, err := ln.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_NORMAL)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +92,7 @@ func (ln *LookupNonUnique) Verify(vcursor VCursor, ids []sqltypes.Value, ksids [
 		}
 		return out, nil
 	}
-	return ln.lkp.Verify(vcursor, ids, ksidsToValues(ksids))
+	return ln.lkp.Verify(vcursor, ids, ksidsToValues(ksids), vtgatepb.CommitOrder_NORMAL)
 }
 
 // Create reserves the id by inserting it into the vindex table.
@@ -208,7 +209,7 @@ func (lu *LookupUnique) Map(vcursor VCursor, ids []sqltypes.Value) ([]KsidOrRang
 		}
 		return out, nil
 	}
-	results, err := lu.lkp.Lookup(vcursor, ids)
+	results, err := lu.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_NORMAL)
 	if err != nil {
 		return nil, err
 	}
@@ -234,7 +235,7 @@ func (lu *LookupUnique) Verify(vcursor VCursor, ids []sqltypes.Value, ksids [][]
 		}
 		return out, nil
 	}
-	return lu.lkp.Verify(vcursor, ids, ksidsToValues(ksids))
+	return lu.lkp.Verify(vcursor, ids, ksidsToValues(ksids), vtgatepb.CommitOrder_NORMAL)
 }
 
 // Create reserves the id by inserting it into the vindex table.
@@ -22,6 +22,7 @@ import (
 
 	"vitess.io/vitess/go/sqltypes"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 var (
@@ -96,7 +97,7 @@ func (lh *LookupHash) Map(vcursor VCursor, ids []sqltypes.Value) ([]Ksids, error
 		return out, nil
 	}
 
-	results, err := lh.lkp.Lookup(vcursor, ids)
+	results, err := lh.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_NORMAL)
 	if err != nil {
 		return nil, err
 	}
@@ -134,7 +135,7 @@ func (lh *LookupHash) Verify(vcursor VCursor, ids []sqltypes.Value, ksids [][]by
 	if err != nil {
 		return nil, fmt.Errorf("lookup.Verify.vunhash: %v", err)
 	}
-	return lh.lkp.Verify(vcursor, ids, values)
+	return lh.lkp.Verify(vcursor, ids, values, vtgatepb.CommitOrder_NORMAL)
 }
 
 // Create reserves the id by inserting it into the vindex table.
@@ -242,7 +243,7 @@ func (lhu *LookupHashUnique) Map(vcursor VCursor, ids []sqltypes.Value) ([]KsidO
 		return out, nil
 	}
 
-	results, err := lhu.lkp.Lookup(vcursor, ids)
+	results, err := lhu.lkp.Lookup(vcursor, ids, vtgatepb.CommitOrder_NORMAL)
 	if err != nil {
 		return nil, err
 	}
@@ -278,7 +279,7 @@ func (lhu *LookupHashUnique) Verify(vcursor VCursor, ids []sqltypes.Value, ksids
 	if err != nil {
 		return nil, fmt.Errorf("lookup.Verify.vunhash: %v", err)
 	}
-	return lhu.lkp.Verify(vcursor, ids, values)
+	return lhu.lkp.Verify(vcursor, ids, values, vtgatepb.CommitOrder_NORMAL)
 }
 
 // Create reserves the id by inserting it into the vindex table.
@@ -23,8 +23,10 @@ import (
 	"strings"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vterrors"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 // lookupInternal implements the functions for the Lookup vindexes.
@@ -58,8 +60,9 @@ func (lkp *lookupInternal) Init(lookupQueryParams map[string]string, autocommit,
 	return nil
 }
 
-// Lookup performs a lookup for the ids.
-func (lkp *lookupInternal) Lookup(vcursor VCursor, ids []sqltypes.Value) ([]*sqltypes.Result, error) {
+// Lookup performs a lookup for the ids. The lookup is executed
+// in the transaction of co, unless the vindex is autocommit.
+func (lkp *lookupInternal) Lookup(vcursor VCursor, ids []sqltypes.Value, co vtgatepb.CommitOrder) ([]*sqltypes.Result, error) {
 	results := make([]*sqltypes.Result, 0, len(ids))
 	for _, id := range ids {
 		bindVars := map[string]*querypb.BindVariable{
@@ -70,7 +73,7 @@ func (lkp *lookupInternal) Lookup(vcursor VCursor, ids []sqltypes.Value) ([]*sql
 		if lkp.Autocommit {
 			result, err = vcursor.ExecuteAutocommit("VindexLookup", lkp.sel, bindVars, false /* isDML */)
 		} else {
-			result, err = vcursor.Execute("VindexLookup", lkp.sel, bindVars, false /* isDML */)
+			result, err = vcursor.Execute("VindexLookup", lkp.sel, bindVars, false /* isDML */, co)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("lookup.Map: %v", err)
@@ -80,8 +83,9 @@ func (lkp *lookupInternal) Lookup(vcursor VCursor, ids []sqltypes.Value) ([]*sql
 	return results, nil
 }
 
-// Verify returns true if ids map to values.
-func (lkp *lookupInternal) Verify(vcursor VCursor, ids, values []sqltypes.Value) ([]bool, error) {
+// Verify returns true if ids map to values. The queries are executed
+// in the transaction of co, unless the vindex is autocommit.
+func (lkp *lookupInternal) Verify(vcursor VCursor, ids, values []sqltypes.Value, co vtgatepb.CommitOrder) ([]bool, error) {
 	out := make([]bool, len(ids))
 	for i, id := range ids {
 		bindVars := map[string]*querypb.BindVariable{
@@ -93,7 +97,7 @@ func (lkp *lookupInternal) Verify(vcursor VCursor, ids, values []sqltypes.Value)
 		if lkp.Autocommit {
 			result, err = vcursor.ExecuteAutocommit("VindexVerify", lkp.ver, bindVars, true /* isDML */)
 		} else {
-			result, err = vcursor.Execute("VindexVerify", lkp.ver, bindVars, true /* isDML */)
+			result, err = vcursor.Execute("VindexVerify", lkp.ver, bindVars, true /* isDML */, co)
 		}
 		if err != nil {
 			return nil, fmt.Errorf("lookup.Verify: %v", err)
@@ -114,6 +118,11 @@ func (lkp *lookupInternal) Verify(vcursor VCursor, ids, values []sqltypes.Value)
 // Create(vcursor, [[value_a0, value_b0,], [value_a1, value_b1]], [binary(value_c0), binary(value_c1)])
 // Notice that toValues contains the computed binary value of the keyspace_id.
 func (lkp *lookupInternal) Create(vcursor VCursor, rowsColValues [][]sqltypes.Value, toValues []sqltypes.Value, ignoreMode bool) error {
+	return lkp.createCustom(vcursor, rowsColValues, toValues, ignoreMode, vtgatepb.CommitOrder_NORMAL)
+}
+
+// createCustom is like Create, but executes the insert in the transaction of co.
+func (lkp *lookupInternal) createCustom(vcursor VCursor, rowsColValues [][]sqltypes.Value, toValues []sqltypes.Value, ignoreMode bool, co vtgatepb.CommitOrder) error {
 	buf := new(bytes.Buffer)
 	if ignoreMode {
 		fmt.Fprintf(buf, "insert ignore into %s(", lkp.Table)
@@ -153,10 +162,10 @@ func (lkp *lookupInternal) Create(vcursor VCursor, rowsColValues [][]sqltypes.Va
 	if lkp.Autocommit {
 		_, err = vcursor.ExecuteAutocommit("VindexCreate", buf.String(), bindVars, true /* isDML */)
 	} else {
-		_, err = vcursor.Execute("VindexCreate", buf.String(), bindVars, true /* isDML */)
+		_, err = vcursor.Execute("VindexCreate", buf.String(), bindVars, true /* isDML */, co)
 	}
 	if err != nil {
-		return fmt.Errorf("lookup.Create: %v", err)
+		return vterrors.Wrap(err, "lookup.Create")
 	}
 	return nil
 }
@@ -181,13 +190,18 @@ func (lkp *lookupInternal) Delete(vcursor VCursor, rowsColValues [][]sqltypes.Va
 	if lkp.Autocommit {
 		return nil
 	}
+	return lkp.deleteCustom(vcursor, rowsColValues, value, vtgatepb.CommitOrder_NORMAL)
+}
+
+// deleteCustom is like Delete, but executes the deletes in the transaction of co.
+func (lkp *lookupInternal) deleteCustom(vcursor VCursor, rowsColValues [][]sqltypes.Value, value sqltypes.Value, co vtgatepb.CommitOrder) error {
 	for _, column := range rowsColValues {
 		bindVars := make(map[string]*querypb.BindVariable, len(rowsColValues))
 		for colIdx, columnValue := range column {
 			bindVars[lkp.FromColumns[colIdx]] = sqltypes.ValueBindVariable(columnValue)
 		}
 		bindVars[lkp.To] = sqltypes.ValueBindVariable(value)
-		_, err := vcursor.Execute("VindexDelete", lkp.del, bindVars, true /* isDML */)
+		_, err := vcursor.Execute("VindexDelete", lkp.del, bindVars, true /* isDML */, co)
 		if err != nil {
 			return fmt.Errorf("lookup.Delete: %v", err)
 		}
@@ -0,0 +1,140 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vindexes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	_ MultiColumn = (*RegionExperimental)(nil)
+)
+
+// RegionExperimental is a multi-column vindex for data-residency
+// sharding. Its first column is a region number, which gives the
+// first region_bytes bytes of the keyspace id, and its second column
+// is an id, hashed like the hash vindex for the remaining 8 bytes. So
+// the rows of a region are in their own keyrange, and a region lives
+// in its own shards if the shards are split along region boundaries.
+// A query that only constrains the region goes to the shards of the
+// region.
+type RegionExperimental struct {
+	name        string
+	regionBytes int
+}
+
+// NewRegionExperimental creates a RegionExperimental vindex.
+// The supplied map requires the region_bytes param, which must be
+// 1 or 2.
+func NewRegionExperimental(name string, m map[string]string) (Vindex, error) {
+	rbs, ok := m["region_bytes"]
+	if !ok {
+		return nil, fmt.Errorf("region_experimental missing region_bytes param")
+	}
+	var regionBytes int
+	switch rbs {
+	case "1":
+		regionBytes = 1
+	case "2":
+		regionBytes = 2
+	default:
+		return nil, fmt.Errorf("region_bytes must be 1 or 2: %v", rbs)
+	}
+	return &RegionExperimental{
+		name:        name,
+		regionBytes: regionBytes,
+	}, nil
+}
+
+// String returns the name of the vindex.
+func (rv *RegionExperimental) String() string {
+	return rv.name
+}
+
+// Cost returns the cost of this index as 1.
+func (rv *RegionExperimental) Cost() int {
+	return 1
+}
+
+// Verify is part of the Vindex interface. The vindex needs the values
+// of all its columns, which only VerifyMulti gets.
+func (rv *RegionExperimental) Verify(_ VCursor, ids []sqltypes.Value, ksids [][]byte) ([]bool, error) {
+	return nil, fmt.Errorf("region_experimental.Verify: %s needs the values of all its columns", rv.name)
+}
+
+// MapMulti returns the keyspace ids of the rows, or the keyrange of
+// the region for the rows that only have the region.
+func (rv *RegionExperimental) MapMulti(_ VCursor, rowsColValues [][]sqltypes.Value) ([]KsidOrRange, error) {
+	out := make([]KsidOrRange, 0, len(rowsColValues))
+	for _, row := range rowsColValues {
+		out = append(out, rv.mapRow(row))
+	}
+	return out, nil
+}
+
+// VerifyMulti returns true if the rows map to ksids.
+func (rv *RegionExperimental) VerifyMulti(_ VCursor, rowsColValues [][]sqltypes.Value, ksids [][]byte) ([]bool, error) {
+	out := make([]bool, len(rowsColValues))
+	for i, row := range rowsColValues {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("region_experimental.VerifyMulti: got %d values, want 2", len(row))
+		}
+		ksid := rv.mapRow(row)
+		out[i] = ksid.ID != nil && bytes.Equal(ksid.ID, ksids[i])
+	}
+	return out, nil
+}
+
+// mapRow maps the values of a row. It returns an empty KsidOrRange
+// if they cannot be mapped.
+func (rv *RegionExperimental) mapRow(row []sqltypes.Value) KsidOrRange {
+	if len(row) == 0 {
+		return KsidOrRange{Range: &topodatapb.KeyRange{}}
+	}
+	region, err := sqltypes.ToUint64(row[0])
+	if err != nil || region >= 1<<(8*uint(rv.regionBytes)) {
+		return KsidOrRange{}
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], region)
+	prefix := buf[8-rv.regionBytes:]
+	if len(row) == 1 {
+		kr := &topodatapb.KeyRange{Start: append([]byte(nil), prefix...)}
+		if region+1 < 1<<(8*uint(rv.regionBytes)) {
+			binary.BigEndian.PutUint64(buf[:], region+1)
+			kr.End = append([]byte(nil), prefix...)
+		}
+		return KsidOrRange{Range: kr}
+	}
+	id, err := sqltypes.ToUint64(row[1])
+	if err != nil {
+		return KsidOrRange{}
+	}
+	ksid := make([]byte, 0, rv.regionBytes+8)
+	ksid = append(ksid, prefix...)
+	return KsidOrRange{ID: append(ksid, vhash(id)...)}
+}
+
+func init() {
+	Register("region_experimental", NewRegionExperimental)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package vindexes
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestRegionExperimentalMapMulti1(t *testing.T) {
+	rv, err := createRegionVindex(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rv.Cost() != 1 {
+		t.Errorf("Cost(): %d, want 1", rv.Cost())
+	}
+	if rv.String() != "region_experimental" {
+		t.Errorf("String(): %s, want region_experimental", rv.String())
+	}
+	got, err := rv.(MultiColumn).MapMulti(nil, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(255), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(256), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(1), sqltypes.NULL,
+	}, {
+		sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(255),
+	}, {
+		sqltypes.NULL,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KsidOrRange{
+		{ID: []byte("\x01\x16k@\xb4J\xbaK\xd6")},
+		{ID: []byte("\xff\x16k@\xb4J\xbaK\xd6")},
+		{},
+		{},
+		{Range: &topodatapb.KeyRange{Start: []byte("\x01"), End: []byte("\x02")}},
+		{Range: &topodatapb.KeyRange{Start: []byte("\xff")}},
+		{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MapMulti():\n%#v, want\n%#v", got, want)
+	}
+}
+
+func TestRegionExperimentalMapMulti2(t *testing.T) {
+	rv, err := createRegionVindex(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rv.(MultiColumn).MapMulti(nil, [][]sqltypes.Value{{
+		sqltypes.NewInt64(1), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(65535), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(65536), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(256),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KsidOrRange{
+		{ID: []byte("\x00\x01\x16k@\xb4J\xbaK\xd6")},
+		{ID: []byte("\xff\xff\x16k@\xb4J\xbaK\xd6")},
+		{},
+		{Range: &topodatapb.KeyRange{Start: []byte("\x01\x00"), End: []byte("\x01\x01")}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MapMulti():\n%#v, want\n%#v", got, want)
+	}
+}
+
+func TestRegionExperimentalVerifyMulti(t *testing.T) {
+	rv, err := createRegionVindex(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vals := [][]sqltypes.Value{{
+		sqltypes.NewInt64(1), sqltypes.NewInt64(1),
+	}, {
+		sqltypes.NewInt64(1), sqltypes.NewInt64(2),
+	}, {
+		sqltypes.NewInt64(256), sqltypes.NewInt64(1),
+	}}
+	ksids := [][]byte{
+		[]byte("\x01\x16k@\xb4J\xbaK\xd6"),
+		[]byte("\x01\x16k@\xb4J\xbaK\xd6"),
+		[]byte("\x01\x16k@\xb4J\xbaK\xd6"),
+	}
+	got, err := rv.(MultiColumn).VerifyMulti(nil, vals, ksids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{true, false, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifyMulti(): %v, want %v", got, want)
+	}
+
+	_, err = rv.(MultiColumn).VerifyMulti(nil, [][]sqltypes.Value{{sqltypes.NewInt64(1)}}, ksids[:1])
+	if want := "region_experimental.VerifyMulti: got 1 values, want 2"; err == nil || err.Error() != want {
+		t.Errorf("VerifyMulti(prefix): %v, want %s", err, want)
+	}
+	_, err = rv.Verify(nil, []sqltypes.Value{sqltypes.NewInt64(1)}, ksids[:1])
+	if want := "region_experimental.Verify: region_experimental needs the values of all its columns"; err == nil || err.Error() != want {
+		t.Errorf("Verify(): %v, want %s", err, want)
+	}
+}
+
+func TestRegionExperimentalCreateErrors(t *testing.T) {
+	_, err := createRegionVindex(3)
+	if want := "region_bytes must be 1 or 2: 3"; err == nil || err.Error() != want {
+		t.Errorf("createRegionVindex(3): %v, want %s", err, want)
+	}
+	_, err = CreateVindex("region_experimental", "region_experimental", nil)
+	if want := "region_experimental missing region_bytes param"; err == nil || err.Error() != want {
+		t.Errorf("CreateVindex(no params): %v, want %s", err, want)
+	}
+}
+
+func createRegionVindex(regionBytes int) (Vindex, error) {
+	return CreateVindex("region_experimental", "region_experimental", map[string]string{
+		"region_bytes": strconv.Itoa(regionBytes),
+	})
+}
@@ -21,9 +21,11 @@ import (
 	"fmt"
 
 	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vtgatepb "vitess.io/vitess/go/vt/proto/vtgate"
 )
 
 // This file defines interfaces and registration for vindexes.
@@ -32,8 +34,14 @@ import (
 // in the current context and session of a VTGate request. Vindexes
 // can use this interface to execute lookup queries.
 type VCursor interface {
-	Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
+	// Execute executes the query in the session. co tells which of the
+	// transactions of the session runs the query, and so when it's
+	// committed: see CommitOrder in vtgate.proto.
+	Execute(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool, co vtgatepb.CommitOrder) (*sqltypes.Result, error)
 	ExecuteAutocommit(method string, query string, bindvars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
+	// ExecuteKeyspaceID executes the query on the shard of ksid in
+	// keyspace, in the main transaction of the session.
+	ExecuteKeyspaceID(keyspace string, ksid []byte, query string, bindVars map[string]*querypb.BindVariable, isDML bool) (*sqltypes.Result, error)
 }
 
 // Vindex defines the interface required to register a vindex.
@@ -99,6 +107,25 @@ func IsUnique(v Vindex) bool {
 	return ok
 }
 
+// A MultiColumn vindex maps the values of several columns to a
+// keyspace id. The values of each row are in the order of the columns
+// of the vindex, like rowsColValues of Lookup. A row can also hold
+// the values of only a prefix of the columns: the vindex then returns
+// the keyrange of the keyspace ids the prefix can map to, so a query
+// that doesn't constrain all the columns scatters only over a subset
+// of the shards. A MultiColumn vindex is unique when all the columns
+// are given, and can be used as a primary vindex.
+type MultiColumn interface {
+	MapMulti(cursor VCursor, rowsColValues [][]sqltypes.Value) ([]KsidOrRange, error)
+	VerifyMulti(cursor VCursor, rowsColValues [][]sqltypes.Value, ksids [][]byte) ([]bool, error)
+}
+
+// IsMultiColumn returns true if the Vindex is MultiColumn.
+func IsMultiColumn(v Vindex) bool {
+	_, ok := v.(MultiColumn)
+	return ok
+}
+
 // A Reversible vindex is one that can perform a
 // reverse lookup from a keyspace id to an id. This
 // is optional. If present, VTGate can use it to
@@ -135,6 +162,13 @@ type Lookup interface {
 	Update(vc VCursor, oldValues []sqltypes.Value, ksid []byte, newValues []sqltypes.Value) error
 }
 
+// WantOwnerInfo defines the interface that a vindex must
+// satisfy to request info about the owner table. This information can
+// be used to query the owner's table for the owning row's presence.
+type WantOwnerInfo interface {
+	SetOwnerInfo(keyspace, table string, cols []sqlparser.ColIdent) error
+}
+
 // A NewVindexFunc is a function that creates a Vindex based on the
 // properties specified in the input map. Every vindex must
 // register a NewVindexFunc under a unique vindexType.
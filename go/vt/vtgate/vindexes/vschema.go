@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"sort"
 	"strings"
+	"time"
 
 	"vitess.io/vitess/go/json2"
 	"vitess.io/vitess/go/vt/sqlparser"
@@ -49,6 +50,8 @@ type Table struct {
 	AutoIncrement  *AutoIncrement       `json:"auto_increment,omitempty"`
 	Columns        []Column             `json:"columns,omitempty"`
 	Pinned         []byte               `json:"pinned,omitempty"`
+	RowCount       int64                `json:"row_count,omitempty"`
+	ResultCacheTTL time.Duration        `json:"result_cache_ttl,omitempty"`
 }
 
 // Keyspace contains the keyspcae info for each Table.
@@ -185,8 +188,9 @@ func buildTables(source *vschemapb.SrvVSchema, vschema *VSchema) error {
 			switch vindex.(type) {
 			case Unique:
 			case NonUnique:
+			case MultiColumn:
 			default:
-				return fmt.Errorf("vindex %q needs to be Unique or NonUnique", vname)
+				return fmt.Errorf("vindex %q needs to be Unique, NonUnique or MultiColumn", vname)
 			}
 			if _, ok := vschema.uniqueVindexes[vname]; ok {
 				vschema.uniqueVindexes[vname] = nil
@@ -197,8 +201,10 @@ func buildTables(source *vschemapb.SrvVSchema, vschema *VSchema) error {
 		}
 		for tname, table := range ks.Tables {
 			t := &Table{
-				Name:     sqlparser.NewTableIdent(tname),
-				Keyspace: keyspace,
+				Name:           sqlparser.NewTableIdent(tname),
+				Keyspace:       keyspace,
+				RowCount:       table.RowCount,
+				ResultCacheTTL: time.Duration(table.ResultCacheTtlSeconds) * time.Second,
 			}
 			if _, ok := vschema.uniqueTables[tname]; ok {
 				vschema.uniqueTables[tname] = nil
@@ -256,9 +262,12 @@ func buildTables(source *vschemapb.SrvVSchema, vschema *VSchema) error {
 					Owned:   owned,
 					Vindex:  vindex,
 				}
+				if _, ok := columnVindex.Vindex.(MultiColumn); ok && len(columns) < 2 {
+					return fmt.Errorf("multi-column vindex %s needs more than one column for table %s", ind.Name, tname)
+				}
 				if i == 0 {
 					// Perform Primary vindex check.
-					if _, ok := columnVindex.Vindex.(Unique); !ok {
+					if !IsUnique(columnVindex.Vindex) && !IsMultiColumn(columnVindex.Vindex) {
 						return fmt.Errorf("primary vindex %s is not Unique for table %s", ind.Name, tname)
 					}
 					if owned {
@@ -267,15 +276,42 @@ func buildTables(source *vschemapb.SrvVSchema, vschema *VSchema) error {
 				}
 				t.ColumnVindexes = append(t.ColumnVindexes, columnVindex)
 				if owned {
+					if cv, ok := vindex.(WantOwnerInfo); ok {
+						if err := cv.SetOwnerInfo(ksname, tname, columns); err != nil {
+							return err
+						}
+					}
 					t.Owned = append(t.Owned, columnVindex)
 				}
 			}
 			t.Ordered = colVindexSorted(t.ColumnVindexes)
+			if table.ResultCacheTtlSeconds < 0 {
+				return fmt.Errorf("result_cache_ttl_seconds cannot be negative for table %s", tname)
+			}
+			if table.ResultCacheTtlSeconds > 0 && !CanCacheResults(t) {
+				return fmt.Errorf("result_cache_ttl_seconds requires a primary vindex that computes the keyspace id without a lookup for table %s", tname)
+			}
 		}
 	}
 	return nil
 }
 
+// CanCacheResults returns true if the results of the queries on a
+// table can be cached by its primary vindex. The primary vindex must
+// compute the keyspace id without a lookup, so the entries can be
+// invalidated by keyspace id from the primary key of the changed rows.
+func CanCacheResults(t *Table) bool {
+	if len(t.ColumnVindexes) == 0 {
+		return false
+	}
+	primary := t.ColumnVindexes[0]
+	if len(primary.Columns) != 1 || !IsUnique(primary.Vindex) {
+		return false
+	}
+	_, isLookup := primary.Vindex.(Lookup)
+	return !isLookup
+}
+
 func resolveAutoIncrement(source *vschemapb.SrvVSchema, vschema *VSchema) error {
 	for ksname, ks := range source.Keyspaces {
 		ksvschema := vschema.Keyspaces[ksname]
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 
@@ -171,6 +172,7 @@ func TestVSchemaColumns(t *testing.T) {
 							Name: "c2",
 							Type: sqltypes.VarChar,
 						}},
+						RowCount: 1000,
 					},
 				},
 			},
@@ -193,6 +195,7 @@ func TestVSchemaColumns(t *testing.T) {
 			Name: sqlparser.NewColIdent("c2"),
 			Type: sqltypes.VarChar,
 		}},
+		RowCount: 1000,
 	}
 	dual := &Table{
 		Name:     sqlparser.NewTableIdent("dual"),
@@ -530,7 +533,7 @@ func TestBuildVSchemaInvalidVindexFail(t *testing.T) {
 		},
 	}
 	_, err := BuildVSchema(&bad)
-	want := `vindex "stf" needs to be Unique or NonUnique`
+	want := `vindex "stf" needs to be Unique, NonUnique or MultiColumn`
 	if err == nil || err.Error() != want {
 		t.Errorf("BuildVSchema: %v, want %v", err, want)
 	}
@@ -878,6 +881,100 @@ func TestBuildVSchemaNotUniqueFail(t *testing.T) {
 	}
 }
 
+func TestBuildVSchemaMultiColumnPrimary(t *testing.T) {
+	input := vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"region": {
+						Type:   "region_experimental",
+						Params: map[string]string{"region_bytes": "1"},
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{
+							{
+								Columns: []string{"region", "user_id"},
+								Name:    "region",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	got, err := BuildVSchema(&input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cv := got.Keyspaces["sharded"].Tables["t1"].ColumnVindexes[0]
+	if !IsMultiColumn(cv.Vindex) {
+		t.Errorf("primary vindex %v is not MultiColumn", cv.Vindex)
+	}
+	if want := []sqlparser.ColIdent{sqlparser.NewColIdent("region"), sqlparser.NewColIdent("user_id")}; !reflect.DeepEqual(cv.Columns, want) {
+		t.Errorf("primary vindex columns: %v, want %v", cv.Columns, want)
+	}
+
+	input.Keyspaces["sharded"].Tables["t1"].ColumnVindexes[0] = &vschemapb.ColumnVindex{
+		Column: "region",
+		Name:   "region",
+	}
+	_, err = BuildVSchema(&input)
+	want := "multi-column vindex region needs more than one column for table t1"
+	if err == nil || err.Error() != want {
+		t.Errorf("BuildVSchema: %v, want %v", err, want)
+	}
+}
+
+func TestBuildVSchemaConsistentLookupOwner(t *testing.T) {
+	input := vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"hash": {
+						Type: "hash",
+					},
+					"name_lookup": {
+						Type: "consistent_lookup",
+						Params: map[string]string{
+							"table": "name_lookup",
+							"from":  "name",
+							"to":    "keyspace_id",
+						},
+						Owner: "t1",
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{{
+							Column: "id",
+							Name:   "hash",
+						}, {
+							Column: "name",
+							Name:   "name_lookup",
+						}},
+					},
+				},
+			},
+		},
+	}
+	got, err := BuildVSchema(&input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := got.Keyspaces["sharded"].Vindexes["name_lookup"].(*ConsistentLookup)
+	want := "select name from t1 where name = :name for update"
+	if cl.lockOwnerQuery != want {
+		t.Errorf("lockOwnerQuery: %s, want %s", cl.lockOwnerQuery, want)
+	}
+	if cl.keyspace != "sharded" {
+		t.Errorf("keyspace: %s, want sharded", cl.keyspace)
+	}
+}
+
 func TestBuildVSchemaPrimaryNonFunctionalFail(t *testing.T) {
 	bad := vschemapb.SrvVSchema{
 		Keyspaces: map[string]*vschemapb.Keyspace{
@@ -909,6 +1006,68 @@ func TestBuildVSchemaPrimaryNonFunctionalFail(t *testing.T) {
 	}
 }
 
+func TestBuildVSchemaResultCache(t *testing.T) {
+	good := vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"stfu": {
+						Type: "stfu",
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{
+							{
+								Column: "c1",
+								Name:   "stfu",
+							},
+						},
+						ResultCacheTtlSeconds: 60,
+					},
+				},
+			},
+		},
+	}
+	vschema, err := BuildVSchema(&good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := vschema.Keyspaces["sharded"].Tables["t1"].ResultCacheTTL, time.Minute; got != want {
+		t.Errorf("ResultCacheTTL: %v, want %v", got, want)
+	}
+
+	bad := vschemapb.SrvVSchema{
+		Keyspaces: map[string]*vschemapb.Keyspace{
+			"sharded": {
+				Sharded: true,
+				Vindexes: map[string]*vschemapb.Vindex{
+					"stlu": {
+						Type: "stlu",
+					},
+				},
+				Tables: map[string]*vschemapb.Table{
+					"t1": {
+						ColumnVindexes: []*vschemapb.ColumnVindex{
+							{
+								Column: "c1",
+								Name:   "stlu",
+							},
+						},
+						ResultCacheTtlSeconds: 60,
+					},
+				},
+			},
+		},
+	}
+	_, err = BuildVSchema(&bad)
+	want := "result_cache_ttl_seconds requires a primary vindex that computes the keyspace id without a lookup for table t1"
+	if err == nil || err.Error() != want {
+		t.Errorf("BuildVSchema: %v, want %v", err, want)
+	}
+}
+
 func TestSequence(t *testing.T) {
 	good := vschemapb.SrvVSchema{
 		Keyspaces: map[string]*vschemapb.Keyspace{
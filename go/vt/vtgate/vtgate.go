@@ -44,7 +44,9 @@ import (
 	"vitess.io/vitess/go/vt/topo/topoproto"
 	"vitess.io/vitess/go/vt/vterrors"
 
+	"vitess.io/vitess/go/vt/vtgate/engine"
 	"vitess.io/vitess/go/vt/vtgate/gateway"
+	"vitess.io/vitess/go/vt/vtgate/resultcache"
 	"vitess.io/vitess/go/vt/vtgate/vtgateservice"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
@@ -62,6 +64,22 @@ var (
 	enableForwarding    = flag.Bool("enable_forwarding", false, "if specified, this process will also expose a QueryService interface that allows other vtgates to talk through this vtgate to the underlying tablets.")
 	l2vtgateAddrs       flagutil.StringListValue
 	disableLocalGateway = flag.Bool("disable_local_gateway", false, "if specified, this process will not route any queries to local tablets in the local cell")
+	hashJoinMemoryLimit = flag.Int64("hash_join_memory_limit", 64*1024*1024, "the maximum number of bytes that the rows of the right side of a hash join or a semi-join can use. Queries that exceed it fail.")
+	semiJoinBatchSize   = flag.Int("semi_join_batch_size", 1000, "the maximum number of values that a semi-join sends to the right side of the join in a single query.")
+	insertSelectBatch   = flag.Int("insert_select_batch_size", 500, "the maximum number of rows that an INSERT...SELECT into a sharded table inserts at once. If autocommit is on, each batch is committed separately.")
+
+	enableQueryConsolidation    = flag.Bool("enable_query_consolidation", false, "if specified, identical reads executed at the same time outside of transactions share a single execution and its result.")
+	queryConsolidationKeyspaces flagutil.StringListValue
+	queryConsolidationMax       = flag.Int("query_consolidation_max_queries", 1000, "the maximum number of distinct queries that -enable_query_consolidation shares at once. Other queries are executed separately.")
+	queryConsolidationWaiters   = flag.Int("query_consolidation_max_waiters", 0, "the maximum number of requests that wait for the same query with -enable_query_consolidation. Other requests execute it separately. 0 means no limit.")
+	queryConsolidationMaxRows   = flag.Int("query_consolidation_max_result_rows", 10000, "the maximum number of rows of a result shared by -enable_query_consolidation. The requests waiting for a query with more rows execute it separately. 0 means no limit.")
+
+	resultCacheService    = flag.String("result_cache_service", "", "if set, caches the results of the reads by primary vindex of the tables that have result_cache_ttl_seconds in the vschema. 'memory' keeps them in this vtgate. Other values are the name of a registered cache service, e.g. 'memcache', which can be shared by several vtgates.")
+	resultCacheAddress    = flag.String("result_cache_address", "", "the address of the cache service of -result_cache_service, e.g. host:port or the path of a unix socket for memcache.")
+	resultCacheTimeout    = flag.Duration("result_cache_timeout", time.Second, "the timeout of the connections to the cache service of -result_cache_service.")
+	resultCachePoolSize   = flag.Int("result_cache_pool_size", 20, "the number of connections to the cache service of -result_cache_service.")
+	resultCacheMemorySize = flag.Int64("result_cache_memory_size", 64*1024*1024, "the maximum number of bytes of results that -result_cache_service=memory keeps.")
+	resultCacheTabletType = topodatapb.TabletType_MASTER
 )
 
 func getTxMode() vtgatepb.TransactionMode {
@@ -127,6 +145,7 @@ type VTGate struct {
 
 	// the throttled loggers for all errors, one per API entry
 	logExecute                  *logutil.ThrottledLogger
+	logPrepare                  *logutil.ThrottledLogger
 	logStreamExecute            *logutil.ThrottledLogger
 	logExecuteShards            *logutil.ThrottledLogger
 	logExecuteKeyspaceIds       *logutil.ThrottledLogger
@@ -191,14 +210,36 @@ func Init(ctx context.Context, hc discovery.HealthCheck, topoServer *topo.Server
 		log.Fatalf("'-disable_local_gateway' cannot be specified if 'l2vtgate_addrs' is also empty, otherwise this vtgate has no backend")
 	}
 
+	engine.HashJoinMemoryLimit = *hashJoinMemoryLimit
+	engine.SemiJoinBatchSize = *semiJoinBatchSize
+	engine.InsertSelectBatchSize = *insertSelectBatch
+
 	tc := NewTxConn(gw, getTxMode())
 	// ScatterConn depends on TxConn to perform forced rollbacks.
 	sc := NewScatterConn("VttabletCall", tc, gw, hc)
 	srvResolver := srvtopo.NewResolver(serv, gw, cell)
 	resolver := NewResolver(srvResolver, serv, cell, sc)
 
+	executor := NewExecutor(ctx, serv, cell, "VTGateExecutor", resolver, *normalizeQueries, *streamBufferSize, *queryPlanCacheSize, *legacyAutocommit)
+	if *enableQueryConsolidation {
+		executor.consolidator = newQueryConsolidator(queryConsolidationKeyspaces, *queryConsolidationMax, *queryConsolidationWaiters, *queryConsolidationMaxRows)
+	}
+	if *resultCacheService != "" {
+		var cache *resultcache.Cache
+		if *resultCacheService == "memory" {
+			cache = resultcache.NewMemory(*resultCacheMemorySize)
+		} else {
+			var err error
+			cache, err = resultcache.New(*resultCacheService, *resultCacheAddress, *resultCacheTimeout, *resultCachePoolSize)
+			if err != nil {
+				log.Fatalf("invalid -result_cache_service: %v", err)
+			}
+		}
+		executor.resultCache = newResultCache(cache, resolver, resultCacheTabletType, executor.VSchema)
+	}
+
 	rpcVTGate = &VTGate{
-		executor:     NewExecutor(ctx, serv, cell, "VTGateExecutor", resolver, *normalizeQueries, *streamBufferSize, *queryPlanCacheSize, *legacyAutocommit),
+		executor:     executor,
 		resolver:     resolver,
 		txConn:       tc,
 		gw:           gw,
@@ -207,6 +248,7 @@ func Init(ctx context.Context, hc discovery.HealthCheck, topoServer *topo.Server
 		rowsReturned: stats.NewMultiCounters("VtgateApiRowsReturned", []string{"Operation", "Keyspace", "DbType"}),
 
 		logExecute:                  logutil.NewThrottledLogger("Execute", 5*time.Second),
+		logPrepare:                  logutil.NewThrottledLogger("Prepare", 5*time.Second),
 		logStreamExecute:            logutil.NewThrottledLogger("StreamExecute", 5*time.Second),
 		logExecuteShards:            logutil.NewThrottledLogger("ExecuteShards", 5*time.Second),
 		logExecuteKeyspaceIds:       logutil.NewThrottledLogger("ExecuteKeyspaceIds", 5*time.Second),
@@ -306,6 +348,33 @@ handleError:
 	return session, nil, err
 }
 
+// Prepare returns the fields of the result set a query would
+// return, without executing it. This is a V3 function.
+func (vtg *VTGate) Prepare(ctx context.Context, session *vtgatepb.Session, sql string, bindVariables map[string]*querypb.BindVariable) (newSession *vtgatepb.Session, fields []*querypb.Field, err error) {
+	target := vtg.executor.ParseTarget(session.TargetString)
+	statsKey := []string{"Prepare", target.Keyspace, topoproto.TabletTypeLString(target.TabletType)}
+	defer vtg.timings.Record(statsKey, time.Now())
+
+	if bvErr := sqltypes.ValidateBindVariables(bindVariables); bvErr != nil {
+		err = vterrors.Errorf(vtrpcpb.Code_INVALID_ARGUMENT, "%v", bvErr)
+		goto handleError
+	}
+
+	fields, err = vtg.executor.Prepare(ctx, "Prepare", NewSafeSession(session), sql, bindVariables)
+	if err == nil {
+		return session, fields, nil
+	}
+
+handleError:
+	query := map[string]interface{}{
+		"Sql":           sql,
+		"BindVariables": bindVariables,
+		"Session":       session,
+	}
+	err = recordAndAnnotateError(err, statsKey, query, vtg.logPrepare)
+	return session, nil, err
+}
+
 // ExecuteBatch executes a batch of queries. This is a V3 function.
 func (vtg *VTGate) ExecuteBatch(ctx context.Context, session *vtgatepb.Session, sqlList []string, bindVariablesList []map[string]*querypb.BindVariable) (*vtgatepb.Session, []sqltypes.QueryResponse, error) {
 	target := vtg.executor.ParseTarget(session.TargetString)
@@ -1151,4 +1220,6 @@ func unambiguousKeyspaceBSQ(queries []*vtgatepb.BoundShardQuery) string {
 
 func init() {
 	flag.Var(&l2vtgateAddrs, "l2vtgate_addrs", "Specifies a comma-separated list of other l2 vtgate pools to connect to. These other vtgates must run with the --enable_forwarding flag")
+	flag.Var(&queryConsolidationKeyspaces, "query_consolidation_keyspaces", "comma-separated list of the keyspaces -enable_query_consolidation applies to, as targeted by the session. If empty, it applies to all keyspaces.")
+	topoproto.TabletTypeVar(&resultCacheTabletType, "result_cache_update_stream_tablet_type", topodatapb.TabletType_MASTER, "the tablet type whose update streams invalidate the entries of -result_cache_service. Only the reads of this tablet type use the cache.")
 }
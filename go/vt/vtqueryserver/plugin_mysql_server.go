@@ -76,6 +76,23 @@ func (mh *proxyHandler) ConnectionClosed(c *mysql.Conn) {
 }
 
 func (mh *proxyHandler) ComQuery(c *mysql.Conn, query string, callback func(*sqltypes.Result) error) error {
+	return mh.execute(c, query, make(map[string]*querypb.BindVariable), callback)
+}
+
+// ComPrepare is part of the mysql.Handler interface. The proxy has
+// no query plan to compute fields from, so they are only returned
+// when the statement is executed.
+func (mh *proxyHandler) ComPrepare(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable) ([]*querypb.Field, error) {
+	return nil, nil
+}
+
+// ComStmtExecute is part of the mysql.Handler interface.
+func (mh *proxyHandler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareData, callback func(*sqltypes.Result) error) error {
+	return mh.execute(c, prepare.PrepareStmt, sqltypes.CopyBindVariables(prepare.BindVars), callback)
+}
+
+// execute runs a query for ComQuery or ComStmtExecute.
+func (mh *proxyHandler) execute(c *mysql.Conn, query string, bindVars map[string]*querypb.BindVariable, callback func(*sqltypes.Result) error) error {
 	// FIXME(alainjobart): Add some kind of timeout to the context.
 	ctx := context.Background()
 
@@ -106,7 +123,7 @@ func (mh *proxyHandler) ComQuery(c *mysql.Conn, query string, callback func(*sql
 	if c.SchemaName != "" {
 		session.TargetString = c.SchemaName
 	}
-	session, result, err := mh.mp.Execute(ctx, session, query, make(map[string]*querypb.BindVariable))
+	session, result, err := mh.mp.Execute(ctx, session, query, bindVars)
 	c.ClientData = session
 	err = mysql.NewSQLErrorFromError(err)
 	if err != nil {
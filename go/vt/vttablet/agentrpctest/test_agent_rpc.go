@@ -1156,21 +1156,25 @@ func agentRPCTestPromoteSlavePanic(ctx context.Context, t *testing.T, client tmc
 //
 
 var testBackupConcurrency = 24
+var testBackupIncremental = true
 var testBackupCalled = false
 var testRestoreFromBackupCalled = false
+var testRestoreToPos = "MariaDB/1-345-789"
+var testRestoreToTimeNS int64 = 1234567890000000000
 
-func (fra *fakeRPCAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger) error {
+func (fra *fakeRPCAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger, incremental bool) error {
 	if fra.panics {
 		panic(fmt.Errorf("test-triggered panic"))
 	}
 	compare(fra.t, "Backup args", concurrency, testBackupConcurrency)
+	compare(fra.t, "Backup incremental", incremental, testBackupIncremental)
 	logStuff(logger, 10)
 	testBackupCalled = true
 	return nil
 }
 
 func agentRPCTestBackup(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, tablet *topodatapb.Tablet) {
-	stream, err := client.Backup(ctx, tablet, testBackupConcurrency)
+	stream, err := client.Backup(ctx, tablet, testBackupConcurrency, testBackupIncremental)
 	if err != nil {
 		t.Fatalf("Backup failed: %v", err)
 	}
@@ -1179,7 +1183,7 @@ func agentRPCTestBackup(ctx context.Context, t *testing.T, client tmclient.Table
 }
 
 func agentRPCTestBackupPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, tablet *topodatapb.Tablet) {
-	stream, err := client.Backup(ctx, tablet, testBackupConcurrency)
+	stream, err := client.Backup(ctx, tablet, testBackupConcurrency, testBackupIncremental)
 	if err != nil {
 		t.Fatalf("Backup failed: %v", err)
 	}
@@ -1190,17 +1194,19 @@ func agentRPCTestBackupPanic(ctx context.Context, t *testing.T, client tmclient.
 	expectHandleRPCPanic(t, "Backup", true /*verbose*/, err)
 }
 
-func (fra *fakeRPCAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger) error {
+func (fra *fakeRPCAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger, restoreToPos string, restoreToTimeNS int64) error {
 	if fra.panics {
 		panic(fmt.Errorf("test-triggered panic"))
 	}
+	compare(fra.t, "RestoreFromBackup restoreToPos", restoreToPos, testRestoreToPos)
+	compare(fra.t, "RestoreFromBackup restoreToTimeNS", restoreToTimeNS, testRestoreToTimeNS)
 	logStuff(logger, 10)
 	testRestoreFromBackupCalled = true
 	return nil
 }
 
 func agentRPCTestRestoreFromBackup(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, tablet *topodatapb.Tablet) {
-	stream, err := client.RestoreFromBackup(ctx, tablet)
+	stream, err := client.RestoreFromBackup(ctx, tablet, testRestoreToPos, testRestoreToTimeNS)
 	if err != nil {
 		t.Fatalf("RestoreFromBackup failed: %v", err)
 	}
@@ -1209,7 +1215,7 @@ func agentRPCTestRestoreFromBackup(ctx context.Context, t *testing.T, client tmc
 }
 
 func agentRPCTestRestoreFromBackupPanic(ctx context.Context, t *testing.T, client tmclient.TabletManagerClient, tablet *topodatapb.Tablet) {
-	stream, err := client.RestoreFromBackup(ctx, tablet)
+	stream, err := client.RestoreFromBackup(ctx, tablet, testRestoreToPos, testRestoreToTimeNS)
 	if err != nil {
 		t.Fatalf("RestoreFromBackup failed: %v", err)
 	}
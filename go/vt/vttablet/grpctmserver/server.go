@@ -439,7 +439,7 @@ func (s *server) Backup(request *tabletmanagerdatapb.BackupRequest, stream table
 		})
 	})
 
-	return s.agent.Backup(ctx, int(request.Concurrency), logger)
+	return s.agent.Backup(ctx, int(request.Concurrency), logger, request.Incremental)
 }
 
 func (s *server) RestoreFromBackup(request *tabletmanagerdatapb.RestoreFromBackupRequest, stream tabletmanagerservicepb.TabletManager_RestoreFromBackupServer) (err error) {
@@ -457,7 +457,7 @@ func (s *server) RestoreFromBackup(request *tabletmanagerdatapb.RestoreFromBacku
 		})
 	})
 
-	return s.agent.RestoreFromBackup(ctx, logger)
+	return s.agent.RestoreFromBackup(ctx, logger, request.RestoreToPos, request.RestoreToTimeNs)
 }
 
 // registration glue
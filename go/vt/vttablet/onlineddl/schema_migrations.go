@@ -0,0 +1,317 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package onlineddl has the _vt.schema_migrations table, which tracks
+// the online schema changes of a shard. ApplySchema with
+// -ddl_strategy=online queues an ALTER TABLE as a migration in the
+// table of each master, instead of running it, and each master runs
+// its migrations one at a time: it copies the table to a shadow table
+// that has the new schema, with a _vt.vreplication stream, and swaps
+// the tables once the stream caught up.
+package onlineddl
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	gouuid "github.com/pborman/uuid"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+// The strategies of ApplySchema.
+const (
+	// StrategyDirect runs the statements on the masters.
+	StrategyDirect = "direct"
+	// StrategyOnline queues the ALTER TABLE statements as
+	// migrations.
+	StrategyOnline = "online"
+)
+
+// The states of a migration.
+const (
+	// StateQueued is a migration that didn't start yet.
+	StateQueued = "queued"
+	// StateRunning is a migration that copies its table.
+	StateRunning = "running"
+	// StateComplete is a migration that swapped its tables.
+	StateComplete = "complete"
+	// StateFailed is a migration that stopped on an error. It
+	// can be retried.
+	StateFailed = "failed"
+	// StateCancelled is a migration that was cancelled. It can
+	// be retried.
+	StateCancelled = "cancelled"
+)
+
+// Migration is a row of the _vt.schema_migrations table.
+type Migration struct {
+	ID        uint64
+	UUID      string
+	Keyspace  string
+	Shard     string
+	Table     string
+	SQL       string
+	State     string
+	Message   string
+	VReplID   uint32
+	Retries   int64
+	Created   int64
+	Started   int64
+	Completed int64
+}
+
+// alterTableRegexp matches the start of an ALTER TABLE statement, up
+// to its table name.
+var alterTableRegexp = regexp.MustCompile("(?is)^(\\s*alter\\s+(?:ignore\\s+)?table\\s+)(`[^`]+`|[a-z0-9_$]+)")
+
+// quotedRegexp matches the string literals of a statement, which
+// renameRegexp and changeColumnRegexp must not look into.
+var quotedRegexp = regexp.MustCompile(`(?s)'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+
+// renameRegexp matches the RENAME clauses of an ALTER TABLE, along
+// with the word that follows them.
+var renameRegexp = regexp.MustCompile("(?is)\\brename\\s+(`|[a-z0-9_$]+)")
+
+// changeColumnRegexp matches the CHANGE COLUMN clauses of an ALTER
+// TABLE, along with the old and new names of their column.
+var changeColumnRegexp = regexp.MustCompile("(?is)\\bchange\\s+(?:column\\s+)?(`[^`]+`|[a-z0-9_$]+)\\s+(`[^`]+`|[a-z0-9_$]+)")
+
+// CreateUUID returns a new migration UUID. The same migration has the
+// same UUID on all the shards.
+func CreateUUID() string {
+	return gouuid.NewUUID().String()
+}
+
+// ParseAlterTable returns the table of sql, which must be an ALTER
+// TABLE statement that can run online.
+func ParseAlterTable(sql string) (string, error) {
+	stmt, err := sqlparser.Parse(sql)
+	if err != nil {
+		return "", err
+	}
+	ddl, ok := stmt.(*sqlparser.DDL)
+	if !ok || ddl.Action != sqlparser.AlterStr || !alterTableRegexp.MatchString(sql) {
+		return "", fmt.Errorf("only ALTER TABLE statements can run online: %v", sql)
+	}
+	if ddl.PartitionSpec != nil {
+		return "", fmt.Errorf("unsupported: partition changes cannot run online: %v", sql)
+	}
+	if !ddl.Table.Qualifier.IsEmpty() {
+		return "", fmt.Errorf("unsupported: qualified table name in online ALTER TABLE: %v", sql)
+	}
+	if err := checkRenames(sql); err != nil {
+		return "", err
+	}
+	return ddl.Table.Name.String(), nil
+}
+
+// checkRenames returns an error if the ALTER TABLE sql renames its
+// table or one of its columns: a migration copies the columns by
+// name, so the data of a renamed column would be lost. Indexes can
+// be renamed.
+func checkRenames(sql string) error {
+	unquoted := quotedRegexp.ReplaceAllString(sql, "''")
+	for _, match := range renameRegexp.FindAllStringSubmatch(unquoted, -1) {
+		switch strings.ToLower(match[1]) {
+		case "index", "key":
+		default:
+			return fmt.Errorf("unsupported: renames cannot run online: %v", sql)
+		}
+	}
+	for _, match := range changeColumnRegexp.FindAllStringSubmatch(unquoted, -1) {
+		if !strings.EqualFold(strings.Trim(match[1], "`"), strings.Trim(match[2], "`")) {
+			return fmt.Errorf("unsupported: renames cannot run online: %v", sql)
+		}
+	}
+	return nil
+}
+
+// ShadowTableName returns the name of the table a migration copies
+// its table to.
+func ShadowTableName(uuid string) string {
+	return "_vt_osc_" + strings.Replace(uuid, "-", "", -1) + "_new"
+}
+
+// OldTableName returns the name of the original table of a migration,
+// once the tables are swapped. It's kept until it's dropped by hand.
+func OldTableName(uuid string) string {
+	return "_vt_osc_" + strings.Replace(uuid, "-", "", -1) + "_old"
+}
+
+// WorkflowName returns the workflow of the _vt.vreplication stream
+// of a migration.
+func WorkflowName(uuid string) string {
+	return "online_ddl:" + uuid
+}
+
+// ShadowTableAlter returns the ALTER TABLE statement of a migration,
+// applied to its shadow table instead.
+func ShadowTableAlter(m *Migration) (string, error) {
+	loc := alterTableRegexp.FindStringSubmatchIndex(m.SQL)
+	if loc == nil {
+		return "", fmt.Errorf("only ALTER TABLE statements can run online: %v", m.SQL)
+	}
+	if err := checkRenames(m.SQL); err != nil {
+		return "", err
+	}
+	return m.SQL[:loc[4]] + ShadowTableName(m.UUID) + m.SQL[loc[5]:], nil
+}
+
+// CreateSchemaMigrationsTable returns the statements to create the
+// _vt.schema_migrations table.
+func CreateSchemaMigrationsTable() []string {
+	return []string{
+		"CREATE DATABASE IF NOT EXISTS _vt",
+		`CREATE TABLE IF NOT EXISTS _vt.schema_migrations (
+  id BIGINT(20) UNSIGNED NOT NULL AUTO_INCREMENT,
+  migration_uuid VARBINARY(64) NOT NULL,
+  keyspace VARBINARY(256) NOT NULL,
+  shard VARBINARY(256) NOT NULL,
+  table_name VARBINARY(128) NOT NULL,
+  migration_statement TEXT NOT NULL,
+  state VARBINARY(100) NOT NULL,
+  message VARBINARY(1000) DEFAULT NULL,
+  vrepl_id INT UNSIGNED NOT NULL DEFAULT 0,
+  retries INT UNSIGNED NOT NULL DEFAULT 0,
+  time_created BIGINT(20) UNSIGNED NOT NULL,
+  time_started BIGINT(20) UNSIGNED NOT NULL DEFAULT 0,
+  time_completed BIGINT(20) UNSIGNED NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE KEY migration_uuid_idx (migration_uuid)
+) ENGINE=InnoDB`}
+}
+
+// InsertMigration returns a statement to queue a migration.
+func InsertMigration(m *Migration) string {
+	return fmt.Sprintf("INSERT INTO _vt.schema_migrations "+
+		"(migration_uuid, keyspace, shard, table_name, migration_statement, state, time_created) "+
+		"VALUES (%v, %v, %v, %v, %v, %v, %v)",
+		encodeString(m.UUID), encodeString(m.Keyspace), encodeString(m.Shard), encodeString(m.Table),
+		encodeString(m.SQL), encodeString(StateQueued), m.Created)
+}
+
+const selectMigrations = "SELECT id, migration_uuid, keyspace, shard, table_name, migration_statement, state, " +
+	"message, vrepl_id, retries, time_created, time_started, time_completed FROM _vt.schema_migrations"
+
+// QueryMigrations returns a statement to read all the migrations, in
+// the order they were queued.
+func QueryMigrations() string {
+	return selectMigrations + " ORDER BY id"
+}
+
+// QueryMigration returns a statement to read the migration of uuid.
+func QueryMigration(uuid string) string {
+	return fmt.Sprintf("%v WHERE migration_uuid=%v", selectMigrations, encodeString(uuid))
+}
+
+// ParseMigrations returns the migrations of the result of
+// QueryMigrations or QueryMigration.
+func ParseMigrations(qr *sqltypes.Result) ([]*Migration, error) {
+	migrations := make([]*Migration, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if len(row) != 13 {
+			return nil, fmt.Errorf("unexpected row in _vt.schema_migrations: %v", row)
+		}
+		m := &Migration{
+			UUID:     row[1].ToString(),
+			Keyspace: row[2].ToString(),
+			Shard:    row[3].ToString(),
+			Table:    row[4].ToString(),
+			SQL:      row[5].ToString(),
+			State:    row[6].ToString(),
+			Message:  row[7].ToString(),
+		}
+		var err error
+		if m.ID, err = sqltypes.ToUint64(row[0]); err != nil {
+			return nil, err
+		}
+		vreplID, err := sqltypes.ToUint64(row[8])
+		if err != nil {
+			return nil, err
+		}
+		m.VReplID = uint32(vreplID)
+		for i, value := range []*int64{&m.Retries, &m.Created, &m.Started, &m.Completed} {
+			if *value, err = sqltypes.ToInt64(row[9+i]); err != nil {
+				return nil, err
+			}
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// StartMigration returns a statement to mark a migration as running.
+func StartMigration(id uint64, timeStarted int64) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET state=%v, message='', time_started=%v WHERE id=%v",
+		encodeString(StateRunning), timeStarted, id)
+}
+
+// SetMigrationVReplID returns a statement to save the id of the
+// _vt.vreplication stream of a migration.
+func SetMigrationVReplID(id uint64, vreplID uint32) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET vrepl_id=%v WHERE id=%v", vreplID, id)
+}
+
+// SetMigrationMessage returns a statement to save the progress of a
+// running migration, or why it's waiting.
+func SetMigrationMessage(id uint64, message string) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET message=%v WHERE id=%v", encodeString(message), id)
+}
+
+// CompleteMigration returns a statement to mark a migration as
+// complete.
+func CompleteMigration(id uint64, timeCompleted int64) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET state=%v, message='', vrepl_id=0, time_completed=%v WHERE id=%v",
+		encodeString(StateComplete), timeCompleted, id)
+}
+
+// FailMigration returns a statement to mark a migration as failed. It
+// doesn't change a migration that was cancelled in the meantime.
+func FailMigration(id uint64, message string) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET state=%v, message=%v, vrepl_id=0 WHERE id=%v AND state=%v",
+		encodeString(StateFailed), encodeString(message), id, encodeString(StateRunning))
+}
+
+// ClearMigrationVReplID returns a statement to forget the stream of
+// a migration, once it's cleaned up.
+func ClearMigrationVReplID(id uint64) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET vrepl_id=0 WHERE id=%v", id)
+}
+
+// CancelMigration returns a statement to cancel the migration of
+// uuid, if it's queued or running. A running migration stops within
+// online_ddl_check_interval.
+func CancelMigration(uuid string) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET state=%v, message='cancelled by user' WHERE migration_uuid=%v AND state IN (%v, %v)",
+		encodeString(StateCancelled), encodeString(uuid), encodeString(StateQueued), encodeString(StateRunning))
+}
+
+// RetryMigration returns a statement to queue again the migration of
+// uuid, if it failed or was cancelled. It starts from scratch.
+func RetryMigration(uuid string) string {
+	return fmt.Sprintf("UPDATE _vt.schema_migrations SET state=%v, message='', retries=retries+1, time_started=0 WHERE migration_uuid=%v AND state IN (%v, %v)",
+		encodeString(StateQueued), encodeString(uuid), encodeString(StateFailed), encodeString(StateCancelled))
+}
+
+func encodeString(in string) string {
+	buf := bytes.NewBuffer(nil)
+	sqltypes.NewVarChar(in).EncodeSQL(buf)
+	return buf.String()
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package onlineddl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestParseAlterTable(t *testing.T) {
+	testcases := []struct {
+		sql   string
+		table string
+		err   string
+	}{{
+		sql:   "alter table t add column c int",
+		table: "t",
+	}, {
+		sql:   "ALTER IGNORE TABLE `order` ADD UNIQUE KEY (c)",
+		table: "order",
+	}, {
+		sql: "create table t (id int)",
+		err: "only ALTER TABLE statements can run online: create table t (id int)",
+	}, {
+		sql: "alter table t rename to u",
+		err: "only ALTER TABLE statements can run online: alter table t rename to u",
+	}, {
+		sql: "alter view v as select 1",
+		err: "only ALTER TABLE statements can run online: alter view v as select 1",
+	}, {
+		sql: "alter table db.t add column c int",
+		err: "unsupported: qualified table name in online ALTER TABLE: alter table db.t add column c int",
+	}, {
+		sql:   "alter table t change column c c bigint, rename index i to j, modify d int comment 'rename change x y'",
+		table: "t",
+	}, {
+		sql:   "alter table t change `C` c bigint",
+		table: "t",
+	}, {
+		sql: "alter table t change column c d int",
+		err: "unsupported: renames cannot run online: alter table t change column c d int",
+	}, {
+		sql: "alter table t add column e int, change c `d` int",
+		err: "unsupported: renames cannot run online: alter table t add column e int, change c `d` int",
+	}}
+	for _, tc := range testcases {
+		table, err := ParseAlterTable(tc.sql)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("ParseAlterTable(%v): %v, want %v", tc.sql, err, tc.err)
+			}
+			continue
+		}
+		if err != nil || table != tc.table {
+			t.Errorf("ParseAlterTable(%v): %v, %v, want %v", tc.sql, table, err, tc.table)
+		}
+	}
+}
+
+func TestShadowTableAlter(t *testing.T) {
+	uuid := "8d2f8b4c-c8f1-11e8-a8d5-f2801f1b9fd1"
+	if got, want := ShadowTableName(uuid), "_vt_osc_8d2f8b4cc8f111e8a8d5f2801f1b9fd1_new"; got != want {
+		t.Errorf("ShadowTableName: %v, want %v", got, want)
+	}
+	m := &Migration{UUID: uuid, SQL: " ALTER IGNORE TABLE `order` ADD COLUMN `table` int"}
+	got, err := ShadowTableAlter(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := " ALTER IGNORE TABLE _vt_osc_8d2f8b4cc8f111e8a8d5f2801f1b9fd1_new ADD COLUMN `table` int"; got != want {
+		t.Errorf("ShadowTableAlter: %v, want %v", got, want)
+	}
+
+	for _, sql := range []string{
+		"ALTER TABLE `order` CHANGE COLUMN c d int",
+		"ALTER TABLE `order` RENAME COLUMN c TO d",
+	} {
+		m.SQL = sql
+		if _, err := ShadowTableAlter(m); err == nil || err.Error() != "unsupported: renames cannot run online: "+sql {
+			t.Errorf("ShadowTableAlter(%v): %v, want a rename error", sql, err)
+		}
+	}
+}
+
+func TestParseMigrations(t *testing.T) {
+	m := &Migration{
+		UUID:     "uuid",
+		Keyspace: "ks",
+		Shard:    "-80",
+		Table:    "t",
+		SQL:      "alter table t add column c varchar(10) default 'a'",
+		Created:  1234,
+	}
+	want := "INSERT INTO _vt.schema_migrations (migration_uuid, keyspace, shard, table_name, migration_statement, state, time_created) " +
+		"VALUES ('uuid', 'ks', '-80', 't', 'alter table t add column c varchar(10) default \\'a\\'', 'queued', 1234)"
+	if got := InsertMigration(m); got != want {
+		t.Errorf("InsertMigration:\n%v, want\n%v", got, want)
+	}
+	if got := QueryMigration("uuid"); !strings.HasSuffix(got, " FROM _vt.schema_migrations WHERE migration_uuid='uuid'") {
+		t.Errorf("QueryMigration: %v", got)
+	}
+
+	fields := sqltypes.MakeTestFields(
+		"id|migration_uuid|keyspace|shard|table_name|migration_statement|state|message|vrepl_id|retries|time_created|time_started|time_completed",
+		"uint64|varbinary|varbinary|varbinary|varbinary|text|varbinary|varbinary|uint32|uint32|uint64|uint64|uint64")
+	qr := sqltypes.MakeTestResult(fields, "3|uuid|ks|-80|t|alter table t add column c int|running|copying rows|7|1|1234|1240|0")
+	got, err := ParseMigrations(qr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantMigrations := []*Migration{{
+		ID:       3,
+		UUID:     "uuid",
+		Keyspace: "ks",
+		Shard:    "-80",
+		Table:    "t",
+		SQL:      "alter table t add column c int",
+		State:    StateRunning,
+		Message:  "copying rows",
+		VReplID:  7,
+		Retries:  1,
+		Created:  1234,
+		Started:  1240,
+	}}
+	if !reflect.DeepEqual(got, wantMigrations) {
+		t.Errorf("ParseMigrations: %+v, want %+v", got[0], wantMigrations[0])
+	}
+}
+
+func TestCancelRetryMigration(t *testing.T) {
+	want := "UPDATE _vt.schema_migrations SET state='cancelled', message='cancelled by user' WHERE migration_uuid='uuid' AND state IN ('queued', 'running')"
+	if got := CancelMigration("uuid"); got != want {
+		t.Errorf("CancelMigration:\n%v, want\n%v", got, want)
+	}
+	want = "UPDATE _vt.schema_migrations SET state='queued', message='', retries=retries+1, time_started=0 WHERE migration_uuid='uuid' AND state IN ('failed', 'cancelled')"
+	if got := RetryMigration("uuid"); got != want {
+		t.Errorf("RetryMigration:\n%v, want\n%v", got, want)
+	}
+}
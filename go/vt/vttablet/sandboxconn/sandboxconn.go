@@ -38,6 +38,8 @@ type SandboxConn struct {
 
 	// These errors work for all functions.
 	MustFailCodes map[vtrpcpb.Code]int
+	// MustFailWith is returned once by the next function called.
+	MustFailWith error
 
 	// These errors are triggered only for specific functions.
 	// For now these are just for the 2PC functions.
@@ -100,6 +102,10 @@ func NewSandboxConn(t *topodatapb.Tablet) *SandboxConn {
 }
 
 func (sbc *SandboxConn) getError() error {
+	if err := sbc.MustFailWith; err != nil {
+		sbc.MustFailWith = nil
+		return err
+	}
 	for code, count := range sbc.MustFailCodes {
 		if count == 0 {
 			continue
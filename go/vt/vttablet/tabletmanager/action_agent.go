@@ -64,6 +64,7 @@ import (
 	"vitess.io/vitess/go/vt/topotools"
 	"vitess.io/vitess/go/vt/vttablet/tabletserver"
 	"vitess.io/vitess/go/vt/vttablet/tabletservermock"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
 
 	querypb "vitess.io/vitess/go/vt/proto/query"
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
@@ -90,6 +91,10 @@ type ActionAgent struct {
 	MysqlDaemon         mysqlctl.MysqlDaemon
 	DBConfigs           dbconfigs.DBConfigs
 	BinlogPlayerMap     *BinlogPlayerMap
+	VREngine            *VReplicationEngine
+	OnlineDDLEngine     *OnlineDDLEngine
+	BinlogArchiver      *BinlogArchiver
+	BackupScheduler     *BackupScheduler
 
 	// exportStats is set only for production tablet.
 	exportStats bool
@@ -247,6 +252,37 @@ func NewActionAgent(
 	servenv.OnTerm(agent.BinlogPlayerMap.StopAllPlayersAndReset)
 	RegisterBinlogPlayerMap(agent.BinlogPlayerMap)
 
+	// Start the VReplication engine, not running any stream at start.
+	agent.VREngine = NewVReplicationEngine(ts, tmclient.NewTabletManagerClient(), mysqld, func() binlogplayer.VtClient {
+		return binlogplayer.NewDbClient(&agent.DBConfigs.Filtered)
+	})
+	servenv.OnTerm(agent.VREngine.Close)
+	RegisterVReplicationEngine(agent.VREngine)
+
+	// Start the online schema change engine, not running any
+	// migration at start.
+	agent.OnlineDDLEngine = NewOnlineDDLEngine(agent.QueryServiceControl, agent.VREngine, mysqld, func() binlogplayer.VtClient {
+		return binlogplayer.NewDbClient(&agent.DBConfigs.Filtered)
+	})
+	servenv.OnTerm(agent.OnlineDDLEngine.Close)
+
+	// Archive the binlogs of the master, if requested.
+	if *binlogArchiveInterval > 0 {
+		agent.BinlogArchiver = NewBinlogArchiver(mysqld)
+		servenv.OnTerm(agent.BinlogArchiver.Close)
+	}
+
+	// Take backups on a schedule, if requested. The scheduler
+	// checks the tablet type when a backup is due.
+	if *backupSchedule != "" {
+		agent.BackupScheduler, err = NewBackupScheduler(agent, *backupSchedule, *backupScheduleTabletType, *backupScheduleConcurrency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -backup_schedule: %v", err)
+		}
+		agent.BackupScheduler.Open(batchCtx)
+		servenv.OnTerm(agent.BackupScheduler.Close)
+	}
+
 	var mysqlHost string
 	var mysqlPort int32
 	if dbcfgs.App.Host != "" {
@@ -332,6 +368,10 @@ func NewTestActionAgent(batchCtx context.Context, ts *topo.Server, tabletAlias *
 		MysqlDaemon:         mysqlDaemon,
 		DBConfigs:           dbconfigs.DBConfigs{},
 		BinlogPlayerMap:     nil,
+		VREngine:            nil,
+		OnlineDDLEngine:     nil,
+		BinlogArchiver:      nil,
+		BackupScheduler:     nil,
 		History:             history.New(historyLength),
 		_healthy:            fmt.Errorf("healthcheck not run yet"),
 	}
@@ -370,6 +410,10 @@ func NewComboActionAgent(batchCtx context.Context, ts *topo.Server, tabletAlias
 		MysqlDaemon:         mysqlDaemon,
 		DBConfigs:           dbcfgs,
 		BinlogPlayerMap:     nil,
+		VREngine:            nil,
+		OnlineDDLEngine:     nil,
+		BinlogArchiver:      nil,
+		BackupScheduler:     nil,
 		gotMysqlPort:        true,
 		History:             history.New(historyLength),
 		_healthy:            fmt.Errorf("healthcheck not run yet"),
@@ -405,6 +449,7 @@ func NewComboActionAgent(batchCtx context.Context, ts *topo.Server, tabletAlias
 // registerQueryRuleSources registers query rule sources under control of agent
 func (agent *ActionAgent) registerQueryRuleSources() {
 	agent.QueryServiceControl.RegisterQueryRuleSource(blacklistQueryRules)
+	agent.QueryServiceControl.RegisterQueryRuleSource(onlineDDLQueryRules)
 }
 
 func (agent *ActionAgent) setTablet(tablet *topodatapb.Tablet) {
@@ -677,6 +722,18 @@ func (agent *ActionAgent) Stop() {
 	if agent.BinlogPlayerMap != nil {
 		agent.BinlogPlayerMap.StopAllPlayersAndReset()
 	}
+	if agent.OnlineDDLEngine != nil {
+		agent.OnlineDDLEngine.Close()
+	}
+	if agent.BinlogArchiver != nil {
+		agent.BinlogArchiver.Close()
+	}
+	if agent.BackupScheduler != nil {
+		agent.BackupScheduler.Close()
+	}
+	if agent.VREngine != nil {
+		agent.VREngine.Close()
+	}
 	if agent.MysqlDaemon != nil {
 		agent.MysqlDaemon.Close()
 	}
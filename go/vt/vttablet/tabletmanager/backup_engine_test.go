@@ -0,0 +1,174 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/mysqlctl/fakemysqldaemon"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// fakeBackupEngine takes hot backups without files, at pos.
+type fakeBackupEngine struct {
+	ts  *topo.Server
+	pos mysql.Position
+
+	// backupTabletType is the tablet type during the last backup.
+	backupTabletType topodatapb.TabletType
+
+	// restored is the name of the last restored backup.
+	restored string
+}
+
+func (be *fakeBackupEngine) ExecuteBackup(ctx context.Context, mysqld mysqlctl.MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, backupConcurrency int, hookExtraEnv map[string]string) (bool, error) {
+	ti, err := be.ts.GetTablet(ctx, tabletAlias)
+	if err != nil {
+		return false, err
+	}
+	be.backupTabletType = ti.Type
+	wc, err := bh.AddFile(ctx, "MANIFEST")
+	if err != nil {
+		return false, err
+	}
+	if err := json.NewEncoder(wc).Encode(&mysqlctl.BackupManifest{
+		Position:     be.pos,
+		BackupMethod: "fake",
+	}); err != nil {
+		wc.Close()
+		return false, err
+	}
+	return true, wc.Close()
+}
+
+func (be *fakeBackupEngine) ExecuteRestore(ctx context.Context, mysqld mysqlctl.MysqlDaemon, logger logutil.Logger, bh backupstorage.BackupHandle, bm *mysqlctl.BackupManifest, restoreConcurrency int, hookExtraEnv map[string]string) error {
+	be.restored = bh.Name()
+	return nil
+}
+
+func (be *fakeBackupEngine) ShouldDrainForBackup() bool {
+	return false
+}
+
+// newBackupTestAgent returns an agent for a REPLICA tablet,
+// that backs up into the file storage in root. The caller
+// must close the returned fake database.
+func newBackupTestAgent(t *testing.T, root string) (*ActionAgent, *topo.Server, *fakesqldb.DB) {
+	ctx := context.Background()
+	db := fakesqldb.New(t)
+	db.AddQuery("CREATE DATABASE IF NOT EXISTS _vt", &sqltypes.Result{})
+	db.AddQuery("BEGIN", &sqltypes.Result{})
+	db.AddQuery("COMMIT", &sqltypes.Result{})
+	db.AddQueryPattern(`SET @@session\.sql_log_bin = .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.shard_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.local_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`INSERT INTO _vt\.local_metadata .*`, &sqltypes.Result{})
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(db)
+	setupBinlogArchive(t, root, fmd)
+
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, "test_keyspace", &topodatapb.Keyspace{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateShard(ctx, "test_keyspace", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateTablet(ctx, &topodatapb.Tablet{
+		Alias:    tabletAlias,
+		Hostname: "host",
+		Keyspace: "test_keyspace",
+		Shard:    "0",
+		Type:     topodatapb.TabletType_REPLICA,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewTestActionAgent(ctx, ts, tabletAlias, 1234, 0, fmd, nil)
+	agent.HealthReporter = &fakeHealthCheck{}
+	return agent, ts, db
+}
+
+func TestBackupEngine(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "backupenginetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	agent, ts, db := newBackupTestAgent(t, root)
+	defer db.Close()
+	dir := "test_keyspace/0"
+	fmd := agent.MysqlDaemon
+
+	be := &fakeBackupEngine{
+		ts:  ts,
+		pos: testPosition(t, testServerUUID+":1-30"),
+	}
+	mysqlctl.BackupEngineMap["fake"] = be
+	defer delete(mysqlctl.BackupEngineMap, "fake")
+	*mysqlctl.BackupEngineImplementation = "fake"
+	defer func() { *mysqlctl.BackupEngineImplementation = "builtin" }()
+
+	// The engine takes a hot backup, the tablet keeps serving.
+	if err := agent.Backup(ctx, 2, logutil.NewMemoryLogger(), false /* incremental */); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if be.backupTabletType != topodatapb.TabletType_REPLICA {
+		t.Errorf("tablet type during backup: %v, want REPLICA", be.backupTabletType)
+	}
+	names, bms := readTestBackups(t, dir)
+	if len(names) != 1 || bms[0].BackupMethod != "fake" {
+		t.Fatalf("backups: %v, want one backup taken by the fake engine", names)
+	}
+
+	// Restore uses the engine recorded in the backup, whatever
+	// the engine of the tablet is.
+	*mysqlctl.BackupEngineImplementation = "builtin"
+	pos, err := mysqlctl.Restore(ctx, fmd, dir, 2, nil, nil, logutil.NewMemoryLogger(), true /* deleteBeforeRestore */, "vt_test_keyspace", mysqlctl.RestorePoint{})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if be.restored != names[0] {
+		t.Errorf("restored backup: %q, want %v", be.restored, names[0])
+	}
+	if !pos.Equal(be.pos) {
+		t.Errorf("Restore position: %v, want %v", pos, be.pos)
+	}
+
+	// A backup taken by an unknown engine cannot be restored.
+	delete(mysqlctl.BackupEngineMap, "fake")
+	_, err = mysqlctl.Restore(ctx, fmd, dir, 2, nil, nil, logutil.NewMemoryLogger(), true /* deleteBeforeRestore */, "vt_test_keyspace", mysqlctl.RestorePoint{})
+	if err == nil || !strings.Contains(err.Error(), "no registered implementation of BackupEngine named fake") {
+		t.Errorf("Restore: %v, want no registered implementation", err)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+// This file takes backups on a cron schedule.
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/cron"
+	"vitess.io/vitess/go/history"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+
+	logutilpb "vitess.io/vitess/go/vt/proto/logutil"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	backupSchedule            = flag.String("backup_schedule", "", "if set, the tablet takes backups on this cron schedule, in UTC, e.g. '0 3 * * *' for every day at 3am, while its type is -backup_schedule_tablet_type")
+	backupScheduleTabletType  = flag.String("backup_schedule_tablet_type", "rdonly", "the tablet type the tablet must have to take the backups of -backup_schedule")
+	backupScheduleConcurrency = flag.Int("backup_schedule_concurrency", 4, "the number of files to compress and copy simultaneously for the backups of -backup_schedule")
+)
+
+// backupSchedulerHistoryLength is the number of backups the
+// BackupScheduler reports on.
+const backupSchedulerHistoryLength = 10
+
+// BackupScheduler takes backups on a cron schedule. It is open while
+// the tablet runs, and takes the backups only while the tablet has
+// the designated type, usually a rdonly or a replica that does not
+// serve, as backups can drain it.
+type BackupScheduler struct {
+	// Immutable, set at construction time.
+	agent       *ActionAgent
+	schedule    *cron.Schedule
+	tabletType  topodatapb.TabletType
+	concurrency int
+	history     *history.History
+
+	// mu protects the following fields.
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	next    time.Time
+	running *BackupRun
+}
+
+// BackupRun describes a scheduled backup.
+type BackupRun struct {
+	Start    time.Time
+	Duration time.Duration
+
+	// Skipped is the reason why the backup was not taken, if any.
+	Skipped string
+
+	// Err is the error of the backup, if any.
+	Err error
+}
+
+// Result returns the result of the backup for the status page.
+func (br *BackupRun) Result() string {
+	switch {
+	case br.Skipped != "":
+		return "skipped: " + br.Skipped
+	case br.Err != nil:
+		return "failed: " + br.Err.Error()
+	}
+	return "succeeded"
+}
+
+// BackupSchedulerStatus is the status of a BackupScheduler.
+type BackupSchedulerStatus struct {
+	Schedule   string
+	TabletType string
+
+	// Next is the time of the next backup, if none is running.
+	Next time.Time
+
+	// Running is the backup in progress, if any.
+	Running *BackupRun
+
+	// Runs are the previous backups, the most recent first.
+	Runs []*BackupRun
+}
+
+// NewBackupScheduler creates a new BackupScheduler, that takes
+// backups on the cron schedule while the tablet type is tabletType.
+// It is not open.
+func NewBackupScheduler(agent *ActionAgent, schedule, tabletType string, concurrency int) (*BackupScheduler, error) {
+	s, err := cron.Parse(schedule)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := topoproto.ParseTabletType(tabletType)
+	if err != nil {
+		return nil, err
+	}
+	if tt == topodatapb.TabletType_MASTER {
+		return nil, fmt.Errorf("the master cannot take scheduled backups, use another tablet type")
+	}
+	return &BackupScheduler{
+		agent:       agent,
+		schedule:    s,
+		tabletType:  tt,
+		concurrency: concurrency,
+		history:     history.New(backupSchedulerHistoryLength),
+	}, nil
+}
+
+// Open starts taking backups on the schedule. It does nothing if
+// the scheduler is already open.
+func (bs *BackupScheduler) Open(ctx context.Context) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	if bs.cancel != nil {
+		return
+	}
+	log.Infof("Opening BackupScheduler with schedule %v", bs.schedule)
+	ctx, bs.cancel = context.WithCancel(ctx)
+	bs.done = make(chan struct{})
+	go bs.run(ctx)
+}
+
+// Close stops taking backups, and cancels the backup in progress,
+// if any. It does nothing if the scheduler is not open.
+func (bs *BackupScheduler) Close() {
+	bs.mu.Lock()
+	cancel, done := bs.cancel, bs.done
+	bs.cancel = nil
+	bs.done = nil
+	bs.next = time.Time{}
+	bs.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	log.Infof("Closing BackupScheduler")
+	cancel()
+	<-done
+}
+
+// run takes the backups until ctx is canceled.
+func (bs *BackupScheduler) run(ctx context.Context) {
+	defer close(bs.done)
+	for {
+		now := time.Now().UTC()
+		next := bs.schedule.Next(now)
+		if next.IsZero() {
+			log.Errorf("BackupScheduler: schedule %v never fires", bs.schedule)
+			return
+		}
+		bs.mu.Lock()
+		bs.next = next
+		bs.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next.Sub(now)):
+		}
+		bs.backup(ctx)
+	}
+}
+
+// backup takes a backup if the tablet has the designated type, and
+// records the result in the history.
+func (bs *BackupScheduler) backup(ctx context.Context) {
+	run := &BackupRun{
+		Start: time.Now().UTC(),
+	}
+	tablet := bs.agent.Tablet()
+	switch {
+	case tablet == nil:
+		run.Skipped = "the tablet is not initialized"
+	case tablet.Type != bs.tabletType:
+		run.Skipped = fmt.Sprintf("the tablet type is %v, not %v", tablet.Type, bs.tabletType)
+	default:
+		bs.mu.Lock()
+		bs.running = run
+		bs.mu.Unlock()
+
+		log.Infof("BackupScheduler: taking a backup")
+		// Backup already logs to the console.
+		err := bs.agent.Backup(ctx, bs.concurrency, logutil.NewCallbackLogger(func(*logutilpb.Event) {}), false /* incremental */)
+		if err != nil {
+			log.Errorf("BackupScheduler: backup failed: %v", err)
+		} else {
+			log.Infof("BackupScheduler: backup succeeded in %v", time.Since(run.Start))
+		}
+
+		bs.mu.Lock()
+		run.Err = err
+		run.Duration = time.Since(run.Start)
+		bs.running = nil
+		bs.mu.Unlock()
+	}
+	if run.Skipped != "" {
+		log.Infof("BackupScheduler: skipping the backup, %v", run.Skipped)
+	}
+	bs.history.Add(run)
+}
+
+// Status returns the status of the scheduler, for the status page.
+func (bs *BackupScheduler) Status() *BackupSchedulerStatus {
+	status := &BackupSchedulerStatus{
+		Schedule:   bs.schedule.String(),
+		TabletType: topoproto.TabletTypeLString(bs.tabletType),
+	}
+	bs.mu.Lock()
+	if bs.running != nil {
+		running := *bs.running
+		status.Running = &running
+	} else {
+		status.Next = bs.next
+	}
+	bs.mu.Unlock()
+	for _, r := range bs.history.Records() {
+		status.Runs = append(status.Runs, r.(*BackupRun))
+	}
+	return status
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/mysqlctl"
+)
+
+func TestBackupScheduler(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "backupschedulertest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	agent, ts, db := newBackupTestAgent(t, root)
+	defer db.Close()
+	dir := "test_keyspace/0"
+	be := &fakeBackupEngine{
+		ts:  ts,
+		pos: testPosition(t, testServerUUID+":1-30"),
+	}
+	mysqlctl.BackupEngineMap["fake"] = be
+	defer delete(mysqlctl.BackupEngineMap, "fake")
+	*mysqlctl.BackupEngineImplementation = "fake"
+	defer func() { *mysqlctl.BackupEngineImplementation = "builtin" }()
+
+	if _, err := NewBackupScheduler(agent, "0 3 * *", "rdonly", 2); err == nil || !strings.Contains(err.Error(), "it has 4 fields") {
+		t.Errorf("NewBackupScheduler with an invalid schedule: %v, want it has 4 fields", err)
+	}
+	if _, err := NewBackupScheduler(agent, "0 3 * * *", "master", 2); err == nil || !strings.Contains(err.Error(), "master cannot take scheduled backups") {
+		t.Errorf("NewBackupScheduler for masters: %v, want master cannot take scheduled backups", err)
+	}
+
+	// The tablet is a replica, so an rdonly scheduler skips.
+	bs, err := NewBackupScheduler(agent, "0 3 * * *", "rdonly", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.backup(ctx)
+	status := bs.Status()
+	if len(status.Runs) != 1 || status.Runs[0].Result() != "skipped: the tablet type is REPLICA, not RDONLY" {
+		t.Errorf("backup runs: %+v, want one skipped", status.Runs)
+	}
+	if names, _ := readTestBackups(t, dir); len(names) != 0 {
+		t.Errorf("backups: %v, want none", names)
+	}
+
+	bs, err = NewBackupScheduler(agent, "0 3 * * *", "replica", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.backup(ctx)
+	status = bs.Status()
+	if len(status.Runs) != 1 || status.Runs[0].Result() != "succeeded" {
+		t.Errorf("backup runs: %+v, want one succeeded", status.Runs)
+	}
+	if names, _ := readTestBackups(t, dir); len(names) != 1 {
+		t.Errorf("backups: %v, want one", names)
+	}
+
+	// Once open, the scheduler reports the next backup.
+	bs.Open(ctx)
+	defer bs.Close()
+	want := time.Now().UTC()
+	want = time.Date(want.Year(), want.Month(), want.Day(), 3, 0, 0, 0, time.UTC)
+	if !want.After(time.Now()) {
+		want = want.AddDate(0, 0, 1)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		status := bs.Status()
+		if status.Next.Equal(want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("next backup: %v, want %v", status.Next, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
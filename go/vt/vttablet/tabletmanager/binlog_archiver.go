@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+// This file archives the binlogs of the master into the
+// BackupStorage, for point-in-time restores.
+
+import (
+	"flag"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
+)
+
+var (
+	binlogArchiveInterval = flag.Duration("binlog_archive_interval", 0, "if set, the master rotates its binlogs and archives them into the BackupStorage at this interval, so RestoreFromBackup can restore to a position or a time")
+)
+
+// BinlogArchiver copies the binlogs of the master into the
+// BackupStorage. Every binlog_archive_interval, it rotates the
+// binlogs, and archives the ones that are not archived yet. It is
+// open while the tablet is a master.
+type BinlogArchiver struct {
+	// Immutable, set at construction time.
+	mysqld mysqlctl.MysqlDaemon
+
+	// mu protects the following fields.
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewBinlogArchiver creates a new BinlogArchiver. It is not open.
+func NewBinlogArchiver(mysqld mysqlctl.MysqlDaemon) *BinlogArchiver {
+	return &BinlogArchiver{
+		mysqld: mysqld,
+	}
+}
+
+// Open starts archiving the binlogs in dir, the directory of the
+// shard backups. It does nothing if the archiver is already open.
+func (ba *BinlogArchiver) Open(ctx context.Context, dir string, hookExtraEnv map[string]string) {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
+	if ba.cancel != nil {
+		return
+	}
+	log.Infof("Opening BinlogArchiver for %v", dir)
+	ctx, ba.cancel = context.WithCancel(ctx)
+	ba.done = make(chan struct{})
+	go ba.run(ctx, dir, hookExtraEnv)
+}
+
+// Close stops archiving the binlogs. It does nothing if the
+// archiver is not open.
+func (ba *BinlogArchiver) Close() {
+	ba.mu.Lock()
+	defer ba.mu.Unlock()
+	if ba.cancel == nil {
+		return
+	}
+	log.Infof("Closing BinlogArchiver")
+	ba.cancel()
+	<-ba.done
+	ba.cancel = nil
+	ba.done = nil
+}
+
+// run archives the binlogs until ctx is canceled.
+func (ba *BinlogArchiver) run(ctx context.Context, dir string, hookExtraEnv map[string]string) {
+	defer close(ba.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*binlogArchiveInterval):
+		}
+
+		if err := ba.archive(ctx, dir, hookExtraEnv); err != nil {
+			log.Errorf("BinlogArchiver: cannot archive binlogs: %v", err)
+		}
+	}
+}
+
+// archive rotates the binlogs, so the archive is at most one
+// interval behind, and archives the binlogs that are closed.
+func (ba *BinlogArchiver) archive(ctx context.Context, dir string, hookExtraEnv map[string]string) error {
+	if err := ba.mysqld.ExecuteSuperQueryList(ctx, []string{"FLUSH BINARY LOGS"}); err != nil {
+		return err
+	}
+	count, err := mysqlctl.ArchiveBinlogs(ctx, ba.mysqld, logutil.NewConsoleLogger(), dir, hookExtraEnv)
+	if count > 0 {
+		log.Infof("BinlogArchiver: archived %v binlogs", count)
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/mysqlctl/fakemysqldaemon"
+	"vitess.io/vitess/go/vt/mysqlctl/filebackupstorage"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+const testServerUUID = "00010203-0405-0607-0809-0a0b0c0d0e0f"
+
+func testPosition(t *testing.T, gtids string) mysql.Position {
+	t.Helper()
+	pos, err := mysql.ParsePosition("MySQL56", gtids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pos
+}
+
+// setupBinlogArchive creates a BackupStorage in root, and three
+// binlog files. The last one is still being written to.
+func setupBinlogArchive(t *testing.T, root string, fmd *fakemysqldaemon.FakeMysqlDaemon) {
+	t.Helper()
+	*filebackupstorage.FileBackupStorageRoot = path.Join(root, "fbs")
+	*backupstorage.BackupStorageImplementation = "file"
+
+	binlogDir := path.Join(root, "bin-logs")
+	tmpDir := path.Join(root, "tmp")
+	for _, dir := range []string{binlogDir, tmpDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fmd.Mycnf = &mysqlctl.Mycnf{
+		DataDir:               path.Join(root, "data"),
+		InnodbDataHomeDir:     path.Join(root, "innodb_data"),
+		InnodbLogGroupHomeDir: path.Join(root, "innodb_log"),
+		BinLogPath:            path.Join(binlogDir, "vt-bin"),
+		RelayLogPath:          path.Join(root, "relay-logs/vt-relay-bin"),
+		RelayLogIndexPath:     path.Join(root, "relay-log.index"),
+		RelayLogInfoPath:      path.Join(root, "relay-log.info"),
+		TmpDir:                tmpDir,
+	}
+	fmd.FetchSuperQueryMap = map[string]*sqltypes.Result{
+		"SHOW DATABASES": {},
+		"SHOW BINARY LOGS": sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+			"Log_name|File_size",
+			"varchar|int64"),
+			"vt-bin.000001|100",
+			"vt-bin.000002|100",
+			"vt-bin.000003|100",
+		),
+	}
+	for i, gtids := range []string{"1-10", "1-20", "1-30"} {
+		name := fmt.Sprintf("vt-bin.%06d", i+1)
+		if err := ioutil.WriteFile(path.Join(binlogDir, name), []byte("binlog "+name), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		setPreviousGTIDs(fmd, name, testServerUUID+":"+gtids)
+	}
+}
+
+func setPreviousGTIDs(fmd *fakemysqldaemon.FakeMysqlDaemon, name, gtids string) {
+	fmd.FetchSuperQueryMap["SHOW BINLOG EVENTS IN '"+name+"' LIMIT 2"] = sqltypes.MakeTestResult(sqltypes.MakeTestFields(
+		"Log_name|Pos|Event_type|Server_id|End_log_pos|Info",
+		"varchar|int64|varchar|int64|int64|varchar"),
+		name+"|4|Format_desc|1|123|Server ver: 5.7.20-log, Binlog ver: 4",
+		name+"|123|Previous_gtids|1|154|"+gtids,
+	)
+}
+
+func archivedBinlogs(t *testing.T, dir string) []string {
+	t.Helper()
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	bhs, err := bs.ListBackups(context.Background(), mysqlctl.BinlogArchiveDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, bh := range bhs {
+		names = append(names, mysqlctl.ArchivedBinlogFile(bh.Name()))
+	}
+	return names
+}
+
+func TestBinlogArchiver(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "binlogarchivetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(nil)
+	setupBinlogArchive(t, root, fmd)
+	fmd.ExpectedExecuteSuperQueryList = []string{
+		"FLUSH BINARY LOGS",
+		"FLUSH BINARY LOGS",
+		"FLUSH BINARY LOGS",
+	}
+	ba := NewBinlogArchiver(fmd)
+	dir := "test_keyspace/0"
+
+	// The binlogs that are closed are archived.
+	if err := ba.archive(ctx, dir, nil); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	want := []string{"vt-bin.000001", "vt-bin.000002"}
+	if got := archivedBinlogs(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("archived binlogs: %v, want %v", got, want)
+	}
+
+	// They are only archived once.
+	if err := ba.archive(ctx, dir, nil); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if got := archivedBinlogs(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("archived binlogs: %v, want %v", got, want)
+	}
+
+	// A binlog name reused after RESET MASTER is archived again.
+	setPreviousGTIDs(fmd, "vt-bin.000001", testServerUUID+":1-40")
+	setPreviousGTIDs(fmd, "vt-bin.000002", testServerUUID+":1-50")
+	fmd.FetchSuperQueryMap["SHOW BINARY LOGS"].Rows = fmd.FetchSuperQueryMap["SHOW BINARY LOGS"].Rows[:2]
+	if err := ba.archive(ctx, dir, nil); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	if got := archivedBinlogs(t, dir); len(got) != 3 || got[2] != "vt-bin.000001" {
+		t.Errorf("archived binlogs: %v, want a second vt-bin.000001", got)
+	}
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Error(err)
+	}
+}
+
+// addTestBackup adds a backup without files, taken at pos.
+func addTestBackup(t *testing.T, dir, name string, pos mysql.Position) {
+	t.Helper()
+	ctx := context.Background()
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	bh, err := bs.StartBackup(ctx, dir, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc, err := bh.AddFile(ctx, "MANIFEST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.NewEncoder(wc).Encode(&mysqlctl.BackupManifest{Position: pos}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bh.EndBackup(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRestoreToPointInTime(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "binlogarchivetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db := fakesqldb.New(t)
+	defer db.Close()
+	db.AddQuery("CREATE DATABASE IF NOT EXISTS _vt", &sqltypes.Result{})
+	db.AddQuery("BEGIN", &sqltypes.Result{})
+	db.AddQuery("COMMIT", &sqltypes.Result{})
+	db.AddQueryPattern(`SET @@session\.sql_log_bin = .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.shard_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.local_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`INSERT INTO _vt\.local_metadata .*`, &sqltypes.Result{})
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(db)
+	setupBinlogArchive(t, root, fmd)
+	dir := "test_keyspace/0"
+	fmd.ExpectedExecuteSuperQueryList = []string{"FLUSH BINARY LOGS"}
+	if err := NewBinlogArchiver(fmd).archive(ctx, dir, nil); err != nil {
+		t.Fatalf("archive failed: %v", err)
+	}
+	firstBackupPos := testPosition(t, testServerUUID+":1-15")
+	lastBackupPos := testPosition(t, testServerUUID+":1-25")
+	addTestBackup(t, dir, "2018-06-01.120000.cell1-0000000002", firstBackupPos)
+	addTestBackup(t, dir, "2018-06-02.120000.cell1-0000000002", lastBackupPos)
+
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, "test_keyspace", &topodatapb.Keyspace{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateShard(ctx, "test_keyspace", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateTablet(ctx, &topodatapb.Tablet{
+		Alias:    tabletAlias,
+		Hostname: "host",
+		Keyspace: "test_keyspace",
+		Shard:    "0",
+		Type:     topodatapb.TabletType_REPLICA,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewTestActionAgent(ctx, ts, tabletAlias, 1234, 0, fmd, nil)
+	agent.HealthReporter = &fakeHealthCheck{}
+
+	// A position after the end of the archive cannot be reached.
+	fmd.ExpectedExecuteSuperQueryList = []string{"FAKE SET SLAVE POSITION"}
+	fmd.ExpectedExecuteSuperQueryCurrent = 0
+	fmd.SetSlavePositionPos = lastBackupPos
+	restoreToPos := mysql.EncodePosition(testPosition(t, testServerUUID+":1-35"))
+	err = agent.RestoreFromBackup(ctx, logutil.NewMemoryLogger(), restoreToPos, 0)
+	if err == nil || !strings.Contains(err.Error(), "archived binlogs end at") {
+		t.Errorf("RestoreFromBackup(%v): %v, want archived binlogs end at", restoreToPos, err)
+	}
+
+	// The first backup is restored, and the two archived binlogs
+	// are replayed up to the position.
+	fmd.ExpectedExecuteSuperQueryCurrent = 0
+	fmd.SetSlavePositionPos = firstBackupPos
+	fmd.AppliedBinlogFiles = nil
+	fmd.CurrentMasterPosition = testPosition(t, testServerUUID+":1-22")
+	restoreToPos = mysql.EncodePosition(fmd.CurrentMasterPosition)
+	if err := agent.RestoreFromBackup(ctx, logutil.NewMemoryLogger(), restoreToPos, 0); err != nil {
+		t.Fatalf("RestoreFromBackup(%v) failed: %v", restoreToPos, err)
+	}
+	want := []string{"vt-bin.000001", "vt-bin.000002"}
+	if !reflect.DeepEqual(fmd.AppliedBinlogFiles, want) {
+		t.Errorf("applied binlogs: %v, want %v", fmd.AppliedBinlogFiles, want)
+	}
+	if !fmd.AppliedRestorePoint.Position.Equal(fmd.CurrentMasterPosition) {
+		t.Errorf("applied restore point: %v, want %v", fmd.AppliedRestorePoint, fmd.CurrentMasterPosition)
+	}
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Error(err)
+	}
+	ti, err := ts.GetTablet(ctx, tabletAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Type != topodatapb.TabletType_DRAINED {
+		t.Errorf("tablet type after restore: %v, want DRAINED", ti.Type)
+	}
+	if !agent.slaveStopped() {
+		t.Errorf("replication should stay stopped after a point-in-time restore")
+	}
+
+	// There is no backup before that time.
+	restoreToTime := time.Date(2018, 5, 1, 0, 0, 0, 0, time.UTC)
+	err = agent.RestoreFromBackup(ctx, logutil.NewMemoryLogger(), "", restoreToTime.UnixNano())
+	if err == nil || !strings.Contains(err.Error(), "no backup before time 2018-05-01T00:00:00Z") {
+		t.Errorf("RestoreFromBackup(%v): %v, want no backup before", restoreToTime, err)
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql/fakesqldb"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/mysqlctl/backupstorage"
+	"vitess.io/vitess/go/vt/mysqlctl/fakemysqldaemon"
+	"vitess.io/vitess/go/vt/mysqlctl/filebackupstorage"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// readTestBackups returns the names and MANIFESTs of the backups in dir.
+func readTestBackups(t *testing.T, dir string) ([]string, []*mysqlctl.BackupManifest) {
+	t.Helper()
+	ctx := context.Background()
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	bhs, err := bs.ListBackups(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var bms []*mysqlctl.BackupManifest
+	for _, bh := range bhs {
+		rc, err := bh.ReadFile(ctx, "MANIFEST")
+		if err != nil {
+			t.Fatal(err)
+		}
+		bm := &mysqlctl.BackupManifest{}
+		err = json.NewDecoder(rc).Decode(bm)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, bh.Name())
+		bms = append(bms, bm)
+	}
+	return names, bms
+}
+
+func TestIncrementalBackup(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "incrementalbackuptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	db := fakesqldb.New(t)
+	defer db.Close()
+	db.AddQuery("CREATE DATABASE IF NOT EXISTS _vt", &sqltypes.Result{})
+	db.AddQuery("BEGIN", &sqltypes.Result{})
+	db.AddQuery("COMMIT", &sqltypes.Result{})
+	db.AddQueryPattern(`SET @@session\.sql_log_bin = .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.shard_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`CREATE TABLE IF NOT EXISTS _vt\.local_metadata .*`, &sqltypes.Result{})
+	db.AddQueryPattern(`INSERT INTO _vt\.local_metadata .*`, &sqltypes.Result{})
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(db)
+	setupBinlogArchive(t, root, fmd)
+	dir := "test_keyspace/0"
+	fullBackup := "2018-06-01.120000.cell1-0000000002"
+	fullBackupPos := testPosition(t, testServerUUID+":1-15")
+	addTestBackup(t, dir, fullBackup, fullBackupPos)
+
+	ts := memorytopo.NewServer("cell1")
+	if err := ts.CreateKeyspace(ctx, "test_keyspace", &topodatapb.Keyspace{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateShard(ctx, "test_keyspace", "0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.CreateTablet(ctx, &topodatapb.Tablet{
+		Alias:    tabletAlias,
+		Hostname: "host",
+		Keyspace: "test_keyspace",
+		Shard:    "0",
+		Type:     topodatapb.TabletType_REPLICA,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	agent := NewTestActionAgent(ctx, ts, tabletAlias, 1234, 0, fmd, nil)
+	agent.HealthReporter = &fakeHealthCheck{}
+
+	// The incremental backup contains the two closed binlogs,
+	// and the tablet keeps serving.
+	fmd.ExpectedExecuteSuperQueryList = []string{"FLUSH BINARY LOGS"}
+	if err := agent.Backup(ctx, 2, logutil.NewMemoryLogger(), true /* incremental */); err != nil {
+		t.Fatalf("incremental Backup failed: %v", err)
+	}
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Error(err)
+	}
+	names, bms := readTestBackups(t, dir)
+	if len(names) != 2 || names[0] != fullBackup {
+		t.Fatalf("backups: %v, want %v and an incremental backup", names, fullBackup)
+	}
+	bm := bms[1]
+	if !bm.Incremental || bm.BaseBackup != fullBackup || !bm.FromPosition.Equal(fullBackupPos) {
+		t.Errorf("incremental backup MANIFEST: %+v, want an incremental backup based on %v at %v", bm, fullBackup, fullBackupPos)
+	}
+	if want := testPosition(t, testServerUUID+":1-30"); !bm.Position.Equal(want) {
+		t.Errorf("incremental backup position: %v, want %v", bm.Position, want)
+	}
+	var files []string
+	for _, fe := range bm.FileEntries {
+		files = append(files, fe.Name)
+	}
+	if want := []string{"vt-bin.000001", "vt-bin.000002"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("incremental backup files: %v, want %v", files, want)
+	}
+	ti, err := ts.GetTablet(ctx, tabletAlias)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti.Type != topodatapb.TabletType_REPLICA {
+		t.Errorf("tablet type after incremental backup: %v, want REPLICA", ti.Type)
+	}
+
+	// The incremental backup depends on the full backup.
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	dependents, err := mysqlctl.BackupDependents(ctx, bs, dir, fullBackup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := names[1:]; !reflect.DeepEqual(dependents, want) {
+		t.Errorf("BackupDependents(%v): %v, want %v", fullBackup, dependents, want)
+	}
+	dependents, err = mysqlctl.BackupDependents(ctx, bs, dir, names[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dependents) != 0 {
+		t.Errorf("BackupDependents(%v): %v, want none", names[1], dependents)
+	}
+
+	// Restore applies the incremental backup on top of the full one.
+	fmd.ExpectedExecuteSuperQueryList = []string{"FAKE SET SLAVE POSITION"}
+	fmd.ExpectedExecuteSuperQueryCurrent = 0
+	fmd.SetSlavePositionPos = fullBackupPos
+	pos, err := mysqlctl.Restore(ctx, fmd, dir, 2, nil, nil, logutil.NewMemoryLogger(), true /* deleteBeforeRestore */, "vt_test_keyspace", mysqlctl.RestorePoint{})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if !pos.Equal(bm.Position) {
+		t.Errorf("Restore position: %v, want %v", pos, bm.Position)
+	}
+	if want := []string{"vt-bin.000001", "vt-bin.000002"}; !reflect.DeepEqual(fmd.AppliedBinlogFiles, want) {
+		t.Errorf("applied binlogs: %v, want %v", fmd.AppliedBinlogFiles, want)
+	}
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIncrementalBackupPurgedBinlogs(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "incrementalbackuptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(nil)
+	setupBinlogArchive(t, root, fmd)
+	dir := "test_keyspace/0"
+	logger := logutil.NewMemoryLogger()
+
+	// There is no backup to base it on.
+	fmd.ExpectedExecuteSuperQueryList = []string{"FLUSH BINARY LOGS"}
+	err = mysqlctl.Backup(ctx, fmd, logger, dir, "2018-06-02.120000.cell1-0000000002", 2, nil, true /* incremental */)
+	if err == nil || !strings.Contains(err.Error(), "take a full backup first") {
+		t.Errorf("incremental Backup: %v, want take a full backup first", err)
+	}
+
+	// The first binlog starts after the backup position.
+	addTestBackup(t, dir, "2018-06-01.120000.cell1-0000000002", testPosition(t, testServerUUID+":1-5"))
+	err = mysqlctl.Backup(ctx, fmd, logger, dir, "2018-06-02.120000.cell1-0000000002", 2, nil, true /* incremental */)
+	if err == nil || !strings.Contains(err.Error(), "were purged") {
+		t.Errorf("incremental Backup: %v, want binlogs were purged", err)
+	}
+	if err := fmd.CheckSuperQueryList(); err != nil {
+		t.Error(err)
+	}
+	if names, _ := readTestBackups(t, dir); len(names) != 1 {
+		t.Errorf("backups: %v, want the aborted backup to be removed", names)
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	ctx := context.Background()
+	root, err := ioutil.TempDir("", "verifybackuptest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	fmd := fakemysqldaemon.NewFakeMysqlDaemon(nil)
+	setupBinlogArchive(t, root, fmd)
+	dir := "test_keyspace/0"
+	fullBackup := "2018-06-01.120000.cell1-0000000002"
+	addTestBackup(t, dir, fullBackup, testPosition(t, testServerUUID+":1-15"))
+	fmd.ExpectedExecuteSuperQueryList = []string{"FLUSH BINARY LOGS"}
+	name := "2018-06-02.120000.cell1-0000000002"
+	if err := mysqlctl.Backup(ctx, fmd, logutil.NewMemoryLogger(), dir, name, 2, nil, true /* incremental */); err != nil {
+		t.Fatalf("incremental Backup failed: %v", err)
+	}
+	_, bms := readTestBackups(t, dir)
+	for _, fe := range bms[1].FileEntries {
+		if fe.Hash == "" || fe.Checksum == "" {
+			t.Errorf("file %v has no hash or checksum: %+v", fe.Name, fe)
+		}
+	}
+
+	bs, err := backupstorage.GetBackupStorage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bs.Close()
+	if err := mysqlctl.VerifyBackup(ctx, logutil.NewMemoryLogger(), bs, dir, name, 2); err != nil {
+		t.Errorf("VerifyBackup(%v) failed: %v", name, err)
+	}
+	if err := mysqlctl.VerifyBackup(ctx, logutil.NewMemoryLogger(), bs, dir, "unknown", 2); err == nil || !strings.Contains(err.Error(), "no backup unknown") {
+		t.Errorf("VerifyBackup(unknown): %v, want no backup", err)
+	}
+
+	// A wrong checksum is detected.
+	backupPath := path.Join(*filebackupstorage.FileBackupStorageRoot, dir, name)
+	manifest, err := ioutil.ReadFile(path.Join(backupPath, "MANIFEST"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badManifest := strings.Replace(string(manifest), bms[1].FileEntries[1].Checksum, strings.Repeat("0", 64), 1)
+	if err := ioutil.WriteFile(path.Join(backupPath, "MANIFEST"), []byte(badManifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mysqlctl.VerifyBackup(ctx, logutil.NewMemoryLogger(), bs, dir, name, 2); err == nil || !strings.Contains(err.Error(), "checksum mismatch for vt-bin.000002") {
+		t.Errorf("VerifyBackup with a wrong checksum: %v, want checksum mismatch", err)
+	}
+
+	// A modified file is detected.
+	if err := ioutil.WriteFile(path.Join(backupPath, "MANIFEST"), manifest, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path.Join(backupPath, "0"), []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := mysqlctl.VerifyBackup(ctx, logutil.NewMemoryLogger(), bs, dir, name, 2); err == nil {
+		t.Errorf("VerifyBackup with a modified file worked, want an error")
+	}
+
+	// An incremental backup without its base backup is not valid.
+	if err := bs.RemoveBackup(ctx, dir, fullBackup); err != nil {
+		t.Fatal(err)
+	}
+	if err := mysqlctl.VerifyBackup(ctx, logutil.NewMemoryLogger(), bs, dir, name, 2); err == nil || !strings.Contains(err.Error(), "which does not exist") {
+		t.Errorf("VerifyBackup without the base backup: %v, want does not exist", err)
+	}
+}
@@ -0,0 +1,484 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+// This file runs the online schema changes of the
+// _vt.schema_migrations table, see the onlineddl package.
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/throttler"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver"
+	"vitess.io/vitess/go/vt/vttablet/tabletserver/rules"
+)
+
+var (
+	onlineDDLCheckInterval     = flag.Duration("online_ddl_check_interval", 10*time.Second, "how often the master checks _vt.schema_migrations to start migrations, and to follow the running one")
+	onlineDDLCutOverTimeout    = flag.Duration("online_ddl_cutover_timeout", 10*time.Second, "how long an online schema change may block the writes to its table while it swaps it with the new one, before it gives up and tries again later")
+	onlineDDLMaxTPS            = flag.Int64("online_ddl_max_tps", throttler.MaxRateModuleDisabled, "max rate of the transactions that copy a table in an online schema change")
+	onlineDDLMaxReplicationLag = flag.Int64("online_ddl_max_replication_lag", 10, "max replication lag of the replicas, in seconds, before an online schema change slows down its copy")
+)
+
+// Query rules of the cut-over of the online schema changes.
+const onlineDDLQueryRules string = "OnlineDDLQueryRules"
+
+// OnlineDDLEngine runs the migrations of the _vt.schema_migrations
+// table, one at a time. It is open while the tablet is a master.
+//
+// A migration creates a shadow table with the new schema, and copies
+// its table into it with a _vt.vreplication stream within the shard.
+// The copy is throttled by the replication lag of the replicas. Once
+// the copy is done, the cut-over blocks the queries of the table,
+// waits for the stream to catch up, and swaps the tables while it
+// holds a write lock on the table. The columns are matched by name:
+// the columns that the ALTER TABLE removes aren't copied, and the
+// migrations that rename columns are refused.
+type OnlineDDLEngine struct {
+	// Immutable, set at construction time.
+	qsc             tabletserver.Controller
+	vre             *VReplicationEngine
+	mysqld          mysqlctl.MysqlDaemon
+	vtClientFactory func() binlogplayer.VtClient
+
+	// mu protects the following fields.
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewOnlineDDLEngine creates a new OnlineDDLEngine. It is not open.
+// The streams of the migrations are run by vre.
+func NewOnlineDDLEngine(qsc tabletserver.Controller, vre *VReplicationEngine, mysqld mysqlctl.MysqlDaemon, vtClientFactory func() binlogplayer.VtClient) *OnlineDDLEngine {
+	return &OnlineDDLEngine{
+		qsc:             qsc,
+		vre:             vre,
+		mysqld:          mysqld,
+		vtClientFactory: vtClientFactory,
+	}
+}
+
+// Open starts running the migrations. It does nothing if the engine
+// is already open.
+func (e *OnlineDDLEngine) Open(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		return
+	}
+	log.Infof("Opening OnlineDDLEngine")
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	go e.run(ctx)
+}
+
+// Close stops running the migrations. A running migration resumes
+// when the engine opens again. It does nothing if the engine is not
+// open.
+func (e *OnlineDDLEngine) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel == nil {
+		return
+	}
+	log.Infof("Closing OnlineDDLEngine")
+	e.cancel()
+	<-e.done
+	e.cancel = nil
+	e.done = nil
+}
+
+// run checks the migrations until ctx is canceled.
+func (e *OnlineDDLEngine) run(ctx context.Context) {
+	defer close(e.done)
+	for {
+		if err := e.check(ctx); err != nil {
+			log.Errorf("OnlineDDLEngine: cannot check migrations: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*onlineDDLCheckInterval):
+		}
+	}
+}
+
+// check reads _vt.schema_migrations, cleans up the migrations that
+// stopped, and moves the current migration forward: the running one,
+// or else the first queued one.
+func (e *OnlineDDLEngine) check(ctx context.Context) error {
+	vtClient := e.vtClientFactory()
+	if err := vtClient.Connect(); err != nil {
+		return fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer vtClient.Close()
+
+	for _, query := range onlineddl.CreateSchemaMigrationsTable() {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	qr, err := vtClient.ExecuteFetch(onlineddl.QueryMigrations(), 10000)
+	if err != nil {
+		return err
+	}
+	migrations, err := onlineddl.ParseMigrations(qr)
+	if err != nil {
+		return err
+	}
+
+	var running, queued *onlineddl.Migration
+	for _, m := range migrations {
+		switch m.State {
+		case onlineddl.StateFailed, onlineddl.StateCancelled:
+			if m.VReplID != 0 {
+				if err := e.cleanup(vtClient, m); err != nil {
+					return err
+				}
+			}
+		case onlineddl.StateRunning:
+			if running == nil {
+				running = m
+			}
+		case onlineddl.StateQueued:
+			if queued == nil {
+				queued = m
+			}
+		}
+	}
+
+	m := running
+	if m == nil {
+		m = queued
+	}
+	if m == nil {
+		return nil
+	}
+	if err := e.advance(ctx, vtClient, m); err != nil {
+		log.Errorf("OnlineDDLEngine: migration %v failed: %v", m.UUID, err)
+		if _, err := vtClient.ExecuteFetch(onlineddl.FailMigration(m.ID, truncateMessage(err.Error())), 0); err != nil {
+			return err
+		}
+		return e.cleanup(vtClient, m)
+	}
+	return nil
+}
+
+// advance starts m if it's queued, or follows its copy if it's
+// running, and cuts over once the copy is done. It returns an error
+// if m failed.
+func (e *OnlineDDLEngine) advance(ctx context.Context, vtClient binlogplayer.VtClient, m *onlineddl.Migration) error {
+	if m.State == onlineddl.StateQueued || m.VReplID == 0 {
+		// A running migration without a stream was interrupted
+		// while it started, so it starts again.
+		log.Infof("OnlineDDLEngine: starting migration %v: %v", m.UUID, m.SQL)
+		if _, err := vtClient.ExecuteFetch(onlineddl.StartMigration(m.ID, time.Now().Unix()), 0); err != nil {
+			return err
+		}
+		return e.start(vtClient, m)
+	}
+
+	copyState, err := binlogplayer.ReadCopyState(vtClient, m.VReplID)
+	if err != nil {
+		return err
+	}
+	if len(copyState) != 0 {
+		message := "copying rows"
+		qr, err := vtClient.ExecuteFetch(binlogplayer.QueryVReplicationStatus(m.VReplID), 1)
+		if err != nil {
+			return err
+		}
+		if len(qr.Rows) != 1 {
+			return fmt.Errorf("stream %v not found in _vt.vreplication", m.VReplID)
+		}
+		if streamMessage := qr.Rows[0][1].ToString(); streamMessage != "" {
+			message = fmt.Sprintf("%v, stream %v: %v", message, m.VReplID, streamMessage)
+		}
+		_, err = vtClient.ExecuteFetch(onlineddl.SetMigrationMessage(m.ID, truncateMessage(message)), 0)
+		return err
+	}
+
+	if err := e.cutOver(ctx, vtClient, m); err != nil {
+		// The cut-over didn't swap the tables, it's tried again
+		// at the next check.
+		log.Warningf("OnlineDDLEngine: cut-over of migration %v failed: %v", m.UUID, err)
+		_, err := vtClient.ExecuteFetch(onlineddl.SetMigrationMessage(m.ID, truncateMessage(fmt.Sprintf("cut-over failed, will retry: %v", err))), 0)
+		return err
+	}
+	log.Infof("OnlineDDLEngine: migration %v is complete", m.UUID)
+	return nil
+}
+
+// start creates the shadow table of m, and its stream that copies
+// the columns the tables have in common.
+func (e *OnlineDDLEngine) start(vtClient binlogplayer.VtClient, m *onlineddl.Migration) error {
+	shadowTable := onlineddl.ShadowTableName(m.UUID)
+	alter, err := onlineddl.ShadowTableAlter(m)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS " + sqlparser.String(sqlparser.NewTableIdent(shadowTable)),
+		fmt.Sprintf("CREATE TABLE %v LIKE %v", sqlparser.String(sqlparser.NewTableIdent(shadowTable)), sqlparser.String(sqlparser.NewTableIdent(m.Table))),
+		alter,
+	} {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+
+	columns, err := readColumns(vtClient, m.Table)
+	if err != nil {
+		return err
+	}
+	shadowColumns, err := readColumns(vtClient, shadowTable)
+	if err != nil {
+		return err
+	}
+	inShadow := make(map[string]bool, len(shadowColumns))
+	for _, column := range shadowColumns {
+		inShadow[strings.ToLower(column)] = true
+	}
+	var selectExprs []string
+	for _, column := range columns {
+		if inShadow[strings.ToLower(column)] {
+			selectExprs = append(selectExprs, sqlparser.String(sqlparser.NewColIdent(column)))
+		}
+	}
+	if len(selectExprs) == 0 {
+		return fmt.Errorf("tables %v and %v have no column in common", m.Table, shadowTable)
+	}
+
+	source := &binlogplayer.BinlogSource{
+		Keyspace: m.Keyspace,
+		Shard:    m.Shard,
+		Rules: []*binlogplayer.Rule{{
+			Match:  shadowTable,
+			Filter: fmt.Sprintf("select %v from %v", strings.Join(selectExprs, ", "), sqlparser.String(sqlparser.NewTableIdent(m.Table))),
+		}},
+	}
+	// The stream is inserted stopped, so it doesn't start before
+	// it knows it must copy the table.
+	qr, err := vtClient.ExecuteFetch(binlogplayer.CreateVReplicationState(onlineddl.WorkflowName(m.UUID), source, "", "", *onlineDDLMaxTPS, *onlineDDLMaxReplicationLag, time.Now().Unix(), binlogplayer.BlpStopped), 0)
+	if err != nil {
+		return err
+	}
+	m.VReplID = uint32(qr.InsertID)
+	insertCopyState, err := binlogplayer.InsertCopyState(m.VReplID, source)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		insertCopyState,
+		binlogplayer.SetVReplicationState(m.VReplID, binlogplayer.BlpRunning, ""),
+		onlineddl.SetMigrationVReplID(m.ID, m.VReplID),
+		onlineddl.SetMigrationMessage(m.ID, "copying rows"),
+	} {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cutOver swaps the table of m with its shadow table. The queries of
+// the table fail with a retryable error in the meantime, and the
+// table is locked until it's renamed, so that no write reaches it
+// after the stream caught up.
+func (e *OnlineDDLEngine) cutOver(ctx context.Context, vtClient binlogplayer.VtClient, m *onlineddl.Migration) error {
+	qr := rules.NewQueryRule("online schema change cut-over", "online_ddl_cutover", rules.QRFailRetry)
+	qr.AddTableCond(m.Table)
+	cutOverRules := rules.New()
+	cutOverRules.Add(qr)
+	if err := e.qsc.SetQueryRules(onlineDDLQueryRules, cutOverRules); err != nil {
+		return err
+	}
+	defer func() {
+		if err := e.qsc.SetQueryRules(onlineDDLQueryRules, rules.New()); err != nil {
+			log.Errorf("OnlineDDLEngine: cannot clear the cut-over query rules: %v", err)
+		}
+	}()
+
+	// Wait for the transactions that already use the table, and
+	// block the others: the position of the master then has all
+	// the changes of the table. The lock is held by its own
+	// connection, since a session that holds table locks can't use
+	// the other tables. Closing it releases the lock if the
+	// cut-over fails.
+	lockClient := e.vtClientFactory()
+	if err := lockClient.Connect(); err != nil {
+		return fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer lockClient.Close()
+	table := sqlparser.String(sqlparser.NewTableIdent(m.Table))
+	oldTable := sqlparser.String(sqlparser.NewTableIdent(onlineddl.OldTableName(m.UUID)))
+	lockWaitTimeout := int64(onlineDDLCutOverTimeout.Seconds())
+	if lockWaitTimeout < 1 {
+		lockWaitTimeout = 1
+	}
+	for _, query := range []string{
+		fmt.Sprintf("SET SESSION lock_wait_timeout=%v", lockWaitTimeout),
+		fmt.Sprintf("LOCK TABLES %v WRITE", table),
+	} {
+		if _, err := lockClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	pos, err := e.mysqld.MasterPosition()
+	if err != nil {
+		return err
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, *onlineDDLCutOverTimeout)
+	defer cancel()
+	if err := waitForStreamPosition(waitCtx, vtClient, m.VReplID, pos); err != nil {
+		return err
+	}
+
+	// The migration may have been cancelled while the stream
+	// caught up.
+	mqr, err := vtClient.ExecuteFetch(onlineddl.QueryMigration(m.UUID), 1)
+	if err != nil {
+		return err
+	}
+	migrations, err := onlineddl.ParseMigrations(mqr)
+	if err != nil {
+		return err
+	}
+	if len(migrations) != 1 || migrations[0].State != onlineddl.StateRunning {
+		return fmt.Errorf("migration %v is not running any more", m.UUID)
+	}
+
+	// The stream stops before the tables swap, or it would copy
+	// the rows of the new table into it.
+	if err := e.stopStream(vtClient, m); err != nil {
+		return err
+	}
+	// MySQL only renames a locked table with an ALTER TABLE, in
+	// the session that locked it. The writes that wait for the lock
+	// then fail until the shadow table takes its name.
+	for _, query := range []string{
+		fmt.Sprintf("ALTER TABLE %v RENAME %v", table, oldTable),
+		"UNLOCK TABLES",
+	} {
+		if _, err := lockClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	if _, err := vtClient.ExecuteFetch(fmt.Sprintf("RENAME TABLE %v TO %v",
+		sqlparser.String(sqlparser.NewTableIdent(onlineddl.ShadowTableName(m.UUID))), table), 0); err != nil {
+		if _, rerr := vtClient.ExecuteFetch(fmt.Sprintf("RENAME TABLE %v TO %v", oldTable, table), 0); rerr != nil {
+			log.Errorf("OnlineDDLEngine: cannot rename %v back to %v: %v", oldTable, table, rerr)
+		}
+		return err
+	}
+	if _, err := vtClient.ExecuteFetch(onlineddl.CompleteMigration(m.ID, time.Now().Unix()), 0); err != nil {
+		return err
+	}
+	return e.qsc.ReloadSchema(ctx)
+}
+
+// cleanup stops the stream of a migration that stopped, and drops its
+// shadow table.
+func (e *OnlineDDLEngine) cleanup(vtClient binlogplayer.VtClient, m *onlineddl.Migration) error {
+	log.Infof("OnlineDDLEngine: cleaning up migration %v", m.UUID)
+	if m.VReplID != 0 {
+		if err := e.stopStream(vtClient, m); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		"DROP TABLE IF EXISTS " + sqlparser.String(sqlparser.NewTableIdent(onlineddl.ShadowTableName(m.UUID))),
+		onlineddl.ClearMigrationVReplID(m.ID),
+	} {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopStream deletes the stream of m, and waits until it's stopped.
+func (e *OnlineDDLEngine) stopStream(vtClient binlogplayer.VtClient, m *onlineddl.Migration) error {
+	for _, query := range []string{
+		binlogplayer.DeleteVReplication(m.VReplID),
+		binlogplayer.DeleteCopyState(m.VReplID, ""),
+	} {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	e.vre.StopStream(m.VReplID)
+	return nil
+}
+
+// waitForStreamPosition waits until the stream uid reaches pos.
+func waitForStreamPosition(ctx context.Context, vtClient binlogplayer.VtClient, uid uint32, pos mysql.Position) error {
+	for {
+		current, _, err := binlogplayer.ReadVReplicationPos(vtClient, uid)
+		if err != nil {
+			return err
+		}
+		currentPos, err := mysql.DecodePosition(current)
+		if err != nil {
+			return err
+		}
+		if currentPos.AtLeast(pos) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stream %v is at %v, it didn't reach %v: %v", uid, current, mysql.EncodePosition(pos), ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// readColumns returns the columns of table, in order.
+func readColumns(vtClient binlogplayer.VtClient, table string) ([]string, error) {
+	qr, err := vtClient.ExecuteFetch(fmt.Sprintf("SELECT column_name FROM information_schema.columns WHERE table_schema=database() AND table_name=%v ORDER BY ordinal_position", sqlparser.String(sqlparser.NewStrVal([]byte(table)))), 10000)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Rows) == 0 {
+		return nil, fmt.Errorf("table %v not found", table)
+	}
+	columns := make([]string, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		columns = append(columns, row[0].ToString())
+	}
+	return columns, nil
+}
+
+func truncateMessage(message string) string {
+	if len(message) > 1000 {
+		return message[:1000]
+	}
+	return message
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/mysqlctl/fakemysqldaemon"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
+	"vitess.io/vitess/go/vt/vttablet/tabletservermock"
+)
+
+// onlineDDLVtClient returns the results of the queries it knows, and
+// empty results for the others.
+type onlineDDLVtClient struct {
+	binlogplayer.VtClient
+	results map[string]*sqltypes.Result
+	onQuery func(query string)
+	log     []string
+}
+
+func (dc *onlineDDLVtClient) Connect() error { return nil }
+func (dc *onlineDDLVtClient) Close()         {}
+
+func (dc *onlineDDLVtClient) ExecuteFetch(query string, maxrows int) (*sqltypes.Result, error) {
+	dc.log = append(dc.log, query)
+	if dc.onQuery != nil {
+		dc.onQuery(query)
+	}
+	if qr, ok := dc.results[query]; ok {
+		return qr, nil
+	}
+	return &sqltypes.Result{}, nil
+}
+
+var migrationFields = sqltypes.MakeTestFields(
+	"id|migration_uuid|keyspace|shard|table_name|migration_statement|state|message|vrepl_id|retries|time_created|time_started|time_completed",
+	"uint64|varbinary|varbinary|varbinary|varbinary|text|varbinary|varbinary|uint32|uint32|uint64|uint64|uint64")
+
+const (
+	testMigrationUUID = "8d2f8b4c-c8f1-11e8-a8d5-f2801f1b9fd1"
+	testShadowTable   = "_vt_osc_8d2f8b4cc8f111e8a8d5f2801f1b9fd1_new"
+	testOldTable      = "_vt_osc_8d2f8b4cc8f111e8a8d5f2801f1b9fd1_old"
+)
+
+func migrationResult(state string, vreplID int) *sqltypes.Result {
+	return sqltypes.MakeTestResult(migrationFields,
+		fmt.Sprintf("1|%v|ks|0|user|alter table user drop column extra, add column c int|%v||%v|0|1234|0|0", testMigrationUUID, state, vreplID))
+}
+
+func newTestOnlineDDLEngine(dc *onlineDDLVtClient) (*OnlineDDLEngine, *tabletservermock.Controller) {
+	qsc := tabletservermock.NewController()
+	mysqld := &fakemysqldaemon.FakeMysqlDaemon{}
+	mysqld.CurrentMasterPosition, _ = mysql.DecodePosition("MariaDB/0-1-1234")
+	vre := NewVReplicationEngine(nil, nil, mysqld, func() binlogplayer.VtClient { return dc })
+	return NewOnlineDDLEngine(qsc, vre, mysqld, func() binlogplayer.VtClient { return dc }), qsc
+}
+
+func encodeSource(source *binlogplayer.BinlogSource) string {
+	return sqlparser.String(sqlparser.NewStrVal([]byte(source.String())))
+}
+
+// withoutCreateTable checks that the statements start by creating
+// _vt.schema_migrations and reading it, and returns the others.
+func withoutCreateTable(t *testing.T, log []string) []string {
+	t.Helper()
+	want := append(onlineddl.CreateSchemaMigrationsTable(), onlineddl.QueryMigrations())
+	if len(log) < len(want) || !reflect.DeepEqual(log[:len(want)], want) {
+		t.Fatalf("first statements: %v, want %v", log, want)
+	}
+	return log[len(want):]
+}
+
+func TestOnlineDDLStart(t *testing.T) {
+	dc := &onlineDDLVtClient{
+		results: map[string]*sqltypes.Result{
+			onlineddl.QueryMigrations(): migrationResult(onlineddl.StateQueued, 0),
+			"SELECT column_name FROM information_schema.columns WHERE table_schema=database() AND table_name='user' ORDER BY ordinal_position": sqltypes.MakeTestResult(
+				sqltypes.MakeTestFields("column_name", "varchar"), "id", "name", "extra"),
+			"SELECT column_name FROM information_schema.columns WHERE table_schema=database() AND table_name='" + testShadowTable + "' ORDER BY ordinal_position": sqltypes.MakeTestResult(
+				sqltypes.MakeTestFields("column_name", "varchar"), "id", "name", "c"),
+		},
+	}
+	e, _ := newTestOnlineDDLEngine(dc)
+	dc.onQuery = func(query string) {
+		if strings.HasPrefix(query, "INSERT INTO _vt.vreplication") {
+			dc.results[query] = &sqltypes.Result{InsertID: 5}
+		}
+	}
+	if err := e.check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream copies the columns the tables have in common.
+	log := withoutCreateTable(t, dc.log)
+	if len(log) != 11 {
+		t.Fatalf("statements: %v, want 11", log)
+	}
+	want := []string{
+		"DROP TABLE IF EXISTS " + testShadowTable,
+		"CREATE TABLE " + testShadowTable + " LIKE user",
+		"alter table " + testShadowTable + " drop column extra, add column c int",
+	}
+	if !reflect.DeepEqual(log[1:4], want) {
+		t.Errorf("shadow table statements:\n%q, want\n%q", log[1:4], want)
+	}
+	if !strings.HasPrefix(log[0], "UPDATE _vt.schema_migrations SET state='running', message='', time_started=") {
+		t.Errorf("first statement: %v, want the start of the migration", log[0])
+	}
+	source := &binlogplayer.BinlogSource{
+		Keyspace: "ks",
+		Shard:    "0",
+		Rules: []*binlogplayer.Rule{{
+			Match:  testShadowTable,
+			Filter: "select id, name from user",
+		}},
+	}
+	if want := fmt.Sprintf("VALUES ('online_ddl:%v', %v, '', '', 9223372036854775807, 10, ", testMigrationUUID, encodeSource(source)); !strings.Contains(log[6], want) || !strings.HasSuffix(log[6], "'Stopped')") {
+		t.Errorf("stream statement:\n%v, want\n%v", log[6], want)
+	}
+	want = []string{
+		"INSERT INTO _vt.copy_state (vrepl_id, table_name) VALUES (5, 'user')",
+		"UPDATE _vt.vreplication SET state='Running', message='' WHERE id=5",
+		"UPDATE _vt.schema_migrations SET vrepl_id=5 WHERE id=1",
+		"UPDATE _vt.schema_migrations SET message='copying rows' WHERE id=1",
+	}
+	if !reflect.DeepEqual(log[7:], want) {
+		t.Errorf("stream statements:\n%q, want\n%q", log[7:], want)
+	}
+}
+
+func TestOnlineDDLCutOver(t *testing.T) {
+	dc := &onlineDDLVtClient{
+		results: map[string]*sqltypes.Result{
+			onlineddl.QueryMigrations():                 migrationResult(onlineddl.StateRunning, 5),
+			onlineddl.QueryMigration(testMigrationUUID): migrationResult(onlineddl.StateRunning, 5),
+			binlogplayer.QueryVReplication(5): {Rows: [][]sqltypes.Value{{
+				sqltypes.NewVarBinary("MariaDB/0-1-1234"),
+				sqltypes.NewVarBinary(""),
+			}}},
+		},
+	}
+	e, qsc := newTestOnlineDDLEngine(dc)
+	blocked := false
+	dc.onQuery = func(query string) {
+		if strings.HasPrefix(query, "LOCK TABLES") {
+			blocked = qsc.GetQueryRules(onlineDDLQueryRules).Find("online_ddl_cutover") != nil
+		}
+	}
+	if err := e.check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !blocked {
+		t.Errorf("the queries of the table weren't blocked during the cut-over")
+	}
+	if qsc.GetQueryRules(onlineDDLQueryRules).Find("online_ddl_cutover") != nil {
+		t.Errorf("the queries of the table are still blocked after the cut-over")
+	}
+
+	// The copy is done, so the cut-over swaps the tables once the
+	// stream reached the position of the master. The table stays
+	// locked until it's renamed.
+	log := withoutCreateTable(t, dc.log)
+	want := []string{
+		binlogplayer.QueryCopyState(5),
+		"SET SESSION lock_wait_timeout=10",
+		"LOCK TABLES user WRITE",
+		binlogplayer.QueryVReplication(5),
+		onlineddl.QueryMigration(testMigrationUUID),
+		"DELETE FROM _vt.vreplication WHERE id=5",
+		"DELETE FROM _vt.copy_state WHERE vrepl_id=5",
+		"ALTER TABLE user RENAME " + testOldTable,
+		"UNLOCK TABLES",
+		"RENAME TABLE " + testShadowTable + " TO user",
+	}
+	if len(log) != len(want)+1 || !reflect.DeepEqual(log[:len(want)], want) {
+		t.Fatalf("statements:\n%q, want\n%q", log, want)
+	}
+	if !strings.HasPrefix(log[len(want)], "UPDATE _vt.schema_migrations SET state='complete', message='', vrepl_id=0, time_completed=") {
+		t.Errorf("last statement: %v, want the completion of the migration", log[len(want)])
+	}
+}
+
+func TestOnlineDDLCancel(t *testing.T) {
+	dc := &onlineDDLVtClient{
+		results: map[string]*sqltypes.Result{
+			onlineddl.QueryMigrations(): migrationResult(onlineddl.StateCancelled, 5),
+		},
+	}
+	e, _ := newTestOnlineDDLEngine(dc)
+	if err := e.check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stream and the shadow table of a cancelled migration are
+	// cleaned up.
+	want := []string{
+		"DELETE FROM _vt.vreplication WHERE id=5",
+		"DELETE FROM _vt.copy_state WHERE vrepl_id=5",
+		"DROP TABLE IF EXISTS " + testShadowTable,
+		"UPDATE _vt.schema_migrations SET vrepl_id=0 WHERE id=1",
+	}
+	if log := withoutCreateTable(t, dc.log); !reflect.DeepEqual(log, want) {
+		t.Errorf("statements:\n%q, want\n%q", log, want)
+	}
+}
@@ -48,10 +48,14 @@ func (agent *ActionAgent) RestoreData(ctx context.Context, logger logutil.Logger
 		return err
 	}
 	defer agent.unlock()
-	return agent.restoreDataLocked(ctx, logger, deleteBeforeRestore)
+	return agent.restoreDataLocked(ctx, logger, deleteBeforeRestore, mysqlctl.RestorePoint{})
 }
 
-func (agent *ActionAgent) restoreDataLocked(ctx context.Context, logger logutil.Logger, deleteBeforeRestore bool) error {
+// restoreDataLocked restores the most recent backup, or the most
+// recent backup before restorePoint, if set. A tablet restored to
+// restorePoint does not replicate, and is left DRAINED, so it does
+// not serve data that is behind its shard.
+func (agent *ActionAgent) restoreDataLocked(ctx context.Context, logger logutil.Logger, deleteBeforeRestore bool, restorePoint mysqlctl.RestorePoint) error {
 	// change type to RESTORE (using UpdateTabletFields so it's
 	// always authorized)
 	var originalType topodatapb.TabletType
@@ -75,12 +79,21 @@ func (agent *ActionAgent) restoreDataLocked(ctx context.Context, logger logutil.
 	localMetadata := agent.getLocalMetadataValues(originalType)
 	tablet := agent.Tablet()
 	dir := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
-	pos, err := mysqlctl.Restore(ctx, agent.MysqlDaemon, dir, *restoreConcurrency, agent.hookExtraEnv(), localMetadata, logger, deleteBeforeRestore, topoproto.TabletDbName(tablet))
+	pos, err := mysqlctl.Restore(ctx, agent.MysqlDaemon, dir, *restoreConcurrency, agent.hookExtraEnv(), localMetadata, logger, deleteBeforeRestore, topoproto.TabletDbName(tablet), restorePoint)
 	switch err {
 	case nil:
 		// Starting from here we won't be able to recover if we get stopped by a cancelled
 		// context. Thus we use the background context to get through to the finish.
 
+		if !restorePoint.IsZero() {
+			// Stay at the restore point: the replication
+			// reporter must not restart replication.
+			logger.Infof("Restored to %v at position %v, not starting replication", restorePoint, pos)
+			agent.setSlaveStopped(true)
+			originalType = topodatapb.TabletType_DRAINED
+			break
+		}
+
 		// Reconnect to master.
 		if err := agent.startReplication(context.Background(), pos, originalType); err != nil {
 			return err
@@ -98,7 +111,7 @@ func (agent *ActionAgent) restoreDataLocked(ctx context.Context, logger logutil.
 
 	// If we had type BACKUP or RESTORE it's better to set our type to the init_tablet_type to make result of the restore
 	// similar to completely clean start from scratch.
-	if (originalType == topodatapb.TabletType_BACKUP || originalType == topodatapb.TabletType_RESTORE) && *initTabletType != "" {
+	if (originalType == topodatapb.TabletType_BACKUP || originalType == topodatapb.TabletType_RESTORE) && *initTabletType != "" && restorePoint.IsZero() {
 		initType, err := topoproto.ParseTabletType(*initTabletType)
 		if err == nil {
 			originalType = initType
@@ -121,9 +121,9 @@ type RPCAgent interface {
 
 	// Backup / restore related methods
 
-	Backup(ctx context.Context, concurrency int, logger logutil.Logger) error
+	Backup(ctx context.Context, concurrency int, logger logutil.Logger, incremental bool) error
 
-	RestoreFromBackup(ctx context.Context, logger logutil.Logger) error
+	RestoreFromBackup(ctx context.Context, logger logutil.Logger, restoreToPos string, restoreToTimeNS int64) error
 
 	// HandleRPCPanic is to be called in a defer statement in each
 	// RPC input point.
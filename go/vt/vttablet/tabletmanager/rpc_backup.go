@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
+	"vitess.io/vitess/go/mysql"
 	"vitess.io/vitess/go/vt/logutil"
 	"vitess.io/vitess/go/vt/mysqlctl"
 	"vitess.io/vitess/go/vt/topo/topoproto"
@@ -29,21 +30,42 @@ import (
 	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
 )
 
-// Backup takes a db backup and sends it to the BackupStorage
-func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger) error {
+// Backup takes a db backup and sends it to the BackupStorage.
+// An incremental backup only copies the binlogs, and some backup
+// engines take hot backups, so these do not need to take the tablet
+// out of serving.
+func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger logutil.Logger, incremental bool) error {
 	if err := agent.lock(ctx); err != nil {
 		return err
 	}
 	defer agent.unlock()
 
-	// update our type to BACKUP
 	tablet, err := agent.TopoServer.GetTablet(ctx, agent.TabletAlias)
 	if err != nil {
 		return err
 	}
+
+	// create the loggers: tee to console and source
+	l := logutil.NewTeeLogger(logutil.NewConsoleLogger(), logger)
+
+	dir := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
+	name := fmt.Sprintf("%v.%v", time.Now().UTC().Format(mysqlctl.BackupTimestampFormat), topoproto.TabletAliasString(tablet.Alias))
+	if incremental {
+		return mysqlctl.Backup(ctx, agent.MysqlDaemon, l, dir, name, concurrency, agent.hookExtraEnv(), true /* incremental */)
+	}
+
 	if tablet.Type == topodatapb.TabletType_MASTER {
 		return fmt.Errorf("type MASTER cannot take backup, if you really need to do this, restart vttablet in replica mode")
 	}
+	engine, err := mysqlctl.GetBackupEngine()
+	if err != nil {
+		return err
+	}
+	if !engine.ShouldDrainForBackup() {
+		return mysqlctl.Backup(ctx, agent.MysqlDaemon, l, dir, name, concurrency, agent.hookExtraEnv(), false /* incremental */)
+	}
+
+	// update our type to BACKUP
 	originalType := tablet.Type
 	if _, err := topotools.ChangeType(ctx, agent.TopoServer, tablet.Alias, topodatapb.TabletType_BACKUP); err != nil {
 		return err
@@ -54,13 +76,8 @@ func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger lo
 		return err
 	}
 
-	// create the loggers: tee to console and source
-	l := logutil.NewTeeLogger(logutil.NewConsoleLogger(), logger)
-
 	// now we can run the backup
-	dir := fmt.Sprintf("%v/%v", tablet.Keyspace, tablet.Shard)
-	name := fmt.Sprintf("%v.%v", time.Now().UTC().Format("2006-01-02.150405"), topoproto.TabletAliasString(tablet.Alias))
-	returnErr := mysqlctl.Backup(ctx, agent.MysqlDaemon, l, dir, name, concurrency, agent.hookExtraEnv())
+	returnErr := mysqlctl.Backup(ctx, agent.MysqlDaemon, l, dir, name, concurrency, agent.hookExtraEnv(), false /* incremental */)
 
 	// change our type back to the original value
 	_, err = topotools.ChangeType(ctx, agent.TopoServer, tablet.Alias, originalType)
@@ -85,7 +102,24 @@ func (agent *ActionAgent) Backup(ctx context.Context, concurrency int, logger lo
 }
 
 // RestoreFromBackup deletes all local data and restores anew from the latest backup.
-func (agent *ActionAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger) error {
+// If restoreToPos or restoreToTimeNS is set, it restores the latest backup before
+// that point instead, and replays the archived binlogs up to that point.
+func (agent *ActionAgent) RestoreFromBackup(ctx context.Context, logger logutil.Logger, restoreToPos string, restoreToTimeNS int64) error {
+	var restorePoint mysqlctl.RestorePoint
+	if restoreToPos != "" && restoreToTimeNS != 0 {
+		return fmt.Errorf("cannot restore to both a position and a time")
+	}
+	if restoreToPos != "" {
+		pos, err := mysql.DecodePosition(restoreToPos)
+		if err != nil {
+			return err
+		}
+		restorePoint.Position = pos
+	}
+	if restoreToTimeNS != 0 {
+		restorePoint.Time = time.Unix(0, restoreToTimeNS)
+	}
+
 	if err := agent.lock(ctx); err != nil {
 		return err
 	}
@@ -103,7 +137,7 @@ func (agent *ActionAgent) RestoreFromBackup(ctx context.Context, logger logutil.
 	l := logutil.NewTeeLogger(logutil.NewConsoleLogger(), logger)
 
 	// now we can run restore
-	err = agent.restoreDataLocked(ctx, l, true /* deleteBeforeRestore */)
+	err = agent.restoreDataLocked(ctx, l, true /* deleteBeforeRestore */, restorePoint)
 
 	// re-run health check to be sure to capture any replication delay
 	agent.runHealthCheckLocked()
@@ -312,6 +312,33 @@ func (agent *ActionAgent) changeCallback(ctx context.Context, oldTablet, newTabl
 		}
 	}
 
+	// The streams of _vt.vreplication only run on the master.
+	if agent.VREngine != nil {
+		if newTablet.Type == topodatapb.TabletType_MASTER {
+			agent.VREngine.Open(agent.batchCtx, newTablet.Alias.Cell)
+		} else {
+			agent.VREngine.Close()
+		}
+	}
+
+	// The online schema changes only run on the master too.
+	if agent.OnlineDDLEngine != nil {
+		if newTablet.Type == topodatapb.TabletType_MASTER {
+			agent.OnlineDDLEngine.Open(agent.batchCtx)
+		} else {
+			agent.OnlineDDLEngine.Close()
+		}
+	}
+
+	// And so does the binlog archiving.
+	if agent.BinlogArchiver != nil {
+		if newTablet.Type == topodatapb.TabletType_MASTER {
+			agent.BinlogArchiver.Open(agent.batchCtx, fmt.Sprintf("%v/%v", newTablet.Keyspace, newTablet.Shard), agent.hookExtraEnv())
+		} else {
+			agent.BinlogArchiver.Close()
+		}
+	}
+
 	// Broadcast health changes to vtgate immediately.
 	if broadcastHealth {
 		agent.broadcastHealth()
@@ -0,0 +1,450 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+// This file handles the streams of the _vt.vreplication table, which
+// are filtered replication streams run by the master tablet.
+
+import (
+	"flag"
+	"fmt"
+	"math/rand" // not crypto-safe is OK here
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/stats"
+	"vitess.io/vitess/go/tb"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/mysqlctl"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	vreplicationRefreshInterval = flag.Duration("vreplication_refresh_interval", 10*time.Second, "how often the master reads _vt.vreplication to start or stop its streams")
+)
+
+// VReplicationEngine runs the streams of the _vt.vreplication table.
+// It is open while the tablet is a master. Streams are managed by
+// changing the table: a row in the binlogplayer.BlpRunning state is
+// a stream that runs, and the engine stops the streams whose rows are
+// deleted or change state. Changes are picked up every
+// vreplication_refresh_interval.
+type VReplicationEngine struct {
+	// Immutable, set at construction time.
+	ts              *topo.Server
+	tmc             tmclient.TabletManagerClient
+	vtClientFactory func() binlogplayer.VtClient
+	mysqld          mysqlctl.MysqlDaemon
+
+	// mu protects the following fields.
+	mu          sync.Mutex
+	cell        string
+	cancel      context.CancelFunc
+	done        chan struct{}
+	controllers map[uint32]*vreplicationController
+}
+
+// NewVReplicationEngine creates a new VReplicationEngine. It is not open.
+func NewVReplicationEngine(ts *topo.Server, tmc tmclient.TabletManagerClient, mysqld mysqlctl.MysqlDaemon, vtClientFactory func() binlogplayer.VtClient) *VReplicationEngine {
+	return &VReplicationEngine{
+		ts:              ts,
+		tmc:             tmc,
+		vtClientFactory: vtClientFactory,
+		mysqld:          mysqld,
+		controllers:     make(map[uint32]*vreplicationController),
+	}
+}
+
+// RegisterVReplicationEngine registers the varz for the engine.
+func RegisterVReplicationEngine(vre *VReplicationEngine) {
+	stats.Publish("VReplicationStreamCount", stats.IntFunc(func() int64 {
+		vre.mu.Lock()
+		defer vre.mu.Unlock()
+		return int64(len(vre.controllers))
+	}))
+	stats.Publish("VReplicationSecondsBehindMasterMap", stats.CountersFunc(func() map[string]int64 {
+		vre.mu.Lock()
+		defer vre.mu.Unlock()
+		result := make(map[string]int64, len(vre.controllers))
+		for id, ct := range vre.controllers {
+			result[fmt.Sprintf("%v", id)] = ct.blpStats.SecondsBehindMaster.Get()
+		}
+		return result
+	}))
+}
+
+// Open starts running the streams of the _vt.vreplication table,
+// reading from the tablets of cell. It does nothing if the engine
+// is already open.
+func (vre *VReplicationEngine) Open(ctx context.Context, cell string) {
+	vre.mu.Lock()
+	defer vre.mu.Unlock()
+	if vre.cancel != nil {
+		return
+	}
+	log.Infof("Opening VReplicationEngine")
+	vre.cell = cell
+	ctx, vre.cancel = context.WithCancel(ctx)
+	vre.done = make(chan struct{})
+	go vre.run(ctx)
+}
+
+// Close stops all the streams. It does nothing if the engine is
+// not open.
+func (vre *VReplicationEngine) Close() {
+	vre.mu.Lock()
+	if vre.cancel == nil {
+		vre.mu.Unlock()
+		return
+	}
+	log.Infof("Closing VReplicationEngine")
+	vre.cancel()
+	done := vre.done
+	vre.mu.Unlock()
+
+	// Wait for the refresh loop outside the lock, it needs it.
+	<-done
+
+	vre.mu.Lock()
+	defer vre.mu.Unlock()
+	for id, ct := range vre.controllers {
+		ct.Stop()
+		delete(vre.controllers, id)
+	}
+	vre.cancel = nil
+	vre.done = nil
+}
+
+// StopStream stops the stream id if it runs, and waits until it's
+// stopped. Its row must be deleted or stopped first, or the next
+// refresh starts it again.
+func (vre *VReplicationEngine) StopStream(id uint32) {
+	vre.mu.Lock()
+	defer vre.mu.Unlock()
+	if ct, ok := vre.controllers[id]; ok {
+		ct.Stop()
+		delete(vre.controllers, id)
+	}
+}
+
+// run refreshes the streams until ctx is canceled.
+func (vre *VReplicationEngine) run(ctx context.Context) {
+	defer close(vre.done)
+	initialized := false
+	for {
+		if !initialized {
+			if err := vre.createTable(); err != nil {
+				log.Errorf("VReplicationEngine: cannot create _vt.vreplication: %v", err)
+			} else {
+				initialized = true
+			}
+		}
+		if initialized {
+			if err := vre.refresh(ctx); err != nil {
+				log.Errorf("VReplicationEngine: cannot refresh streams: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*vreplicationRefreshInterval):
+		}
+	}
+}
+
+func (vre *VReplicationEngine) createTable() error {
+	vtClient := vre.vtClientFactory()
+	if err := vtClient.Connect(); err != nil {
+		return fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer vtClient.Close()
+
+	for _, query := range binlogplayer.CreateVReplicationTable() {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refresh reads _vt.vreplication, and starts or stops streams to
+// match it.
+func (vre *VReplicationEngine) refresh(ctx context.Context) error {
+	vtClient := vre.vtClientFactory()
+	if err := vtClient.Connect(); err != nil {
+		return fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer vtClient.Close()
+
+	qr, err := vtClient.ExecuteFetch(binlogplayer.QueryVReplicationStreams(), 10000)
+	if err != nil {
+		return err
+	}
+
+	vre.mu.Lock()
+	defer vre.mu.Unlock()
+
+	// Sources of the streams that should run.
+	sources := make(map[uint32]string)
+	for _, row := range qr.Rows {
+		id, err := sqltypes.ToUint64(row[0])
+		if err != nil {
+			return err
+		}
+		if row[2].ToString() != binlogplayer.BlpRunning {
+			continue
+		}
+		sources[uint32(id)] = row[1].ToString()
+	}
+
+	// Stop the streams that don't run any more, or whose
+	// source changed.
+	for id, ct := range vre.controllers {
+		if source, ok := sources[id]; ok && source == ct.source {
+			continue
+		}
+		ct.Stop()
+		delete(vre.controllers, id)
+	}
+
+	// Start the new ones.
+	for id, source := range sources {
+		if _, ok := vre.controllers[id]; ok {
+			continue
+		}
+		ct, err := newVReplicationController(ctx, vre.ts, vre.tmc, vre.vtClientFactory, vre.mysqld, vre.cell, id, source)
+		if err != nil {
+			// This stream cannot run, record why.
+			log.Errorf("VReplicationEngine: cannot start stream %v: %v", id, err)
+			if _, err := vtClient.ExecuteFetch(binlogplayer.SetVReplicationMessage(id, err.Error()), 0); err != nil {
+				log.Errorf("VReplicationEngine: cannot save message for stream %v: %v", id, err)
+			}
+			continue
+		}
+		vre.controllers[id] = ct
+	}
+	return nil
+}
+
+// vreplicationController runs one stream of _vt.vreplication. It
+// retries until the stream is stopped, or reaches its stop position.
+type vreplicationController struct {
+	// Immutable, set at construction time.
+	tmc             tmclient.TabletManagerClient
+	vtClientFactory func() binlogplayer.VtClient
+	mysqld          mysqlctl.MysqlDaemon
+	cell            string
+	id              uint32
+	source          string
+	binlogSource    *binlogplayer.BinlogSource
+	plan            *binlogplayer.StreamPlan
+	blpStats        *binlogplayer.Stats
+
+	// healthCheck, tabletStatsCache and shardReplicationWatcher
+	// find the source tablets.
+	healthCheck             discovery.HealthCheck
+	tabletStatsCache        *discovery.TabletStatsCache
+	shardReplicationWatcher *discovery.TopologyWatcher
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// newVReplicationController parses the source of a stream, and
+// starts running it.
+func newVReplicationController(ctx context.Context, ts *topo.Server, tmc tmclient.TabletManagerClient, vtClientFactory func() binlogplayer.VtClient, mysqld mysqlctl.MysqlDaemon, cell string, id uint32, source string) (*vreplicationController, error) {
+	binlogSource, err := binlogplayer.ParseBinlogSource(source)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := binlogplayer.BuildStreamPlan(binlogSource)
+	if err != nil {
+		return nil, err
+	}
+
+	healthCheck := discovery.NewHealthCheck(*healthcheckRetryDelay, *healthCheckTimeout)
+	ct := &vreplicationController{
+		tmc:                     tmc,
+		vtClientFactory:         vtClientFactory,
+		mysqld:                  mysqld,
+		cell:                    cell,
+		id:                      id,
+		source:                  source,
+		binlogSource:            binlogSource,
+		plan:                    plan,
+		blpStats:                binlogplayer.NewStats(),
+		healthCheck:             healthCheck,
+		tabletStatsCache:        discovery.NewTabletStatsCache(healthCheck, ts, cell),
+		shardReplicationWatcher: discovery.NewShardReplicationWatcher(ts, healthCheck, cell, binlogSource.Keyspace, binlogSource.Shard, *healthCheckTopologyRefresh, discovery.DefaultTopoReadConcurrency),
+		done:                    make(chan struct{}),
+	}
+	ctx, ct.cancel = context.WithCancel(ctx)
+	log.Infof("%v: starting", ct)
+	go ct.run(ctx)
+	return ct, nil
+}
+
+func (ct *vreplicationController) String() string {
+	return fmt.Sprintf("VReplication(%v: %v/%v)", ct.id, ct.binlogSource.Keyspace, ct.binlogSource.Shard)
+}
+
+// Stop stops the stream, and frees its resources.
+func (ct *vreplicationController) Stop() {
+	log.Infof("%v: stopping", ct)
+	ct.cancel()
+	<-ct.done
+	ct.shardReplicationWatcher.Stop()
+	ct.healthCheck.Close()
+}
+
+// run plays the stream, and retries after retryDelay on errors.
+func (ct *vreplicationController) run(ctx context.Context) {
+	defer close(ct.done)
+	for {
+		err := ct.runOnce(ctx)
+		if err == nil {
+			break
+		}
+		log.Warningf("%v: %v", ct, err)
+		ct.setMessage(err.Error())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*retryDelay):
+		}
+	}
+	log.Infof("%v: exited", ct)
+}
+
+// runOnce plays the stream until it's interrupted, reaches its stop
+// position, or an error occurs.
+func (ct *vreplicationController) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			log.Errorf("%v: caught panic: %v\n%s", ct, x, tb.Stack(4))
+			err = fmt.Errorf("panic: %v", x)
+		}
+	}()
+
+	// Apply any special settings necessary for playback of binlogs.
+	// We do it on every iteration to be sure, in case MySQL was restarted.
+	// They are not disabled when the stream stops, as BinlogPlayerMap
+	// may need them too.
+	if err := ct.mysqld.EnableBinlogPlayback(); err != nil {
+		return err
+	}
+
+	vtClient := ct.vtClientFactory()
+	if err := vtClient.Connect(); err != nil {
+		return fmt.Errorf("can't connect to database: %v", err)
+	}
+	defer vtClient.Close()
+
+	tablet, err := pickSourceTablet(ctx, ct.tabletStatsCache, ct.cell, ct.binlogSource.Keyspace, ct.binlogSource.Shard)
+	if err != nil {
+		return err
+	}
+
+	copyState, err := binlogplayer.ReadCopyState(vtClient, ct.id)
+	if err != nil {
+		return err
+	}
+	if len(copyState) != 0 {
+		if err := ct.runCopy(ctx, vtClient, tablet, copyState); err != nil {
+			if ctx.Err() != nil {
+				// We were stopped, the copy resumes
+				// from its last chunk.
+				return nil
+			}
+			return err
+		}
+	}
+
+	startPosition, stopPosition, err := binlogplayer.ReadVReplicationPos(vtClient, ct.id)
+	if err != nil {
+		return err
+	}
+
+	player, err := binlogplayer.NewBinlogPlayerStream(vtClient, tablet, ct.plan, ct.id, startPosition, stopPosition, ct.blpStats)
+	if err != nil {
+		return fmt.Errorf("NewBinlogPlayerStream failed: %v", err)
+	}
+	if err := player.ApplyBinlogEvents(ctx); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		// We were stopped.
+		return nil
+	}
+
+	// We reached the stop position, so the stream is done.
+	if _, err := vtClient.ExecuteFetch(binlogplayer.SetVReplicationState(ct.id, binlogplayer.BlpStopped, "Reached stopping position"), 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ct *vreplicationController) setMessage(message string) {
+	vtClient := ct.vtClientFactory()
+	if err := vtClient.Connect(); err != nil {
+		log.Errorf("%v: can't connect to database: %v", ct, err)
+		return
+	}
+	defer vtClient.Close()
+	if _, err := vtClient.ExecuteFetch(binlogplayer.SetVReplicationMessage(ct.id, message), 0); err != nil {
+		log.Errorf("%v: cannot save message: %v", ct, err)
+	}
+}
+
+// pickSourceTablet waits for a healthy tablet of one of the
+// binlog_player_tablet_type types in keyspace/shard, and returns
+// one of them at random.
+func pickSourceTablet(ctx context.Context, tsc *discovery.TabletStatsCache, cell, keyspace, shard string) (*topodatapb.Tablet, error) {
+	sourceTabletTypes, err := topoproto.ParseTabletTypes(*sourceTabletTypeStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse list of source tablet types: %v", *sourceTabletTypeStr)
+	}
+
+	// wait for any of required the tablets (useful for the first run at least, fast for next runs)
+	if err := tsc.WaitForAnyTablet(ctx, cell, keyspace, shard, sourceTabletTypes); err != nil {
+		return nil, fmt.Errorf("error waiting for tablets for %v %v/%v %v: %v", cell, keyspace, shard, sourceTabletTypes, err)
+	}
+
+	// Find the server list from the health check.
+	// Note: We cannot use tsc.GetHealthyTabletStats() here because it does
+	// not return non-serving tablets. We must include non-serving tablets because
+	// REPLICA source tablets may not be serving anymore because their traffic was
+	// already migrated to the destination shards.
+	for _, sourceTabletType := range sourceTabletTypes {
+		addrs := discovery.RemoveUnhealthyTablets(tsc.GetTabletStats(keyspace, shard, sourceTabletType))
+		if len(addrs) > 0 {
+			return addrs[rand.Intn(len(addrs))].Tablet, nil
+		}
+	}
+	return nil, fmt.Errorf("can't find any healthy source tablet for %v %v/%v %v", cell, keyspace, shard, sourceTabletTypes)
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+// This file handles the copy phase of the streams of _vt.vreplication,
+// see binlogplayer.CreateVReplicationCopy.
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/golang/glog"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/grpcclient"
+	"vitess.io/vitess/go/vt/throttler"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+	"vitess.io/vitess/go/vt/vttablet/tabletconn"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+var (
+	vreplicationCopyChunkSize = flag.Int("vreplication_copy_chunk_size", 1000, "number of rows a vreplication stream copies at a time, before catching up with the changes of the source")
+)
+
+// runCopy copies the tables of copyState from the source tablet, in
+// chunks of rows read in primary key order. The stream starts from
+// the position of the source when the copy started. Each chunk is
+// read along with the position of the source it has the values of:
+// the stream catches up with that position, for the rows already
+// copied only, and the chunk is then saved with the position, so
+// that every copied row is at the position of the stream. The copy
+// resumes where it stopped if it's interrupted. runCopy returns once
+// all the tables are copied.
+//
+// Each chunk is a transaction throttled by the max_tps and
+// max_replication_lag settings of the stream. The replication lag is
+// the one of the source tablets: for a stream that copies within its
+// own shard, like an online schema change, they're the replicas that
+// apply the copy.
+func (ct *vreplicationController) runCopy(ctx context.Context, vtClient binlogplayer.VtClient, tablet *topodatapb.Tablet, copyState map[string]string) error {
+	startPosition, _, err := binlogplayer.ReadVReplicationPos(vtClient, ct.id)
+	if err != nil {
+		return err
+	}
+	if startPosition == "" {
+		pos, err := sourcePosition(ctx, ct.tmc, tablet)
+		if err != nil {
+			return err
+		}
+		log.Infof("%v: starting copy at %v", ct, pos)
+		if _, err := vtClient.ExecuteFetch(binlogplayer.SetVReplicationPos(ct.id, pos, time.Now().Unix()), 0); err != nil {
+			return err
+		}
+	}
+
+	tables := make([]string, 0, len(copyState))
+	for table := range copyState {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	sd, err := ct.tmc.GetSchema(ctx, tablet, tables, nil, false)
+	if err != nil {
+		return err
+	}
+	pkColumns := make(map[string][]string, len(tables))
+	for _, td := range sd.TableDefinitions {
+		pkColumns[td.Name] = td.PrimaryKeyColumns
+	}
+	for _, table := range tables {
+		if len(pkColumns[table]) == 0 {
+			return fmt.Errorf("table %v has no primary key on %v, it cannot be copied", table, tablet.Alias)
+		}
+	}
+
+	conn, err := tabletconn.GetDialer()(tablet, grpcclient.FailFast(false))
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	maxTPS, maxReplicationLag, err := binlogplayer.ReadVReplicationThrottlerSettings(vtClient, ct.id)
+	if err != nil {
+		return err
+	}
+	t, err := throttler.NewThrottler(fmt.Sprintf("VReplicationCopy/%d", ct.id), "transactions", 1 /* threadCount */, maxTPS, maxReplicationLag)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate throttler: %v", err)
+	}
+	defer t.Close()
+
+	for _, table := range tables {
+		log.Infof("%v: copying table %v", ct, table)
+		for {
+			if err := ct.throttleCopy(ctx, t); err != nil {
+				return err
+			}
+			done, err := ct.copyChunk(ctx, vtClient, conn, tablet, table, pkColumns, copyState)
+			if err != nil {
+				return err
+			}
+			if done {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// catchup plays the stream up to stopPosition, for the rows already
+// copied.
+func (ct *vreplicationController) catchup(ctx context.Context, vtClient binlogplayer.VtClient, tablet *topodatapb.Tablet, copyState map[string]string, pkColumns map[string][]string, stopPosition string) error {
+	plan, err := binlogplayer.BuildStreamPlan(ct.binlogSource)
+	if err != nil {
+		return err
+	}
+	for table, lastPK := range copyState {
+		if err := plan.SetCopyState(table, pkColumns[table], lastPK); err != nil {
+			return err
+		}
+	}
+
+	startPosition, _, err := binlogplayer.ReadVReplicationPos(vtClient, ct.id)
+	if err != nil {
+		return err
+	}
+	player, err := binlogplayer.NewBinlogPlayerStream(vtClient, tablet, plan, ct.id, startPosition, stopPosition, ct.blpStats)
+	if err != nil {
+		return fmt.Errorf("NewBinlogPlayerStream failed: %v", err)
+	}
+	if err := player.ApplyBinlogEvents(ctx); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// copyChunk copies the next chunk of rows of table, once the stream
+// caught up with the position of the chunk, and saves the progress
+// along with that position in the same transaction. It returns true
+// once the table is copied.
+func (ct *vreplicationController) copyChunk(ctx context.Context, vtClient binlogplayer.VtClient, conn queryservice.QueryService, tablet *topodatapb.Tablet, table string, pkColumns map[string][]string, copyState map[string]string) (bool, error) {
+	plan, err := binlogplayer.BuildStreamPlan(ct.binlogSource)
+	if err != nil {
+		return false, err
+	}
+	query := binlogplayer.CopyChunkQuery(table, pkColumns[table], copyState[table], *vreplicationCopyChunkSize)
+	qr, pos, err := ct.readChunk(ctx, conn, tablet, query)
+	if err != nil {
+		return false, fmt.Errorf("cannot read rows of %v: %v", table, err)
+	}
+	queries, err := plan.InsertRows(table, qr.Fields, qr.Rows)
+	if err != nil {
+		return false, err
+	}
+
+	done := len(qr.Rows) < *vreplicationCopyChunkSize
+	lastPK := ""
+	if done {
+		queries = append(queries, binlogplayer.DeleteCopyState(ct.id, table))
+	} else {
+		lastPK, err = binlogplayer.EncodeLastPK(qr.Fields, qr.Rows[len(qr.Rows)-1], pkColumns[table])
+		if err != nil {
+			return false, err
+		}
+		queries = append(queries, binlogplayer.UpdateCopyState(ct.id, table, lastPK))
+	}
+	queries = append(queries, binlogplayer.SetVReplicationPos(ct.id, pos, time.Now().Unix()))
+
+	if err := ct.catchup(ctx, vtClient, tablet, copyState, pkColumns, pos); err != nil {
+		return false, err
+	}
+
+	if err := vtClient.Begin(); err != nil {
+		return false, err
+	}
+	for _, query := range queries {
+		if _, err := vtClient.ExecuteFetch(query, 0); err != nil {
+			vtClient.Rollback()
+			return false, err
+		}
+	}
+	if err := vtClient.Commit(); err != nil {
+		return false, err
+	}
+
+	if done {
+		delete(copyState, table)
+	} else {
+		copyState[table] = lastPK
+	}
+	return done, nil
+}
+
+// readChunk reads a chunk of rows from the source tablet with query,
+// along with the position of the source they have the values of. On
+// a master, the rows are read with a locking read in a transaction,
+// which blocks their changes until the position is read. On the other
+// tablets, the replication stops while the rows are read.
+func (ct *vreplicationController) readChunk(ctx context.Context, conn queryservice.QueryService, tablet *topodatapb.Tablet, query string) (*sqltypes.Result, string, error) {
+	target := &querypb.Target{
+		Keyspace:   tablet.Keyspace,
+		Shard:      tablet.Shard,
+		TabletType: tablet.Type,
+	}
+	if tablet.Type == topodatapb.TabletType_MASTER {
+		transactionID, err := conn.Begin(ctx, target, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		defer conn.Rollback(ctx, target, transactionID)
+		qr, err := conn.Execute(ctx, target, query+" lock in share mode", nil, transactionID, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		pos, err := ct.tmc.MasterPosition(ctx, tablet)
+		if err != nil {
+			return nil, "", err
+		}
+		return qr, pos, nil
+	}
+
+	if err := ct.tmc.StopSlave(ctx, tablet); err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err := ct.tmc.StartSlave(ctx, tablet); err != nil {
+			log.Errorf("%v: cannot restart the replication of %v: %v", ct, tablet.Alias, err)
+		}
+	}()
+	status, err := ct.tmc.SlaveStatus(ctx, tablet)
+	if err != nil {
+		return nil, "", err
+	}
+	qr, err := conn.Execute(ctx, target, query, nil, 0, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return qr, status.Position, nil
+}
+
+// throttleCopy records the replication lag of the source tablets,
+// and blocks until t lets the next chunk go.
+func (ct *vreplicationController) throttleCopy(ctx context.Context, t *throttler.Throttler) error {
+	for _, tabletType := range []topodatapb.TabletType{topodatapb.TabletType_REPLICA, topodatapb.TabletType_RDONLY} {
+		for _, ts := range ct.tabletStatsCache.GetTabletStats(ct.binlogSource.Keyspace, ct.binlogSource.Shard, tabletType) {
+			ts := ts
+			t.RecordReplicationLag(time.Now(), &ts)
+		}
+	}
+	for {
+		backoff := t.Throttle(0 /* threadID */)
+		if backoff == throttler.NotThrottled {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// sourcePosition returns the current replication position of tablet.
+func sourcePosition(ctx context.Context, tmc tmclient.TabletManagerClient, tablet *topodatapb.Tablet) (string, error) {
+	if tablet.Type == topodatapb.TabletType_MASTER {
+		return tmc.MasterPosition(ctx, tablet)
+	}
+	status, err := tmc.SlaveStatus(ctx, tablet)
+	if err != nil {
+		return "", err
+	}
+	return status.Position, nil
+}
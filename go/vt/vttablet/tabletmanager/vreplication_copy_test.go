@@ -0,0 +1,267 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"flag"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/discovery"
+	"vitess.io/vitess/go/vt/grpcclient"
+	"vitess.io/vitess/go/vt/vttablet/queryservice"
+	"vitess.io/vitess/go/vt/vttablet/queryservice/fakes"
+	"vitess.io/vitess/go/vt/vttablet/tabletconn"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	replicationdatapb "vitess.io/vitess/go/vt/proto/replicationdata"
+	tabletmanagerdatapb "vitess.io/vitess/go/vt/proto/tabletmanagerdata"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+// copyTMC is the source tablet of the copy, it doesn't move.
+type copyTMC struct {
+	tmclient.TabletManagerClient
+	position string
+	log      []string
+}
+
+// SlaveStatus is part of the tmclient.TabletManagerClient interface.
+func (tmc *copyTMC) SlaveStatus(ctx context.Context, tablet *topodatapb.Tablet) (*replicationdatapb.Status, error) {
+	tmc.log = append(tmc.log, "SlaveStatus")
+	return &replicationdatapb.Status{Position: tmc.position}, nil
+}
+
+// MasterPosition is part of the tmclient.TabletManagerClient interface.
+func (tmc *copyTMC) MasterPosition(ctx context.Context, tablet *topodatapb.Tablet) (string, error) {
+	tmc.log = append(tmc.log, "MasterPosition")
+	return tmc.position, nil
+}
+
+// StopSlave is part of the tmclient.TabletManagerClient interface.
+func (tmc *copyTMC) StopSlave(ctx context.Context, tablet *topodatapb.Tablet) error {
+	tmc.log = append(tmc.log, "StopSlave")
+	return nil
+}
+
+// StartSlave is part of the tmclient.TabletManagerClient interface.
+func (tmc *copyTMC) StartSlave(ctx context.Context, tablet *topodatapb.Tablet) error {
+	tmc.log = append(tmc.log, "StartSlave")
+	return nil
+}
+
+// GetSchema is part of the tmclient.TabletManagerClient interface.
+func (tmc *copyTMC) GetSchema(ctx context.Context, tablet *topodatapb.Tablet, tables, excludeTables []string, includeViews bool) (*tabletmanagerdatapb.SchemaDefinition, error) {
+	return &tabletmanagerdatapb.SchemaDefinition{
+		TableDefinitions: []*tabletmanagerdatapb.TableDefinition{{
+			Name:              "user",
+			PrimaryKeyColumns: []string{"id"},
+		}},
+	}, nil
+}
+
+// copyTabletConn returns the rows of the copied table.
+type copyTabletConn struct {
+	queryservice.QueryService
+	queries []string
+	results map[string]*sqltypes.Result
+}
+
+// Begin is part of the queryservice.QueryService interface.
+func (conn *copyTabletConn) Begin(ctx context.Context, target *querypb.Target, options *querypb.ExecuteOptions) (int64, error) {
+	conn.queries = append(conn.queries, "begin")
+	return 1, nil
+}
+
+// Rollback is part of the queryservice.QueryService interface.
+func (conn *copyTabletConn) Rollback(ctx context.Context, target *querypb.Target, transactionID int64) error {
+	conn.queries = append(conn.queries, "rollback")
+	return nil
+}
+
+// Execute is part of the queryservice.QueryService interface.
+func (conn *copyTabletConn) Execute(ctx context.Context, target *querypb.Target, sql string, bindVariables map[string]*querypb.BindVariable, transactionID int64, options *querypb.ExecuteOptions) (*sqltypes.Result, error) {
+	conn.queries = append(conn.queries, sql)
+	return conn.results[strings.TrimSuffix(sql, " lock in share mode")], nil
+}
+
+// copyVtClient is the target database of the copy.
+type copyVtClient struct {
+	position string
+	log      []string
+}
+
+func (dc *copyVtClient) Connect() error { return nil }
+func (dc *copyVtClient) Close()         {}
+
+func (dc *copyVtClient) Begin() error {
+	dc.log = append(dc.log, "BEGIN")
+	return nil
+}
+
+func (dc *copyVtClient) Commit() error {
+	dc.log = append(dc.log, "COMMIT")
+	return nil
+}
+
+func (dc *copyVtClient) Rollback() error {
+	dc.log = append(dc.log, "ROLLBACK")
+	return nil
+}
+
+func (dc *copyVtClient) ExecuteFetch(query string, maxrows int) (*sqltypes.Result, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT pos, stop_pos"):
+		return &sqltypes.Result{Rows: [][]sqltypes.Value{{
+			sqltypes.NewVarBinary(dc.position),
+			sqltypes.NewVarBinary(""),
+		}}}, nil
+	case strings.HasPrefix(query, "SELECT max_tps"):
+		return mockedThrottlerSettings, nil
+	case strings.HasPrefix(query, "UPDATE _vt.vreplication SET pos="):
+		dc.position = "MariaDB/0-1-1234"
+	}
+	dc.log = append(dc.log, query)
+	return &sqltypes.Result{}, nil
+}
+
+func TestVReplicationCopy(t *testing.T) {
+	defer func(chunkSize int) { *vreplicationCopyChunkSize = chunkSize }(*vreplicationCopyChunkSize)
+	*vreplicationCopyChunkSize = 2
+
+	fields := sqltypes.MakeTestFields("id|name|extra", "int64|varchar|int64")
+	conn := &copyTabletConn{
+		QueryService: fakes.ErrorQueryService,
+		results: map[string]*sqltypes.Result{
+			"select * from user order by id limit 2":                  sqltypes.MakeTestResult(fields, "1|a|1", "4|b|1"),
+			"select * from user where (id) > (4) order by id limit 2": sqltypes.MakeTestResult(fields, "2|c|1"),
+		},
+	}
+	tabletconn.RegisterDialer("test_vreplication_copy", func(tablet *topodatapb.Tablet, failFast grpcclient.FailFast) (queryservice.QueryService, error) {
+		return conn, nil
+	})
+	flag.Set("tablet_protocol", "test_vreplication_copy")
+
+	tmc := &copyTMC{position: "MariaDB/0-1-1234"}
+	ct := &vreplicationController{
+		tmc: tmc,
+		id:  1,
+		binlogSource: &binlogplayer.BinlogSource{
+			Keyspace: "source",
+			Shard:    "0",
+			Rules: []*binlogplayer.Rule{{
+				Match:  "target",
+				Filter: "select id, name as user_name from user where in_keyrange(id, 'hash', '-80')",
+			}},
+		},
+		blpStats:         binlogplayer.NewStats(),
+		tabletStatsCache: discovery.NewTabletStatsCacheDoNotSetListener(nil, "cell1"),
+	}
+	tablet := &topodatapb.Tablet{
+		Alias:    &topodatapb.TabletAlias{Cell: "cell1", Uid: 100},
+		Keyspace: "source",
+		Shard:    "0",
+		Type:     topodatapb.TabletType_RDONLY,
+	}
+	vtClient := &copyVtClient{}
+	copyState := map[string]string{"user": ""}
+	if err := ct.runCopy(context.Background(), vtClient, tablet, copyState); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source doesn't move, so catching up is a no-op. hash(1)
+	// and hash(2) are in -80, hash(4) is not. Each chunk is saved
+	// with the position it was read at.
+	setPos := "UPDATE _vt.vreplication SET pos='MariaDB/0-1-1234', time_updated=0 WHERE id=1"
+	want := []string{
+		setPos,
+		"BEGIN",
+		"insert into target(id, user_name) values (1, 'a')",
+		"UPDATE _vt.copy_state SET lastpk='(4)' WHERE vrepl_id=1 AND table_name='user'",
+		setPos,
+		"COMMIT",
+		"BEGIN",
+		"insert into target(id, user_name) values (2, 'c')",
+		"DELETE FROM _vt.copy_state WHERE vrepl_id=1 AND table_name='user'",
+		setPos,
+		"COMMIT",
+	}
+	if got := withoutTimeUpdated(vtClient.log); !reflect.DeepEqual(got, want) {
+		t.Errorf("statements:\n%q, want\n%q", got, want)
+	}
+	if len(copyState) != 0 {
+		t.Errorf("copyState: %v, want empty", copyState)
+	}
+	if want := []string{
+		"select * from user order by id limit 2",
+		"select * from user where (id) > (4) order by id limit 2",
+	}; !reflect.DeepEqual(conn.queries, want) {
+		t.Errorf("source queries: %v, want %v", conn.queries, want)
+	}
+	// The replication of the rdonly tablet stops while each chunk
+	// is read.
+	if want := []string{
+		"SlaveStatus",
+		"StopSlave", "SlaveStatus", "StartSlave",
+		"StopSlave", "SlaveStatus", "StartSlave",
+	}; !reflect.DeepEqual(tmc.log, want) {
+		t.Errorf("source calls: %v, want %v", tmc.log, want)
+	}
+
+	// A copy that was interrupted resumes after its last chunk.
+	conn.queries = nil
+	vtClient.log = nil
+	if err := ct.runCopy(context.Background(), vtClient, tablet, map[string]string{"user": "(4)"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"select * from user where (id) > (4) order by id limit 2"}; !reflect.DeepEqual(conn.queries, want) {
+		t.Errorf("source queries: %v, want %v", conn.queries, want)
+	}
+
+	// A master locks the rows of each chunk in a transaction while
+	// its position is read.
+	conn.queries = nil
+	tmc.log = nil
+	tablet.Type = topodatapb.TabletType_MASTER
+	if err := ct.runCopy(context.Background(), vtClient, tablet, map[string]string{"user": "(4)"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"begin", "select * from user where (id) > (4) order by id limit 2 lock in share mode", "rollback"}; !reflect.DeepEqual(conn.queries, want) {
+		t.Errorf("source queries: %v, want %v", conn.queries, want)
+	}
+	if want := []string{"MasterPosition"}; !reflect.DeepEqual(tmc.log, want) {
+		t.Errorf("source calls: %v, want %v", tmc.log, want)
+	}
+}
+
+var timeUpdatedRegexp = regexp.MustCompile(`time_updated=[0-9]+`)
+
+// withoutTimeUpdated returns the statements with a zero time_updated.
+func withoutTimeUpdated(log []string) []string {
+	result := make([]string, len(log))
+	for i, query := range log {
+		result[i] = timeUpdatedRegexp.ReplaceAllString(query, "time_updated=0")
+	}
+	return result
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tabletmanager
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/mysqlctl/fakemysqldaemon"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+
+	binlogdatapb "vitess.io/vitess/go/vt/proto/binlogdata"
+	querypb "vitess.io/vitess/go/vt/proto/query"
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+)
+
+func TestVReplicationEngine(t *testing.T) {
+	// The test refreshes the streams by hand.
+	*vreplicationRefreshInterval = time.Hour
+
+	ts := memorytopo.NewServer("cell1")
+	ctx := context.Background()
+	if err := ts.CreateKeyspace(ctx, "source", &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace failed: %v", err)
+	}
+	if err := ts.CreateShard(ctx, "source", "0"); err != nil {
+		t.Fatalf("CreateShard failed: %v", err)
+	}
+
+	// create one replica remote tablet in the source shard.
+	createSourceTablet(t, "test_vreplication", ts, "source", "0")
+
+	// register a binlog player factory that will return the instances
+	// we want
+	clientSyncChannel := make(chan *fakeBinlogClient)
+	binlogplayer.RegisterClientFactory("test_vreplication", func() binlogplayer.Client {
+		return <-clientSyncChannel
+	})
+	flag.Set("binlog_player_protocol", "test_vreplication")
+
+	mysqlDaemon := &fakemysqldaemon.FakeMysqlDaemon{MysqlPort: 3306}
+	vtClientSyncChannel := make(chan *binlogplayer.VtClientMock)
+	vre := NewVReplicationEngine(ts, nil, mysqlDaemon, func() binlogplayer.VtClient {
+		return <-vtClientSyncChannel
+	})
+	vre.Open(ctx, "cell1")
+
+	// The engine creates the table, then reads the streams.
+	createClient := binlogplayer.NewVtClientMock()
+	createClient.AddResult(&sqltypes.Result{})
+	vtClientSyncChannel <- createClient
+
+	source := &binlogplayer.BinlogSource{
+		Keyspace: "source",
+		Shard:    "0",
+		Rules: []*binlogplayer.Rule{{
+			Match:  "target",
+			Filter: "select id, name as user_name from user where in_keyrange(id, 'hash', '-80')",
+		}},
+	}
+	refreshClient := binlogplayer.NewVtClientMock()
+	refreshClient.AddResult(&sqltypes.Result{
+		Rows: [][]sqltypes.Value{{
+			sqltypes.NewInt64(1),
+			sqltypes.NewVarBinary(source.String()),
+			sqltypes.NewVarBinary(binlogplayer.BlpRunning),
+		}, {
+			sqltypes.NewInt64(2),
+			sqltypes.NewVarBinary(source.String()),
+			sqltypes.NewVarBinary(binlogplayer.BlpStopped),
+		}},
+	})
+	vtClientSyncChannel <- refreshClient
+	if want := binlogplayer.CreateVReplicationTable(); !reflect.DeepEqual(createClient.Stdout, want) {
+		t.Errorf("create statements: %v, want %v", createClient.Stdout, want)
+	}
+
+	// The stream reads its copy state, which is empty, then its
+	// position and its throttler settings.
+	streamClient := binlogplayer.NewVtClientMock()
+	streamClient.AddResult(&sqltypes.Result{})
+	streamClient.AddResult(&sqltypes.Result{
+		RowsAffected: 1,
+		Rows: [][]sqltypes.Value{{
+			sqltypes.NewVarBinary("MariaDB/0-1-1234"),
+			sqltypes.NewVarBinary(""),
+		}},
+	})
+	streamClient.AddResult(mockedThrottlerSettings)
+	streamClient.CommitChannel = make(chan []string)
+	vtClientSyncChannel <- streamClient
+	if !mysqlDaemon.BinlogPlayerEnabled {
+		t.Errorf("mysqlDaemon.BinlogPlayerEnabled should be true")
+	}
+	if want := []string{binlogplayer.QueryVReplicationStreams()}; !reflect.DeepEqual(refreshClient.Stdout, want) {
+		t.Errorf("refresh statements: %v, want %v", refreshClient.Stdout, want)
+	}
+
+	// The stream then connects to the source tablet, and streams
+	// the tables of its rules.
+	fbc := newFakeBinlogClient(t, 100)
+	fbc.expectedTables = "user"
+	clientSyncChannel <- fbc
+
+	// hash(1) is in -80, hash(4) is not.
+	fbc.tablesChannel <- &binlogdatapb.BinlogTransaction{
+		Statements: []*binlogdatapb.BinlogTransaction_Statement{{
+			Category: binlogdatapb.BinlogTransaction_Statement_BL_SET,
+			Sql:      []byte("SET TIMESTAMP=72"),
+		}, {
+			Category: binlogdatapb.BinlogTransaction_Statement_BL_INSERT,
+			Sql:      []byte("INSERT INTO user SET id=1, name='a', extra=2"),
+		}, {
+			Category: binlogdatapb.BinlogTransaction_Statement_BL_INSERT,
+			Sql:      []byte("INSERT INTO user SET id=4, name='b', extra=2"),
+		}},
+		EventToken: &querypb.EventToken{
+			Timestamp: 72,
+			Position:  "MariaDB/0-1-1235",
+		},
+	}
+	sql := <-streamClient.CommitChannel
+	if len(sql) != 8 ||
+		sql[0] != "SELECT table_name, lastpk FROM _vt.copy_state WHERE vrepl_id=1" ||
+		sql[1] != "SELECT pos, stop_pos FROM _vt.vreplication WHERE id=1" ||
+		sql[2] != "SELECT max_tps, max_replication_lag FROM _vt.vreplication WHERE id=1" ||
+		sql[3] != "BEGIN" ||
+		!strings.HasPrefix(sql[4], "UPDATE _vt.vreplication SET pos='MariaDB/0-1-1235', time_updated=") ||
+		!strings.HasSuffix(sql[4], ", transaction_timestamp=72 WHERE id=1") ||
+		sql[5] != "SET TIMESTAMP=72" ||
+		sql[6] != "insert into target(id, user_name) values (1, 'a')" ||
+		sql[7] != "COMMIT" {
+		t.Errorf("Got wrong SQL: %#v", sql)
+	}
+
+	// Closing the engine stops the stream.
+	vre.Close()
+	if len(vre.controllers) != 0 {
+		t.Errorf("controllers: %v, want none", vre.controllers)
+	}
+}
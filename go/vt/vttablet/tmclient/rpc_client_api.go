@@ -199,11 +199,14 @@ type TabletManagerClient interface {
 	// Backup / restore related methods
 	//
 
-	// Backup creates a database backup
-	Backup(ctx context.Context, tablet *topodatapb.Tablet, concurrency int) (logutil.EventStream, error)
-
-	// RestoreFromBackup deletes local data and restores database from backup
-	RestoreFromBackup(ctx context.Context, tablet *topodatapb.Tablet) (logutil.EventStream, error)
+	// Backup creates a database backup. If incremental is set, it only
+	// backs up the binlogs since the previous backup.
+	Backup(ctx context.Context, tablet *topodatapb.Tablet, concurrency int, incremental bool) (logutil.EventStream, error)
+
+	// RestoreFromBackup deletes local data and restores database from backup.
+	// If restoreToPos or restoreToTimeNS is set, it restores the backup
+	// before that point, and replays the archived binlogs up to it.
+	RestoreFromBackup(ctx context.Context, tablet *topodatapb.Tablet, restoreToPos string, restoreToTimeNS int64) (logutil.EventStream, error)
 
 	//
 	// Management methods
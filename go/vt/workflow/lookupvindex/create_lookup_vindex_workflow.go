@@ -0,0 +1,281 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lookupvindex contains a workflow that backfills a lookup
+// vindex added to a populated table: it creates the lookup table,
+// populates it from the owner table with vreplication streams, which
+// also apply the changes made during the copy, and then makes the
+// vindex owned by the table.
+package lookupvindex
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/logutil"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vttablet/tmclient"
+	"vitess.io/vitess/go/vt/workflow"
+	"vitess.io/vitess/go/vt/workflow/resharding"
+	"vitess.io/vitess/go/vt/wrangler"
+
+	workflowpb "vitess.io/vitess/go/vt/proto/workflow"
+)
+
+const (
+	codeVersion = 1
+
+	createLookupVindexFactoryName = "create_lookup_vindex"
+)
+
+// PhaseType is used to store the phase name in a workflow.
+type PhaseType string
+
+const (
+	phaseCreateTable     PhaseType = "create_table"
+	phaseStartBackfill   PhaseType = "start_backfill"
+	phaseWaitForBackfill PhaseType = "wait_for_backfill"
+	phaseSwitchOwner     PhaseType = "switch_owner"
+	phaseStopBackfill    PhaseType = "stop_backfill"
+)
+
+// Register registers the CreateLookupVindexWorkflowFactory as a factory
+// in the workflow framework.
+func Register() {
+	workflow.Register(createLookupVindexFactoryName, &CreateLookupVindexWorkflowFactory{})
+}
+
+// CreateLookupVindexWorkflowFactory is the factory to create
+// a create lookup vindex workflow.
+type CreateLookupVindexWorkflowFactory struct{}
+
+// Init is part of the workflow.Factory interface.
+func (*CreateLookupVindexWorkflowFactory) Init(m *workflow.Manager, w *workflowpb.Workflow, args []string) error {
+	subFlags := flag.NewFlagSet(createLookupVindexFactoryName, flag.ContinueOnError)
+	keyspace := subFlags.String("keyspace", "", "Name of the keyspace of the vindex")
+	vindex := subFlags.String("vindex", "", "Name of the lookup vindex to backfill, which must be in the vschema of the keyspace")
+	table := subFlags.String("table", "", "Name of the table that will own the vindex")
+	columns := subFlags.String("columns", "", "A comma-separated list of the columns of the table the vindex is on. Defaults to the from columns of the vindex.")
+	enableApprovals := subFlags.Bool("enable_approvals", true, "If true, executions of tasks require user's approvals on the UI.")
+
+	if err := subFlags.Parse(args); err != nil {
+		return err
+	}
+	if *keyspace == "" || *vindex == "" || *table == "" {
+		return fmt.Errorf("keyspace, vindex and table must be provided to create a lookup vindex")
+	}
+
+	w.Name = fmt.Sprintf("Create lookup vindex %s on %s.%s", *vindex, *keyspace, *table)
+
+	wr := wrangler.New(logutil.NewConsoleLogger(), m.TopoServer(), tmclient.NewTabletManagerClient())
+	lookupShards, err := wr.LookupVindexShards(context.Background(), *keyspace, *vindex)
+	if err != nil {
+		return err
+	}
+	checkpoint := initCheckpoint(*keyspace, *vindex, *table, *columns, lookupShards)
+	checkpoint.Settings["enable_approvals"] = fmt.Sprintf("%v", *enableApprovals)
+
+	w.Data, err = proto.Marshal(checkpoint)
+	return err
+}
+
+// Instantiate is part the workflow.Factory interface.
+func (*CreateLookupVindexWorkflowFactory) Instantiate(m *workflow.Manager, w *workflowpb.Workflow, rootNode *workflow.Node) (workflow.Workflow, error) {
+	rootNode.Message = "This is a workflow to backfill a lookup vindex, and make it owned by its table."
+
+	checkpoint := &workflowpb.WorkflowCheckpoint{}
+	if err := proto.Unmarshal(w.Data, checkpoint); err != nil {
+		return nil, err
+	}
+
+	enableApprovals, err := strconv.ParseBool(checkpoint.Settings["enable_approvals"])
+	if err != nil {
+		return nil, err
+	}
+
+	lw := &CreateLookupVindexWorkflow{
+		checkpoint:      checkpoint,
+		rootUINode:      rootNode,
+		logger:          logutil.NewMemoryLogger(),
+		wr:              wrangler.New(logutil.NewConsoleLogger(), m.TopoServer(), tmclient.NewTabletManagerClient()),
+		topoServer:      m.TopoServer(),
+		manager:         m,
+		enableApprovals: enableApprovals,
+	}
+	lw.rootUINode.Children = []*workflow.Node{{
+		Name:     "CreateLookupTable",
+		PathName: string(phaseCreateTable),
+	}, {
+		Name:     "StartLookupBackfill",
+		PathName: string(phaseStartBackfill),
+	}, {
+		Name:     "WaitForLookupBackfill",
+		PathName: string(phaseWaitForBackfill),
+	}, {
+		Name:     "SwitchLookupVindexOwner",
+		PathName: string(phaseSwitchOwner),
+	}, {
+		Name:     "StopLookupBackfill",
+		PathName: string(phaseStopBackfill),
+	}}
+
+	for _, phase := range []PhaseType{phaseCreateTable, phaseStartBackfill, phaseWaitForBackfill, phaseSwitchOwner, phaseStopBackfill} {
+		if err := createUINodes(lw.rootUINode, phase, lw.taskPaths(phase)); err != nil {
+			return lw, err
+		}
+	}
+	return lw, nil
+}
+
+func createUINodes(rootNode *workflow.Node, phaseName PhaseType, paths []string) error {
+	phaseNode, err := rootNode.GetChildByPath(string(phaseName))
+	if err != nil {
+		return fmt.Errorf("fails to find phase node for: %v", phaseName)
+	}
+
+	for _, path := range paths {
+		taskUINode := &workflow.Node{
+			Name:     "Shard " + path,
+			PathName: path,
+		}
+		if phaseName == phaseSwitchOwner {
+			taskUINode.Name = "Keyspace " + path
+		}
+		phaseNode.Children = append(phaseNode.Children, taskUINode)
+	}
+	return nil
+}
+
+// initCheckpoint initializes the checkpoint of the workflow. The tasks
+// of all the phases run on each shard of the lookup table, except the
+// switch of the owner, which runs once for the keyspace.
+func initCheckpoint(keyspace, vindex, table, columns string, lookupShards []string) *workflowpb.WorkflowCheckpoint {
+	tasks := make(map[string]*workflowpb.Task)
+	attributes := func(shard string) map[string]string {
+		return map[string]string{
+			"keyspace": keyspace,
+			"vindex":   vindex,
+			"table":    table,
+			"columns":  columns,
+			"shard":    shard,
+		}
+	}
+	for _, phase := range []PhaseType{phaseCreateTable, phaseStartBackfill, phaseWaitForBackfill, phaseStopBackfill} {
+		for _, shard := range lookupShards {
+			initTask(tasks, phase, shard, attributes(shard))
+		}
+	}
+	initTask(tasks, phaseSwitchOwner, keyspace, attributes(""))
+
+	return &workflowpb.WorkflowCheckpoint{
+		CodeVersion: codeVersion,
+		Tasks:       tasks,
+		Settings: map[string]string{
+			"keyspace":      keyspace,
+			"lookup_shards": strings.Join(lookupShards, ","),
+		},
+	}
+}
+
+func initTask(tasks map[string]*workflowpb.Task, phase PhaseType, path string, attributes map[string]string) {
+	taskID := createTaskID(phase, path)
+	tasks[taskID] = &workflowpb.Task{
+		Id:         taskID,
+		State:      workflowpb.TaskState_TaskNotStarted,
+		Attributes: attributes,
+	}
+}
+
+// CreateLookupVindexWorkflow contains meta-information and methods to
+// control the create lookup vindex workflow.
+type CreateLookupVindexWorkflow struct {
+	ctx        context.Context
+	wr         LookupVindexWrangler
+	manager    *workflow.Manager
+	topoServer *topo.Server
+	wi         *topo.WorkflowInfo
+	// logger is the logger we export UI logs from.
+	logger *logutil.MemoryLogger
+
+	// rootUINode is the root node representing the workflow in the UI.
+	rootUINode *workflow.Node
+
+	checkpoint       *workflowpb.WorkflowCheckpoint
+	checkpointWriter *resharding.CheckpointWriter
+
+	enableApprovals bool
+}
+
+// Run executes the create lookup vindex process.
+// It implements the workflow.Workflow interface.
+func (lw *CreateLookupVindexWorkflow) Run(ctx context.Context, manager *workflow.Manager, wi *topo.WorkflowInfo) error {
+	lw.ctx = ctx
+	lw.wi = wi
+	lw.checkpointWriter = resharding.NewCheckpointWriter(lw.topoServer, lw.checkpoint, lw.wi)
+	lw.rootUINode.Display = workflow.NodeDisplayDeterminate
+	lw.rootUINode.BroadcastChanges(true /* updateChildren */)
+
+	if err := lw.runWorkflow(); err != nil {
+		return err
+	}
+	lw.setUIMessage("Create lookup vindex is finished successfully.")
+	return nil
+}
+
+func (lw *CreateLookupVindexWorkflow) runWorkflow() error {
+	createTableTasks := lw.GetTasks(phaseCreateTable)
+	createTableRunner := resharding.NewParallelRunner(lw.ctx, lw.rootUINode, lw.checkpointWriter, createTableTasks, lw.runCreateTable, resharding.Parallel, lw.enableApprovals)
+	if err := createTableRunner.Run(); err != nil {
+		return err
+	}
+
+	startBackfillTasks := lw.GetTasks(phaseStartBackfill)
+	startBackfillRunner := resharding.NewParallelRunner(lw.ctx, lw.rootUINode, lw.checkpointWriter, startBackfillTasks, lw.runStartBackfill, resharding.Parallel, lw.enableApprovals)
+	if err := startBackfillRunner.Run(); err != nil {
+		return err
+	}
+
+	waitForBackfillTasks := lw.GetTasks(phaseWaitForBackfill)
+	waitForBackfillRunner := resharding.NewParallelRunner(lw.ctx, lw.rootUINode, lw.checkpointWriter, waitForBackfillTasks, lw.runWaitForBackfill, resharding.Parallel, lw.enableApprovals)
+	if err := waitForBackfillRunner.Run(); err != nil {
+		return err
+	}
+
+	switchOwnerTasks := lw.GetTasks(phaseSwitchOwner)
+	switchOwnerRunner := resharding.NewParallelRunner(lw.ctx, lw.rootUINode, lw.checkpointWriter, switchOwnerTasks, lw.runSwitchOwner, resharding.Sequential, lw.enableApprovals)
+	if err := switchOwnerRunner.Run(); err != nil {
+		return err
+	}
+
+	// The streams must apply the changes that vtgates made before
+	// they knew the vindex is owned, so they're stopped last.
+	stopBackfillTasks := lw.GetTasks(phaseStopBackfill)
+	stopBackfillRunner := resharding.NewParallelRunner(lw.ctx, lw.rootUINode, lw.checkpointWriter, stopBackfillTasks, lw.runStopBackfill, resharding.Parallel, lw.enableApprovals)
+	return stopBackfillRunner.Run()
+}
+
+func (lw *CreateLookupVindexWorkflow) setUIMessage(message string) {
+	log.Infof("Create lookup vindex : %v.", message)
+	lw.rootUINode.Log = lw.logger.String()
+	lw.rootUINode.Message = message
+	lw.rootUINode.BroadcastChanges(false /* updateChildren */)
+}
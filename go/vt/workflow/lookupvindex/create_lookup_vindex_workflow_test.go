@@ -0,0 +1,229 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookupvindex
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/memorytopo"
+	"vitess.io/vitess/go/vt/workflow"
+
+	// import the gRPC client implementation for tablet manager
+	_ "vitess.io/vitess/go/vt/vttablet/grpctmclient"
+
+	topodatapb "vitess.io/vitess/go/vt/proto/topodata"
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+	workflowpb "vitess.io/vitess/go/vt/proto/workflow"
+)
+
+const testKeyspace = "test_keyspace"
+
+func init() {
+	Register()
+}
+
+// fakeLookupVindexWrangler logs the calls of the workflow.
+type fakeLookupVindexWrangler struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (f *fakeLookupVindexWrangler) logCall(format string, args ...interface{}) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (f *fakeLookupVindexWrangler) CreateLookupTable(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error {
+	return f.logCall("CreateLookupTable %s %s %s %v %s", keyspace, vindexName, ownerTable, ownerColumns, shard)
+}
+
+func (f *fakeLookupVindexWrangler) StartLookupBackfill(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error {
+	return f.logCall("StartLookupBackfill %s %s %s %v %s", keyspace, vindexName, ownerTable, ownerColumns, shard)
+}
+
+func (f *fakeLookupVindexWrangler) WaitForLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error {
+	return f.logCall("WaitForLookupBackfill %s %s %s", keyspace, vindexName, shard)
+}
+
+func (f *fakeLookupVindexWrangler) SwitchLookupVindexOwner(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string) error {
+	return f.logCall("SwitchLookupVindexOwner %s %s %s %v", keyspace, vindexName, ownerTable, ownerColumns)
+}
+
+func (f *fakeLookupVindexWrangler) StopLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error {
+	return f.logCall("StopLookupBackfill %s %s %s", keyspace, vindexName, shard)
+}
+
+// TestCreateLookupVindex runs the happy path of CreateLookupVindexWorkflow.
+func TestCreateLookupVindex(t *testing.T) {
+	ctx := context.Background()
+	ts := setupTopology(ctx, t)
+	m := workflow.NewManager(ts)
+	// Run the manager in the background.
+	wg, cancel := startManager(m)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	uuid, err := m.Create(ctx, createLookupVindexFactoryName, []string{"-keyspace=" + testKeyspace, "-vindex=name_idx", "-table=user", "-columns=uname", "-enable_approvals=false"})
+	if err != nil {
+		t.Fatalf("cannot create lookup vindex workflow: %v", err)
+	}
+	// Inject the fake wrangler into the workflow.
+	w, err := m.WorkflowForTesting(uuid)
+	if err != nil {
+		t.Fatalf("fail to get workflow from manager: %v", err)
+	}
+	fakeWrangler := &fakeLookupVindexWrangler{}
+	w.(*CreateLookupVindexWorkflow).wr = fakeWrangler
+
+	if err := m.Start(ctx, uuid); err != nil {
+		t.Fatalf("cannot start lookup vindex workflow: %v", err)
+	}
+	if err := m.Wait(ctx, uuid); err != nil {
+		t.Fatalf("lookup vindex workflow failed: %v", err)
+	}
+	if err := verifyAllTasksDone(ctx, ts, uuid); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Stop(ctx, uuid); err != nil {
+		t.Fatalf("cannot stop lookup vindex workflow: %v", err)
+	}
+
+	// The tasks of a phase run in parallel, but the phases run
+	// in order.
+	phases := []string{"CreateLookupTable", "StartLookupBackfill", "WaitForLookupBackfill", "SwitchLookupVindexOwner", "StopLookupBackfill"}
+	rank := func(call string) int {
+		for i, phase := range phases {
+			if strings.HasPrefix(call, phase+" ") {
+				return i
+			}
+		}
+		return -1
+	}
+	got := fakeWrangler.log
+	if !sort.SliceIsSorted(got, func(i, j int) bool { return rank(got[i]) < rank(got[j]) }) {
+		t.Errorf("phases ran out of order: %v", got)
+	}
+	sort.Strings(got)
+	want := []string{
+		"CreateLookupTable test_keyspace name_idx user [uname] -80",
+		"CreateLookupTable test_keyspace name_idx user [uname] 80-",
+		"StartLookupBackfill test_keyspace name_idx user [uname] -80",
+		"StartLookupBackfill test_keyspace name_idx user [uname] 80-",
+		"StopLookupBackfill test_keyspace name_idx -80",
+		"StopLookupBackfill test_keyspace name_idx 80-",
+		"SwitchLookupVindexOwner test_keyspace name_idx user [uname]",
+		"WaitForLookupBackfill test_keyspace name_idx -80",
+		"WaitForLookupBackfill test_keyspace name_idx 80-",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrangler calls:\n%v, want\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCreateLookupVindexErrors(t *testing.T) {
+	ctx := context.Background()
+	ts := setupTopology(ctx, t)
+	m := workflow.NewManager(ts)
+
+	if _, err := m.Create(ctx, createLookupVindexFactoryName, []string{"-keyspace=" + testKeyspace, "-vindex=name_idx"}); err == nil {
+		t.Errorf("Create(no table) succeeded, want error")
+	}
+	want := "vindex other_idx not found in keyspace test_keyspace"
+	if _, err := m.Create(ctx, createLookupVindexFactoryName, []string{"-keyspace=" + testKeyspace, "-vindex=other_idx", "-table=user"}); err == nil || err.Error() != want {
+		t.Errorf("Create(unknown vindex): %v, want %s", err, want)
+	}
+}
+
+func setupTopology(ctx context.Context, t *testing.T) *topo.Server {
+	ts := memorytopo.NewServer("cell")
+	if err := ts.CreateKeyspace(ctx, testKeyspace, &topodatapb.Keyspace{}); err != nil {
+		t.Fatalf("CreateKeyspace: %v", err)
+	}
+	for _, shard := range []string{"-80", "80-"} {
+		if err := ts.CreateShard(ctx, testKeyspace, shard); err != nil {
+			t.Fatalf("CreateShard: %v", err)
+		}
+	}
+	vschema := &vschemapb.Keyspace{
+		Sharded: true,
+		Vindexes: map[string]*vschemapb.Vindex{
+			"hash": {Type: "hash"},
+			"name_idx": {
+				Type: "lookup_unique",
+				Params: map[string]string{
+					"table": "name_idx",
+					"from":  "name",
+					"to":    "keyspace_id",
+				},
+			},
+		},
+		Tables: map[string]*vschemapb.Table{
+			"user": {
+				ColumnVindexes: []*vschemapb.ColumnVindex{{Name: "hash", Columns: []string{"id"}}},
+			},
+		},
+	}
+	if err := ts.SaveVSchema(ctx, testKeyspace, vschema); err != nil {
+		t.Fatalf("SaveVSchema: %v", err)
+	}
+	return ts
+}
+
+func startManager(m *workflow.Manager) (*sync.WaitGroup, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.Run(ctx)
+	}()
+	m.WaitUntilRunning()
+	return wg, cancel
+}
+
+func verifyAllTasksDone(ctx context.Context, ts *topo.Server, uuid string) error {
+	wi, err := ts.GetWorkflow(ctx, uuid)
+	if err != nil {
+		return fmt.Errorf("fail to get workflow for: %v", uuid)
+	}
+	checkpoint := &workflowpb.WorkflowCheckpoint{}
+	if err := proto.Unmarshal(wi.Workflow.Data, checkpoint); err != nil {
+		return fmt.Errorf("fails to get checkpoint for the workflow: %v", err)
+	}
+	if len(checkpoint.Tasks) != 9 {
+		return fmt.Errorf("got %v tasks, want 9", len(checkpoint.Tasks))
+	}
+	for _, task := range checkpoint.Tasks {
+		if task.State != workflowpb.TaskState_TaskDone || task.Error != "" {
+			return fmt.Errorf("task: %v should succeed: task status: %v, %v", task.Id, task.State, task.Attributes)
+		}
+	}
+	return nil
+}
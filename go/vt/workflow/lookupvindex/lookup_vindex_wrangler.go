@@ -0,0 +1,35 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookupvindex
+
+import (
+	"golang.org/x/net/context"
+)
+
+// LookupVindexWrangler is the subset of the methods of
+// wrangler.Wrangler that the workflow uses, so tests can fake it.
+type LookupVindexWrangler interface {
+	CreateLookupTable(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error
+
+	StartLookupBackfill(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error
+
+	WaitForLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error
+
+	SwitchLookupVindexOwner(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string) error
+
+	StopLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lookupvindex
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	workflowpb "vitess.io/vitess/go/vt/proto/workflow"
+)
+
+func createTaskID(phase PhaseType, path string) string {
+	return fmt.Sprintf("%s/%s", phase, path)
+}
+
+// taskPaths returns the paths of the tasks of a phase, in their
+// execution order.
+func (lw *CreateLookupVindexWorkflow) taskPaths(phase PhaseType) []string {
+	switch phase {
+	case phaseCreateTable, phaseStartBackfill, phaseWaitForBackfill, phaseStopBackfill:
+		return strings.Split(lw.checkpoint.Settings["lookup_shards"], ",")
+	case phaseSwitchOwner:
+		return []string{lw.checkpoint.Settings["keyspace"]}
+	}
+	log.Fatalf("BUG: unknown phase type: %v", phase)
+	return nil
+}
+
+// GetTasks returns selected tasks for a phase from the checkpoint
+// with expected execution order.
+func (lw *CreateLookupVindexWorkflow) GetTasks(phase PhaseType) []*workflowpb.Task {
+	var tasks []*workflowpb.Task
+	for _, path := range lw.taskPaths(phase) {
+		tasks = append(tasks, lw.checkpoint.Tasks[createTaskID(phase, path)])
+	}
+	return tasks
+}
+
+// ownerColumns returns the owner columns of a task, which are empty
+// if they default to the from columns of the vindex.
+func ownerColumns(t *workflowpb.Task) []string {
+	if t.Attributes["columns"] == "" {
+		return nil
+	}
+	return strings.Split(t.Attributes["columns"], ",")
+}
+
+func (lw *CreateLookupVindexWorkflow) runCreateTable(ctx context.Context, t *workflowpb.Task) error {
+	return lw.wr.CreateLookupTable(ctx, t.Attributes["keyspace"], t.Attributes["vindex"], t.Attributes["table"], ownerColumns(t), t.Attributes["shard"])
+}
+
+func (lw *CreateLookupVindexWorkflow) runStartBackfill(ctx context.Context, t *workflowpb.Task) error {
+	return lw.wr.StartLookupBackfill(ctx, t.Attributes["keyspace"], t.Attributes["vindex"], t.Attributes["table"], ownerColumns(t), t.Attributes["shard"])
+}
+
+func (lw *CreateLookupVindexWorkflow) runWaitForBackfill(ctx context.Context, t *workflowpb.Task) error {
+	return lw.wr.WaitForLookupBackfill(ctx, t.Attributes["keyspace"], t.Attributes["vindex"], t.Attributes["shard"])
+}
+
+func (lw *CreateLookupVindexWorkflow) runSwitchOwner(ctx context.Context, t *workflowpb.Task) error {
+	return lw.wr.SwitchLookupVindexOwner(ctx, t.Attributes["keyspace"], t.Attributes["vindex"], t.Attributes["table"], ownerColumns(t))
+}
+
+func (lw *CreateLookupVindexWorkflow) runStopBackfill(ctx context.Context, t *workflowpb.Task) error {
+	return lw.wr.StopLookupBackfill(ctx, t.Attributes["keyspace"], t.Attributes["vindex"], t.Attributes["shard"])
+}
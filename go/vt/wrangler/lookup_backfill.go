@@ -0,0 +1,597 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wrangler
+
+// This file handles the backfill of a lookup vindex that is added to
+// a populated table: its table is populated by vreplication streams
+// from the owner table, before the vindex becomes owned.
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/mysql"
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/binlog/binlogplayer"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/throttler"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/topo/topoproto"
+	"vitess.io/vitess/go/vt/topotools"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+
+	vschemapb "vitess.io/vitess/go/vt/proto/vschema"
+)
+
+var (
+	lookupBackfillPollInterval = flag.Duration("lookup_backfill_poll_interval", 1*time.Second, "how often the progress of the streams that backfill a lookup vindex is checked")
+)
+
+// lookupBackfill describes the backfill of a lookup vindex: the
+// filter of the streams that populate its table from the owner table.
+type lookupBackfill struct {
+	*lookupVindexInfo
+
+	// ownerColumnTypes are the MySQL types of ownerColumns.
+	ownerColumnTypes []string
+	// primaryType is the MySQL type of the primary column of
+	// the owner table.
+	primaryType string
+	// toType is the MySQL type of toColumn.
+	toType string
+	// unique is set if the vindex is unique.
+	unique bool
+	// filter is the filter of the streams, without their keyrange.
+	filter string
+	// keyRangeColumn and keyRangeVindexType are the owner column and
+	// the vindex type that map a row to its lookup table shard. They
+	// are empty if the lookup keyspace is not sharded.
+	keyRangeColumn     string
+	keyRangeVindexType string
+}
+
+// lookupBackfillWorkflow returns the workflow name of the vreplication
+// streams that backfill vindexName.
+func lookupBackfillWorkflow(vindexName string) string {
+	return "lookup_backfill:" + vindexName
+}
+
+// LookupVindexShards returns the shards of the keyspace of the table
+// of a lookup vindex, sorted.
+func (wr *Wrangler) LookupVindexShards(ctx context.Context, keyspace, vindexName string) ([]string, error) {
+	vindexInfo, err := wr.getVindex(ctx, keyspace, vindexName)
+	if err != nil {
+		return nil, err
+	}
+	lookupKeyspace, _ := splitLookupTable(keyspace, vindexInfo.Params["table"])
+	shards, err := wr.ts.GetShardNames(ctx, lookupKeyspace)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(shards)
+	return shards, nil
+}
+
+// CreateLookupTable creates the table of a lookup vindex on the master
+// of shard, in the keyspace of the table, if it doesn't exist. The
+// vindex will be owned by ownerTable, on ownerColumns, which default
+// to the from columns of the vindex. The types of the from columns are
+// the ones of the owner columns, which must not be NULL.
+func (wr *Wrangler) CreateLookupTable(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error {
+	lb, err := wr.findLookupBackfill(ctx, keyspace, vindexName, ownerTable, ownerColumns)
+	if err != nil {
+		return err
+	}
+	si, err := wr.ts.GetShard(ctx, lb.lookupKeyspace, shard)
+	if err != nil {
+		return err
+	}
+	_, err = wr.executeOnMaster(ctx, si, lb.createTableQuery(), 0)
+	return err
+}
+
+// StartLookupBackfill starts the vreplication streams that populate
+// the table of a lookup vindex on the master of shard: one stream per
+// shard of the owner table, which copies the owner rows before
+// replicating their changes. The streams that already exist are kept.
+func (wr *Wrangler) StartLookupBackfill(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string, shard string) error {
+	lb, err := wr.findLookupBackfill(ctx, keyspace, vindexName, ownerTable, ownerColumns)
+	if err != nil {
+		return err
+	}
+	si, err := wr.ts.GetShard(ctx, lb.lookupKeyspace, shard)
+	if err != nil {
+		return err
+	}
+	streams, err := wr.readLookupBackfillStreams(ctx, si, vindexName)
+	if err != nil {
+		return err
+	}
+	started := make(map[string]bool, len(streams))
+	for _, stream := range streams {
+		started[stream.source.Shard] = true
+	}
+
+	ownerShards, err := wr.ts.GetShardNames(ctx, lb.ownerKeyspace)
+	if err != nil {
+		return err
+	}
+	sort.Strings(ownerShards)
+	workflow := lookupBackfillWorkflow(vindexName)
+	for _, ownerShard := range ownerShards {
+		if started[ownerShard] {
+			continue
+		}
+		source := &binlogplayer.BinlogSource{
+			Keyspace: lb.ownerKeyspace,
+			Shard:    ownerShard,
+			Rules: []*binlogplayer.Rule{{
+				Match:  lb.lookupTable,
+				Filter: lb.streamFilter(shard),
+			}},
+			Upsert: true,
+		}
+		// The stream is inserted stopped, so it doesn't start
+		// before it knows it must copy the owner table.
+		qr, err := wr.executeOnMaster(ctx, si, binlogplayer.CreateVReplicationState(workflow, source, "", "", throttler.MaxRateModuleDisabled, throttler.ReplicationLagModuleDisabled, time.Now().Unix(), binlogplayer.BlpStopped), 0)
+		if err != nil {
+			return err
+		}
+		uid := uint32(qr.InsertId)
+		insertCopyState, err := binlogplayer.InsertCopyState(uid, source)
+		if err != nil {
+			return err
+		}
+		if _, err := wr.executeOnMaster(ctx, si, insertCopyState, 0); err != nil {
+			return err
+		}
+		if _, err := wr.executeOnMaster(ctx, si, binlogplayer.SetVReplicationState(uid, binlogplayer.BlpRunning, ""), 0); err != nil {
+			return err
+		}
+		wr.Logger().Infof("started stream %v on %v/%v to backfill vindex %v from %v/%v", uid, lb.lookupKeyspace, shard, vindexName, lb.ownerKeyspace, ownerShard)
+	}
+	return nil
+}
+
+// WaitForLookupBackfill waits until the streams that backfill a lookup
+// vindex on the master of shard copied the owner table, and caught up
+// with the positions of the owner masters when it was called.
+func (wr *Wrangler) WaitForLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error {
+	_, err := wr.waitForLookupBackfill(ctx, keyspace, vindexName, shard)
+	return err
+}
+
+// StopLookupBackfill waits for the streams that backfill a lookup
+// vindex on the master of shard to catch up, like WaitForLookupBackfill,
+// and deletes them. It must be called after the vindex is owned by its
+// table, so the changes made after the streams are deleted are applied
+// by vtgate.
+func (wr *Wrangler) StopLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) error {
+	streams, err := wr.waitForLookupBackfill(ctx, keyspace, vindexName, shard)
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		if _, err := wr.executeOnMaster(ctx, stream.si, binlogplayer.DeleteVReplication(stream.uid), 0); err != nil {
+			return err
+		}
+		if _, err := wr.executeOnMaster(ctx, stream.si, binlogplayer.DeleteCopyState(stream.uid, ""), 0); err != nil {
+			return err
+		}
+		wr.Logger().Infof("deleted stream %v on %v/%v", stream.uid, stream.si.Keyspace(), stream.si.ShardName())
+	}
+	return nil
+}
+
+// SwitchLookupVindexOwner makes ownerTable the owner of a lookup vindex
+// in the vschema, on ownerColumns, which default to the from columns of
+// the vindex: from then on, vtgate maintains the vindex table when it
+// changes the owner table. The vschema is rebuilt in all cells.
+func (wr *Wrangler) SwitchLookupVindexOwner(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string) error {
+	lb, err := wr.findLookupBackfill(ctx, keyspace, vindexName, ownerTable, ownerColumns)
+	if err != nil {
+		return err
+	}
+	vschema, err := wr.ts.GetVSchema(ctx, keyspace)
+	if err != nil {
+		return err
+	}
+	vschema.Vindexes[vindexName].Owner = ownerTable
+	table := vschema.Tables[ownerTable]
+	found := false
+	for _, cv := range table.ColumnVindexes {
+		if cv.Name == vindexName {
+			found = true
+		}
+	}
+	if !found {
+		cv := &vschemapb.ColumnVindex{Name: vindexName}
+		for _, col := range lb.ownerColumns {
+			cv.Columns = append(cv.Columns, col.String())
+		}
+		table.ColumnVindexes = append(table.ColumnVindexes, cv)
+	}
+	if _, err := vindexes.BuildKeyspaceSchema(vschema, keyspace); err != nil {
+		return err
+	}
+	if err := wr.ts.SaveVSchema(ctx, keyspace, vschema); err != nil {
+		return err
+	}
+	return topotools.RebuildVSchema(ctx, wr.Logger(), wr.ts, nil)
+}
+
+// getVindex returns the vschema definition of vindexName.
+func (wr *Wrangler) getVindex(ctx context.Context, keyspace, vindexName string) (*vschemapb.Vindex, error) {
+	vschema, err := wr.ts.GetVSchema(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	vindexInfo, ok := vschema.Vindexes[vindexName]
+	if !ok {
+		return nil, fmt.Errorf("vindex %v not found in keyspace %v", vindexName, keyspace)
+	}
+	return vindexInfo, nil
+}
+
+// findLookupBackfill reads the vschema of keyspace and the owner table
+// on its first master, and returns the backfill of its vindexName
+// lookup vindex from ownerTable. The primary vindexes of the owner
+// table and of the lookup table must be functional, and have a single
+// column.
+func (wr *Wrangler) findLookupBackfill(ctx context.Context, keyspace, vindexName, ownerTable string, ownerColumns []string) (*lookupBackfill, error) {
+	vschema, err := wr.ts.GetVSchema(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	vindexInfo, ok := vschema.Vindexes[vindexName]
+	if !ok {
+		return nil, fmt.Errorf("vindex %v not found in keyspace %v", vindexName, keyspace)
+	}
+	if vindexInfo.Owner != "" && vindexInfo.Owner != ownerTable {
+		return nil, fmt.Errorf("vindex %v is already owned by table %v", vindexName, vindexInfo.Owner)
+	}
+	ks, err := vindexes.BuildKeyspaceSchema(vschema, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ks.Vindexes[vindexName].(vindexes.Lookup); !ok {
+		return nil, fmt.Errorf("vindex %v is not a lookup vindex", vindexName)
+	}
+	owner, ok := ks.Tables[ownerTable]
+	if !ok || len(owner.ColumnVindexes) == 0 {
+		return nil, fmt.Errorf("table %v not found in the vschema of keyspace %v", ownerTable, keyspace)
+	}
+	primary := owner.ColumnVindexes[0]
+	if _, ok := primary.Vindex.(vindexes.Unique); !ok || primary.Vindex.Cost() > 1 || len(primary.Columns) != 1 {
+		return nil, fmt.Errorf("primary vindex of table %v must be functional, on a single column", ownerTable)
+	}
+
+	lb := &lookupBackfill{
+		lookupVindexInfo: &lookupVindexInfo{
+			ownerKeyspace: keyspace,
+			owner:         owner,
+			toColumn:      vindexInfo.Params["to"],
+		},
+	}
+	lb.lookupKeyspace, lb.lookupTable = splitLookupTable(keyspace, vindexInfo.Params["table"])
+	for _, from := range strings.Split(vindexInfo.Params["from"], ",") {
+		lb.fromColumns = append(lb.fromColumns, strings.TrimSpace(from))
+	}
+	if len(ownerColumns) == 0 {
+		for _, cv := range owner.ColumnVindexes {
+			if cv.Name == vindexName {
+				for _, col := range cv.Columns {
+					ownerColumns = append(ownerColumns, col.String())
+				}
+			}
+		}
+	}
+	if len(ownerColumns) == 0 {
+		ownerColumns = lb.fromColumns
+	}
+	if len(ownerColumns) != len(lb.fromColumns) {
+		return nil, fmt.Errorf("vindex %v has %v from columns, got owner columns %v", vindexName, len(lb.fromColumns), ownerColumns)
+	}
+	for _, col := range ownerColumns {
+		lb.ownerColumns = append(lb.ownerColumns, sqlparser.NewColIdent(col))
+	}
+
+	if err := wr.readOwnerColumnTypes(ctx, lb); err != nil {
+		return nil, err
+	}
+	_, lb.unique = ks.Vindexes[vindexName].(vindexes.Unique)
+	// The lookup_hash vindexes store the unhashed keyspace id, which is
+	// the primary column itself when the primary vindex is hash.
+	buf := &bytes.Buffer{}
+	buf.WriteString("select ")
+	for i, col := range lb.ownerColumns {
+		fmt.Fprintf(buf, "%s as %s, ", sqlparser.String(col), sqlparser.String(sqlparser.NewColIdent(lb.fromColumns[i])))
+	}
+	if strings.HasPrefix(vindexInfo.Type, "lookup_hash") {
+		if primary.Type != "hash" {
+			return nil, fmt.Errorf("vindex %v of type %v requires the primary vindex of table %v to be hash", vindexName, vindexInfo.Type, ownerTable)
+		}
+		fmt.Fprintf(buf, "%s as %s", sqlparser.String(primary.Columns[0]), sqlparser.String(sqlparser.NewColIdent(lb.toColumn)))
+		lb.toType = lb.primaryType
+	} else {
+		fmt.Fprintf(buf, "keyspace_id(%s, %s) as %s", sqlparser.String(primary.Columns[0]), encodeSQLString(primary.Type), sqlparser.String(sqlparser.NewColIdent(lb.toColumn)))
+		lb.toType = "varbinary(128)"
+	}
+	fmt.Fprintf(buf, " from %s", sqlparser.String(owner.Name))
+	lb.filter = buf.String()
+
+	if err := wr.findLookupKeyRange(ctx, lb); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// readOwnerColumnTypes reads the types of the owner columns of lb,
+// and of the primary column of the owner table, from the master of
+// the first shard of the owner keyspace.
+func (wr *Wrangler) readOwnerColumnTypes(ctx context.Context, lb *lookupBackfill) error {
+	shards, err := wr.ts.GetShardNames(ctx, lb.ownerKeyspace)
+	if err != nil {
+		return err
+	}
+	if len(shards) == 0 {
+		return fmt.Errorf("no shards in keyspace %v", lb.ownerKeyspace)
+	}
+	sort.Strings(shards)
+	si, err := wr.ts.GetShard(ctx, lb.ownerKeyspace, shards[0])
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("select column_name, column_type from information_schema.columns where table_schema = database() and table_name = %s", encodeSQLString(lb.owner.Name.String()))
+	qr, err := wr.executeOnMaster(ctx, si, query, 10000)
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string)
+	for _, row := range sqltypes.Proto3ToResult(qr).Rows {
+		types[strings.ToLower(row[0].ToString())] = row[1].ToString()
+	}
+	columnType := func(col sqlparser.ColIdent) (string, error) {
+		typ, ok := types[col.Lowered()]
+		if !ok {
+			return "", fmt.Errorf("column %v not found in table %v on %v", col.String(), lb.owner.Name.String(), topoproto.TabletAliasString(si.MasterAlias))
+		}
+		return typ, nil
+	}
+	for _, col := range lb.ownerColumns {
+		typ, err := columnType(col)
+		if err != nil {
+			return err
+		}
+		lb.ownerColumnTypes = append(lb.ownerColumnTypes, typ)
+	}
+	lb.primaryType, err = columnType(lb.owner.ColumnVindexes[0].Columns[0])
+	return err
+}
+
+// findLookupKeyRange sets the column and the vindex type that map the
+// owner rows to the shards of the lookup table, if the lookup keyspace
+// is sharded: they are the owner column of the from column that has
+// the primary vindex of the lookup table.
+func (wr *Wrangler) findLookupKeyRange(ctx context.Context, lb *lookupBackfill) error {
+	vschema, err := wr.ts.GetVSchema(ctx, lb.lookupKeyspace)
+	if err != nil {
+		return err
+	}
+	if !vschema.Sharded {
+		return nil
+	}
+	ks, err := vindexes.BuildKeyspaceSchema(vschema, lb.lookupKeyspace)
+	if err != nil {
+		return err
+	}
+	table, ok := ks.Tables[lb.lookupTable]
+	if !ok || len(table.ColumnVindexes) == 0 {
+		return fmt.Errorf("lookup table %v not found in the vschema of keyspace %v", lb.lookupTable, lb.lookupKeyspace)
+	}
+	primary := table.ColumnVindexes[0]
+	if _, ok := primary.Vindex.(vindexes.Unique); !ok || primary.Vindex.Cost() > 1 || len(primary.Columns) != 1 {
+		return fmt.Errorf("primary vindex of lookup table %v must be functional, on a single column", lb.lookupTable)
+	}
+	for i, from := range lb.fromColumns {
+		if primary.Columns[0].EqualString(from) {
+			lb.keyRangeColumn = lb.ownerColumns[i].String()
+			lb.keyRangeVindexType = primary.Type
+			return nil
+		}
+	}
+	return fmt.Errorf("primary vindex column %v of lookup table %v is not a from column", primary.Columns[0].String(), lb.lookupTable)
+}
+
+// streamFilter returns the filter of the streams that populate shard
+// of the lookup table.
+func (lb *lookupBackfill) streamFilter(shard string) string {
+	if lb.keyRangeColumn == "" {
+		return lb.filter
+	}
+	return fmt.Sprintf("%s where in_keyrange(%s, %s, %s)", lb.filter, sqlparser.String(sqlparser.NewColIdent(lb.keyRangeColumn)), encodeSQLString(lb.keyRangeVindexType), encodeSQLString(shard))
+}
+
+// createTableQuery returns the statement that creates the lookup table.
+// Its primary key is the from columns, and the to column too if the
+// vindex is not unique.
+func (lb *lookupBackfill) createTableQuery() string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "create table if not exists %s (\n", sqlparser.String(sqlparser.NewTableIdent(lb.lookupTable)))
+	var pk []string
+	for i, from := range lb.fromColumns {
+		col := sqlparser.String(sqlparser.NewColIdent(from))
+		fmt.Fprintf(buf, "  %s %s not null,\n", col, lb.ownerColumnTypes[i])
+		pk = append(pk, col)
+	}
+	to := sqlparser.String(sqlparser.NewColIdent(lb.toColumn))
+	fmt.Fprintf(buf, "  %s %s,\n", to, lb.toType)
+	if !lb.unique {
+		pk = append(pk, to)
+	}
+	fmt.Fprintf(buf, "  primary key (%s)\n) engine=InnoDB", strings.Join(pk, ", "))
+	return buf.String()
+}
+
+// lookupBackfillStream is a stream that backfills a lookup vindex.
+type lookupBackfillStream struct {
+	si     *topo.ShardInfo
+	uid    uint32
+	source *binlogplayer.BinlogSource
+	pos    string
+}
+
+// readLookupBackfillStreams returns the streams that backfill
+// vindexName on the master of si.
+func (wr *Wrangler) readLookupBackfillStreams(ctx context.Context, si *topo.ShardInfo, vindexName string) ([]*lookupBackfillStream, error) {
+	qr, err := wr.executeOnMaster(ctx, si, binlogplayer.QueryVReplicationWorkflow(lookupBackfillWorkflow(vindexName)), 10000)
+	if err != nil {
+		return nil, err
+	}
+	var streams []*lookupBackfillStream
+	for _, row := range sqltypes.Proto3ToResult(qr).Rows {
+		uid, err := sqltypes.ToUint64(row[0])
+		if err != nil {
+			return nil, err
+		}
+		source, err := binlogplayer.ParseBinlogSource(row[1].ToString())
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, &lookupBackfillStream{
+			si:     si,
+			uid:    uint32(uid),
+			source: source,
+			pos:    row[2].ToString(),
+		})
+	}
+	return streams, nil
+}
+
+// waitForLookupBackfill implements WaitForLookupBackfill, and returns
+// the streams it waited for.
+func (wr *Wrangler) waitForLookupBackfill(ctx context.Context, keyspace, vindexName, shard string) ([]*lookupBackfillStream, error) {
+	vindexInfo, err := wr.getVindex(ctx, keyspace, vindexName)
+	if err != nil {
+		return nil, err
+	}
+	lookupKeyspace, _ := splitLookupTable(keyspace, vindexInfo.Params["table"])
+	si, err := wr.ts.GetShard(ctx, lookupKeyspace, shard)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := wr.readLookupBackfillStreams(ctx, si, vindexName)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, fmt.Errorf("no stream backfills vindex %v on %v/%v", vindexName, lookupKeyspace, shard)
+	}
+
+	// The streams must reach the positions of their source
+	// masters as of now.
+	targets := make(map[uint32]mysql.Position, len(streams))
+	for _, stream := range streams {
+		sourceShard, err := wr.ts.GetShard(ctx, stream.source.Keyspace, stream.source.Shard)
+		if err != nil {
+			return nil, err
+		}
+		if !sourceShard.HasMaster() {
+			return nil, fmt.Errorf("no master in shard %v/%v", sourceShard.Keyspace(), sourceShard.ShardName())
+		}
+		ti, err := wr.ts.GetTablet(ctx, sourceShard.MasterAlias)
+		if err != nil {
+			return nil, err
+		}
+		pos, err := wr.tmc.MasterPosition(ctx, ti.Tablet)
+		if err != nil {
+			return nil, err
+		}
+		if targets[stream.uid], err = mysql.DecodePosition(pos); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		done, err := wr.lookupBackfillDone(ctx, si, vindexName, targets)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			return streams, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("streams backfilling vindex %v on %v/%v did not catch up: %v", vindexName, lookupKeyspace, shard, ctx.Err())
+		case <-time.After(*lookupBackfillPollInterval):
+		}
+	}
+}
+
+// lookupBackfillDone returns true if the streams backfilling vindexName
+// on the master of si finished their copy, and reached their target
+// position.
+func (wr *Wrangler) lookupBackfillDone(ctx context.Context, si *topo.ShardInfo, vindexName string, targets map[uint32]mysql.Position) (bool, error) {
+	streams, err := wr.readLookupBackfillStreams(ctx, si, vindexName)
+	if err != nil {
+		return false, err
+	}
+	for _, stream := range streams {
+		target, ok := targets[stream.uid]
+		if !ok {
+			continue
+		}
+		qr, err := wr.executeOnMaster(ctx, si, binlogplayer.QueryCopyState(stream.uid), 10000)
+		if err != nil {
+			return false, err
+		}
+		if len(qr.Rows) != 0 {
+			wr.Logger().Infof("stream %v on %v/%v is copying %v tables", stream.uid, si.Keyspace(), si.ShardName(), len(qr.Rows))
+			return false, nil
+		}
+		pos, err := mysql.DecodePosition(stream.pos)
+		if err != nil {
+			return false, err
+		}
+		if !pos.AtLeast(target) {
+			wr.Logger().Infof("stream %v on %v/%v is at %v, waiting for %v", stream.uid, si.Keyspace(), si.ShardName(), stream.pos, mysql.EncodePosition(target))
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// splitLookupTable returns the keyspace and the name of the table of a
+// lookup vindex of keyspace, which may be qualified by its keyspace.
+func splitLookupTable(keyspace, table string) (string, string) {
+	if i := strings.Index(table, "."); i != -1 {
+		return table[:i], table[i+1:]
+	}
+	return keyspace, table
+}
+
+func encodeSQLString(in string) string {
+	buf := &bytes.Buffer{}
+	sqltypes.NewVarChar(in).EncodeSQL(buf)
+	return buf.String()
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wrangler
+
+import (
+	"testing"
+)
+
+func TestLookupBackfillQueries(t *testing.T) {
+	lb := &lookupBackfill{
+		lookupVindexInfo: &lookupVindexInfo{
+			lookupTable: "name_user_idx",
+			fromColumns: []string{"name", "region"},
+			toColumn:    "keyspace_id",
+		},
+		ownerColumnTypes: []string{"varchar(64)", "int(11)"},
+		toType:           "varbinary(128)",
+		unique:           true,
+		filter:           "select uname as name, region as region, keyspace_id(id, 'hash') as keyspace_id from user",
+	}
+	want := "create table if not exists name_user_idx (\n" +
+		"  name varchar(64) not null,\n" +
+		"  region int(11) not null,\n" +
+		"  keyspace_id varbinary(128),\n" +
+		"  primary key (name, region)\n" +
+		") engine=InnoDB"
+	if got := lb.createTableQuery(); got != want {
+		t.Errorf("createTableQuery:\n%s, want\n%s", got, want)
+	}
+	lb.unique = false
+	want = "create table if not exists name_user_idx (\n" +
+		"  name varchar(64) not null,\n" +
+		"  region int(11) not null,\n" +
+		"  keyspace_id varbinary(128),\n" +
+		"  primary key (name, region, keyspace_id)\n" +
+		") engine=InnoDB"
+	if got := lb.createTableQuery(); got != want {
+		t.Errorf("createTableQuery(non unique):\n%s, want\n%s", got, want)
+	}
+
+	// The filter has no keyrange if the lookup keyspace is unsharded.
+	if got := lb.streamFilter("0"); got != lb.filter {
+		t.Errorf("streamFilter(unsharded): %s, want %s", got, lb.filter)
+	}
+	lb.keyRangeColumn = "uname"
+	lb.keyRangeVindexType = "unicode_loose_md5"
+	want = "select uname as name, region as region, keyspace_id(id, 'hash') as keyspace_id from user where in_keyrange(uname, 'unicode_loose_md5', '-80')"
+	if got := lb.streamFilter("-80"); got != want {
+		t.Errorf("streamFilter:\n%s, want\n%s", got, want)
+	}
+}
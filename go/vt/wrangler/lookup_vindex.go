@@ -0,0 +1,442 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wrangler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/key"
+	"vitess.io/vitess/go/vt/sqlparser"
+	"vitess.io/vitess/go/vt/topo"
+	"vitess.io/vitess/go/vt/vtgate/vindexes"
+
+	querypb "vitess.io/vitess/go/vt/proto/query"
+)
+
+// LookupEntry is a row of a lookup vindex table: the values of its
+// from columns, and the keyspace id they map to.
+type LookupEntry struct {
+	From  []sqltypes.Value
+	Ksid  []byte
+	Shard string
+}
+
+// String returns a printable representation of the entry.
+func (le *LookupEntry) String() string {
+	return fmt.Sprintf("%v -> %s (shard %s)", le.From, hex.EncodeToString(le.Ksid), le.Shard)
+}
+
+// key returns a string that identifies the from values and the
+// keyspace id of the entry, independently of the value types.
+func (le *LookupEntry) key() string {
+	parts := make([]string, 0, len(le.From)+1)
+	for _, v := range le.From {
+		parts = append(parts, v.ToString())
+	}
+	parts = append(parts, string(le.Ksid))
+	return fmt.Sprintf("%q", parts)
+}
+
+// LookupVindexReport is the result of VerifyLookupVindex.
+type LookupVindexReport struct {
+	// Orphans are the lookup rows whose owner row doesn't exist.
+	// Their Shard is the lookup table shard they were found on.
+	Orphans []*LookupEntry
+	// Missing are the owner rows that have no lookup row. Their
+	// Shard is the lookup table shard they belong to.
+	Missing []*LookupEntry
+}
+
+// lookupVindexInfo describes a lookup vindex, its owner table,
+// and its backing table.
+type lookupVindexInfo struct {
+	ownerKeyspace string
+	owner         *vindexes.Table
+	ownerColumns  []sqlparser.ColIdent
+
+	lookupKeyspace string
+	lookupTable    string
+	fromColumns    []string
+	toColumn       string
+}
+
+// VerifyLookupVindex scans the owner table of a lookup vindex and its
+// backing table on the masters, and reports the lookup rows that have
+// no owner row, and the owner rows that have no lookup row. If fix is
+// set, the orphaned lookup rows are deleted and the missing ones are
+// inserted. maxRows is the maximum number of rows read from each shard.
+// The tables should not change during the scan: rows changed by
+// concurrent transactions may be reported incorrectly.
+func (wr *Wrangler) VerifyLookupVindex(ctx context.Context, keyspace, vindexName string, fix bool, maxRows int) (*LookupVindexReport, error) {
+	info, err := wr.findLookupVindex(ctx, keyspace, vindexName)
+	if err != nil {
+		return nil, err
+	}
+	ownerEntries, err := wr.scanOwnerTable(ctx, info, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	lookupEntries, err := wr.scanLookupTable(ctx, info, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	report := diffLookupEntries(ownerEntries, lookupEntries)
+	if err := wr.assignLookupShards(ctx, info, report.Missing); err != nil {
+		return nil, err
+	}
+	for _, entry := range report.Orphans {
+		wr.Logger().Printf("orphaned lookup row: %v\n", entry)
+	}
+	for _, entry := range report.Missing {
+		wr.Logger().Printf("missing lookup row: %v\n", entry)
+	}
+	if !fix {
+		return report, nil
+	}
+	for _, entry := range report.Orphans {
+		if err := wr.execLookupFix(ctx, info, entry, info.deleteQuery(entry)); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range report.Missing {
+		if err := wr.execLookupFix(ctx, info, entry, info.insertQuery(entry)); err != nil {
+			return nil, err
+		}
+	}
+	wr.Logger().Printf("deleted %v orphaned and inserted %v missing lookup rows\n", len(report.Orphans), len(report.Missing))
+	return report, nil
+}
+
+// findLookupVindex reads the vschema of keyspace, and returns the info
+// of its vindexName lookup vindex.
+func (wr *Wrangler) findLookupVindex(ctx context.Context, keyspace, vindexName string) (*lookupVindexInfo, error) {
+	vschema, err := wr.ts.GetVSchema(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	vindexInfo, ok := vschema.Vindexes[vindexName]
+	if !ok {
+		return nil, fmt.Errorf("vindex %v not found in keyspace %v", vindexName, keyspace)
+	}
+	if vindexInfo.Owner == "" {
+		return nil, fmt.Errorf("vindex %v has no owner table", vindexName)
+	}
+	ks, err := vindexes.BuildKeyspaceSchema(vschema, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ks.Vindexes[vindexName].(vindexes.Lookup); !ok {
+		return nil, fmt.Errorf("vindex %v is not a lookup vindex", vindexName)
+	}
+	info := &lookupVindexInfo{
+		ownerKeyspace: keyspace,
+		owner:         ks.Tables[vindexInfo.Owner],
+		toColumn:      vindexInfo.Params["to"],
+	}
+	info.lookupKeyspace, info.lookupTable = splitLookupTable(keyspace, vindexInfo.Params["table"])
+	if info.owner == nil {
+		return nil, fmt.Errorf("owner table %v of vindex %v not found", vindexInfo.Owner, vindexName)
+	}
+	for _, from := range strings.Split(vindexInfo.Params["from"], ",") {
+		info.fromColumns = append(info.fromColumns, strings.TrimSpace(from))
+	}
+	for _, cv := range info.owner.Owned {
+		if cv.Name == vindexName {
+			info.ownerColumns = cv.Columns
+		}
+	}
+	if len(info.ownerColumns) != len(info.fromColumns) {
+		return nil, fmt.Errorf("owner table %v does not have the %v columns of vindex %v", vindexInfo.Owner, len(info.fromColumns), vindexName)
+	}
+	if _, ok := info.owner.ColumnVindexes[0].Vindex.(vindexes.Lookup); ok {
+		return nil, fmt.Errorf("primary vindex of owner table %v must be functional", vindexInfo.Owner)
+	}
+	return info, nil
+}
+
+// scanOwnerTable returns the lookup entries that the rows of the owner
+// table should have. The keyspace ids are computed with the primary
+// vindex of the table, which must be functional.
+func (wr *Wrangler) scanOwnerTable(ctx context.Context, info *lookupVindexInfo, maxRows int) ([]*LookupEntry, error) {
+	primary := info.owner.ColumnVindexes[0]
+	buf := &bytes.Buffer{}
+	buf.WriteString("select ")
+	for _, col := range primary.Columns {
+		fmt.Fprintf(buf, "%s, ", sqlparser.String(col))
+	}
+	for i, col := range info.ownerColumns {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(sqlparser.String(col))
+	}
+	fmt.Fprintf(buf, " from %s", sqlparser.String(info.owner.Name))
+
+	rowsByShard, err := wr.scanShards(ctx, info.ownerKeyspace, buf.String(), maxRows)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*LookupEntry
+	for _, rows := range rowsByShard {
+		ksids, err := mapPrimaryVindex(primary, rows)
+		if err != nil {
+			return nil, err
+		}
+		for i, row := range rows {
+			entries = append(entries, &LookupEntry{
+				From: row[len(primary.Columns):],
+				Ksid: ksids[i],
+			})
+		}
+	}
+	return entries, nil
+}
+
+// scanLookupTable returns the rows of the lookup table.
+func (wr *Wrangler) scanLookupTable(ctx context.Context, info *lookupVindexInfo, maxRows int) ([]*LookupEntry, error) {
+	query := fmt.Sprintf("select %s, %s from %s", strings.Join(info.fromColumns, ", "), info.toColumn, info.lookupTable)
+	rowsByShard, err := wr.scanShards(ctx, info.lookupKeyspace, query, maxRows)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*LookupEntry
+	for shard, rows := range rowsByShard {
+		for _, row := range rows {
+			entries = append(entries, &LookupEntry{
+				From:  row[:len(info.fromColumns)],
+				Ksid:  row[len(info.fromColumns)].ToBytes(),
+				Shard: shard,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// scanShards executes query on the master of every shard of keyspace,
+// and returns the rows by shard.
+func (wr *Wrangler) scanShards(ctx context.Context, keyspace, query string, maxRows int) (map[string][][]sqltypes.Value, error) {
+	shards, err := wr.ts.FindAllShardsInKeyspace(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	rowsByShard := make(map[string][][]sqltypes.Value, len(shards))
+	for name, si := range shards {
+		qr, err := wr.executeOnMaster(ctx, si, query, maxRows)
+		if err != nil {
+			return nil, err
+		}
+		rowsByShard[name] = sqltypes.Proto3ToResult(qr).Rows
+	}
+	return rowsByShard, nil
+}
+
+// mapPrimaryVindex returns the keyspace ids of rows, which start
+// with the columns of the primary vindex primary.
+func mapPrimaryVindex(primary *vindexes.ColumnVindex, rows [][]sqltypes.Value) ([][]byte, error) {
+	var ksids []vindexes.KsidOrRange
+	var err error
+	switch vindex := primary.Vindex.(type) {
+	case vindexes.MultiColumn:
+		rowsColValues := make([][]sqltypes.Value, len(rows))
+		for i, row := range rows {
+			rowsColValues[i] = row[:len(primary.Columns)]
+		}
+		ksids, err = vindex.MapMulti(nil, rowsColValues)
+	case vindexes.Unique:
+		ids := make([]sqltypes.Value, len(rows))
+		for i, row := range rows {
+			ids[i] = row[0]
+		}
+		ksids, err = vindex.Map(nil, ids)
+	default:
+		return nil, fmt.Errorf("primary vindex %v is not unique", primary.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(ksids))
+	for i, ksid := range ksids {
+		if ksid.ID == nil {
+			return nil, fmt.Errorf("could not map %v to a keyspace id", rows[i][:len(primary.Columns)])
+		}
+		out[i] = ksid.ID
+	}
+	return out, nil
+}
+
+// diffLookupEntries returns the lookup entries that have no owner
+// entry, and the owner entries that have no lookup entry. The
+// entries are sorted.
+func diffLookupEntries(ownerEntries, lookupEntries []*LookupEntry) *LookupVindexReport {
+	owned := make(map[string]bool, len(ownerEntries))
+	for _, entry := range ownerEntries {
+		owned[entry.key()] = true
+	}
+	found := make(map[string]bool, len(lookupEntries))
+	report := &LookupVindexReport{}
+	for _, entry := range lookupEntries {
+		key := entry.key()
+		found[key] = true
+		if !owned[key] {
+			report.Orphans = append(report.Orphans, entry)
+		}
+	}
+	for _, entry := range ownerEntries {
+		key := entry.key()
+		if !found[key] {
+			report.Missing = append(report.Missing, entry)
+			// Don't report the same entry twice for
+			// a non-unique vindex.
+			found[key] = true
+		}
+	}
+	sortLookupEntries(report.Orphans)
+	sortLookupEntries(report.Missing)
+	return report
+}
+
+func sortLookupEntries(entries []*LookupEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key() < entries[j].key()
+	})
+}
+
+// assignLookupShards sets the shard of the lookup table that each of
+// the entries belongs to. If the lookup keyspace is sharded, the shard
+// is found with the primary vindex of the lookup table, which must be
+// functional and on one of the from columns.
+func (wr *Wrangler) assignLookupShards(ctx context.Context, info *lookupVindexInfo, entries []*LookupEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	shards, err := wr.ts.FindAllShardsInKeyspace(ctx, info.lookupKeyspace)
+	if err != nil {
+		return err
+	}
+	vschema, err := wr.ts.GetVSchema(ctx, info.lookupKeyspace)
+	if err != nil {
+		return err
+	}
+	if !vschema.Sharded {
+		for name := range shards {
+			for _, entry := range entries {
+				entry.Shard = name
+			}
+			return nil
+		}
+		return fmt.Errorf("no shards in keyspace %v", info.lookupKeyspace)
+	}
+
+	ks, err := vindexes.BuildKeyspaceSchema(vschema, info.lookupKeyspace)
+	if err != nil {
+		return err
+	}
+	table, ok := ks.Tables[info.lookupTable]
+	if !ok {
+		return fmt.Errorf("lookup table %v not found in keyspace %v", info.lookupTable, info.lookupKeyspace)
+	}
+	primary := table.ColumnVindexes[0]
+	if _, ok := primary.Vindex.(vindexes.Lookup); ok {
+		return fmt.Errorf("primary vindex of lookup table %v must be functional", info.lookupTable)
+	}
+	var colnums []int
+	for _, col := range primary.Columns {
+		colnum := -1
+		for i, from := range info.fromColumns {
+			if col.EqualString(from) {
+				colnum = i
+			}
+		}
+		if colnum == -1 {
+			return fmt.Errorf("primary vindex column %v of lookup table %v is not a from column", col, info.lookupTable)
+		}
+		colnums = append(colnums, colnum)
+	}
+	rows := make([][]sqltypes.Value, len(entries))
+	for i, entry := range entries {
+		for _, colnum := range colnums {
+			rows[i] = append(rows[i], entry.From[colnum])
+		}
+	}
+	ksids, err := mapPrimaryVindex(primary, rows)
+	if err != nil {
+		return err
+	}
+	for i, ksid := range ksids {
+		for name, si := range shards {
+			if key.KeyRangeContains(si.KeyRange, ksid) {
+				entries[i].Shard = name
+				break
+			}
+		}
+		if entries[i].Shard == "" {
+			return fmt.Errorf("no shard in keyspace %v for lookup row %v", info.lookupKeyspace, entries[i])
+		}
+	}
+	return nil
+}
+
+// deleteQuery returns the query that deletes the lookup row of entry.
+func (info *lookupVindexInfo) deleteQuery(entry *LookupEntry) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "delete from %s where ", info.lookupTable)
+	for i, col := range info.fromColumns {
+		fmt.Fprintf(buf, "%s = ", col)
+		sqlparser.EncodeValue(buf, sqltypes.ValueBindVariable(entry.From[i]))
+		buf.WriteString(" and ")
+	}
+	fmt.Fprintf(buf, "%s = ", info.toColumn)
+	sqlparser.EncodeValue(buf, sqltypes.BytesBindVariable(entry.Ksid))
+	return buf.String()
+}
+
+// insertQuery returns the query that inserts the lookup row of entry.
+func (info *lookupVindexInfo) insertQuery(entry *LookupEntry) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "insert into %s(%s, %s) values(", info.lookupTable, strings.Join(info.fromColumns, ", "), info.toColumn)
+	for _, v := range entry.From {
+		sqlparser.EncodeValue(buf, sqltypes.ValueBindVariable(v))
+		buf.WriteString(", ")
+	}
+	sqlparser.EncodeValue(buf, sqltypes.BytesBindVariable(entry.Ksid))
+	buf.WriteString(")")
+	return buf.String()
+}
+
+// execLookupFix executes query on the master of the lookup table
+// shard of entry.
+func (wr *Wrangler) execLookupFix(ctx context.Context, info *lookupVindexInfo, entry *LookupEntry, query string) error {
+	si, err := wr.ts.GetShard(ctx, info.lookupKeyspace, entry.Shard)
+	if err != nil {
+		return err
+	}
+	_, err = wr.executeOnMaster(ctx, si, query, 0)
+	return err
+}
+
+func (wr *Wrangler) executeOnMaster(ctx context.Context, si *topo.ShardInfo, query string, maxRows int) (*querypb.QueryResult, error) {
+	if !si.HasMaster() {
+		return nil, fmt.Errorf("no master in shard %v/%v", si.Keyspace(), si.ShardName())
+	}
+	return wr.ExecuteFetchAsDba(ctx, si.MasterAlias, query, maxRows, false /* disableBinlogs */, false /* reloadSchema */)
+}
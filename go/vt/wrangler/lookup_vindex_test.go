@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package wrangler
+
+import (
+	"reflect"
+	"testing"
+
+	"vitess.io/vitess/go/sqltypes"
+)
+
+func TestDiffLookupEntries(t *testing.T) {
+	owner := []*LookupEntry{{
+		From: []sqltypes.Value{sqltypes.NewInt64(1)},
+		Ksid: []byte("\x16"),
+	}, {
+		From: []sqltypes.Value{sqltypes.NewInt64(2)},
+		Ksid: []byte("\x06"),
+	}, {
+		// Two owner rows with the same entry are reported once.
+		From: []sqltypes.Value{sqltypes.NewInt64(3)},
+		Ksid: []byte("\x4e"),
+	}, {
+		From: []sqltypes.Value{sqltypes.NewInt64(3)},
+		Ksid: []byte("\x4e"),
+	}}
+	lookup := []*LookupEntry{{
+		// The types of the values don't matter.
+		From:  []sqltypes.Value{sqltypes.NewVarBinary("1")},
+		Ksid:  []byte("\x16"),
+		Shard: "0",
+	}, {
+		From:  []sqltypes.Value{sqltypes.NewVarBinary("2")},
+		Ksid:  []byte("\x16"),
+		Shard: "0",
+	}}
+	got := diffLookupEntries(owner, lookup)
+	want := &LookupVindexReport{
+		Orphans: []*LookupEntry{lookup[1]},
+		Missing: []*LookupEntry{owner[1], owner[2]},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffLookupEntries:\n%v, want\n%v", got, want)
+	}
+}
+
+func TestLookupFixQueries(t *testing.T) {
+	info := &lookupVindexInfo{
+		lookupTable: "name_user_idx",
+		fromColumns: []string{"name", "region"},
+		toColumn:    "keyspace_id",
+	}
+	entry := &LookupEntry{
+		From: []sqltypes.Value{sqltypes.NewVarChar("a'b"), sqltypes.NewInt64(1)},
+		Ksid: []byte("\x16k@"),
+	}
+	want := "delete from name_user_idx where name = 'a\\'b' and region = 1 and keyspace_id = '\x16k@'"
+	if got := info.deleteQuery(entry); got != want {
+		t.Errorf("deleteQuery: %q, want %q", got, want)
+	}
+	want = "insert into name_user_idx(name, region, keyspace_id) values('a\\'b', 1, '\x16k@')"
+	if got := info.insertQuery(entry); got != want {
+		t.Errorf("insertQuery: %q, want %q", got, want)
+	}
+}
@@ -581,11 +581,18 @@ func (wr *Wrangler) EmergencyReparentShard(ctx context.Context, keyspace, shard
 	}
 	defer unlock(&err)
 
+	return wr.EmergencyReparentShardLocked(ctx, keyspace, shard, masterElectTabletAlias, waitSlaveTimeout)
+}
+
+// EmergencyReparentShardLocked is EmergencyReparentShard for callers
+// that already hold the shard lock, like the automatic failover that
+// decides to reparent under it.
+func (wr *Wrangler) EmergencyReparentShardLocked(ctx context.Context, keyspace, shard string, masterElectTabletAlias *topodatapb.TabletAlias, waitSlaveTimeout time.Duration) error {
 	// Create reusable Reparent event with available info
 	ev := &events.Reparent{}
 
 	// do the work
-	err = wr.emergencyReparentShardLocked(ctx, ev, keyspace, shard, masterElectTabletAlias, waitSlaveTimeout)
+	err := wr.emergencyReparentShardLocked(ctx, ev, keyspace, shard, masterElectTabletAlias, waitSlaveTimeout)
 	if err != nil {
 		event.DispatchUpdate(ev, "failed EmergencyReparentShard: "+err.Error())
 	} else {
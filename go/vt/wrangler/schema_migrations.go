@@ -0,0 +1,111 @@
+/*
+Copyright 2018 Google Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreedto in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wrangler
+
+// This file manages the online schema changes queued by ApplySchema
+// with -ddl_strategy=online, see the onlineddl package.
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+
+	"vitess.io/vitess/go/sqltypes"
+	"vitess.io/vitess/go/vt/vttablet/onlineddl"
+)
+
+// ShowSchemaMigrations returns the online schema changes of the
+// shards of keyspace, or only the one of uuid if it's not empty.
+func (wr *Wrangler) ShowSchemaMigrations(ctx context.Context, keyspace, uuid string) (*sqltypes.Result, error) {
+	query := onlineddl.QueryMigrations()
+	if uuid != "" {
+		query = onlineddl.QueryMigration(uuid)
+	}
+	results, err := wr.executeOnMigrationMasters(ctx, keyspace, query)
+	if err != nil {
+		return nil, err
+	}
+	result := &sqltypes.Result{}
+	for _, qr := range results {
+		result.Fields = qr.Fields
+		result.Rows = append(result.Rows, qr.Rows...)
+	}
+	result.RowsAffected = uint64(len(result.Rows))
+	return result, nil
+}
+
+// CancelSchemaMigration cancels the online schema change of uuid on
+// the shards of keyspace where it's queued or running. Its stream
+// stops and its shadow table is dropped.
+func (wr *Wrangler) CancelSchemaMigration(ctx context.Context, keyspace, uuid string) error {
+	return wr.updateSchemaMigration(ctx, keyspace, uuid, onlineddl.CancelMigration(uuid), "queued or running")
+}
+
+// RetrySchemaMigration queues again the online schema change of uuid
+// on the shards of keyspace where it failed or was cancelled.
+func (wr *Wrangler) RetrySchemaMigration(ctx context.Context, keyspace, uuid string) error {
+	return wr.updateSchemaMigration(ctx, keyspace, uuid, onlineddl.RetryMigration(uuid), "failed or cancelled")
+}
+
+func (wr *Wrangler) updateSchemaMigration(ctx context.Context, keyspace, uuid, query, states string) error {
+	results, err := wr.executeOnMigrationMasters(ctx, keyspace, query)
+	if err != nil {
+		return err
+	}
+	shards := make([]string, 0, len(results))
+	for shard, qr := range results {
+		if qr.RowsAffected != 0 {
+			shards = append(shards, shard)
+		}
+	}
+	if len(shards) == 0 {
+		return fmt.Errorf("no %v migration %v in keyspace %v", states, uuid, keyspace)
+	}
+	sort.Strings(shards)
+	wr.Logger().Printf("updated migration %v on shards %v\n", uuid, shards)
+	return nil
+}
+
+// executeOnMigrationMasters runs query on the master of each shard
+// of keyspace, after it creates the _vt.schema_migrations table if
+// needed. It returns the results by shard.
+func (wr *Wrangler) executeOnMigrationMasters(ctx context.Context, keyspace, query string) (map[string]*sqltypes.Result, error) {
+	shards, err := wr.ts.GetShardNames(ctx, keyspace)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(shards)
+	results := make(map[string]*sqltypes.Result, len(shards))
+	for _, shard := range shards {
+		si, err := wr.ts.GetShard(ctx, keyspace, shard)
+		if err != nil {
+			return nil, err
+		}
+		for _, create := range onlineddl.CreateSchemaMigrationsTable() {
+			if _, err := wr.executeOnMaster(ctx, si, create, 0); err != nil {
+				return nil, err
+			}
+		}
+		qr, err := wr.executeOnMaster(ctx, si, query, 10000)
+		if err != nil {
+			return nil, err
+		}
+		results[shard] = sqltypes.Proto3ToResult(qr)
+	}
+	return results, nil
+}